@@ -0,0 +1,243 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench measures how quickly the archive operations run on synthetic trees of files.
+//
+// A tree of files with pseudo-random contents is generated, snapshotted
+// into a new archive, modified, and snapshotted again, and the latest
+// snapshot is then compared with the first and restored to a new
+// directory. Each of these phases is timed, so that settings such as the
+// number of concurrent jobs can be tuned for the machine and the disk
+// that the archive is on.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Config describes the synthetic tree of files to benchmark with.
+type Config struct {
+	// Files is the number of regular files in the tree.
+	Files int
+
+	// FileSize is the average size in bytes of each file.
+	//
+	// The sizes of the files are spread evenly between zero and twice this.
+	FileSize int64
+
+	// FilesPerDir is the maximum number of files in each directory.
+	FilesPerDir int
+
+	// ChangeRatio is the fraction of the files that are modified before the second snapshot.
+	ChangeRatio float64
+
+	// Seed seeds the pseudo-random file sizes and contents, so that runs with the same seed use the same tree.
+	Seed int64
+}
+
+// Result is the measurement of a single phase of the benchmark.
+type Result struct {
+	// Phase names what was measured, such as "snapshot".
+	Phase string
+
+	// Files is the number of files that the phase processed.
+	Files int
+
+	// Bytes is the number of bytes of file contents that the phase processed.
+	Bytes int64
+
+	// Duration is how long the phase took.
+	Duration time.Duration
+}
+
+// FilesPerSecond returns the rate at which the phase processed files.
+func (r *Result) FilesPerSecond() float64 {
+	return float64(r.Files) / r.Duration.Seconds()
+}
+
+// BytesPerSecond returns the rate at which the phase processed file contents.
+func (r *Result) BytesPerSecond() float64 {
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// generatedTime is the modification time of the generated files.
+//
+// Files modified within a second of a snapshot starting are never added
+// to the path info cache, so the generated files are backdated in order
+// for later snapshots to measure the cache rather than rehashing them.
+func generatedTime() time.Time {
+	return time.Now().Add(-time.Hour)
+}
+
+// writeFile writes `size` pseudo-random bytes to the file `p`.
+func writeFile(p string, rnd *rand.Rand, size int64, mtime time.Time) error {
+	out, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("failure creating the file %q: %w", p, err)
+	}
+	if _, err := io.CopyN(out, rnd, size); err != nil {
+		out.Close()
+		return fmt.Errorf("failure writing the file %q: %w", p, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure writing the file %q: %w", p, err)
+	}
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		return fmt.Errorf("failure setting the modification time of %q: %w", p, err)
+	}
+	return nil
+}
+
+// filePath returns the location of the i'th file of the tree in `dir`.
+func (c *Config) filePath(dir string, i int) string {
+	perDir := c.FilesPerDir
+	if perDir <= 0 {
+		perDir = c.Files
+	}
+	return filepath.Join(dir, fmt.Sprintf("dir-%d", i/perDir), fmt.Sprintf("file-%d", i))
+}
+
+// Generate writes the tree of files described by the config to the new directory `dir`.
+//
+// The returned value is the total size of the files.
+func (c *Config) Generate(dir string) (int64, error) {
+	rnd := rand.New(rand.NewSource(c.Seed))
+	mtime := generatedTime()
+	var total int64
+	for i := 0; i < c.Files; i++ {
+		p := c.filePath(dir, i)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return 0, fmt.Errorf("failure creating the directory %q: %w", filepath.Dir(p), err)
+		}
+		size := rnd.Int63n(2*c.FileSize + 1)
+		if err := writeFile(p, rnd, size, mtime); err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Modify rewrites the fraction `ChangeRatio` of the files in the tree generated in `dir`.
+//
+// The returned values are the number of files modified and their new total size.
+func (c *Config) Modify(dir string) (int, int64, error) {
+	rnd := rand.New(rand.NewSource(c.Seed + 1))
+	// The modified files must not match the path info cache, so their modification times differ from the originals.
+	mtime := generatedTime().Add(time.Minute)
+	var changed int
+	var total int64
+	for i := 0; i < c.Files; i++ {
+		if rnd.Float64() >= c.ChangeRatio {
+			continue
+		}
+		size := rnd.Int63n(2*c.FileSize + 1)
+		if err := writeFile(c.filePath(dir, i), rnd, size, mtime); err != nil {
+			return 0, 0, err
+		}
+		changed++
+		total += size
+	}
+	return changed, total, nil
+}
+
+// treeSize returns the total size of the regular files in `dir`.
+func treeSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failure measuring the size of %q: %w", dir, err)
+	}
+	return total, nil
+}
+
+// Run runs the benchmark in the new directory `dir`, and returns the measurement of each phase.
+//
+// The archive `s` must be a new, empty archive, and the snapshots are
+// generated with the given options. Restores use `jobs` concurrent jobs.
+func Run(ctx context.Context, s *storage.LocalFiles, dir string, c *Config, jobs int, opts ...snapshot.Option) ([]*Result, error) {
+	tree := snapshot.Path(filepath.Join(dir, "tree"))
+	size, err := c.Generate(string(tree))
+	if err != nil {
+		return nil, err
+	}
+	var results []*Result
+	timed := func(phase string, files int, bytes int64, f func() error) error {
+		start := time.Now()
+		if err := f(); err != nil {
+			return fmt.Errorf("failure running the %q phase: %w", phase, err)
+		}
+		results = append(results, &Result{Phase: phase, Files: files, Bytes: bytes, Duration: time.Since(start)})
+		return nil
+	}
+	snapshotTree := func(h **snapshot.Hash) func() error {
+		return func() (err error) {
+			*h, _, err = snapshot.NewSnapshotter(s, opts...).Snapshot(ctx, tree)
+			return err
+		}
+	}
+	var first, unchanged, second *snapshot.Hash
+	if err := timed("snapshot", c.Files, size, snapshotTree(&first)); err != nil {
+		return nil, err
+	}
+	if err := timed("snapshot-unchanged", c.Files, 0, snapshotTree(&unchanged)); err != nil {
+		return nil, err
+	}
+	changed, changedSize, err := c.Modify(string(tree))
+	if err != nil {
+		return nil, err
+	}
+	if err := timed("snapshot-changed", changed, changedSize, snapshotTree(&second)); err != nil {
+		return nil, err
+	}
+	if err := timed("diff", changed, 0, func() error {
+		_, err := diff.Compare(ctx, s, first, second)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	restoredSize, err := treeSize(string(tree))
+	if err != nil {
+		return nil, err
+	}
+	restored := snapshot.Path(filepath.Join(dir, "restored"))
+	if err := timed("restore", c.Files, restoredSize, func() error {
+		return merge.Checkout(ctx, s, second, restored, merge.WithJobs(jobs))
+	}); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	c := &Config{Files: 20, FileSize: 100, FilesPerDir: 6, ChangeRatio: 0.5, Seed: 1}
+	results, err := Run(ctx, s, dir, c, 2)
+	if err != nil {
+		t.Fatalf("failure running the benchmark: %v", err)
+	}
+	var phases []string
+	for _, r := range results {
+		phases = append(phases, r.Phase)
+		if r.Duration <= 0 {
+			t.Errorf("unexpected duration for the %q phase: %v", r.Phase, r.Duration)
+		}
+	}
+	want := []string{"snapshot", "snapshot-unchanged", "snapshot-changed", "diff", "restore"}
+	if len(phases) != len(want) {
+		t.Fatalf("unexpected phases: got %q, want %q", phases, want)
+	}
+	for i := range want {
+		if phases[i] != want[i] {
+			t.Errorf("unexpected phase %d: got %q, want %q", i, phases[i], want[i])
+		}
+	}
+	if changed := results[2].Files; changed == 0 || changed == c.Files {
+		t.Errorf("unexpected number of changed files: %d of %d", changed, c.Files)
+	}
+	if got := len(mustReadDir(t, filepath.Join(dir, "tree"))); got != 4 {
+		t.Errorf("unexpected number of directories in the tree: got %d, want 4", got)
+	}
+	for i := 0; i < c.Files; i++ {
+		original, err := os.ReadFile(c.filePath(filepath.Join(dir, "tree"), i))
+		if err != nil {
+			t.Fatalf("failure reading generated file %d: %v", i, err)
+		}
+		restored, err := os.ReadFile(c.filePath(filepath.Join(dir, "restored"), i))
+		if err != nil {
+			t.Fatalf("failure reading restored file %d: %v", i, err)
+		}
+		if !bytes.Equal(original, restored) {
+			t.Errorf("restored file %d does not match the modified tree", i)
+		}
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	c := &Config{Files: 5, FileSize: 50, Seed: 42}
+	var trees [][]byte
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(t.TempDir(), name)
+		if _, err := c.Generate(dir); err != nil {
+			t.Fatalf("failure generating the tree: %v", err)
+		}
+		var all []byte
+		for i := 0; i < c.Files; i++ {
+			contents, err := os.ReadFile(c.filePath(dir, i))
+			if err != nil {
+				t.Fatalf("failure reading generated file %d: %v", i, err)
+			}
+			all = append(all, contents...)
+		}
+		trees = append(trees, all)
+	}
+	if !bytes.Equal(trees[0], trees[1]) {
+		t.Error("trees generated with the same seed differ")
+	}
+}
+
+func mustReadDir(t *testing.T, dir string) []os.DirEntry {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failure reading the directory %q: %v", dir, err)
+	}
+	return entries
+}
@@ -20,45 +20,135 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/log"
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
 )
 
-func addFileToZipWriter(ctx context.Context, s *storage.LocalFiles, w *zip.Writer, h *snapshot.Hash, f *snapshot.File) ([]*snapshot.Hash, error) {
-	fw, err := w.Create(fmt.Sprintf("%s/%s", h.Function(), h.HexContents()))
+// deletedManifest is the name of the bundle entry listing the files deleted in an incremental export.
+const deletedManifest = "DELETED"
+
+// snapshotsManifest is the name of the bundle entry listing the snapshots that were exported.
+const snapshotsManifest = "SNAPSHOTS"
+
+// writeSnapshotsManifest writes the list of exported snapshots, one hash per line.
+func writeSnapshotsManifest(zw *zip.Writer, snapshots []*snapshot.Hash) error {
+	mw, err := zw.Create(snapshotsManifest)
 	if err != nil {
-		return nil, fmt.Errorf("failure creating the zip file entry for %q: %v", h, err)
+		return fmt.Errorf("failure creating the snapshots manifest: %w", err)
+	}
+	for _, h := range snapshots {
+		if _, err := fmt.Fprintln(mw, h); err != nil {
+			return fmt.Errorf("failure writing the snapshots manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// exporter writes snapshots to a zip file.
+type exporter struct {
+	s *storage.LocalFiles
+	w *zip.Writer
+
+	// skip holds the hashes of objects that should not be written.
+	skip map[snapshot.Hash]struct{}
+
+	// written holds the hashes of objects that have already been written.
+	written map[snapshot.Hash]struct{}
+
+	// history means that the parents of each snapshot are exported too.
+	history bool
+
+	// skipContents means that the contents of regular files are not written.
+	skipContents bool
+}
+
+func (e *exporter) addObject(ctx context.Context, h *snapshot.Hash) error {
+	if _, ok := e.written[*h]; ok {
+		return nil
 	}
-	if _, err := fw.Write([]byte(f.String())); err != nil {
-		return nil, fmt.Errorf("failure writing the zip file entry for %q: %v", h, err)
+	if _, ok := e.skip[*h]; ok {
+		return nil
+	}
+	e.written[*h] = struct{}{}
+	reader, err := e.s.ReadObject(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	defer reader.Close()
+	ow, err := e.w.Create(fmt.Sprintf("%s/%s", h.Function(), h.HexContents()))
+	if err != nil {
+		return fmt.Errorf("failure creating the zip file entry for %q: %w", h, err)
+	}
+	if _, err := io.Copy(ow, reader); err != nil {
+		return fmt.Errorf("failure writing the zip file entry for %q: %w", h, err)
+	}
+	return nil
+}
+
+// addFile writes the given file snapshot and its contents, returning the snapshots of any children.
+//
+// When exporting history, the returned snapshots include the parents of `h`.
+func (e *exporter) addFile(ctx context.Context, h *snapshot.Hash, f *snapshot.File) ([]*snapshot.Hash, error) {
+	if err := e.addObject(ctx, h); err != nil {
+		return nil, err
+	}
+	var next []*snapshot.Hash
+	if e.history {
+		next = append(next, f.Parents...)
 	}
 	if f.Contents == nil {
-		return nil, nil
+		return next, nil
 	}
-	if f.IsDir() {
-		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
-		if err != nil {
-			return nil, fmt.Errorf("failure reading the contents of the directory snapshot %q: %v", h, err)
-		}
-		var next []*snapshot.Hash
-		for _, childHash := range tree {
-			next = append(next, childHash)
-		}
+	if e.skipContents && !f.IsDir() && !f.IsLink() {
 		return next, nil
 	}
-	contentsReader, err := s.ReadObject(ctx, f.Contents)
-	if err != nil {
-		return nil, fmt.Errorf("failure opening the contents of the link snapshot %q: %v", h, err)
+	if err := e.addObject(ctx, f.Contents); err != nil {
+		return nil, fmt.Errorf("failure adding the contents of %q: %w", h, err)
 	}
-	cw, err := w.Create(fmt.Sprintf("%s/%s", f.Contents.Function(), f.Contents.HexContents()))
+	if !f.IsDir() {
+		return next, nil
+	}
+	tree, err := e.s.ListDirectorySnapshotContents(ctx, h, f)
 	if err != nil {
-		return nil, fmt.Errorf("failure creating the zip file entry for the contents %q: %v", f.Contents, err)
+		return nil, fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", h, err)
 	}
-	if _, err := io.Copy(cw, contentsReader); err != nil {
-		return nil, fmt.Errorf("failure writing the zip file entry for the contents %q: %v", f.Contents, err)
+	for _, childHash := range tree {
+		next = append(next, childHash)
 	}
-	return nil, nil
+	return next, nil
+}
+
+func (e *exporter) export(ctx context.Context, snapshots []*snapshot.Hash) error {
+	visited := make(map[snapshot.Hash]struct{})
+	for len(snapshots) > 0 {
+		var next []*snapshot.Hash
+		for _, h := range snapshots {
+			visited[*h] = struct{}{}
+			if _, ok := e.skip[*h]; ok {
+				// The snapshot, and everything it contains, is being skipped.
+				continue
+			}
+			f, err := e.s.ReadSnapshot(ctx, h)
+			if err != nil {
+				return fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+			}
+			children, err := e.addFile(ctx, h, f)
+			if err != nil {
+				return fmt.Errorf("failure adding %q to the zip file: %w", h, err)
+			}
+			for _, childHash := range children {
+				if _, ok := visited[*childHash]; !ok {
+					next = append(next, childHash)
+				}
+			}
+		}
+		snapshots = next
+	}
+	return nil
 }
 
 // Export writes a bundle with the specified snapshots to the given writer.
@@ -75,27 +165,119 @@ func Export(ctx context.Context, s *storage.LocalFiles, w io.Writer, snapshots [
 			err = ce
 		}
 	}()
+	e := &exporter{
+		s:       s,
+		w:       zw,
+		written: make(map[snapshot.Hash]struct{}),
+	}
+	if err := e.export(ctx, snapshots); err != nil {
+		return err
+	}
+	return writeSnapshotsManifest(zw, snapshots)
+}
 
-	visited := make(map[snapshot.Hash]struct{})
-	for len(snapshots) > 0 {
-		var next []*snapshot.Hash
-		for _, h := range snapshots {
-			visited[*h] = struct{}{}
-			f, err := s.ReadSnapshot(ctx, h)
-			if err != nil {
-				return fmt.Errorf("failure reading the snapshot %q: %v", h, err)
-			}
-			children, err := addFileToZipWriter(ctx, s, zw, h, f)
+// reachableObjects returns the hashes of every object contained in the snapshot `h`.
+//
+// The history of the snapshot is not included.
+func reachableObjects(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) (map[snapshot.Hash]struct{}, error) {
+	reachable := make(map[snapshot.Hash]struct{})
+	queue := []*snapshot.Hash{h}
+	for len(queue) > 0 {
+		h, queue = queue[0], queue[1:]
+		if _, ok := reachable[*h]; ok {
+			continue
+		}
+		reachable[*h] = struct{}{}
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+		}
+		if f.Contents == nil {
+			continue
+		}
+		reachable[*f.Contents] = struct{}{}
+		if f.IsDir() {
+			tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
 			if err != nil {
-				return fmt.Errorf("failure adding %q to the zip file: %v", h, err)
+				return nil, fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", h, err)
 			}
-			for _, childHash := range children {
-				if _, ok := visited[*childHash]; !ok {
-					next = append(next, childHash)
-				}
+			for _, child := range tree {
+				queue = append(queue, child)
 			}
 		}
-		snapshots = next
+	}
+	return reachable, nil
+}
+
+// ExportIncremental writes a bundle containing only the parts of the snapshot `h` that are not in the snapshot `base`.
+//
+// Objects that are contained in `base` are left out of the bundle, so
+// it only holds the contents of files that were added or changed.
+//
+// Every snapshot in the history of `h` that is not also in the history
+// of `base` is included, so that the full log of `h` can be read once
+// the bundle is applied on top of `base`.
+//
+// The bundle also includes a manifest named `DELETED`, listing the
+// paths (relative to the snapshot) of the files that were removed,
+// one per line, with each path quoted as a Go string literal.
+func ExportIncremental(ctx context.Context, s *storage.LocalFiles, w io.Writer, h, base *snapshot.Hash) (err error) {
+	skip, err := reachableObjects(ctx, s, base)
+	if err != nil {
+		return fmt.Errorf("failure listing the contents of the base snapshot %q: %w", base, err)
+	}
+	baseLog, err := log.ReadLog(ctx, s, base)
+	if err != nil {
+		return fmt.Errorf("failure reading the history of the base snapshot %q: %w", base, err)
+	}
+	headLog, err := log.ReadLog(ctx, s, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the history of %q: %w", h, err)
+	}
+	inBase := make(map[snapshot.Hash]struct{})
+	for _, entry := range baseLog {
+		inBase[*entry.Hash] = struct{}{}
+	}
+	var snapshots []*snapshot.Hash
+	for _, entry := range headLog {
+		if _, ok := inBase[*entry.Hash]; !ok {
+			snapshots = append(snapshots, entry.Hash)
+		}
+	}
+	changes, err := diff.Compare(ctx, s, base, h)
+	if err != nil {
+		return fmt.Errorf("failure comparing %q to the base snapshot %q: %w", h, base, err)
+	}
+	zw := zip.NewWriter(w)
+	defer func() {
+		ce := zw.Close()
+		if err == nil {
+			err = ce
+		}
+	}()
+	e := &exporter{
+		s:       s,
+		w:       zw,
+		skip:    skip,
+		written: make(map[snapshot.Hash]struct{}),
+	}
+	if err := e.export(ctx, snapshots); err != nil {
+		return err
+	}
+	if err := writeSnapshotsManifest(zw, []*snapshot.Hash{h}); err != nil {
+		return err
+	}
+	mw, err := zw.Create(deletedManifest)
+	if err != nil {
+		return fmt.Errorf("failure creating the deletion manifest: %w", err)
+	}
+	for _, c := range changes {
+		if c.After != nil {
+			continue
+		}
+		if _, err := fmt.Fprintln(mw, strconv.Quote(c.Path)); err != nil {
+			return fmt.Errorf("failure writing the deletion manifest: %w", err)
+		}
 	}
 	return nil
 }
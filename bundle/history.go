@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// historyManifest is the name of the bundle entry describing an exported history.
+const historyManifest = "HISTORY"
+
+// History describes the snapshot chain of a single path, as exported by `ExportHistory`.
+type History struct {
+	// Path is the path whose history was exported.
+	Path snapshot.Path
+
+	// Head is the latest snapshot of the path.
+	Head *snapshot.Hash
+
+	// Contents reports whether or not the contents of regular files were included.
+	Contents bool
+}
+
+// writeHistoryManifest records the exported history as `key value` lines.
+func writeHistoryManifest(zw *zip.Writer, history *History) error {
+	mw, err := zw.Create(historyManifest)
+	if err != nil {
+		return fmt.Errorf("failure creating the history manifest: %w", err)
+	}
+	if _, err := fmt.Fprintf(mw, "path %s\nhead %s\ncontents %t\n", strconv.Quote(string(history.Path)), history.Head, history.Contents); err != nil {
+		return fmt.Errorf("failure writing the history manifest: %w", err)
+	}
+	return nil
+}
+
+func readHistoryManifest(zf *zip.File) (*History, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the history manifest: %w", err)
+	}
+	defer r.Close()
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the history manifest: %w", err)
+	}
+	history := &History{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "path":
+			p, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("malformed path %q in the history manifest: %w", value, err)
+			}
+			history.Path = snapshot.Path(p)
+		case "head":
+			if history.Head, err = snapshot.ParseHash(value); err != nil {
+				return nil, fmt.Errorf("malformed head %q in the history manifest: %w", value, err)
+			}
+		case "contents":
+			if history.Contents, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("malformed contents setting %q in the history manifest: %w", value, err)
+			}
+		}
+		// Unknown keys are ignored, so that newer bundles can still be imported.
+	}
+	if history.Head == nil {
+		return nil, fmt.Errorf("the history manifest does not name a head snapshot: %w", storage.ErrCorrupt)
+	}
+	return history, nil
+}
+
+// ExportHistory writes a bundle holding the complete history of the path `p`, whose latest snapshot is `h`.
+//
+// Every snapshot reachable from `h` through its parents is exported,
+// along with the snapshots and directory listings they contain, so
+// that the history can be browsed after it is imported. The contents
+// of regular files are only included if `includeContents` is true.
+func ExportHistory(ctx context.Context, s *storage.LocalFiles, w io.Writer, p snapshot.Path, h *snapshot.Hash, includeContents bool) (err error) {
+	zw := zip.NewWriter(w)
+	defer func() {
+		ce := zw.Close()
+		if err == nil {
+			err = ce
+		}
+	}()
+	e := &exporter{
+		s:            s,
+		w:            zw,
+		written:      make(map[snapshot.Hash]struct{}),
+		history:      true,
+		skipContents: !includeContents,
+	}
+	if err := e.export(ctx, []*snapshot.Hash{h}); err != nil {
+		return err
+	}
+	if err := writeSnapshotsManifest(zw, []*snapshot.Hash{h}); err != nil {
+		return err
+	}
+	return writeHistoryManifest(zw, &History{Path: p, Head: h, Contents: includeContents})
+}
+
+// ImportHistory stores every object in the history bundle read from `r`, which is `size` bytes long.
+//
+// The returned history describes the path and head snapshot that were
+// exported; mapping a local path to that snapshot is left to the caller.
+func ImportHistory(ctx context.Context, s *storage.LocalFiles, r io.ReaderAt, size int64) (*History, error) {
+	_, history, err := importBundle(ctx, s, r, size)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		return nil, errors.New("the bundle does not hold the history of a path")
+	}
+	return history, nil
+}
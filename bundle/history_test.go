@@ -0,0 +1,82 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestExportImportHistory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "src")}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	var snapshots []*snapshot.Hash
+	for _, contents := range []string{"first", "second"} {
+		if err := os.WriteFile(filepath.Join(workDir, "example.txt"), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		h, _, err := snapshot.Current(ctx, src, snapshot.Path(workDir))
+		if err != nil {
+			t.Fatalf("failure snapshotting the working directory: %v", err)
+		}
+		snapshots = append(snapshots, h)
+	}
+	head := snapshots[1]
+	for _, includeContents := range []bool{false, true} {
+		dest := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, fmt.Sprintf("dest-%t", includeContents))}
+		var buf bytes.Buffer
+		if err := bundle.ExportHistory(ctx, src, &buf, snapshot.Path(workDir), head, includeContents); err != nil {
+			t.Fatalf("failure exporting the history: %v", err)
+		}
+		history, err := bundle.ImportHistory(ctx, dest, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("failure importing the history: %v", err)
+		}
+		if history.Path != snapshot.Path(workDir) || !history.Head.Equal(head) || history.Contents != includeContents {
+			t.Errorf("unexpected history imported: %+v", history)
+		}
+		for _, h := range snapshots {
+			f, err := dest.ReadSnapshot(ctx, h)
+			if err != nil {
+				t.Fatalf("failure reading the imported snapshot %q: %v", h, err)
+			}
+			tree, err := dest.ListDirectorySnapshotContents(ctx, h, f)
+			if err != nil {
+				t.Fatalf("failure listing the imported snapshot %q: %v", h, err)
+			}
+			child, err := dest.ReadSnapshot(ctx, tree["example.txt"])
+			if err != nil {
+				t.Fatalf("failure reading the imported file snapshot in %q: %v", h, err)
+			}
+			if got := dest.HasObject(ctx, child.Contents); got != includeContents {
+				t.Errorf("unexpected presence of the contents in %q with includeContents=%v: got %v", h, includeContents, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func readSnapshotsManifest(zf *zip.File) ([]*snapshot.Hash, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the snapshots manifest: %w", err)
+	}
+	defer r.Close()
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshots manifest: %w", err)
+	}
+	var snapshots []*snapshot.Hash
+	for _, line := range strings.Split(string(contents), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		h, err := snapshot.ParseHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("malformed entry %q in the snapshots manifest: %w", line, err)
+		}
+		snapshots = append(snapshots, h)
+	}
+	return snapshots, nil
+}
+
+func importObject(ctx context.Context, s *storage.LocalFiles, zf *zip.File) error {
+	parts := strings.SplitN(zf.Name, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("unexpected bundle entry %q", zf.Name)
+	}
+	h, err := snapshot.ParseHash(parts[0] + ":" + parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed object name %q in the bundle: %w", zf.Name, err)
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("failure opening the bundle entry for %q: %w", h, err)
+	}
+	defer r.Close()
+	if err := s.StoreVerifiedObject(ctx, r, h); err != nil {
+		return fmt.Errorf("failure importing the object %q: %w", h, err)
+	}
+	return nil
+}
+
+// Import stores every object in the bundle read from `r`, which is `size` bytes long.
+//
+// Each object is verified against its hash before it is stored. The
+// returned hashes are those of the snapshots that were exported into
+// the bundle. Bundles written before the list of exported snapshots
+// was recorded import successfully, but return no snapshots.
+func Import(ctx context.Context, s *storage.LocalFiles, r io.ReaderAt, size int64) ([]*snapshot.Hash, error) {
+	snapshots, _, err := importBundle(ctx, s, r, size)
+	return snapshots, err
+}
+
+// importBundle stores every object in the bundle, returning the exported snapshots and the history manifest, if any.
+func importBundle(ctx context.Context, s *storage.LocalFiles, r io.ReaderAt, size int64) ([]*snapshot.Hash, *History, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure reading the bundle: %w", err)
+	}
+	var snapshots []*snapshot.Hash
+	var history *History
+	for _, zf := range zr.File {
+		switch zf.Name {
+		case snapshotsManifest:
+			if snapshots, err = readSnapshotsManifest(zf); err != nil {
+				return nil, nil, err
+			}
+		case historyManifest:
+			if history, err = readHistoryManifest(zf); err != nil {
+				return nil, nil, err
+			}
+		case deletedManifest:
+			// The deleted files are informational; there is nothing to import.
+		default:
+			if err := importObject(ctx, s, zf); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return snapshots, history, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "src")}
+	dest := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "dest")}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(filepath.Join(workDir, "nested"), 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "nested", "example.txt"), []byte("hello, world"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	h, _, err := snapshot.Current(ctx, src, snapshot.Path(workDir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the working directory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Export(ctx, src, &buf, []*snapshot.Hash{h}); err != nil {
+		t.Fatalf("failure exporting the bundle: %v", err)
+	}
+	imported, err := bundle.Import(ctx, dest, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failure importing the bundle: %v", err)
+	}
+	if len(imported) != 1 || !imported[0].Equal(h) {
+		t.Fatalf("unexpected snapshots imported: got %v, want [%v]", imported, h)
+	}
+	f, err := dest.ReadSnapshot(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading the imported snapshot: %v", err)
+	}
+	tree, err := dest.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		t.Fatalf("failure listing the imported directory: %v", err)
+	}
+	if _, ok := tree["nested"]; !ok {
+		t.Errorf("missing nested directory in the imported snapshot: %v", tree)
+	}
+}
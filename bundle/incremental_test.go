@@ -0,0 +1,172 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/log"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestExportIncrementalIncludesHistory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "src")}
+	dest := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "dest")}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	var snapshots []*snapshot.Hash
+	for _, contents := range []string{"first", "second", "third"} {
+		if err := os.WriteFile(filepath.Join(workDir, "example.txt"), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		h, _, err := snapshot.Current(ctx, src, snapshot.Path(workDir))
+		if err != nil {
+			t.Fatalf("failure snapshotting the working directory: %v", err)
+		}
+		snapshots = append(snapshots, h)
+	}
+	base, head := snapshots[0], snapshots[len(snapshots)-1]
+
+	var full bytes.Buffer
+	if err := bundle.Export(ctx, src, &full, []*snapshot.Hash{base}); err != nil {
+		t.Fatalf("failure exporting the base bundle: %v", err)
+	}
+	if _, err := bundle.Import(ctx, dest, bytes.NewReader(full.Bytes()), int64(full.Len())); err != nil {
+		t.Fatalf("failure importing the base bundle: %v", err)
+	}
+
+	var incremental bytes.Buffer
+	if err := bundle.ExportIncremental(ctx, src, &incremental, head, base); err != nil {
+		t.Fatalf("failure exporting the incremental bundle: %v", err)
+	}
+	imported, err := bundle.Import(ctx, dest, bytes.NewReader(incremental.Bytes()), int64(incremental.Len()))
+	if err != nil {
+		t.Fatalf("failure importing the incremental bundle: %v", err)
+	}
+	if len(imported) != 1 || !imported[0].Equal(head) {
+		t.Fatalf("unexpected snapshots imported: got %v, want [%v]", imported, head)
+	}
+
+	entries, err := log.ReadLog(ctx, dest, head)
+	if err != nil {
+		t.Fatalf("failure reading the log of the imported snapshot: %v", err)
+	}
+	if got, want := len(entries), len(snapshots); got != want {
+		t.Fatalf("unexpected number of log entries: got %d, want %d", got, want)
+	}
+	for i, entry := range entries {
+		if want := snapshots[len(snapshots)-1-i]; !entry.Hash.Equal(want) {
+			t.Errorf("unexpected log entry %d: got %q, want %q", i, entry.Hash, want)
+		}
+	}
+}
+
+func TestExportIncrementalChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(filepath.Join(workDir, "removed"), 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	for name, contents := range map[string]string{
+		"unchanged.txt":                        "unchanged",
+		"changed.txt":                          "before",
+		"deleted.txt":                          "deleted",
+		filepath.Join("removed", "nested.txt"): "nested",
+	} {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	base, _, err := snapshot.Current(ctx, s, snapshot.Path(workDir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the working directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "changed.txt"), []byte("after"), 0600); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "added.txt"), []byte("added"), 0600); err != nil {
+		t.Fatalf("failure adding the example file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(workDir, "deleted.txt")); err != nil {
+		t.Fatalf("failure deleting the example file: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(workDir, "removed")); err != nil {
+		t.Fatalf("failure deleting the example directory: %v", err)
+	}
+	head, _, err := snapshot.Current(ctx, s, snapshot.Path(workDir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the working directory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.ExportIncremental(ctx, s, &buf, head, base); err != nil {
+		t.Fatalf("failure exporting the incremental bundle: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failure reading the incremental bundle: %v", err)
+	}
+	entries := make(map[string]*zip.File)
+	for _, zf := range zr.File {
+		entries[zf.Name] = zf
+	}
+	for contents, want := range map[string]bool{
+		"unchanged": false,
+		"before":    false,
+		"deleted":   false,
+		"after":     true,
+		"added":     true,
+	} {
+		h, err := snapshot.NewHash(bytes.NewReader([]byte(contents)))
+		if err != nil {
+			t.Fatalf("failure hashing %q: %v", contents, err)
+		}
+		if _, got := entries[h.Function()+"/"+h.HexContents()]; got != want {
+			t.Errorf("unexpected inclusion of the contents %q in the bundle: got %v, want %v", contents, got, want)
+		}
+	}
+	deleted, ok := entries["DELETED"]
+	if !ok {
+		t.Fatal("missing the deletion manifest in the incremental bundle")
+	}
+	r, err := deleted.Open()
+	if err != nil {
+		t.Fatalf("failure opening the deletion manifest: %v", err)
+	}
+	defer r.Close()
+	manifest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failure reading the deletion manifest: %v", err)
+	}
+	if got, want := string(manifest), "\"deleted.txt\"\n\"removed/nested.txt\"\n"; got != want {
+		t.Errorf("unexpected deletion manifest: got %q, want %q", got, want)
+	}
+}
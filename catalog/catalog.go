@@ -0,0 +1,203 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catalog lists the files in a snapshot for use by external tools.
+//
+// Catalogs are flat listings of every file in a snapshot, written as
+// CSV or as one JSON encoded entry per line, so that archives stored
+// offline can be searched without rvcs or access to the archive itself.
+package catalog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	// TypeFile is the `Entry.Type` of a regular file.
+	TypeFile = "file"
+
+	// TypeDir is the `Entry.Type` of a directory.
+	TypeDir = "dir"
+
+	// TypeLink is the `Entry.Type` of a symbolic link.
+	TypeLink = "link"
+)
+
+// Entry describes a single file in a snapshot.
+type Entry struct {
+	// Path is the slash separated path of the file relative to the
+	// root of the snapshot, which itself has the path ".".
+	Path string `json:"path"`
+
+	// Type is one of `TypeFile`, `TypeDir`, or `TypeLink`.
+	Type string `json:"type"`
+
+	// Size is the size of a regular file's stored contents, or the length of a link's target.
+	//
+	// This is nil for directories, and for contents whose size is not
+	// known, such as those that were only partially fetched.
+	Size *int64 `json:"size,omitempty"`
+
+	// Hash is the hash of a regular file's stored contents, or of a link's target.
+	//
+	// This is empty for directories.
+	Hash string `json:"hash,omitempty"`
+
+	// ModTime is the modification time recorded for a directory, or
+	// otherwise the time that the snapshot of the file was generated.
+	//
+	// This is nil if neither was recorded.
+	ModTime *time.Time `json:"mtime,omitempty"`
+}
+
+// csvHeader is the header row of catalogs written as CSV.
+var csvHeader = []string{"path", "type", "size", "hash", "mtime"}
+
+// record returns the CSV row for the entry.
+func (e *Entry) record() []string {
+	var size, mtime string
+	if e.Size != nil {
+		size = strconv.FormatInt(*e.Size, 10)
+	}
+	if e.ModTime != nil {
+		mtime = e.ModTime.Format(time.RFC3339Nano)
+	}
+	return []string{e.Path, e.Type, size, e.Hash, mtime}
+}
+
+// newEntry returns the catalog entry for the file snapshot `f` at the relative path `rel`.
+func newEntry(ctx context.Context, s *storage.LocalFiles, rel string, f *snapshot.File) (*Entry, error) {
+	e := &Entry{Path: rel, Type: TypeFile}
+	switch {
+	case f.IsDir():
+		e.Type = TypeDir
+	case f.IsLink():
+		e.Type = TypeLink
+	}
+	if !f.IsDir() && f.Contents != nil {
+		e.Size = contentsSize(ctx, s, f.Contents)
+		e.Hash = f.Contents.String()
+	}
+	t, ok := f.DirectoryTime()
+	if !ok {
+		t, ok = f.Time()
+	}
+	if ok {
+		t = t.UTC()
+		e.ModTime = &t
+	}
+	return e, nil
+}
+
+// contentsSize returns the size of the object `h`, or nil if it is not known.
+//
+// Objects that were offloaded to a remote have their sizes recorded in
+// their stubs, while those that are missing or only partially fetched
+// do not stop the rest of the snapshot from being cataloged.
+func contentsSize(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) *int64 {
+	if size, err := s.ObjectSize(ctx, h); err == nil {
+		return &size
+	}
+	if stub, err := s.FindStub(ctx, h); err == nil {
+		return &stub.Size
+	}
+	return nil
+}
+
+// Walk calls `fn` with the catalog entry of every file in the snapshot `h`.
+//
+// The entries are visited depth first, with the children of each
+// directory sorted by name and listed right after the directory.
+func Walk(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, fn func(*Entry) error) error {
+	var visit func(h *snapshot.Hash, rel string) error
+	visit = func(h *snapshot.Hash, rel string) error {
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return fmt.Errorf("failure reading the snapshot %q of %q: %w", h, rel, err)
+		}
+		e, err := newEntry(ctx, s, rel, f)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return fmt.Errorf("failure listing the contents of the snapshot %q: %w", h, err)
+		}
+		var children []string
+		for child := range tree {
+			children = append(children, string(child))
+		}
+		sort.Strings(children)
+		for _, child := range children {
+			if err := visit(tree[snapshot.Path(child)], path.Join(rel, child)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(h, ".")
+}
+
+// WriteJSON writes the catalog of the snapshot `h` to `w`, as one JSON encoded `Entry` per line.
+func WriteJSON(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return Walk(ctx, s, h, func(e *Entry) error {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failure writing the catalog: %w", err)
+		}
+		return nil
+	})
+}
+
+// WriteCSV writes the catalog of the snapshot `h` to `w` as CSV.
+//
+// The first row is a header naming the columns, which hold the fields
+// of each `Entry` in order. The modification time is in RFC 3339
+// format, or empty if it was not recorded.
+func WriteCSV(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return fmt.Errorf("failure writing the catalog: %w", err)
+	}
+	if err := Walk(ctx, s, h, func(e *Entry) error {
+		if err := out.Write(e.record()); err != nil {
+			return fmt.Errorf("failure writing the catalog: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("failure writing the catalog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "file.txt"), []byte("Hello, World!"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	if err := os.Symlink("sub/file.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("failure creating the example link: %v", err)
+	}
+	mtime := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "sub"), mtime, mtime); err != nil {
+		t.Fatalf("failure setting the modification time of the example directory: %v", err)
+	}
+	h, _, err := snapshot.NewSnapshotter(s, snapshot.WithDirectoryTimes(true), snapshot.WithRecordTime(true)).Snapshot(ctx, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := WriteJSON(ctx, s, h, &jsonOut); err != nil {
+		t.Fatalf("failure writing the catalog as JSON: %v", err)
+	}
+	var entries []*Entry
+	dec := json.NewDecoder(&jsonOut)
+	for dec.More() {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("failure decoding the catalog entry: %v", err)
+		}
+		entries = append(entries, &e)
+	}
+	want := []struct {
+		path, typ string
+
+		// size is -1 for entries with no size.
+		size int64
+	}{
+		{".", TypeDir, -1},
+		{"link", TypeLink, int64(len("sub/file.txt"))},
+		{"sub", TypeDir, -1},
+		{"sub/file.txt", TypeFile, int64(len("Hello, World!"))},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("unexpected catalog entries: got %d, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		size := int64(-1)
+		if e.Size != nil {
+			size = *e.Size
+		}
+		if e.Path != w.path || e.Type != w.typ || size != w.size {
+			t.Errorf("unexpected catalog entry %d: got %+v, want %+v", i, e, w)
+		}
+		if got := len(e.Hash) > 0; got != (w.typ != TypeDir) {
+			t.Errorf("unexpected hash for %q: %q", e.Path, e.Hash)
+		}
+		if e.ModTime == nil {
+			t.Errorf("missing modification time for %q", e.Path)
+		}
+	}
+	if got := entries[2].ModTime; got == nil || !got.Equal(mtime) {
+		t.Errorf("unexpected modification time for the subdirectory: got %v, want %v", got, mtime)
+	}
+
+	var csvOut bytes.Buffer
+	if err := WriteCSV(ctx, s, h, &csvOut); err != nil {
+		t.Fatalf("failure writing the catalog as CSV: %v", err)
+	}
+	records, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil {
+		t.Fatalf("failure reading the CSV catalog: %v", err)
+	}
+	if len(records) != len(entries)+1 || records[0][0] != "path" {
+		t.Fatalf("unexpected CSV catalog: %q", records)
+	}
+	for i, e := range entries {
+		if got, want := records[i+1], e.record(); len(got) != len(want) || got[0] != want[0] || got[3] != want[3] || got[4] != want[4] {
+			t.Errorf("unexpected CSV row for %q: got %q, want %q", e.Path, got, want)
+		}
+	}
+}
+
+func TestCatalogMissingContents(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: t.TempDir()}
+	missing, err := snapshot.NewHash(strings.NewReader("never stored"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	h, err := s.StoreObject(ctx, strings.NewReader((&snapshot.File{Contents: missing, Mode: "-rw-------"}).String()))
+	if err != nil {
+		t.Fatalf("failure storing the example snapshot: %v", err)
+	}
+	var entries []*Entry
+	if err := Walk(ctx, s, h, func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("failure cataloging a snapshot whose contents are missing: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Size != nil || entries[0].Hash != missing.String() {
+		t.Errorf("unexpected catalog entries for missing contents: %+v", entries)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command rvcs-backend-ipfs is the rvcs backend plugin for remotes stored in IPFS.
+//
+// To use it, install it in the PATH and add a remote of the form:
+//
+//	rvcs remote add <NAME> ipfs::http://127.0.0.1:5001#<KEY>
+//
+// where the URL is that of the HTTP API of a running IPFS node, and
+// <KEY> optionally names the IPNS key used to publish snapshots.
+//
+// Other machines can pull those snapshots through their own IPFS node
+// by instead adding a read-only remote of the form:
+//
+//	rvcs remote add <NAME> ipfs::http://127.0.0.1:5001#/ipns/<IPNS-NAME>
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/google/recursive-version-control-system/ipfs"
+	"github.com/google/recursive-version-control-system/remote"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("Usage: %s <API-URL>[#<KEY>|#/ipns/<IPNS-NAME>]\n", os.Args[0])
+	}
+	b, err := ipfs.New(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := remote.ServeBackend(context.Background(), b, os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("failure serving requests: %v\n", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/health"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const assertFreshUsage = `Usage: %s assert-fresh [<FLAGS>]* <PATH>+
+
+Where each <PATH> is a local file path which should have been snapshotted.
+
+Checks that each path has a recent snapshot that matches its current
+contents, for use in backup monitoring scripts and pre-deployment
+checks. Nothing is printed for paths that pass, while each problem
+with the others is printed on its own line, and the command exits with
+a failure if there were any.
+
+A path fails the check if it has never been snapshotted, if it has not
+been snapshotted successfully within the -max-age duration, or if its
+current contents differ from its latest snapshot.
+
+The age is measured from the last successful run of "snapshot" for the
+path, even if that run found nothing changed and so did not generate a
+new snapshot. For paths with no such run recorded, such as those only
+snapshotted as part of a parent directory, it is measured from when the
+latest snapshot was generated. The contents are hashed the
+same way that they would be snapshotted, so files that have not changed
+since they were last snapshotted are not read again, and nothing is
+stored in the archive. Use -skip-contents to only check the age of the
+latest snapshot, which does not read the path at all.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	assertFreshFlags = flag.NewFlagSet("assert-fresh", flag.ContinueOnError)
+
+	assertFreshMaxAgeFlag = assertFreshFlags.Duration(
+		"max-age", 0,
+		"maximum time since each path was last snapshotted successfully, such as \"2h\"; 0 means the age is not checked")
+	assertFreshSkipContentsFlag = assertFreshFlags.Bool(
+		"skip-contents", false,
+		"do not check whether the current contents of each path match its latest snapshot")
+)
+
+var assertFreshSubcommand = &subcommand{
+	summary: "check that paths have recent snapshots matching their contents",
+	usage:   assertFreshUsage,
+	flags:   assertFreshFlags,
+	examples: []string{
+		"assert-fresh -max-age=2h ~/documents",
+		"assert-fresh -max-age=24h -skip-contents /srv/db-dumps",
+		"assert-fresh ~/src/app && deploy.sh",
+	},
+	run: assertFreshCommand,
+}
+
+// lastSnapshotted returns when the path `p`, whose latest snapshot is `f`, was last snapshotted successfully.
+//
+// This is the last successful run recorded in `states`, if that is later
+// than when the snapshot `f` was generated, since an unchanged path does
+// not get a new snapshot.
+func lastSnapshotted(p snapshot.Path, f *snapshot.File, states map[snapshot.Path]*health.State) (time.Time, bool) {
+	t, ok := f.Time()
+	if st, found := states[p]; found && st.LastSuccess.After(t) {
+		return st.LastSuccess, true
+	}
+	return t, ok
+}
+
+// checkFresh returns the problems with the freshness of the path `p`, if any.
+func checkFresh(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, now time.Time, states map[snapshot.Path]*health.State, opts []snapshot.Option) ([]string, error) {
+	_, f, err := s.FindSnapshot(ctx, p)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{"has never been snapshotted"}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	var problems []string
+	if *assertFreshMaxAgeFlag > 0 {
+		if t, ok := lastSnapshotted(p, f, states); !ok {
+			problems = append(problems, "has no recorded time for its latest snapshot")
+		} else if age := now.Sub(t); age > *assertFreshMaxAgeFlag {
+			problems = append(problems, fmt.Sprintf("was last snapshotted %v ago, at %s", age.Round(time.Second), t.Local().Format(time.RFC3339)))
+		}
+	}
+	if *assertFreshSkipContentsFlag {
+		return problems, nil
+	}
+	changes, err := diff.CompareWorking(ctx, s, p, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failure comparing %q to its latest snapshot: %w", p, err)
+	}
+	if len(changes) > 0 {
+		problems = append(problems, fmt.Sprintf("has %d files that changed since its latest snapshot", len(changes)))
+	}
+	return problems, nil
+}
+
+func assertFreshCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := assertFreshFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = assertFreshFlags.Args()
+	if len(args) < 1 {
+		return -1, nil
+	}
+	var opts []snapshot.Option
+	if !*assertFreshSkipContentsFlag {
+		var err error
+		if opts, err = workingTreeOptions(ctx, s); err != nil {
+			return 1, err
+		}
+	}
+	states, err := health.Read(s)
+	if err != nil {
+		return 1, err
+	}
+	now := time.Now()
+	stale := false
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", arg, err)
+		}
+		p := snapshot.Path(abs)
+		problems, err := checkFresh(ctx, s, p, now, states, opts)
+		if err != nil {
+			return 1, err
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s %s\n", displayPath(p), problem)
+			stale = true
+		}
+	}
+	if stale {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/recursive-version-control-system/bench"
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/resources"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const benchUsage = `Usage: %s bench [<FLAGS>]*
+
+Measures how quickly snapshots, diffs, and restores run on this machine,
+using a generated tree of files with pseudo-random contents.
+
+The tree is snapshotted into a new, temporary archive three times: once
+with nothing cached, once unchanged so that every file matches the path
+info cache, and once after modifying the -change-ratio fraction of its
+files. The last snapshot is then compared with the first, and restored
+to a new directory. The time taken by each phase is printed along with
+the rate at which it processed files and bytes of file contents.
+
+The benchmark runs in a temporary directory within the store, so that it
+measures the disk the store is on, unless another directory is given
+with -dir. Everything it writes is removed afterwards, and the store
+itself is not modified. The snapshots use the resource settings, content
+filters, and archive format of the store.
+
+To help choose the number of concurrent jobs, -jobs accepts a comma
+separated list, in which case the benchmark is repeated with each.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	benchFlags = flag.NewFlagSet("bench", flag.ContinueOnError)
+
+	benchFilesFlag = benchFlags.Int(
+		"files", 10000,
+		"number of files in the generated tree")
+	benchFileSizeFlag = benchFlags.Int64(
+		"file-size", 64*1024,
+		"average size in bytes of the generated files")
+	benchFilesPerDirFlag = benchFlags.Int(
+		"files-per-dir", 100,
+		"maximum number of files in each directory of the generated tree")
+	benchChangeRatioFlag = benchFlags.Float64(
+		"change-ratio", 0.1,
+		"fraction of the files modified before the last snapshot")
+	benchSeedFlag = benchFlags.Int64(
+		"seed", 1,
+		"seed for the pseudo-random sizes and contents of the files, so that runs can be compared")
+	benchJobsFlag = benchFlags.String(
+		"jobs", "",
+		"comma separated numbers of concurrent jobs to run the benchmark with. By default, the number from the resource settings is used")
+	benchDirFlag = benchFlags.String(
+		"dir", "",
+		"directory in which to run the benchmark. By default, a temporary directory within the store is used")
+)
+
+var benchSubcommand = &subcommand{
+	summary: "measure the speed of snapshots, diffs, and restores",
+	usage:   benchUsage,
+	flags:   benchFlags,
+	examples: []string{
+		"bench",
+		"bench -files=1000 -file-size=10485760",
+		"bench -jobs=1,2,4,8,16",
+		"bench -dir=/mnt/nas/tmp",
+	},
+	run: benchCommand,
+}
+
+// parseJobs parses the value of the -jobs flag.
+func parseJobs(budget *resources.Budget, list string) ([]int, error) {
+	if len(list) == 0 {
+		return []int{jobs(budget, 0)}, nil
+	}
+	var parsed []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of jobs %q", field)
+		}
+		parsed = append(parsed, n)
+	}
+	return parsed, nil
+}
+
+func benchCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := benchFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(benchFlags.Args()) != 0 || *benchFilesFlag < 1 || *benchFileSizeFlag < 0 || *benchChangeRatioFlag < 0 || *benchChangeRatioFlag > 1 {
+		return -1, nil
+	}
+	budget, err := resources.Load(s)
+	if err != nil {
+		return 1, err
+	}
+	jobCounts, err := parseJobs(budget, *benchJobsFlag)
+	if err != nil {
+		return 1, err
+	}
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return 1, err
+	}
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return 1, err
+	}
+	parent := *benchDirFlag
+	if len(parent) == 0 {
+		parent = filepath.Join(s.ArchiveDir, "tmp")
+	}
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return 1, fmt.Errorf("failure creating the directory %q: %w", parent, err)
+	}
+	c := &bench.Config{
+		Files:       *benchFilesFlag,
+		FileSize:    *benchFileSizeFlag,
+		FilesPerDir: *benchFilesPerDirFlag,
+		ChangeRatio: *benchChangeRatioFlag,
+		Seed:        *benchSeedFlag,
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "jobs\tphase\tfiles\tbytes\tseconds\tfiles/s\tMiB/s\t")
+	for _, n := range jobCounts {
+		dir, err := os.MkdirTemp(parent, "rvcs-bench")
+		if err != nil {
+			return 1, fmt.Errorf("failure creating a temporary directory for the benchmark: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		bs := &storage.LocalFiles{
+			ArchiveDir:      filepath.Join(dir, "archive"),
+			CacheValidation: s.CacheValidation,
+			CacheMemory:     s.CacheMemory,
+		}
+		opts := append([]snapshot.Option{snapshot.WithConcurrency(n), formatOpt, filterOpt}, resourceOptions(budget)...)
+		results, err := bench.Run(ctx, bs, dir, c, n, opts...)
+		if err != nil {
+			return 1, fmt.Errorf("failure running the benchmark with %d jobs: %w", n, err)
+		}
+		for _, r := range results {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%.3f\t%.0f\t%.1f\t\n", n, r.Phase, r.Files, r.Bytes, r.Duration.Seconds(), r.FilesPerSecond(), r.BytesPerSecond()/(1<<20))
+		}
+		// Free the disk space before the next run rather than once they are all done.
+		if err := os.RemoveAll(dir); err != nil {
+			return 1, fmt.Errorf("failure removing the benchmark directory %q: %w", dir, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// snapshotReader reads snapshots and their contents, either from the local archive or from a remote.
+type snapshotReader interface {
+	ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error)
+	ReadSnapshot(ctx context.Context, h *snapshot.Hash) (*snapshot.File, error)
+	ListDirectorySnapshotContents(ctx context.Context, h *snapshot.Hash, f *snapshot.File) (snapshot.Tree, error)
+}
+
+// remoteSourceUsage describes the -remote flag shared by the subcommands that read snapshots.
+const remoteSourceUsage = `With -remote, the snapshot is read from the named remote instead of
+this archive, without pulling it. Only the objects that are needed are
+read from the remote, and if RVCS_OBJECT_CACHE_SIZE is set they are
+kept in the object cache so that they need not be read again. In that
+case <SOURCE> must be a full hash, or a path that has been pushed to
+the remote from the configured namespace.
+`
+
+// openSource resolves the snapshot named by `source`, in the remote
+// named `remoteName` or in the local archive if that is empty.
+//
+// The returned reader reads from wherever the snapshot was found, and
+// the returned function must be called once it is no longer needed.
+func openSource(ctx context.Context, s *storage.LocalFiles, remoteName, source string) (snapshotReader, *snapshot.Hash, func(), error) {
+	if len(remoteName) == 0 {
+		h, err := resolveSnapshot(ctx, s, source)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failure resolving the snapshot hash for %q: %w", source, err)
+		}
+		return s, h, func() {}, nil
+	}
+	remotes, err := selectRemotes(s, remoteName, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, err := remotes[0].Backend(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h, err := snapshot.ParseHash(source)
+	if err != nil {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			b.Close()
+			return nil, nil, nil, fmt.Errorf("failure determining the absolute path of %q: %w", source, err)
+		}
+		namespace, err := remote.ReadNamespace(s)
+		if err != nil {
+			b.Close()
+			return nil, nil, nil, err
+		}
+		if h, err = b.FindSnapshot(ctx, remote.NamespacedPath(namespace, snapshot.Path(abs))); err != nil {
+			b.Close()
+			return nil, nil, nil, fmt.Errorf("failure looking up the snapshot of %q in the remote %q: %w", abs, remoteName, err)
+		}
+	}
+	return remote.NewBrowser(s, b), h, func() { b.Close() }, nil
+}
+
+// lookupSubpath returns the snapshot of the relative path `subpath` within the snapshot `h`.
+func lookupSubpath(ctx context.Context, r snapshotReader, h *snapshot.Hash, subpath string) (*snapshot.Hash, *snapshot.File, error) {
+	f, err := r.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	subpath = filepath.Clean(subpath)
+	if subpath == "." {
+		return h, f, nil
+	}
+	if filepath.IsAbs(subpath) || subpath == ".." || strings.HasPrefix(subpath, ".."+string(filepath.Separator)) {
+		return nil, nil, fmt.Errorf("the path %q is not within the snapshot", subpath)
+	}
+	for _, name := range strings.Split(subpath, string(filepath.Separator)) {
+		if !f.IsDir() {
+			return nil, nil, fmt.Errorf("the path %q is not within a directory: %w", subpath, storage.ErrNotFound)
+		}
+		tree, err := r.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failure listing the contents of %q: %w", h, err)
+		}
+		child, ok := tree[snapshot.Path(name)]
+		if !ok {
+			return nil, nil, fmt.Errorf("the path %q does not exist in the snapshot: %w", subpath, storage.ErrNotFound)
+		}
+		if f, err = r.ReadSnapshot(ctx, child); err != nil {
+			return nil, nil, fmt.Errorf("failure reading the snapshot %q: %w", child, err)
+		}
+		h = child
+	}
+	return h, f, nil
+}
+
+// openContents opens the contents of the file snapshot `f`, with hash `h`.
+//
+// Contents that were transformed by a content filter are passed
+// through the inverse of the filter, as when they are restored.
+func openContents(ctx context.Context, s *storage.LocalFiles, r snapshotReader, h *snapshot.Hash, f *snapshot.File) (io.ReadCloser, error) {
+	if f.IsDir() {
+		return nil, fmt.Errorf("%q is the snapshot of a directory", h)
+	}
+	if f.Contents == nil {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	contents, err := r.ReadObject(ctx, f.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the contents of %q: %w", h, err)
+	}
+	filterName, ok := f.Metadata[snapshot.FilterMetadataKey]
+	if !ok {
+		return contents, nil
+	}
+	contentFilter, err := filter.Find(s, filterName)
+	if err != nil {
+		contents.Close()
+		return nil, fmt.Errorf("failure looking up the content filter for %q: %w", h, err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer contents.Close()
+		pw.CloseWithError(contentFilter.Smudge(ctx, contents, pw))
+	}()
+	return pr, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const bundleUsage = `Usage: %s bundle <ACTION>
+
+Where <ACTION> is one of:
+
+	create [--incremental-from=<BASE>] <SOURCE>+
+	apply [<FILE>]
+
+And each <SOURCE> or <BASE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+The "create" action writes a bundle of the given snapshots to standard
+output, and the "apply" action reads a bundle from <FILE>, or from
+standard input if no file is given, and stores its contents. This allows
+snapshots to be carried between machines that are not connected.
+`
+
+var (
+	bundleCreateFlags = flag.NewFlagSet("bundle create", flag.ContinueOnError)
+
+	bundleCreateIncrementalFromFlag = bundleCreateFlags.String(
+		"incremental-from", "",
+		"snapshot to use as the base of an incremental bundle. This requires exactly one <SOURCE>")
+)
+
+func bundleCreate(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := bundleCreateFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = bundleCreateFlags.Args()
+	if len(args) < 1 {
+		return -1, nil
+	}
+	var snapshots []*snapshot.Hash
+	for _, arg := range args {
+		h, err := resolveSnapshot(ctx, s, arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", arg, err)
+		}
+		snapshots = append(snapshots, h)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if base := *bundleCreateIncrementalFromFlag; len(base) > 0 {
+		if len(snapshots) != 1 {
+			return 1, fmt.Errorf("an incremental bundle requires exactly one snapshot, but got %d", len(snapshots))
+		}
+		baseHash, err := resolveSnapshot(ctx, s, base)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the base snapshot %q: %w", base, err)
+		}
+		if err := bundle.ExportIncremental(ctx, s, out, snapshots[0], baseHash); err != nil {
+			return 1, fmt.Errorf("failure creating the bundle: %w", err)
+		}
+	} else if err := bundle.Export(ctx, s, out, snapshots); err != nil {
+		return 1, fmt.Errorf("failure creating the bundle: %w", err)
+	}
+	if err := out.Flush(); err != nil {
+		return 1, fmt.Errorf("failure writing the bundle: %w", err)
+	}
+	return 0, nil
+}
+
+// openBundle opens the bundle in the file `path`, or in standard input if `path` is empty.
+//
+// The returned function must be called once the bundle has been read.
+func openBundle(path string) (f *os.File, size int64, done func(), err error) {
+	if len(path) > 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failure opening the bundle %q: %w", path, err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, nil, fmt.Errorf("failure reading the size of the bundle: %w", err)
+		}
+		return f, info.Size(), func() { f.Close() }, nil
+	}
+	// Reading a bundle requires random access, so standard input is first copied to a temporary file.
+	tmp, err := os.CreateTemp("", "rvcs-bundle")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failure creating a temporary file for the bundle: %w", err)
+	}
+	done = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err = io.Copy(tmp, os.Stdin)
+	if err != nil {
+		done()
+		return nil, 0, nil, fmt.Errorf("failure reading the bundle from standard input: %w", err)
+	}
+	return tmp, size, done, nil
+}
+
+func bundleApply(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) > 1 {
+		return -1, nil
+	}
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	}
+	in, size, done, err := openBundle(path)
+	if err != nil {
+		return 1, err
+	}
+	defer done()
+	snapshots, err := bundle.Import(ctx, s, in, size)
+	if err != nil {
+		return 1, fmt.Errorf("failure applying the bundle: %w", err)
+	}
+	for _, h := range snapshots {
+		fmt.Printf("Imported %q\n", h)
+	}
+	return 0, nil
+}
+
+var bundleSubcommand = &subcommand{
+	summary:     "carry snapshots between disconnected machines",
+	usage:       bundleUsage,
+	actionFlags: []*flag.FlagSet{bundleCreateFlags},
+	examples: []string{
+		"bundle create ~/notes > notes.bundle",
+		"bundle create --incremental-from=sha256:<HASH> ~/notes > notes.bundle",
+		"bundle apply notes.bundle",
+	},
+	run: bundleCommand,
+}
+
+func bundleCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	var ret int
+	var err error
+	switch args[0] {
+	case "create":
+		ret, err = bundleCreate(ctx, s, args[1:])
+	case "apply":
+		ret, err = bundleApply(ctx, s, args[1:])
+	default:
+		ret = -1
+	}
+	return ret, err
+}
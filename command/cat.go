@@ -0,0 +1,100 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const catUsage = `Usage: %s cat [<FLAGS>]* <SOURCE> [<PATH>]
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+and <PATH> is an optional relative path within <SOURCE>, if it is the
+snapshot of a directory.
+
+Writes the contents of the snapshotted file to standard output. For a
+symbolic link, the target of the link is written.
+
+Files that were transformed by a content filter when they were
+snapshotted are passed through the inverse of the filter, as they are
+when restored.
+
+` + remoteSourceUsage + `
+<FLAGS> are one of:
+
+`
+
+var (
+	catFlags = flag.NewFlagSet("cat", flag.ContinueOnError)
+
+	catRemoteFlag = catFlags.String(
+		"remote", "",
+		"name of the remote to read the snapshot from")
+)
+
+var catSubcommand = &subcommand{
+	summary: "write the contents of a snapshotted file",
+	usage:   catUsage,
+	flags:   catFlags,
+	examples: []string{
+		"cat ~/notes/todo.txt",
+		"cat sha256:<HASH> docs/README.md",
+		"cat -remote=origin ~/notes todo.txt",
+	},
+	run: catCommand,
+}
+
+func catCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := catFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = catFlags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		return -1, nil
+	}
+	r, h, done, err := openSource(ctx, s, *catRemoteFlag, args[0])
+	if err != nil {
+		return 1, err
+	}
+	defer done()
+	subpath := "."
+	if len(args) == 2 {
+		subpath = args[1]
+	}
+	h, f, err := lookupSubpath(ctx, r, h, subpath)
+	if err != nil {
+		return 1, err
+	}
+	contents, err := openContents(ctx, s, r, h, f)
+	if err != nil {
+		return 1, err
+	}
+	defer contents.Close()
+	if _, err := io.Copy(os.Stdout, contents); err != nil {
+		return 1, fmt.Errorf("failure writing the contents of %q: %w", h, err)
+	}
+	return 0, nil
+}
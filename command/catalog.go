@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/catalog"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const catalogUsage = `Usage: %s catalog [<FLAGS>]* <SOURCE>
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Writes a flat listing of every file in the snapshot, for feeding into
+external catalog or search systems, such as for archives that are stored
+offline. Each file is listed with its path relative to the root of the
+snapshot, its type ("file", "dir", or "link"), the size and hash of its
+contents, and its modification time. The size is left empty for
+directories, and for contents that are missing or only partially
+fetched, while offloaded contents use the size recorded when they were
+offloaded.
+
+Only directories have their modification times recorded, when using
+"snapshot -directory-times". Other files are listed with the time at
+which their snapshot was generated instead.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	catalogFlags = flag.NewFlagSet("catalog", flag.ContinueOnError)
+
+	catalogOutFlag = catalogFlags.String(
+		"out", "",
+		"file to write the catalog to. By default, the catalog is written to standard output")
+	catalogFormatFlag = catalogFlags.String(
+		"format", "",
+		"format of the catalog; either \"csv\", or \"json\" for one JSON object per line.\n"+
+			"By default, this is \"csv\" if the -out file name ends in \".csv\", and \"json\" otherwise")
+)
+
+var catalogSubcommand = &subcommand{
+	summary: "list every file in a snapshot for external catalogs",
+	usage:   catalogUsage,
+	flags:   catalogFlags,
+	examples: []string{
+		"catalog -out=catalog.csv ~/photos",
+		"catalog -out=catalog.json sha256:<HASH>",
+		"catalog -format=csv ~/notes",
+	},
+	run: catalogCommand,
+}
+
+// writeCatalog writes the catalog of the snapshot `h` to `w` in the given format.
+func writeCatalog(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, format string, w io.Writer) error {
+	if format == "csv" {
+		return catalog.WriteCSV(ctx, s, h, w)
+	}
+	return catalog.WriteJSON(ctx, s, h, w)
+}
+
+func catalogCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := catalogFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = catalogFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	format := *catalogFormatFlag
+	if len(format) == 0 {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(*catalogOutFlag), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "json" {
+		return 1, fmt.Errorf("unsupported catalog format %q; must be either \"csv\" or \"json\"", format)
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	} else if h == nil {
+		return 1, fmt.Errorf("no snapshot found for %q", args[0])
+	}
+	if len(*catalogOutFlag) == 0 {
+		if err := writeCatalog(ctx, s, h, format, os.Stdout); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	out, err := os.Create(*catalogOutFlag)
+	if err != nil {
+		return 1, fmt.Errorf("failure creating the catalog file %q: %w", *catalogOutFlag, err)
+	}
+	defer out.Close()
+	if err := writeCatalog(ctx, s, h, format, out); err != nil {
+		return 1, err
+	}
+	if err := out.Close(); err != nil {
+		return 1, fmt.Errorf("failure closing the catalog file %q: %w", *catalogOutFlag, err)
+	}
+	return 0, nil
+}
@@ -17,71 +17,310 @@ package command
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
 )
 
-type command func(context.Context, *storage.LocalFiles, string, []string) (int, error)
+// command runs a subcommand with the given arguments and returns its exit code.
+//
+// A negative exit code means that the arguments were invalid, in which
+// case the help text of the subcommand is printed.
+type command func(context.Context, *storage.LocalFiles, []string) (int, error)
+
+// subcommand describes a single subcommand of the `rvcs` CLI.
+type subcommand struct {
+	// summary is a short description shown in the list of subcommands.
+	summary string
+
+	// usage is the help text of the subcommand.
+	//
+	// Every "%[1]s" in it is replaced with the name of the rvcs executable.
+	usage string
+
+	// flags holds the flags of the subcommand, if it has any.
+	//
+	// Their descriptions are printed after the usage text.
+	flags *flag.FlagSet
 
-var (
-	commandMap = map[string]command{
-		"export":   exportCommand,
-		"log":      logCommand,
-		"merge":    mergeCommand,
-		"snapshot": snapshotCommand,
+	// actionFlags holds the flags of the individual actions of
+	// subcommands such as "remote add".
+	actionFlags []*flag.FlagSet
+
+	// examples are example invocations, without the leading name of the rvcs executable.
+	examples []string
+
+	run command
+}
+
+// printHelp writes the full help text of the subcommand to `out`.
+func (sc *subcommand) printHelp(out io.Writer, cmd string) {
+	fmt.Fprintf(out, sc.usage, cmd)
+	if sc.flags != nil {
+		sc.flags.SetOutput(out)
+		sc.flags.PrintDefaults()
+		sc.flags.SetOutput(nil)
+	}
+	for _, fs := range sc.actionFlags {
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if !hasFlags {
+			continue
+		}
+		fmt.Fprintf(out, "\nThe flags of %q are:\n\n", fs.Name())
+		fs.SetOutput(out)
+		fs.PrintDefaults()
+		fs.SetOutput(nil)
+	}
+	if len(sc.examples) > 0 {
+		fmt.Fprintf(out, "\nExamples:\n\n")
+		for _, example := range sc.examples {
+			fmt.Fprintf(out, "\t%s %s\n", cmd, example)
+		}
 	}
+}
 
-	usage = `Usage: %s <SUBCOMMAND>
+var commandMap = map[string]*subcommand{
+	"apply-patch":     applyPatchSubcommand,
+	"assert-fresh":    assertFreshSubcommand,
+	"bench":           benchSubcommand,
+	"bundle":          bundleSubcommand,
+	"cat":             catSubcommand,
+	"catalog":         catalogSubcommand,
+	"diff":            diffSubcommand,
+	"dircmp":          dircmpSubcommand,
+	"duplicates":      duplicatesSubcommand,
+	"export":          exportSubcommand,
+	"find":            findSubcommand,
+	"find-object":     findObjectSubcommand,
+	"format-patch":    formatPatchSubcommand,
+	"fsck":            fsckSubcommand,
+	"grep":            grepSubcommand,
+	"health":          healthSubcommand,
+	"history":         historySubcommand,
+	"log":             logSubcommand,
+	"ls-remote":       lsRemoteSubcommand,
+	"merge":           mergeSubcommand,
+	"metrics":         metricsSubcommand,
+	"notes":           notesSubcommand,
+	"pull":            pullSubcommand,
+	"push":            pushSubcommand,
+	"query":           querySubcommand,
+	"reflog":          reflogSubcommand,
+	"relocate":        relocateSubcommand,
+	"remote":          remoteSubcommand,
+	"resources":       resourcesSubcommand,
+	"restore":         restoreSubcommand,
+	"restore-object":  restoreObjectSubcommand,
+	"service":         serviceSubcommand,
+	"show":            showSubcommand,
+	"snapshot":        snapshotSubcommand,
+	"squash":          squashSubcommand,
+	"status":          statusSubcommand,
+	"store":           storeSubcommand,
+	"thaw":            thawSubcommand,
+	"tier":            tierSubcommand,
+	"timestamp":       timestampSubcommand,
+	"track":           trackSubcommand,
+	"undo":            undoSubcommand,
+	"upgrade":         upgradeSubcommand,
+	"verify-manifest": verifyManifestSubcommand,
+}
 
-Where <SUBCOMMAND> is one of:
+// printUsage writes the list of subcommands to `out`.
+func printUsage(out io.Writer, cmd string) {
+	fmt.Fprintf(out, "Usage: %s [--store=<STORE>] <SUBCOMMAND> [<ARGS>]*\n\nWhere <SUBCOMMAND> is one of:\n\n", cmd)
+	var names []string
+	for name := range commandMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%s\t%s\n", name, commandMap[name].summary)
+	}
+	fmt.Fprintf(w, "\t%s\t%s\n", "help", "show the help text of a subcommand")
+	w.Flush()
+	fmt.Fprintf(out, "\nRun \"%s help <SUBCOMMAND>\" for the details of each subcommand.\n", cmd)
+	fmt.Fprint(out, storeFlagUsage)
+	fmt.Fprint(out, exitCodesUsage)
+}
 
-	export
-	log
-	merge
-	snapshot
-`
-)
+// isHelpFlag reports whether or not the argument asks for help.
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// wantsHelp reports whether or not any of the given flags ask for help.
+//
+// Only the arguments before the first non-flag argument are checked,
+// since the flag package stops parsing there. Anything after it, such
+// as a path named "-h", belongs to the subcommand.
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			return false
+		}
+		if isHelpFlag(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// help implements the `rvcs help [<SUBCOMMAND>]` subcommand.
+func help(cmd string, args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout, cmd)
+		return 0
+	}
+	sc, ok := commandMap[args[0]]
+	if len(args) > 1 || !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown subcommand %q\n", strings.Join(args, " "))
+		printUsage(flag.CommandLine.Output(), cmd)
+		return 1
+	}
+	sc.printHelp(os.Stdout, cmd)
+	return 0
+}
+
+// displayPath returns the form of a path shown to users, using "." for the empty path.
+//
+// Unusual paths are quoted as with `snapshot.Path.Display`, so that each path is shown on a single line.
+func displayPath(p snapshot.Path) string {
+	if len(p) == 0 {
+		return "."
+	}
+	return p.Display()
+}
 
 func resolveSnapshot(ctx context.Context, s *storage.LocalFiles, name string) (*snapshot.Hash, error) {
 	h, err := snapshot.ParseHash(name)
 	if err == nil {
+		if h == nil || s.HasObject(ctx, h) {
+			return h, nil
+		}
+		// Hashes may be abbreviated, as they are in the output of "log".
+		if expanded, err := s.ExpandHash(ctx, h); err == nil {
+			return expanded, nil
+		}
 		return h, nil
 	}
 	abs, err := filepath.Abs(name)
 	if err != nil {
-		return nil, fmt.Errorf("failure resolving the absolute path of %q: %v", name, err)
+		return nil, fmt.Errorf("failure resolving the absolute path of %q: %w", name, err)
 	}
 	h, _, err = s.FindSnapshot(ctx, snapshot.Path(abs))
 	if err == nil {
 		return h, nil
 	}
-	return nil, fmt.Errorf("unable to resolve the hash corresponding to %q", name)
+	return nil, fmt.Errorf("unable to resolve the hash corresponding to %q: %w", name, err)
+}
+
+// The exit codes returned by `Run`, so that scripts can branch on the kind of failure.
+const (
+	// ExitOK means that the subcommand succeeded.
+	ExitOK = 0
+
+	// ExitFailure means that the subcommand was invoked incorrectly, or
+	// that it failed for a reason not covered by the other exit codes.
+	ExitFailure = 1
+
+	// ExitNotFound means that a snapshot, object, track, or file did not exist.
+	ExitNotFound = 2
+
+	// ExitConflict means that changes conflicted and could not be combined automatically.
+	ExitConflict = 3
+
+	// ExitCorrupt means that stored data did not match its hash or could not be parsed.
+	ExitCorrupt = 4
+)
+
+const storeFlagUsage = `
+<STORE> is the name of a store listed by "store list", or the directory
+of an archive. If it is not given, then the store named in the RVCS_STORE
+environment variable is used, or otherwise the default store.
+`
+
+const exitCodesUsage = `
+The exit code is one of:
+
+	0  success
+	1  invalid usage, or a failure not covered below
+	2  a snapshot, object, track, or file was not found
+	3  changes conflicted and could not be combined automatically
+	4  stored data is corrupt
+`
+
+// failureExitCode returns the exit code describing the given failure.
+func failureExitCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrCorrupt):
+		return ExitCorrupt
+	case errors.Is(err, storage.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, storage.ErrNotFound):
+		return ExitNotFound
+	}
+	return ExitFailure
 }
 
 // Run implements the subcommands of the `rvcs` CLI.
 //
 // The passed in `args` should be the value returned by `os.Args`
 //
-// The returned value is the exit code of the command; 0 for success
-// and non-zero for any form of failure.
+// The returned value is the exit code of the command; `ExitOK` for
+// success and one of the other exit codes for any form of failure.
 func Run(ctx context.Context, s *storage.LocalFiles, args []string) (exitCode int) {
 	if len(args) < 2 {
-		fmt.Fprintf(flag.CommandLine.Output(), usage, args[0])
+		printUsage(flag.CommandLine.Output(), args[0])
 		return 1
 	}
-	subcommand, ok := commandMap[args[1]]
+	if args[1] == "help" || isHelpFlag(args[1]) {
+		return help(args[0], args[2:])
+	}
+	sc, ok := commandMap[args[1]]
 	if !ok {
 		fmt.Fprintf(flag.CommandLine.Output(), "Unknown subcommand %q\n", args[1])
-		fmt.Fprintf(flag.CommandLine.Output(), usage, args[0])
+		printUsage(flag.CommandLine.Output(), args[0])
 		return 1
 	}
-	retcode, err := subcommand(ctx, s, args[0], args[2:])
+	if wantsHelp(args[2:]) {
+		sc.printHelp(os.Stdout, args[0])
+		return 0
+	}
+	printHelp := func() {
+		sc.printHelp(flag.CommandLine.Output(), args[0])
+	}
+	for _, fs := range append([]*flag.FlagSet{sc.flags}, sc.actionFlags...) {
+		if fs != nil {
+			fs.Usage = printHelp
+		}
+	}
+	retcode, err := sc.run(ctx, s, args[2:])
 	if err != nil {
 		fmt.Fprintf(flag.CommandLine.Output(), "Failure running the %q subcommand: %v\n", args[1], err)
+		var tiered *storage.TieredError
+		if errors.As(err, &tiered) {
+			fmt.Fprintf(flag.CommandLine.Output(), "Use \"%s thaw\" to bring back the offloaded contents\n", args[0])
+		}
+		if retcode == ExitFailure {
+			retcode = failureExitCode(err)
+		}
+	}
+	if retcode < 0 {
+		// The subcommand was invoked incorrectly.
+		printHelp()
+		return ExitFailure
 	}
 	return retcode
 }
@@ -0,0 +1,37 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import "testing"
+
+func TestWantsHelp(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-h"}, true},
+		{[]string{"--help"}, true},
+		{[]string{"-quiet", "-help", "~/notes"}, true},
+		{[]string{"~/notes", "-h"}, false},
+		{[]string{"sha256:1a2b3c", "-h"}, false},
+		{[]string{"-quiet", "--", "-h"}, false},
+		{[]string{"-", "-h"}, false},
+	} {
+		if got := wantsHelp(tc.args); got != tc.want {
+			t.Errorf("wantsHelp(%q): got %v, want %v", tc.args, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const diffUsage = `Usage: %s diff [<FLAGS>]* <BEFORE> <AFTER>
+
+Where <BEFORE> and <AFTER> are each one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Each changed file is listed with a leading "A" if it was added, "D"
+if it was deleted, and "M" if it was modified.
+
+Modified files whose type is recognized, either from the content type
+recorded in their snapshots or from their names, are followed
+by a description of what changed within them: the values in JSON and
+YAML documents, the members of zip and tar archives, and the format,
+dimensions, and EXIF metadata of images. Other modified binary files
+are followed by a summary of how their size and contents changed.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	diffFlags = flag.NewFlagSet("diff", flag.ContinueOnError)
+
+	diffToolFlag = diffFlags.String(
+		"tool", os.Getenv("RVCS_DIFF_TOOL"),
+		"external tool used to compare the two snapshots (defaults to the value of the RVCS_DIFF_TOOL environment variable).\n"+
+			"The variables $LOCAL and $REMOTE in the command are replaced with the paths of the before and after versions;\n"+
+			"if neither is referenced then both paths are appended to the command")
+	diffSimilarityFlag = diffFlags.Bool(
+		"similarity", false,
+		"report how similar the two versions of each changed binary file are. This requires reading both versions in full")
+	diffStructuredFlag = diffFlags.Bool(
+		"structured", true,
+		"describe the changes within recognized types of files, such as JSON documents, archives, and images")
+)
+
+func runDiffTool(ctx context.Context, s *storage.LocalFiles, before, after *snapshot.Hash, name string) error {
+	tmpDir, err := os.MkdirTemp("", "rvcs-diff")
+	if err != nil {
+		return fmt.Errorf("failure creating a temporary directory for the diff: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	beforePath := snapshot.Path(filepath.Join(tmpDir, "before", name))
+	afterPath := snapshot.Path(filepath.Join(tmpDir, "after", name))
+	for _, dir := range []string{filepath.Dir(string(beforePath)), filepath.Dir(string(afterPath))} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return fmt.Errorf("failure creating the temporary directory %q: %w", dir, err)
+		}
+	}
+	if err := merge.Extract(ctx, s, before, beforePath); err != nil {
+		return fmt.Errorf("failure extracting %q: %w", before, err)
+	}
+	if err := merge.Extract(ctx, s, after, afterPath); err != nil {
+		return fmt.Errorf("failure extracting %q: %w", after, err)
+	}
+	vars := map[string]snapshot.Path{
+		"LOCAL":  beforePath,
+		"REMOTE": afterPath,
+	}
+	return runTool(ctx, *diffToolFlag, vars, []string{"LOCAL", "REMOTE"}, true)
+}
+
+var diffSubcommand = &subcommand{
+	summary: "list the files that differ between two snapshots",
+	usage:   diffUsage,
+	flags:   diffFlags,
+	examples: []string{
+		"diff sha256:<HASH> ~/notes",
+		`diff -tool="meld $LOCAL $REMOTE" sha256:<HASH> ~/notes`,
+	},
+	run: diffCommand,
+}
+
+func diffCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := diffFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = diffFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	before, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	after, err := resolveSnapshot(ctx, s, args[1])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[1], err)
+	}
+	if len(*diffToolFlag) > 0 {
+		if err := runDiffTool(ctx, s, before, after, filepath.Base(args[1])); err != nil {
+			return 1, fmt.Errorf("failure comparing %q and %q: %w", before, after, err)
+		}
+		return 0, nil
+	}
+	changes, err := diff.Compare(ctx, s, before, after)
+	if err != nil {
+		return 1, fmt.Errorf("failure comparing %q and %q: %w", before, after, err)
+	}
+	for _, c := range changes {
+		p := displayPath(snapshot.Path(c.Path))
+		fmt.Printf("%s %s\n", c.Kind(), p)
+		if *diffStructuredFlag {
+			lines, err := diff.Render(ctx, s, c)
+			if err != nil {
+				return 1, fmt.Errorf("failure describing the changes to %q: %w", p, err)
+			}
+			for _, line := range lines {
+				fmt.Printf("    %s\n", line)
+			}
+			if lines != nil {
+				continue
+			}
+		}
+		binary, err := diff.SummarizeBinary(ctx, s, c, *diffSimilarityFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure summarizing the changes to %q: %w", p, err)
+		}
+		if binary != nil {
+			fmt.Printf("    %s\n", binary)
+		}
+	}
+	return 0, nil
+}
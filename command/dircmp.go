@@ -0,0 +1,76 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const dircmpUsage = `Usage: %s dircmp <BEFORE> <AFTER>
+
+Where <BEFORE> and <AFTER> are local directories, or other files.
+
+Compares the two directories as they currently are on disk, without
+storing anything in the archive. Each changed file is listed as it is
+by "diff", with a leading "A" if it was added, "D" if it was deleted,
+and "M" if it was modified.
+
+The directories are hashed the same way that they would be snapshotted,
+so files that have not changed since they were last snapshotted are not
+read again, and the content filters configured for the archive apply.
+`
+
+var dircmpSubcommand = &subcommand{
+	summary: "list the files that differ between two local directories",
+	usage:   dircmpUsage,
+	examples: []string{
+		"dircmp ~/photos /media/backup/photos",
+	},
+	run: dircmpCommand,
+}
+
+func dircmpCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) != 2 {
+		return -1, nil
+	}
+	var paths []snapshot.Path
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", arg, err)
+		}
+		paths = append(paths, snapshot.Path(abs))
+	}
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return 1, err
+	}
+	changes, err := diff.CompareDirs(ctx, s, paths[0], paths[1], filterOpt)
+	if err != nil {
+		return 1, fmt.Errorf("failure comparing %q and %q: %w", paths[0], paths[1], err)
+	}
+	for _, c := range changes {
+		fmt.Printf("%s %s\n", c.Kind(), displayPath(snapshot.Path(c.Path)))
+	}
+	return 0, nil
+}
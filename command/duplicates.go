@@ -0,0 +1,82 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/google/recursive-version-control-system/duplicates"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const duplicatesUsage = `Usage: %s duplicates <SOURCE>+
+
+Where each <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Lists the groups of files within all of the given snapshots that have
+identical contents, along with the size of those contents. The groups
+wasting the most space are listed first.
+`
+
+var duplicatesFlags = flag.NewFlagSet("duplicates", flag.ContinueOnError)
+
+var duplicatesSubcommand = &subcommand{
+	summary: "find files with identical contents",
+	usage:   duplicatesUsage,
+	flags:   duplicatesFlags,
+	examples: []string{
+		"duplicates ~/photos ~/backups",
+	},
+	run: duplicatesCommand,
+}
+
+func duplicatesCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := duplicatesFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = duplicatesFlags.Args()
+	if len(args) < 1 {
+		return -1, nil
+	}
+	roots := make(map[snapshot.Path]*snapshot.Hash)
+	for _, arg := range args {
+		h, err := resolveSnapshot(ctx, s, arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", arg, err)
+		}
+		roots[snapshot.Path(arg)] = h
+	}
+	groups, err := duplicates.Find(ctx, s, roots)
+	if err != nil {
+		return 1, fmt.Errorf("failure finding duplicate files: %w", err)
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d copies of %d bytes\n", g.Contents, len(g.Paths), g.Size)
+		for _, p := range g.Paths {
+			fmt.Printf("  %s\n", displayPath(p))
+		}
+	}
+	return 0, nil
+}
@@ -24,13 +24,18 @@ import (
 	"strings"
 
 	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/mirror"
+	"github.com/google/recursive-version-control-system/redact"
+	"github.com/google/recursive-version-control-system/restic"
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
 )
 
 const exportUsage = `Usage: %s export [<FLAGS>]* <PATH>
 
-Where <PATH> is a local filesystem path for the newly generated bundle, and <FLAGS> are one of:
+Where <PATH> is a local filesystem path for the newly generated bundle,
+for the mirror directory if the -mirror flag is set, or for the restic
+repository if the -restic flag is set, and <FLAGS> are one of:
 
 `
 
@@ -40,28 +45,148 @@ var (
 	exportSnapshotsFlag = exportFlags.String(
 		"snapshots", "",
 		"comma separated list of snapshots to include in the exported bundle")
+	exportIncrementalFromFlag = exportFlags.String(
+		"incremental-from", "",
+		"snapshot to use as the base of an incremental export. The bundle will only contain files added or changed since the base, "+
+			"plus a manifest of the deleted files. This requires exactly one snapshot to be exported")
+	exportMirrorFlag = exportFlags.Bool(
+		"mirror", false,
+		"instead of a bundle, maintain a plain directory at <PATH> holding the latest snapshot of each tracked path. "+
+			"Only files that changed since the previous export are rewritten")
+	exportManifestFlag = exportFlags.String(
+		"manifest", "",
+		"with -mirror, also write a manifest of the path, size, hash, mode, and modification time of every mirrored file to this file.\n"+
+			"The manifest can later be checked against a copy of the mirror using the \"verify-manifest\" subcommand")
+	exportResticFlag = exportFlags.Bool(
+		"restic", false,
+		"instead of a bundle, export the latest snapshot of each tracked path into the restic repository at <PATH>, creating the repository if it does not exist.\n"+
+			"Snapshots that were previously exported are skipped. Only version 1 repositories, which do not compress their contents, are supported")
+	exportResticPasswordFileFlag = exportFlags.String(
+		"restic-password-file", os.Getenv("RESTIC_PASSWORD_FILE"),
+		"with -restic, read the repository password from this file. If not set, the password is read from the RESTIC_PASSWORD environment variable")
+	exportRedactMetadataFlag = exportFlags.Bool(
+		"redact-metadata", false,
+		"export copies of the snapshots without the author of each snapshot, and with the times truncated to the day.\n"+
+			"The tree structure and the contents of the files are unchanged, but the snapshots have new hashes")
 )
 
-func exportCommand(ctx context.Context, s *storage.LocalFiles, cmd string, args []string) (int, error) {
-	exportFlags.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), exportUsage, cmd)
-		exportFlags.PrintDefaults()
+// writeFileManifest writes the manifest of the files in the mirror `dir` to the file `path`.
+func writeFileManifest(ctx context.Context, s *storage.LocalFiles, dir, path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failure creating the manifest file %q: %w", path, err)
+	}
+	defer out.Close()
+	if err := mirror.WriteFileManifest(ctx, s, dir, out); err != nil {
+		return fmt.Errorf("failure writing the manifest of %q: %w", dir, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure closing the manifest file %q: %w", path, err)
+	}
+	return nil
+}
+
+// resticPassword returns the password for the restic repository.
+func resticPassword() (string, error) {
+	if len(*exportResticPasswordFileFlag) == 0 {
+		if password := os.Getenv("RESTIC_PASSWORD"); len(password) > 0 {
+			return password, nil
+		}
+		return "", fmt.Errorf("the -restic flag requires either the -restic-password-file flag or the RESTIC_PASSWORD environment variable")
+	}
+	bs, err := os.ReadFile(*exportResticPasswordFileFlag)
+	if err != nil {
+		return "", fmt.Errorf("failure reading the restic password file %q: %w", *exportResticPasswordFileFlag, err)
+	}
+	return strings.TrimRight(string(bs), "\r\n"), nil
+}
+
+// exportToRestic exports the latest snapshot of each tracked path into the restic repository in `dir`.
+func exportToRestic(ctx context.Context, s *storage.LocalFiles, dir string) error {
+	password, err := resticPassword()
+	if err != nil {
+		return err
 	}
+	r, err := restic.Open(dir, password)
+	if err != nil {
+		return fmt.Errorf("failure opening the restic repository %q: %w", dir, err)
+	}
+	defer r.Close()
+	tracked, err := s.TrackedPaths(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range tracked {
+		h, _, err := s.FindSnapshot(ctx, p)
+		if err != nil {
+			return fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+		}
+		if h == nil || r.Exported(h) {
+			continue
+		}
+		id, err := r.Export(ctx, s, p, h)
+		if err != nil {
+			return fmt.Errorf("failure exporting the snapshot %q of %q: %w", h, p, err)
+		}
+		fmt.Printf("Exported %q of %q as the restic snapshot %s\n", h, p, id)
+	}
+	return r.Close()
+}
+
+var exportSubcommand = &subcommand{
+	summary: "export snapshots to a bundle, a mirror directory, or a restic repository",
+	usage:   exportUsage,
+	flags:   exportFlags,
+	examples: []string{
+		"export -snapshots=sha256:<HASH> notes.bundle",
+		"export -mirror -manifest=manifest.jsonl ~/mirror",
+		"export -restic -restic-password-file=restic-password.txt ~/backups/restic-repo",
+		"export -redact-metadata -snapshots=sha256:<HASH> public.bundle",
+	},
+	run: exportCommand,
+}
+
+func exportCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
 	if err := exportFlags.Parse(args); err != nil {
 		return 1, nil
 	}
 	args = exportFlags.Args()
 	if len(args) < 1 {
-		fmt.Fprintf(flag.CommandLine.Output(), exportUsage, cmd)
-		exportFlags.PrintDefaults()
-		return 1, nil
+		return -1, nil
+	}
+
+	if *exportMirrorFlag {
+		if len(*exportSnapshotsFlag) > 0 || len(*exportIncrementalFromFlag) > 0 || *exportRedactMetadataFlag || *exportResticFlag {
+			return 1, fmt.Errorf("the -mirror flag cannot be combined with the -snapshots, -incremental-from, -redact-metadata, or -restic flags")
+		}
+		if err := mirror.Update(ctx, s, args[0]); err != nil {
+			return 1, fmt.Errorf("failure updating the mirror in %q: %w", args[0], err)
+		}
+		if len(*exportManifestFlag) > 0 {
+			if err := writeFileManifest(ctx, s, args[0], *exportManifestFlag); err != nil {
+				return 1, err
+			}
+		}
+		return 0, nil
+	}
+	if len(*exportManifestFlag) > 0 {
+		return 1, fmt.Errorf("the -manifest flag requires the -mirror flag")
+	}
+	if *exportResticFlag {
+		if len(*exportSnapshotsFlag) > 0 || len(*exportIncrementalFromFlag) > 0 || *exportRedactMetadataFlag {
+			return 1, fmt.Errorf("the -restic flag cannot be combined with the -snapshots, -incremental-from, or -redact-metadata flags")
+		}
+		if err := exportToRestic(ctx, s, args[0]); err != nil {
+			return 1, err
+		}
+		return 0, nil
 	}
 
 	var snapshots []*snapshot.Hash
 	for _, s := range strings.Split(*exportSnapshotsFlag, ",") {
 		h, err := snapshot.ParseHash(s)
 		if err != nil {
-			return 1, fmt.Errorf("failure parsing snapshot hash %q: %v", s, err)
+			return 1, fmt.Errorf("failure parsing snapshot hash %q: %w", s, err)
 		}
 		if h != nil {
 			snapshots = append(snapshots, h)
@@ -70,15 +195,52 @@ func exportCommand(ctx context.Context, s *storage.LocalFiles, cmd string, args
 
 	path, err := filepath.Abs(args[0])
 	if err != nil {
-		return 1, fmt.Errorf("failure resolving the absolute path of %q: %v", args[0], err)
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[0], err)
+	}
+
+	var base *snapshot.Hash
+	if len(*exportIncrementalFromFlag) > 0 {
+		if len(snapshots) != 1 {
+			return 1, fmt.Errorf("an incremental export requires exactly one snapshot, but got %d", len(snapshots))
+		}
+		base, err = resolveSnapshot(ctx, s, *exportIncrementalFromFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the base snapshot %q: %w", *exportIncrementalFromFlag, err)
+		}
 	}
 
-	out, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0700)
+	if *exportRedactMetadataFlag {
+		if base != nil {
+			snapshots = append(snapshots, base)
+		}
+		redacted, err := redact.Snapshots(ctx, s, snapshots)
+		if err != nil {
+			return 1, fmt.Errorf("failure redacting the metadata of the snapshots: %w", err)
+		}
+		for i, h := range snapshots {
+			fmt.Printf("Redacted %q to %q\n", h, redacted[i])
+		}
+		snapshots = redacted
+		if base != nil {
+			snapshots, base = snapshots[:1], snapshots[1]
+		}
+	}
+
+	out, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0700)
+	if err != nil {
+		return 1, fmt.Errorf("failure opening the file %q: %w", path, err)
+	}
+	defer out.Close()
+	if base != nil {
+		err = bundle.ExportIncremental(ctx, s, out, snapshots[0], base)
+	} else {
+		err = bundle.Export(ctx, s, out, snapshots)
+	}
 	if err != nil {
-		return 1, fmt.Errorf("failure opening the file %q: %v", path, err)
+		return 1, fmt.Errorf("failure creating the bundle: %w\n", err)
 	}
-	if err := bundle.Export(ctx, s, out, snapshots); err != nil {
-		return 1, fmt.Errorf("failure creating the bundle: %v\n", err)
+	if err := out.Close(); err != nil {
+		return 1, fmt.Errorf("failure closing the file %q: %w", path, err)
 	}
 	return 0, nil
 }
@@ -0,0 +1,178 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const findUsage = `Usage: %s find -name=<PATTERN> [<FLAGS>]* [<PATH>]*
+
+Where <PATTERN> is a shell pattern such as "*.key", and each <PATH> is a
+local file path which has previously been snapshotted.
+
+Lists every file whose name matches <PATTERN> in the latest snapshots of
+the given paths, or of every snapshotted path if none are given. Each is
+printed on its own line, as the time and hash of the snapshot in which it
+was found, the hash of the snapshot of the file, and the path, separated
+by tabs. Only the base name of each file is matched against <PATTERN>.
+
+With -all-history, every snapshot in the history of the paths is
+searched instead, and each file is listed with the snapshot in which it
+first appeared at its path. This uses an index of file names that is
+only maintained once it has been enabled with the -enable flag, rather
+than walking every snapshot. Enabling it indexes the existing history of
+every snapshotted path, which may take a while for large archives. After
+that, the new history of a path is indexed by each command that changes
+its latest snapshot, such as "snapshot", "merge", "pull", and "history
+import".
+
+<FLAGS> are one of:
+
+`
+
+var (
+	findFlags = flag.NewFlagSet("find", flag.ContinueOnError)
+
+	findNameFlag = findFlags.String(
+		"name", "",
+		"shell pattern that the base names of the listed files must match")
+	findAllHistoryFlag = findFlags.Bool(
+		"all-history", false,
+		"search every snapshot in the history of the paths using the index of file names, rather than only the latest snapshots")
+	findEnableFlag = findFlags.Bool(
+		"enable", false,
+		"start maintaining the index of file names, indexing the existing history")
+	findDisableFlag = findFlags.Bool(
+		"disable", false,
+		"stop maintaining the index of file names, and remove it")
+)
+
+var findSubcommand = &subcommand{
+	summary: "find files by name in the latest snapshots or across history",
+	usage:   findUsage,
+	flags:   findFlags,
+	examples: []string{
+		"find -name='*.key'",
+		"find -name=README.md ~/src",
+		"find -enable",
+		"find -name='*.key' -all-history",
+	},
+	run: findCommand,
+}
+
+// findInLatest returns the matching files in the latest snapshots of the given paths, or of every tracked path if none are given.
+func findInLatest(ctx context.Context, s *storage.LocalFiles, paths []snapshot.Path, pattern string) ([]*index.Location, error) {
+	if len(paths) == 0 {
+		tracked, err := s.TrackedPaths(ctx)
+		if err != nil {
+			return nil, err
+		}
+		paths = tracked
+	}
+	var found []*index.Location
+	for _, p := range paths {
+		h, _, err := s.FindSnapshot(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+		}
+		locations, err := index.MatchNames(ctx, s, p, h, pattern)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, locations...)
+	}
+	return found, nil
+}
+
+// findInHistory returns the matching files in the index of file names that are within any of the given paths.
+func findInHistory(s *storage.LocalFiles, paths []snapshot.Path, pattern string) ([]*index.Location, error) {
+	locations, err := index.FindNames(s, pattern)
+	if err != nil || len(paths) == 0 {
+		return locations, err
+	}
+	var found []*index.Location
+	for _, l := range locations {
+		for _, p := range paths {
+			if _, ok := l.Path.Relocate(p, p); ok {
+				found = append(found, l)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func findCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := findFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = findFlags.Args()
+	if *findEnableFlag || *findDisableFlag {
+		if len(args) > 0 || len(*findNameFlag) > 0 || (*findEnableFlag && *findDisableFlag) {
+			return -1, nil
+		}
+		if *findDisableFlag {
+			if err := index.DisableNames(ctx, s); err != nil {
+				return 1, err
+			}
+			return 0, nil
+		}
+		if err := index.EnableNames(ctx, s); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	if len(*findNameFlag) == 0 {
+		return -1, nil
+	}
+	var paths []snapshot.Path
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", arg, err)
+		}
+		paths = append(paths, snapshot.Path(abs))
+	}
+	var locations []*index.Location
+	var err error
+	if *findAllHistoryFlag {
+		locations, err = findInHistory(s, paths, *findNameFlag)
+	} else {
+		locations, err = findInLatest(ctx, s, paths, *findNameFlag)
+	}
+	if err != nil {
+		return 1, err
+	}
+	for _, l := range locations {
+		taken := "-"
+		if root, err := s.ReadSnapshot(ctx, l.Root); err != nil {
+			return 1, fmt.Errorf("failure reading the snapshot %q: %w", l.Root, err)
+		} else if t, ok := root.Time(); ok {
+			taken = t.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", taken, l.Root, l.Snapshot, displayPath(l.Path))
+	}
+	return 0, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const findObjectUsage = `Usage: %s find-object [<FLAGS>]* <HASH>|<FILE>
+
+Where <HASH> is the hash of an object, such as the contents of a file,
+or of the snapshot of a file, and <FILE> is a local file whose contents
+are searched for.
+
+Lists every path at which the object appears in the history of the
+snapshotted paths. Each is printed on its own line, as the time and hash
+of the snapshot in which it first appeared at that path, the hash of
+the snapshot of the file, and the path, separated by tabs.
+
+This uses a reverse index of objects that is only maintained once it has
+been enabled with the -enable flag. Enabling it indexes the existing
+history of every snapshotted path, which may take a while for large
+archives. After that, the new history of a path is indexed by each
+command that changes its latest snapshot, such as "snapshot", "merge",
+"pull", and "history import".
+
+The contents of files that were transformed by a content filter when
+they were snapshotted are not found by searching for a <FILE>.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	findObjectFlags = flag.NewFlagSet("find-object", flag.ContinueOnError)
+
+	findObjectEnableFlag = findObjectFlags.Bool(
+		"enable", false,
+		"start maintaining the reverse index of objects, indexing the existing history")
+	findObjectDisableFlag = findObjectFlags.Bool(
+		"disable", false,
+		"stop maintaining the reverse index of objects, and remove it")
+)
+
+var findObjectSubcommand = &subcommand{
+	summary: "find every path and snapshot that an object appears in",
+	usage:   findObjectUsage,
+	flags:   findObjectFlags,
+	examples: []string{
+		"find-object -enable",
+		"find-object sha256:4c7740fee18c",
+		"find-object ~/Downloads/mystery.pdf",
+	},
+	run: findObjectCommand,
+}
+
+// resolveObject returns the hash named by `name`, or the hash of the contents of the local file `name`.
+func resolveObject(ctx context.Context, s *storage.LocalFiles, name string) (*snapshot.Hash, error) {
+	if h, err := snapshot.ParseHash(name); err == nil && h != nil {
+		if s.HasObject(ctx, h) {
+			return h, nil
+		}
+		if expanded, err := s.ExpandHash(ctx, h); err == nil {
+			return expanded, nil
+		}
+		return h, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a hash nor a readable file: %w", name, err)
+	}
+	defer f.Close()
+	h, err := snapshot.NewHash(f)
+	if err != nil {
+		return nil, fmt.Errorf("failure hashing the contents of %q: %w", name, err)
+	}
+	return h, nil
+}
+
+func findObjectCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := findObjectFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = findObjectFlags.Args()
+	if *findObjectEnableFlag || *findObjectDisableFlag {
+		if len(args) > 0 || (*findObjectEnableFlag && *findObjectDisableFlag) {
+			return -1, nil
+		}
+		if *findObjectDisableFlag {
+			if err := index.DisableObjects(ctx, s); err != nil {
+				return 1, err
+			}
+			return 0, nil
+		}
+		if err := index.EnableObjects(ctx, s); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	if len(args) != 1 {
+		return -1, nil
+	}
+	h, err := resolveObject(ctx, s, args[0])
+	if err != nil {
+		return 1, err
+	}
+	locations, err := index.FindObject(s, h)
+	if err != nil {
+		return 1, err
+	}
+	if len(locations) == 0 {
+		return 1, fmt.Errorf("the object %q does not appear in any indexed snapshot: %w", h, storage.ErrNotFound)
+	}
+	for _, l := range locations {
+		taken := "-"
+		if root, err := s.ReadSnapshot(ctx, l.Root); err != nil {
+			return 1, fmt.Errorf("failure reading the snapshot %q: %w", l.Root, err)
+		} else if t, ok := root.Time(); ok {
+			taken = t.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", taken, l.Root, l.Snapshot, displayPath(l.Path))
+	}
+	return 0, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/google/recursive-version-control-system/fsck"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const fsckUsage = `Usage: %s fsck [<FLAGS>]* <SOURCE>
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Every object reachable from the snapshot, including its entire history,
+is read and compared against its hash, and every file snapshot and
+directory listing is parsed. Each problem found is printed along with
+the path at which it was found, relative to <SOURCE>.
+
+Files that were being written while they were snapshotted, and so may
+have been captured part way through an update, are listed as possibly
+inconsistent. These are not counted as problems.
+
+The contents of files that were offloaded by "tier run" are not local,
+so they are skipped and counted rather than reported as missing.
+
+With -repair, objects that are missing or whose contents do not match
+their hashes are fetched by hash from the configured remotes, or only
+from the remote named by -from, rewritten locally, and re-verified.
+Each repaired object is listed, and is not counted as a problem.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	fsckFlags = flag.NewFlagSet("fsck", flag.ContinueOnError)
+
+	fsckCanonicalFlag = fsckFlags.Bool(
+		"canonical", false,
+		"also check that every file snapshot and directory listing is encoded in its canonical form, "+
+			"so that the same logical tree always has the same hash")
+	fsckRepairFlag = fsckFlags.Bool(
+		"repair", false,
+		"repair missing or corrupt objects by fetching them from the remotes")
+	fsckFromFlag = fsckFlags.String(
+		"from", "",
+		"name of the only remote to repair objects from. By default, every configured remote is tried in order of priority")
+)
+
+var fsckSubcommand = &subcommand{
+	summary: "check the integrity of a snapshot and its history",
+	usage:   fsckUsage,
+	flags:   fsckFlags,
+	examples: []string{
+		"fsck ~/notes",
+		"fsck -canonical sha256:<HASH>",
+		"fsck -repair -from backup ~/notes",
+	},
+	run: fsckCommand,
+}
+
+func fsckCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := fsckFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = fsckFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	opts := fsck.Options{Canonical: *fsckCanonicalFlag}
+	if *fsckRepairFlag {
+		remotes, err := selectRemotes(s, *fsckFromFlag, false)
+		if err != nil {
+			return 1, err
+		}
+		if len(remotes) == 0 {
+			return 1, fmt.Errorf("no remotes are configured to repair from")
+		}
+		opts.RepairFrom = remotes
+	} else if len(*fsckFromFlag) > 0 {
+		return 1, fmt.Errorf("the -from flag can only be used with -repair")
+	}
+	result, err := fsck.Check(ctx, s, h, opts)
+	if err != nil {
+		return 1, fmt.Errorf("failure checking %q: %w", h, err)
+	}
+	for _, p := range result.Inconsistent {
+		fmt.Printf("possibly inconsistent: %s\n", displayPath(p))
+	}
+	for _, repair := range result.Repaired {
+		fmt.Printf("repaired from %q: %s: %s: %v\n", repair.Remote, displayPath(repair.Path), repair.Hash, repair.Err)
+	}
+	for _, problem := range result.Problems {
+		fmt.Printf("%s: %s: %v\n", displayPath(problem.Path), problem.Hash, problem.Err)
+	}
+	if result.Offloaded > 0 {
+		fmt.Printf("Skipped the contents of %d files that were offloaded to a remote; thaw them to check them\n", result.Offloaded)
+	}
+	if *fsckRepairFlag {
+		fmt.Printf("Checked %d objects; repaired %d problems; found %d problems that could not be repaired\n", result.Objects, len(result.Repaired), len(result.Problems))
+	} else {
+		fmt.Printf("Checked %d objects; found %d problems\n", result.Objects, len(result.Problems))
+	}
+	if len(result.Problems) > 0 {
+		return failureExitCode(result.Problems[0].Err), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const grepUsage = `Usage: %s grep [<FLAGS>]* <PATTERN> <SOURCE> [<PATH>]
+
+Where <PATTERN> is a regular expression using the syntax of the Go
+"regexp" package, <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+and <PATH> is an optional relative path within <SOURCE>, if it is the
+snapshot of a directory.
+
+Searches the contents of every regular file in the snapshot, and prints
+each matching line as <FILE>:<LINE-NUMBER>:<LINE>, where <FILE> is
+relative to <SOURCE>. Binary files, which contain NUL bytes, are only
+reported as matching.
+
+The exit code is 0 if any line matched, and 1 otherwise.
+
+` + remoteSourceUsage + `
+<FLAGS> are one of:
+
+`
+
+var (
+	grepFlags = flag.NewFlagSet("grep", flag.ContinueOnError)
+
+	grepRemoteFlag = grepFlags.String(
+		"remote", "",
+		"name of the remote to read the snapshot from")
+	grepIgnoreCaseFlag = grepFlags.Bool(
+		"i", false,
+		"ignore case when matching")
+	grepFilesFlag = grepFlags.Bool(
+		"l", false,
+		"only print the names of the files that match")
+)
+
+var grepSubcommand = &subcommand{
+	summary: "search the contents of a snapshot",
+	usage:   grepUsage,
+	flags:   grepFlags,
+	examples: []string{
+		"grep TODO ~/notes",
+		"grep -i -l 'password' sha256:<HASH> config",
+		"grep -remote=origin 'func main' ~/src",
+	},
+	run: grepCommand,
+}
+
+// binaryCheckSize is the number of bytes at the start of a file that are checked for NUL bytes.
+const binaryCheckSize = 8000
+
+// grepFile prints the lines in the contents of the file `p` that match `pattern`, and reports whether there were any.
+func grepFile(p snapshot.Path, contents io.Reader, pattern *regexp.Regexp) (bool, error) {
+	r := bufio.NewReader(contents)
+	prefix, err := r.Peek(binaryCheckSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+	binary := bytes.IndexByte(prefix, 0) >= 0
+	matched := false
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+			if pattern.Match(line) {
+				if binary || *grepFilesFlag {
+					break
+				}
+				matched = true
+				fmt.Printf("%s:%d:%s\n", p.Display(), lineNumber, line)
+			}
+		}
+		if err == io.EOF {
+			return matched, nil
+		} else if err != nil {
+			return matched, err
+		}
+	}
+	if *grepFilesFlag {
+		fmt.Println(p.Display())
+	} else {
+		fmt.Printf("%s: binary file matches\n", p.Display())
+	}
+	return true, nil
+}
+
+// grepSnapshot searches every regular file within the snapshot `h` of the relative path `p`.
+func grepSnapshot(ctx context.Context, s *storage.LocalFiles, r snapshotReader, p snapshot.Path, h *snapshot.Hash, f *snapshot.File, pattern *regexp.Regexp) (bool, error) {
+	if f.IsLink() {
+		return false, nil
+	}
+	if !f.IsDir() {
+		contents, err := openContents(ctx, s, r, h, f)
+		if err != nil {
+			return false, err
+		}
+		defer contents.Close()
+		matched, err := grepFile(p, contents, pattern)
+		if err != nil {
+			return false, fmt.Errorf("failure searching the contents of %q: %w", p, err)
+		}
+		return matched, nil
+	}
+	tree, err := r.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return false, fmt.Errorf("failure listing the contents of %q: %w", p, err)
+	}
+	var children []string
+	for child := range tree {
+		children = append(children, string(child))
+	}
+	sort.Strings(children)
+	matched := false
+	for _, child := range children {
+		childHash := tree[snapshot.Path(child)]
+		childFile, err := r.ReadSnapshot(ctx, childHash)
+		if err != nil {
+			return false, fmt.Errorf("failure reading the snapshot %q of %q: %w", childHash, child, err)
+		}
+		childMatched, err := grepSnapshot(ctx, s, r, p.Join(snapshot.Path(child)), childHash, childFile, pattern)
+		if err != nil {
+			return false, err
+		}
+		matched = matched || childMatched
+	}
+	return matched, nil
+}
+
+func grepCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := grepFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = grepFlags.Args()
+	if len(args) < 2 || len(args) > 3 {
+		return -1, nil
+	}
+	expr := args[0]
+	if *grepIgnoreCaseFlag {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return 1, fmt.Errorf("failure parsing the pattern %q: %w", args[0], err)
+	}
+	r, h, done, err := openSource(ctx, s, *grepRemoteFlag, args[1])
+	if err != nil {
+		return 1, err
+	}
+	defer done()
+	subpath := "."
+	if len(args) == 3 {
+		subpath = args[2]
+	}
+	h, f, err := lookupSubpath(ctx, r, h, subpath)
+	if err != nil {
+		return 1, err
+	}
+	p := snapshot.Path(filepath.Clean(subpath))
+	if len(args) == 2 && !f.IsDir() {
+		// Name the file as it was given, rather than as ".".
+		p = snapshot.Path(args[1])
+	}
+	matched, err := grepSnapshot(ctx, s, r, p, h, f, pattern)
+	if err != nil {
+		return 1, err
+	}
+	if !matched {
+		return 1, nil
+	}
+	return 0, nil
+}
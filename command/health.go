@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/recursive-version-control-system/health"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const healthUsage = `Usage: %s health [<FLAGS>]* [<PATH>]*
+
+Where each <PATH> is a local file path.
+
+Reports whether the snapshots of each path are succeeding, so that
+snapshots run in the background, such as by "service install", do not
+fail silently. Each path is listed with the time of its latest
+successful snapshot, the number of consecutive failed snapshots since
+then, and the error from the latest failure.
+
+The outcome of every run of "snapshot" is recorded. If no paths are
+given, then every path that has been snapshotted is listed.
+
+The exit code is 1 if the latest snapshot of any listed path failed,
+or, with -max-age, if any of them has not been snapshotted successfully
+within that long.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	healthFlags = flag.NewFlagSet("health", flag.ContinueOnError)
+
+	healthMaxAgeFlag = healthFlags.Duration(
+		"max-age", 0,
+		"maximum time since the latest successful snapshot of each path, such as \"2h\"; 0 means no limit")
+)
+
+var healthSubcommand = &subcommand{
+	summary: "report whether the snapshots of each path are succeeding",
+	usage:   healthUsage,
+	flags:   healthFlags,
+	examples: []string{
+		"health",
+		"health -max-age=2h ~/notes",
+	},
+	run: healthCommand,
+}
+
+// recordSnapshotHealth records the outcome of snapshotting the path `p`, as returned by `snapshotPath`.
+func recordSnapshotHealth(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, ret int, snapshotErr error) error {
+	now := time.Now()
+	if snapshotErr != nil {
+		return health.RecordFailure(ctx, s, p, now, snapshotErr.Error())
+	} else if ret != 0 {
+		return health.RecordFailure(ctx, s, p, now, "no snapshot was generated")
+	}
+	return health.RecordSuccess(ctx, s, p, now)
+}
+
+func healthCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := healthFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	states, err := health.Read(s)
+	if err != nil {
+		return 1, err
+	}
+	var paths []snapshot.Path
+	for _, arg := range healthFlags.Args() {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", arg, err)
+		}
+		paths = append(paths, snapshot.Path(abs))
+	}
+	if len(paths) == 0 {
+		tracked, err := s.TrackedPaths(ctx)
+		if err != nil {
+			return 1, err
+		}
+		seen := make(map[snapshot.Path]bool)
+		for _, p := range tracked {
+			seen[p] = true
+		}
+		for p := range states {
+			if !seen[p] {
+				tracked = append(tracked, p)
+			}
+		}
+		sort.Slice(tracked, func(i, j int) bool { return tracked[i] < tracked[j] })
+		paths = tracked
+	}
+	now := time.Now()
+	unhealthy := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tLAST SUCCESS\tFAILURES\tLAST ERROR")
+	var problems []string
+	for _, p := range paths {
+		st, ok := states[p]
+		if !ok {
+			// The path has not been snapshotted since its health started being recorded.
+			st = &health.State{Path: p}
+		}
+		var lastError string
+		if st.ConsecutiveFailures > 0 {
+			lastError = st.LastError
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", displayPath(p), formatLastTime(st.LastSuccess.Local()), st.ConsecutiveFailures, lastError)
+		if problem := st.Problem(*healthMaxAgeFlag, now); len(problem) > 0 {
+			unhealthy++
+			problems = append(problems, fmt.Sprintf("%s: %s", displayPath(p), problem))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 1, err
+	}
+	if unhealthy == 0 {
+		return 0, nil
+	}
+	fmt.Printf("\n%d of %d paths are unhealthy:\n", unhealthy, len(paths))
+	for _, problem := range problems {
+		fmt.Printf("    %s\n", problem)
+	}
+	return 1, nil
+}
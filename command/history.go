@@ -0,0 +1,178 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/bundle"
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const historyUsage = `Usage: %s history <ACTION>
+
+Where <ACTION> is one of:
+
+	export [-contents] <PATH>
+	import [-path=<PATH>] [<FILE>]
+
+The "export" action writes a bundle holding the complete history of the
+local file path <PATH> to standard output. This includes every snapshot
+in its log along with their directory listings, but only includes the
+contents of regular files if the -contents flag is given.
+
+The "import" action reads such a bundle from <FILE>, or from standard
+input if no file is given, stores its contents, and maps the exported
+path, or the path given by -path, to the latest snapshot in the bundle.
+This allows the history of a single path to be moved to another machine
+independently of the rest of the archive.
+
+A path that already has snapshots is only updated if the imported history
+descends from its current snapshot; otherwise, use "merge" to combine the
+two. The files themselves are not changed; use "restore" to recreate them
+from a bundle that includes their contents.
+`
+
+var (
+	historyExportFlags = flag.NewFlagSet("history export", flag.ContinueOnError)
+	historyImportFlags = flag.NewFlagSet("history import", flag.ContinueOnError)
+
+	historyExportContentsFlag = historyExportFlags.Bool(
+		"contents", false,
+		"include the contents of regular files, and not only the snapshots and directory listings")
+	historyImportPathFlag = historyImportFlags.String(
+		"path", "",
+		"local path to map to the imported history, instead of the path it was exported from")
+)
+
+var historySubcommand = &subcommand{
+	summary:     "move the complete history of a path between archives",
+	usage:       historyUsage,
+	actionFlags: []*flag.FlagSet{historyExportFlags, historyImportFlags},
+	examples: []string{
+		"history export ~/notes > notes.rvcs",
+		"history export -contents ~/notes > notes.rvcs",
+		"history import notes.rvcs",
+		"history import -path=$HOME/old-notes notes.rvcs",
+	},
+	run: historyCommand,
+}
+
+func historyExport(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := historyExportFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = historyExportFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	abs, err := filepath.Abs(args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[0], err)
+	}
+	p := snapshot.Path(abs)
+	h, _, err := s.FindSnapshot(ctx, p)
+	if err != nil {
+		return 1, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if err := bundle.ExportHistory(ctx, s, out, p, h, *historyExportContentsFlag); err != nil {
+		return 1, fmt.Errorf("failure exporting the history of %q: %w", p, err)
+	}
+	if err := out.Flush(); err != nil {
+		return 1, fmt.Errorf("failure writing the history bundle: %w", err)
+	}
+	return 0, nil
+}
+
+func historyImport(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := historyImportFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = historyImportFlags.Args()
+	if len(args) > 1 {
+		return -1, nil
+	}
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	}
+	in, size, done, err := openBundle(path)
+	if err != nil {
+		return 1, err
+	}
+	defer done()
+	history, err := bundle.ImportHistory(ctx, s, in, size)
+	if err != nil {
+		return 1, fmt.Errorf("failure importing the history: %w", err)
+	}
+	p := history.Path
+	if len(*historyImportPathFlag) > 0 {
+		abs, err := filepath.Abs(*historyImportPathFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", *historyImportPathFlag, err)
+		}
+		p = snapshot.Path(abs)
+	}
+	if len(p) == 0 {
+		return 1, fmt.Errorf("the bundle does not name the path of its history; use -path to choose one")
+	}
+	current, _, err := s.FindSnapshot(ctx, p)
+	if err != nil && !os.IsNotExist(err) {
+		return 1, fmt.Errorf("failure looking up the current snapshot of %q: %w", p, err)
+	}
+	if current != nil {
+		base, err := merge.MergeBase(ctx, s, current, history.Head)
+		if err != nil {
+			return 1, fmt.Errorf("failure comparing the history of %q to the imported history: %w", p, err)
+		}
+		if base.Equal(history.Head) {
+			fmt.Printf("The history of %q already includes %q\n", p, history.Head)
+			return 0, nil
+		}
+		if !base.Equal(current) {
+			return 1, fmt.Errorf("the history of %q does not lead to the imported snapshot %q; use \"merge\" to combine them: %w", p, history.Head, storage.ErrConflict)
+		}
+	}
+	if err := s.ResetSnapshot(ctx, p, history.Head); err != nil {
+		return 1, fmt.Errorf("failure mapping %q to the imported snapshot %q: %w", p, history.Head, err)
+	}
+	if err := recordMapping(ctx, s, "history", p, current, history.Head); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Imported the history of %q up to %q\n", p, history.Head)
+	return 0, nil
+}
+
+func historyCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	switch args[0] {
+	case "export":
+		return historyExport(ctx, s, args[1:])
+	case "import":
+		return historyImport(ctx, s, args[1:])
+	}
+	return -1, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"os"
+	"os/user"
+	"runtime/debug"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// authorConfig is the name of the archive config file holding the author identity.
+const authorConfig = "author"
+
+// authorIdentity returns the identity recorded as the author of new snapshots.
+//
+// This is taken from the RVCS_AUTHOR environment variable if it is set,
+// and otherwise from the "author" config file of the archive. If neither
+// is set, then it defaults to `<USER>@<HOST>`.
+func authorIdentity(s *storage.LocalFiles) string {
+	if author := os.Getenv("RVCS_AUTHOR"); len(author) > 0 {
+		return author
+	}
+	if bs, err := os.ReadFile(s.ConfigFile(authorConfig)); err == nil {
+		if author := strings.TrimSpace(string(bs)); len(author) > 0 {
+			return author
+		}
+	}
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return username + "@" + host
+}
+
+// rvcsVersion returns the version of the running rvcs binary.
+func rvcsVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// provenanceOptions returns the snapshot options for recording the author and time of new snapshots.
+func provenanceOptions(s *storage.LocalFiles) []snapshot.Option {
+	return []snapshot.Option{
+		snapshot.WithAuthor(authorIdentity(s), rvcsVersion()),
+		snapshot.WithRecordTime(true),
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package command
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+// lowerIOPriority moves the current process into the idle I/O scheduling class.
+//
+// Linux tracks the I/O priority of each thread separately, and the Go
+// runtime does I/O from many threads, so every thread of the process is
+// moved. Threads created afterwards inherit the priority of the thread
+// that created them.
+//
+// The returned boolean reports whether or not this is supported on the
+// current platform; if not, callers should fall back to limiting the
+// rate at which they read files.
+func lowerIOPriority() (bool, error) {
+	lowered := make(map[int]bool)
+	for {
+		tids, err := threadIDs()
+		if err != nil {
+			return true, err
+		}
+		changed := false
+		for _, tid := range tids {
+			if lowered[tid] {
+				continue
+			}
+			_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift)
+			if errno == syscall.ESRCH {
+				// The thread exited.
+				continue
+			} else if errno != 0 {
+				return true, errno
+			}
+			lowered[tid] = true
+			changed = true
+		}
+		// A thread that had not yet been moved may have started another, so
+		// repeat until no new threads show up.
+		if !changed {
+			return true, nil
+		}
+	}
+}
+
+// threadIDs lists the IDs of the threads of the current process.
+func threadIDs() ([]int, error) {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+	var tids []int
+	for _, task := range tasks {
+		if tid, err := strconv.Atoi(task.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package command
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestLowerIOPriorityAllThreads(t *testing.T) {
+	// Park goroutines on their own threads, so that the process has
+	// threads other than the one calling `lowerIOPriority`.
+	var started sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		started.Add(1)
+		go func() {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			started.Done()
+			<-done
+		}()
+	}
+	started.Wait()
+	defer close(done)
+
+	if supported, err := lowerIOPriority(); err != nil {
+		t.Skipf("unable to lower the I/O priority: %v", err)
+	} else if !supported {
+		t.Fatal("lowering the I/O priority is unexpectedly unsupported")
+	}
+	tids, err := threadIDs()
+	if err != nil {
+		t.Fatalf("failure listing the threads: %v", err)
+	}
+	if len(tids) < 5 {
+		t.Fatalf("unexpected threads: got %v, want at least 5", tids)
+	}
+	for _, tid := range tids {
+		prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(tid), 0)
+		if errno == syscall.ESRCH {
+			continue
+		} else if errno != 0 {
+			t.Fatalf("failure reading the I/O priority of thread %d: %v", tid, errno)
+		}
+		if got := prio >> ioprioClassShift; got != ioprioClassIdle {
+			t.Errorf("unexpected I/O scheduling class of thread %d: got %d, want %d", tid, got, ioprioClassIdle)
+		}
+	}
+}
@@ -19,38 +19,203 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/recursive-version-control-system/log"
+	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
 )
 
-func logCommand(ctx context.Context, s *storage.LocalFiles, cmd string, args []string) (int, error) {
-	if len(args) != 1 {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s log <HASH>\n", cmd)
+const logUsage = `Usage: %s log [<FLAGS>]* <SOURCE>
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Each snapshot is listed with its abbreviated hash, how long ago it was
+generated, its author, and how many files it added, modified, and
+deleted relative to its first parent. Any merge strategy or notes
+recorded for the snapshot are listed too. Abbreviated hashes can be
+passed to other subcommands in place of full hashes.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	logFlags = flag.NewFlagSet("log", flag.ContinueOnError)
+
+	logSinceFlag = logFlags.String(
+		"since", "",
+		"only show snapshots generated at or after this time, given either as a date (YYYY-MM-DD) or in RFC 3339 format")
+	logUntilFlag = logFlags.String(
+		"until", "",
+		"only show snapshots generated at or before this time, given either as a date (YYYY-MM-DD), which includes the whole of that day, or in RFC 3339 format")
+	logMaxCountFlag = logFlags.Int(
+		"max-count", 0,
+		"maximum number of snapshots to show; 0 means no limit")
+	logPathFlag = logFlags.String(
+		"path", "",
+		"only show snapshots in which the file at this path, relative to <SOURCE>, changed")
+	logOnelineFlag = logFlags.Bool(
+		"oneline", false,
+		"show each snapshot on a single line")
+	logStatFlag = logFlags.Bool(
+		"stat", false,
+		"also list each file that changed in each snapshot")
+	logDeletedFlag = logFlags.Bool(
+		"deleted", false,
+		"only show the files deleted in each snapshot, as recorded by \"snapshot -tombstones\"")
+)
+
+// parseLogTime parses a time given to either the `-since` or `-until` flags.
+//
+// A date on its own means the start of that day, or the end of that
+// day if `endOfDay` is true, so that `-until` includes the whole day.
+func parseLogTime(value string, endOfDay bool) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+var logSubcommand = &subcommand{
+	summary: "show the history of a snapshot",
+	usage:   logUsage,
+	flags:   logFlags,
+	examples: []string{
+		"log ~/notes",
+		"log -max-count=5 sha256:<HASH>",
+		"log -oneline ~/notes",
+		"log -stat -since=2022-06-01 ~/notes",
+	},
+	run: logCommand,
+}
+
+func logCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := logFlags.Parse(args); err != nil {
 		return 1, nil
 	}
+	args = logFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	since, err := parseLogTime(*logSinceFlag, false)
+	if err != nil {
+		return 1, fmt.Errorf("failure parsing the -since time %q: %w", *logSinceFlag, err)
+	}
+	until, err := parseLogTime(*logUntilFlag, true)
+	if err != nil {
+		return 1, fmt.Errorf("failure parsing the -until time %q: %w", *logUntilFlag, err)
+	}
 	h, err := resolveSnapshot(ctx, s, args[0])
 	if err != nil {
-		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %v", args[0], err)
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
 	}
 	entries, err := log.ReadLog(ctx, s, h)
 	if err != nil {
-		return 1, fmt.Errorf("failure reading the log for %q: %v", args[0], err)
+		return 1, fmt.Errorf("failure reading the log for %q: %w", args[0], err)
 	}
-	summaries, err := log.SummarizeLog(ctx, s, entries)
+	entries, err = log.FilterLog(ctx, s, entries, &log.Filter{
+		Since:    since,
+		Until:    until,
+		MaxCount: *logMaxCountFlag,
+		Path:     *logPathFlag,
+	})
 	if err != nil {
-		return 1, fmt.Errorf("failure summarizing log entries for %q: %v", args[0], err)
+		return 1, fmt.Errorf("failure filtering the log entries for %q: %w", args[0], err)
+	}
+	if *logDeletedFlag {
+		return logDeleted(ctx, s, entries)
 	}
+	now := time.Now()
 	for i, e := range entries {
-		if i > 0 {
+		lines, err := describeLogEntry(ctx, s, e, now)
+		if err != nil {
+			return 1, fmt.Errorf("failure describing the log entry %q: %w", e.Hash, err)
+		}
+		if i > 0 && !*logOnelineFlag {
 			// Separate log entries for each change with a newline to make the output more readable.
 			fmt.Println()
 		}
-		summary, ok := summaries[*e.Hash]
-		if !ok {
-			return 1, fmt.Errorf("internal error reading log summaries: entry %q is missing", e.Hash)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	return 0, nil
+}
+
+// describeLogEntry returns the lines printed for the log entry `e`, according to the -oneline and -stat flags.
+func describeLogEntry(ctx context.Context, s *storage.LocalFiles, e *log.LogEntry, now time.Time) ([]string, error) {
+	header := []string{e.Hash.Short()}
+	if t, ok := e.File.Time(); ok {
+		header = append(header, log.RelativeTime(t, now))
+	}
+	if author, ok := e.File.Metadata[snapshot.AuthorMetadataKey]; ok {
+		header = append(header, author)
+	}
+	changes, err := e.Changes(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Kind()]++
+	}
+	if *logOnelineFlag {
+		header = append(header, fmt.Sprintf("[+%d ~%d -%d]", counts["A"], counts["M"], counts["D"]))
+		return []string{strings.Join(header, " ")}, nil
+	}
+	lines := []string{
+		strings.Join(header, "  "),
+		fmt.Sprintf("    %d added, %d modified, %d deleted", counts["A"], counts["M"], counts["D"]),
+	}
+	if strategy, ok := e.File.Metadata[snapshot.MergeStrategyMetadataKey]; ok {
+		lines = append(lines, "    merge strategy: "+strategy)
+	}
+	notes, err := s.ListNotes(ctx, e.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 1 {
+		lines = append(lines, "    1 note")
+	} else if len(notes) > 1 {
+		lines = append(lines, fmt.Sprintf("    %d notes", len(notes)))
+	}
+	if *logStatFlag {
+		for _, c := range changes {
+			lines = append(lines, fmt.Sprintf("    %s %s", c.Kind(), displayPath(snapshot.Path(c.Path))))
+		}
+	}
+	return lines, nil
+}
+
+// logDeleted prints the files deleted in each of the given log entries.
+//
+// Entries that did not record any deleted files are skipped.
+func logDeleted(ctx context.Context, s *storage.LocalFiles, entries []*log.LogEntry) (int, error) {
+	printed := false
+	for _, e := range entries {
+		lines, err := log.DescribeDeleted(ctx, s, e)
+		if err != nil {
+			return 1, fmt.Errorf("failure reading the deleted files for %q: %w", e.Hash, err)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if printed {
+			fmt.Println()
 		}
-		for _, line := range summary {
+		printed = true
+		for _, line := range lines {
 			fmt.Println(line)
 		}
 	}
@@ -0,0 +1,50 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLogTime(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Value       string
+		EndOfDay    bool
+		Want        time.Time
+	}{
+		{"empty", "", true, time.Time{}},
+		{"date since", "2022-06-01", false, time.Date(2022, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"date until", "2022-06-01", true, time.Date(2022, 6, 1, 23, 59, 59, 999999999, time.Local)},
+		{"timestamp until", "2022-06-01T12:00:00Z", true, time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, testCase := range testCases {
+		got, err := parseLogTime(testCase.Value, testCase.EndOfDay)
+		if err != nil {
+			t.Errorf("failure parsing the time for test case %q: %v", testCase.Description, err)
+		} else if !got.Equal(testCase.Want) {
+			t.Errorf("unexpected time for test case %q: got %v, want %v", testCase.Description, got, testCase.Want)
+		}
+	}
+	// A snapshot generated during the day given to -until is included.
+	until, err := parseLogTime("2022-06-01", true)
+	if err != nil {
+		t.Fatalf("failure parsing the -until date: %v", err)
+	}
+	if generated := time.Date(2022, 6, 1, 18, 30, 0, 0, time.Local); generated.After(until) {
+		t.Errorf("a snapshot generated at %v was excluded by -until=2022-06-01", generated)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const lsRemoteUsage = `Usage: %s ls-remote [<FLAGS>]* <REMOTE> [<PATH>]
+
+Where <REMOTE> is the name of a configured remote, and <PATH> is a local
+filesystem path.
+
+Lists each path recorded in <REMOTE>, or only <PATH>, along with the hash
+of its latest snapshot in the remote and the time that snapshot was taken,
+if recorded. Nothing is pulled; only the snapshots themselves are read
+from the remote.
+
+Paths are looked up in the namespace configured with "remote namespace"
+unless the -namespace flag is given. Listing every path is only supported
+for remotes accessed via the file system, but a single <PATH> can be
+looked up in any remote.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	lsRemoteFlags = flag.NewFlagSet("ls-remote", flag.ContinueOnError)
+
+	lsRemoteNamespaceFlag = lsRemoteFlags.String(
+		"namespace", "",
+		"namespace to list the paths of, instead of the configured namespace. Use -namespace=\"\" to list every path in the remote")
+)
+
+var lsRemoteSubcommand = &subcommand{
+	summary: "list the latest snapshots of paths in a remote without pulling them",
+	usage:   lsRemoteUsage,
+	flags:   lsRemoteFlags,
+	examples: []string{
+		"ls-remote origin",
+		"ls-remote origin ~/notes",
+		"ls-remote -namespace=machine/desktop origin",
+	},
+	run: lsRemoteCommand,
+}
+
+// browsedNamespace returns the namespace used for browsing a remote.
+//
+// This is the value of `namespaceFlag` if it was set explicitly in
+// `flags`, and the configured namespace otherwise.
+func browsedNamespace(s *storage.LocalFiles, flags *flag.FlagSet, namespaceFlag *string) (string, error) {
+	explicit := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "namespace" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		return remote.ReadNamespace(s)
+	}
+	if err := remote.ValidateNamespace(*namespaceFlag); err != nil {
+		return "", err
+	}
+	return *namespaceFlag, nil
+}
+
+func lsRemoteCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := lsRemoteFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = lsRemoteFlags.Args()
+	if len(args) < 1 || len(args) > 2 {
+		return -1, nil
+	}
+	remotes, err := selectRemotes(s, args[0], false)
+	if err != nil {
+		return 1, err
+	}
+	r := remotes[0]
+	namespace, err := browsedNamespace(s, lsRemoteFlags, lsRemoteNamespaceFlag)
+	if err != nil {
+		return 1, err
+	}
+	var paths []snapshot.Path
+	if len(args) == 2 {
+		abs, err := filepath.Abs(args[1])
+		if err != nil {
+			return 1, fmt.Errorf("failure determining the absolute path of %q: %w", args[1], err)
+		}
+		paths = []snapshot.Path{snapshot.Path(abs)}
+	} else if paths, err = remote.ListPaths(ctx, r, namespace); err != nil {
+		return 1, err
+	}
+	b, err := r.Backend(ctx)
+	if err != nil {
+		return 1, err
+	}
+	defer b.Close()
+	for _, p := range paths {
+		h, err := b.FindSnapshot(ctx, remote.NamespacedPath(namespace, p))
+		if os.IsNotExist(err) && len(args) == 2 {
+			return 1, fmt.Errorf("the remote %q has no snapshot of %q", r.Name, p)
+		} else if err != nil {
+			return 1, fmt.Errorf("failure looking up the snapshot of %q in the remote %q: %w", p, r.Name, err)
+		}
+		f, err := remote.ReadSnapshot(ctx, b, h)
+		if err != nil {
+			return 1, err
+		}
+		taken := "-"
+		if t, ok := f.Time(); ok {
+			taken = t.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\n", h, taken, displayPath(p))
+	}
+	return 0, nil
+}
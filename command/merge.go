@@ -19,36 +19,161 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/resources"
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
 )
 
-const mergeUsage = `Usage: %s merge <SOURCE> <DESTINATION>
+const mergeUsage = `Usage: %s merge [<FLAGS>]* <SOURCE> <DESTINATION>
 
 Where <DESTINATION> is a local file path, and <SOURCE> is one of:
 
 	The hash of a known snapshot.
 	A local file path which has previously been snapshotted.
+
+<FLAGS> are one of:
+
 `
 
-func mergeCommand(ctx context.Context, s *storage.LocalFiles, cmd string, args []string) (int, error) {
-	if len(args) != 2 {
-		fmt.Fprintf(flag.CommandLine.Output(), mergeUsage, cmd)
+var (
+	mergeFlags = flag.NewFlagSet("merge", flag.ContinueOnError)
+
+	mergeToolFlag = mergeFlags.String(
+		"tool", os.Getenv("RVCS_MERGE_TOOL"),
+		"external tool used to resolve conflicting changes to a file (defaults to the value of the RVCS_MERGE_TOOL environment variable).\n"+
+			"The variables $BASE, $LOCAL, $REMOTE, and $MERGED in the command are replaced with the corresponding paths;\n"+
+			"if none are referenced then the paths are appended in that order. The tool must write the result to $MERGED,\n"+
+			"and the merge fails if the tool exits with an error or leaves any conflict markers in the result")
+	mergeStrategyFlag = mergeFlags.String(
+		"strategy", "",
+		"strategy used to resolve conflicting changes without any interaction; one of \"ours\", \"theirs\", or \"newest-mtime\".\n"+
+			"Only the files changed on both sides are resolved this way, and the strategy takes precedence over -tool")
+	mergeJobsFlag = mergeFlags.Int(
+		"jobs", 0,
+		"maximum number of files to restore concurrently; 0 means the number of workers shown by \"resources\"")
+	mergeDryRunFlag = mergeFlags.Bool(
+		"dry-run", false,
+		"do not change anything, but instead list the files that the merge would change and any conflicting changes.\n"+
+			"Each file is prefixed with \"A\", \"M\", or \"D\" if it would be added, modified, or deleted, \"=\" if it would be kept as-is, or \"C\" for an unresolved conflict")
+)
+
+func mergeToolResolver(ctx context.Context, base, local, remote, merged snapshot.Path) error {
+	vars := map[string]snapshot.Path{
+		"BASE":   base,
+		"LOCAL":  local,
+		"REMOTE": remote,
+		"MERGED": merged,
+	}
+	return runTool(ctx, *mergeToolFlag, vars, []string{"BASE", "LOCAL", "REMOTE", "MERGED"}, false)
+}
+
+var mergeSubcommand = &subcommand{
+	summary: "merge a snapshot into a local path",
+	usage:   mergeUsage,
+	flags:   mergeFlags,
+	examples: []string{
+		"merge sha256:<HASH> ~/notes",
+		"merge -strategy=theirs sha256:<HASH> ~/notes",
+		"merge -dry-run sha256:<HASH> ~/notes",
+	},
+	run: mergeCommand,
+}
+
+func mergeCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := mergeFlags.Parse(args); err != nil {
 		return 1, nil
 	}
+	args = mergeFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
 	h, err := resolveSnapshot(ctx, s, args[0])
 	if err != nil {
-		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %v", args[0], err)
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
 	}
 	abs, err := filepath.Abs(args[1])
 	if err != nil {
-		return 1, fmt.Errorf("failure determining the absolute path of %q: %v", args[1], err)
+		return 1, fmt.Errorf("failure determining the absolute path of %q: %w", args[1], err)
+	}
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return 1, err
+	}
+	budget, err := resources.Load(s)
+	if err != nil {
+		return 1, err
 	}
-	if err := merge.Merge(ctx, s, h, snapshot.Path(abs)); err != nil {
-		return 1, fmt.Errorf("failure merging %q into %q: %v", h, abs, err)
+	snapshotOpts := append(provenanceOptions(s), formatOpt)
+	opts := []merge.Option{
+		merge.WithSnapshotOptions(append(snapshotOpts, resourceOptions(budget)...)...),
+		merge.WithJobs(jobs(budget, *mergeJobsFlag)),
+	}
+	if len(*mergeToolFlag) > 0 {
+		opts = append(opts, merge.WithResolver(mergeToolResolver))
+	}
+	if len(*mergeStrategyFlag) > 0 {
+		strategy, err := merge.ParseStrategy(*mergeStrategyFlag)
+		if err != nil {
+			return 1, err
+		}
+		opts = append(opts, merge.WithStrategy(strategy))
+	}
+	if *mergeDryRunFlag {
+		return previewMerge(ctx, s, h, snapshot.Path(abs), opts)
+	}
+	prev, err := latestSnapshot(ctx, s, snapshot.Path(abs))
+	if err != nil {
+		return 1, err
+	}
+	if err := merge.Merge(ctx, s, h, snapshot.Path(abs), opts...); err != nil {
+		return 1, fmt.Errorf("failure merging %q into %q: %w", h, abs, err)
+	}
+	if err := recordHeadChange(ctx, s, "merge", snapshot.Path(abs), prev); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// previewMerge prints what merging the snapshot `h` into `dest` would do.
+//
+// The exit code is 1 if the merge would fail due to unresolved conflicts.
+func previewMerge(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, dest snapshot.Path, opts []merge.Option) (int, error) {
+	preview, err := merge.PreviewMerge(ctx, s, h, dest, opts...)
+	if err != nil {
+		return 1, fmt.Errorf("failure previewing the merge of %q into %q: %w", h, dest, err)
+	}
+	if len(preview.Outcomes) == 0 {
+		fmt.Printf("Merging %q into %q would not change anything\n", h, dest)
+		return 0, nil
+	}
+	var unresolved int
+	for _, o := range preview.Outcomes {
+		kind, note := o.Kind, ""
+		if len(kind) == 0 {
+			kind = "="
+		}
+		conflict := "conflict"
+		if o.MetadataConflict {
+			conflict = "conflicting permissions"
+		}
+		switch {
+		case o.Conflict && len(o.Resolution) == 0:
+			kind, note = "C", fmt.Sprintf(" (%s)", conflict)
+			unresolved++
+		case o.Resolution == merge.ResolvedByTool:
+			note = " (conflict, resolved with -tool)"
+		case o.Conflict:
+			note = fmt.Sprintf(" (%s, resolved with the %q strategy)", conflict, o.Resolution)
+		}
+		fmt.Printf("%s %s%s\n", kind, displayPath(dest.Join(snapshot.Path(o.Path))), note)
+	}
+	if unresolved > 0 {
+		fmt.Printf("The merge would fail due to %d unresolved conflicts; use -strategy or -tool to resolve them\n", unresolved)
+		return 1, nil
 	}
 	return 0, nil
 }
@@ -0,0 +1,112 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestMergeToolResolver(t *testing.T) {
+	ctx := context.Background()
+	tool := *mergeToolFlag
+	t.Cleanup(func() { *mergeToolFlag = tool })
+	for _, tc := range []struct {
+		name         string
+		script       string
+		wantErr      bool
+		wantConflict bool
+		want         string
+	}{
+		{
+			name:   "success",
+			script: "cat \"$2\" \"$3\" > \"$4\"\n",
+			want:   "ours\ntheirs\n",
+		},
+		{
+			name:    "failure",
+			script:  "echo resolved > \"$4\"\nexit 3\n",
+			wantErr: true,
+			want:    "ours\n",
+		},
+		{
+			name:         "markers",
+			script:       "printf '<<<<<<< local\\nours\\n=======\\ntheirs\\n>>>>>>> remote\\n' > \"$4\"\n",
+			wantErr:      true,
+			wantConflict: true,
+			want:         "ours\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+			script := filepath.Join(dir, "tool.sh")
+			if err := os.WriteFile(script, []byte("#!/bin/sh\n"+tc.script), 0700); err != nil {
+				t.Fatalf("failure writing the merge tool script: %v", err)
+			}
+			*mergeToolFlag = script
+
+			src := filepath.Join(dir, "src")
+			if err := os.WriteFile(src, []byte("original\n"), 0600); err != nil {
+				t.Fatalf("failure creating the source file: %v", err)
+			}
+			h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+			if err != nil {
+				t.Fatalf("failure snapshotting the source file: %v", err)
+			}
+			dest := filepath.Join(dir, "dest")
+			if err := merge.Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+				t.Fatalf("failure checking out the initial snapshot: %v", err)
+			}
+			if err := os.WriteFile(src, []byte("theirs\n"), 0600); err != nil {
+				t.Fatalf("failure updating the source file: %v", err)
+			}
+			if err := os.WriteFile(dest, []byte("ours\n"), 0600); err != nil {
+				t.Fatalf("failure updating the destination file: %v", err)
+			}
+			h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+			if err != nil {
+				t.Fatalf("failure resnapshotting the source file: %v", err)
+			}
+
+			err = merge.Merge(ctx, s, h2, snapshot.Path(dest), merge.WithResolver(mergeToolResolver))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("unexpected result from merging with the tool: got %v, want error: %v", err, tc.wantErr)
+			}
+			if gotConflict := errors.Is(err, storage.ErrConflict); gotConflict != tc.wantConflict {
+				t.Errorf("unexpected conflict error: got %v, want conflict: %v", err, tc.wantConflict)
+			}
+			if got, err := os.ReadFile(dest); err != nil {
+				t.Errorf("failure reading the merged file: %v", err)
+			} else if string(got) != tc.want {
+				t.Errorf("unexpected contents for the merged file: got %q, want %q", got, tc.want)
+			}
+			_, f, err := s.FindSnapshot(ctx, snapshot.Path(dest))
+			if err != nil {
+				t.Fatalf("failure looking up the latest snapshot of the destination: %v", err)
+			}
+			if merged := len(f.Parents) == 2 && f.Parents[1].Equal(h2); merged == tc.wantErr {
+				t.Errorf("unexpected parents of the latest destination snapshot: %v", f.Parents)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/recursive-version-control-system/metrics"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const metricsUsage = `Usage: %s metrics [<FLAGS>]*
+
+Prints metrics about the archive in the Prometheus text format, so that
+the health of backups can be monitored and alerted on.
+
+The metrics include how many snapshots succeeded and failed, how long
+they took, how many objects and bytes they stored, how often the path
+info cache was hit, how many pushes and pulls failed, the bytes
+transferred to and from each remote, and the size of the archive.
+
+With -listen, the metrics are instead served over HTTP at the path
+"/metrics" until the command is interrupted. Otherwise the output can
+be written to a file for the node exporter's textfile collector.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	metricsFlags = flag.NewFlagSet("metrics", flag.ContinueOnError)
+
+	metricsListenFlag = metricsFlags.String(
+		"listen", "",
+		"address, such as \"localhost:9464\", on which to serve the metrics over HTTP")
+)
+
+// recordSnapshotMetrics records the metrics for a snapshot by `sn` that started at `start`.
+func recordSnapshotMetrics(ctx context.Context, s *storage.LocalFiles, sn *snapshot.Snapshotter, start time.Time, succeeded bool) error {
+	hits, misses := sn.CacheStats()
+	c := &metrics.Counters{
+		ObjectsStored: s.StoredObjects(),
+		BytesStored:   s.StoredBytes(),
+		CacheHits:     hits,
+		CacheMisses:   misses,
+	}
+	if succeeded {
+		now := time.Now()
+		c.Snapshots = 1
+		c.SnapshotSeconds = now.Sub(start).Seconds()
+		c.LastSnapshot = now
+		c.LastSnapshotSeconds = c.SnapshotSeconds
+	} else {
+		c.SnapshotFailures = 1
+	}
+	return metrics.Record(ctx, s, c)
+}
+
+var metricsSubcommand = &subcommand{
+	summary: "report metrics about the archive for monitoring",
+	usage:   metricsUsage,
+	flags:   metricsFlags,
+	examples: []string{
+		"metrics > /var/lib/node_exporter/textfile_collector/rvcs.prom",
+		"metrics -listen=localhost:9464",
+	},
+	run: metricsCommand,
+}
+
+func metricsCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := metricsFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(metricsFlags.Args()) != 0 {
+		return -1, nil
+	}
+	if len(*metricsListenFlag) == 0 {
+		if err := metrics.Write(ctx, os.Stdout, s); err != nil {
+			return 1, fmt.Errorf("failure writing the metrics: %w", err)
+		}
+		return 0, nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var out bytes.Buffer
+		if err := metrics.Write(r.Context(), &out, s); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(out.Bytes())
+	})
+	server := &http.Server{Addr: *metricsListenFlag, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics at http://%s/metrics\n", *metricsListenFlag)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return 1, fmt.Errorf("failure serving the metrics: %w", err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const notesUsage = `Usage: %s notes <ACTION>
+
+Where <ACTION> is one of:
+
+	add [--file=<FILE>] <SOURCE>
+	show <SOURCE>
+
+And <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Notes attach additional objects, such as test results or build logs, to
+a snapshot without changing its hash. If no file is given when adding a
+note, then the note is read from standard input.
+`
+
+var (
+	notesAddFlags = flag.NewFlagSet("notes add", flag.ContinueOnError)
+
+	notesAddFileFlag = notesAddFlags.String(
+		"file", "",
+		"file holding the contents of the note")
+)
+
+func notesAdd(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := notesAddFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = notesAddFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	var contents io.Reader = os.Stdin
+	if len(*notesAddFileFlag) > 0 {
+		f, err := os.Open(*notesAddFileFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure opening the note file %q: %w", *notesAddFileFlag, err)
+		}
+		defer f.Close()
+		contents = f
+	}
+	note, err := s.StoreObject(ctx, contents)
+	if err != nil {
+		return 1, fmt.Errorf("failure storing the note: %w", err)
+	}
+	if err := s.AddNote(ctx, h, note); err != nil {
+		return 1, fmt.Errorf("failure attaching the note %q to %q: %w", note, h, err)
+	}
+	fmt.Printf("Attached the note %q to %q\n", note, h)
+	return 0, nil
+}
+
+func notesShow(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) != 1 {
+		return -1, nil
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	notes, err := s.ListNotes(ctx, h)
+	if err != nil {
+		return 1, err
+	}
+	for i, note := range notes {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Note %s:\n", note)
+		reader, err := s.ReadObject(ctx, note)
+		if err != nil {
+			return 1, fmt.Errorf("failure opening the note %q: %w", note, err)
+		}
+		_, err = io.Copy(os.Stdout, reader)
+		reader.Close()
+		if err != nil {
+			return 1, fmt.Errorf("failure reading the note %q: %w", note, err)
+		}
+	}
+	return 0, nil
+}
+
+var notesSubcommand = &subcommand{
+	summary:     "attach notes to snapshots",
+	usage:       notesUsage,
+	actionFlags: []*flag.FlagSet{notesAddFlags},
+	examples: []string{
+		"notes add --file=test-results.txt ~/project",
+		"notes show ~/project",
+	},
+	run: notesCommand,
+}
+
+func notesCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	var ret int
+	var err error
+	switch args[0] {
+	case "add":
+		ret, err = notesAdd(ctx, s, args[1:])
+	case "show":
+		ret, err = notesShow(ctx, s, args[1:])
+	default:
+		ret = -1
+	}
+	return ret, err
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/patch"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const formatPatchUsage = `Usage: %[1]s format-patch [<FLAGS>]* <BEFORE>..<AFTER>
+
+Or: %[1]s format-patch [<FLAGS>]* <BEFORE> <AFTER>
+
+Where <BEFORE> and <AFTER> are each one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+The second form must be used if either path contains "..".
+
+The patch lists the changes to each file. Changes to text files are
+written as unified diffs, while all other changes only reference the
+new contents by their hash. Anyone applying the patch must already have
+those contents, e.g. from pulling them or from a bundle.
+
+<FLAGS> are one of:
+
+`
+
+const applyPatchUsage = `Usage: %s apply-patch <PATCH> <BASE>
+
+Where <PATCH> is a file written by "format-patch", or "-" for standard
+input, and <BASE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+The changes in the patch are applied on top of <BASE>, and the hash of
+the resulting snapshot is printed. <BASE> does not have to be the
+snapshot that the patch was created from; changes to text files are
+applied wherever their surrounding lines match.
+
+The resulting snapshot is not written to the filesystem. Use the
+"merge" subcommand to update a local file path with it.
+`
+
+var (
+	formatPatchFlags = flag.NewFlagSet("format-patch", flag.ContinueOnError)
+
+	formatPatchOutputFlag = formatPatchFlags.String(
+		"o", "",
+		"file to write the patch to. If not set, then the patch is written to standard output")
+)
+
+var formatPatchSubcommand = &subcommand{
+	summary: "write the changes between two snapshots as a patch",
+	usage:   formatPatchUsage,
+	flags:   formatPatchFlags,
+	examples: []string{
+		"format-patch sha256:<HASH>..sha256:<HASH> > notes.patch",
+		"format-patch -o notes.patch sha256:<HASH> ~/notes",
+	},
+	run: formatPatchCommand,
+}
+
+func formatPatchCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := formatPatchFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = formatPatchFlags.Args()
+	if len(args) == 1 {
+		if before, after, ok := strings.Cut(args[0], ".."); ok {
+			args = []string{before, after}
+		}
+	}
+	if len(args) != 2 {
+		return -1, nil
+	}
+	before, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	after, err := resolveSnapshot(ctx, s, args[1])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[1], err)
+	}
+	var out io.Writer = os.Stdout
+	if len(*formatPatchOutputFlag) > 0 {
+		f, err := os.Create(*formatPatchOutputFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure creating the patch file %q: %w", *formatPatchOutputFlag, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := patch.Format(ctx, s, out, before, after); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+var applyPatchFlags = flag.NewFlagSet("apply-patch", flag.ContinueOnError)
+
+var applyPatchSubcommand = &subcommand{
+	summary: "apply a patch on top of a snapshot",
+	usage:   applyPatchUsage,
+	flags:   applyPatchFlags,
+	examples: []string{
+		"apply-patch notes.patch ~/notes",
+	},
+	run: applyPatchCommand,
+}
+
+func applyPatchCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := applyPatchFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = applyPatchFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return 1, fmt.Errorf("failure opening the patch %q: %w", args[0], err)
+		}
+		defer f.Close()
+		in = f
+	}
+	base, err := resolveSnapshot(ctx, s, args[1])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[1], err)
+	}
+	h, err := patch.Apply(ctx, s, in, base)
+	if err != nil {
+		return 1, fmt.Errorf("failure applying the patch %q to %q: %w", args[0], base, err)
+	}
+	fmt.Println(h)
+	return 0, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// progressInterval is the minimum time between progress updates.
+const progressInterval = 250 * time.Millisecond
+
+// snapshotProgress reports the progress of a snapshot against an estimate from a pre-scan.
+type snapshotProgress struct {
+	out      io.Writer
+	estimate *snapshot.Estimate
+	start    time.Time
+
+	mu      sync.Mutex
+	files   int64
+	bytes   int64
+	printed time.Time
+	width   int
+}
+
+func newSnapshotProgress(estimate *snapshot.Estimate) *snapshotProgress {
+	return &snapshotProgress{
+		out:      os.Stderr,
+		estimate: estimate,
+		start:    time.Now(),
+	}
+}
+
+// update records that the path `p` was snapshotted, and is passed to `snapshot.WithProgress`.
+func (sp *snapshotProgress) update(p snapshot.Path, info os.FileInfo, h *snapshot.Hash) {
+	if !info.Mode().IsRegular() {
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.files++
+	sp.bytes += info.Size()
+	if now := time.Now(); now.Sub(sp.printed) >= progressInterval {
+		sp.printed = now
+		sp.print(sp.describe(now))
+	}
+}
+
+// print replaces the previously printed status line with `status`.
+func (sp *snapshotProgress) print(status string) {
+	padding := sp.width - len(status)
+	if padding < 0 {
+		padding = 0
+	}
+	fmt.Fprintf(sp.out, "\r%s%s", status, strings.Repeat(" ", padding))
+	sp.width = len(status)
+}
+
+// fraction returns the estimated fraction of the snapshot that has completed.
+//
+// Progress is measured in bytes, or in files if the files are all empty.
+func (sp *snapshotProgress) fraction() float64 {
+	var fraction float64
+	if sp.estimate.Bytes > 0 {
+		fraction = float64(sp.bytes) / float64(sp.estimate.Bytes)
+	} else if sp.estimate.Files > 0 {
+		fraction = float64(sp.files) / float64(sp.estimate.Files)
+	}
+	if fraction > 1 {
+		// The files may have grown since the pre-scan, or been read more than once by -verify.
+		fraction = 1
+	}
+	return fraction
+}
+
+func (sp *snapshotProgress) describe(now time.Time) string {
+	fraction := sp.fraction()
+	status := fmt.Sprintf("%3.0f%% (%d of %d files, %d of %d bytes)", fraction*100, sp.files, sp.estimate.Files, sp.bytes, sp.estimate.Bytes)
+	if fraction <= 0 || fraction >= 1 {
+		return status
+	}
+	elapsed := now.Sub(sp.start)
+	remaining := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+	return fmt.Sprintf("%s, about %v remaining", status, remaining.Round(time.Second))
+}
+
+// done reports the final progress, and ends the progress output.
+func (sp *snapshotProgress) done() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.print(sp.describe(time.Now()))
+	fmt.Fprintln(sp.out)
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/metrics"
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/resources"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/track"
+)
+
+const pullUsage = `Usage: %s pull [<FLAGS>]* <SOURCE>
+
+Where <SOURCE> is one of:
+
+	The hash of a snapshot.
+	A file path whose latest snapshot should be read from the remotes. If
+	the path is linked to a track, then the track's latest snapshot is read.
+
+Paths are read from the namespace configured with "remote namespace",
+falling back to paths recorded without a namespace. Use the -namespace
+flag to instead pull a path pushed from another machine.
+
+Objects received from remotes accessed using a backend plugin are
+compressed if the plugin supports it. Use the -no-compress flag to skip
+this for data that is already compressed.
+
+When <SOURCE> is a path that has been snapshotted locally, the pulled
+snapshot is merged into it if the local and remote changes touch disjoint
+files, or only change the contents and the permissions of a file on
+different sides. Otherwise, or if the -no-merge flag is given, the pulled snapshot
+can be merged into a local path using the "merge" subcommand.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	pullFlags = flag.NewFlagSet("pull", flag.ContinueOnError)
+
+	pullRemoteFlag = pullFlags.String(
+		"remote", "",
+		"name of the only remote to pull from. By default, every configured remote is tried in order of priority")
+	pullNamespaceFlag = pullFlags.String(
+		"namespace", "",
+		"namespace to read <SOURCE> from when it is a path. By default, the configured namespace is used")
+	pullNoCompressFlag = pullFlags.Bool(
+		"no-compress", false,
+		"do not compress the objects received from backend plugins")
+	pullNoMergeFlag = pullFlags.Bool(
+		"no-merge", false,
+		"only read the snapshot, without merging it into <SOURCE> when that is a local path")
+)
+
+// findNamespacedSnapshot looks up the latest snapshot of the path `p` in the namespace selected for pulling.
+func findNamespacedSnapshot(ctx context.Context, s *storage.LocalFiles, remotes []*remote.Remote, p snapshot.Path) (*snapshot.Hash, error) {
+	namespace := *pullNamespaceFlag
+	if len(namespace) > 0 {
+		if err := remote.ValidateNamespace(namespace); err != nil {
+			return nil, err
+		}
+		h, _, err := remote.FindSnapshot(ctx, remotes, remote.NamespacedPath(namespace, p))
+		return h, err
+	}
+	namespace, err := remote.ReadNamespace(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespace) > 0 {
+		if h, _, err := remote.FindSnapshot(ctx, remotes, remote.NamespacedPath(namespace, p)); err == nil {
+			return h, nil
+		}
+	}
+	h, _, err := remote.FindSnapshot(ctx, remotes, p)
+	return h, err
+}
+
+var pullSubcommand = &subcommand{
+	summary: "read snapshots from the remotes",
+	usage:   pullUsage,
+	flags:   pullFlags,
+	examples: []string{
+		"pull ~/notes",
+		"pull -namespace=machine/desktop /home/me/docs",
+		"pull -no-merge ~/notes",
+	},
+	run: pullCommand,
+}
+
+func pullCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := pullFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = pullFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	remotes, err := selectRemotes(s, *pullRemoteFlag, *pullNoCompressFlag)
+	if err != nil {
+		return 1, err
+	}
+	var local snapshot.Path
+	h, err := snapshot.ParseHash(args[0])
+	if err != nil {
+		abs, err := filepath.Abs(args[0])
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[0], err)
+		}
+		local = snapshot.Path(abs)
+		trackID, linked, err := track.ForPath(s, local)
+		if err != nil {
+			return 1, err
+		}
+		if linked {
+			h, _, err = remote.FindTrack(ctx, remotes, trackID)
+		} else {
+			h, err = findNamespacedSnapshot(ctx, s, remotes, local)
+		}
+		if err != nil {
+			return 1, err
+		}
+	}
+	stats, err := remote.Pull(ctx, s, remotes, h)
+	if err != nil {
+		metrics.Record(ctx, s, &metrics.Counters{PullFailures: 1})
+		return 1, fmt.Errorf("failure pulling %q: %w", h, err)
+	}
+	fmt.Printf("Pulled %q\n", h)
+	var names []string
+	for name := range stats.Fetched {
+		names = append(names, name)
+	}
+	for name := range stats.Mismatched {
+		if _, ok := stats.Fetched[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("    %d objects fetched and verified from %q\n", stats.Fetched[name], name)
+		if mismatched := stats.Mismatched[name]; mismatched > 0 {
+			fmt.Printf("    %d objects from %q did not match their hashes and were quarantined\n", mismatched, name)
+		}
+	}
+	fmt.Printf("    %d objects already present\n", stats.Present)
+	if len(local) == 0 || *pullNoMergeFlag {
+		return 0, nil
+	}
+	return mergePulled(ctx, s, h, local)
+}
+
+// mergePulled merges the pulled snapshot `h` into the local path `p` if that does not require resolving any conflicts.
+//
+// Paths that have never been snapshotted locally are left as-is.
+func mergePulled(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, p snapshot.Path) (int, error) {
+	prev, err := latestSnapshot(ctx, s, p)
+	if err != nil {
+		return 1, err
+	} else if prev == nil {
+		return 0, nil
+	}
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return 1, err
+	}
+	budget, err := resources.Load(s)
+	if err != nil {
+		return 1, err
+	}
+	snapshotOpts := append(provenanceOptions(s), formatOpt)
+	opts := []merge.Option{
+		merge.WithSnapshotOptions(append(snapshotOpts, resourceOptions(budget)...)...),
+		merge.WithJobs(jobs(budget, 0)),
+	}
+	mergeErr := merge.Merge(ctx, s, h, p, opts...)
+	if mergeErr != nil && !errors.Is(mergeErr, storage.ErrConflict) {
+		return 1, fmt.Errorf("failure merging %q into %q: %w", h, p, mergeErr)
+	}
+	// Even a conflicting merge may have snapshotted local changes first.
+	if err := recordHeadChange(ctx, s, "pull", p, prev); err != nil {
+		return 1, err
+	}
+	if mergeErr != nil {
+		fmt.Printf("Changes in %q conflict with the pulled snapshot; use the \"merge\" subcommand to resolve them\n", displayPath(p))
+		return 0, nil
+	}
+	fmt.Printf("Merged %q into %q\n", h, displayPath(p))
+	return 0, nil
+}
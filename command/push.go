@@ -0,0 +1,180 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/metrics"
+	"github.com/google/recursive-version-control-system/redact"
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/track"
+)
+
+const pushUsage = `Usage: %s push [<FLAGS>]* <PATH>
+
+Where <PATH> is a local file path which has previously been snapshotted.
+
+The latest snapshot of <PATH> is copied to the remotes, along with its
+entire history. If a previous push was interrupted part way through
+copying a large file, then the copy resumes where it left off. If <PATH>
+is linked to a track, then the remote's snapshot of the track is updated too.
+
+Objects sent to remotes accessed using a backend plugin are compressed
+if the plugin supports it. Use the -no-compress flag to skip this for
+data that is already compressed. Small objects are sent to those
+remotes in batches, so that pushing many small files does not take a
+round trip per file.
+
+With -redact-metadata, a redacted copy of the snapshot and its history
+is pushed instead, without the author of each snapshot and with the
+times recorded in them truncated to the day. The contents of the files
+are unchanged. Redacted copies are stored locally too, so that later
+redacted pushes only copy what changed.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	pushFlags = flag.NewFlagSet("push", flag.ContinueOnError)
+
+	pushRemoteFlag = pushFlags.String(
+		"remote", "",
+		"name of the only remote to push to. By default, the snapshot is pushed to every configured remote")
+	pushNoCompressFlag = pushFlags.Bool(
+		"no-compress", false,
+		"do not compress the objects sent to backend plugins")
+	pushBatchObjectsFlag = pushFlags.Int(
+		"batch-objects", 1000,
+		"maximum number of small objects sent to a backend plugin in a single request; values below 2 disable batching")
+	pushBatchObjectSizeFlag = pushFlags.Int64(
+		"batch-object-size", 64*1024,
+		"size in bytes of the largest object that is batched with others when sent to a backend plugin")
+	pushRedactMetadataFlag = pushFlags.Bool(
+		"redact-metadata", false,
+		"push a copy of the history without the author of each snapshot, and with the times truncated to the day")
+)
+
+// selectRemotes returns the configured remotes, limited to the one with the given name if it is not empty.
+func selectRemotes(s *storage.LocalFiles, name string, noCompress bool) ([]*remote.Remote, error) {
+	remotes, err := remote.ReadRemotes(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range remotes {
+		r.NoCompress = noCompress
+	}
+	if len(name) == 0 {
+		return remotes, nil
+	}
+	for _, r := range remotes {
+		if r.Name == name {
+			return []*remote.Remote{r}, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no remote named %q", name)
+}
+
+// pushTrack records the snapshot `h` as the latest snapshot of the given track in the remote.
+func pushTrack(ctx context.Context, r *remote.Remote, trackID string, h *snapshot.Hash) error {
+	b, err := r.Backend(ctx)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	if err := b.StoreTrack(ctx, trackID, h); err != nil {
+		return fmt.Errorf("failure updating the track %q in %q: %w", trackID, r.Name, err)
+	}
+	return nil
+}
+
+var pushSubcommand = &subcommand{
+	summary: "copy snapshots to the remotes",
+	usage:   pushUsage,
+	flags:   pushFlags,
+	examples: []string{
+		"push ~/notes",
+		"push -batch-objects=5000 ~/maildir",
+		"push -redact-metadata -remote=public ~/src/project",
+	},
+	run: pushCommand,
+}
+
+func pushCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := pushFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = pushFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	abs, err := filepath.Abs(args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[0], err)
+	}
+	remotes, err := selectRemotes(s, *pushRemoteFlag, *pushNoCompressFlag)
+	if err != nil {
+		return 1, err
+	}
+	if len(remotes) == 0 {
+		return 1, fmt.Errorf("no remotes are configured")
+	}
+	trackID, linked, err := track.ForPath(s, snapshot.Path(abs))
+	if err != nil {
+		return 1, err
+	}
+	var redacted *snapshot.Hash
+	if *pushRedactMetadataFlag {
+		h, _, err := s.FindSnapshot(ctx, snapshot.Path(abs))
+		if err != nil {
+			return 1, fmt.Errorf("failure looking up the latest snapshot of %q: %w", abs, err)
+		}
+		if redacted, err = redact.Snapshot(ctx, s, h); err != nil {
+			return 1, fmt.Errorf("failure redacting the metadata of %q: %w", h, err)
+		}
+	}
+	for _, r := range remotes {
+		r.Batch = remote.BatchOptions{
+			MaxObjects:    *pushBatchObjectsFlag,
+			MaxObjectSize: *pushBatchObjectSizeFlag,
+		}
+		h := redacted
+		var stats *remote.PushStats
+		if redacted != nil {
+			stats, err = remote.PushSnapshot(ctx, s, r, snapshot.Path(abs), redacted)
+		} else {
+			h, stats, err = remote.Push(ctx, s, r, snapshot.Path(abs))
+		}
+		if err != nil {
+			metrics.Record(ctx, s, &metrics.Counters{PushFailures: 1})
+			return 1, err
+		}
+		if linked {
+			if err := pushTrack(ctx, r, trackID, h); err != nil {
+				return 1, err
+			}
+		}
+		fmt.Printf("Pushed %q to %q\n", h, r.Name)
+		fmt.Printf("    %d objects copied (%d resumed), %d objects already present\n", stats.Pushed, stats.Resumed, stats.Present)
+	}
+	return 0, nil
+}
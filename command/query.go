@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const queryUsage = `Usage: %s query [<FLAGS>]* [<CONDITION>]*
+
+Where <CONDITION> has the form <FIELD><OPERATOR><VALUE>, and <FIELD> is one of:
+
+	path	the path that was snapshotted
+	hash	the hash of the snapshot
+	time	when the snapshot was generated, as a date (YYYY-MM-DD) or in RFC 3339 format
+	files	the number of files in the snapshot
+	size	the total size of the files in the snapshot, counting identical files each time
+	new	the number of bytes of new data that the snapshot added to the archive
+
+<OPERATOR> is one of "=", "!=", "<", "<=", ">", or ">=", or "~" to
+match a path along with every path nested beneath it. Sizes may have a
+unit suffix such as "KB", "MiB", or "GB".
+
+Snapshots are only recorded in the index once it has been enabled with
+the -enable flag. The snapshots matching every condition are then
+printed in the order they were generated, one per line, with the
+fields separated by tabs.
+
+For example, the snapshots that added over 1GB of new data in June 2022
+are listed by:
+
+	%[1]s query 'new>1GB' 'time>=2022-06-01' 'time<2022-07-01'
+
+<FLAGS> are one of:
+
+`
+
+var (
+	queryFlags = flag.NewFlagSet("query", flag.ContinueOnError)
+
+	queryEnableFlag = queryFlags.Bool(
+		"enable", false,
+		"start recording every new snapshot in the index")
+	queryDisableFlag = queryFlags.Bool(
+		"disable", false,
+		"stop recording snapshots, and remove the index")
+)
+
+var querySubcommand = &subcommand{
+	summary: "query the index of snapshot metadata",
+	usage:   queryUsage,
+	flags:   queryFlags,
+	examples: []string{
+		"query -enable",
+		"query 'path~/home/me/docs' 'size>=500MiB'",
+	},
+	run: queryCommand,
+}
+
+func queryCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := queryFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = queryFlags.Args()
+	if *queryEnableFlag || *queryDisableFlag {
+		if len(args) > 0 || (*queryEnableFlag && *queryDisableFlag) {
+			return -1, nil
+		}
+		if *queryDisableFlag {
+			if err := index.Disable(ctx, s); err != nil {
+				return 1, err
+			}
+			return 0, nil
+		}
+		if err := index.Enable(ctx, s); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	var conditions []*index.Condition
+	for _, arg := range args {
+		c, err := index.ParseCondition(arg)
+		if err != nil {
+			return 1, err
+		}
+		conditions = append(conditions, c)
+	}
+	entries, err := index.Read(s)
+	if err != nil {
+		return 1, err
+	}
+	for _, e := range index.Query(entries, conditions) {
+		fmt.Printf("%s\t%s\t%s\t%d\t%d\t%d\n", e.Time.Format(time.RFC3339), e.Hash, displayPath(e.Path), e.Files, e.Size, e.NewBytes)
+	}
+	return 0, nil
+}
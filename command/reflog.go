@@ -0,0 +1,125 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/reflog"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const reflogUsage = `Usage: %[1]s reflog [<PATH>]
+
+Where <PATH> is a local filesystem path.
+
+Lists every change to the latest snapshot of <PATH>, or of every path if
+<PATH> is omitted, oldest first. Each line shows when the change was made,
+the subcommand that made it, and the previous and new snapshots.
+
+Snapshots that are no longer in the history of a path, such as ones
+removed by "undo", can be found here.
+`
+
+var reflogFlags = flag.NewFlagSet("reflog", flag.ContinueOnError)
+
+var reflogSubcommand = &subcommand{
+	summary: "list the changes to the latest snapshots of paths",
+	usage:   reflogUsage,
+	flags:   reflogFlags,
+	examples: []string{
+		"reflog",
+		"reflog ~/notes",
+	},
+	run: reflogCommand,
+}
+
+func reflogCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := reflogFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = reflogFlags.Args()
+	if len(args) > 1 {
+		return -1, nil
+	}
+	var p snapshot.Path
+	if len(args) == 1 {
+		abs, err := filepath.Abs(args[0])
+		if err != nil {
+			return 1, fmt.Errorf("failure determining the absolute path of %q: %w", args[0], err)
+		}
+		p = snapshot.Path(abs)
+	}
+	entries, err := reflog.Read(s, p)
+	if err != nil {
+		return 1, err
+	}
+	for _, e := range entries {
+		fmt.Printf("%s %-8s %s -> %s %s\n", e.Time.Local().Format(time.RFC3339), e.Action, reflogHash(e.Prev), reflogHash(e.New), displayPath(e.Path))
+	}
+	return 0, nil
+}
+
+// reflogHash returns the form of a reflog hash shown to users, using "-" for a missing hash.
+func reflogHash(h *snapshot.Hash) string {
+	if h == nil {
+		return "-"
+	}
+	return h.String()
+}
+
+// latestSnapshot returns the hash of the latest snapshot of `p`, or nil if it has never been snapshotted.
+func latestSnapshot(ctx context.Context, s *storage.LocalFiles, p snapshot.Path) (*snapshot.Hash, error) {
+	h, _, err := s.FindSnapshot(ctx, p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	return h, nil
+}
+
+// recordHeadChange records in the reflog that `action` changed the latest snapshot of `p` from `prev` to its current value.
+func recordHeadChange(ctx context.Context, s *storage.LocalFiles, action string, p snapshot.Path, prev *snapshot.Hash) error {
+	h, err := latestSnapshot(ctx, s, p)
+	if err != nil {
+		return err
+	}
+	return recordMapping(ctx, s, action, p, prev, h)
+}
+
+// recordMapping records that `action` changed the latest snapshot of `p` from `prev` to `h`.
+//
+// The change is added to the reflog, and the new history is added to
+// the object and name indexes if those are enabled.
+func recordMapping(ctx context.Context, s *storage.LocalFiles, action string, p snapshot.Path, prev, h *snapshot.Hash) error {
+	if h != nil && !h.Equal(prev) {
+		if err := index.RecordObjects(ctx, s, p, prev, h); err != nil {
+			return err
+		}
+		if err := index.RecordNames(ctx, s, p, prev, h); err != nil {
+			return err
+		}
+	}
+	return reflog.Record(ctx, s, action, p, prev, h)
+}
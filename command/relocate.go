@@ -0,0 +1,118 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/reflog"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/track"
+)
+
+const relocateUsage = `Usage: %[1]s relocate <OLD-PATH> <NEW-PATH>
+
+Where <OLD-PATH> and <NEW-PATH> are local filesystem paths.
+
+Moves the history of <OLD-PATH> to <NEW-PATH>, for when a directory
+has been moved or a drive is mounted at a new location. Subsequent
+snapshots of <NEW-PATH> then continue the history of <OLD-PATH>, rather
+than starting a new, unrelated history.
+
+The latest snapshots of <OLD-PATH> and every path within it, their
+cached file information, their reflog entries, and any track linked to
+them are all moved to the corresponding paths within <NEW-PATH>.
+Neither the files themselves nor any background service installed with
+"service" are changed.
+
+<NEW-PATH> must not already have a different latest snapshot. If the
+relocation is interrupted, it can be safely run again.
+
+This is not allowed in append-only archives.
+`
+
+var relocateFlags = flag.NewFlagSet("relocate", flag.ContinueOnError)
+
+var relocateSubcommand = &subcommand{
+	summary: "move the history of a path to a new location",
+	usage:   relocateUsage,
+	flags:   relocateFlags,
+	examples: []string{
+		"relocate ~/notes ~/Documents/notes",
+		"relocate /media/old-usb-drive /media/backup",
+	},
+	run: relocateCommand,
+}
+
+// relocateTrackLinks updates the track links for `old`, and for any path within it, to be for `new`.
+func relocateTrackLinks(ctx context.Context, s *storage.LocalFiles, old, new snapshot.Path) error {
+	links, err := track.ReadLinks(s)
+	if err != nil {
+		return err
+	}
+	relocated := false
+	for _, l := range links {
+		if p, ok := l.Path.Relocate(old, new); ok {
+			l.Path = p
+			relocated = true
+		}
+	}
+	if !relocated {
+		return nil
+	}
+	return track.WriteLinks(ctx, s, links)
+}
+
+func relocateCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := relocateFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = relocateFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	var paths []snapshot.Path
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure determining the absolute path of %q: %w", arg, err)
+		}
+		paths = append(paths, snapshot.Path(abs))
+	}
+	old, new := paths[0], paths[1]
+	moveRefs := func() error {
+		// These are moved before the mappings for the old path are
+		// removed, so that retrying an interrupted relocation finds
+		// and finishes moving them.
+		if err := reflog.Relocate(ctx, s, old, new); err != nil {
+			return err
+		}
+		if err := index.RelocateLocations(ctx, s, old, new); err != nil {
+			return err
+		}
+		return relocateTrackLinks(ctx, s, old, new)
+	}
+	if err := s.Relocate(ctx, old, new, moveRefs); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Relocated %q to %q\n", old, new)
+	return 0, nil
+}
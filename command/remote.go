@@ -0,0 +1,390 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const remoteUsage = `Usage: %s remote <ACTION>
+
+Where <ACTION> is one of:
+
+	add [--priority=<N>] [--append-only] [<LIMIT-FLAGS>]* <NAME> <ARCHIVE-DIR>
+	limits [<LIMIT-FLAGS>]* <NAME>
+	remove <NAME>
+	list
+	ls [--namespace=<NAMESPACE>] [<NAME>]
+	namespace [<NAMESPACE>]
+	stats [<NAME>]
+
+Remotes are tried in increasing order of priority when pulling.
+
+<ARCHIVE-DIR> is usually a local path, which may be on a separate drive
+or a network mount. Other storage services can be used via backend
+plugins by instead specifying <BACKEND>::<ADDRESS>, in which case the
+remote is accessed by running the "rvcs-backend-<BACKEND>" executable
+from the PATH with <ADDRESS> as its argument.
+
+Adding a remote with --append-only marks the remote archive itself so
+that pushes to it may only fast-forward the snapshots of each path, and
+may never remove them. The mark cannot be removed using rvcs, and it
+is only supported for remotes accessed via the file system.
+
+Remotes can be given limits on the rate of requests sent to them, on
+how many times failed requests are retried, with exponential backoff
+and jitter between retries, and on how long each request may take.
+This keeps large pushes within the request limits of storage services,
+and makes requests to a hung network mount or an unresponsive service
+fail rather than wait forever. With --break-after, requests to a remote
+fail immediately for the --break-for duration once that many requests
+in a row have failed, and then a single request is sent to test the
+remote before the others resume. These limits only cover requests to
+the remote itself; reading and writing the local archive, and reading
+the contents of an object after the remote has opened it, are not
+limited. Use the "limits" action to print or change the limits of an
+existing remote. <LIMIT-FLAGS> are --max-requests-per-second, --burst,
+--max-retries, --timeout, --break-after, and --break-for.
+
+Several machines can push to the same remote by each setting a
+different namespace, such as "machine/laptop", with the "namespace"
+action. The paths pushed from a machine are then recorded in remotes
+beneath its namespace, e.g. "/machine/laptop/home/me/docs", and pulls
+of a path read it from the same namespace unless told otherwise. Run
+"namespace" without arguments to print the current namespace, or with
+"" to remove it.
+
+The "ls" action lists the paths recorded in each remote, or only in the
+remote named <NAME>. These can be pulled from another machine using the
+"-namespace" flag of the "pull" subcommand. Listing paths is only
+supported for remotes accessed via the file system.
+
+The "stats" action prints the transfer statistics recorded for each
+remote, or only for the remote named <NAME>. These are the totals of
+every successful push and pull from this archive, and include the time
+of the last successful push and pull so that stalled syncs can be
+spotted.
+`
+
+var (
+	remoteAddFlags = flag.NewFlagSet("remote add", flag.ContinueOnError)
+
+	remoteAddPriorityFlag = remoteAddFlags.Int(
+		"priority", 0,
+		"priority of the remote; remotes with lower priorities are tried first")
+	remoteAddAppendOnlyFlag = remoteAddFlags.Bool(
+		"append-only", false,
+		"mark the remote archive as append-only")
+
+	remoteAddLimits = addLimitFlags(remoteAddFlags)
+
+	remoteLimitsFlags = flag.NewFlagSet("remote limits", flag.ContinueOnError)
+
+	remoteLimitsLimits = addLimitFlags(remoteLimitsFlags)
+
+	remoteLsFlags = flag.NewFlagSet("remote ls", flag.ContinueOnError)
+
+	remoteLsNamespaceFlag = remoteLsFlags.String(
+		"namespace", "",
+		"only list the paths within this namespace, with the namespace removed. By default, every path is listed")
+)
+
+// limitFlags holds the flags for setting the request limits of a remote.
+type limitFlags struct {
+	requestsPerSecond *float64
+	burst             *int
+	maxRetries        *int
+	timeout           *time.Duration
+	breakAfter        *int
+	breakFor          *time.Duration
+}
+
+func addLimitFlags(fs *flag.FlagSet) *limitFlags {
+	return &limitFlags{
+		requestsPerSecond: fs.Float64(
+			"max-requests-per-second", 0,
+			"maximum sustained rate of requests sent to the remote; 0 means no limit"),
+		burst: fs.Int(
+			"burst", 1,
+			"number of requests that may be sent at once before the rate limit applies"),
+		maxRetries: fs.Int(
+			"max-retries", 0,
+			"maximum number of times a failed request to the remote is retried"),
+		timeout: fs.Duration(
+			"timeout", 0,
+			"maximum time each attempt of a request to the remote may take; 0 means no limit"),
+		breakAfter: fs.Int(
+			"break-after", 0,
+			"number of consecutive failed requests after which requests to the remote fail immediately; 0 means never"),
+		breakFor: fs.Duration(
+			"break-for", 0,
+			"how long requests fail immediately once --break-after is reached; 0 means 30s"),
+	}
+}
+
+// apply updates the given limits with any of the flags that were set in `fs`.
+func (lf *limitFlags) apply(fs *flag.FlagSet, limits *remote.RequestLimits) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-requests-per-second":
+			limits.RequestsPerSecond = *lf.requestsPerSecond
+		case "burst":
+			limits.Burst = *lf.burst
+		case "max-retries":
+			limits.MaxRetries = *lf.maxRetries
+		case "timeout":
+			limits.Timeout = *lf.timeout
+		case "break-after":
+			limits.BreakAfter = *lf.breakAfter
+		case "break-for":
+			limits.BreakFor = *lf.breakFor
+		}
+	})
+}
+
+func remoteAdd(ctx context.Context, s *storage.LocalFiles, remotes []*remote.Remote, args []string) (int, error) {
+	if err := remoteAddFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = remoteAddFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	for _, r := range remotes {
+		if r.Name == args[0] {
+			return 1, fmt.Errorf("the remote %q already exists", args[0])
+		}
+	}
+	r := &remote.Remote{
+		Name:       args[0],
+		Priority:   *remoteAddPriorityFlag,
+		ArchiveDir: args[1],
+	}
+	_, _, isPlugin := r.Plugin()
+	remoteAddLimits.apply(remoteAddFlags, &r.Limits)
+	if !isPlugin {
+		archiveDir, err := filepath.Abs(args[1])
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[1], err)
+		}
+		r.ArchiveDir = archiveDir
+	}
+	if *remoteAddAppendOnlyFlag {
+		if isPlugin {
+			return 1, fmt.Errorf("the remote %q uses a backend plugin, and cannot be marked as append-only", r.Name)
+		}
+		if err := r.Storage().SetAppendOnly(ctx); err != nil {
+			return 1, fmt.Errorf("failure marking the remote %q as append-only: %w", r.Name, err)
+		}
+	}
+	remotes = append(remotes, r)
+	if err := remote.WriteRemotes(ctx, s, remotes); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func remoteRemove(ctx context.Context, s *storage.LocalFiles, remotes []*remote.Remote, args []string) (int, error) {
+	if len(args) != 1 {
+		return -1, nil
+	}
+	var remaining []*remote.Remote
+	for _, r := range remotes {
+		if r.Name != args[0] {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) == len(remotes) {
+		return 1, fmt.Errorf("there is no remote named %q", args[0])
+	}
+	if err := remote.WriteRemotes(ctx, s, remaining); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func remoteLimits(ctx context.Context, s *storage.LocalFiles, remotes []*remote.Remote, args []string) (int, error) {
+	if err := remoteLimitsFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = remoteLimitsFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	for _, r := range remotes {
+		if r.Name != args[0] {
+			continue
+		}
+		if remoteLimitsFlags.NFlag() == 0 {
+			fmt.Printf("max-requests-per-second\t%g\nburst\t%d\nmax-retries\t%d\n", r.Limits.RequestsPerSecond, r.Limits.Burst, r.Limits.MaxRetries)
+			fmt.Printf("timeout\t%v\nbreak-after\t%d\nbreak-for\t%v\n", r.Limits.Timeout, r.Limits.BreakAfter, r.Limits.BreakFor)
+			return 0, nil
+		}
+		remoteLimitsLimits.apply(remoteLimitsFlags, &r.Limits)
+		if err := remote.WriteRemotes(ctx, s, remotes); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	return 1, fmt.Errorf("there is no remote named %q", args[0])
+}
+
+func remoteLs(ctx context.Context, remotes []*remote.Remote, args []string) (int, error) {
+	if err := remoteLsFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = remoteLsFlags.Args()
+	if len(args) > 1 {
+		return -1, nil
+	}
+	if err := remote.ValidateNamespace(*remoteLsNamespaceFlag); err != nil {
+		return 1, err
+	}
+	found := false
+	for _, r := range remotes {
+		if len(args) > 0 && r.Name != args[0] {
+			continue
+		}
+		found = true
+		paths, err := remote.ListPaths(ctx, r, *remoteLsNamespaceFlag)
+		if err != nil {
+			return 1, err
+		}
+		for _, p := range paths {
+			fmt.Printf("%s\t%s\n", r.Name, p)
+		}
+	}
+	if len(args) > 0 && !found {
+		return 1, fmt.Errorf("there is no remote named %q", args[0])
+	}
+	return 0, nil
+}
+
+// formatLastTime formats the time of the last successful transfer or snapshot, for "remote stats" and "health".
+func formatLastTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Round(time.Second))
+}
+
+func remoteStats(s *storage.LocalFiles, remotes []*remote.Remote, args []string) (int, error) {
+	if len(args) > 1 {
+		return -1, nil
+	}
+	stats, err := remote.ReadTransferStats(s)
+	if err != nil {
+		return 1, err
+	}
+	found := false
+	for _, r := range remotes {
+		if len(args) > 0 && r.Name != args[0] {
+			continue
+		}
+		found = true
+		ts, ok := stats[r.Name]
+		if !ok {
+			ts = &remote.TransferStats{}
+		}
+		fmt.Printf("%s:\n", r.Name)
+		fmt.Printf("    sent:      %d bytes in %d objects, %d objects already present\n", ts.BytesSent, ts.ObjectsSent, ts.DedupHits)
+		fmt.Printf("    received:  %d bytes in %d objects\n", ts.BytesReceived, ts.ObjectsReceived)
+		fmt.Printf("    last push: %s\n", formatLastTime(ts.LastPush))
+		fmt.Printf("    last pull: %s\n", formatLastTime(ts.LastPull))
+	}
+	if len(args) > 0 && !found {
+		return 1, fmt.Errorf("there is no remote named %q", args[0])
+	}
+	return 0, nil
+}
+
+func remoteNamespace(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) > 1 {
+		return -1, nil
+	}
+	if len(args) == 0 {
+		namespace, err := remote.ReadNamespace(s)
+		if err != nil {
+			return 1, err
+		}
+		fmt.Println(namespace)
+		return 0, nil
+	}
+	if err := remote.WriteNamespace(ctx, s, args[0]); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+var remoteSubcommand = &subcommand{
+	summary:     "manage the remotes used for pushing and pulling",
+	usage:       remoteUsage,
+	actionFlags: []*flag.FlagSet{remoteAddFlags, remoteLimitsFlags, remoteLsFlags},
+	examples: []string{
+		"remote add backup /mnt/backup/rvcs",
+		"remote add --priority=10 ipfs ipfs::http://127.0.0.1:5001",
+		"remote list",
+		"remote limits --max-requests-per-second=100 --burst=20 --max-retries=5 cloud",
+		"remote limits --timeout=2m --break-after=10 --break-for=5m backup",
+		"remote namespace machine/laptop",
+		"remote ls --namespace=machine/desktop backup",
+		"remote stats backup",
+	},
+	run: remoteCommand,
+}
+
+func remoteCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	remotes, err := remote.ReadRemotes(s)
+	if err != nil {
+		return 1, err
+	}
+	var ret int
+	switch args[0] {
+	case "add":
+		ret, err = remoteAdd(ctx, s, remotes, args[1:])
+	case "remove":
+		ret, err = remoteRemove(ctx, s, remotes, args[1:])
+	case "limits":
+		ret, err = remoteLimits(ctx, s, remotes, args[1:])
+	case "list":
+		for _, r := range remotes {
+			var appendOnly string
+			if _, _, isPlugin := r.Plugin(); !isPlugin && r.Storage().AppendOnly() {
+				appendOnly = "\tappend-only"
+			}
+			fmt.Printf("%s\t%d\t%s%s\n", r.Name, r.Priority, r.ArchiveDir, appendOnly)
+		}
+	case "ls":
+		ret, err = remoteLs(ctx, remotes, args[1:])
+	case "namespace":
+		ret, err = remoteNamespace(ctx, s, args[1:])
+	case "stats":
+		ret, err = remoteStats(s, remotes, args[1:])
+	default:
+		ret = -1
+	}
+	return ret, err
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/google/recursive-version-control-system/resources"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const resourcesUsage = `Usage: %s resources [<FLAGS>]*
+
+Prints or changes the concurrency and memory settings of rvcs.
+
+Each setting is detected from the number of CPUs and the amount of
+available memory unless it is overridden in the archive's config using
+the flags below, or using its environment variable. Environment
+variables take precedence over the archive's config.
+
+With no flags, the current value of each setting is printed along with
+its environment variable and where the value came from. A flag value
+of 0 removes the override, so that the value is detected again.
+
+The "workers" setting is the default for the -jobs flag of the
+"snapshot", "merge", and "restore" subcommands.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	resourcesFlags = flag.NewFlagSet("resources", flag.ContinueOnError)
+
+	resourcesValueFlags = map[string]*int64{
+		resources.Workers: resourcesFlags.Int64(
+			resources.Workers, 0,
+			"maximum number of files read or written concurrently"),
+		resources.ReadBufferSize: resourcesFlags.Int64(
+			resources.ReadBufferSize, 0,
+			"size, in bytes, of the buffer used to read each file"),
+		resources.MaxInFlightBytes: resourcesFlags.Int64(
+			resources.MaxInFlightBytes, 0,
+			"maximum combined size, in bytes, of the files being read at the same time"),
+		resources.CacheMemory: resourcesFlags.Int64(
+			resources.CacheMemory, 0,
+			"approximate memory, in bytes, used for pending updates to the path info cache"),
+	}
+)
+
+var resourcesSubcommand = &subcommand{
+	summary: "print or change the concurrency and memory settings",
+	usage:   resourcesUsage,
+	flags:   resourcesFlags,
+	examples: []string{
+		"resources",
+		"resources -workers=2 -max-in-flight-bytes=67108864",
+		"resources -workers=0",
+	},
+	run: resourcesCommand,
+}
+
+// jobs returns the number of workers to use, given the value of a -jobs flag.
+//
+// Values of the flag below 1 mean the configured number of workers is used.
+func jobs(b *resources.Budget, jobsFlag int) int {
+	if jobsFlag > 0 {
+		return jobsFlag
+	}
+	return b.Workers()
+}
+
+// resourceOptions returns the snapshot options for reading files within the given budget.
+func resourceOptions(b *resources.Budget) []snapshot.Option {
+	return []snapshot.Option{
+		snapshot.WithReadBufferSize(b.ReadBufferSize()),
+		snapshot.WithMaxInFlightBytes(b.MaxInFlightBytes()),
+	}
+}
+
+func resourcesCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := resourcesFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(resourcesFlags.Args()) > 0 {
+		return -1, nil
+	}
+	if resourcesFlags.NFlag() == 0 {
+		b, err := resources.Load(s)
+		if err != nil {
+			return 1, err
+		}
+		for _, name := range resources.Names {
+			fmt.Printf("%s\t%d\t%s\t%s\n", name, b.Values[name], resources.EnvVar(name), b.Sources[name])
+		}
+		return 0, nil
+	}
+	configured, err := resources.ReadConfig(s)
+	if err != nil {
+		return 1, err
+	}
+	var invalid error
+	resourcesFlags.Visit(func(f *flag.Flag) {
+		v := *resourcesValueFlags[f.Name]
+		switch {
+		case v < 0:
+			invalid = fmt.Errorf("the -%s flag must not be negative", f.Name)
+		case v == 0:
+			delete(configured, f.Name)
+		default:
+			configured[f.Name] = v
+		}
+	})
+	if invalid != nil {
+		return 1, invalid
+	}
+	if err := resources.WriteConfig(ctx, s, configured); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
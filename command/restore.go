@@ -0,0 +1,177 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/resources"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const restoreUsage = `Usage: %[1]s restore [<FLAGS>]* <SOURCE> <DESTINATION>
+
+Or: %[1]s restore -group=<GROUP> [<FLAGS>]*
+
+Where <DESTINATION> is a local file path, <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+And <GROUP> is either the name of a group recorded with "snapshot -group",
+or the hash of one of its earlier versions.
+
+Updates <DESTINATION> to match <SOURCE>, or each path in <GROUP> to match
+its snapshot in the group. Unlike "merge", any changes that are not in the
+restored snapshot are undone. Each destination is snapshotted before it is
+restored, so those changes remain available in the archive.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	restoreFlags = flag.NewFlagSet("restore", flag.ContinueOnError)
+
+	restoreGroupFlag = restoreFlags.String(
+		"group", "",
+		"restore every path in the named group, or in the group with the given hash, to its snapshot in that group")
+	restoreJobsFlag = restoreFlags.Int(
+		"jobs", 0,
+		"maximum number of files to restore concurrently; 0 means the number of workers shown by \"resources\"")
+)
+
+var restoreSubcommand = &subcommand{
+	summary: "restore local paths to earlier snapshots",
+	usage:   restoreUsage,
+	flags:   restoreFlags,
+	examples: []string{
+		"restore sha256:<HASH> ~/notes",
+		"restore -group=app",
+		"restore -group=sha256:<HASH>",
+	},
+	run: restoreCommand,
+}
+
+// resolveGroup returns the hash of the group named by `name`, which may be either a group name or a group hash.
+func resolveGroup(ctx context.Context, s *storage.LocalFiles, name string) (*snapshot.Hash, error) {
+	if storage.ValidTrackID(name) {
+		h, err := s.FindGroup(ctx, name)
+		if err == nil {
+			return h, nil
+		}
+		if _, parseErr := snapshot.ParseHash(name); parseErr != nil {
+			return nil, fmt.Errorf("failure looking up the group %q: %w", name, err)
+		}
+	}
+	h, err := snapshot.ParseHash(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown group %q: %w", name, err)
+	}
+	if !s.HasObject(ctx, h) {
+		if expanded, err := s.ExpandHash(ctx, h); err == nil {
+			return expanded, nil
+		}
+	}
+	return h, nil
+}
+
+func restoreCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := restoreFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = restoreFlags.Args()
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return 1, err
+	}
+	budget, err := resources.Load(s)
+	if err != nil {
+		return 1, err
+	}
+	snapshotOpts := append(provenanceOptions(s), formatOpt)
+	opts := []merge.Option{
+		merge.WithSnapshotOptions(append(snapshotOpts, resourceOptions(budget)...)...),
+		merge.WithJobs(jobs(budget, *restoreJobsFlag)),
+	}
+	if len(*restoreGroupFlag) == 0 {
+		if len(args) != 2 {
+			return -1, nil
+		}
+		h, err := resolveSnapshot(ctx, s, args[0])
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+		}
+		abs, err := filepath.Abs(args[1])
+		if err != nil {
+			return 1, fmt.Errorf("failure determining the absolute path of %q: %w", args[1], err)
+		}
+		if err := restorePath(ctx, s, h, snapshot.Path(abs), opts); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	if len(args) != 0 {
+		return -1, nil
+	}
+	groupHash, err := resolveGroup(ctx, s, *restoreGroupFlag)
+	if err != nil {
+		return 1, err
+	}
+	g, err := s.ReadGroup(ctx, groupHash)
+	if err != nil {
+		return 1, err
+	}
+	var paths []snapshot.Path
+	for p := range g.Snapshots {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	for _, p := range paths {
+		if err := restorePath(ctx, s, g.Snapshots[p], p, opts); err != nil {
+			return 1, fmt.Errorf("failure restoring the group %q: %w", groupHash, err)
+		}
+	}
+	fmt.Printf("Restored the %d paths in the group %q\n", len(paths), groupHash)
+	return 0, nil
+}
+
+// restorePath restores the path `dest` to the snapshot `h`, and reports where its previous contents were saved.
+func restorePath(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, dest snapshot.Path, opts []merge.Option) error {
+	head, err := latestSnapshot(ctx, s, dest)
+	if err != nil {
+		return err
+	}
+	prev, err := merge.Restore(ctx, s, h, dest, opts...)
+	if err != nil {
+		return err
+	}
+	if err := recordHeadChange(ctx, s, "restore", dest, head); err != nil {
+		return err
+	}
+	if prev == nil || prev.Equal(h) {
+		fmt.Printf("Restored %q to %q\n", dest, h)
+		return nil
+	}
+	fmt.Printf("Restored %q to %q; its previous contents were snapshotted as %q\n", dest, h, prev)
+	return nil
+}
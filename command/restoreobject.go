@@ -0,0 +1,134 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const restoreObjectUsage = `Usage: %s restore-object [<FLAGS>]* <HASH> <DESTINATION>
+
+Where <HASH> is the hash of an object in the archive, such as the
+contents of a file listed by "duplicates", and <DESTINATION> is a local
+file path, or "-" to write the object to standard output.
+
+Writes the object to <DESTINATION> without needing to know which
+snapshot refers to it. The contents are checked against <HASH> before
+<DESTINATION> is created.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	restoreObjectFlags = flag.NewFlagSet("restore-object", flag.ContinueOnError)
+
+	restoreObjectForceFlag = restoreObjectFlags.Bool(
+		"force", false,
+		"replace <DESTINATION> if it already exists")
+	restoreObjectModeFlag = restoreObjectFlags.String(
+		"mode", "0644",
+		"octal permissions of the restored file")
+)
+
+var restoreObjectSubcommand = &subcommand{
+	summary: "write an object from the archive to a file",
+	usage:   restoreObjectUsage,
+	flags:   restoreObjectFlags,
+	examples: []string{
+		"restore-object sha256:<HASH> ~/recovered.jpg",
+		"restore-object sha256:<HASH> - | less",
+	},
+	run: restoreObjectCommand,
+}
+
+func restoreObjectCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := restoreObjectFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = restoreObjectFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	h, err := snapshot.ParseHash(args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure parsing the object hash %q: %w", args[0], err)
+	}
+	mode, err := strconv.ParseUint(*restoreObjectModeFlag, 8, 32)
+	if err != nil {
+		return 1, fmt.Errorf("failure parsing the file mode %q: %w", *restoreObjectModeFlag, err)
+	}
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return 1, fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	defer reader.Close()
+	if args[1] == "-" {
+		// The contents can only be checked after they have been written.
+		if err := copyVerified(os.Stdout, reader, h); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	dest, err := filepath.Abs(args[1])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[1], err)
+	}
+	if _, err := os.Lstat(dest); err == nil && !*restoreObjectForceFlag {
+		return 1, fmt.Errorf("the destination %q already exists; use -force to replace it", dest)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".rvcs-restore-*")
+	if err != nil {
+		return 1, fmt.Errorf("failure creating a temporary file for %q: %w", dest, err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyVerified(tmp, reader, h); err != nil {
+		tmp.Close()
+		return 1, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 1, fmt.Errorf("failure writing the temporary file for %q: %w", dest, err)
+	}
+	if err := os.Chmod(tmp.Name(), os.FileMode(mode).Perm()); err != nil {
+		return 1, fmt.Errorf("failure setting the permissions of %q: %w", dest, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return 1, fmt.Errorf("failure moving the restored object to %q: %w", dest, err)
+	}
+	fmt.Printf("Restored %q to %q\n", h, dest)
+	return 0, nil
+}
+
+// copyVerified copies the object `h` from `reader` to `w`, and checks that the copied contents match the hash.
+func copyVerified(w io.Writer, reader io.Reader, h *snapshot.Hash) error {
+	got, err := snapshot.NewHash(io.TeeReader(reader, w))
+	if err != nil {
+		return fmt.Errorf("failure copying the object %q: %w", h, err)
+	}
+	if !got.Equal(h) {
+		return fmt.Errorf("%w: the contents of the object %q have the hash %q", storage.ErrCorrupt, h, got)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRestoreObject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	t.Cleanup(func() {
+		restoreObjectFlags.Set("force", "false")
+		restoreObjectFlags.Set("mode", "0644")
+	})
+	h, err := s.StoreObject(ctx, strings.NewReader("hello, world"))
+	if err != nil {
+		t.Fatalf("failure storing the example object: %v", err)
+	}
+	dest := filepath.Join(dir, "restored.txt")
+	restore := func(args ...string) (int, error) {
+		var code int
+		var err error
+		captureStdout(t, func() {
+			code, err = restoreObjectCommand(ctx, s, args)
+		})
+		return code, err
+	}
+
+	if code, err := restore("-mode", "0600", h.String(), dest); err != nil || code != 0 {
+		t.Fatalf("failure restoring the object, exit code %d: %v", code, err)
+	}
+	if got, err := os.ReadFile(dest); err != nil {
+		t.Fatalf("failure reading the restored file: %v", err)
+	} else if string(got) != "hello, world" {
+		t.Errorf("unexpected contents of the restored file: got %q, want %q", got, "hello, world")
+	}
+	if info, err := os.Stat(dest); err != nil {
+		t.Fatalf("failure checking the restored file: %v", err)
+	} else if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("unexpected permissions of the restored file: got %o, want %o", got, 0600)
+	}
+
+	if err := os.WriteFile(dest, []byte("changed"), 0600); err != nil {
+		t.Fatalf("failure changing the restored file: %v", err)
+	}
+	if code, _ := restore(h.String(), dest); code == 0 {
+		t.Error("unexpectedly replaced an existing file without -force")
+	}
+	if code, err := restore("-force", h.String(), dest); err != nil || code != 0 {
+		t.Fatalf("failure restoring the object with -force, exit code %d: %v", code, err)
+	}
+	if got, err := os.ReadFile(dest); err != nil {
+		t.Fatalf("failure reading the restored file: %v", err)
+	} else if string(got) != "hello, world" {
+		t.Errorf("unexpected contents of the replaced file: got %q, want %q", got, "hello, world")
+	}
+
+	out := captureStdout(t, func() {
+		if code, err := restoreObjectCommand(ctx, s, []string{h.String(), "-"}); err != nil || code != 0 {
+			t.Errorf("failure writing the object to standard output, exit code %d: %v", code, err)
+		}
+	})
+	if out != "hello, world" {
+		t.Errorf("unexpected object written to standard output: got %q, want %q", out, "hello, world")
+	}
+}
+
+func TestRestoreObjectCorrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	h, err := s.StoreObject(ctx, strings.NewReader("hello, world"))
+	if err != nil {
+		t.Fatalf("failure storing the example object: %v", err)
+	}
+	objFile := filepath.Join(s.ArchiveDir, "objects", h.Function(), h.HexContents()[0:2], h.HexContents()[2:4], h.HexContents()[4:])
+	if err := os.Chmod(objFile, 0600); err != nil {
+		t.Fatalf("failure making the object writable: %v", err)
+	}
+	if err := os.WriteFile(objFile, []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("failure corrupting the object: %v", err)
+	}
+	dest := filepath.Join(dir, "restored.txt")
+	var code int
+	captureStdout(t, func() {
+		code, err = restoreObjectCommand(ctx, s, []string{h.String(), dest})
+	})
+	if code == 0 || !errors.Is(err, storage.ErrCorrupt) {
+		t.Errorf("unexpected result from restoring a corrupted object: exit code %d, error %v", code, err)
+	}
+	if _, err := os.Lstat(dest); !os.IsNotExist(err) {
+		t.Errorf("the destination was created for a corrupted object: %v", err)
+	}
+	if matches, err := filepath.Glob(filepath.Join(dir, ".rvcs-restore-*")); err != nil || len(matches) > 0 {
+		t.Errorf("temporary files were left behind: %v, %v", matches, err)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const serviceUsage = `Usage: %s service <ACTION>
+
+Where <ACTION> is one of:
+
+	install [--path=<PATH>] [--every=<DURATION>]
+	uninstall [--path=<PATH>]
+
+Installing a service sets up the operating system to periodically run
+"snapshot" on <PATH> in the background for the current user, using a
+systemd user timer on Linux or a launchd agent on macOS. The snapshots
+run with -quiet and -io-nice so that they do not get in the way, and
+with -newest-first so that the most recently modified files are
+captured first.
+
+<PATH> defaults to the current working directory, and each path gets
+its own service, so installing a service for the same path again
+replaces its schedule. <DURATION> is a Go duration such as "30m" or
+"2h", and must be at least one minute.
+`
+
+var (
+	serviceInstallFlags = flag.NewFlagSet("service install", flag.ContinueOnError)
+
+	serviceInstallPathFlag = serviceInstallFlags.String(
+		"path", "",
+		"local path to snapshot. If not set, then the current working directory is used")
+	serviceInstallEveryFlag = serviceInstallFlags.Duration(
+		"every", 30*time.Minute,
+		"how often to snapshot the path")
+
+	serviceUninstallFlags = flag.NewFlagSet("service uninstall", flag.ContinueOnError)
+
+	serviceUninstallPathFlag = serviceUninstallFlags.String(
+		"path", "",
+		"local path whose service to remove. If not set, then the current working directory is used")
+)
+
+// serviceName returns the name of the service that snapshots the given path.
+//
+// The name is derived from a hash of the path, so that it is stable
+// and does not need any escaping.
+func serviceName(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("rvcs-snapshot-%x", sum[:8])
+}
+
+// servicePath resolves the path flag of a service action to an absolute path.
+func servicePath(path string) (string, error) {
+	if len(path) == 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failure determining the current working directory: %w", err)
+		}
+		path = wd
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failure resolving the absolute path of %q: %w", path, err)
+	}
+	return abs, nil
+}
+
+// serviceCommandLine returns the command run by the service for the given path.
+//
+// The service always uses the store in `s`, even if the default store changes later.
+func serviceCommandLine(s *storage.LocalFiles, path string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failure resolving the path of the rvcs executable: %w", err)
+	}
+	return []string{exe, "--store=" + s.ArchiveDir, "snapshot", "-quiet", "-io-nice", "-newest-first", path}, nil
+}
+
+// systemdQuote quotes a single command line argument for use in a systemd unit file.
+func systemdQuote(arg string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '%':
+			b.WriteString("%%")
+		case '$':
+			b.WriteString("$$")
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// systemdUnits returns the contents of the systemd service and timer units for the given path.
+func systemdUnits(path string, args []string, every time.Duration) (service, timer string) {
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	description := strings.NewReplacer("%", "%%", "\n", " ").Replace(path)
+	service = fmt.Sprintf(`[Unit]
+Description=rvcs snapshots of %s
+
+[Service]
+Type=oneshot
+ExecStart=%s
+Nice=10
+`, description, strings.Join(quoted, " "))
+	seconds := int64(every / time.Second)
+	timer = fmt.Sprintf(`[Unit]
+Description=Periodic rvcs snapshots of %s
+
+[Timer]
+OnBootSec=%ds
+OnUnitActiveSec=%ds
+
+[Install]
+WantedBy=timers.target
+`, description, seconds, seconds)
+	return service, timer
+}
+
+// launchdPlist returns the contents of the launchd agent definition for the given path.
+func launchdPlist(label string, args []string, every time.Duration) (string, error) {
+	escape := func(s string) (string, error) {
+		var b bytes.Buffer
+		if err := xml.EscapeText(&b, []byte(s)); err != nil {
+			return "", fmt.Errorf("failure escaping %q: %w", s, err)
+		}
+		return b.String(), nil
+	}
+	var programArgs strings.Builder
+	for _, arg := range args {
+		escaped, err := escape(arg)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&programArgs, "\t\t<string>%s</string>\n", escaped)
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>StartInterval</key>
+	<integer>%d</integer>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>ProcessType</key>
+	<string>Background</string>
+	<key>LowPriorityIO</key>
+	<true/>
+</dict>
+</plist>
+`, label, programArgs.String(), int64(every/time.Second)), nil
+}
+
+// serviceFiles returns the paths of the files defining the service with the given name.
+func serviceFiles(name string) ([]string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failure resolving the user's config dir: %w", err)
+		}
+		unitDir := filepath.Join(configDir, "systemd", "user")
+		return []string{filepath.Join(unitDir, name+".service"), filepath.Join(unitDir, name+".timer")}, nil
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failure resolving the user's home dir: %w", err)
+		}
+		return []string{filepath.Join(home, "Library", "LaunchAgents", launchdLabel(name)+".plist")}, nil
+	}
+	return nil, fmt.Errorf("background services are not supported on %s", runtime.GOOS)
+}
+
+// launchdLabel returns the launchd label for the service with the given name.
+func launchdLabel(name string) string {
+	return "com.github.google.rvcs." + name
+}
+
+// runServiceManager runs a command of the operating system's service manager.
+func runServiceManager(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failure running %q: %w", strings.Join(append([]string{name}, args...), " "), err)
+	}
+	return nil
+}
+
+func serviceInstall(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := serviceInstallFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(serviceInstallFlags.Args()) > 0 {
+		return -1, nil
+	}
+	every := *serviceInstallEveryFlag
+	if every < time.Minute {
+		return 1, fmt.Errorf("the interval %v is too short; it must be at least one minute", every)
+	}
+	path, err := servicePath(*serviceInstallPathFlag)
+	if err != nil {
+		return 1, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return 1, fmt.Errorf("failure checking the path %q: %w", path, err)
+	}
+	cmdLine, err := serviceCommandLine(s, path)
+	if err != nil {
+		return 1, err
+	}
+	name := serviceName(path)
+	files, err := serviceFiles(name)
+	if err != nil {
+		return 1, err
+	}
+	var contents []string
+	if runtime.GOOS == "darwin" {
+		plist, err := launchdPlist(launchdLabel(name), cmdLine, every)
+		if err != nil {
+			return 1, err
+		}
+		contents = []string{plist}
+	} else {
+		service, timer := systemdUnits(path, cmdLine, every)
+		contents = []string{service, timer}
+	}
+	for i, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return 1, fmt.Errorf("failure creating the directory for %q: %w", file, err)
+		}
+		if err := os.WriteFile(file, []byte(contents[i]), 0600); err != nil {
+			return 1, fmt.Errorf("failure writing the service definition %q: %w", file, err)
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		// Unloading fails if the agent was not already loaded, which is fine.
+		exec.CommandContext(ctx, "launchctl", "unload", files[0]).Run()
+		if err := runServiceManager(ctx, "launchctl", "load", "-w", files[0]); err != nil {
+			return 1, err
+		}
+	} else {
+		if err := runServiceManager(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+			return 1, err
+		}
+		if err := runServiceManager(ctx, "systemctl", "--user", "enable", "--now", name+".timer"); err != nil {
+			return 1, err
+		}
+	}
+	fmt.Printf("Installed the service %q to snapshot %q every %v\n", name, path, every)
+	return 0, nil
+}
+
+func serviceUninstall(ctx context.Context, args []string) (int, error) {
+	if err := serviceUninstallFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(serviceUninstallFlags.Args()) > 0 {
+		return -1, nil
+	}
+	path, err := servicePath(*serviceUninstallPathFlag)
+	if err != nil {
+		return 1, err
+	}
+	name := serviceName(path)
+	files, err := serviceFiles(name)
+	if err != nil {
+		return 1, err
+	}
+	if _, err := os.Stat(files[0]); err != nil {
+		return 1, fmt.Errorf("there is no service for %q: %w", path, err)
+	}
+	if runtime.GOOS == "darwin" {
+		if err := runServiceManager(ctx, "launchctl", "unload", "-w", files[0]); err != nil {
+			return 1, err
+		}
+	} else {
+		if err := runServiceManager(ctx, "systemctl", "--user", "disable", "--now", name+".timer"); err != nil {
+			return 1, err
+		}
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return 1, fmt.Errorf("failure removing the service definition %q: %w", file, err)
+		}
+	}
+	if runtime.GOOS != "darwin" {
+		if err := runServiceManager(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+			return 1, err
+		}
+	}
+	fmt.Printf("Removed the service %q for %q\n", name, path)
+	return 0, nil
+}
+
+var serviceSubcommand = &subcommand{
+	summary:     "install a background service that periodically snapshots a path",
+	usage:       serviceUsage,
+	actionFlags: []*flag.FlagSet{serviceInstallFlags, serviceUninstallFlags},
+	examples: []string{
+		"service install --path ~/notes --every 30m",
+		"service uninstall --path ~/notes",
+	},
+	run: serviceCommand,
+}
+
+func serviceCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	switch args[0] {
+	case "install":
+		return serviceInstall(ctx, s, args[1:])
+	case "uninstall":
+		return serviceUninstall(ctx, args[1:])
+	}
+	return -1, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestServiceCommandLine(t *testing.T) {
+	s := &storage.LocalFiles{ArchiveDir: "/example/archive"}
+	args, err := serviceCommandLine(s, "/example/notes")
+	if err != nil {
+		t.Fatalf("failure generating the service command line: %v", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failure resolving the test executable: %v", err)
+	}
+	want := []string{exe, "--store=/example/archive", "snapshot", "-quiet", "-io-nice", "-newest-first", "/example/notes"}
+	if strings.Join(args, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected service command line: got %q, want %q", args, want)
+	}
+	for _, arg := range args[3 : len(args)-1] {
+		if snapshotFlags.Lookup(strings.TrimPrefix(arg, "-")) == nil {
+			t.Errorf("the service passes the flag %q, which is not a snapshot flag", arg)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	name := serviceName("/example/notes")
+	if got := serviceName("/example/notes"); got != name {
+		t.Errorf("service name is not stable: got %q, then %q", name, got)
+	}
+	if got := serviceName("/example/photos"); got == name {
+		t.Errorf("different paths have the same service name %q", got)
+	}
+	if !strings.HasPrefix(name, "rvcs-snapshot-") {
+		t.Errorf("unexpected service name %q", name)
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	path := `/example/100% "notes"`
+	args := []string{"/usr/bin/rvcs", "--store=/example/archive", "snapshot", "-quiet", "-io-nice", "-newest-first", path}
+	service, timer := systemdUnits(path, args, 45*time.Minute)
+	wantService := `[Unit]
+Description=rvcs snapshots of /example/100%% "notes"
+
+[Service]
+Type=oneshot
+ExecStart="/usr/bin/rvcs" "--store=/example/archive" "snapshot" "-quiet" "-io-nice" "-newest-first" "/example/100%% \"notes\""
+Nice=10
+`
+	if service != wantService {
+		t.Errorf("unexpected service unit: got:\n%s\nwant:\n%s", service, wantService)
+	}
+	wantTimer := `[Unit]
+Description=Periodic rvcs snapshots of /example/100%% "notes"
+
+[Timer]
+OnBootSec=2700s
+OnUnitActiveSec=2700s
+
+[Install]
+WantedBy=timers.target
+`
+	if timer != wantTimer {
+		t.Errorf("unexpected timer unit: got:\n%s\nwant:\n%s", timer, wantTimer)
+	}
+	if got, want := systemdQuote("$HOME\\notes\n"), `"$$HOME\\notes\n"`; got != want {
+		t.Errorf("unexpected quoting: got %s, want %s", got, want)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	args := []string{"/usr/bin/rvcs", "--store=/example/archive", "snapshot", "-quiet", "-io-nice", "-newest-first", "/example/<notes> & more"}
+	plist, err := launchdPlist(launchdLabel("rvcs-snapshot-example"), args, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("failure generating the plist: %v", err)
+	}
+	var parsed struct {
+		Dict struct {
+			Keys    []string `xml:"key"`
+			Strings []string `xml:"string"`
+			Array   struct {
+				Strings []string `xml:"string"`
+			} `xml:"array"`
+			Integer int64 `xml:"integer"`
+		} `xml:"dict"`
+	}
+	if err := xml.Unmarshal([]byte(plist), &parsed); err != nil {
+		t.Fatalf("failure parsing the generated plist %q: %v", plist, err)
+	}
+	if got, want := strings.Join(parsed.Dict.Keys, ","), "Label,ProgramArguments,StartInterval,RunAtLoad,ProcessType,LowPriorityIO"; got != want {
+		t.Errorf("unexpected plist keys: got %q, want %q", got, want)
+	}
+	if got, want := strings.Join(parsed.Dict.Strings, ","), "com.github.google.rvcs.rvcs-snapshot-example,Background"; got != want {
+		t.Errorf("unexpected plist strings: got %q, want %q", got, want)
+	}
+	if got, want := strings.Join(parsed.Dict.Array.Strings, "\n"), strings.Join(args, "\n"); got != want {
+		t.Errorf("unexpected program arguments: got %q, want %q", parsed.Dict.Array.Strings, args)
+	}
+	if got, want := parsed.Dict.Integer, int64(7200); got != want {
+		t.Errorf("unexpected start interval: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const showUsage = `Usage: %s show [<FLAGS>]* <SOURCE>
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+The format version, mode, contents, parents, and metadata of the snapshot
+are shown. If the snapshot is of a directory, then its immediate children
+are listed along with the detected content type of each.
+
+Files that were being written while they were snapshotted are marked as
+possibly inconsistent, since their contents may have been captured part
+way through an update.
+
+` + remoteSourceUsage + `
+<FLAGS> are one of:
+
+`
+
+var (
+	showFlags = flag.NewFlagSet("show", flag.ContinueOnError)
+
+	showRemoteFlag = showFlags.String(
+		"remote", "",
+		"name of the remote to read the snapshot from")
+)
+
+var showSubcommand = &subcommand{
+	summary: "show the details of a snapshot",
+	usage:   showUsage,
+	flags:   showFlags,
+	examples: []string{
+		"show ~/notes",
+		"show sha256:<HASH>",
+		"show -remote=origin sha256:<HASH>",
+	},
+	run: showCommand,
+}
+
+func showCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := showFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = showFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	r, h, done, err := openSource(ctx, s, *showRemoteFlag, args[0])
+	if err != nil {
+		return 1, err
+	}
+	defer done()
+	return showSnapshot(ctx, r, h)
+}
+
+// showSnapshot prints the details of the snapshot `h`, which is read using `r`.
+func showSnapshot(ctx context.Context, r snapshotReader, h *snapshot.Hash) (int, error) {
+	f, err := r.ReadSnapshot(ctx, h)
+	if err != nil {
+		return 1, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	fmt.Printf("snapshot %s\n", h)
+	if f.Version > snapshot.LegacyFormat {
+		fmt.Printf("  format: %d\n", f.Version)
+	}
+	fmt.Printf("  mode: %s\n", f.Mode)
+	fmt.Printf("  contents: %s\n", f.Contents)
+	for _, parent := range f.Parents {
+		fmt.Printf("  parent: %s\n", parent)
+	}
+	var keys []string
+	for key := range f.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %s: %s\n", key, f.Metadata[key])
+	}
+	if reason, ok := f.PossiblyInconsistent(); ok {
+		fmt.Printf("  warning: the contents are possibly inconsistent, as the file was %s\n", reason)
+	}
+	if !f.IsDir() {
+		return 0, nil
+	}
+	tree, err := r.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return 1, fmt.Errorf("failure listing the contents of the directory snapshot %q: %w", h, err)
+	}
+	var children []string
+	for child := range tree {
+		children = append(children, string(child))
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		childHash := tree[snapshot.Path(child)]
+		childFile, err := r.ReadSnapshot(ctx, childHash)
+		if err != nil {
+			return 1, fmt.Errorf("failure reading the snapshot %q of the child %q: %w", childHash, child, err)
+		}
+		contentType, ok := childFile.ContentType()
+		switch {
+		case childFile.IsDir():
+			contentType = "directory"
+		case childFile.IsLink():
+			contentType = "link"
+		case !ok:
+			contentType = "unknown"
+		}
+		name := snapshot.Path(child).Display()
+		if _, ok := childFile.PossiblyInconsistent(); ok {
+			name += "\t(possibly inconsistent)"
+		}
+		fmt.Printf("%s\t%s\t%s\n", childHash, contentType, name)
+	}
+	return 0, nil
+}
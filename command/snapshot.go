@@ -19,17 +19,43 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/index"
+	"github.com/google/recursive-version-control-system/resources"
+	"github.com/google/recursive-version-control-system/scan"
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/timestamp"
 )
 
-const snapshotUsage = `Usage: %s snapshot [<FLAGS>]* <PATH>
+const snapshotUsage = `Usage: %[1]s snapshot [<FLAGS>]* <PATH>
 
-Where <PATH> is a local filesystem path, and <FLAGS> are one of:
+Or: %[1]s snapshot -group=<NAME> [<FLAGS>]* <PATH>+
+
+Where <PATH> is a local filesystem path.
+
+The contents of each file read while snapshotting are passed to the
+scanners configured in the "scanners" file of the archive config, such as
+virus or secret scanners. That file has one scanner per line, with its
+name, the file name pattern it applies to, and its command separated by
+tabs. Each finding is printed, and a report of them is attached to the
+generated snapshot as a note, which can be shown with "notes show".
+
+With -stdin-list, only the paths read from standard input are
+snapshotted again, instead of walking all of <PATH>, such as the files
+that a build system or "find" reports as changed. Each directory holding
+a listed path keeps the entries of its previous snapshot that are not
+listed, so new and deleted files must be listed to be added or removed.
+Relative paths in the list are relative to the current directory.
+
+<FLAGS> are one of:
 
 `
 
@@ -39,13 +65,241 @@ var (
 	snapshotAdditionalParentsFlag = snapshotFlags.String(
 		"additional-parents", "",
 		"comma separated list of additional parents for the generated snapshot")
+	snapshotJobsFlag = snapshotFlags.Int(
+		"jobs", 0,
+		"maximum number of files to snapshot concurrently; 0 means the number of workers shown by \"resources\"")
+	snapshotMaxDepthFlag = snapshotFlags.Int(
+		"max-depth", 0,
+		"maximum number of directories to descend into below <PATH>; 0 means no limit")
+	snapshotMaxFilesFlag = snapshotFlags.Int64(
+		"max-files", 0,
+		"maximum number of files to snapshot; 0 means no limit")
+	snapshotMaxTotalSizeFlag = snapshotFlags.Int64(
+		"max-total-size", 0,
+		"maximum total size in bytes of the files to snapshot; 0 means no limit")
+	snapshotIONiceFlag = snapshotFlags.Bool(
+		"io-nice", false,
+		"reduce the impact of snapshotting on other programs. On Linux this uses the idle I/O scheduling class; "+
+			"elsewhere it limits reads to -max-read-rate, or 16 MiB per second if that is not set")
+	snapshotMaxReadRateFlag = snapshotFlags.Int64(
+		"max-read-rate", 0,
+		"maximum rate, in bytes per second, at which to read file contents; 0 means no limit")
+	snapshotQuietFlag = snapshotFlags.Bool(
+		"quiet", false,
+		"do not print a summary of what changed since the previous snapshot")
+	snapshotTombstonesFlag = snapshotFlags.Bool(
+		"tombstones", false,
+		"record the files deleted since the previous snapshot, so that they can be listed with \"log -deleted\"")
+	snapshotContentTypesFlag = snapshotFlags.Bool(
+		"content-types", true,
+		"record the detected MIME type of each file's contents in its snapshot")
+	snapshotDetectOpenFilesFlag = snapshotFlags.Bool(
+		"detect-open-files", true,
+		"mark files that other processes have open for writing as possibly inconsistent. This is only supported on Linux")
+	snapshotVerifyFlag = snapshotFlags.Bool(
+		"verify", false,
+		"after snapshotting, check whether any files changed since they were read, and if so snapshot again to re-read them")
+	snapshotDryRunFlag = snapshotFlags.Bool(
+		"dry-run", false,
+		"do not snapshot anything, but instead report how many files would be snapshotted and how much of their data has changed")
+	snapshotProgressFlag = snapshotFlags.Bool(
+		"progress", false,
+		"scan <PATH> before snapshotting it, and then report the percentage completed and estimated time remaining")
+	snapshotNewestFirstFlag = snapshotFlags.Bool(
+		"newest-first", false,
+		"snapshot the most recently modified files first, so that they are the most likely to have been captured if snapshotting is interrupted")
+	snapshotDirectoryTimesFlag = snapshotFlags.Bool(
+		"directory-times", false,
+		"record the modification time of each directory so that it is restored when the snapshot is checked out. "+
+			"The setting is remembered for later snapshots in the same archive")
+	snapshotXattrsFlag = snapshotFlags.String(
+		"xattrs", "",
+		"comma separated list of patterns, such as \"com.apple.*\", for the names of the extended attributes to record for each file\n"+
+			"and directory, so that they are restored when the snapshot is checked out. On macOS this includes Finder information,\n"+
+			"tags, and resource forks. This requires the archive to have been upgraded with \"upgrade\".\n"+
+			"The setting is remembered for later snapshots in the same archive; set it to an empty list to stop recording them")
+	snapshotTSAFlag = snapshotFlags.String(
+		"tsa", "",
+		"URL of an RFC 3161 timestamping authority used to timestamp the generated snapshot, as with \"timestamp add\"")
+	snapshotTSACAFlag = snapshotFlags.String(
+		"tsa-ca", "",
+		"PEM file of root certificates trusted to sign timestamps requested with -tsa; if not set, then the system's trusted roots are used")
+	snapshotGroupFlag = snapshotFlags.String(
+		"group", "",
+		"snapshot every <PATH> and then record their snapshots together as the named group, so that they can be restored\n"+
+			"to a mutually consistent point with \"restore -group\". The group is only recorded if every path is snapshotted")
+	snapshotExcludeOtherUsersFlag = snapshotFlags.Bool(
+		"exclude-other-users", false,
+		"skip files that are not owned by the current user, such as when snapshotting a shared directory. Directories are never skipped")
+	snapshotExcludeOlderThanFlag = snapshotFlags.Duration(
+		"exclude-older-than", 0,
+		"skip files last modified longer ago than this, such as \"720h\"; 0 means no limit. Directories are never skipped")
+	snapshotExcludeNewerThanFlag = snapshotFlags.Duration(
+		"exclude-newer-than", 0,
+		"skip files last modified more recently than this, such as \"1h\"; 0 means no limit. Directories are never skipped")
+	snapshotFailOnFindingsFlag = snapshotFlags.Bool(
+		"fail-on-findings", false,
+		"exit with a failure if any of the configured scanners reported findings, such as for a policy check in CI. "+
+			"The snapshot is still recorded, with the findings attached to it")
+	snapshotVerifyRetriesFlag = snapshotFlags.Int(
+		"verify-retries", 3,
+		"maximum number of times to snapshot again with -verify before giving up on files that keep changing")
+	snapshotStdinListFlag = snapshotFlags.Bool(
+		"stdin-list", false,
+		"only snapshot the paths under <PATH> listed on standard input, one per line, instead of walking all of <PATH>.\n"+
+			"This cannot be combined with -group, -dry-run, -progress, or -verify")
+	snapshotNullFlag = snapshotFlags.Bool(
+		"null", false,
+		"with -stdin-list, the listed paths are separated by NUL bytes, as printed by \"find -print0\", instead of by newlines")
 )
 
-func snapshotCommand(ctx context.Context, s *storage.LocalFiles, cmd string, args []string) (int, error) {
-	snapshotFlags.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), snapshotUsage, cmd)
-		snapshotFlags.PrintDefaults()
+// readPathList reads the paths listed for -stdin-list from `r`, separated by `sep`.
+//
+// Relative paths are resolved against the current directory.
+func readPathList(r io.Reader, sep string) ([]snapshot.Path, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the list of paths: %w", err)
+	}
+	// The result is never nil, even if nothing was listed, so that an empty list does not walk all of <PATH>.
+	paths := []snapshot.Path{}
+	for _, listed := range strings.Split(string(bs), sep) {
+		if len(listed) == 0 {
+			continue
+		}
+		abs, err := filepath.Abs(listed)
+		if err != nil {
+			return nil, fmt.Errorf("failure resolving the absolute path of the listed path %q: %w", listed, err)
+		}
+		paths = append(paths, snapshot.Path(abs))
+	}
+	return paths, nil
+}
+
+// exclusionOptions returns the snapshot options for the files skipped based on their owner or age.
+//
+// These are decided from each file's information alone, so skipped files are never read.
+func exclusionOptions() []snapshot.Option {
+	var opts []snapshot.Option
+	if *snapshotExcludeOtherUsersFlag {
+		opts = append(opts, snapshot.WithExcluder(snapshot.ExcludeOtherOwners(os.Getuid())))
+	}
+	now := time.Now()
+	if *snapshotExcludeOlderThanFlag > 0 {
+		opts = append(opts, snapshot.WithExcluder(snapshot.ExcludeModifiedBefore(now.Add(-*snapshotExcludeOlderThanFlag))))
+	}
+	if *snapshotExcludeNewerThanFlag > 0 {
+		opts = append(opts, snapshot.WithExcluder(snapshot.ExcludeModifiedAfter(now.Add(-*snapshotExcludeNewerThanFlag))))
+	}
+	return opts
+}
+
+// directoryTimesConfig is the name of the archive config file that marks directory modification times as recorded.
+const directoryTimesConfig = "directory-times"
+
+// directoryTimesOption returns the snapshot option for recording directory modification times.
+//
+// If the -directory-times flag was set explicitly, then its value is
+// saved in the archive config; otherwise the saved value is used.
+func directoryTimesOption(ctx context.Context, s *storage.LocalFiles) (snapshot.Option, error) {
+	explicit := false
+	snapshotFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "directory-times" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		_, err := os.Stat(s.ConfigFile(directoryTimesConfig))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failure reading the directory times config: %w", err)
+		}
+		return snapshot.WithDirectoryTimes(err == nil), nil
+	}
+	if *snapshotDirectoryTimesFlag {
+		if err := s.WriteConfigFile(ctx, directoryTimesConfig, []byte("Directory modification times are recorded in snapshots\n")); err != nil {
+			return nil, fmt.Errorf("failure writing the directory times config: %w", err)
+		}
+	} else if err := os.Remove(s.ConfigFile(directoryTimesConfig)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failure removing the directory times config: %w", err)
+	}
+	return snapshot.WithDirectoryTimes(*snapshotDirectoryTimesFlag), nil
+}
+
+// xattrsConfig is the name of the archive config file listing the patterns for the extended attributes recorded in snapshots.
+const xattrsConfig = "xattrs"
+
+// xattrsOption returns the snapshot option for recording extended attributes.
+//
+// If the -xattrs flag was set explicitly, then its value is saved in
+// the archive config; otherwise the saved value is used.
+func xattrsOption(ctx context.Context, s *storage.LocalFiles) (snapshot.Option, error) {
+	explicit := false
+	snapshotFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "xattrs" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		bs, err := os.ReadFile(s.ConfigFile(xattrsConfig))
+		if os.IsNotExist(err) {
+			return snapshot.WithXattrs(), nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failure reading the extended attributes config: %w", err)
+		}
+		return snapshot.WithXattrs(strings.Fields(string(bs))...), nil
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(*snapshotXattrsFlag, ",") {
+		if pattern = strings.TrimSpace(pattern); len(pattern) == 0 {
+			continue
+		}
+		if err := snapshot.ValidateXattrPattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		if err := os.Remove(s.ConfigFile(xattrsConfig)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failure removing the extended attributes config: %w", err)
+		}
+		return snapshot.WithXattrs(), nil
 	}
+	v, err := archiveFormatVersion(s)
+	if err != nil {
+		return nil, err
+	} else if v < snapshot.VersionedFormat {
+		return nil, fmt.Errorf("recording extended attributes requires the snapshot format version %d; use \"upgrade\" to upgrade the archive first", snapshot.VersionedFormat)
+	}
+	if err := s.WriteConfigFile(ctx, xattrsConfig, []byte(strings.Join(patterns, "\n")+"\n")); err != nil {
+		return nil, fmt.Errorf("failure writing the extended attributes config: %w", err)
+	}
+	return snapshot.WithXattrs(patterns...), nil
+}
+
+// defaultNiceReadRate is the read rate limit used for -io-nice on platforms without I/O scheduling classes.
+const defaultNiceReadRate = 16 * 1024 * 1024
+
+var snapshotSubcommand = &subcommand{
+	summary: "snapshot a local path",
+	usage:   snapshotUsage,
+	flags:   snapshotFlags,
+	examples: []string{
+		"snapshot ~/notes",
+		"snapshot -jobs=4 -quiet ~/photos",
+		"snapshot -verify ~",
+		"snapshot -dry-run ~/photos",
+		"snapshot -progress ~",
+		"snapshot -directory-times ~/backups",
+		"snapshot -xattrs='com.apple.*' ~/Documents",
+		"snapshot -group=app ~/app ~/backups/app-db.sql",
+		"snapshot -fail-on-findings ~/src/app",
+		"snapshot -stdin-list ~/src < changed-files.txt",
+		"snapshot -stdin-list -null ~/src < <(find ~/src -newer ~/.last-build -print0)",
+	},
+	run: snapshotCommand,
+}
+
+func snapshotCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
 	if err := snapshotFlags.Parse(args); err != nil {
 		return 1, nil
 	}
@@ -55,44 +309,255 @@ func snapshotCommand(ctx context.Context, s *storage.LocalFiles, cmd string, arg
 	for _, parent := range strings.Split(*snapshotAdditionalParentsFlag, ",") {
 		parentHash, err := resolveSnapshot(ctx, s, parent)
 		if err != nil {
-			return 1, fmt.Errorf("failure resolving the additional parent %q: %v", parent, err)
+			return 1, fmt.Errorf("failure resolving the additional parent %q: %w", parent, err)
 		}
 		if parentHash != nil {
 			additionalParents = append(additionalParents, parentHash)
 		}
 	}
 
-	var path string
+	var paths []string
 	if len(args) > 0 {
-		path = args[0]
+		paths = args
 	} else {
 		wd, err := os.Getwd()
 		if err != nil {
-			return 1, fmt.Errorf("failure determining the current working directory: %v\n", err)
+			return 1, fmt.Errorf("failure determining the current working directory: %w\n", err)
 		}
-		path = wd
+		paths = []string{wd}
 	}
-	abs, err := filepath.Abs(path)
+	if len(paths) > 1 && len(*snapshotGroupFlag) == 0 {
+		return -1, nil
+	}
+	if len(*snapshotGroupFlag) > 0 && !storage.ValidTrackID(*snapshotGroupFlag) {
+		return 1, fmt.Errorf("invalid group name %q", *snapshotGroupFlag)
+	}
+	var listed []snapshot.Path
+	if *snapshotStdinListFlag {
+		if len(*snapshotGroupFlag) > 0 || *snapshotDryRunFlag || *snapshotProgressFlag || *snapshotVerifyFlag {
+			return 1, fmt.Errorf("the -stdin-list flag cannot be combined with -group, -dry-run, -progress, or -verify")
+		}
+		sep := "\n"
+		if *snapshotNullFlag {
+			sep = "\x00"
+		}
+		var err error
+		if listed, err = readPathList(os.Stdin, sep); err != nil {
+			return 1, err
+		}
+	}
+	members := make(snapshot.Tree)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", path, err)
+		}
+		if *snapshotDryRunFlag {
+			if ret, err := snapshotDryRun(ctx, s, snapshot.Path(abs)); ret != 0 || err != nil {
+				return ret, err
+			}
+			continue
+		}
+		h, ret, err := snapshotPath(ctx, s, abs, additionalParents, listed)
+		if healthErr := recordSnapshotHealth(ctx, s, snapshot.Path(abs), ret, err); healthErr != nil {
+			// The snapshot itself is unaffected, so it is not failed over its health record.
+			fmt.Printf("Warning: failure recording the health of %q: %v\n", abs, healthErr)
+		}
+		if ret != 0 || err != nil {
+			return ret, err
+		}
+		members[snapshot.Path(abs)] = h
+	}
+	if len(*snapshotGroupFlag) == 0 || *snapshotDryRunFlag {
+		return 0, nil
+	}
+	g, err := s.StoreGroup(ctx, *snapshotGroupFlag, members)
 	if err != nil {
-		return 1, fmt.Errorf("failure resolving the absolute path of %q: %v", path, err)
+		return 1, err
 	}
-	path = abs
+	fmt.Printf("Recorded the group %q as %q\n", *snapshotGroupFlag, g)
+	return 0, nil
+}
 
-	h, f, err := snapshot.Current(ctx, s, snapshot.Path(path))
+// snapshotPath snapshots the absolute path `path`, and returns the hash of the generated snapshot.
+//
+// If `listed` is not nil, then only those paths under `path` are
+// snapshotted again; see `snapshot.Snapshotter.SnapshotPaths`.
+//
+// The returned exit code is non-zero if no snapshot was generated.
+func snapshotPath(ctx context.Context, s *storage.LocalFiles, path string, additionalParents []*snapshot.Hash, listed []snapshot.Path) (*snapshot.Hash, int, error) {
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return nil, 1, fmt.Errorf("failure loading the configured content filters: %w", err)
+	}
+	scanOpt, err := scan.SnapshotOption(s)
+	if err != nil {
+		return nil, 1, fmt.Errorf("failure loading the configured scanners: %w", err)
+	}
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return nil, 1, err
+	}
+	dirTimesOpt, err := directoryTimesOption(ctx, s)
+	if err != nil {
+		return nil, 1, err
+	}
+	xattrsOpt, err := xattrsOption(ctx, s)
+	if err != nil {
+		return nil, 1, err
+	}
+	limits := snapshot.Limits{
+		MaxDepth:     *snapshotMaxDepthFlag,
+		MaxFiles:     *snapshotMaxFilesFlag,
+		MaxTotalSize: *snapshotMaxTotalSizeFlag,
+	}
+	readRate := *snapshotMaxReadRateFlag
+	if *snapshotIONiceFlag {
+		supported, err := lowerIOPriority()
+		if err != nil {
+			return nil, 1, fmt.Errorf("failure lowering the I/O priority: %w", err)
+		}
+		if !supported && readRate <= 0 {
+			readRate = defaultNiceReadRate
+		}
+	}
+	budget, err := resources.Load(s)
 	if err != nil {
-		return 1, fmt.Errorf("failure snapshotting the directory %q: %v\n", path, err)
+		return nil, 1, err
+	}
+	opts := append(provenanceOptions(s), snapshot.WithConcurrency(jobs(budget, *snapshotJobsFlag)), snapshot.WithLimits(limits), snapshot.WithReadRateLimit(readRate), snapshot.WithContentTypes(*snapshotContentTypesFlag), snapshot.WithTombstones(*snapshotTombstonesFlag), snapshot.WithOpenFileDetection(*snapshotDetectOpenFilesFlag), snapshot.WithNewestFirst(*snapshotNewestFirstFlag), formatOpt, dirTimesOpt, xattrsOpt, filterOpt, scanOpt)
+	opts = append(opts, resourceOptions(budget)...)
+	opts = append(opts, exclusionOptions()...)
+	prev, _, err := s.FindSnapshot(ctx, snapshot.Path(path))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 1, fmt.Errorf("failure looking up the previous snapshot of %q: %w", path, err)
+	}
+	if *snapshotVerifyFlag && *snapshotVerifyRetriesFlag > 0 {
+		opts = append(opts, snapshot.WithVerification(*snapshotVerifyRetriesFlag))
+	}
+	var progress *snapshotProgress
+	if *snapshotProgressFlag {
+		progress = newSnapshotProgress(&snapshot.Estimate{})
+		opts = append(opts, snapshot.WithProgress(progress.update))
+	}
+	snapshotter := snapshot.NewSnapshotter(s, opts...)
+	if progress != nil {
+		estimate, err := snapshotter.Prescan(ctx, snapshot.Path(path))
+		if err != nil {
+			return nil, 1, fmt.Errorf("failure scanning %q: %w", path, err)
+		}
+		progress.estimate = estimate
+		progress.start = time.Now()
+	}
+	start := time.Now()
+	var h *snapshot.Hash
+	var f *snapshot.File
+	if listed != nil {
+		h, f, err = snapshotter.SnapshotPaths(ctx, snapshot.Path(path), listed)
+	} else {
+		h, f, err = snapshotter.Snapshot(ctx, snapshot.Path(path))
+	}
+	if progress != nil {
+		progress.done()
+	}
+	if metricsErr := recordSnapshotMetrics(ctx, s, snapshotter, start, err == nil && h != nil); metricsErr != nil {
+		// The snapshot itself is unaffected, so it is not failed over its metrics.
+		fmt.Printf("Warning: %v\n", metricsErr)
+	}
+	if err != nil {
+		return nil, 1, fmt.Errorf("failure snapshotting the directory %q: %w\n", path, err)
 	} else if h == nil || f == nil {
 		fmt.Printf("Did not generate a snapshot as %q does not exist\n", path)
-		return 1, nil
+		return nil, 1, nil
 	}
 	if len(additionalParents) > 0 {
 		f.Parents = append(f.Parents, additionalParents...)
 		h, err = s.StoreSnapshot(ctx, snapshot.Path(path), f)
 		if err != nil {
-			return 1, fmt.Errorf("failure updating the snapshot of %q to include the additional parents %v: %v", path, additionalParents, err)
+			return nil, 1, fmt.Errorf("failure updating the snapshot of %q to include the additional parents %v: %w", path, additionalParents, err)
 		}
 	}
 
+	if err := index.Record(ctx, s, snapshot.Path(path), h, f, s.StoredBytes()); err != nil {
+		return nil, 1, err
+	}
+	if err := recordMapping(ctx, s, "snapshot", snapshot.Path(path), prev, h); err != nil {
+		return nil, 1, err
+	}
 	fmt.Printf("Snapshotted %q to %q\n", path, h)
+	if len(*snapshotTSAFlag) > 0 {
+		roots, err := timestampRoots(*snapshotTSACAFlag)
+		if err != nil {
+			return nil, 1, err
+		}
+		a, err := timestamp.Add(ctx, s, *snapshotTSAFlag, h, roots)
+		if err != nil {
+			return nil, 1, fmt.Errorf("failure timestamping the snapshot %q: %w", h, err)
+		}
+		fmt.Printf("Timestamped %q at %s by %q\n", h, a.Time.Format(time.RFC3339), a.Authority)
+	}
+	if unstable := snapshotter.Unstable(); len(unstable) > 0 {
+		fmt.Printf("Warning: %d files were still changing after %d retries, and may not match their snapshots:\n", len(unstable), *snapshotVerifyRetriesFlag)
+		for _, p := range unstable {
+			fmt.Printf("    %s\n", displayPath(p))
+		}
+	}
+	if findings := snapshotter.Findings(); len(findings) > 0 {
+		report, err := scan.Attach(ctx, s, h, findings)
+		if err != nil {
+			return nil, 1, err
+		}
+		fmt.Printf("Warning: the scanners reported %d findings, attached to %q as the note %q:\n", len(findings), h, report)
+		for _, f := range findings {
+			fmt.Printf("    %s\n", f)
+		}
+		if *snapshotFailOnFindingsFlag {
+			return nil, 1, fmt.Errorf("the scanners reported %d findings in %q", len(findings), path)
+		}
+	}
+	if *snapshotQuietFlag {
+		return h, 0, nil
+	}
+	summary, err := summarizeSnapshot(ctx, s, prev, h)
+	if err != nil {
+		return nil, 1, fmt.Errorf("failure summarizing the changes to %q: %w", path, err)
+	}
+	fmt.Println(summary)
+	return h, 0, nil
+}
+
+// snapshotDryRun reports what a snapshot of `p` is expected to read and store, without snapshotting it.
+func snapshotDryRun(ctx context.Context, s *storage.LocalFiles, p snapshot.Path) (int, error) {
+	limits := snapshot.Limits{
+		MaxDepth:     *snapshotMaxDepthFlag,
+		MaxFiles:     *snapshotMaxFilesFlag,
+		MaxTotalSize: *snapshotMaxTotalSizeFlag,
+	}
+	sn := snapshot.NewSnapshotter(s, append(exclusionOptions(), snapshot.WithLimits(limits))...)
+	estimate, err := sn.Prescan(ctx, p)
+	if err != nil {
+		return 1, fmt.Errorf("failure scanning %q: %w", p, err)
+	}
+	if estimate.Paths == 0 {
+		fmt.Printf("Would not generate a snapshot as %q does not exist\n", p)
+		return 1, nil
+	}
+	fmt.Printf("Would snapshot %d files totalling %d bytes in %q\n", estimate.Files, estimate.Bytes, p)
+	fmt.Printf("%d of those files, totalling %d bytes, changed since they were last snapshotted; this is the most new data that would be stored\n", estimate.ChangedFiles, estimate.ChangedBytes)
 	return 0, nil
 }
+
+// summarizeSnapshot describes the changes from the snapshot `prev` to the snapshot `h`.
+//
+// The previous snapshot may be nil, in which case every file is reported as added.
+func summarizeSnapshot(ctx context.Context, s *storage.LocalFiles, prev, h *snapshot.Hash) (string, error) {
+	changes, err := diff.Compare(ctx, s, prev, h)
+	if err != nil {
+		return "", err
+	}
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Kind()]++
+	}
+	return fmt.Sprintf("%d added, %d modified, %d deleted, %d bytes of new data stored", counts["A"], counts["M"], counts["D"], s.StoredBytes()), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/squash"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const squashUsage = `Usage: %s squash [<FLAGS>]* <PATH> [<FLAGS>]*
+
+Where <PATH> is a local filesystem path that has previously been snapshotted.
+
+The snapshots of <PATH> after the -from snapshot, up to and including the
+-to snapshot, are replaced with a single snapshot whose contents are the
+same as the -to snapshot. Later snapshots of <PATH> are rewritten to
+build on the squashed snapshot, so the latest contents do not change.
+
+This shortens the history of frequently snapshotted paths, e.g. before
+pushing them to a remote. The snapshots of any directories containing
+<PATH> still reference the original history.
+
+The values of -from and -to are each one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	squashFlags = flag.NewFlagSet("squash", flag.ContinueOnError)
+
+	squashFromFlag = squashFlags.String(
+		"from", "",
+		"snapshot to keep as the parent of the squashed snapshot. If not set, then the entire history up to -to is squashed")
+	squashToFlag = squashFlags.String(
+		"to", "",
+		"last snapshot to squash. If not set, then this defaults to the latest snapshot of <PATH>")
+)
+
+var squashSubcommand = &subcommand{
+	summary: "replace a run of snapshots with a single snapshot",
+	usage:   squashUsage,
+	flags:   squashFlags,
+	examples: []string{
+		"squash -from=sha256:<HASH> ~/notes",
+		"squash ~/notes -from sha256:<HASH> -to sha256:<HASH>",
+	},
+	run: squashCommand,
+}
+
+func squashCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := squashFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = squashFlags.Args()
+	if len(args) < 1 {
+		return -1, nil
+	}
+	path := args[0]
+	// Allow flags to also follow the path.
+	if err := squashFlags.Parse(args[1:]); err != nil {
+		return 1, nil
+	}
+	if len(squashFlags.Args()) > 0 {
+		return -1, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", path, err)
+	}
+	from, err := resolveSnapshot(ctx, s, *squashFromFlag)
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", *squashFromFlag, err)
+	}
+	to, err := resolveSnapshot(ctx, s, *squashToFlag)
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", *squashToFlag, err)
+	}
+	prev, err := latestSnapshot(ctx, s, snapshot.Path(abs))
+	if err != nil {
+		return 1, err
+	}
+	h, err := squash.Squash(ctx, s, snapshot.Path(abs), from, to)
+	if err != nil {
+		return 1, fmt.Errorf("failure squashing the history of %q: %w", abs, err)
+	}
+	// Record the change so that the pre-squash history can still be found with the "reflog" subcommand.
+	if err := recordMapping(ctx, s, "squash", snapshot.Path(abs), prev, h); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Squashed the history of %q; its latest snapshot is now %q\n", abs, h)
+	return 0, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const statusUsage = `Usage: %s status [<FLAGS>]* <PATH>+ [<FLAGS>]*
+
+Where each <PATH> is a local file path which has previously been
+snapshotted, and <SNAPSHOT> is the hash of a known snapshot.
+
+Lists the files that changed on disk since the latest snapshot of each
+path, without snapshotting them. Each changed file is listed as it is
+by "diff", with a leading "A" if it was added, "D" if it was deleted,
+and "M" if it was modified.
+
+With -base, the files are instead compared to the given snapshot, which
+may be any snapshot, such as an older one found with "log". This shows
+everything that changed since then, whether or not it has been
+snapshotted. Only one <PATH> may be given with -base.
+
+The paths are hashed the same way that they would be snapshotted, so
+files that have not changed since they were last snapshotted are not
+read again, and nothing is stored in the archive.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	statusFlags = flag.NewFlagSet("status", flag.ContinueOnError)
+
+	statusBaseFlag = statusFlags.String(
+		"base", "",
+		"snapshot to compare the path to, instead of its latest snapshot")
+)
+
+var statusSubcommand = &subcommand{
+	summary: "list the files changed on disk since a snapshot",
+	usage:   statusUsage,
+	flags:   statusFlags,
+	examples: []string{
+		"status ~/notes",
+		"status -base=sha256:1a2b3c ~/notes",
+		"status ~/notes -base sha256:1a2b3c",
+	},
+	run: statusCommand,
+}
+
+// workingTreeOptions returns the snapshot options for hashing local paths the way that "snapshot" would.
+func workingTreeOptions(ctx context.Context, s *storage.LocalFiles) ([]snapshot.Option, error) {
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return nil, err
+	}
+	formatOpt, err := formatOption(s)
+	if err != nil {
+		return nil, err
+	}
+	dirTimesOpt, err := directoryTimesOption(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	xattrsOpt, err := xattrsOption(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return []snapshot.Option{filterOpt, formatOpt, dirTimesOpt, xattrsOpt}, nil
+}
+
+func statusCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	var paths []string
+	for {
+		// Allow flags to also follow (or be interleaved with) the paths.
+		if err := statusFlags.Parse(args); err != nil {
+			return 1, nil
+		}
+		args = statusFlags.Args()
+		if len(args) == 0 {
+			break
+		}
+		paths = append(paths, args[0])
+		args = args[1:]
+	}
+	args = paths
+	if len(args) < 1 || (len(*statusBaseFlag) > 0 && len(args) != 1) {
+		return -1, nil
+	}
+	var base *snapshot.Hash
+	if len(*statusBaseFlag) > 0 {
+		h, err := resolveSnapshot(ctx, s, *statusBaseFlag)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", *statusBaseFlag, err)
+		}
+		base = h
+	}
+	opts, err := workingTreeOptions(ctx, s)
+	if err != nil {
+		return 1, err
+	}
+	for _, arg := range args {
+		abs, err := filepath.Abs(arg)
+		if err != nil {
+			return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", arg, err)
+		}
+		p := snapshot.Path(abs)
+		var changes []*diff.Change
+		if base == nil {
+			changes, err = diff.CompareWorking(ctx, s, p, opts...)
+		} else {
+			changes, err = diff.CompareWorkingTo(ctx, s, base, p, opts...)
+		}
+		if err != nil {
+			return 1, fmt.Errorf("failure comparing %q: %w", p, err)
+		}
+		for _, c := range changes {
+			fmt.Printf("%s %s\n", c.Kind(), displayPath(snapshot.Path(filepath.Join(string(p), c.Path))))
+		}
+	}
+	return 0, nil
+}
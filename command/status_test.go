@@ -0,0 +1,90 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// captureStdout returns everything that `fn` writes to standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failure creating a pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestStatusFlagsAfterPath(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	t.Cleanup(func() { statusFlags.Set("base", "") })
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(workDir, 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	base, _, err := snapshot.Current(ctx, s, snapshot.Path(workDir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the working directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "b.txt"), []byte("b"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(workDir)); err != nil {
+		t.Fatalf("failure snapshotting the working directory: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--base", base.String(), workDir},
+		{workDir, "--base", base.String()},
+	} {
+		var code int
+		var err error
+		out := captureStdout(t, func() {
+			code, err = statusCommand(ctx, s, args)
+		})
+		if err != nil || code != 0 {
+			t.Fatalf("status %q failed with exit code %d: %v", args, code, err)
+		}
+		if want := "A " + displayPath(snapshot.Path(filepath.Join(workDir, "b.txt"))); strings.TrimSpace(out) != want {
+			t.Errorf("unexpected output from status %q: got %q, want %q", args, out, want)
+		}
+		statusFlags.Set("base", "")
+	}
+}
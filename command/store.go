@@ -0,0 +1,163 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/stores"
+)
+
+const storeUsage = `Usage: %[1]s store <ACTION>
+
+Where <ACTION> is one of:
+
+	list
+	create <NAME> [<DIR>]
+	default [<NAME>]
+	share
+
+Stores are separate archives, such as one for work and another for
+personal data, or one on an external drive. Every user has a store named
+"default", held in ~/.rvcs/archive.
+
+The "list" action lists each store along with its directory, marking the
+store in use with a "*". The "create" action registers a new store, held
+in <DIR> or, if that is not given, under ~/.rvcs/archives. The "default"
+action shows the store used when no other store is selected, or changes
+it to the store named <NAME>.
+
+The "share" action marks the store in use as shared by the users in the
+group that owns its directory, such as for a store on a shared file
+system. Objects and snapshots in a shared store are kept accessible to
+the group, while each user's own state, such as the path info cache and
+the reflog, is kept under ~/.rvcs/shared instead of in the store. This
+must be run by the owner of the store, after which other users can add
+the store with the "create" action. Only the owner of a shared store can
+configure the filters, scanners, and remotes it runs commands for.
+
+Any subcommand can use a different store by passing the name or directory
+of the store in the global --store flag, as in "%[1]s --store=work log",
+or in the RVCS_STORE environment variable.
+`
+
+var storeSubcommand = &subcommand{
+	summary: "manage the stores that snapshots are kept in",
+	usage:   storeUsage,
+	examples: []string{
+		"store list",
+		"store create work",
+		"store create usb /media/usb/rvcs",
+		"store default work",
+		"--store=team store share",
+		"--store=usb snapshot ~/photos",
+	},
+	run: storeCommand,
+}
+
+func storeList(s *storage.LocalFiles, root string, args []string) (int, error) {
+	if len(args) != 0 {
+		return -1, nil
+	}
+	list, err := stores.List(root)
+	if err != nil {
+		return 1, err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, st := range list {
+		marker := " "
+		if st.Dir == s.ArchiveDir {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\n", marker, st.Name, st.Dir)
+	}
+	return 0, w.Flush()
+}
+
+func storeCreate(root string, args []string) (int, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return -1, nil
+	}
+	var dir string
+	if len(args) == 2 {
+		dir = args[1]
+	}
+	st, err := stores.Create(root, args[0], dir)
+	if err != nil {
+		return 1, err
+	}
+	fmt.Printf("Created the store %q in %q\n", st.Name, st.Dir)
+	return 0, nil
+}
+
+func storeDefault(root string, args []string) (int, error) {
+	if len(args) > 1 {
+		return -1, nil
+	}
+	if len(args) == 0 {
+		st, err := stores.Default(root)
+		if err != nil {
+			return 1, err
+		}
+		fmt.Printf("%s\t%s\n", st.Name, st.Dir)
+		return 0, nil
+	}
+	if err := stores.SetDefault(root, args[0]); err != nil {
+		return 1, err
+	}
+	fmt.Printf("The default store is now %q\n", args[0])
+	return 0, nil
+}
+
+func storeShare(ctx context.Context, s *storage.LocalFiles, root string, args []string) (int, error) {
+	if len(args) != 0 {
+		return -1, nil
+	}
+	if s.Shared() {
+		return 1, fmt.Errorf("the store in %q is already shared", s.ArchiveDir)
+	}
+	s.UserDir = stores.UserDir(root, s.ArchiveDir)
+	if err := s.SetShared(ctx); err != nil {
+		return 1, fmt.Errorf("failure sharing the store in %q: %w", s.ArchiveDir, err)
+	}
+	fmt.Printf("Shared the store in %q; your own state for it is now kept in %q\n", s.ArchiveDir, s.UserDir)
+	return 0, nil
+}
+
+func storeCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	root, err := stores.Root()
+	if err != nil {
+		return 1, err
+	}
+	switch args[0] {
+	case "list":
+		return storeList(s, root, args[1:])
+	case "create":
+		return storeCreate(root, args[1:])
+	case "default":
+		return storeDefault(root, args[1:])
+	case "share":
+		return storeShare(ctx, s, root, args[1:])
+	}
+	return -1, nil
+}
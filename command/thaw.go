@@ -0,0 +1,135 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/tier"
+)
+
+const thawUsage = `Usage: %[1]s thaw [<FLAGS>]* <SOURCE>
+
+Or: %[1]s thaw -all
+
+Where <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Brings back the contents of the files in <SOURCE> that were offloaded to
+a remote by "tier run", so that they can be read again. With -all, every
+offloaded object is brought back.
+
+Remotes backed by cold storage may take hours to retrieve an object. The
+first time such an object is thawed, its remote is asked to retrieve it,
+and it is listed as pending; run this again later to bring back the
+objects that have since been retrieved. Each object is listed with its
+state, hash, and the path of a file it is the contents of.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	thawFlags = flag.NewFlagSet("thaw", flag.ContinueOnError)
+
+	thawAllFlag = thawFlags.Bool(
+		"all", false,
+		"thaw every offloaded object rather than only those in <SOURCE>")
+)
+
+var thawSubcommand = &subcommand{
+	summary: "bring back file contents offloaded by \"tier\"",
+	usage:   thawUsage,
+	flags:   thawFlags,
+	examples: []string{
+		"thaw ~/photos/2019",
+		"thaw sha256:<HASH>",
+		"thaw -all",
+	},
+	run: thawCommand,
+}
+
+func thawCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := thawFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = thawFlags.Args()
+	var offloaded []*tier.Offloaded
+	if *thawAllFlag {
+		if len(args) != 0 {
+			return -1, nil
+		}
+		stubs, err := s.ListStubs(ctx)
+		if err != nil {
+			return 1, err
+		}
+		for _, stub := range stubs {
+			offloaded = append(offloaded, &tier.Offloaded{Stub: stub})
+		}
+	} else {
+		if len(args) != 1 {
+			return -1, nil
+		}
+		h, err := resolveSnapshot(ctx, s, args[0])
+		if err != nil {
+			return 1, err
+		}
+		var p snapshot.Path
+		if _, err := snapshot.ParseHash(args[0]); err != nil {
+			abs, err := filepath.Abs(args[0])
+			if err != nil {
+				return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[0], err)
+			}
+			p = snapshot.Path(abs)
+		}
+		if offloaded, err = tier.FindOffloaded(ctx, s, p, h); err != nil {
+			return 1, err
+		}
+	}
+	var stubs []*storage.Stub
+	for _, o := range offloaded {
+		stubs = append(stubs, o.Stub)
+	}
+	states, err := tier.Thaw(ctx, s, stubs)
+	thawed, pending := 0, 0
+	for i, state := range states {
+		if len(state) == 0 {
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\n", state, offloaded[i].Hash, displayPath(offloaded[i].Path))
+		if state == tier.Thawed {
+			thawed++
+		} else {
+			pending++
+		}
+	}
+	if err != nil {
+		return 1, err
+	}
+	if pending > 0 {
+		fmt.Printf("Thawed %d objects; %d are still being retrieved by their remotes, so run this again later\n", thawed, pending)
+	} else {
+		fmt.Printf("Thawed %d objects\n", thawed)
+	}
+	return 0, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/tier"
+)
+
+const tierUsage = `Usage: %s tier <ACTION>
+
+Where <ACTION> is one of:
+
+	policy [<POLICY-FLAGS>]*
+	run [-dry-run]
+	status
+
+Tiering moves the contents of files that are only referenced by old
+snapshots to a cheaper remote, such as one backed by cold storage, and
+leaves small stubs in their place. The snapshots and directory listings
+stay local, so the history can still be browsed, but reading offloaded
+contents fails until they are brought back with "thaw".
+
+The "policy" action prints the tiering policy, or changes the settings
+given as flags. The "run" action offloads everything the policy selects.
+Snapshots older than -older-than are old, except for the latest snapshot
+of each path and snapshots without a recorded time. The "status" action
+lists how many objects, and how many bytes, were offloaded to each remote.
+Objects are never offloaded from append-only archives.
+`
+
+var (
+	tierPolicyFlags = flag.NewFlagSet("tier policy", flag.ContinueOnError)
+	tierRunFlags    = flag.NewFlagSet("tier run", flag.ContinueOnError)
+
+	tierPolicyRemoteFlag = tierPolicyFlags.String(
+		"remote", "",
+		"name of the remote to offload objects to")
+	tierPolicyOlderThanFlag = tierPolicyFlags.Duration(
+		"older-than", 0,
+		"how old snapshots must be for the contents only they reference to be offloaded, such as \"2160h\"")
+	tierRunDryRunFlag = tierRunFlags.Bool(
+		"dry-run", false,
+		"report what would be offloaded without offloading it")
+)
+
+var tierSubcommand = &subcommand{
+	summary:     "offload the contents of old snapshots to a cheaper remote",
+	usage:       tierUsage,
+	actionFlags: []*flag.FlagSet{tierPolicyFlags, tierRunFlags},
+	examples: []string{
+		"tier policy -remote=glacier -older-than=2160h",
+		"tier run -dry-run",
+		"tier run",
+		"tier status",
+	},
+	run: tierCommand,
+}
+
+func tierPolicy(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := tierPolicyFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(tierPolicyFlags.Args()) > 0 {
+		return -1, nil
+	}
+	policy, err := tier.ReadPolicy(s)
+	if err != nil {
+		return 1, err
+	}
+	changed := false
+	var visitErr error
+	tierPolicyFlags.Visit(func(f *flag.Flag) {
+		changed = true
+		switch f.Name {
+		case "remote":
+			if len(*tierPolicyRemoteFlag) == 0 {
+				visitErr = fmt.Errorf("the -remote flag must name a remote")
+			} else if _, err := selectRemotes(s, *tierPolicyRemoteFlag, false); err != nil {
+				visitErr = err
+			}
+			policy.Remote = *tierPolicyRemoteFlag
+		case "older-than":
+			if *tierPolicyOlderThanFlag <= 0 {
+				visitErr = fmt.Errorf("the -older-than duration must be positive")
+			}
+			policy.OlderThan = *tierPolicyOlderThanFlag
+		}
+	})
+	if visitErr != nil {
+		return 1, visitErr
+	}
+	if changed {
+		if err := tier.WritePolicy(ctx, s, policy); err != nil {
+			return 1, err
+		}
+	}
+	fmt.Printf("remote\t%s\n", policy.Remote)
+	fmt.Printf("older-than\t%s\n", policy.OlderThan)
+	return 0, nil
+}
+
+func tierRun(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := tierRunFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(tierRunFlags.Args()) > 0 {
+		return -1, nil
+	}
+	policy, err := tier.ReadPolicy(s)
+	if err != nil {
+		return 1, err
+	}
+	if len(policy.Remote) == 0 || policy.OlderThan <= 0 {
+		return 1, fmt.Errorf("the tiering policy must set both a remote and an age; use \"tier policy\" to set them")
+	}
+	remotes, err := selectRemotes(s, policy.Remote, false)
+	if err != nil {
+		return 1, err
+	}
+	candidates, err := tier.Candidates(ctx, s, time.Now().Add(-policy.OlderThan))
+	if err != nil {
+		return 1, err
+	}
+	if *tierRunDryRunFlag {
+		var total int64
+		for _, h := range candidates {
+			size, err := s.ObjectSize(ctx, h)
+			if err != nil {
+				return 1, fmt.Errorf("failure reading the size of the object %q: %w", h, err)
+			}
+			total += size
+		}
+		fmt.Printf("Would offload %d objects totalling %d bytes to the remote %q\n", len(candidates), total, policy.Remote)
+		return 0, nil
+	}
+	result, err := tier.Offload(ctx, s, remotes[0], candidates)
+	if result != nil && result.Objects > 0 {
+		fmt.Printf("Offloaded %d objects totalling %d bytes to the remote %q\n", result.Objects, result.Bytes, policy.Remote)
+	}
+	if err != nil {
+		return 1, err
+	}
+	if result.Objects == 0 {
+		fmt.Println("Nothing to offload")
+	}
+	return 0, nil
+}
+
+func tierStatus(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) > 0 {
+		return -1, nil
+	}
+	stubs, err := s.ListStubs(ctx)
+	if err != nil {
+		return 1, err
+	}
+	objects := make(map[string]int)
+	bytes := make(map[string]int64)
+	for _, stub := range stubs {
+		objects[stub.Remote]++
+		bytes[stub.Remote] += stub.Size
+	}
+	var names []string
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%d objects\t%d bytes\n", name, objects[name], bytes[name])
+	}
+	return 0, w.Flush()
+}
+
+func tierCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	switch args[0] {
+	case "policy":
+		return tierPolicy(ctx, s, args[1:])
+	case "run":
+		return tierRun(ctx, s, args[1:])
+	case "status":
+		return tierStatus(ctx, s, args[1:])
+	}
+	return -1, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/timestamp"
+)
+
+const timestampUsage = `Usage: %s timestamp <ACTION>
+
+Where <ACTION> is one of:
+
+	add [--tsa=<URL>] [--ca=<FILE>] <SOURCE>
+	verify [--ca=<FILE>] <SOURCE>
+
+And <SOURCE> is one of:
+
+	The hash of a known snapshot.
+	A local file path which has previously been snapshotted.
+
+Timestamps are signed by an RFC 3161 timestamping authority, and prove
+that the snapshot, and therefore all of the data it contains, existed at
+the time of signing. They are stored as notes on the snapshot.
+
+The "add" action requests a new timestamp for the snapshot, and the
+"verify" action checks every timestamp previously stored for it.
+`
+
+var (
+	timestampAddFlags    = flag.NewFlagSet("timestamp add", flag.ContinueOnError)
+	timestampVerifyFlags = flag.NewFlagSet("timestamp verify", flag.ContinueOnError)
+
+	timestampAddTSAFlag = timestampAddFlags.String(
+		"tsa", os.Getenv("RVCS_TSA_URL"),
+		"URL of the timestamping authority (defaults to the value of the RVCS_TSA_URL environment variable)")
+	timestampAddCAFlag = timestampAddFlags.String(
+		"ca", "",
+		"PEM file of root certificates trusted to sign timestamps; if not set, then the system's trusted roots are used")
+	timestampVerifyCAFlag = timestampVerifyFlags.String(
+		"ca", "",
+		"PEM file of root certificates trusted to sign timestamps; if not set, then the system's trusted roots are used")
+)
+
+// timestampRoots returns the root certificates trusted to sign timestamps.
+//
+// If `caFile` is empty, then nil is returned so that the system's trusted roots are used.
+func timestampRoots(caFile string) (*x509.CertPool, error) {
+	if len(caFile) == 0 {
+		return nil, nil
+	}
+	contents, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the root certificates file %q: %w", caFile, err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %q", caFile)
+	}
+	return roots, nil
+}
+
+func timestampAdd(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := timestampAddFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = timestampAddFlags.Args()
+	if len(args) != 1 || len(*timestampAddTSAFlag) == 0 {
+		return -1, nil
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	roots, err := timestampRoots(*timestampAddCAFlag)
+	if err != nil {
+		return 1, err
+	}
+	a, err := timestamp.Add(ctx, s, *timestampAddTSAFlag, h, roots)
+	if err != nil {
+		return 1, fmt.Errorf("failure timestamping %q: %w", h, err)
+	}
+	fmt.Printf("Timestamped %q at %s by %q\n", h, a.Time.Format(time.RFC3339), a.Authority)
+	return 0, nil
+}
+
+func timestampVerify(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := timestampVerifyFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = timestampVerifyFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	h, err := resolveSnapshot(ctx, s, args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the snapshot hash for %q: %w", args[0], err)
+	}
+	roots, err := timestampRoots(*timestampVerifyCAFlag)
+	if err != nil {
+		return 1, err
+	}
+	tokens, err := timestamp.List(ctx, s, h)
+	if err != nil {
+		return 1, fmt.Errorf("failure listing the timestamps of %q: %w", h, err)
+	}
+	if len(tokens) == 0 {
+		fmt.Printf("No timestamps found for %q\n", h)
+		return 1, nil
+	}
+	ret := 0
+	for _, token := range tokens {
+		a, err := timestamp.Verify(token.DER, h, roots)
+		if err != nil {
+			fmt.Printf("Invalid timestamp %q from %q: %v\n", token.Note, token.URL, err)
+			ret = 1
+			continue
+		}
+		fmt.Printf("Verified that %q existed at %s according to %q\n", h, a.Time.Format(time.RFC3339), a.Authority)
+	}
+	return ret, nil
+}
+
+var timestampSubcommand = &subcommand{
+	summary:     "prove when snapshots existed using a timestamping authority",
+	usage:       timestampUsage,
+	actionFlags: []*flag.FlagSet{timestampAddFlags, timestampVerifyFlags},
+	examples: []string{
+		"timestamp add --tsa=https://freetsa.org/tsr ~/contracts",
+		"timestamp verify --ca=tsa-roots.pem ~/contracts",
+	},
+	run: timestampCommand,
+}
+
+func timestampCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	var ret int
+	var err error
+	switch args[0] {
+	case "add":
+		ret, err = timestampAdd(ctx, s, args[1:])
+	case "verify":
+		ret, err = timestampVerify(ctx, s, args[1:])
+	default:
+		ret = -1
+	}
+	return ret, err
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// runTool runs an external diff or merge tool and waits for it to exit.
+//
+// The `tool` string is split into fields, and any references to the
+// variables in `vars` (e.g. `$LOCAL`) are replaced with the corresponding
+// paths. If none of the variables are referenced, then the paths named
+// by `order` are appended to the command in that order.
+//
+// If `ignoreExitStatus` is true, then the tool exiting with a non-zero
+// status is not treated as a failure. This is needed for diff tools,
+// which conventionally exit with a non-zero status when the inputs differ.
+func runTool(ctx context.Context, tool string, vars map[string]snapshot.Path, order []string, ignoreExitStatus bool) error {
+	fields := strings.Fields(tool)
+	if len(fields) == 0 {
+		return errors.New("no tool specified")
+	}
+	referenced := false
+	for i, field := range fields {
+		fields[i] = os.Expand(field, func(name string) string {
+			if p, ok := vars[name]; ok {
+				referenced = true
+				return string(p)
+			}
+			return os.Getenv(name)
+		})
+	}
+	if !referenced {
+		for _, name := range order {
+			fields = append(fields, string(vars[name]))
+		}
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok && ignoreExitStatus {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failure running the tool %q: %w", tool, err)
+	}
+	return nil
+}
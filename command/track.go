@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/track"
+)
+
+const trackUsage = `Usage: %s track <ACTION>
+
+Where <ACTION> is one of:
+
+	link <ID> <PATH>
+	unlink <ID>
+	list
+
+A track is a history identified by <ID> rather than by a path. When a
+linked path is pushed, its snapshot is also recorded under the track in
+the remote, and pulling a linked path reads the latest snapshot of its
+track. This lets the same history be shared between machines that keep
+the files at different paths.
+`
+
+func trackLink(ctx context.Context, s *storage.LocalFiles, links []*track.Link, args []string) (int, error) {
+	if len(args) != 2 {
+		return -1, nil
+	}
+	abs, err := filepath.Abs(args[1])
+	if err != nil {
+		return 1, fmt.Errorf("failure resolving the absolute path of %q: %w", args[1], err)
+	}
+	var updated []*track.Link
+	for _, l := range links {
+		if l.ID != args[0] {
+			updated = append(updated, l)
+		}
+	}
+	updated = append(updated, &track.Link{ID: args[0], Path: snapshot.Path(abs)})
+	if err := track.WriteLinks(ctx, s, updated); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func trackUnlink(ctx context.Context, s *storage.LocalFiles, links []*track.Link, args []string) (int, error) {
+	if len(args) != 1 {
+		return -1, nil
+	}
+	var remaining []*track.Link
+	for _, l := range links {
+		if l.ID != args[0] {
+			remaining = append(remaining, l)
+		}
+	}
+	if len(remaining) == len(links) {
+		return 1, fmt.Errorf("there is no track named %q", args[0])
+	}
+	if err := track.WriteLinks(ctx, s, remaining); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+var trackSubcommand = &subcommand{
+	summary: "link local paths to histories shared between machines",
+	usage:   trackUsage,
+	examples: []string{
+		"track link notes ~/notes",
+		"track list",
+	},
+	run: trackCommand,
+}
+
+func trackCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if len(args) < 1 {
+		return -1, nil
+	}
+	links, err := track.ReadLinks(s)
+	if err != nil {
+		return 1, err
+	}
+	var ret int
+	switch args[0] {
+	case "link":
+		ret, err = trackLink(ctx, s, links, args[1:])
+	case "unlink":
+		ret, err = trackUnlink(ctx, s, links, args[1:])
+	case "list":
+		for _, l := range links {
+			fmt.Printf("%s\t%s\n", l.ID, displayPath(l.Path))
+		}
+	default:
+		ret = -1
+	}
+	return ret, err
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const undoUsage = `Usage: %[1]s undo <PATH>
+
+Where <PATH> is a local filesystem path.
+
+Makes the parent of the latest snapshot of <PATH> its latest snapshot
+again, as if the latest snapshot had never been taken. If the latest
+snapshot was a merge, then its first parent is used.
+
+The files under <PATH> are not modified, and the undone snapshot is
+not deleted. It is recorded in the reflog, so that it can still be
+found with "reflog" and brought back with "merge" or "restore".
+
+This is not allowed in append-only archives.
+`
+
+var undoFlags = flag.NewFlagSet("undo", flag.ContinueOnError)
+
+var undoSubcommand = &subcommand{
+	summary: "make the previous snapshot of a path its latest snapshot again",
+	usage:   undoUsage,
+	flags:   undoFlags,
+	examples: []string{
+		"undo ~/notes",
+	},
+	run: undoCommand,
+}
+
+func undoCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := undoFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = undoFlags.Args()
+	if len(args) != 1 {
+		return -1, nil
+	}
+	abs, err := filepath.Abs(args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure determining the absolute path of %q: %w", args[0], err)
+	}
+	p := snapshot.Path(abs)
+	h, f, err := s.FindSnapshot(ctx, p)
+	if os.IsNotExist(err) {
+		return 1, fmt.Errorf("%q has not been snapshotted", abs)
+	} else if err != nil {
+		return 1, fmt.Errorf("failure looking up the latest snapshot of %q: %w", abs, err)
+	}
+	if len(f.Parents) == 0 {
+		return 1, fmt.Errorf("nothing to undo, as the latest snapshot %q of %q has no parents", h, abs)
+	}
+	parent := f.Parents[0]
+	if err := s.ResetSnapshot(ctx, p, parent); err != nil {
+		return 1, fmt.Errorf("failure resetting %q to %q: %w", abs, parent, err)
+	}
+	if err := recordMapping(ctx, s, "undo", p, h, parent); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Reset %q from %q back to %q\n", abs, h, parent)
+	return 0, nil
+}
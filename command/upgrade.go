@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// formatVersionConfig is the name of the archive config file holding the format version for new snapshots.
+const formatVersionConfig = "format-version"
+
+const upgradeUsage = `Usage: %s upgrade [<FLAGS>]*
+
+Upgrades the format version used for new snapshots in the archive.
+
+Existing snapshots are left as-is, and a path's snapshot is only stored
+in the new format once the path changes. Older versions of rvcs may not
+be able to read snapshots stored in newer formats.
+
+Format version 3 stores snapshots in a compact binary encoding instead
+of as text. Use "-format 2" to keep storing new snapshots as text.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	upgradeFlags = flag.NewFlagSet("upgrade", flag.ContinueOnError)
+
+	upgradeFormatFlag = upgradeFlags.Int(
+		"format", int(snapshot.LatestFormat),
+		"format version to upgrade to")
+)
+
+// archiveFormatVersion returns the format version configured for new snapshots in the archive.
+//
+// This is `snapshot.LegacyFormat` if the archive has never been upgraded.
+func archiveFormatVersion(s *storage.LocalFiles) (snapshot.FormatVersion, error) {
+	bs, err := os.ReadFile(s.ConfigFile(formatVersionConfig))
+	if os.IsNotExist(err) {
+		return snapshot.LegacyFormat, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failure reading the format version config: %w", err)
+	}
+	return snapshot.ParseFormatVersion(string(bs))
+}
+
+// formatOption returns the snapshot option for storing new snapshots in the archive's format version.
+func formatOption(s *storage.LocalFiles) (snapshot.Option, error) {
+	v, err := archiveFormatVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	if v > snapshot.LatestFormat {
+		return nil, fmt.Errorf("the archive uses the snapshot format version %d, but this version of rvcs only supports up to version %d", v, snapshot.LatestFormat)
+	}
+	return snapshot.WithFormatVersion(v), nil
+}
+
+var upgradeSubcommand = &subcommand{
+	summary: "upgrade the format version used for new snapshots",
+	usage:   upgradeUsage,
+	flags:   upgradeFlags,
+	examples: []string{
+		"upgrade",
+	},
+	run: upgradeCommand,
+}
+
+func upgradeCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := upgradeFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	if len(upgradeFlags.Args()) != 0 {
+		return -1, nil
+	}
+	current, err := archiveFormatVersion(s)
+	if err != nil {
+		return 1, err
+	}
+	target := snapshot.FormatVersion(*upgradeFormatFlag)
+	if target > snapshot.LatestFormat {
+		return 1, fmt.Errorf("the format version %d is not supported by this version of rvcs; the latest supported version is %d", target, snapshot.LatestFormat)
+	} else if target < current {
+		return 1, fmt.Errorf("the archive already uses the format version %d, and cannot be downgraded to version %d", current, target)
+	} else if target == current {
+		fmt.Printf("The archive already uses the format version %d\n", current)
+		return 0, nil
+	}
+	if err := s.WriteConfigFile(ctx, formatVersionConfig, []byte(target.String()+"\n")); err != nil {
+		return 1, fmt.Errorf("failure writing the format version config: %w", err)
+	}
+	fmt.Printf("Upgraded the archive from format version %d to %d\n", current, target)
+	return 0, nil
+}
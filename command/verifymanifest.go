@@ -0,0 +1,82 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package command defines the command line interface for rvcs
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/mirror"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const verifyManifestUsage = `Usage: %s verify-manifest [<FLAGS>]* <MANIFEST> <DIR>
+
+Where <MANIFEST> is a manifest written by "export -mirror -manifest", and
+<DIR> is the exported mirror directory or a copy of it.
+
+Every file listed in the manifest is checked against the file in <DIR>,
+and any files that are missing, unexpected, or that differ are reported.
+
+<FLAGS> are one of:
+
+`
+
+var (
+	verifyManifestFlags = flag.NewFlagSet("verify-manifest", flag.ContinueOnError)
+
+	verifyManifestIgnoreMtimeFlag = verifyManifestFlags.Bool(
+		"ignore-mtime", false,
+		"do not report files whose modification times differ from the manifest, e.g. for copies that did not preserve them")
+)
+
+var verifyManifestSubcommand = &subcommand{
+	summary: "check a mirror against its file manifest",
+	usage:   verifyManifestUsage,
+	flags:   verifyManifestFlags,
+	examples: []string{
+		"verify-manifest manifest.jsonl ~/mirror",
+	},
+	run: verifyManifestCommand,
+}
+
+func verifyManifestCommand(ctx context.Context, s *storage.LocalFiles, args []string) (int, error) {
+	if err := verifyManifestFlags.Parse(args); err != nil {
+		return 1, nil
+	}
+	args = verifyManifestFlags.Args()
+	if len(args) != 2 {
+		return -1, nil
+	}
+	in, err := os.Open(args[0])
+	if err != nil {
+		return 1, fmt.Errorf("failure opening the manifest %q: %w", args[0], err)
+	}
+	defer in.Close()
+	problems, err := mirror.VerifyFileManifest(ctx, in, args[1], !*verifyManifestIgnoreMtimeFlag)
+	if err != nil {
+		return 1, err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return 1, fmt.Errorf("%w: %d files in %q do not match the manifest", storage.ErrCorrupt, len(problems), args[1])
+	}
+	return 0, nil
+}
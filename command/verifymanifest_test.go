@@ -0,0 +1,50 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestVerifyManifestMismatchIsCorrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	manifest := filepath.Join(dir, "manifest.jsonl")
+	entry := `{"path":"missing.txt","mode":"-rw-------","size":5,"mtime":"2022-06-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(manifest, []byte(entry), 0600); err != nil {
+		t.Fatalf("failure writing the manifest: %v", err)
+	}
+	mirrorDir := filepath.Join(dir, "mirror")
+	if err := os.Mkdir(mirrorDir, 0700); err != nil {
+		t.Fatalf("failure creating the mirror directory: %v", err)
+	}
+	var code int
+	var err error
+	captureStdout(t, func() {
+		code, err = verifyManifestCommand(ctx, s, []string{manifest, mirrorDir})
+	})
+	if err == nil || code != ExitFailure {
+		t.Fatalf("unexpected result from verifying a mismatched mirror: exit code %d, error %v", code, err)
+	}
+	if got := failureExitCode(err); got != ExitCorrupt {
+		t.Errorf("unexpected exit code for a manifest mismatch: got %d, want %d", got, ExitCorrupt)
+	}
+}
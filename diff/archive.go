@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func init() {
+	RegisterRenderer("application/zip", renderArchive(zipEntries), ".zip", ".jar")
+	RegisterRenderer("application/x-tar", renderArchive(tarEntries), ".tar")
+	RegisterRenderer("application/x-gzip", renderArchive(gzipTarEntries), ".tgz", ".tar.gz")
+}
+
+// renderArchive returns a renderer that lists the members of an archive that were added, removed, or changed.
+//
+// The `entries` function returns a description of each member of an
+// archive, keyed by the member's name.
+func renderArchive(entries func([]byte) (map[string]string, error)) Renderer {
+	return func(before, after []byte) ([]string, error) {
+		beforeEntries, err := entries(before)
+		if err != nil {
+			return nil, err
+		}
+		afterEntries, err := entries(after)
+		if err != nil {
+			return nil, err
+		}
+		return describeFields(beforeEntries, afterEntries), nil
+	}
+}
+
+func describeMember(size int64, checksum uint32) string {
+	return fmt.Sprintf("%d bytes, crc32 %08x", size, checksum)
+}
+
+func zipEntries(contents []byte) (map[string]string, error) {
+	r, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]string)
+	for _, f := range r.File {
+		name := snapshot.Path(f.Name).Display()
+		if f.FileInfo().IsDir() {
+			entries[name] = "directory"
+			continue
+		}
+		entries[name] = describeMember(int64(f.UncompressedSize64), f.CRC32)
+	}
+	return entries, nil
+}
+
+func tarEntries(contents []byte) (map[string]string, error) {
+	return readTarEntries(bytes.NewReader(contents))
+}
+
+func gzipTarEntries(contents []byte) (map[string]string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// Guard against small files that decompress to something huge.
+	return readTarEntries(io.LimitReader(r, maxRenderSize))
+}
+
+func readTarEntries(r io.Reader) (map[string]string, error) {
+	tr := tar.NewReader(r)
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		name := snapshot.Path(hdr.Name).Display()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entries[name] = "directory"
+		case tar.TypeSymlink:
+			entries[name] = fmt.Sprintf("symlink to %q", hdr.Linkname)
+		case tar.TypeLink:
+			entries[name] = fmt.Sprintf("hard link to %q", hdr.Linkname)
+		case tar.TypeReg:
+			checksum := crc32.NewIEEE()
+			size, err := io.Copy(checksum, tr)
+			if err != nil {
+				return nil, err
+			}
+			entries[name] = describeMember(size, checksum.Sum32())
+		default:
+			entries[name] = fmt.Sprintf("type %q", hdr.Typeflag)
+		}
+	}
+}
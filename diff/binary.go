@@ -0,0 +1,265 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"unicode/utf8"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	// sniffLen is the number of leading bytes examined to decide whether or not contents are text.
+	sniffLen = 8000
+
+	minChunkSize = 2 * 1024
+	maxChunkSize = 64 * 1024
+
+	// chunkMask selects chunk boundaries so that chunks average 8KiB.
+	chunkMask = 8*1024 - 1
+)
+
+// gearTable is the table of random values used by the rolling hash that picks chunk boundaries.
+//
+// It is generated from a fixed seed so that chunk boundaries are stable.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	r := rand.New(rand.NewSource(0x72766373))
+	for i := range table {
+		table[i] = r.Uint64()
+	}
+	return table
+}()
+
+// isBinary reports whether or not the given prefix of some contents looks like binary data.
+//
+// If `truncated` is true, then the prefix may end part way through a
+// multi-byte character, and that is not treated as a sign of binary data.
+func isBinary(prefix []byte, truncated bool) bool {
+	if bytes.IndexByte(prefix, 0) >= 0 {
+		return true
+	}
+	for len(prefix) > 0 {
+		r, size := utf8.DecodeRune(prefix)
+		if r == utf8.RuneError && size <= 1 {
+			return !truncated || utf8.FullRune(prefix)
+		}
+		prefix = prefix[size:]
+	}
+	return false
+}
+
+// chunkCount is the size of a chunk, and how many times it occurs in some contents.
+type chunkCount struct {
+	size  int64
+	count int64
+}
+
+// chunks splits the given contents into content-defined chunks.
+//
+// The returned map is keyed by the hash of each chunk, with the
+// values recording the size of that chunk and how many times it occurs.
+//
+// Chunk boundaries depend only on the nearby contents, so data that is
+// shared between two versions of a file results in shared chunks even
+// if bytes were inserted or removed elsewhere in the file.
+func chunks(r io.Reader) (map[[sha256.Size]byte]chunkCount, error) {
+	result := make(map[[sha256.Size]byte]chunkCount)
+	add := func(chunk []byte) {
+		key := sha256.Sum256(chunk)
+		c := result[key]
+		c.size = int64(len(chunk))
+		c.count++
+		result[key] = c
+	}
+	br := bufio.NewReader(r)
+	var chunk []byte
+	var rolling uint64
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		chunk = append(chunk, b)
+		rolling = (rolling << 1) + gearTable[b]
+		if (len(chunk) >= minChunkSize && rolling&chunkMask == 0) || len(chunk) >= maxChunkSize {
+			add(chunk)
+			chunk = chunk[:0]
+			rolling = 0
+		}
+	}
+	if len(chunk) > 0 {
+		add(chunk)
+	}
+	return result, nil
+}
+
+// sharedSize returns how many bytes of the `after` chunks also occur in
+// the `before` chunks, along with the total size of the `after` chunks.
+//
+// A chunk that occurs more times after than before is only counted as
+// shared for as many times as it occurred before.
+func sharedSize(before, after map[[sha256.Size]byte]chunkCount) (shared, total int64) {
+	for chunk, a := range after {
+		total += a.size * a.count
+		count := before[chunk].count
+		if count > a.count {
+			count = a.count
+		}
+		shared += a.size * count
+	}
+	return shared, total
+}
+
+// BinarySummary describes how the contents of a binary file changed.
+type BinarySummary struct {
+	// BeforeSize is the size in bytes of the contents before the change.
+	BeforeSize int64
+
+	// AfterSize is the size in bytes of the contents after the change.
+	AfterSize int64
+
+	// BeforeContents is the hash of the contents before the change.
+	BeforeContents *snapshot.Hash
+
+	// AfterContents is the hash of the contents after the change.
+	AfterContents *snapshot.Hash
+
+	// Similarity is the fraction of the contents after the change that
+	// was also present before the change, measured in chunks.
+	//
+	// This is negative if the similarity was not computed.
+	Similarity float64
+}
+
+// String implements the `fmt.Stringer` interface.
+func (b *BinarySummary) String() string {
+	summary := fmt.Sprintf("binary: %d -> %d bytes (%+d), %s -> %s", b.BeforeSize, b.AfterSize, b.AfterSize-b.BeforeSize, b.BeforeContents, b.AfterContents)
+	if b.Similarity >= 0 {
+		summary += fmt.Sprintf(", %.0f%% similar", b.Similarity*100)
+	}
+	return summary
+}
+
+func readPrefix(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]byte, bool, error) {
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, false, fmt.Errorf("failure opening the contents %q: %w", h, err)
+	}
+	defer reader.Close()
+	prefix, err := io.ReadAll(io.LimitReader(reader, sniffLen+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failure reading the contents %q: %w", h, err)
+	}
+	if len(prefix) > sniffLen {
+		return prefix[:sniffLen], true, nil
+	}
+	return prefix, false, nil
+}
+
+// fileIsBinary reports whether or not the contents of the given regular file are binary.
+//
+// The content type recorded in the snapshot is used if present, so that
+// the contents only need to be read for snapshots that predate it.
+func fileIsBinary(ctx context.Context, s *storage.LocalFiles, f *snapshot.File) (bool, error) {
+	if isText, known := f.IsText(); known {
+		return !isText, nil
+	}
+	prefix, truncated, err := readPrefix(ctx, s, f.Contents)
+	if err != nil {
+		return false, err
+	}
+	return isBinary(prefix, truncated), nil
+}
+
+func objectChunks(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) (map[[sha256.Size]byte]chunkCount, error) {
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the contents %q: %w", h, err)
+	}
+	defer reader.Close()
+	return chunks(reader)
+}
+
+// SummarizeBinary summarizes the change to the contents of a regular file, if either version is binary.
+//
+// The returned summary is nil if the change is not a modification of
+// a regular file, or if both versions of the file are text.
+//
+// If `similarity` is true, then both versions of the file are read in
+// full in order to compute how similar they are.
+func SummarizeBinary(ctx context.Context, s *storage.LocalFiles, c *Change, similarity bool) (*BinarySummary, error) {
+	if c.BeforeFile == nil || c.AfterFile == nil {
+		return nil, nil
+	}
+	for _, f := range []*snapshot.File{c.BeforeFile, c.AfterFile} {
+		if f.IsDir() || f.IsLink() {
+			return nil, nil
+		}
+	}
+	binary := false
+	for _, f := range []*snapshot.File{c.BeforeFile, c.AfterFile} {
+		fileBinary, err := fileIsBinary(ctx, s, f)
+		if err != nil {
+			return nil, err
+		}
+		binary = binary || fileBinary
+	}
+	if !binary {
+		return nil, nil
+	}
+	beforeSize, err := s.ObjectSize(ctx, c.BeforeFile.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the size of %q: %w", c.BeforeFile.Contents, err)
+	}
+	afterSize, err := s.ObjectSize(ctx, c.AfterFile.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the size of %q: %w", c.AfterFile.Contents, err)
+	}
+	summary := &BinarySummary{
+		BeforeSize:     beforeSize,
+		AfterSize:      afterSize,
+		BeforeContents: c.BeforeFile.Contents,
+		AfterContents:  c.AfterFile.Contents,
+		Similarity:     -1,
+	}
+	if !similarity {
+		return summary, nil
+	}
+	beforeChunks, err := objectChunks(ctx, s, c.BeforeFile.Contents)
+	if err != nil {
+		return nil, err
+	}
+	afterChunks, err := objectChunks(ctx, s, c.AfterFile.Contents)
+	if err != nil {
+		return nil, err
+	}
+	shared, total := sharedSize(beforeChunks, afterChunks)
+	summary.Similarity = 1
+	if total > 0 {
+		summary.Similarity = float64(shared) / float64(total)
+	}
+	return summary, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestIsBinary(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Prefix      []byte
+		Truncated   bool
+		Want        bool
+	}{
+		{
+			Description: "empty",
+		},
+		{
+			Description: "ascii text",
+			Prefix:      []byte("Hello, World!\n"),
+		},
+		{
+			Description: "utf-8 text",
+			Prefix:      []byte("Grüße, 世界"),
+		},
+		{
+			Description: "truncated utf-8 text",
+			Prefix:      []byte("世界")[:4],
+			Truncated:   true,
+		},
+		{
+			Description: "incomplete utf-8 text",
+			Prefix:      []byte("世界")[:4],
+			Want:        true,
+		},
+		{
+			Description: "nul byte",
+			Prefix:      []byte("Hello\x00World"),
+			Want:        true,
+		},
+		{
+			Description: "invalid utf-8",
+			Prefix:      []byte{0xff, 0xfe, 'a'},
+			Want:        true,
+		},
+	}
+	for _, testCase := range testCases {
+		if got, want := isBinary(testCase.Prefix, testCase.Truncated), testCase.Want; got != want {
+			t.Errorf("unexpected result for test case %q: got %v, want %v", testCase.Description, got, want)
+		}
+	}
+}
+
+func TestChunksShareUnchangedData(t *testing.T) {
+	original := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(original)
+	// Insert some bytes in the middle, which shifts the offsets of everything after them.
+	modified := append(append(append([]byte{}, original[:500000]...), []byte("inserted")...), original[500000:]...)
+
+	originalChunks, err := chunks(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("failure chunking the original data: %v", err)
+	}
+	modifiedChunks, err := chunks(bytes.NewReader(modified))
+	if err != nil {
+		t.Fatalf("failure chunking the modified data: %v", err)
+	}
+	shared, total := sharedSize(originalChunks, modifiedChunks)
+	if total != int64(len(modified)) {
+		t.Errorf("unexpected total chunk size: got %d, want %d", total, len(modified))
+	}
+	if similarity := float64(shared) / float64(total); similarity < 0.9 {
+		t.Errorf("unexpectedly low similarity after a small insertion: %f", similarity)
+	}
+}
+
+func TestChunksCountRepeatedData(t *testing.T) {
+	original := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(original)
+	// Repeat the original data, so that every chunk occurs several times.
+	repeated := bytes.Repeat(original, 4)
+
+	originalChunks, err := chunks(bytes.NewReader(original))
+	if err != nil {
+		t.Fatalf("failure chunking the original data: %v", err)
+	}
+	repeatedChunks, err := chunks(bytes.NewReader(repeated))
+	if err != nil {
+		t.Fatalf("failure chunking the repeated data: %v", err)
+	}
+	shared, total := sharedSize(originalChunks, repeatedChunks)
+	if total != int64(len(repeated)) {
+		t.Errorf("unexpected total chunk size: got %d, want %d", total, len(repeated))
+	}
+	if similarity := float64(shared) / float64(total); similarity > 0.3 {
+		t.Errorf("unexpectedly high similarity after repeating the data: %f", similarity)
+	}
+	shared, total = sharedSize(repeatedChunks, originalChunks)
+	if similarity := float64(shared) / float64(total); similarity < 0.9 {
+		t.Errorf("unexpectedly low similarity after removing the repeats: %f", similarity)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff defines methods for comparing two snapshots.
+package diff
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Change describes a single file that differs between two snapshots.
+type Change struct {
+	// Path is the path of the changed file, relative to the compared snapshots.
+	//
+	// This is empty if the compared snapshots are not directories.
+	Path string
+
+	// Before is the hash of the file snapshot before the change.
+	//
+	// This is nil if the file was added.
+	Before *snapshot.Hash
+
+	// BeforeFile is the file snapshot before the change.
+	BeforeFile *snapshot.File
+
+	// After is the hash of the file snapshot after the change.
+	//
+	// This is nil if the file was removed.
+	After *snapshot.Hash
+
+	// AfterFile is the file snapshot after the change.
+	AfterFile *snapshot.File
+}
+
+// Kind returns a single letter describing the change.
+//
+// The letter is `A` for added files, `D` for deleted files, and `M` for modified files.
+func (c *Change) Kind() string {
+	if c.Before == nil {
+		return "A"
+	}
+	if c.After == nil {
+		return "D"
+	}
+	return "M"
+}
+
+func readSnapshot(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) (*snapshot.File, error) {
+	if h == nil {
+		return nil, nil
+	}
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+	}
+	return f, nil
+}
+
+func listContents(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File) (snapshot.Tree, error) {
+	if !f.IsDir() {
+		return nil, nil
+	}
+	return s.ListDirectorySnapshotContents(ctx, h, f)
+}
+
+func compare(ctx context.Context, s *storage.LocalFiles, subpath string, before, after *snapshot.Hash) ([]*Change, error) {
+	beforeFile, err := readSnapshot(ctx, s, before)
+	if err != nil {
+		return nil, err
+	}
+	afterFile, err := readSnapshot(ctx, s, after)
+	if err != nil {
+		return nil, err
+	}
+	if beforeFile != nil && afterFile != nil && beforeFile.Mode == afterFile.Mode && beforeFile.Contents.Equal(afterFile.Contents) {
+		// The two snapshots only differ in their history.
+		return nil, nil
+	}
+	if !beforeFile.IsDir() && !afterFile.IsDir() {
+		return []*Change{{
+			Path:       subpath,
+			Before:     before,
+			BeforeFile: beforeFile,
+			After:      after,
+			AfterFile:  afterFile,
+		}}, nil
+	}
+	var changes []*Change
+	if !beforeFile.IsDir() && beforeFile != nil {
+		// A file was replaced with a directory.
+		changes = append(changes, &Change{Path: subpath, Before: before, BeforeFile: beforeFile})
+		before, beforeFile = nil, nil
+	} else if !afterFile.IsDir() && afterFile != nil {
+		// A directory was replaced with a file.
+		changes = append(changes, &Change{Path: subpath, After: after, AfterFile: afterFile})
+		after, afterFile = nil, nil
+	}
+	beforeTree, err := listContents(ctx, s, before, beforeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the contents of %q: %w", before, err)
+	}
+	afterTree, err := listContents(ctx, s, after, afterFile)
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the contents of %q: %w", after, err)
+	}
+	children := make(map[snapshot.Path]struct{})
+	for child := range beforeTree {
+		children[child] = struct{}{}
+	}
+	for child := range afterTree {
+		children[child] = struct{}{}
+	}
+	for child := range children {
+		childChanges, err := compare(ctx, s, filepath.Join(subpath, string(child)), beforeTree[child], afterTree[child])
+		if err != nil {
+			return nil, fmt.Errorf("failure comparing the child %q: %w", child, err)
+		}
+		changes = append(changes, childChanges...)
+	}
+	return changes, nil
+}
+
+// Compare returns the list of files that differ between the snapshots `before` and `after`.
+//
+// Directories are compared recursively, and only the changes to the
+// files within them are reported. Snapshots whose contents are
+// identical, but whose histories differ, are treated as unchanged.
+//
+// The returned changes are sorted by path.
+func Compare(ctx context.Context, s *storage.LocalFiles, before, after *snapshot.Hash) ([]*Change, error) {
+	changes, err := compare(ctx, s, "", before, after)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// maxKeptObjectSize is the size of the largest object kept while comparing directories.
+//
+// Directory listings and file snapshots are much smaller than this, so
+// they can be read back to compare the directories, while the contents
+// of large files are only hashed.
+const maxKeptObjectSize = 1 << 20
+
+// hashingStorage is an overlay that only keeps small objects.
+type hashingStorage struct {
+	*storage.Overlay
+}
+
+func (hs *hashingStorage) StoreObject(ctx context.Context, reader io.Reader) (*snapshot.Hash, error) {
+	var prefix bytes.Buffer
+	n, err := io.CopyN(&prefix, reader, maxKeptObjectSize+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failure reading an object: %w", err)
+	}
+	if n <= maxKeptObjectSize {
+		return hs.Overlay.StoreObject(ctx, &prefix)
+	}
+	return snapshot.NewHash(io.MultiReader(&prefix, reader))
+}
+
+// hashPath hashes the local path `p` into `hs` the same way that it would be snapshotted.
+//
+// The returned hash is nil if `p` does not exist.
+func hashPath(ctx context.Context, hs *hashingStorage, p snapshot.Path, opts ...snapshot.Option) (*snapshot.Hash, error) {
+	h, _, err := snapshot.NewSnapshotter(hs, opts...).Snapshot(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failure hashing %q: %w", p, err)
+	}
+	return h, nil
+}
+
+// CompareDirs returns the list of files that differ between the local directories `before` and `after`.
+//
+// Both directories are hashed the same way they would be snapshotted,
+// reusing the hashes of files that match the path info cache of `s`,
+// but nothing is stored in `s`. The changes are reported as they are by
+// `Compare`, but the contents of large files are not kept, so the
+// returned changes can only be used for their paths and kinds.
+func CompareDirs(ctx context.Context, s *storage.LocalFiles, before, after snapshot.Path, opts ...snapshot.Option) ([]*Change, error) {
+	overlay, err := storage.NewOverlay(s)
+	if err != nil {
+		return nil, err
+	}
+	defer overlay.Close()
+	hs := &hashingStorage{Overlay: overlay}
+	var hashes []*snapshot.Hash
+	for _, p := range []snapshot.Path{before, after} {
+		h, err := hashPath(ctx, hs, p, opts...)
+		if err != nil {
+			return nil, err
+		} else if h == nil {
+			return nil, fmt.Errorf("%q does not exist: %w", p, storage.ErrNotFound)
+		}
+		hashes = append(hashes, h)
+	}
+	return Compare(ctx, overlay.LocalFiles, hashes[0], hashes[1])
+}
+
+// CompareWorking returns the list of files that differ between the latest snapshot of the local path `p` and its current contents.
+//
+// The current contents are hashed as they are by `CompareDirs`, so
+// nothing is stored in `s`. If `p` no longer exists, then every file in
+// its latest snapshot is reported as deleted.
+func CompareWorking(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, opts ...snapshot.Option) ([]*Change, error) {
+	prev, _, err := s.FindSnapshot(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	return CompareWorkingTo(ctx, s, prev, p, opts...)
+}
+
+// CompareWorkingTo returns the list of files that differ between the snapshot `base` and the current contents of the local path `p`.
+//
+// This is the same as `CompareWorking`, except that `base` may be any
+// snapshot, such as an older one from the history of `p`.
+func CompareWorkingTo(ctx context.Context, s *storage.LocalFiles, base *snapshot.Hash, p snapshot.Path, opts ...snapshot.Option) ([]*Change, error) {
+	overlay, err := storage.NewOverlay(s)
+	if err != nil {
+		return nil, err
+	}
+	defer overlay.Close()
+	h, err := hashPath(ctx, &hashingStorage{Overlay: overlay}, p, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(ctx, overlay.LocalFiles, base, h)
+}
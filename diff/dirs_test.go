@@ -0,0 +1,139 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestCompareDirs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	large := bytes.Repeat([]byte("x"), maxKeptObjectSize+10)
+	trees := map[string]map[string][]byte{
+		"before": {
+			"same.txt":    []byte("same"),
+			"changed.txt": []byte("old"),
+			"deleted.txt": []byte("gone"),
+			"large.bin":   large,
+		},
+		"after": {
+			"same.txt":    []byte("same"),
+			"changed.txt": []byte("new"),
+			"added.txt":   []byte("added"),
+			"large.bin":   append(append([]byte{}, large...), 'y'),
+		},
+	}
+	for name, files := range trees {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatalf("failure creating the example directory %q: %v", name, err)
+		}
+		for file, contents := range files {
+			if err := os.WriteFile(filepath.Join(dir, name, file), contents, 0600); err != nil {
+				t.Fatalf("failure writing the example file %q: %v", file, err)
+			}
+		}
+	}
+	changes, err := CompareDirs(ctx, s, snapshot.Path(filepath.Join(dir, "before")), snapshot.Path(filepath.Join(dir, "after")))
+	if err != nil {
+		t.Fatalf("failure comparing the directories: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Kind()+" "+c.Path)
+	}
+	want := []string{"A added.txt", "M changed.txt", "D deleted.txt", "M large.bin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes: got %q, want %q", got, want)
+	}
+	if _, err := os.Stat(s.ArchiveDir); !os.IsNotExist(err) {
+		t.Errorf("unexpected archive created while comparing the directories: %v", err)
+	}
+}
+
+func TestCompareWorking(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	p := snapshot.Path(filepath.Join(dir, "working"))
+	if err := os.MkdirAll(string(p), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for _, file := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(string(p), file), []byte(file), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", file, err)
+		}
+	}
+	if _, err := CompareWorking(ctx, s, p); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected result comparing a path that was never snapshotted: %v", err)
+	}
+	h, _, err := snapshot.NewSnapshotter(s).Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	if changes, err := CompareWorking(ctx, s, p); err != nil || len(changes) != 0 {
+		t.Errorf("unexpected result comparing an unchanged directory: %+v, %v", changes, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(string(p), "a.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatalf("failure modifying the example file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(string(p), "b.txt")); err != nil {
+		t.Fatalf("failure removing the example file: %v", err)
+	}
+	changes, err := CompareWorking(ctx, s, p)
+	if err != nil {
+		t.Fatalf("failure comparing the changed directory: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Kind()+" "+c.Path)
+	}
+	if want := []string{"M a.txt", "D b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes: got %q, want %q", got, want)
+	}
+
+	// Comparing to the first snapshot includes the changes that were snapshotted since.
+	if err := os.WriteFile(filepath.Join(string(p), "b.txt"), []byte("b.txt"), 0600); err != nil {
+		t.Fatalf("failure restoring the example file: %v", err)
+	}
+	second, _, err := snapshot.NewSnapshotter(s).Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the changed directory: %v", err)
+	}
+	if changes, err := CompareWorking(ctx, s, p); err != nil || len(changes) != 0 {
+		t.Errorf("unexpected result comparing to the latest snapshot: %+v, %v", changes, err)
+	}
+	changes, err = CompareWorkingTo(ctx, s, h, p)
+	if err != nil {
+		t.Fatalf("failure comparing to the first snapshot: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "a.txt" {
+		t.Errorf("unexpected changes since the first snapshot: %+v", changes)
+	}
+	if latest, _, err := s.FindSnapshot(ctx, p); err != nil || !latest.Equal(second) {
+		t.Errorf("the latest snapshot changed while comparing: got %q, %v, want %q", latest, err, second)
+	}
+}
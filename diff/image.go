@@ -0,0 +1,202 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+)
+
+func init() {
+	for _, t := range []string{"image/gif", "image/jpeg", "image/png"} {
+		RegisterRenderer(t, renderImage)
+	}
+}
+
+// exifTags names the EXIF tags that are compared, keyed by tag number.
+var exifTags = map[uint16]string{
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x829a: "ExposureTime",
+	0x829d: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x920a: "FocalLength",
+}
+
+const (
+	exifIFDTag = 0x8769
+	gpsIFDTag  = 0x8825
+)
+
+func imageFields(contents []byte) (map[string]string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"format":     format,
+		"dimensions": fmt.Sprintf("%dx%d", config.Width, config.Height),
+	}
+	if format == "jpeg" {
+		// Images with malformed EXIF data can still be displayed, so just skip the EXIF fields for them.
+		if tiff := jpegEXIF(contents); tiff != nil {
+			readEXIF(tiff, fields)
+		}
+	}
+	return fields, nil
+}
+
+// renderImage lists the changes to the format, dimensions, and EXIF metadata of an image.
+func renderImage(before, after []byte) ([]string, error) {
+	beforeFields, err := imageFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := imageFields(after)
+	if err != nil {
+		return nil, err
+	}
+	return describeFields(beforeFields, afterFields), nil
+}
+
+// jpegEXIF returns the TIFF-formatted EXIF data embedded in a JPEG image, if any.
+func jpegEXIF(contents []byte) []byte {
+	if len(contents) < 2 || contents[0] != 0xff || contents[1] != 0xd8 {
+		return nil
+	}
+	for pos := 2; pos+4 <= len(contents); {
+		if contents[pos] != 0xff {
+			return nil
+		}
+		marker := contents[pos+1]
+		if marker == 0xda || marker == 0xd9 {
+			// The start of the image data, or the end of the image.
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(contents[pos+2:]))
+		if length < 2 || pos+2+length > len(contents) {
+			return nil
+		}
+		segment := contents[pos+4 : pos+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// readEXIF records the values of the known EXIF tags in the given TIFF-formatted data in `fields`.
+func readEXIF(tiff []byte, fields map[string]string) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return
+	}
+	ifds := []uint32{order.Uint32(tiff[4:])}
+	visited := make(map[uint32]bool)
+	for len(ifds) > 0 {
+		offset := ifds[0]
+		ifds = ifds[1:]
+		if visited[offset] || int64(offset)+2 > int64(len(tiff)) {
+			continue
+		}
+		visited[offset] = true
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entryStart := int64(offset) + 2 + int64(i)*12
+			if entryStart+12 > int64(len(tiff)) {
+				break
+			}
+			entry := tiff[entryStart : entryStart+12]
+			tag := order.Uint16(entry)
+			if tag == exifIFDTag {
+				ifds = append(ifds, order.Uint32(entry[8:]))
+				continue
+			}
+			if tag == gpsIFDTag {
+				fields["exif GPS"] = "present"
+				continue
+			}
+			name, ok := exifTags[tag]
+			if !ok {
+				continue
+			}
+			if value, ok := exifValue(tiff, order, entry); ok {
+				fields["exif "+name] = value
+			}
+		}
+	}
+}
+
+// exifValue formats the value of a single IFD entry.
+func exifValue(tiff []byte, order binary.ByteOrder, entry []byte) (string, bool) {
+	valueType := order.Uint16(entry[2:])
+	count := int64(order.Uint32(entry[4:]))
+	var size int64
+	switch valueType {
+	case 2: // ASCII
+		size = count
+	case 3: // SHORT
+		size = 2 * count
+	case 4: // LONG
+		size = 4 * count
+	case 5: // RATIONAL
+		size = 8 * count
+	default:
+		return "", false
+	}
+	if count == 0 {
+		return "", false
+	}
+	data := entry[8:12]
+	if size > 4 {
+		offset := int64(order.Uint32(entry[8:]))
+		if offset+size > int64(len(tiff)) {
+			return "", false
+		}
+		data = tiff[offset : offset+size]
+	}
+	switch valueType {
+	case 2:
+		return fmt.Sprintf("%q", strings.TrimRight(string(data[:count]), "\x00 ")), true
+	case 3:
+		return fmt.Sprintf("%d", order.Uint16(data)), true
+	case 4:
+		return fmt.Sprintf("%d", order.Uint32(data)), true
+	default:
+		return fmt.Sprintf("%d/%d", order.Uint32(data), order.Uint32(data[4:])), true
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// maxRenderSize is the largest file, in bytes, that is read into memory in order to render its changes.
+const maxRenderSize = 32 * 1024 * 1024
+
+// Renderer describes the changes between two versions of the contents of a file.
+//
+// It returns one line per change. An error means that one of the
+// versions could not be parsed as the expected type of file.
+type Renderer func(before, after []byte) ([]string, error)
+
+var (
+	renderers = make(map[string]Renderer)
+
+	// extensionTypes maps lower-case file name extensions to the media
+	// types of renderers, for files whose recorded content type is too
+	// generic to select a renderer, such as JSON recorded as plain text.
+	extensionTypes = make(map[string]string)
+)
+
+// RegisterRenderer registers the renderer used for files of the given media type.
+//
+// Files whose names end in one of the given extensions, such as ".json",
+// also use the renderer unless their recorded content type has a
+// renderer of its own.
+//
+// This is meant to be called during package initialization.
+func RegisterRenderer(mediaType string, r Renderer, extensions ...string) {
+	renderers[mediaType] = r
+	for _, ext := range extensions {
+		extensionTypes[strings.ToLower(ext)] = mediaType
+	}
+}
+
+// describeFields describes the differences between two flattened forms of a file.
+//
+// Each map holds the fields of one version of the file, keyed by the
+// name of the field. The returned lines are sorted by field name.
+func describeFields(before, after map[string]string) []string {
+	names := make(map[string]struct{})
+	for name := range before {
+		names[name] = struct{}{}
+	}
+	for name := range after {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, name := range sorted {
+		beforeValue, inBefore := before[name]
+		afterValue, inAfter := after[name]
+		switch {
+		case !inBefore:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", name, afterValue))
+		case !inAfter:
+			lines = append(lines, fmt.Sprintf("- %s: %s", name, beforeValue))
+		case beforeValue != afterValue:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", name, beforeValue, afterValue))
+		}
+	}
+	return lines
+}
+
+// mediaType determines the media type used to pick the renderer for the regular file `f` named `name`.
+//
+// The result is empty if no renderer applies.
+func mediaType(ctx context.Context, s *storage.LocalFiles, f *snapshot.File, name string) (string, error) {
+	contentType, recorded := f.ContentType()
+	if recorded {
+		if t, _, err := mime.ParseMediaType(contentType); err == nil && renderers[t] != nil {
+			return t, nil
+		}
+	}
+	// Extensions may contain dots themselves, as in ".tar.gz", so the longest match wins.
+	lowerName := strings.ToLower(name)
+	var matched string
+	for ext := range extensionTypes {
+		if strings.HasSuffix(lowerName, ext) && len(ext) > len(matched) {
+			matched = ext
+		}
+	}
+	if len(matched) > 0 {
+		return extensionTypes[matched], nil
+	}
+	if recorded {
+		return "", nil
+	}
+	// The snapshot predates recording content types, so detect it the same way.
+	prefix, _, err := readPrefix(ctx, s, f.Contents)
+	if err != nil {
+		return "", err
+	}
+	t, _, err := mime.ParseMediaType(http.DetectContentType(prefix))
+	if err != nil || renderers[t] == nil {
+		return "", nil
+	}
+	return t, nil
+}
+
+func readContents(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]byte, error) {
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the contents %q: %w", h, err)
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the contents %q: %w", h, err)
+	}
+	return contents, nil
+}
+
+// Render describes the changes to the contents of a modified regular
+// file using the renderer registered for its type.
+//
+// The renderer is picked by the content type recorded in the snapshot,
+// falling back to the extension of the file's name. The returned lines
+// are nil if no renderer applies, if either version is too large, or if
+// either version cannot be parsed by the renderer, so that the caller
+// can fall back to a less detailed description of the change.
+func Render(ctx context.Context, s *storage.LocalFiles, c *Change) ([]string, error) {
+	if c.BeforeFile == nil || c.AfterFile == nil {
+		return nil, nil
+	}
+	for _, f := range []*snapshot.File{c.BeforeFile, c.AfterFile} {
+		if f.IsDir() || f.IsLink() {
+			return nil, nil
+		}
+	}
+	name := filepath.Base(c.Path)
+	t, err := mediaType(ctx, s, c.AfterFile, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(t) == 0 {
+		if t, err = mediaType(ctx, s, c.BeforeFile, name); err != nil {
+			return nil, err
+		}
+	}
+	r, ok := renderers[t]
+	if !ok {
+		return nil, nil
+	}
+	var versions [][]byte
+	for _, h := range []*snapshot.Hash{c.BeforeFile.Contents, c.AfterFile.Contents} {
+		size, err := s.ObjectSize(ctx, h)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the size of %q: %w", h, err)
+		}
+		if size > maxRenderSize {
+			return nil, nil
+		}
+		contents, err := readContents(ctx, s, h)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, contents)
+	}
+	lines, err := r(versions[0], versions[1])
+	if err != nil {
+		return nil, nil
+	}
+	if len(lines) == 0 {
+		return []string{fmt.Sprintf("%s: no structural changes", t)}, nil
+	}
+	return lines, nil
+}
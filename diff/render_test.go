@@ -0,0 +1,196 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func zipArchive(t *testing.T, members map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range members {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("failure adding %q to the zip archive: %v", name, err)
+		}
+		if _, err := f.Write([]byte(contents)); err != nil {
+			t.Fatalf("failure writing %q to the zip archive: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failure closing the zip archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, members map[string]string) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for name, contents := range members {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("failure adding %q to the tar archive: %v", name, err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatalf("failure writing %q to the tar archive: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failure closing the tar archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failure encoding the example image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRenderers(t *testing.T) {
+	testCases := []struct {
+		Description string
+		MediaType   string
+		Before      []byte
+		After       []byte
+		Want        []string
+	}{
+		{
+			Description: "json",
+			MediaType:   "application/json",
+			Before:      []byte(`{"name": "app", "port": 8080, "tags": ["a", "b"], "debug": true}`),
+			After:       []byte(`{"name": "app", "port": 9090, "tags": ["a"], "log level": "info"}`),
+			Want: []string{
+				`+ .["log level"]: "info"`,
+				`- .debug: true`,
+				`~ .port: 8080 -> 9090`,
+				`- .tags[1]: "b"`,
+			},
+		},
+		{
+			Description: "json reformatted",
+			MediaType:   "application/json",
+			Before:      []byte(`{"a":[1,2]}`),
+			After:       []byte("{\n  \"a\": [\n    1,\n    2\n  ]\n}\n"),
+		},
+		{
+			Description: "yaml",
+			MediaType:   "application/yaml",
+			Before:      []byte("# Settings\nserver:\n  host: example.com\n  port: 80\nusers:\n- name: alice\n  admin: true\n- name: bob\nmotd: |\n  Hello\n  World\n"),
+			After:       []byte("server:\n  host: example.com # unchanged\n  port: 8080\nusers:\n  - name: alice\n    admin: false\nmotd: 'Hello'\n"),
+			Want: []string{
+				`~ .motd: "Hello\nWorld" -> Hello`,
+				`~ .server.port: 80 -> 8080`,
+				`~ .users[0].admin: true -> false`,
+				`- .users[1].name: bob`,
+			},
+		},
+		{
+			Description: "zip",
+			MediaType:   "application/zip",
+			Before:      zipArchive(t, map[string]string{"README": "hello", "old.txt": "old"}),
+			After:       zipArchive(t, map[string]string{"README": "hello, world", "new.txt": "new"}),
+			Want: []string{
+				"~ README: 5 bytes, crc32 3610a686 -> 12 bytes, crc32 ffab723a",
+				"+ new.txt: 3 bytes, crc32 6be34445",
+				"- old.txt: 3 bytes, crc32 3f5dd4e5",
+			},
+		},
+		{
+			Description: "tar",
+			MediaType:   "application/x-tar",
+			Before:      tarArchive(t, map[string]string{"a": "same"}),
+			After:       tarArchive(t, map[string]string{"a": "same", "odd\nname": ""}),
+			Want: []string{
+				`+ "odd\nname": 0 bytes, crc32 00000000`,
+			},
+		},
+		{
+			Description: "png",
+			MediaType:   "image/png",
+			Before:      pngImage(t, 4, 3),
+			After:       pngImage(t, 8, 6),
+			Want: []string{
+				"~ dimensions: 4x3 -> 8x6",
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		got, err := renderers[testCase.MediaType](testCase.Before, testCase.After)
+		if err != nil {
+			t.Errorf("failure rendering the test case %q: %v", testCase.Description, err)
+		} else if !reflect.DeepEqual(got, testCase.Want) {
+			t.Errorf("unexpected result for the test case %q: got %q, want %q", testCase.Description, got, testCase.Want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	root := filepath.Join(dir, "example")
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	files := map[string]string{
+		"config.json": `{"port": 80}`,
+		"notes.txt":   "first",
+	}
+	var snapshots []*snapshot.Hash
+	for _, port := range []string{"80", "8080"} {
+		files["config.json"] = `{"port": ` + port + `}`
+		files["notes.txt"] = port
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0600); err != nil {
+				t.Fatalf("failure writing the example file %q: %v", name, err)
+			}
+		}
+		h, _, err := snapshot.NewSnapshotter(s, snapshot.WithContentTypes(true)).Snapshot(ctx, snapshot.Path(root))
+		if err != nil {
+			t.Fatalf("failure snapshotting the example dir: %v", err)
+		}
+		snapshots = append(snapshots, h)
+	}
+	changes, err := Compare(ctx, s, snapshots[0], snapshots[1])
+	if err != nil {
+		t.Fatalf("failure comparing the snapshots: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if lines, err := Render(ctx, s, changes[0]); err != nil {
+		t.Errorf("failure rendering the changes to %q: %v", changes[0].Path, err)
+	} else if want := []string{"~ .port: 80 -> 8080"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("unexpected rendering of the changes to %q: got %q, want %q", changes[0].Path, lines, want)
+	}
+	if lines, err := Render(ctx, s, changes[1]); err != nil || lines != nil {
+		t.Errorf("unexpected rendering of the changes to %q: %q, %v", changes[1].Path, lines, err)
+	}
+}
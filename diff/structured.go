@@ -0,0 +1,389 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	RegisterRenderer("application/json", renderJSON, ".json")
+	RegisterRenderer("application/yaml", renderYAML, ".yaml", ".yml")
+	RegisterRenderer("application/x-yaml", renderYAML)
+	RegisterRenderer("text/yaml", renderYAML)
+}
+
+// rawScalar is a scalar value that is displayed as-is, rather than encoded as JSON.
+type rawScalar string
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// flatten records every leaf value within `v` in `fields`, keyed by its path from the root of the document.
+//
+// Paths use the "jq" style, such as `.servers[0].port`.
+func flatten(path string, v any, fields map[string]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			fields[displayField(path)] = "{}"
+		}
+		for key, child := range v {
+			if identifierPattern.MatchString(key) {
+				flatten(path+"."+key, child, fields)
+			} else {
+				flatten(displayField(path)+"["+strconv.Quote(key)+"]", child, fields)
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			fields[displayField(path)] = "[]"
+		}
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", path, i), child, fields)
+		}
+	case rawScalar:
+		value := string(v)
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			value = strconv.Quote(value)
+		}
+		fields[displayField(path)] = value
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%v", v))
+		}
+		fields[displayField(path)] = string(encoded)
+	}
+}
+
+func displayField(path string) string {
+	if len(path) == 0 {
+		return "."
+	}
+	return path
+}
+
+func decodeJSON(contents []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	// Keep numbers as written, so that large integers are compared exactly.
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	fields := make(map[string]string)
+	flatten("", v, fields)
+	return fields, nil
+}
+
+// renderJSON lists the values that were added, removed, or changed between two JSON documents.
+func renderJSON(before, after []byte) ([]string, error) {
+	beforeFields, err := decodeJSON(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := decodeJSON(after)
+	if err != nil {
+		return nil, err
+	}
+	return describeFields(beforeFields, afterFields), nil
+}
+
+// renderYAML lists the values that were added, removed, or changed between two YAML documents.
+func renderYAML(before, after []byte) ([]string, error) {
+	beforeFields, err := decodeYAML(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := decodeYAML(after)
+	if err != nil {
+		return nil, err
+	}
+	return describeFields(beforeFields, afterFields), nil
+}
+
+func decodeYAML(contents []byte) (map[string]string, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")}
+	v, err := p.parseDocument()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	flatten("", v, fields)
+	return fields, nil
+}
+
+// yamlParser parses the block-style subset of YAML that is commonly used for configuration files.
+//
+// Flow collections such as `[a, b]`, anchors, aliases, and tags are
+// kept as the text of the scalar values they appear in, rather than
+// being interpreted. Only a single document is supported.
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// stripYAMLComment removes any trailing comment from the line.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' || line[i-1] == '[' || line[i-1] == '{' || line[i-1] == ',' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// peek skips blank and comment lines, and returns the indentation and contents of the next line.
+//
+// The returned indentation is negative at the end of the document.
+func (p *yamlParser) peek() (int, string, error) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := stripYAMLComment(p.lines[p.pos])
+		text := strings.TrimLeft(line, " ")
+		if len(text) == 0 {
+			continue
+		}
+		if text[0] == '\t' {
+			return 0, "", fmt.Errorf("line %d is indented with a tab", p.pos+1)
+		}
+		return len(line) - len(text), text, nil
+	}
+	return -1, "", nil
+}
+
+func (p *yamlParser) parseDocument() (any, error) {
+	indent, text, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if indent == 0 && (text == "---" || strings.HasPrefix(text, "--- ") || strings.HasPrefix(text, "%")) {
+		for strings.HasPrefix(text, "%") {
+			p.pos++
+			if indent, text, err = p.peek(); err != nil {
+				return nil, err
+			}
+		}
+		if text != "---" {
+			return nil, fmt.Errorf("unsupported document start %q", text)
+		}
+		p.pos++
+		if indent, _, err = p.peek(); err != nil {
+			return nil, err
+		}
+	}
+	if indent < 0 {
+		return nil, nil
+	}
+	v, err := p.parseNode(indent)
+	if err != nil {
+		return nil, err
+	}
+	if indent, text, err = p.peek(); err != nil {
+		return nil, err
+	} else if indent >= 0 && text != "..." {
+		return nil, fmt.Errorf("unexpected content on line %d: %q", p.pos+1, text)
+	}
+	return v, nil
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a mapping entry into its key and value.
+func splitYAMLKey(text string) (string, string, bool) {
+	if len(text) > 0 && (text[0] == '"' || text[0] == '\'') {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return yamlScalar(text[:end+2]), strings.TrimSpace(rest[1:]), true
+	}
+	if key, value, ok := strings.Cut(text, ": "); ok {
+		return key, strings.TrimSpace(value), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSuffix(text, ":"), "", true
+	}
+	return "", "", false
+}
+
+// yamlScalar returns the value of a plain or quoted scalar.
+func yamlScalar(text string) string {
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			return unquoted
+		}
+	}
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'")
+	}
+	return text
+}
+
+// parseNode parses the node whose first line is the next line, which is indented by `indent` spaces.
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	_, text, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if isSequenceItem(text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(text); ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return rawScalar(yamlScalar(text)), nil
+}
+
+// parseValue parses the value following a mapping key or sequence item
+// that is indented by `indent` spaces, and whose inline value is `value`.
+//
+// The line holding the key or item must already have been consumed.
+// Unless `inSequence` is true, a sequence at the same indentation as
+// the key is its value, as in the common "key:\n- item" style.
+func (p *yamlParser) parseValue(indent int, value string, inSequence bool) (any, error) {
+	if len(value) > 0 && (value[0] == '|' || value[0] == '>') {
+		return p.parseBlockScalar(indent, value[0] == '>'), nil
+	}
+	if len(value) > 0 {
+		return rawScalar(yamlScalar(value)), nil
+	}
+	next, text, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if next > indent || (next == indent && !inSequence && isSequenceItem(text)) {
+		return p.parseNode(next)
+	}
+	return rawScalar(""), nil
+}
+
+// parseBlockScalar parses the lines of a literal or folded block scalar
+// that are indented by more than `indent` spaces.
+func (p *yamlParser) parseBlockScalar(indent int, folded bool) rawScalar {
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := strings.TrimRight(p.lines[p.pos], " \t")
+		text := strings.TrimLeft(line, " ")
+		lineIndent := len(line) - len(text)
+		if len(text) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		if lineIndent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if folded {
+		return rawScalar(strings.Join(lines, " "))
+	}
+	return rawScalar(strings.Join(lines, "\n"))
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	var items []any
+	for {
+		next, text, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next != indent || !isSequenceItem(text) {
+			if next > indent {
+				return nil, fmt.Errorf("unexpected indentation on line %d", p.pos+1)
+			}
+			return items, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+		var item any
+		if len(rest) == 0 || rest[0] == '|' || rest[0] == '>' {
+			p.pos++
+			if item, err = p.parseValue(indent, rest, true); err != nil {
+				return nil, err
+			}
+		} else {
+			// The item's contents start on the same line, so treat the rest of the line as if it were on a line of its own.
+			childIndent := indent + len(text) - len(rest)
+			p.lines[p.pos] = strings.Repeat(" ", childIndent) + rest
+			if item, err = p.parseNode(childIndent); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := make(map[string]any)
+	for {
+		next, text, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if next != indent || isSequenceItem(text) {
+			if next > indent {
+				return nil, fmt.Errorf("unexpected indentation on line %d", p.pos+1)
+			}
+			return m, nil
+		}
+		key, value, ok := splitYAMLKey(text)
+		if !ok {
+			return nil, fmt.Errorf("expected a mapping entry on line %d: %q", p.pos+1, text)
+		}
+		p.pos++
+		if m[key], err = p.parseValue(indent, value, false); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package duplicates finds files with identical contents in snapshots.
+package duplicates
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Group is a set of distinct paths whose files have the same contents.
+type Group struct {
+	// Contents is the hash of the shared contents.
+	Contents *snapshot.Hash
+
+	// Size is the size in bytes of the shared contents.
+	Size int64
+
+	// Paths lists the paths holding the contents, in sorted order.
+	Paths []snapshot.Path
+}
+
+// Wasted returns the number of bytes used by all but one copy of the contents.
+func (g *Group) Wasted() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+func walk(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, p snapshot.Path, byContents map[snapshot.Hash]map[snapshot.Path]struct{}) error {
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	if f.IsLink() {
+		return nil
+	}
+	if !f.IsDir() {
+		paths, ok := byContents[*f.Contents]
+		if !ok {
+			paths = make(map[snapshot.Path]struct{})
+			byContents[*f.Contents] = paths
+		}
+		paths[p] = struct{}{}
+		return nil
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return fmt.Errorf("failure listing the contents of %q: %w", h, err)
+	}
+	for child, childHash := range tree {
+		if err := walk(ctx, s, childHash, p.Join(child), byContents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the groups of regular files with identical contents in the given snapshots.
+//
+// The `roots` map is keyed by the path under which the files of each
+// snapshot are reported. The returned groups are sorted so that those
+// wasting the most space come first.
+func Find(ctx context.Context, s *storage.LocalFiles, roots map[snapshot.Path]*snapshot.Hash) ([]*Group, error) {
+	byContents := make(map[snapshot.Hash]map[snapshot.Path]struct{})
+	for p, h := range roots {
+		if err := walk(ctx, s, h, p, byContents); err != nil {
+			return nil, fmt.Errorf("failure reading the files in %q: %w", p, err)
+		}
+	}
+	var groups []*Group
+	for contents, paths := range byContents {
+		if len(paths) < 2 {
+			continue
+		}
+		contents := contents
+		size, err := s.ObjectSize(ctx, &contents)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the size of %q: %w", &contents, err)
+		}
+		g := &Group{
+			Contents: &contents,
+			Size:     size,
+		}
+		for p := range paths {
+			g.Paths = append(g.Paths, p)
+		}
+		sort.Slice(g.Paths, func(i, j int) bool {
+			return g.Paths[i] < g.Paths[j]
+		})
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
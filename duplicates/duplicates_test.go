@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package duplicates
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestFind(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a/one.txt":   "duplicated",
+		"a/two.txt":   "duplicated",
+		"a/three.txt": "unique",
+		"b/one.txt":   "duplicated",
+		"b/four.txt":  "dup",
+		"b/five.txt":  "dup",
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatalf("failure creating the parent dir of %q: %v", name, err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating the file %q: %v", name, err)
+		}
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	roots := make(map[snapshot.Path]*snapshot.Hash)
+	for _, root := range []string{"a", "b"} {
+		h, _, err := snapshot.Current(ctx, s, snapshot.Path(filepath.Join(dir, root)))
+		if err != nil {
+			t.Fatalf("failure snapshotting %q: %v", root, err)
+		}
+		roots[snapshot.Path(root)] = h
+	}
+	groups, err := Find(ctx, s, roots)
+	if err != nil {
+		t.Fatalf("failure finding duplicates: %v", err)
+	}
+	var got [][]snapshot.Path
+	for _, g := range groups {
+		got = append(got, g.Paths)
+	}
+	want := [][]snapshot.Path{
+		{"a/one.txt", "a/two.txt", "b/one.txt"},
+		{"b/five.txt", "b/four.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected duplicate groups: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filter defines content filters that transform the contents
+// of files when they are snapshotted and restored.
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const filtersConfig = "filters"
+
+// Filter is a pair of external commands that transform file contents.
+//
+// The clean command is run when a file is snapshotted, and the smudge
+// command is run when it is restored. Each command reads the input
+// contents from its standard input and writes the transformed contents
+// to its standard output, so the smudge command should be the inverse
+// of the clean command.
+type Filter struct {
+	// FilterName is the name used to refer to the filter.
+	//
+	// This is recorded in the snapshot of each file the filter is applied to.
+	FilterName string
+
+	// Pattern is matched against the base name of each file to determine
+	// whether or not the filter applies to it.
+	//
+	// The pattern syntax is that of `filepath.Match`.
+	Pattern string
+
+	// CleanCommand is the command run when snapshotting a file.
+	CleanCommand string
+
+	// SmudgeCommand is the command run when restoring a file.
+	SmudgeCommand string
+}
+
+// Name implements the `snapshot.ContentFilter` interface.
+func (f *Filter) Name() string {
+	return f.FilterName
+}
+
+// Matches implements the `snapshot.ContentFilter` interface.
+func (f *Filter) Matches(p snapshot.Path) bool {
+	matched, err := filepath.Match(f.Pattern, filepath.Base(string(p)))
+	return err == nil && matched
+}
+
+func runCommand(ctx context.Context, command string, r io.Reader, w io.Writer) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return errors.New("no command specified")
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failure running the command %q: %w", command, err)
+	}
+	return nil
+}
+
+// Clean implements the `snapshot.ContentFilter` interface.
+func (f *Filter) Clean(ctx context.Context, r io.Reader, w io.Writer) error {
+	return runCommand(ctx, f.CleanCommand, r, w)
+}
+
+// Smudge writes the restored form of the cleaned contents read from `r` to `w`.
+func (f *Filter) Smudge(ctx context.Context, r io.Reader, w io.Writer) error {
+	return runCommand(ctx, f.SmudgeCommand, r, w)
+}
+
+func (f *Filter) String() string {
+	return strings.Join([]string{f.FilterName, f.Pattern, f.CleanCommand, f.SmudgeCommand}, "\t")
+}
+
+func parseFilter(line string) (*Filter, error) {
+	parts := strings.Split(line, "\t")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("malformed filter %q", line)
+	}
+	if _, err := filepath.Match(parts[1], ""); err != nil {
+		return nil, fmt.Errorf("malformed pattern in the filter %q: %w", line, err)
+	}
+	return &Filter{
+		FilterName:    parts[0],
+		Pattern:       parts[1],
+		CleanCommand:  parts[2],
+		SmudgeCommand: parts[3],
+	}, nil
+}
+
+// ReadFilters reads the filters configured for the given archive.
+//
+// The config file has one filter per line, with the name, pattern,
+// clean command, and smudge command of the filter separated by tabs.
+// Filters are returned in the order they are configured, and the
+// first filter matching a path is the one applied to it.
+func ReadFilters(s *storage.LocalFiles) ([]*Filter, error) {
+	bs, err := s.ReadCommandConfig(filtersConfig)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured filters: %w", err)
+	}
+	var filters []*Filter
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f, err := parseFilter(line)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// Find returns the configured filter with the given name.
+func Find(s *storage.LocalFiles, name string) (*Filter, error) {
+	filters, err := ReadFilters(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		if f.FilterName == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("no filter named %q is configured", name)
+}
+
+// SnapshotOption returns an option for applying the configured filters when snapshotting.
+func SnapshotOption(s *storage.LocalFiles) (snapshot.Option, error) {
+	filters, err := ReadFilters(s)
+	if err != nil {
+		return nil, err
+	}
+	var contentFilters []snapshot.ContentFilter
+	for _, f := range filters {
+		contentFilters = append(contentFilters, f)
+	}
+	return snapshot.WithFilters(contentFilters...), nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestFilterRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("the `tr` command is not available")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := os.MkdirAll(filepath.Dir(s.ConfigFile("filters")), 0700); err != nil {
+		t.Fatalf("failure creating the config dir: %v", err)
+	}
+	config := "upper\t*.txt\ttr a-z A-Z\ttr A-Z a-z\n"
+	if err := os.WriteFile(s.ConfigFile("filters"), []byte(config), 0600); err != nil {
+		t.Fatalf("failure writing the filters config: %v", err)
+	}
+
+	file := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(file, []byte("hello, world"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		t.Fatalf("failure loading the filters: %v", err)
+	}
+	h, f, err := snapshot.NewSnapshotter(s, filterOpt).Snapshot(ctx, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if got, want := f.Metadata[snapshot.FilterMetadataKey], "upper"; got != want {
+		t.Errorf("unexpected filter recorded in the snapshot: got %q, want %q", got, want)
+	}
+	reader, err := s.ReadObject(ctx, f.Contents)
+	if err != nil {
+		t.Fatalf("failure reading the stored contents: %v", err)
+	}
+	stored, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failure reading the stored contents: %v", err)
+	}
+	if got, want := string(stored), "HELLO, WORLD"; got != want {
+		t.Errorf("unexpected stored contents: got %q, want %q", got, want)
+	}
+
+	restored := filepath.Join(dir, "restored.txt")
+	if err := merge.Extract(ctx, s, h, snapshot.Path(restored)); err != nil {
+		t.Fatalf("failure extracting the snapshot: %v", err)
+	}
+	contents, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatalf("failure reading the restored file: %v", err)
+	}
+	if got, want := string(contents), "hello, world"; got != want {
+		t.Errorf("unexpected restored contents: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsck defines methods for checking the integrity of stored snapshots.
+package fsck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Options controls which checks are performed by `Check`.
+type Options struct {
+	// Canonical enables checking that every file snapshot and directory
+	// tree is encoded in its canonical form.
+	Canonical bool
+
+	// RepairFrom lists the remotes to repair objects from.
+	//
+	// If this is not empty, then objects that are missing or whose
+	// contents do not match their hashes are fetched from the first of
+	// these remotes that has them, rewritten locally, and re-verified
+	// before the check continues.
+	RepairFrom []*remote.Remote
+}
+
+// Problem describes a single problem found with a stored object.
+type Problem struct {
+	// Path is the path, relative to the checked snapshot, at which the object was found.
+	Path snapshot.Path
+
+	// Hash is the hash of the object with the problem.
+	Hash *snapshot.Hash
+
+	// Err describes the problem.
+	Err error
+}
+
+// Repair describes an object that was repaired from a remote.
+type Repair struct {
+	Problem
+
+	// Remote is the name of the remote the object was fetched from.
+	Remote string
+}
+
+// Result summarizes the outcome of `Check`.
+type Result struct {
+	// Objects is the number of distinct objects checked.
+	Objects int
+
+	// Offloaded is the number of file contents that were not checked
+	// because they have been offloaded to a remote.
+	Offloaded int
+
+	// Problems lists the problems found, sorted by path.
+	Problems []*Problem
+
+	// Repaired lists the problems that were repaired, sorted by path.
+	Repaired []*Repair
+
+	// Inconsistent lists the paths with file snapshots that were marked
+	// as possibly inconsistent when they were taken, in sorted order.
+	Inconsistent []snapshot.Path
+}
+
+type checker struct {
+	s       *storage.LocalFiles
+	opts    Options
+	result  *Result
+	visited map[snapshot.Hash]struct{}
+
+	// inconsistent holds the paths with possibly inconsistent file snapshots.
+	inconsistent map[snapshot.Path]struct{}
+}
+
+func (c *checker) report(p snapshot.Path, h *snapshot.Hash, err error) {
+	c.result.Problems = append(c.result.Problems, &Problem{Path: p, Hash: h, Err: err})
+}
+
+// readVerified reads the given object and verifies that its contents match its hash.
+//
+// The contents are only returned if `keep` is true; otherwise they are
+// streamed through the hash without being held in memory.
+//
+// Objects that are missing or corrupt are repaired if that is enabled.
+func (c *checker) readVerified(ctx context.Context, p snapshot.Path, h *snapshot.Hash, keep bool) ([]byte, error) {
+	contents, err := c.readObject(ctx, h, keep)
+	if err == nil || len(c.opts.RepairFrom) == 0 {
+		return contents, err
+	}
+	var tiered *storage.TieredError
+	if errors.As(err, &tiered) || !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrCorrupt) {
+		// Offloaded objects are not missing, so they are not repaired.
+		return nil, err
+	}
+	r, fetchErr := remote.FetchObject(ctx, c.s, c.opts.RepairFrom, h)
+	if fetchErr != nil {
+		return nil, fmt.Errorf("%w; repair failed: %v", err, fetchErr)
+	}
+	contents, verifyErr := c.readObject(ctx, h, keep)
+	if verifyErr != nil {
+		return nil, fmt.Errorf("%w; the repaired object is still invalid: %v", err, verifyErr)
+	}
+	c.result.Repaired = append(c.result.Repaired, &Repair{
+		Problem: Problem{Path: p, Hash: h, Err: err},
+		Remote:  r.Name,
+	})
+	return contents, nil
+}
+
+// readObject reads the given object and verifies that its contents match its hash.
+//
+// The contents are only buffered and returned if `keep` is true.
+func (c *checker) readObject(ctx context.Context, h *snapshot.Hash, keep bool) ([]byte, error) {
+	reader, err := c.s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var contents bytes.Buffer
+	var r io.Reader = reader
+	if keep {
+		r = io.TeeReader(reader, &contents)
+	}
+	if got, err := snapshot.NewHash(r); err != nil {
+		return nil, fmt.Errorf("failure reading the object %q: %w", h, err)
+	} else if !got.Equal(h) {
+		return nil, fmt.Errorf("the contents of the object %q hash to %q: %w", h, got, storage.ErrCorrupt)
+	}
+	if !keep {
+		return nil, nil
+	}
+	return contents.Bytes(), nil
+}
+
+// visit records that the object `h` has been checked, and reports whether or not it was already.
+func (c *checker) visit(h *snapshot.Hash) bool {
+	if _, ok := c.visited[*h]; ok {
+		return true
+	}
+	c.visited[*h] = struct{}{}
+	c.result.Objects++
+	return false
+}
+
+// checkSnapshot checks the file snapshot `h` and returns the snapshots it references, keyed by their paths.
+func (c *checker) checkSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) (map[*snapshot.Hash]snapshot.Path, error) {
+	encoded, err := c.readVerified(ctx, p, h, true)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Canonical {
+		if err := snapshot.CheckCanonicalFile(string(encoded)); err != nil {
+			return nil, err
+		}
+	}
+	f, err := snapshot.ParseFile(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the file snapshot: %w: %v", storage.ErrCorrupt, err)
+	} else if f == nil {
+		return nil, fmt.Errorf("the file snapshot is empty: %w", storage.ErrCorrupt)
+	}
+	if _, ok := f.PossiblyInconsistent(); ok {
+		c.inconsistent[p] = struct{}{}
+	}
+	next := make(map[*snapshot.Hash]snapshot.Path)
+	for _, parent := range f.Parents {
+		next[parent] = p
+	}
+	if c.visit(f.Contents) {
+		return next, nil
+	}
+	// Only the contents of directories are parsed, so those of files and links are streamed.
+	contents, err := c.readVerified(ctx, p, f.Contents, f.IsDir())
+	var tiered *storage.TieredError
+	if errors.As(err, &tiered) && !f.IsDir() {
+		c.result.Offloaded++
+		return next, nil
+	} else if err != nil {
+		c.report(p, f.Contents, err)
+		return next, nil
+	}
+	if !f.IsDir() {
+		return next, nil
+	}
+	if c.opts.Canonical {
+		if err := snapshot.CheckCanonicalTree(string(contents)); err != nil {
+			c.report(p, f.Contents, err)
+		}
+	}
+	tree, err := snapshot.ParseTree(string(contents))
+	if err != nil {
+		c.report(p, f.Contents, fmt.Errorf("failure parsing the directory contents: %w: %v", storage.ErrCorrupt, err))
+		return next, nil
+	}
+	for child, childHash := range tree {
+		next[childHash] = p.Join(child)
+	}
+	return next, nil
+}
+
+// Check checks every object reachable from the snapshot `h`, including its entire history.
+//
+// Each object is read in full and its contents are compared to its
+// hash, and each file snapshot and directory tree is parsed. Problems
+// with individual objects are collected in the result rather than
+// stopping the check, so that every problem is found in a single pass.
+//
+// If `opts.RepairFrom` is set, then objects that are missing or corrupt
+// are repaired as they are found, and the check continues into them.
+func Check(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, opts Options) (*Result, error) {
+	c := &checker{
+		s:            s,
+		opts:         opts,
+		result:       &Result{},
+		visited:      make(map[snapshot.Hash]struct{}),
+		inconsistent: make(map[snapshot.Path]struct{}),
+	}
+	type entry struct {
+		p snapshot.Path
+		h *snapshot.Hash
+	}
+	queue := []entry{{h: h}}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		next := queue[0]
+		queue = queue[1:]
+		if next.h == nil || c.visit(next.h) {
+			continue
+		}
+		references, err := c.checkSnapshot(ctx, next.p, next.h)
+		if err != nil {
+			c.report(next.p, next.h, err)
+			continue
+		}
+		for refHash, refPath := range references {
+			queue = append(queue, entry{p: refPath, h: refHash})
+		}
+	}
+	sort.SliceStable(c.result.Problems, func(i, j int) bool {
+		return c.result.Problems[i].Path < c.result.Problems[j].Path
+	})
+	sort.SliceStable(c.result.Repaired, func(i, j int) bool {
+		return c.result.Repaired[i].Path < c.result.Repaired[j].Path
+	})
+	for p := range c.inconsistent {
+		c.result.Inconsistent = append(c.result.Inconsistent, p)
+	}
+	sort.Slice(c.result.Inconsistent, func(i, j int) bool {
+		return c.result.Inconsistent[i] < c.result.Inconsistent[j]
+	})
+	return c.result, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsck
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for name, contents := range map[string]string{"a.txt": "a", "b.txt": "b", "sub/c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	result, err := Check(ctx, s, h, Options{Canonical: true})
+	if err != nil {
+		t.Fatalf("failure checking the snapshot: %v", err)
+	}
+	if len(result.Problems) > 0 {
+		t.Errorf("unexpected problems in a valid snapshot: %+v", result.Problems)
+	}
+	// Three files, two directories, and the contents of each.
+	if got, want := result.Objects, 10; got != want {
+		t.Errorf("unexpected number of objects checked: got %d, want %d", got, want)
+	}
+
+	// A directory listing that is valid but not canonical.
+	cHash, _, err := s.FindSnapshot(ctx, snapshot.Path(filepath.Join(src, "sub", "c.txt")))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of an example file: %v", err)
+	}
+	tree := snapshot.Tree{snapshot.Path("x"): cHash, snapshot.Path("y"): cHash}
+	lines := strings.Split(tree.String(), "\n")
+	lines[0], lines[1] = lines[1], lines[0]
+	treeHash, err := s.StoreObject(ctx, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("failure storing the non-canonical tree: %v", err)
+	}
+	dirHash, err := s.StoreObject(ctx, strings.NewReader((&snapshot.File{Mode: "drwx------", Contents: treeHash}).String()))
+	if err != nil {
+		t.Fatalf("failure storing the non-canonical directory: %v", err)
+	}
+	if result, err := Check(ctx, s, dirHash, Options{}); err != nil {
+		t.Fatalf("failure checking the non-canonical directory: %v", err)
+	} else if len(result.Problems) > 0 {
+		t.Errorf("unexpected problems without checking for canonical encodings: %+v", result.Problems)
+	}
+	if result, err := Check(ctx, s, dirHash, Options{Canonical: true}); err != nil {
+		t.Fatalf("failure checking the non-canonical directory: %v", err)
+	} else if len(result.Problems) != 1 || !errors.Is(result.Problems[0].Err, snapshot.ErrNotCanonical) {
+		t.Errorf("unexpected problems for the non-canonical directory: %+v", result.Problems)
+	}
+
+	// Corrupt the contents of one of the files.
+	_, bFile, err := s.FindSnapshot(ctx, snapshot.Path(filepath.Join(src, "b.txt")))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of an example file: %v", err)
+	}
+	hex := bFile.Contents.HexContents()
+	objectPath := filepath.Join(s.ArchiveDir, "objects", bFile.Contents.Function(), hex[0:2], hex[2:4], hex[4:])
+	if err := os.Chmod(objectPath, 0600); err != nil {
+		t.Fatalf("failure making the object %q writable: %v", objectPath, err)
+	}
+	if err := os.WriteFile(objectPath, []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("failure corrupting the object %q: %v", objectPath, err)
+	}
+	result, err = Check(ctx, s, h, Options{})
+	if err != nil {
+		t.Fatalf("failure checking the corrupted snapshot: %v", err)
+	}
+	if len(result.Problems) != 1 {
+		t.Fatalf("unexpected problems for the corrupted snapshot: %+v", result.Problems)
+	}
+	if got, want := result.Problems[0].Path, snapshot.Path("b.txt"); got != want {
+		t.Errorf("unexpected path for the corrupted object: got %q, want %q", got, want)
+	}
+	if !errors.Is(result.Problems[0].Err, storage.ErrCorrupt) {
+		t.Errorf("unexpected error for the corrupted object: %v", result.Problems[0].Err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for name, contents := range map[string]string{"a.txt": "a", "sub/c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	r := &remote.Remote{Name: "backup", ArchiveDir: filepath.Join(dir, "backup")}
+	if _, _, err := remote.Push(ctx, s, r, snapshot.Path(src)); err != nil {
+		t.Fatalf("failure pushing the example directory: %v", err)
+	}
+
+	objectPath := func(h *snapshot.Hash) string {
+		hex := h.HexContents()
+		return filepath.Join(s.ArchiveDir, "objects", h.Function(), hex[0:2], hex[2:4], hex[4:])
+	}
+	// Corrupt the contents of one file, and remove the snapshot of the
+	// subdirectory so that its contents cannot be reached without a repair.
+	_, aFile, err := s.FindSnapshot(ctx, snapshot.Path(filepath.Join(src, "a.txt")))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of an example file: %v", err)
+	}
+	if err := os.Chmod(objectPath(aFile.Contents), 0600); err != nil {
+		t.Fatalf("failure making an object writable: %v", err)
+	}
+	if err := os.WriteFile(objectPath(aFile.Contents), []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("failure corrupting an object: %v", err)
+	}
+	subHash, _, err := s.FindSnapshot(ctx, snapshot.Path(filepath.Join(src, "sub")))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of the example subdirectory: %v", err)
+	}
+	if err := os.Remove(objectPath(subHash)); err != nil {
+		t.Fatalf("failure removing an object: %v", err)
+	}
+
+	if result, err := Check(ctx, s, h, Options{}); err != nil {
+		t.Fatalf("failure checking the damaged snapshot: %v", err)
+	} else if len(result.Problems) != 2 {
+		t.Errorf("unexpected problems for the damaged snapshot: %+v", result.Problems)
+	}
+	result, err := Check(ctx, s, h, Options{RepairFrom: []*remote.Remote{r}})
+	if err != nil {
+		t.Fatalf("failure repairing the damaged snapshot: %v", err)
+	}
+	if len(result.Problems) > 0 {
+		t.Errorf("unexpected problems after repairing: %+v", result.Problems)
+	}
+	if len(result.Repaired) != 2 {
+		t.Fatalf("unexpected repairs: %+v", result.Repaired)
+	}
+	if got, want := result.Repaired[0].Path, snapshot.Path("a.txt"); got != want || !errors.Is(result.Repaired[0].Err, storage.ErrCorrupt) {
+		t.Errorf("unexpected first repair: %+v", result.Repaired[0])
+	}
+	if got, want := result.Repaired[1].Path, snapshot.Path("sub"); got != want || !errors.Is(result.Repaired[1].Err, storage.ErrNotFound) {
+		t.Errorf("unexpected second repair: %+v", result.Repaired[1])
+	}
+	if result.Repaired[0].Remote != r.Name {
+		t.Errorf("unexpected remote for the repair: got %q, want %q", result.Repaired[0].Remote, r.Name)
+	}
+	// Every object from the subdirectory was checked once it was repaired.
+	if got, want := result.Objects, 8; got != want {
+		t.Errorf("unexpected number of objects checked: got %d, want %d", got, want)
+	}
+	if result, err := Check(ctx, s, h, Options{}); err != nil {
+		t.Fatalf("failure checking the repaired snapshot: %v", err)
+	} else if len(result.Problems) > 0 || len(result.Repaired) > 0 {
+		t.Errorf("unexpected problems in the repaired snapshot: %+v", result.Problems)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health records whether the snapshots of each path are succeeding.
+//
+// Snapshots taken in the background by a service have nobody watching
+// their output, so they can keep failing unnoticed. The recorded state
+// lets wrapper scripts and monitoring detect that.
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// stateConfig is the name of the archive config file holding the recorded outcomes of snapshots.
+//
+// The file is only ever appended to, one record per line, so that
+// snapshots recorded at the same time by separate processes do not
+// overwrite each other.
+const stateConfig = "health"
+
+// State is the recorded health of the snapshots of a single path.
+type State struct {
+	// Path is the absolute path that was snapshotted.
+	Path snapshot.Path `json:"path"`
+
+	// LastSuccess is the time that the latest successful snapshot finished, or zero if there has been none.
+	LastSuccess time.Time `json:"last-success"`
+
+	// LastFailure is the time that the latest failed snapshot finished, or zero if there has been none.
+	LastFailure time.Time `json:"last-failure"`
+
+	// LastError describes why the latest failed snapshot failed.
+	LastError string `json:"last-error,omitempty"`
+
+	// ConsecutiveFailures is the number of snapshots that failed since the latest successful one.
+	ConsecutiveFailures int `json:"consecutive-failures"`
+}
+
+// Problem describes what is wrong with the snapshots of the path, or returns the empty string if nothing is.
+//
+// A path is unhealthy if its latest snapshot failed, or if `maxAge` is
+// positive and there has been no successful snapshot within that long
+// before `now`.
+func (st *State) Problem(maxAge time.Duration, now time.Time) string {
+	if st.ConsecutiveFailures > 0 {
+		return fmt.Sprintf("the last %d snapshots failed", st.ConsecutiveFailures)
+	}
+	if maxAge <= 0 {
+		return ""
+	}
+	if st.LastSuccess.IsZero() {
+		return "has never been snapshotted successfully"
+	}
+	if age := now.Sub(st.LastSuccess); age > maxAge {
+		return fmt.Sprintf("was last snapshotted successfully %v ago", age.Round(time.Second))
+	}
+	return ""
+}
+
+// record is the outcome of a single snapshot of a path.
+type record struct {
+	// Path is the absolute path that was snapshotted.
+	Path snapshot.Path `json:"path"`
+
+	// Time is when the snapshot finished.
+	Time time.Time `json:"time"`
+
+	// Error describes why the snapshot failed, or is empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Read returns the health recorded for each path in the given archive.
+func Read(s *storage.LocalFiles) (map[snapshot.Path]*State, error) {
+	bs, err := os.ReadFile(s.ConfigFile(stateConfig))
+	if os.IsNotExist(err) {
+		return make(map[snapshot.Path]*State), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the health state: %w", err)
+	}
+	states := make(map[snapshot.Path]*State)
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	for dec.More() {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("failure parsing the health state: %w", err)
+		}
+		st, ok := states[r.Path]
+		if !ok {
+			st = &State{Path: r.Path}
+			states[r.Path] = st
+		}
+		if len(r.Error) == 0 {
+			st.LastSuccess = r.Time
+			st.ConsecutiveFailures = 0
+		} else {
+			st.LastFailure = r.Time
+			st.LastError = r.Error
+			st.ConsecutiveFailures++
+		}
+	}
+	return states, nil
+}
+
+// appendRecord adds the record `r` to the end of the recorded outcomes.
+func appendRecord(s *storage.LocalFiles, r *record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failure encoding the health state: %w", err)
+	}
+	stateFile := s.ConfigFile(stateConfig)
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0700); err != nil {
+		return fmt.Errorf("failure creating the config dir: %w", err)
+	}
+	out, err := os.OpenFile(stateFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failure opening the health state: %w", err)
+	}
+	// The record is written in a single call so that concurrent appends are not interleaved.
+	if _, err := out.Write(append(line, '\n')); err != nil {
+		out.Close()
+		return fmt.Errorf("failure writing the health state: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure writing the health state: %w", err)
+	}
+	return nil
+}
+
+// RecordSuccess records that a snapshot of the path `p` succeeded at the time `t`.
+func RecordSuccess(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, t time.Time) error {
+	return appendRecord(s, &record{Path: p, Time: t.UTC()})
+}
+
+// RecordFailure records that a snapshot of the path `p` failed at the time `t`, with the given reason.
+func RecordFailure(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, t time.Time, reason string) error {
+	if len(reason) == 0 {
+		reason = "the snapshot failed"
+	}
+	return appendRecord(s, &record{Path: p, Time: t.UTC(), Error: reason})
+}
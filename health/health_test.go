@@ -0,0 +1,109 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	p, other := snapshot.Path(filepath.Join(dir, "a")), snapshot.Path(filepath.Join(dir, "b"))
+	start := time.Unix(1000, 0).UTC()
+
+	if err := RecordSuccess(ctx, s, p, start); err != nil {
+		t.Fatalf("failure recording a successful snapshot: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := RecordFailure(ctx, s, p, start.Add(time.Duration(i)*time.Minute), "disk full"); err != nil {
+			t.Fatalf("failure recording a failed snapshot: %v", err)
+		}
+	}
+	if err := RecordFailure(ctx, s, other, start, "no such file"); err != nil {
+		t.Fatalf("failure recording a failed snapshot: %v", err)
+	}
+	states, err := Read(s)
+	if err != nil {
+		t.Fatalf("failure reading the health state: %v", err)
+	}
+	want := State{
+		Path:                p,
+		LastSuccess:         start,
+		LastFailure:         start.Add(2 * time.Minute),
+		LastError:           "disk full",
+		ConsecutiveFailures: 2,
+	}
+	if got := states[p]; got == nil || *got != want {
+		t.Errorf("unexpected health state: got %+v, want %+v", got, want)
+	}
+	if got := states[other]; got == nil || got.ConsecutiveFailures != 1 || !got.LastSuccess.IsZero() {
+		t.Errorf("unexpected health state for a path that never succeeded: %+v", got)
+	}
+	if problem := states[p].Problem(0, start); len(problem) == 0 {
+		t.Errorf("missing problem for a path whose snapshots are failing")
+	}
+
+	if err := RecordSuccess(ctx, s, p, start.Add(time.Hour)); err != nil {
+		t.Fatalf("failure recording a successful snapshot: %v", err)
+	}
+	if states, err = Read(s); err != nil {
+		t.Fatalf("failure rereading the health state: %v", err)
+	}
+	st := states[p]
+	if st.ConsecutiveFailures != 0 || st.LastError != "disk full" || !st.LastSuccess.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected health state after recovering: %+v", st)
+	}
+	if problem := st.Problem(time.Hour, start.Add(90*time.Minute)); len(problem) != 0 {
+		t.Errorf("unexpected problem for a recent snapshot: %q", problem)
+	}
+	if problem := st.Problem(time.Hour, start.Add(3*time.Hour)); len(problem) == 0 {
+		t.Errorf("missing problem for an old snapshot")
+	}
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	p := snapshot.Path(filepath.Join(dir, "a"))
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := RecordFailure(ctx, s, p, time.Now(), "disk full"); err != nil {
+				t.Errorf("failure recording a failed snapshot: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	states, err := Read(s)
+	if err != nil {
+		t.Fatalf("failure reading the health state: %v", err)
+	}
+	if got := states[p]; got == nil || got.ConsecutiveFailures != count {
+		t.Errorf("unexpected health state after concurrent failures: got %+v, want %d consecutive failures", got, count)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package index defines an optional index of snapshot metadata that can be queried.
+//
+// When the index is enabled, every snapshot generated by the "snapshot"
+// subcommand is recorded in it along with the number of files and the
+// total size of the snapshotted path, and the number of bytes of new
+// data that the snapshot added to the archive. This makes it possible
+// to answer questions about the history of an archive, such as which
+// snapshots added the most data, without walking every snapshot.
+//
+// The index is stored as a config file of the archive, with one line
+// per snapshot of the form:
+//
+//	<TIME> <HASH> <FILES> <SIZE> <NEW-BYTES> <QUOTED-PATH>
+//
+// where <TIME> is in RFC 3339 format, and the remaining numbers are in decimal.
+//
+// Separately, an optional reverse index of objects records every path
+// and snapshot that each object, such as the contents of a file, has
+// appeared in. This answers questions about where a file came from.
+// A similar index of file names answers questions about which files
+// have ever existed, such as every key file in any snapshot.
+package index
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// indexConfig is the name of the archive config file holding the index.
+const indexConfig = "snapshot-index"
+
+// Entry is the indexed metadata of a single snapshot.
+type Entry struct {
+	// Path is the path that was snapshotted.
+	Path snapshot.Path
+
+	// Hash is the hash of the snapshot.
+	Hash *snapshot.Hash
+
+	// Time is the time that the snapshot was generated.
+	Time time.Time
+
+	// Files is the number of files in the snapshot, excluding directories.
+	Files int64
+
+	// Size is the total size in bytes of the contents of the files in the snapshot.
+	//
+	// Files with identical contents are each counted, so this is the
+	// amount of data that restoring the snapshot writes rather than the
+	// space it takes in the archive, where identical contents are only
+	// stored once.
+	Size int64
+
+	// NewBytes is the number of bytes of new data that the snapshot added to the archive.
+	NewBytes int64
+}
+
+func (e *Entry) String() string {
+	return strings.Join([]string{
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.Hash.String(),
+		strconv.FormatInt(e.Files, 10),
+		strconv.FormatInt(e.Size, 10),
+		strconv.FormatInt(e.NewBytes, 10),
+		strconv.Quote(string(e.Path)),
+	}, " ")
+}
+
+func parseEntry(line string) (*Entry, error) {
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed index entry %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed time in the index entry %q: %w", line, err)
+	}
+	h, err := snapshot.ParseHash(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed hash in the index entry %q: %w", line, err)
+	}
+	e := &Entry{Hash: h, Time: t}
+	for i, count := range []*int64{&e.Files, &e.Size, &e.NewBytes} {
+		n, err := strconv.ParseInt(fields[i+2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed count in the index entry %q: %w", line, err)
+		}
+		*count = n
+	}
+	p, err := strconv.Unquote(fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("malformed path in the index entry %q: %w", line, err)
+	}
+	e.Path = snapshot.Path(p)
+	return e, nil
+}
+
+// Enabled reports whether or not the index is enabled for the given archive.
+func Enabled(s *storage.LocalFiles) bool {
+	_, err := os.Stat(s.ConfigFile(indexConfig))
+	return err == nil
+}
+
+// Enable starts indexing the snapshots generated for the given archive.
+//
+// Snapshots generated before the index was enabled are not indexed.
+// Enabling an already enabled index has no effect.
+func Enable(ctx context.Context, s *storage.LocalFiles) error {
+	if Enabled(s) {
+		return nil
+	}
+	if err := s.WriteConfigFile(ctx, indexConfig, nil); err != nil {
+		return fmt.Errorf("failure creating the snapshot index: %w", err)
+	}
+	return nil
+}
+
+// Disable stops indexing snapshots for the given archive, and removes the index.
+func Disable(ctx context.Context, s *storage.LocalFiles) error {
+	if err := os.Remove(s.ConfigFile(indexConfig)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure removing the snapshot index: %w", err)
+	}
+	return nil
+}
+
+// maxEntrySearch is the number of bytes at the end of the index that
+// are searched for the entry of the previous snapshot of a path.
+//
+// Snapshots whose previous snapshot was indexed longer ago than that
+// are measured in full instead.
+const maxEntrySearch = 1 << 20
+
+// findEntry returns the latest entry in the index for the snapshot `h` of the path `p`, or nil if there is none.
+//
+// The index is read backwards from its end, since the previous snapshot
+// of a path was usually indexed recently, and at most `maxEntrySearch`
+// bytes are read.
+func findEntry(s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash) (*Entry, error) {
+	in, err := os.Open(s.ConfigFile(indexConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the snapshot index: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the size of the snapshot index: %w", err)
+	}
+	start := info.Size() - maxEntrySearch
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, info.Size()-start)
+	if _, err := in.ReadAt(tail, start); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failure reading the snapshot index: %w", err)
+	}
+	lines := strings.Split(string(tail), "\n")
+	if start > 0 {
+		// The first line is probably only the end of an entry.
+		lines = lines[1:]
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if len(lines[i]) == 0 {
+			continue
+		}
+		e, err := parseEntry(lines[i])
+		if err != nil {
+			return nil, err
+		}
+		if e.Path == p && e.Hash.Equal(h) {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// measure returns the number of files in the snapshot `h`, and the total size of their contents.
+func measure(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File) (files, size int64, err error) {
+	if f.IsDir() {
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failure listing the contents of %q: %w", h, err)
+		}
+		for p, childHash := range tree {
+			child, err := s.ReadSnapshot(ctx, childHash)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failure reading the snapshot of %q: %w", p, err)
+			}
+			childFiles, childSize, err := measure(ctx, s, childHash, child)
+			if err != nil {
+				return 0, 0, err
+			}
+			files += childFiles
+			size += childSize
+		}
+		return files, size, nil
+	}
+	if f.IsLink() || f.Contents == nil {
+		return 1, 0, nil
+	}
+	contentsSize, err := s.ObjectSize(ctx, f.Contents)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failure reading the size of the contents %q: %w", f.Contents, err)
+	}
+	return 1, contentsSize, nil
+}
+
+// measureChanges returns the change in the number of files, and in the
+// total size of their contents, from the snapshot `prev` to the snapshot `h`.
+//
+// Only the subtrees that differ between the two snapshots are read.
+func measureChanges(ctx context.Context, s *storage.LocalFiles, prevHash *snapshot.Hash, prev *snapshot.File, h *snapshot.Hash, f *snapshot.File) (files, size int64, err error) {
+	if prevHash.Equal(h) {
+		return 0, 0, nil
+	}
+	if !prev.IsDir() || !f.IsDir() {
+		prevFiles, prevSize, err := measure(ctx, s, prevHash, prev)
+		if err != nil {
+			return 0, 0, err
+		}
+		files, size, err := measure(ctx, s, h, f)
+		if err != nil {
+			return 0, 0, err
+		}
+		return files - prevFiles, size - prevSize, nil
+	}
+	prevTree, err := s.ListDirectorySnapshotContents(ctx, prevHash, prev)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failure listing the contents of %q: %w", prevHash, err)
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failure listing the contents of %q: %w", h, err)
+	}
+	for p, childHash := range tree {
+		prevChildHash, ok := prevTree[p]
+		if ok && prevChildHash.Equal(childHash) {
+			continue
+		}
+		child, err := s.ReadSnapshot(ctx, childHash)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failure reading the snapshot of %q: %w", p, err)
+		}
+		var childFiles, childSize int64
+		if ok {
+			prevChild, err := s.ReadSnapshot(ctx, prevChildHash)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failure reading the previous snapshot of %q: %w", p, err)
+			}
+			childFiles, childSize, err = measureChanges(ctx, s, prevChildHash, prevChild, childHash, child)
+		} else {
+			childFiles, childSize, err = measure(ctx, s, childHash, child)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		files += childFiles
+		size += childSize
+	}
+	for p, prevChildHash := range prevTree {
+		if _, ok := tree[p]; ok {
+			continue
+		}
+		prevChild, err := s.ReadSnapshot(ctx, prevChildHash)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failure reading the previous snapshot of %q: %w", p, err)
+		}
+		childFiles, childSize, err := measure(ctx, s, prevChildHash, prevChild)
+		if err != nil {
+			return 0, 0, err
+		}
+		files -= childFiles
+		size -= childSize
+	}
+	return files, size, nil
+}
+
+// measureSince returns the number of files in the snapshot `h` of the path `p`, and the total size of their contents.
+//
+// If the previous snapshot of `p` is in the index, then only the
+// subtrees that changed since it are read.
+func measureSince(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash, f *snapshot.File) (files, size int64, err error) {
+	if len(f.Parents) == 0 {
+		return measure(ctx, s, h, f)
+	}
+	prevEntry, err := findEntry(s, p, f.Parents[0])
+	if err != nil {
+		return 0, 0, err
+	} else if prevEntry == nil {
+		return measure(ctx, s, h, f)
+	}
+	prev, err := s.ReadSnapshot(ctx, f.Parents[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("failure reading the previous snapshot %q: %w", f.Parents[0], err)
+	}
+	files, size, err = measureChanges(ctx, s, f.Parents[0], prev, h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return prevEntry.Files + files, prevEntry.Size + size, nil
+}
+
+// Record adds the snapshot `h` of the path `p` to the index, if it is enabled.
+//
+// The `newBytes` argument is the number of bytes of new data that the
+// snapshot added to the archive.
+func Record(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash, f *snapshot.File, newBytes int64) error {
+	if !Enabled(s) {
+		return nil
+	}
+	files, size, err := measureSince(ctx, s, p, h, f)
+	if err != nil {
+		return fmt.Errorf("failure measuring the snapshot %q: %w", h, err)
+	}
+	t, ok := f.Time()
+	if !ok {
+		t = time.Now()
+	}
+	e := &Entry{
+		Path:     p,
+		Hash:     h,
+		Time:     t,
+		Files:    files,
+		Size:     size,
+		NewBytes: newBytes,
+	}
+	out, err := os.OpenFile(s.ConfigFile(indexConfig), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failure opening the snapshot index: %w", err)
+	}
+	if _, err := fmt.Fprintln(out, e); err != nil {
+		out.Close()
+		return fmt.Errorf("failure updating the snapshot index: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure updating the snapshot index: %w", err)
+	}
+	return nil
+}
+
+// Read reads every entry in the index, in the order they were recorded.
+func Read(s *storage.LocalFiles) ([]*Entry, error) {
+	bs, err := os.ReadFile(s.ConfigFile(indexConfig))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("the snapshot index is not enabled: %w", storage.ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot index: %w", err)
+	}
+	var entries []*Entry
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		e, err := parseEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
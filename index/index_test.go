@@ -0,0 +1,192 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	docs := filepath.Join(dir, "docs")
+	photos := filepath.Join(dir, "photos")
+	for _, p := range []string{docs, photos} {
+		if err := os.MkdirAll(p, 0700); err != nil {
+			t.Fatalf("failure creating the example directory %q: %v", p, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(docs, "a.txt"), []byte("first document"), 0600); err != nil {
+		t.Fatalf("failure creating an example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "b.txt"), []byte("first document"), 0600); err != nil {
+		t.Fatalf("failure creating an example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(photos, "large.bin"), make([]byte, 4096), 0600); err != nil {
+		t.Fatalf("failure creating an example file: %v", err)
+	}
+
+	if _, err := Read(s); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected result reading a disabled index: %v", err)
+	}
+	if err := Enable(ctx, s); err != nil {
+		t.Fatalf("failure enabling the index: %v", err)
+	}
+	for _, p := range []string{docs, photos} {
+		h, f, err := snapshot.Current(ctx, s, snapshot.Path(p))
+		if err != nil {
+			t.Fatalf("failure snapshotting %q: %v", p, err)
+		}
+		if err := Record(ctx, s, snapshot.Path(p), h, f, 123); err != nil {
+			t.Fatalf("failure indexing the snapshot of %q: %v", p, err)
+		}
+	}
+	entries, err := Read(s)
+	if err != nil {
+		t.Fatalf("failure reading the index: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected number of index entries: %d", len(entries))
+	}
+	if e := entries[0]; e.Path != snapshot.Path(docs) || e.Files != 2 || e.Size != int64(2*len("first document")) || e.NewBytes != 123 {
+		t.Errorf("unexpected index entry for the documents: %+v", e)
+	}
+	if e := entries[1]; e.Path != snapshot.Path(photos) || e.Files != 1 || e.Size != 4096 {
+		t.Errorf("unexpected index entry for the photos: %+v", e)
+	}
+
+	testCases := []struct {
+		conditions []string
+		want       []snapshot.Path
+	}{
+		{
+			want: []snapshot.Path{snapshot.Path(docs), snapshot.Path(photos)},
+		},
+		{
+			conditions: []string{"size>4KB"},
+			want:       []snapshot.Path{snapshot.Path(photos)},
+		},
+		{
+			conditions: []string{"size>=4KiB", "files<2"},
+			want:       []snapshot.Path{snapshot.Path(photos)},
+		},
+		{
+			conditions: []string{"path~" + dir, "files=2"},
+			want:       []snapshot.Path{snapshot.Path(docs)},
+		},
+		{
+			conditions: []string{"path~" + docs + "x"},
+		},
+		{
+			conditions: []string{"time<2000-01-01"},
+		},
+		{
+			conditions: []string{"new!=123"},
+		},
+	}
+	for _, tc := range testCases {
+		var conditions []*Condition
+		for _, arg := range tc.conditions {
+			c, err := ParseCondition(arg)
+			if err != nil {
+				t.Fatalf("failure parsing the condition %q: %v", arg, err)
+			}
+			conditions = append(conditions, c)
+		}
+		var got []snapshot.Path
+		for _, e := range Query(entries, conditions) {
+			got = append(got, e.Path)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("unexpected results for %q: got %q, want %q", tc.conditions, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("unexpected results for %q: got %q, want %q", tc.conditions, got, tc.want)
+				break
+			}
+		}
+	}
+
+	for _, invalid := range []string{"size", "=5", "color=red", "size~5", "files>many"} {
+		if _, err := ParseCondition(invalid); err == nil {
+			t.Errorf("unexpectedly parsed the invalid condition %q", invalid)
+		}
+	}
+}
+
+func TestRecordMeasuresChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	docs := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(filepath.Join(docs, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	files := map[string]string{
+		"a.txt":         "first",
+		"b.txt":         "second",
+		"sub/c.txt":     "third",
+		"sub/other.txt": "fourth",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(docs, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	if err := Enable(ctx, s); err != nil {
+		t.Fatalf("failure enabling the index: %v", err)
+	}
+	record := func() *Entry {
+		h, f, err := snapshot.Current(ctx, s, snapshot.Path(docs))
+		if err != nil {
+			t.Fatalf("failure snapshotting %q: %v", docs, err)
+		}
+		if err := Record(ctx, s, snapshot.Path(docs), h, f, 0); err != nil {
+			t.Fatalf("failure indexing the snapshot of %q: %v", docs, err)
+		}
+		e, err := findEntry(s, snapshot.Path(docs), h)
+		if err != nil || e == nil {
+			t.Fatalf("failure finding the index entry for %q: %+v, %v", h, e, err)
+		}
+		return e
+	}
+	if e := record(); e.Files != 4 || e.Size != int64(len("firstsecondthirdfourth")) {
+		t.Errorf("unexpected index entry for the first snapshot: %+v", e)
+	}
+
+	// Update one file, remove another, and add a third.
+	if err := os.WriteFile(filepath.Join(docs, "sub", "c.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatalf("failure updating an example file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(docs, "b.txt")); err != nil {
+		t.Fatalf("failure removing an example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "new.txt"), []byte("new"), 0600); err != nil {
+		t.Fatalf("failure adding an example file: %v", err)
+	}
+	if e := record(); e.Files != 4 || e.Size != int64(len("firstchangedfourthnew")) {
+		t.Errorf("unexpected index entry for the updated snapshot: %+v", e)
+	}
+}
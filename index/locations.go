@@ -0,0 +1,338 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// locationIndex is an optional index of the paths at which file snapshots appeared in the history of the snapshotted paths.
+//
+// Each index is stored as a config file of the archive, with one line per location.
+type locationIndex struct {
+	// config is the name of the archive config file holding the index.
+	config string
+
+	// description names the index in error messages.
+	description string
+
+	// format returns the line recorded for a location, without the trailing newline.
+	format func(*Location) string
+
+	// parse parses a line written by `format`.
+	parse func(string) (*Location, error)
+}
+
+func (li *locationIndex) enabled(s *storage.LocalFiles) bool {
+	_, err := os.Stat(s.ConfigFile(li.config))
+	return err == nil
+}
+
+// enable starts maintaining the index, after indexing the history of every path that has already been snapshotted.
+func (li *locationIndex) enable(ctx context.Context, s *storage.LocalFiles) error {
+	if li.enabled(s) {
+		return nil
+	}
+	tracked, err := s.TrackedPaths(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	var locations []*Location
+	for _, p := range tracked {
+		h, _, err := s.FindSnapshot(ctx, p)
+		if err != nil {
+			return fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+		}
+		history, err := ancestors(ctx, s, h)
+		if err != nil {
+			return err
+		}
+		// Index the oldest snapshots first, so that each file is recorded with the root it first appeared in.
+		for i := len(history) - 1; i >= 0; i-- {
+			found, err := findLocations(ctx, s, p, history[i], history[i], nil, seen)
+			if err != nil {
+				return err
+			}
+			locations = append(locations, found...)
+		}
+	}
+	if err := s.WriteConfigFile(ctx, li.config, []byte(li.formatAll(locations))); err != nil {
+		return fmt.Errorf("failure creating the %s: %w", li.description, err)
+	}
+	return nil
+}
+
+// disable stops maintaining the index, and removes it.
+func (li *locationIndex) disable(ctx context.Context, s *storage.LocalFiles) error {
+	if err := os.Remove(s.ConfigFile(li.config)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure removing the %s: %w", li.description, err)
+	}
+	return nil
+}
+
+func (li *locationIndex) formatAll(locations []*Location) string {
+	var lines []string
+	for _, l := range locations {
+		lines = append(lines, li.format(l)+"\n")
+	}
+	return strings.Join(lines, "")
+}
+
+func (li *locationIndex) read(s *storage.LocalFiles) ([]*Location, error) {
+	bs, err := os.ReadFile(s.ConfigFile(li.config))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("the %s is not enabled: %w", li.description, storage.ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the %s: %w", li.description, err)
+	}
+	// A file snapshot that reappears at a path after being removed
+	// from it is recorded again, so only the first location is kept.
+	seen := make(map[string]struct{})
+	var locations []*Location
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		l, err := li.parse(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[l.key()]; ok {
+			continue
+		}
+		seen[l.key()] = struct{}{}
+		locations = append(locations, l)
+	}
+	return locations, nil
+}
+
+// record adds the locations in the snapshot `h` of the path `p` to the index, if it is enabled.
+//
+// The path `p` previously had the snapshot `prev`, which may be nil.
+// Every snapshot in the history of `h` that is not in the history of
+// `prev` is indexed, so that snapshots merged, pulled, or imported into
+// the history of `p` are found too. Only the parts of each snapshot that
+// differ from its parents are read, and the existing index is not read
+// at all, since the history of `prev` was indexed when it was recorded.
+func (li *locationIndex) record(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, prev, h *snapshot.Hash) error {
+	if !li.enabled(s) {
+		return nil
+	}
+	history, err := newHistory(ctx, s, prev, h)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	var locations []*Location
+	// Index the oldest snapshots first, so that each file is recorded with the root it first appeared in.
+	for i := len(history) - 1; i >= 0; i-- {
+		f, err := s.ReadSnapshot(ctx, history[i])
+		if err != nil {
+			return fmt.Errorf("failure reading the snapshot %q: %w", history[i], err)
+		}
+		found, err := findLocations(ctx, s, p, history[i], history[i], f.Parents, seen)
+		if err != nil {
+			return fmt.Errorf("failure indexing the files in %q: %w", history[i], err)
+		}
+		locations = append(locations, found...)
+	}
+	if len(locations) == 0 {
+		return nil
+	}
+	out, err := os.OpenFile(s.ConfigFile(li.config), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failure opening the %s: %w", li.description, err)
+	}
+	if _, err := out.WriteString(li.formatAll(locations)); err != nil {
+		out.Close()
+		return fmt.Errorf("failure updating the %s: %w", li.description, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure updating the %s: %w", li.description, err)
+	}
+	return nil
+}
+
+// relocate updates the locations at `old`, or at any path within it, to be at `new` instead.
+func (li *locationIndex) relocate(ctx context.Context, s *storage.LocalFiles, old, new snapshot.Path) error {
+	if !li.enabled(s) {
+		return nil
+	}
+	locations, err := li.read(s)
+	if err != nil {
+		return err
+	}
+	relocated := false
+	for _, l := range locations {
+		if p, ok := l.Path.Relocate(old, new); ok {
+			l.Path = p
+			relocated = true
+		}
+	}
+	if !relocated {
+		return nil
+	}
+	if err := s.WriteConfigFile(ctx, li.config, []byte(li.formatAll(locations))); err != nil {
+		return fmt.Errorf("failure rewriting the %s: %w", li.description, err)
+	}
+	return nil
+}
+
+// newHistory returns `h` and every snapshot it descends from that is
+// not also `prev` or in its history, with each snapshot before its parents.
+func newHistory(ctx context.Context, s *storage.LocalFiles, prev, h *snapshot.Hash) ([]*snapshot.Hash, error) {
+	if prev == nil {
+		return ancestors(ctx, s, h)
+	}
+	if h.Equal(prev) {
+		return nil, nil
+	}
+	// The common cases of a new snapshot on top of `prev`, or of going
+	// back to one of its parents, do not need the history of `prev`.
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	if len(f.Parents) == 1 && f.Parents[0].Equal(prev) {
+		return []*snapshot.Hash{h}, nil
+	}
+	prevFile, err := s.ReadSnapshot(ctx, prev)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot %q: %w", prev, err)
+	}
+	for _, parent := range prevFile.Parents {
+		if parent.Equal(h) {
+			return nil, nil
+		}
+	}
+	old, err := ancestors(ctx, s, prev)
+	if err != nil {
+		return nil, err
+	}
+	visited := make(map[snapshot.Hash]struct{})
+	for _, o := range old {
+		visited[*o] = struct{}{}
+	}
+	var history []*snapshot.Hash
+	queue := []*snapshot.Hash{h}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[*next]; ok {
+			continue
+		}
+		visited[*next] = struct{}{}
+		f, err := s.ReadSnapshot(ctx, next)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the snapshot %q: %w", next, err)
+		}
+		history = append(history, next)
+		queue = append(queue, f.Parents...)
+	}
+	return history, nil
+}
+
+// ancestors returns `h` and every snapshot it descends from, with each snapshot before its parents.
+func ancestors(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]*snapshot.Hash, error) {
+	visited := make(map[snapshot.Hash]struct{})
+	var history []*snapshot.Hash
+	queue := []*snapshot.Hash{h}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[*next]; ok {
+			continue
+		}
+		visited[*next] = struct{}{}
+		f, err := s.ReadSnapshot(ctx, next)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the snapshot %q: %w", next, err)
+		}
+		history = append(history, next)
+		queue = append(queue, f.Parents...)
+	}
+	return history, nil
+}
+
+// findLocations returns the locations of the objects in the snapshot `h` of the path `p` that are not yet indexed.
+//
+// The snapshots in `prevs` are those at the same path in the parents of
+// the snapshot being indexed, which are already indexed along with
+// everything in them, so anything unchanged from one of them is skipped.
+// So are directories already in `seen`, along with their contents,
+// since those were recorded at the same time as the directory.
+func findLocations(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h, root *snapshot.Hash, prevs []*snapshot.Hash, seen map[string]struct{}) ([]*Location, error) {
+	for _, prev := range prevs {
+		if prev.Equal(h) {
+			return nil, nil
+		}
+	}
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot %q of %q: %w", h, p, err)
+	}
+	if f.Contents == nil {
+		return nil, nil
+	}
+	l := &Location{Object: f.Contents, Snapshot: h, Root: root, Path: p}
+	if _, ok := seen[l.key()]; ok {
+		return nil, nil
+	}
+	seen[l.key()] = struct{}{}
+	locations := []*Location{l}
+	if !f.IsDir() {
+		return locations, nil
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the contents of %q: %w", p, err)
+	}
+	var prevTrees []snapshot.Tree
+	for _, prev := range prevs {
+		prevFile, err := s.ReadSnapshot(ctx, prev)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the snapshot %q of %q: %w", prev, p, err)
+		}
+		if !prevFile.IsDir() {
+			continue
+		}
+		prevTree, err := s.ListDirectorySnapshotContents(ctx, prev, prevFile)
+		if err != nil {
+			return nil, fmt.Errorf("failure listing the contents of %q: %w", prev, err)
+		}
+		prevTrees = append(prevTrees, prevTree)
+	}
+	for child, childHash := range tree {
+		var childPrevs []*snapshot.Hash
+		for _, prevTree := range prevTrees {
+			if prevChild, ok := prevTree[child]; ok {
+				childPrevs = append(childPrevs, prevChild)
+			}
+		}
+		found, err := findLocations(ctx, s, p.Join(child), childHash, root, childPrevs, seen)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, found...)
+	}
+	return locations, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// nameIndexConfig is the name of the archive config file holding the index of file names.
+//
+// It has one line per location of a file snapshot, of the form:
+//
+//	<SNAPSHOT-HASH> <ROOT-HASH> <QUOTED-PATH>
+const nameIndexConfig = "name-index"
+
+func formatName(l *Location) string {
+	return strings.Join([]string{
+		l.Snapshot.String(),
+		l.Root.String(),
+		strconv.Quote(string(l.Path)),
+	}, " ")
+}
+
+func parseName(line string) (*Location, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("malformed name index entry %q", line)
+	}
+	var hashes []*snapshot.Hash
+	for _, field := range fields[:2] {
+		h, err := snapshot.ParseHash(field)
+		if err != nil || h == nil {
+			return nil, fmt.Errorf("malformed hash in the name index entry %q: %v", line, err)
+		}
+		hashes = append(hashes, h)
+	}
+	p, err := strconv.Unquote(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed path in the name index entry %q: %w", line, err)
+	}
+	return &Location{Snapshot: hashes[0], Root: hashes[1], Path: snapshot.Path(p)}, nil
+}
+
+// nameIndex is the index of file names.
+//
+// The locations it holds do not record the hashes of the objects.
+var nameIndex = &locationIndex{
+	config:      nameIndexConfig,
+	description: "name index",
+	format:      formatName,
+	parse:       parseName,
+}
+
+// NamesEnabled reports whether or not the index of file names is enabled for the given archive.
+func NamesEnabled(s *storage.LocalFiles) bool {
+	return nameIndex.enabled(s)
+}
+
+// EnableNames starts maintaining the index of file names for the given archive.
+//
+// The history of every path that has already been snapshotted is
+// indexed before this returns. Enabling an already enabled index has
+// no effect.
+func EnableNames(ctx context.Context, s *storage.LocalFiles) error {
+	return nameIndex.enable(ctx, s)
+}
+
+// DisableNames stops maintaining the index of file names for the given archive, and removes it.
+func DisableNames(ctx context.Context, s *storage.LocalFiles) error {
+	return nameIndex.disable(ctx, s)
+}
+
+// RecordNames adds the files in the snapshot `h` of the path `p` to the index of file names, if it is enabled.
+//
+// The path `p` previously had the snapshot `prev`, which may be nil, and
+// the files in the history of `h` since then are added too.
+func RecordNames(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, prev, h *snapshot.Hash) error {
+	return nameIndex.record(ctx, s, p, prev, h)
+}
+
+// matchName reports whether or not the base name of `p` matches the shell pattern `pattern`.
+func matchName(pattern string, p snapshot.Path) bool {
+	matched, _ := filepath.Match(pattern, filepath.Base(string(p)))
+	return matched
+}
+
+// validatePattern reports an error if `pattern` is not a valid shell pattern.
+func validatePattern(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+func sortByPath(locations []*Location) {
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Path < locations[j].Path
+	})
+}
+
+// FindNames returns every location in the history of the snapshotted paths whose base name matches `pattern`, sorted by path.
+//
+// The pattern uses the syntax of `filepath.Match`. Each file snapshot
+// is returned once per path, along with the root snapshot in which it
+// first appeared there. This reads the index of file names, and fails
+// with an error wrapping `storage.ErrNotFound` if it is not enabled.
+func FindNames(s *storage.LocalFiles, pattern string) ([]*Location, error) {
+	if err := validatePattern(pattern); err != nil {
+		return nil, err
+	}
+	locations, err := nameIndex.read(s)
+	if err != nil {
+		return nil, err
+	}
+	var found []*Location
+	for _, l := range locations {
+		if matchName(pattern, l.Path) {
+			found = append(found, l)
+		}
+	}
+	sortByPath(found)
+	return found, nil
+}
+
+// MatchNames returns the location of every file in the snapshot `h` of the path `p` whose base name matches `pattern`, sorted by path.
+//
+// Unlike `FindNames`, this does not use the index, and only searches
+// the given snapshot rather than its history.
+func MatchNames(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash, pattern string) ([]*Location, error) {
+	if err := validatePattern(pattern); err != nil {
+		return nil, err
+	}
+	locations, err := findLocations(ctx, s, p, h, h, nil, make(map[string]struct{}))
+	if err != nil {
+		return nil, err
+	}
+	var found []*Location
+	for _, l := range locations {
+		if matchName(pattern, l.Path) {
+			found = append(found, l)
+		}
+	}
+	sortByPath(found)
+	return found, nil
+}
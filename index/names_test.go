@@ -0,0 +1,96 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestFindNames(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	keys := snapshot.Path(filepath.Join(dir, "keys"))
+	if err := os.MkdirAll(string(keys), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for _, name := range []string{"old.key", "notes.txt"} {
+		if err := os.WriteFile(string(keys.Join(snapshot.Path(name))), []byte(name), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	first, _, err := snapshot.Current(ctx, s, keys)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", keys, err)
+	}
+
+	if _, err := FindNames(s, "*.key"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected result searching a disabled name index: %v", err)
+	}
+	if err := EnableNames(ctx, s); err != nil {
+		t.Fatalf("failure enabling the name index: %v", err)
+	}
+	if err := os.Remove(string(keys.Join("old.key"))); err != nil {
+		t.Fatalf("failure removing the old key: %v", err)
+	}
+	if err := os.WriteFile(string(keys.Join("new.key")), []byte("new"), 0600); err != nil {
+		t.Fatalf("failure creating the new key: %v", err)
+	}
+	second, _, err := snapshot.Current(ctx, s, keys)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", keys, err)
+	}
+	if err := RecordNames(ctx, s, keys, first, second); err != nil {
+		t.Fatalf("failure indexing the names in %q: %v", second, err)
+	}
+
+	locations, err := FindNames(s, "*.key")
+	if err != nil {
+		t.Fatalf("failure finding the keys: %v", err)
+	}
+	var gotPaths []snapshot.Path
+	var gotRoots []*snapshot.Hash
+	for _, l := range locations {
+		gotPaths = append(gotPaths, l.Path)
+		gotRoots = append(gotRoots, l.Root)
+	}
+	if want := []snapshot.Path{keys.Join("new.key"), keys.Join("old.key")}; !reflect.DeepEqual(gotPaths, want) {
+		t.Errorf("unexpected paths found in the history: got %q, want %q", gotPaths, want)
+	}
+	if want := []*snapshot.Hash{second, first}; !reflect.DeepEqual(gotRoots, want) {
+		t.Errorf("unexpected roots found in the history: got %q, want %q", gotRoots, want)
+	}
+
+	// Only the latest snapshot is searched without the index.
+	locations, err = MatchNames(ctx, s, keys, second, "*.key")
+	if err != nil {
+		t.Fatalf("failure matching the keys in %q: %v", second, err)
+	}
+	if len(locations) != 1 || locations[0].Path != keys.Join("new.key") {
+		t.Errorf("unexpected keys in the latest snapshot: %+v", locations)
+	}
+
+	if _, err := FindNames(s, "["); err == nil {
+		t.Error("unexpected success searching for a malformed pattern")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// objectIndexConfig is the name of the archive config file holding the reverse index of objects.
+//
+// It has one line per location of an object, of the form:
+//
+//	<OBJECT-HASH> <SNAPSHOT-HASH> <ROOT-HASH> <QUOTED-PATH>
+const objectIndexConfig = "object-index"
+
+// Location records a path at which an object appeared in the history of a snapshotted path.
+type Location struct {
+	// Object is the hash of the object, such as the contents of a file.
+	//
+	// This is nil for locations read from the index of file names.
+	Object *snapshot.Hash
+
+	// Snapshot is the hash of the snapshot of the file whose contents are `Object`.
+	Snapshot *snapshot.Hash
+
+	// Root is the hash of the snapshot of the top-level path in which
+	// `Snapshot` was first recorded at `Path`.
+	Root *snapshot.Hash
+
+	// Path is the path of the file.
+	Path snapshot.Path
+}
+
+func (l *Location) String() string {
+	return strings.Join([]string{
+		l.Object.String(),
+		l.Snapshot.String(),
+		l.Root.String(),
+		strconv.Quote(string(l.Path)),
+	}, " ")
+}
+
+// key identifies a file snapshot at a specific path.
+func (l *Location) key() string {
+	return l.Snapshot.String() + " " + string(l.Path)
+}
+
+func parseLocation(line string) (*Location, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("malformed object index entry %q", line)
+	}
+	var hashes []*snapshot.Hash
+	for _, field := range fields[:3] {
+		h, err := snapshot.ParseHash(field)
+		if err != nil || h == nil {
+			return nil, fmt.Errorf("malformed hash in the object index entry %q: %v", line, err)
+		}
+		hashes = append(hashes, h)
+	}
+	p, err := strconv.Unquote(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("malformed path in the object index entry %q: %w", line, err)
+	}
+	return &Location{Object: hashes[0], Snapshot: hashes[1], Root: hashes[2], Path: snapshot.Path(p)}, nil
+}
+
+// objectIndex is the reverse index of objects.
+var objectIndex = &locationIndex{
+	config:      objectIndexConfig,
+	description: "object index",
+	format:      (*Location).String,
+	parse:       parseLocation,
+}
+
+// ObjectsEnabled reports whether or not the reverse index of objects is enabled for the given archive.
+func ObjectsEnabled(s *storage.LocalFiles) bool {
+	return objectIndex.enabled(s)
+}
+
+// EnableObjects starts maintaining the reverse index of objects for the given archive.
+//
+// The history of every path that has already been snapshotted is
+// indexed before this returns. Enabling an already enabled index has
+// no effect.
+func EnableObjects(ctx context.Context, s *storage.LocalFiles) error {
+	return objectIndex.enable(ctx, s)
+}
+
+// DisableObjects stops maintaining the reverse index of objects for the given archive, and removes it.
+func DisableObjects(ctx context.Context, s *storage.LocalFiles) error {
+	return objectIndex.disable(ctx, s)
+}
+
+// RecordObjects adds the objects in the snapshot `h` of the path `p` to the reverse index of objects, if it is enabled.
+//
+// The path `p` previously had the snapshot `prev`, which may be nil, and
+// the objects in the history of `h` since then are added too. Only the
+// parts of each snapshot that differ from its parents are read, so this
+// is cheap for snapshots that share most of their contents with earlier
+// ones.
+func RecordObjects(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, prev, h *snapshot.Hash) error {
+	return objectIndex.record(ctx, s, p, prev, h)
+}
+
+// RelocateLocations updates the reverse index of objects and the index
+// of file names, if they are enabled, so that the locations at the path
+// `old`, or at any path within it, are at the path `new` instead.
+func RelocateLocations(ctx context.Context, s *storage.LocalFiles, old, new snapshot.Path) error {
+	if err := objectIndex.relocate(ctx, s, old, new); err != nil {
+		return err
+	}
+	return nameIndex.relocate(ctx, s, old, new)
+}
+
+// FindObject returns every location at which the object `h` appears, sorted by path.
+//
+// The hash `h` may be either the hash of an object, such as the
+// contents of a file, or the hash of the snapshot of a file.
+func FindObject(s *storage.LocalFiles, h *snapshot.Hash) ([]*Location, error) {
+	locations, err := objectIndex.read(s)
+	if err != nil {
+		return nil, err
+	}
+	var found []*Location
+	for _, l := range locations {
+		if l.Object.Equal(h) || l.Snapshot.Equal(h) {
+			found = append(found, l)
+		}
+	}
+	sortByPath(found)
+	return found, nil
+}
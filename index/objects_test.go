@@ -0,0 +1,162 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestFindObject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	docs := snapshot.Path(filepath.Join(dir, "docs"))
+	if err := os.MkdirAll(string(docs), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(string(docs.Join(snapshot.Path(name))), []byte("first document"), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	first, _, err := snapshot.Current(ctx, s, docs)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", docs, err)
+	}
+
+	if _, err := FindObject(s, first); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected result searching a disabled object index: %v", err)
+	}
+	// Enabling the index indexes the existing history.
+	if err := EnableObjects(ctx, s); err != nil {
+		t.Fatalf("failure enabling the object index: %v", err)
+	}
+	if err := os.WriteFile(string(docs.Join("a.txt")), []byte("second document"), 0600); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	second, _, err := snapshot.Current(ctx, s, docs)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", docs, err)
+	}
+	if err := RecordObjects(ctx, s, docs, first, second); err != nil {
+		t.Fatalf("failure indexing the objects in %q: %v", second, err)
+	}
+
+	testCases := []struct {
+		Contents  string
+		WantPaths []snapshot.Path
+		WantRoot  *snapshot.Hash
+	}{
+		{"first document", []snapshot.Path{docs.Join("a.txt"), docs.Join("b.txt")}, first},
+		{"second document", []snapshot.Path{docs.Join("a.txt")}, second},
+	}
+	for _, testCase := range testCases {
+		h, err := snapshot.NewHash(strings.NewReader(testCase.Contents))
+		if err != nil {
+			t.Fatalf("failure hashing %q: %v", testCase.Contents, err)
+		}
+		locations, err := FindObject(s, h)
+		if err != nil {
+			t.Fatalf("failure finding %q: %v", testCase.Contents, err)
+		}
+		var gotPaths []snapshot.Path
+		for _, l := range locations {
+			gotPaths = append(gotPaths, l.Path)
+			if !l.Root.Equal(testCase.WantRoot) {
+				t.Errorf("unexpected root for %q at %q: got %q, want %q", testCase.Contents, l.Path, l.Root, testCase.WantRoot)
+			}
+		}
+		if !reflect.DeepEqual(gotPaths, testCase.WantPaths) {
+			t.Errorf("unexpected paths for %q: got %q, want %q", testCase.Contents, gotPaths, testCase.WantPaths)
+		}
+	}
+
+	// The unchanged file is not indexed again for the second snapshot.
+	unchanged, _, err := s.FindSnapshot(ctx, docs.Join("b.txt"))
+	if err != nil {
+		t.Fatalf("failure looking up the snapshot of the unchanged file: %v", err)
+	}
+	locations, err := FindObject(s, unchanged)
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of the unchanged file: %v", err)
+	}
+	for _, l := range locations {
+		if !l.Root.Equal(first) {
+			t.Errorf("unexpected root for the unchanged file at %q: got %q, want %q", l.Path, l.Root, first)
+		}
+	}
+}
+
+func TestRecordObjectsFromOtherHistory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	docs, other := snapshot.Path(filepath.Join(dir, "docs")), snapshot.Path(filepath.Join(dir, "other"))
+	for _, p := range []snapshot.Path{docs, other} {
+		if err := os.MkdirAll(string(p), 0700); err != nil {
+			t.Fatalf("failure creating the example directory: %v", err)
+		}
+		if err := os.WriteFile(string(p.Join("file.txt")), []byte("contents of "+string(p)), 0600); err != nil {
+			t.Fatalf("failure creating the example file: %v", err)
+		}
+	}
+	first, _, err := snapshot.Current(ctx, s, docs)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", docs, err)
+	}
+	if err := EnableObjects(ctx, s); err != nil {
+		t.Fatalf("failure enabling the object index: %v", err)
+	}
+	// A snapshot with an unrelated history, such as one that was pulled, replaces that of `docs`.
+	pulled, _, err := snapshot.Current(ctx, s, other)
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", other, err)
+	}
+	if err := RecordObjects(ctx, s, docs, first, pulled); err != nil {
+		t.Fatalf("failure indexing the objects in %q: %v", pulled, err)
+	}
+	h, err := snapshot.NewHash(strings.NewReader("contents of " + string(other)))
+	if err != nil {
+		t.Fatalf("failure hashing the pulled contents: %v", err)
+	}
+	locations, err := FindObject(s, h)
+	if err != nil {
+		t.Fatalf("failure finding the pulled contents: %v", err)
+	}
+	if len(locations) != 1 || locations[0].Path != docs.Join("file.txt") || !locations[0].Root.Equal(pulled) {
+		t.Errorf("unexpected locations of the pulled contents: %+v", locations)
+	}
+
+	moved := snapshot.Path(filepath.Join(dir, "moved"))
+	if err := RelocateLocations(ctx, s, docs, moved); err != nil {
+		t.Fatalf("failure relocating the indexed locations: %v", err)
+	}
+	locations, err = FindObject(s, h)
+	if err != nil {
+		t.Fatalf("failure finding the relocated contents: %v", err)
+	}
+	if len(locations) != 1 || locations[0].Path != moved.Join("file.txt") {
+		t.Errorf("unexpected locations of the relocated contents: %+v", locations)
+	}
+}
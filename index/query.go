@@ -0,0 +1,226 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Condition is a single condition on the entries of the index.
+//
+// Conditions are written as `<FIELD><OPERATOR><VALUE>`, e.g. "new>1GB".
+type Condition struct {
+	// Field is the name of the entry field being compared.
+	//
+	// This is one of "path", "hash", "time", "files", "size", or "new".
+	Field string
+
+	// Operator is the comparison operator.
+	//
+	// This is one of "=", "!=", "<", "<=", ">", ">=", or "~". The "~"
+	// operator is only supported for paths, and matches the path and
+	// every path nested beneath it.
+	Operator string
+
+	// Value is the value the field is compared against, as written.
+	Value string
+
+	matches func(e *Entry) bool
+}
+
+func (c *Condition) String() string {
+	return c.Field + c.Operator + c.Value
+}
+
+// Matches reports whether or not the index entry satisfies the condition.
+func (c *Condition) Matches(e *Entry) bool {
+	return c.matches(e)
+}
+
+// operators lists the supported operators, with longer operators before their prefixes.
+var operators = []string{"!=", "<=", ">=", "=", "<", ">", "~"}
+
+// sizeUnits are the suffixes accepted for sizes, with "B" last since it ends the others.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseSize parses a number of bytes, with an optional unit suffix such as "GB" or "MiB".
+func parseSize(value string) (int64, error) {
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// parseTime parses a time given either as a date (YYYY-MM-DD) or in RFC 3339 format.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func compare(operator string, cmp int) bool {
+	switch operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// ParseCondition parses a condition of the form `<FIELD><OPERATOR><VALUE>`.
+func ParseCondition(condition string) (*Condition, error) {
+	c := &Condition{}
+	for i := range condition {
+		for _, op := range operators {
+			if strings.HasPrefix(condition[i:], op) {
+				c.Field, c.Operator, c.Value = condition[:i], op, condition[i+len(op):]
+				break
+			}
+		}
+		if len(c.Operator) > 0 {
+			break
+		}
+	}
+	if len(c.Operator) == 0 || len(c.Field) == 0 {
+		return nil, fmt.Errorf("malformed condition %q", condition)
+	}
+	if c.Operator == "~" && c.Field != "path" {
+		return nil, fmt.Errorf("the operator %q is only supported for paths, in the condition %q", c.Operator, condition)
+	}
+	switch c.Field {
+	case "path":
+		abs, err := filepath.Abs(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failure resolving the absolute path of %q: %w", c.Value, err)
+		}
+		p := snapshot.Path(abs)
+		if c.Operator == "~" {
+			prefix := string(p)
+			if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+				prefix += string(filepath.Separator)
+			}
+			c.matches = func(e *Entry) bool {
+				return e.Path == p || strings.HasPrefix(string(e.Path), prefix)
+			}
+		} else {
+			c.matches = func(e *Entry) bool {
+				return compare(c.Operator, strings.Compare(string(e.Path), string(p)))
+			}
+		}
+	case "hash":
+		h, err := snapshot.ParseHash(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed hash in the condition %q: %w", condition, err)
+		}
+		c.matches = func(e *Entry) bool {
+			return compare(c.Operator, strings.Compare(e.Hash.String(), h.String()))
+		}
+	case "time":
+		t, err := parseTime(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed time in the condition %q: %w", condition, err)
+		}
+		c.matches = func(e *Entry) bool {
+			return compare(c.Operator, compareInts(e.Time.UnixNano(), t.UnixNano()))
+		}
+	case "files", "size", "new":
+		var n int64
+		var err error
+		if c.Field == "files" {
+			n, err = strconv.ParseInt(c.Value, 10, 64)
+		} else {
+			n, err = parseSize(c.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed number in the condition %q: %w", condition, err)
+		}
+		field := map[string]func(e *Entry) int64{
+			"files": func(e *Entry) int64 { return e.Files },
+			"size":  func(e *Entry) int64 { return e.Size },
+			"new":   func(e *Entry) int64 { return e.NewBytes },
+		}[c.Field]
+		c.matches = func(e *Entry) bool {
+			return compare(c.Operator, compareInts(field(e), n))
+		}
+	default:
+		return nil, fmt.Errorf("unknown field %q in the condition %q", c.Field, condition)
+	}
+	return c, nil
+}
+
+// Query returns the entries that satisfy every one of the given conditions.
+func Query(entries []*Entry, conditions []*Condition) []*Entry {
+	var result []*Entry
+	for _, e := range entries {
+		matched := true
+		for _, c := range conditions {
+			if !c.Matches(e) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, e)
+		}
+	}
+	return result
+}
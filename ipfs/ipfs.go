@@ -0,0 +1,560 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ipfs defines a remote backend that stores objects in IPFS.
+//
+// Objects are already addressed by their SHA-256 hashes, so each object
+// small enough to fit in a single IPFS block is stored as a raw block
+// whose CID is derived directly from the object's hash. Larger objects
+// are added as regular IPFS files.
+//
+// The latest snapshots of paths and tracks, along with the CIDs of the
+// large objects, are recorded in an index file that is published using
+// IPNS. This allows anyone who knows the IPNS name to pull the snapshots.
+package ipfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// maxBlockSize is the size of the largest object stored as a single raw block.
+//
+// This is the default block size limit enforced by IPFS nodes.
+const maxBlockSize = 1024 * 1024
+
+// defaultKey is the name of the IPNS key used when none is specified.
+const defaultKey = "self"
+
+// Backend stores objects in IPFS using the HTTP API of an IPFS node.
+type Backend struct {
+	api    string
+	client *http.Client
+
+	// key is the name of the IPNS key used to publish the index.
+	//
+	// This is empty for read-only backends.
+	key string
+
+	// name is the IPNS name the index is read from for read-only backends.
+	//
+	// For other backends, this is looked up from `key`.
+	name string
+
+	mu sync.Mutex
+
+	// index is loaded from IPNS the first time it is needed.
+	index *index
+}
+
+// New returns a backend for the given address.
+//
+// The address is the URL of the HTTP API of an IPFS node, optionally
+// followed by `#<KEY>`, naming the IPNS key used to publish the index.
+// The key "self" is used by default.
+//
+// Only the node holding a key can publish under it, so other machines
+// instead use an address ending in `#/ipns/<NAME>`, naming the IPNS
+// name that the index was published under. Such backends are read-only.
+func New(address string) (*Backend, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("malformed IPFS API address %q: %w", address, err)
+	}
+	b := &Backend{
+		key:    defaultKey,
+		client: http.DefaultClient,
+	}
+	if name := strings.TrimPrefix(u.Fragment, "/ipns/"); name != u.Fragment {
+		if len(name) == 0 {
+			return nil, fmt.Errorf("missing IPNS name in the IPFS API address %q", address)
+		}
+		b.key, b.name = "", name
+	} else if len(u.Fragment) > 0 {
+		b.key = u.Fragment
+	}
+	u.Fragment = ""
+	b.api = strings.TrimSuffix(u.String(), "/")
+	return b, nil
+}
+
+// checkWritable returns an error if the backend is read-only.
+func (b *Backend) checkWritable() error {
+	if len(b.key) == 0 {
+		return fmt.Errorf("the IPNS name %q is read-only; an IPNS key held by the IPFS node is needed to write to it", b.name)
+	}
+	return nil
+}
+
+// rawCID returns the CID of the raw IPFS block holding the object with the given hash.
+func rawCID(h *snapshot.Hash) (string, error) {
+	if h.Function() != "sha256" {
+		return "", fmt.Errorf("unsupported hash function %q", h.Function())
+	}
+	digest, err := hex.DecodeString(h.HexContents())
+	if err != nil {
+		return "", fmt.Errorf("malformed hash %q: %w", h, err)
+	}
+	// CIDv1, raw codec, sha2-256 multihash of 32 bytes.
+	cid := append([]byte{0x01, 0x55, 0x12, 0x20}, digest...)
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(cid)
+	return "b" + strings.ToLower(encoded), nil
+}
+
+// apiErrNotFound is the `apiError.Code` of errors for things that do not exist.
+const apiErrNotFound = 3
+
+// apiError is the error body returned by the IPFS HTTP API.
+type apiError struct {
+	Message string
+	Code    int
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// isNotFound reports whether or not `err` is an IPFS HTTP API error for something that does not exist.
+func isNotFound(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && e.Code == apiErrNotFound
+}
+
+// call invokes the given command of the IPFS HTTP API.
+//
+// The caller is responsible for closing the returned response body.
+func (b *Backend) call(ctx context.Context, cmd string, args url.Values, body io.Reader, contentType string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.api+"/api/v0/"+cmd+"?"+args.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e apiError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || len(e.Message) == 0 {
+			return nil, fmt.Errorf("IPFS command %q failed with status %q", cmd, resp.Status)
+		}
+		return nil, fmt.Errorf("IPFS command %q failed: %w", cmd, &e)
+	}
+	return resp.Body, nil
+}
+
+// callJSON invokes the given command of the IPFS HTTP API and decodes its JSON response into `result`.
+func (b *Backend) callJSON(ctx context.Context, cmd string, args url.Values, body io.Reader, contentType string, result any) error {
+	respBody, err := b.call(ctx, cmd, args, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+	if err := json.NewDecoder(respBody).Decode(result); err != nil {
+		return fmt.Errorf("malformed response to the IPFS command %q: %w", cmd, err)
+	}
+	return nil
+}
+
+// upload sends the contents of `reader` to the given IPFS command as a multipart file.
+func (b *Backend) upload(ctx context.Context, cmd string, args url.Values, reader io.Reader, result any) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", "file")
+		if err == nil {
+			_, err = io.Copy(part, reader)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	err := b.callJSON(ctx, cmd, args, pr, mw.FormDataContentType(), result)
+	pr.Close()
+	return err
+}
+
+// addResult is the response to the "add" command.
+type addResult struct {
+	Hash string
+}
+
+// addFile adds the contents of `reader` to IPFS as a regular file and returns its CID.
+//
+// If `pin` is false, then the file is removed by the node's next garbage collection unless it is pinned later.
+func (b *Backend) addFile(ctx context.Context, reader io.Reader, pin bool) (string, error) {
+	args := url.Values{
+		"cid-version": {"1"},
+		"raw-leaves":  {"true"},
+		"pin":         {fmt.Sprint(pin)},
+		"quieter":     {"true"},
+	}
+	var result addResult
+	if err := b.upload(ctx, "add", args, reader, &result); err != nil {
+		return "", err
+	}
+	return result.Hash, nil
+}
+
+// pin keeps the given CID from being garbage collected by the node.
+func (b *Backend) pin(ctx context.Context, cid string) error {
+	var result struct{}
+	return b.callJSON(ctx, "pin/add", url.Values{"arg": {"/ipfs/" + cid}}, nil, "", &result)
+}
+
+func (b *Backend) cat(ctx context.Context, cid string) (io.ReadCloser, error) {
+	return b.call(ctx, "cat", url.Values{"arg": {"/ipfs/" + cid}}, nil, "")
+}
+
+// index records the mutable state of the backend.
+type index struct {
+	// objects maps the hashes of objects stored as regular files to their CIDs.
+	objects map[snapshot.Hash]string
+
+	// paths maps each path to its latest snapshot.
+	paths map[snapshot.Path]*snapshot.Hash
+
+	// tracks maps each track to its latest snapshot.
+	tracks map[string]*snapshot.Hash
+}
+
+func newIndex() *index {
+	return &index{
+		objects: make(map[snapshot.Hash]string),
+		paths:   make(map[snapshot.Path]*snapshot.Hash),
+		tracks:  make(map[string]*snapshot.Hash),
+	}
+}
+
+func encodePath(p snapshot.Path) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(p))
+}
+
+// String serializes the index as sorted lines of the form `<KIND> <KEY> <VALUE>`.
+func (idx *index) String() string {
+	var lines []string
+	for h, cid := range idx.objects {
+		lines = append(lines, fmt.Sprintf("object %s %s", h.String(), cid))
+	}
+	for p, h := range idx.paths {
+		lines = append(lines, fmt.Sprintf("path %s %s", encodePath(p), h))
+	}
+	for id, h := range idx.tracks {
+		lines = append(lines, fmt.Sprintf("track %s %s", id, h))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func parseIndex(r io.Reader) (*index, error) {
+	idx := newIndex()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, " ")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("malformed index line %q", line)
+		}
+		switch parts[0] {
+		case "object":
+			h, err := snapshot.ParseHash(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index line %q: %w", line, err)
+			}
+			idx.objects[*h] = parts[2]
+		case "path":
+			p, err := base64.RawStdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index line %q: %w", line, err)
+			}
+			h, err := snapshot.ParseHash(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index line %q: %w", line, err)
+			}
+			idx.paths[snapshot.Path(p)] = h
+		case "track":
+			h, err := snapshot.ParseHash(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index line %q: %w", line, err)
+			}
+			idx.tracks[parts[1]] = h
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failure reading the index: %w", err)
+	}
+	return idx, nil
+}
+
+// keyListResult is the response to the "key/list" command.
+type keyListResult struct {
+	Keys []struct {
+		Name string
+		Id   string
+	}
+}
+
+// resolveResult is the response to the "name/resolve" command.
+type resolveResult struct {
+	Path string
+}
+
+// loadIndex reads the index published under the backend's IPNS name.
+//
+// The caller must hold `b.mu`.
+func (b *Backend) loadIndex(ctx context.Context) (*index, error) {
+	if b.index != nil {
+		return b.index, nil
+	}
+	if len(b.name) == 0 {
+		var keys keyListResult
+		if err := b.callJSON(ctx, "key/list", nil, nil, "", &keys); err != nil {
+			return nil, fmt.Errorf("failure listing the IPNS keys: %w", err)
+		}
+		for _, k := range keys.Keys {
+			if k.Name == b.key {
+				b.name = k.Id
+			}
+		}
+		if len(b.name) == 0 {
+			return nil, fmt.Errorf("there is no IPNS key named %q", b.key)
+		}
+	}
+	var resolved resolveResult
+	if err := b.callJSON(ctx, "name/resolve", url.Values{"arg": {"/ipns/" + b.name}, "nocache": {"true"}}, nil, "", &resolved); err != nil {
+		if !isNotFound(err) {
+			return nil, fmt.Errorf("failure resolving the IPNS name %q: %w", b.name, err)
+		}
+		// Nothing has been published under the name yet.
+		b.index = newIndex()
+		return b.index, nil
+	}
+	reader, err := b.cat(ctx, strings.TrimPrefix(resolved.Path, "/ipfs/"))
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the index %q: %w", resolved.Path, err)
+	}
+	defer reader.Close()
+	idx, err := parseIndex(reader)
+	if err != nil {
+		return nil, err
+	}
+	b.index = idx
+	return idx, nil
+}
+
+// publishIndex stores the index and publishes it under the backend's IPNS key.
+//
+// The caller must hold `b.mu`.
+func (b *Backend) publishIndex(ctx context.Context) error {
+	cid, err := b.addFile(ctx, strings.NewReader(b.index.String()), true)
+	if err != nil {
+		return fmt.Errorf("failure storing the index: %w", err)
+	}
+	args := url.Values{
+		"arg":           {"/ipfs/" + cid},
+		"key":           {b.key},
+		"allow-offline": {"true"},
+	}
+	var result struct{}
+	if err := b.callJSON(ctx, "name/publish", args, nil, "", &result); err != nil {
+		return fmt.Errorf("failure publishing the index: %w", err)
+	}
+	return nil
+}
+
+// HasObject reports whether or not the IPFS node has the given object locally.
+func (b *Backend) HasObject(ctx context.Context, h *snapshot.Hash) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if idx, err := b.loadIndex(ctx); err == nil {
+		if _, ok := idx.objects[*h]; ok {
+			return true
+		}
+	}
+	cid, err := rawCID(h)
+	if err != nil {
+		return false
+	}
+	var result struct{}
+	return b.callJSON(ctx, "block/stat", url.Values{"arg": {cid}, "offline": {"true"}}, nil, "", &result) == nil
+}
+
+// ReadObject reads the given object from IPFS.
+//
+// The contents are not verified, so callers must check them against the hash.
+func (b *Backend) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
+	b.mu.Lock()
+	idx, err := b.loadIndex(ctx)
+	var fileCID string
+	if err == nil {
+		fileCID = idx.objects[*h]
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(fileCID) > 0 {
+		return b.cat(ctx, fileCID)
+	}
+	cid, err := rawCID(h)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := b.call(ctx, "block/get", url.Values{"arg": {cid}}, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", os.ErrNotExist, err)
+	}
+	return reader, nil
+}
+
+// WriteObject stores the object read from `reader` in IPFS.
+//
+// Objects larger than a single block are recorded in the index, which
+// is published by the next call to `StoreSnapshot` or `StoreTrack`.
+//
+// Contents are only pinned once they have been checked against the
+// hash, so the node discards any that do not match.
+func (b *Backend) WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	reader = io.TeeReader(reader, hasher)
+	prefix := make([]byte, maxBlockSize+1)
+	n, err := io.ReadFull(reader, prefix)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	prefix = prefix[:n]
+	if n <= maxBlockSize {
+		if got := hex.EncodeToString(hasher.Sum(nil)); got != h.HexContents() {
+			return fmt.Errorf("the contents of the object %q hashed to %q", h, got)
+		}
+		args := url.Values{
+			"cid-codec": {"raw"},
+			"mhtype":    {"sha2-256"},
+			"pin":       {"true"},
+		}
+		var result struct{}
+		return b.upload(ctx, "block/put", args, bytes.NewReader(prefix), &result)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.loadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	cid, err := b.addFile(ctx, io.MultiReader(bytes.NewReader(prefix), reader), false)
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != h.HexContents() {
+		return fmt.Errorf("the contents of the object %q hashed to %q", h, got)
+	}
+	if err := b.pin(ctx, cid); err != nil {
+		return fmt.Errorf("failure pinning the object %q: %w", h, err)
+	}
+	idx.objects[*h] = cid
+	return nil
+}
+
+// FindSnapshot returns the latest snapshot of the given path recorded in the published index.
+func (b *Backend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h, ok := idx.paths[p]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return h, nil
+}
+
+// StoreSnapshot records `h` as the latest snapshot of the given path and publishes the index.
+func (b *Backend) StoreSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.loadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	idx.paths[p] = h
+	return b.publishIndex(ctx)
+}
+
+// FindTrack returns the latest snapshot of the given track recorded in the published index.
+func (b *Backend) FindTrack(ctx context.Context, id string) (*snapshot.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h, ok := idx.tracks[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return h, nil
+}
+
+// StoreTrack records `h` as the latest snapshot of the given track and publishes the index.
+func (b *Backend) StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	idx, err := b.loadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	idx.tracks[id] = h
+	return b.publishIndex(ctx)
+}
+
+// Close does nothing, since the index is published whenever it is updated.
+func (b *Backend) Close() error {
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestRawCID(t *testing.T) {
+	h, err := snapshot.NewHash(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("failure hashing the empty string: %v", err)
+	}
+	// The well-known CID of the empty raw block.
+	want := "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	if got, err := rawCID(h); err != nil {
+		t.Errorf("failure computing the CID of %q: %v", h, err)
+	} else if got != want {
+		t.Errorf("unexpected CID for %q: got %q, want %q", h, got, want)
+	}
+}
+
+// fakeNode implements the subset of the IPFS HTTP API used by the backend.
+type fakeNode struct {
+	mu        sync.Mutex
+	blocks    map[string][]byte
+	files     map[string][]byte
+	pinned    map[string]bool
+	published string
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		blocks: make(map[string][]byte),
+		files:  make(map[string][]byte),
+		pinned: make(map[string]bool),
+	}
+}
+
+func (n *fakeNode) fail(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]any{"Message": msg, "Code": 0, "Type": "error"})
+}
+
+func (n *fakeNode) notFound(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]any{"Message": msg, "Code": apiErrNotFound, "Type": "error"})
+}
+
+func (n *fakeNode) upload(r *http.Request) ([]byte, error) {
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	arg := r.URL.Query().Get("arg")
+	switch strings.TrimPrefix(r.URL.Path, "/api/v0/") {
+	case "block/put":
+		contents, err := n.upload(r)
+		if err != nil {
+			n.fail(w, err.Error())
+			return
+		}
+		h, _ := snapshot.NewHash(bytes.NewReader(contents))
+		cid, _ := rawCID(h)
+		n.blocks[cid] = contents
+		json.NewEncoder(w).Encode(map[string]any{"Key": cid, "Size": len(contents)})
+	case "block/stat":
+		if contents, ok := n.blocks[arg]; ok {
+			json.NewEncoder(w).Encode(map[string]any{"Key": arg, "Size": len(contents)})
+			return
+		}
+		n.fail(w, "block was not found locally (offline)")
+	case "block/get":
+		if contents, ok := n.blocks[arg]; ok {
+			w.Write(contents)
+			return
+		}
+		n.fail(w, "block not found")
+	case "add":
+		contents, err := n.upload(r)
+		if err != nil {
+			n.fail(w, err.Error())
+			return
+		}
+		cid := fmt.Sprintf("bafyfile%d", len(n.files))
+		n.files[cid] = contents
+		n.pinned[cid] = r.URL.Query().Get("pin") == "true"
+		json.NewEncoder(w).Encode(map[string]any{"Name": cid, "Hash": cid})
+	case "cat":
+		if contents, ok := n.files[strings.TrimPrefix(arg, "/ipfs/")]; ok {
+			w.Write(contents)
+			return
+		}
+		n.fail(w, "file not found")
+	case "pin/add":
+		cid := strings.TrimPrefix(arg, "/ipfs/")
+		if _, ok := n.files[cid]; !ok {
+			n.fail(w, "file not found")
+			return
+		}
+		n.pinned[cid] = true
+		json.NewEncoder(w).Encode(map[string]any{"Pins": []string{cid}})
+	case "key/list":
+		json.NewEncoder(w).Encode(map[string]any{"Keys": []map[string]string{{"Name": "self", "Id": "k51self"}}})
+	case "name/resolve":
+		if arg != "/ipns/k51self" || len(n.published) == 0 {
+			n.notFound(w, "could not resolve name")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Path": n.published})
+	case "name/publish":
+		n.published = arg
+		json.NewEncoder(w).Encode(map[string]any{"Name": "k51self", "Value": arg})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	node := newFakeNode()
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	small := []byte("Hello, World!")
+	large := make([]byte, 2*maxBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	b, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("failure creating the backend: %v", err)
+	}
+	var hashes []*snapshot.Hash
+	for _, contents := range [][]byte{small, large} {
+		h, err := snapshot.NewHash(bytes.NewReader(contents))
+		if err != nil {
+			t.Fatalf("failure hashing the example contents: %v", err)
+		}
+		if b.HasObject(ctx, h) {
+			t.Errorf("unexpectedly found the object %q before writing it", h)
+		}
+		if err := b.WriteObject(ctx, h, bytes.NewReader(contents)); err != nil {
+			t.Fatalf("failure writing the object %q: %v", h, err)
+		}
+		hashes = append(hashes, h)
+	}
+	if err := b.WriteObject(ctx, hashes[0], bytes.NewReader(large)); err == nil {
+		t.Error("unexpectedly wrote an object whose contents did not match its hash")
+	}
+	for cid, pinned := range node.pinned {
+		if pinned && !bytes.Equal(node.files[cid], large) {
+			t.Errorf("contents that did not match their hash were pinned as %q", cid)
+		}
+	}
+	if err := b.StoreSnapshot(ctx, snapshot.Path("/example"), hashes[0]); err != nil {
+		t.Fatalf("failure storing the snapshot: %v", err)
+	}
+	if err := b.StoreTrack(ctx, "example", hashes[1]); err != nil {
+		t.Fatalf("failure storing the track: %v", err)
+	}
+
+	// A new backend must read everything back from the published index.
+	b, err = New(server.URL + "#self")
+	if err != nil {
+		t.Fatalf("failure creating the backend: %v", err)
+	}
+	for i, contents := range [][]byte{small, large} {
+		h := hashes[i]
+		if !b.HasObject(ctx, h) {
+			t.Errorf("missing the object %q", h)
+		}
+		reader, err := b.ReadObject(ctx, h)
+		if err != nil {
+			t.Fatalf("failure reading the object %q: %v", h, err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Errorf("failure reading the object %q: %v", h, err)
+		} else if !bytes.Equal(got, contents) {
+			t.Errorf("unexpected contents for the object %q", h)
+		}
+	}
+	if got, err := b.FindSnapshot(ctx, snapshot.Path("/example")); err != nil {
+		t.Errorf("failure finding the snapshot: %v", err)
+	} else if !got.Equal(hashes[0]) {
+		t.Errorf("unexpected snapshot: got %q, want %q", got, hashes[0])
+	}
+	if got, err := b.FindTrack(ctx, "example"); err != nil {
+		t.Errorf("failure finding the track: %v", err)
+	} else if !got.Equal(hashes[1]) {
+		t.Errorf("unexpected track: got %q, want %q", got, hashes[1])
+	}
+	if _, err := b.FindSnapshot(ctx, snapshot.Path("/missing")); err == nil {
+		t.Error("unexpectedly found a snapshot of a missing path")
+	}
+}
+
+func TestReadOnlyBackend(t *testing.T) {
+	ctx := context.Background()
+	node := newFakeNode()
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	b, err := New(server.URL + "#/ipns/k51self")
+	if err != nil {
+		t.Fatalf("failure creating the read-only backend: %v", err)
+	}
+	// Nothing has been published yet.
+	if _, err := b.FindSnapshot(ctx, snapshot.Path("/example")); err == nil {
+		t.Error("unexpectedly found a snapshot before anything was published")
+	}
+
+	contents := []byte("Hello, World!")
+	h, err := snapshot.NewHash(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	if err := b.WriteObject(ctx, h, bytes.NewReader(contents)); err == nil {
+		t.Error("unexpectedly wrote an object to a read-only backend")
+	}
+	if err := b.StoreSnapshot(ctx, snapshot.Path("/example"), h); err == nil {
+		t.Error("unexpectedly stored a snapshot in a read-only backend")
+	}
+
+	writer, err := New(server.URL)
+	if err != nil {
+		t.Fatalf("failure creating the backend: %v", err)
+	}
+	if err := writer.WriteObject(ctx, h, bytes.NewReader(contents)); err != nil {
+		t.Fatalf("failure writing the object %q: %v", h, err)
+	}
+	if err := writer.StoreSnapshot(ctx, snapshot.Path("/example"), h); err != nil {
+		t.Fatalf("failure storing the snapshot: %v", err)
+	}
+	b, err = New(server.URL + "#/ipns/k51self")
+	if err != nil {
+		t.Fatalf("failure creating the read-only backend: %v", err)
+	}
+	if got, err := b.FindSnapshot(ctx, snapshot.Path("/example")); err != nil {
+		t.Errorf("failure finding the snapshot: %v", err)
+	} else if !got.Equal(h) {
+		t.Errorf("unexpected snapshot: got %q, want %q", got, h)
+	}
+
+	// Failures other than the name not being found are not mistaken for an empty index.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.fail(w, "could not resolve name: context deadline exceeded")
+	}))
+	defer failing.Close()
+	b, err = New(failing.URL + "#/ipns/k51self")
+	if err != nil {
+		t.Fatalf("failure creating the read-only backend: %v", err)
+	}
+	if _, err := b.FindSnapshot(ctx, snapshot.Path("/example")); err == nil || isNotFound(err) {
+		t.Errorf("unexpected result of resolving the name on a failing node: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// deletedFiles adds the tombstones recorded in the directory snapshot
+// `f`, and in any of its nested directories that differ from `prev`, to
+// the `deleted` map.
+func deletedFiles(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, prevTree snapshot.Tree, subpath string, deleted map[string]*snapshot.Hash) error {
+	tombstones, err := f.Tombstones()
+	if err != nil {
+		return fmt.Errorf("failure reading the tombstones of %q: %w", h, err)
+	}
+	for child, last := range tombstones {
+		deleted[filepath.Join(subpath, string(child))] = last
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return fmt.Errorf("failure listing the directory contents of the snapshot %q: %w", h, err)
+	}
+	for child, childHash := range tree {
+		prevChildHash := prevTree[child]
+		if childHash.Equal(prevChildHash) {
+			// Unchanged directories cannot have any new tombstones.
+			continue
+		}
+		childFile, err := s.ReadSnapshot(ctx, childHash)
+		if err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", child, err)
+		} else if !childFile.IsDir() {
+			continue
+		}
+		var prevChildTree snapshot.Tree
+		if prevChildHash != nil {
+			prevChildFile, err := s.ReadSnapshot(ctx, prevChildHash)
+			if err != nil {
+				return fmt.Errorf("failure reading the previous file snapshot for %q: %w", child, err)
+			}
+			if prevChildFile.IsDir() {
+				prevChildTree, err = s.ListDirectorySnapshotContents(ctx, prevChildHash, prevChildFile)
+				if err != nil {
+					return fmt.Errorf("failure listing the previous directory contents for %q: %w", child, err)
+				}
+			}
+		}
+		if err := deletedFiles(ctx, s, childHash, childFile, prevChildTree, filepath.Join(subpath, string(child)), deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescribeDeleted describes the files that were deleted in the given log entry.
+//
+// This relies on the tombstones recorded when the snapshot was
+// generated, so only the directories that changed since the entry's
+// first parent are read. The returned value is empty if no tombstones
+// were recorded.
+func DescribeDeleted(ctx context.Context, s *storage.LocalFiles, e *LogEntry) ([]string, error) {
+	if !e.File.IsDir() {
+		return nil, nil
+	}
+	var prevTree snapshot.Tree
+	if len(e.File.Parents) > 0 {
+		parent := e.File.Parents[0]
+		parentFile, err := s.ReadSnapshot(ctx, parent)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the parent snapshot %q: %w", parent, err)
+		}
+		if parentFile.IsDir() {
+			prevTree, err = s.ListDirectorySnapshotContents(ctx, parent, parentFile)
+			if err != nil {
+				return nil, fmt.Errorf("failure listing the contents of the parent snapshot %q: %w", parent, err)
+			}
+		}
+	}
+	deleted := make(map[string]*snapshot.Hash)
+	if err := deletedFiles(ctx, s, e.Hash, e.File, prevTree, "", deleted); err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	var paths []string
+	for p := range deleted {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	lines := []string{e.Hash.String()}
+	if t, ok := e.File.Time(); ok {
+		lines = append(lines, "  deleted at: "+t.Local().Format(time.RFC3339))
+	}
+	for _, p := range paths {
+		lines = append(lines, deleteLine(p, deleted[p]))
+	}
+	return lines, nil
+}
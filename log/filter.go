@@ -0,0 +1,134 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Filter selects which entries of a log are shown.
+//
+// The zero value selects every entry.
+type Filter struct {
+	// Since, if non-zero, excludes snapshots generated before it.
+	//
+	// Snapshots that did not record the time they were generated are
+	// excluded when either `Since` or `Until` is set.
+	Since time.Time
+
+	// Until, if non-zero, excludes snapshots generated after it.
+	Until time.Time
+
+	// MaxCount, if positive, is the maximum number of entries selected.
+	MaxCount int
+
+	// Path, if non-empty, is a slash separated path relative to the
+	// logged file, and excludes snapshots in which the nested file at
+	// that path is the same as in the snapshot's first parent.
+	Path string
+}
+
+// subpathHash returns the hash of the nested snapshot at the given
+// relative path inside the snapshot `h`, or nil if there is none.
+func subpathHash(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, subpath string) (*snapshot.Hash, error) {
+	for _, name := range strings.Split(filepath.ToSlash(filepath.Clean(subpath)), "/") {
+		if len(name) == 0 || name == "." {
+			continue
+		}
+		if f == nil || !f.IsDir() {
+			return nil, nil
+		}
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return nil, fmt.Errorf("failure listing the contents of %q: %w", h, err)
+		}
+		h = tree[snapshot.Path(name)]
+		if h == nil {
+			return nil, nil
+		}
+		f, err = s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+		}
+	}
+	return h, nil
+}
+
+func (filter *Filter) matchesTime(e *LogEntry) bool {
+	if filter.Since.IsZero() && filter.Until.IsZero() {
+		return true
+	}
+	t, ok := e.File.Time()
+	if !ok {
+		return false
+	}
+	if !filter.Since.IsZero() && t.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && t.After(filter.Until) {
+		return false
+	}
+	return true
+}
+
+func (filter *Filter) matchesPath(ctx context.Context, s *storage.LocalFiles, e *LogEntry) (bool, error) {
+	if len(filter.Path) == 0 {
+		return true, nil
+	}
+	h, err := subpathHash(ctx, s, e.Hash, e.File, filter.Path)
+	if err != nil {
+		return false, err
+	}
+	var prevHash *snapshot.Hash
+	if len(e.File.Parents) > 0 {
+		parent := e.File.Parents[0]
+		parentFile, err := s.ReadSnapshot(ctx, parent)
+		if err != nil {
+			return false, fmt.Errorf("failure reading the parent snapshot %q: %w", parent, err)
+		}
+		prevHash, err = subpathHash(ctx, s, parent, parentFile, filter.Path)
+		if err != nil {
+			return false, err
+		}
+	}
+	return !h.Equal(prevHash), nil
+}
+
+// FilterLog returns the log entries that are selected by the given filter, in their original order.
+func FilterLog(ctx context.Context, s *storage.LocalFiles, entries []*LogEntry, filter *Filter) ([]*LogEntry, error) {
+	var result []*LogEntry
+	for _, e := range entries {
+		if filter.MaxCount > 0 && len(result) >= filter.MaxCount {
+			break
+		}
+		if !filter.matchesTime(e) {
+			continue
+		}
+		matched, err := filter.matchesPath(ctx, s, e)
+		if err != nil {
+			return nil, fmt.Errorf("failure checking if %q changed in %q: %w", filter.Path, e.Hash, err)
+		} else if matched {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
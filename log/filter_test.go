@@ -0,0 +1,142 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func entryHashes(entries []*LogEntry) []string {
+	var hashes []string
+	for _, e := range entries {
+		hashes = append(hashes, e.Hash.String())
+	}
+	return hashes
+}
+
+func sameHashes(entries []*LogEntry, want []*snapshot.Hash) bool {
+	if len(entries) != len(want) {
+		return false
+	}
+	for i, e := range entries {
+		if !e.Hash.Equal(want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFilterLogTime(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	var entries []*LogEntry
+	var hashes []*snapshot.Hash
+	for i := 0; i < 4; i++ {
+		h, err := snapshot.ParseHash(fmt.Sprintf("sha256:%02x", i))
+		if err != nil {
+			t.Fatalf("failure parsing the example hash: %v", err)
+		}
+		hashes = append(hashes, h)
+		entries = append(entries, &LogEntry{
+			Hash: h,
+			File: &snapshot.File{Metadata: map[string]string{
+				snapshot.TimeMetadataKey: start.Add(-time.Duration(i) * time.Hour).Format(time.RFC3339Nano),
+			}},
+		})
+	}
+	untimed, err := snapshot.ParseHash("sha256:ff")
+	if err != nil {
+		t.Fatalf("failure parsing the example hash: %v", err)
+	}
+	entries = append(entries, &LogEntry{Hash: untimed, File: &snapshot.File{}})
+
+	testCases := []struct {
+		name   string
+		filter Filter
+		want   []*snapshot.Hash
+	}{
+		{"all", Filter{}, append(hashes, untimed)},
+		{"since", Filter{Since: start.Add(-90 * time.Minute)}, hashes[:2]},
+		{"until", Filter{Until: start.Add(-90 * time.Minute)}, hashes[2:]},
+		{"range", Filter{Since: start.Add(-2 * time.Hour), Until: start.Add(-time.Hour)}, hashes[1:3]},
+		{"max count", Filter{MaxCount: 3}, hashes[:3]},
+		{"since and max count", Filter{Since: start.Add(-3 * time.Hour), MaxCount: 2}, hashes[:2]},
+	}
+	for _, tc := range testCases {
+		got, err := FilterLog(ctx, nil, entries, &tc.filter)
+		if err != nil {
+			t.Errorf("%s: failure filtering the log: %v", tc.name, err)
+		} else if !sameHashes(got, tc.want) {
+			t.Errorf("%s: unexpected entries: got %v, want %v", tc.name, entryHashes(got), tc.want)
+		}
+	}
+}
+
+func TestFilterLogPath(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	workDir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(filepath.Join(workDir, "nested"), 0700); err != nil {
+		t.Fatalf("failure creating the working directory: %v", err)
+	}
+	var hashes []*snapshot.Hash
+	for _, change := range []struct{ path, contents string }{
+		{"a.txt", "a"},
+		{filepath.Join("nested", "b.txt"), "b"},
+		{"a.txt", "a, again"},
+		{filepath.Join("nested", "b.txt"), "b, again"},
+	} {
+		if err := os.WriteFile(filepath.Join(workDir, change.path), []byte(change.contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", change.path, err)
+		}
+		h, _, err := snapshot.Current(ctx, s, snapshot.Path(workDir))
+		if err != nil {
+			t.Fatalf("failure snapshotting the working directory: %v", err)
+		}
+		hashes = append(hashes, h)
+	}
+	entries, err := ReadLog(ctx, s, hashes[3])
+	if err != nil {
+		t.Fatalf("failure reading the log: %v", err)
+	}
+	testCases := []struct {
+		name   string
+		filter Filter
+		want   []*snapshot.Hash
+	}{
+		{"file", Filter{Path: "a.txt"}, []*snapshot.Hash{hashes[2], hashes[0]}},
+		{"nested file", Filter{Path: "nested/b.txt"}, []*snapshot.Hash{hashes[3], hashes[1]}},
+		{"subtree", Filter{Path: "nested"}, []*snapshot.Hash{hashes[3], hashes[1], hashes[0]}},
+		{"missing", Filter{Path: "c.txt"}, nil},
+		{"path and max count", Filter{Path: "a.txt", MaxCount: 1}, []*snapshot.Hash{hashes[2]}},
+	}
+	for _, tc := range testCases {
+		got, err := FilterLog(ctx, s, entries, &tc.filter)
+		if err != nil {
+			t.Errorf("%s: failure filtering the log: %v", tc.name, err)
+		} else if !sameHashes(got, tc.want) {
+			t.Errorf("%s: unexpected entries: got %v, want %v", tc.name, entryHashes(got), tc.want)
+		}
+	}
+}
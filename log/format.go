@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// RelativeTime describes how long before `now` the time `t` was, such as "2 hours ago".
+//
+// Times more than a minute after `now` are given as a date and time instead.
+func RelativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < -time.Minute {
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	const day = 24 * time.Hour
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int64(d/time.Minute), "minute")
+	case d < day:
+		return plural(int64(d/time.Hour), "hour")
+	case d < 14*day:
+		return plural(int64(d/day), "day")
+	case d < 60*day:
+		return plural(int64(d/(7*day)), "week")
+	case d < 365*day:
+		return plural(int64(d/(30*day)), "month")
+	}
+	return plural(int64(d/(365*day)), "year")
+}
+
+// Changes lists the files that changed between the first parent of the log entry and the entry itself.
+//
+// If the entry has no parents, then every file in it is reported as added.
+func (e *LogEntry) Changes(ctx context.Context, s *storage.LocalFiles) ([]*diff.Change, error) {
+	var parent *snapshot.Hash
+	if len(e.File.Parents) > 0 {
+		parent = e.File.Parents[0]
+	}
+	changes, err := diff.Compare(ctx, s, parent, e.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failure comparing %q to its parent: %w", e.Hash, err)
+	}
+	return changes, nil
+}
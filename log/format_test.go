@@ -0,0 +1,46 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{ago: 10 * time.Second, want: "just now"},
+		{ago: time.Minute, want: "1 minute ago"},
+		{ago: 59 * time.Minute, want: "59 minutes ago"},
+		{ago: 2*time.Hour + 30*time.Minute, want: "2 hours ago"},
+		{ago: 3 * 24 * time.Hour, want: "3 days ago"},
+		{ago: 20 * 24 * time.Hour, want: "2 weeks ago"},
+		{ago: 90 * 24 * time.Hour, want: "3 months ago"},
+		{ago: 800 * 24 * time.Hour, want: "2 years ago"},
+	}
+	for _, tc := range testCases {
+		if got := RelativeTime(now.Add(-tc.ago), now); got != tc.want {
+			t.Errorf("unexpected relative time for %v ago: got %q, want %q", tc.ago, got, tc.want)
+		}
+	}
+	future := now.Add(time.Hour)
+	if got, want := RelativeTime(future, now), future.Local().Format("2006-01-02 15:04"); got != want {
+		t.Errorf("unexpected relative time for a future time: got %q, want %q", got, want)
+	}
+}
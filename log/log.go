@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"sort"
 	"syscall"
+	"time"
 
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
@@ -58,12 +59,12 @@ type LogEntry struct {
 func dirContents(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, subpath string, includeDirectories bool, contentsMap map[string]*snapshot.Hash) error {
 	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
 	if err != nil {
-		return fmt.Errorf("failure listing the directory contents of the snapshot %q: %v", h, err)
+		return fmt.Errorf("failure listing the directory contents of the snapshot %q: %w", h, err)
 	}
 	for p, ph := range tree {
 		child, err := s.ReadSnapshot(ctx, ph)
 		if err != nil {
-			return fmt.Errorf("failure reading the file snapshot for %q: %v", p, err)
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", p, err)
 		}
 		childPath := filepath.Join(subpath, string(p))
 		if child.IsDir() {
@@ -71,7 +72,7 @@ func dirContents(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f
 				contentsMap[childPath] = ph
 			}
 			if err := dirContents(ctx, s, ph, child, childPath, includeDirectories, contentsMap); err != nil {
-				return fmt.Errorf("failure enumerating the contents of %q: %v", p, err)
+				return fmt.Errorf("failure enumerating the contents of %q: %w", p, err)
 			}
 		} else {
 			contentsMap[childPath] = ph
@@ -95,7 +96,7 @@ func (e *LogEntry) NestedContents(ctx context.Context, s *storage.LocalFiles, in
 	paths := []string{}
 	contentsMap := make(map[string]*snapshot.Hash)
 	if err := dirContents(ctx, s, e.Hash, e.File, "", includeDirectories, contentsMap); err != nil {
-		return nil, nil, fmt.Errorf("failure reading the nested contents for %q: %v", e.Hash, err)
+		return nil, nil, fmt.Errorf("failure reading the nested contents for %q: %w", e.Hash, err)
 	}
 	for path, _ := range contentsMap {
 		paths = append(paths, path)
@@ -107,7 +108,7 @@ func (e *LogEntry) NestedContents(ctx context.Context, s *storage.LocalFiles, in
 }
 
 func deleteLine(deletedPath string, deletedHash *snapshot.Hash) string {
-	coreText := fmt.Sprintf("  -%s(%s)", deletedPath, deletedHash)
+	coreText := fmt.Sprintf("  -%s(%s)", snapshot.Path(deletedPath).Display(), deletedHash)
 	if !term.IsTerminal(syscall.Stdout) {
 		return coreText
 	}
@@ -116,7 +117,7 @@ func deleteLine(deletedPath string, deletedHash *snapshot.Hash) string {
 }
 
 func insertLine(insertedPath string, insertedHash *snapshot.Hash) string {
-	coreText := fmt.Sprintf("  +%s(%s)", insertedPath, insertedHash)
+	coreText := fmt.Sprintf("  +%s(%s)", snapshot.Path(insertedPath).Display(), insertedHash)
 	if !term.IsTerminal(syscall.Stdout) {
 		return coreText
 	}
@@ -159,7 +160,7 @@ func SummarizeLog(ctx context.Context, s *storage.LocalFiles, entries []*LogEntr
 	for _, e := range entries {
 		paths, contents, err := e.NestedContents(ctx, s, false)
 		if err != nil {
-			return nil, fmt.Errorf("failure reading the nested contents of snapshot %q: %v", e.Hash, err)
+			return nil, fmt.Errorf("failure reading the nested contents of snapshot %q: %w", e.Hash, err)
 		}
 		if paths != nil && contents != nil {
 			pathsMap[*e.Hash] = paths
@@ -176,6 +177,15 @@ func SummarizeLog(ctx context.Context, s *storage.LocalFiles, entries []*LogEntr
 			prevContents = contentsMap[*firstParent]
 		}
 		summary := []string{e.Hash.String()}
+		if author, ok := e.File.Metadata[snapshot.AuthorMetadataKey]; ok {
+			summary = append(summary, "  author: "+author)
+		}
+		if t, ok := e.File.Time(); ok {
+			summary = append(summary, "  time: "+t.Local().Format(time.RFC3339))
+		}
+		if version, ok := e.File.Metadata[snapshot.VersionMetadataKey]; ok {
+			summary = append(summary, "  rvcs version: "+version)
+		}
 		contents, contentsOk := contentsMap[*e.Hash]
 		paths, pathsOk := pathsMap[*e.Hash]
 		if contentsOk && pathsOk {
@@ -192,9 +202,13 @@ func ReadLog(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]*L
 	result := []*LogEntry{}
 	for len(queue) > 0 {
 		h, queue = queue[0], queue[1:]
+		if _, ok := visited[*h]; ok {
+			// The snapshot was reachable via multiple parents, and was already added.
+			continue
+		}
 		f, err := s.ReadSnapshot(ctx, h)
 		if err != nil {
-			return nil, fmt.Errorf("failure reading the snapshot for %q: %v", h, err)
+			return nil, fmt.Errorf("failure reading the snapshot for %q: %w", h, err)
 		}
 		visited[*h] = f
 		result = append(result, &LogEntry{
@@ -16,13 +16,15 @@
 package merge
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/google/recursive-version-control-system/filter"
 	"github.com/google/recursive-version-control-system/log"
 	"github.com/google/recursive-version-control-system/snapshot"
 	"github.com/google/recursive-version-control-system/storage"
@@ -31,79 +33,270 @@ import (
 func recreateLink(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, p snapshot.Path) error {
 	contentsReader, err := s.ReadObject(ctx, f.Contents)
 	if err != nil {
-		return fmt.Errorf("failure opening the contents of the link snapshot %q: %v", h, err)
+		return fmt.Errorf("failure opening the contents of the link snapshot %q: %w", h, err)
 	}
 	contents, err := io.ReadAll(contentsReader)
 	if err != nil {
-		return fmt.Errorf("failure reading the contents of the link snapshot %q: %v", h, err)
+		return fmt.Errorf("failure reading the contents of the link snapshot %q: %w", h, err)
 	}
 	if err := os.Symlink(string(contents), string(p)); err != nil {
-		return fmt.Errorf("failure recreating the symling %q: %v", h, err)
+		return fmt.Errorf("failure recreating the symling %q: %w", h, err)
 	}
 	return nil
 }
 
-func recreateDir(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, p snapshot.Path) error {
+// recreateDir recreates the directory snapshot `h` at the path `p`.
+//
+// The directory itself is always created before any of its children,
+// which may then be recreated concurrently.
+func recreateDir(ctx context.Context, s *storage.LocalFiles, o *options, h *snapshot.Hash, f *snapshot.File, p snapshot.Path, record bool) error {
 	perm := f.Permissions()
 	if err := os.Mkdir(string(p), perm); err != nil {
-		return fmt.Errorf("failure creating the directory %q: %v", p, err)
+		return fmt.Errorf("failure creating the directory %q: %w", p, err)
 	}
 	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
 	if err != nil {
-		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %v", h, err)
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", h, err)
+	}
+	recreateChild := checkout
+	if !record {
+		recreateChild = extract
+	}
+	var children []snapshot.Path
+	for child := range tree {
+		children = append(children, child)
 	}
-	for child, childHash := range tree {
-		childPath := p.Join(child)
-		if err := Checkout(ctx, s, childHash, childPath); err != nil {
-			return fmt.Errorf("failure checking out the child path %q: %v", childPath, err)
+	childErrs := o.forEach(len(children), func(i int) error {
+		return recreateChild(ctx, s, o, tree[children[i]], p.Join(children[i]))
+	})
+	for i, err := range childErrs {
+		if err != nil {
+			return fmt.Errorf("failure checking out the child path %q: %w", p.Join(children[i]), err)
 		}
 	}
+	if err := restoreXattrs(ctx, s, nil, f, p); err != nil {
+		return err
+	}
+	return restoreDirectoryTime(f, p)
+}
+
+// restoreDirectoryTime sets the modification time of the directory `p` to the one recorded in `f`, if any.
+//
+// This must be called after the contents of the directory have been
+// written, since writing them updates the modification time.
+func restoreDirectoryTime(f *snapshot.File, p snapshot.Path) error {
+	mtime, ok := f.DirectoryTime()
+	if !ok {
+		return nil
+	}
+	if err := os.Chtimes(string(p), mtime, mtime); err != nil {
+		return fmt.Errorf("failure restoring the modification time of the directory %q: %w", p, err)
+	}
 	return nil
 }
 
-func recreateFile(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, f *snapshot.File, p snapshot.Path) error {
+func recreateFile(ctx context.Context, s *storage.LocalFiles, o *options, h *snapshot.Hash, f *snapshot.File, p snapshot.Path, record bool) error {
 	if f.IsLink() {
 		return recreateLink(ctx, s, h, f, p)
 	}
 	if f.IsDir() {
-		return recreateDir(ctx, s, h, f, p)
+		return recreateDir(ctx, s, o, h, f, p, record)
 	}
 	perm := f.Permissions()
 	contentsReader, err := s.ReadObject(ctx, f.Contents)
 	if err != nil {
-		return fmt.Errorf("failure opening the contents of the link snapshot %q: %v", h, err)
+		return fmt.Errorf("failure opening the contents of the link snapshot %q: %w", h, err)
 	}
 	out, err := os.OpenFile(string(p), os.O_RDWR|os.O_CREATE, perm)
 	if err != nil {
-		return fmt.Errorf("failure opening the file %q: %v", p, err)
+		return fmt.Errorf("failure opening the file %q: %w", p, err)
 	}
-	if _, err := io.Copy(out, contentsReader); err != nil {
-		return fmt.Errorf("failure writing the contents of %q: %v", p, err)
+	if filterName, ok := f.Metadata[snapshot.FilterMetadataKey]; ok {
+		contentFilter, err := filter.Find(s, filterName)
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("failure looking up the content filter for %q: %w", p, err)
+		}
+		if err := contentFilter.Smudge(ctx, contentsReader, out); err != nil {
+			out.Close()
+			return fmt.Errorf("failure writing the filtered contents of %q: %w", p, err)
+		}
+	} else if _, err := io.Copy(out, contentsReader); err != nil {
+		out.Close()
+		return fmt.Errorf("failure writing the contents of %q: %w", p, err)
 	}
 	if err := out.Close(); err != nil {
-		return fmt.Errorf("failure closing the file %q: %v", p, err)
+		return fmt.Errorf("failure closing the file %q: %w", p, err)
 	}
-	return nil
+	return restoreXattrs(ctx, s, nil, f, p)
+}
+
+// Checkout writes the contents of the snapshot `h` to the path `p`, and records `p` as the location of the snapshot.
+//
+// Of the given options, only `WithJobs` is used.
+func Checkout(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, p snapshot.Path, opts ...Option) error {
+	return checkout(ctx, s, newOptions(opts), h, p)
 }
 
-func Checkout(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, p snapshot.Path) error {
+func checkout(ctx context.Context, s *storage.LocalFiles, o *options, h *snapshot.Hash, p snapshot.Path) error {
 	f, err := s.ReadSnapshot(ctx, h)
 	if err != nil {
-		return fmt.Errorf("failure reading the file snapshot for %q: %v", h, err)
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
 	}
 	if f == nil {
 		// The source file does not exist; nothing for us to do.
 		return nil
 	}
-	if err := recreateFile(ctx, s, h, f, p); err != nil {
-		return fmt.Errorf("failure checking out the snapshot %q to the path %q: %v", h, p, err)
+	if err := recreateFile(ctx, s, o, h, f, p, true); err != nil {
+		return fmt.Errorf("failure checking out the snapshot %q to the path %q: %w", h, p, err)
 	}
 	if _, err := s.StoreSnapshot(ctx, p, f); err != nil {
-		return fmt.Errorf("failure updating the snapshot for %q to %q: %v", p, h, err)
+		return fmt.Errorf("failure updating the snapshot for %q to %q: %w", p, h, err)
 	}
 	return nil
 }
 
+// Extract writes the contents of the snapshot `h` to the path `p`.
+//
+// Unlike `Checkout`, this does not record `p` as the location of the
+// snapshot, so it is suitable for writing snapshots to temporary locations.
+//
+// Of the given options, only `WithJobs` is used.
+func Extract(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, p snapshot.Path, opts ...Option) error {
+	return extract(ctx, s, newOptions(opts), h, p)
+}
+
+func extract(ctx context.Context, s *storage.LocalFiles, o *options, h *snapshot.Hash, p snapshot.Path) error {
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+	}
+	if f == nil {
+		// The source file does not exist; nothing for us to do.
+		return nil
+	}
+	if err := recreateFile(ctx, s, o, h, f, p, false); err != nil {
+		return fmt.Errorf("failure extracting the snapshot %q to the path %q: %w", h, p, err)
+	}
+	return nil
+}
+
+// UpdateExtracted updates the files at `p`, previously extracted from
+// the snapshot `prev`, to match the snapshot `h`.
+//
+// Only the files that differ between the two snapshots are rewritten,
+// so this is much cheaper than extracting `h` from scratch when most
+// files are unchanged. Any local modifications made to the files since
+// they were extracted are not detected.
+//
+// If `prev` is nil, then this is equivalent to `Extract`, except that any
+// existing file at `p` is replaced. If `h` is nil, then `p` is removed.
+func UpdateExtracted(ctx context.Context, s *storage.LocalFiles, prev, h *snapshot.Hash, p snapshot.Path) error {
+	return update(ctx, s, newOptions(nil), prev, h, p, false)
+}
+
+// update updates the files at `p`, which currently match the snapshot `prev`, to match the snapshot `h`.
+//
+// Files whose mode and contents are the same in both snapshots are not
+// rewritten, even if their histories differ. If `record` is true, then
+// each updated path is recorded as the location of its new snapshot.
+func update(ctx context.Context, s *storage.LocalFiles, o *options, prev, h *snapshot.Hash, p snapshot.Path, record bool) error {
+	info, statErr := os.Lstat(string(p))
+	if statErr == nil && prev.Equal(h) {
+		return nil
+	}
+	if h == nil {
+		if err := os.RemoveAll(string(p)); err != nil {
+			return fmt.Errorf("failure removing %q: %w", p, err)
+		}
+		return nil
+	}
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+	}
+	var prevFile *snapshot.File
+	if prev != nil && statErr == nil {
+		if prevFile, err = s.ReadSnapshot(ctx, prev); err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", prev, err)
+		}
+	}
+	recordUpdate := func() error {
+		if !record {
+			return nil
+		}
+		if _, err := s.StoreSnapshot(ctx, p, f); err != nil {
+			return fmt.Errorf("failure updating the snapshot for %q to %q: %w", p, h, err)
+		}
+		return nil
+	}
+	if !f.IsDir() && prevFile != nil && prevFile.Mode == f.Mode && prevFile.Contents.Equal(f.Contents) {
+		// The file on disk already matches the snapshot, except possibly for its extended attributes.
+		if err := restoreXattrs(ctx, s, prevFile, f, p); err != nil {
+			return err
+		}
+		return recordUpdate()
+	}
+	if !f.IsDir() || prevFile == nil || !prevFile.IsDir() || !info.IsDir() {
+		if err := os.RemoveAll(string(p)); err != nil {
+			return fmt.Errorf("failure removing the previous contents of %q: %w", p, err)
+		}
+		if record {
+			return checkout(ctx, s, o, h, p)
+		}
+		return extract(ctx, s, o, h, p)
+	}
+	if perm := f.Permissions(); perm != info.Mode().Perm() {
+		if err := os.Chmod(string(p), perm); err != nil {
+			return fmt.Errorf("failure updating the permissions of %q: %w", p, err)
+		}
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", h, err)
+	}
+	prevTree, err := s.ListDirectorySnapshotContents(ctx, prev, prevFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", prev, err)
+	}
+	var children []snapshot.Path
+	for child := range tree {
+		children = append(children, child)
+	}
+	childErrs := o.forEach(len(children), func(i int) error {
+		child := children[i]
+		return update(ctx, s, o, prevTree[child], tree[child], p.Join(child), record)
+	})
+	for _, err := range childErrs {
+		if err != nil {
+			return err
+		}
+	}
+	for child := range prevTree {
+		if _, ok := tree[child]; !ok {
+			if err := os.RemoveAll(string(p.Join(child))); err != nil {
+				return fmt.Errorf("failure removing %q: %w", p.Join(child), err)
+			}
+		}
+	}
+	if err := restoreXattrs(ctx, s, prevFile, f, p); err != nil {
+		return err
+	}
+	if err := restoreDirectoryTime(f, p); err != nil {
+		return err
+	}
+	return recordUpdate()
+}
+
+// current snapshots the given path, applying the content filters configured for the store.
+func current(ctx context.Context, s *storage.LocalFiles, o *options, p snapshot.Path) (*snapshot.Hash, *snapshot.File, error) {
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot.NewSnapshotter(s, append(o.snapshotOptions, filterOpt)...).Snapshot(ctx, p)
+}
+
 func MergeBase(ctx context.Context, s *storage.LocalFiles, lhs, rhs *snapshot.Hash) (*snapshot.Hash, error) {
 	if lhs.Equal(rhs) {
 		return lhs, nil
@@ -113,7 +306,7 @@ func MergeBase(ctx context.Context, s *storage.LocalFiles, lhs, rhs *snapshot.Ha
 	}
 	lhsLog, err := log.ReadLog(ctx, s, lhs)
 	if err != nil {
-		return nil, fmt.Errorf("failure reading the log for %q: %v", lhs, err)
+		return nil, fmt.Errorf("failure reading the log for %q: %w", lhs, err)
 	}
 	lhsAncestors := make(map[snapshot.Hash]struct{})
 	for _, e := range lhsLog {
@@ -121,7 +314,7 @@ func MergeBase(ctx context.Context, s *storage.LocalFiles, lhs, rhs *snapshot.Ha
 	}
 	rhsLog, err := log.ReadLog(ctx, s, rhs)
 	if err != nil {
-		return nil, fmt.Errorf("failure reading the log for %q: %v", rhs, err)
+		return nil, fmt.Errorf("failure reading the log for %q: %w", rhs, err)
 	}
 	rhsAncestors := make(map[snapshot.Hash]struct{})
 	for _, e := range rhsLog {
@@ -141,33 +334,280 @@ func MergeBase(ctx context.Context, s *storage.LocalFiles, lhs, rhs *snapshot.Ha
 	return nil, nil
 }
 
-func Merge(ctx context.Context, s *storage.LocalFiles, src *snapshot.Hash, dest snapshot.Path) error {
+// Resolver resolves a conflict between two versions of a regular file.
+//
+// The `base`, `local`, and `remote` paths hold the contents of the merge
+// base, the destination, and the source respectively. The base file is
+// empty if the two versions have no common ancestor.
+//
+// The `merged` path initially holds the contents of the destination, and
+// the resolver must leave the merged contents there before returning.
+// The merge fails if those contents still contain conflict markers.
+type Resolver func(ctx context.Context, base, local, remote, merged snapshot.Path) error
+
+type options struct {
+	resolver        Resolver
+	strategy        Strategy
+	snapshotOptions []snapshot.Option
+	workers         chan struct{}
+}
+
+// Option configures how snapshots are merged.
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		workers: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithResolver sets the function used to resolve conflicting changes to a regular file.
+func WithResolver(r Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithSnapshotOptions sets additional options used when snapshotting the merge destination.
+//
+// The content filters configured for the store are always applied.
+func WithSnapshotOptions(opts ...snapshot.Option) Option {
+	return func(o *options) {
+		o.snapshotOptions = append(o.snapshotOptions, opts...)
+	}
+}
+
+// forEach calls `fn` for each index from 0 to `n`-1, using any free
+// workers to make the calls concurrently.
+//
+// The returned slice holds the error returned by each call.
+func (o *options) forEach(n int, fn func(int) error) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		select {
+		case o.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-o.workers
+					wg.Done()
+				}()
+				errs[i] = fn(i)
+			}()
+		default:
+			// No workers are free, so make the call in this goroutine.
+			errs[i] = fn(i)
+		}
+	}
+	wg.Wait()
+	return errs
+}
+
+// WithJobs sets the maximum number of files that are restored at the same time.
+//
+// The default is 1, meaning files are restored sequentially.
+func WithJobs(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		// The goroutine doing the restore counts as one of the workers.
+		o.workers = make(chan struct{}, n-1)
+	}
+}
+
+// recordMerge snapshots the merged contents of `dest`, recording `destPrev` and `src` as its parents.
+//
+// If the merge left the contents of `dest` unchanged, then the snapshot
+// returned for it is `destPrev` itself, so the parents are always set
+// explicitly rather than added to the ones of the returned snapshot.
+func recordMerge(ctx context.Context, s *storage.LocalFiles, o *options, src, destPrev *snapshot.Hash, dest snapshot.Path) error {
+	_, merged, err := current(ctx, s, o, dest)
+	if err != nil {
+		return fmt.Errorf("failure snapshotting the merged contents of %q: %w", dest, err)
+	}
+	// Copy the snapshot so that neither its parents nor its metadata are shared with the one that was read.
+	f := *merged
+	f.Parents = []*snapshot.Hash{destPrev, src}
+	f.Metadata = make(map[string]string)
+	for k, v := range merged.Metadata {
+		f.Metadata[k] = v
+	}
+	if len(o.strategy) > 0 {
+		f.Metadata[snapshot.MergeStrategyMetadataKey] = string(o.strategy)
+	}
+	if _, err := s.StoreSnapshot(ctx, dest, &f); err != nil {
+		return fmt.Errorf("failure recording %q as a parent of the merged snapshot: %w", src, err)
+	}
+	return nil
+}
+
+func resolveConflict(ctx context.Context, s *storage.LocalFiles, o *options, base, src, destPrev *snapshot.Hash, dest snapshot.Path) (err error) {
+	if len(o.strategy) == 0 {
+		kind, err := overlap(ctx, s, base, src, destPrev)
+		if err != nil {
+			return fmt.Errorf("failure comparing the changes made in %q and %q: %w", src, destPrev, err)
+		}
+		switch kind {
+		case noConflict:
+			// No file was changed in conflicting ways, so the strategy is never consulted.
+			if err := applyStrategy(ctx, s, o, base, src, destPrev, dest); err != nil {
+				return fmt.Errorf("failure merging the disjoint changes made in %q and %q: %w", src, destPrev, err)
+			}
+			return recordMerge(ctx, s, o, src, destPrev, dest)
+		case metadataConflict:
+			return fmt.Errorf("%w: both sides changed the permissions of the same files", ErrMetadataConflict)
+		}
+	}
+	if len(o.strategy) > 0 {
+		if err := applyStrategy(ctx, s, o, base, src, destPrev, dest); err != nil {
+			return fmt.Errorf("failure applying the %q merge strategy: %w", o.strategy, err)
+		}
+		return recordMerge(ctx, s, o, src, destPrev, dest)
+	}
+	if o.resolver == nil {
+		return fmt.Errorf("%w: automatic merging into an already existing destination is not yet supported", storage.ErrConflict)
+	}
+	srcFile, err := s.ReadSnapshot(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+	}
+	destFile, err := s.ReadSnapshot(ctx, destPrev)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", destPrev, err)
+	}
+	if srcFile.IsDir() || srcFile.IsLink() || destFile.IsDir() || destFile.IsLink() {
+		return fmt.Errorf("%w: merging conflicting changes is only supported for regular files", storage.ErrConflict)
+	}
+	baseFile, err := readBase(ctx, s, base)
+	if err != nil {
+		return err
+	}
+	perm := destFile.Permissions()
+	if m := mergeFile(baseFile, srcFile, destFile); m != nil {
+		if m.modeConflict {
+			return fmt.Errorf("%w: both sides changed the permissions of %q", ErrMetadataConflict, dest)
+		}
+		perm = m.perm
+	}
+	tmpDir, err := os.MkdirTemp("", "rvcs-merge")
+	if err != nil {
+		return fmt.Errorf("failure creating a temporary directory for the merge: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmp := snapshot.Path(tmpDir)
+	basePath, localPath, remotePath, mergedPath := tmp.Join("base"), tmp.Join("local"), tmp.Join("remote"), tmp.Join("merged")
+	if base == nil {
+		if err := os.WriteFile(string(basePath), nil, 0600); err != nil {
+			return fmt.Errorf("failure creating an empty merge base: %w", err)
+		}
+	} else if err := Extract(ctx, s, base, basePath); err != nil {
+		return fmt.Errorf("failure extracting the merge base %q: %w", base, err)
+	}
+	if err := Extract(ctx, s, destPrev, localPath); err != nil {
+		return fmt.Errorf("failure extracting the destination snapshot %q: %w", destPrev, err)
+	}
+	if err := Extract(ctx, s, src, remotePath); err != nil {
+		return fmt.Errorf("failure extracting the source snapshot %q: %w", src, err)
+	}
+	if err := Extract(ctx, s, destPrev, mergedPath); err != nil {
+		return fmt.Errorf("failure extracting the destination snapshot %q: %w", destPrev, err)
+	}
+	if err := o.resolver(ctx, basePath, localPath, remotePath, mergedPath); err != nil {
+		return fmt.Errorf("failure resolving the conflict between %q and %q: %w", src, destPrev, err)
+	}
+	merged, err := os.ReadFile(string(mergedPath))
+	if err != nil {
+		return fmt.Errorf("failure reading the merged contents: %w", err)
+	}
+	if hasConflictMarkers(merged) {
+		return fmt.Errorf("%w: the resolved contents of %q still contain conflict markers", storage.ErrConflict, dest)
+	}
+	if err := os.WriteFile(string(dest), merged, perm); err != nil {
+		return fmt.Errorf("failure writing the merged contents to %q: %w", dest, err)
+	}
+	if err := os.Chmod(string(dest), perm); err != nil {
+		return fmt.Errorf("failure updating the permissions of %q: %w", dest, err)
+	}
+	return recordMerge(ctx, s, o, src, destPrev, dest)
+}
+
+// hasConflictMarkers reports whether `contents` contain an unresolved conflict delimited by the markers that merge tools write.
+func hasConflictMarkers(contents []byte) bool {
+	var start, separator bool
+	for _, line := range bytes.Split(contents, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		switch {
+		case bytes.HasPrefix(line, []byte("<<<<<<<")):
+			start = true
+		case start && bytes.Equal(line, []byte("=======")):
+			separator = true
+		case separator && bytes.HasPrefix(line, []byte(">>>>>>>")):
+			return true
+		}
+	}
+	return false
+}
+
+func Merge(ctx context.Context, s *storage.LocalFiles, src *snapshot.Hash, dest snapshot.Path, opts ...Option) error {
+	o := newOptions(opts)
 	destParent := filepath.Dir(string(dest))
 	if err := os.MkdirAll(destParent, os.FileMode(0700)); err != nil {
-		return fmt.Errorf("failure ensuring the parent directory of %q exists: %v", dest, err)
+		return fmt.Errorf("failure ensuring the parent directory of %q exists: %w", dest, err)
 	}
-	destPrevHash, _, err := snapshot.Current(ctx, s, dest)
+	destPrevHash, _, err := current(ctx, s, o, dest)
 	if err != nil {
-		return fmt.Errorf("failure generating snapshot of destination %q prior to merging: %v", dest, err)
+		return fmt.Errorf("failure generating snapshot of destination %q prior to merging: %w", dest, err)
 	}
 	if destPrevHash == nil {
 		// The destination does not exist; simply check out the source hash there.
-		return Checkout(ctx, s, src, dest)
+		return checkout(ctx, s, o, src, dest)
 	}
 	mergeBase, err := MergeBase(ctx, s, src, destPrevHash)
 	if err != nil {
-		return fmt.Errorf("failure determining the merge base for %q and %q: %v", src, destPrevHash, err)
+		return fmt.Errorf("failure determining the merge base for %q and %q: %w", src, destPrevHash, err)
 	}
 	if mergeBase.Equal(src) {
 		// The source has already been merged in
 		return nil
 	}
 	if mergeBase.Equal(destPrevHash) {
-		// Simply update the destination to point to the target
-		if err := os.RemoveAll(string(dest)); err != nil {
-			return fmt.Errorf("failure updating %q to point to newer snapshot %q; failure removing old files: %v", dest, src, err)
+		// Simply update the destination to point to the target, only
+		// rewriting the files that differ from what is already there.
+		if err := update(ctx, s, o, destPrevHash, src, dest, true); err != nil {
+			return fmt.Errorf("failure updating %q to point to newer snapshot %q: %w", dest, src, err)
 		}
-		return Checkout(ctx, s, src, dest)
+		return nil
+	}
+	return resolveConflict(ctx, s, o, mergeBase, src, destPrevHash, dest)
+}
+
+// Restore updates the path `dest` to match the snapshot `src`, and records `dest` as the location of `src`.
+//
+// Unlike `Merge`, this discards any changes made to `dest` that are not
+// in `src`, even if `dest` has a newer history. The destination is
+// snapshotted first so that those changes remain in the archive, and the
+// hash of that snapshot is returned. It is nil if `dest` did not exist.
+//
+// Only the files that differ from `src` are rewritten.
+func Restore(ctx context.Context, s *storage.LocalFiles, src *snapshot.Hash, dest snapshot.Path, opts ...Option) (*snapshot.Hash, error) {
+	o := newOptions(opts)
+	destParent := filepath.Dir(string(dest))
+	if err := os.MkdirAll(destParent, os.FileMode(0700)); err != nil {
+		return nil, fmt.Errorf("failure ensuring the parent directory of %q exists: %w", dest, err)
+	}
+	destPrevHash, _, err := current(ctx, s, o, dest)
+	if err != nil {
+		return nil, fmt.Errorf("failure generating snapshot of destination %q prior to restoring: %w", dest, err)
+	}
+	if err := update(ctx, s, o, destPrevHash, src, dest, true); err != nil {
+		return destPrevHash, fmt.Errorf("failure restoring %q to the snapshot %q: %w", dest, src, err)
 	}
-	return errors.New("automatic merging into an already existing destination is not yet supported")
+	return destPrevHash, nil
 }
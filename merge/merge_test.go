@@ -0,0 +1,531 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestExtractConcurrently(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	want := make(map[string]string)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			name := filepath.Join(fmt.Sprintf("dir-%d", i), fmt.Sprintf("file-%d", j))
+			want[name] = fmt.Sprintf("contents %d/%d", i, j)
+		}
+	}
+	for name, contents := range want {
+		if err := os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0700); err != nil {
+			t.Fatalf("failure creating the parent directory of %q: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Extract(ctx, s, h, snapshot.Path(dest), WithJobs(4)); err != nil {
+		t.Fatalf("failure extracting the snapshot: %v", err)
+	}
+	for name, contents := range want {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Errorf("failure reading the extracted file %q: %v", name, err)
+		} else if string(got) != contents {
+			t.Errorf("unexpected contents for the extracted file %q: got %q, want %q", name, got, contents)
+		}
+	}
+}
+
+func TestExtractDirectoryMetadata(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	empty := filepath.Join(src, "empty")
+	if err := os.MkdirAll(empty, 0750); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "file.txt"), []byte("contents"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	mtime := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	for _, p := range []string{empty, src} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("failure setting the modification time of %q: %v", p, err)
+		}
+	}
+	h, _, err := snapshot.NewSnapshotter(s, snapshot.WithDirectoryTimes(true)).Snapshot(ctx, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Extract(ctx, s, h, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure extracting the snapshot: %v", err)
+	}
+	for _, p := range []string{filepath.Join(dest, "empty"), dest} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("failure reading the extracted directory %q: %v", p, err)
+		}
+		if !info.IsDir() {
+			t.Errorf("the extracted path %q is not a directory", p)
+		}
+		if got := info.ModTime(); !got.Equal(mtime) {
+			t.Errorf("unexpected modification time for %q: got %v, want %v", p, got, mtime)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "empty")); err == nil {
+		if got, want := info.Mode().Perm(), os.FileMode(0750); got != want {
+			t.Errorf("unexpected permissions for the extracted empty directory: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeOnlyRewritesChangedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	for _, name := range []string{"unchanged", "changed"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("original"), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the source directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure checking out the initial snapshot: %v", err)
+	}
+	before, err := os.Stat(filepath.Join(dest, "unchanged"))
+	if err != nil {
+		t.Fatalf("failure reading the file info of the unchanged file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "changed"), []byte("updated"), 0600); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	if err := Merge(ctx, s, h2, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure merging the updated snapshot: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "changed")); err != nil {
+		t.Errorf("failure reading the changed file: %v", err)
+	} else if string(got) != "updated" {
+		t.Errorf("unexpected contents for the changed file: got %q, want %q", got, "updated")
+	}
+	after, err := os.Stat(filepath.Join(dest, "unchanged"))
+	if err != nil {
+		t.Fatalf("failure reading the file info of the unchanged file: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("the unchanged file was unexpectedly rewritten")
+	}
+	if got, _, err := s.FindSnapshot(ctx, snapshot.Path(dest)); err != nil {
+		t.Errorf("failure looking up the snapshot of the destination: %v", err)
+	} else if !got.Equal(h2) {
+		t.Errorf("unexpected snapshot recorded for the destination: got %q, want %q", got, h2)
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		strategy Strategy
+		want     string
+	}{
+		{StrategyOurs, "ours"},
+		{StrategyTheirs, "theirs"},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			dir := t.TempDir()
+			s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+			src := filepath.Join(dir, "src")
+			if err := os.Mkdir(src, 0700); err != nil {
+				t.Fatalf("failure creating the source directory: %v", err)
+			}
+			for _, name := range []string{"both", "src-only", "dest-only"} {
+				if err := os.WriteFile(filepath.Join(src, name), []byte("original"), 0600); err != nil {
+					t.Fatalf("failure creating the example file %q: %v", name, err)
+				}
+			}
+			h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+			if err != nil {
+				t.Fatalf("failure snapshotting the source directory: %v", err)
+			}
+			dest := filepath.Join(dir, "dest")
+			if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+				t.Fatalf("failure checking out the initial snapshot: %v", err)
+			}
+			changes := map[string]string{
+				filepath.Join(src, "both"):       "theirs",
+				filepath.Join(src, "src-only"):   "src change",
+				filepath.Join(dest, "both"):      "ours",
+				filepath.Join(dest, "dest-only"): "dest change",
+			}
+			for file, contents := range changes {
+				if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+					t.Fatalf("failure updating the example file %q: %v", file, err)
+				}
+			}
+			h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+			if err != nil {
+				t.Fatalf("failure resnapshotting the source directory: %v", err)
+			}
+			if err := Merge(ctx, s, h2, snapshot.Path(dest), WithStrategy(tc.strategy)); err != nil {
+				t.Fatalf("failure merging the updated snapshot: %v", err)
+			}
+			for name, want := range map[string]string{"both": tc.want, "src-only": "src change", "dest-only": "dest change"} {
+				if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil {
+					t.Errorf("failure reading the merged file %q: %v", name, err)
+				} else if string(got) != want {
+					t.Errorf("unexpected contents for the merged file %q: got %q, want %q", name, got, want)
+				}
+			}
+			_, f, err := s.FindSnapshot(ctx, snapshot.Path(dest))
+			if err != nil {
+				t.Fatalf("failure looking up the merge snapshot: %v", err)
+			}
+			if got := f.Metadata[snapshot.MergeStrategyMetadataKey]; got != string(tc.strategy) {
+				t.Errorf("unexpected merge strategy recorded: got %q, want %q", got, tc.strategy)
+			}
+			if len(f.Parents) != 2 || !f.Parents[1].Equal(h2) {
+				t.Errorf("unexpected parents of the merge snapshot: %v", f.Parents)
+			}
+		})
+	}
+	if _, err := ParseStrategy("mine"); err == nil {
+		t.Error("unexpectedly parsed an unknown merge strategy")
+	}
+}
+
+func TestMergeUnchangedDestination(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "file"), []byte("original"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the source directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure checking out the initial snapshot: %v", err)
+	}
+	for file, contents := range map[string]string{filepath.Join(src, "file"): "theirs", filepath.Join(dest, "file"): "ours"} {
+		if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure updating the example file %q: %v", file, err)
+		}
+	}
+	h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	destPrev, _, err := snapshot.Current(ctx, s, snapshot.Path(dest))
+	if err != nil {
+		t.Fatalf("failure snapshotting the destination directory: %v", err)
+	}
+
+	// Keeping our side leaves the destination unchanged, but its previous snapshot must still be a parent of the merge.
+	if err := Merge(ctx, s, h2, snapshot.Path(dest), WithStrategy(StrategyOurs)); err != nil {
+		t.Fatalf("failure merging the updated snapshot: %v", err)
+	}
+	merged, f, err := s.FindSnapshot(ctx, snapshot.Path(dest))
+	if err != nil {
+		t.Fatalf("failure looking up the merge snapshot: %v", err)
+	}
+	if merged.Equal(destPrev) {
+		t.Fatalf("the merge was not recorded as a new snapshot")
+	}
+	if len(f.Parents) != 2 || !f.Parents[0].Equal(destPrev) || !f.Parents[1].Equal(h2) {
+		t.Errorf("unexpected parents of the merge snapshot: got %v, want [%q %q]", f.Parents, destPrev, h2)
+	}
+	prev, err := s.ReadSnapshot(ctx, destPrev)
+	if err != nil {
+		t.Fatalf("failure reading the previous destination snapshot: %v", err)
+	}
+	if len(prev.Parents) != 1 || !prev.Parents[0].Equal(h1) {
+		t.Errorf("the parents of the previous destination snapshot were modified: %v", prev.Parents)
+	}
+}
+
+func TestMergeDisjointChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	for _, name := range []string{"both", "src-only", filepath.Join("sub", "dest-only")} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("original"), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the source directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure checking out the initial snapshot: %v", err)
+	}
+	changes := map[string]string{
+		filepath.Join(src, "src-only"):          "src change",
+		filepath.Join(src, "sub", "src-added"):  "src added",
+		filepath.Join(dest, "sub", "dest-only"): "dest change",
+		filepath.Join(dest, "dest-added"):       "dest added",
+	}
+	for file, contents := range changes {
+		if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure updating the example file %q: %v", file, err)
+		}
+	}
+	h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+
+	// Neither a strategy nor a resolver is needed when no file changed on both sides.
+	preview, err := PreviewMerge(ctx, s, h2, snapshot.Path(dest), WithResolver(nil))
+	if err != nil {
+		t.Fatalf("failure previewing the merge: %v", err)
+	} else if preview.Fails() || len(preview.Outcomes) != 2 {
+		t.Errorf("unexpected preview of merging disjoint changes: %+v", preview.Outcomes)
+	}
+	if err := Merge(ctx, s, h2, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure merging the disjoint changes: %v", err)
+	}
+	want := map[string]string{
+		"both":                            "original",
+		"src-only":                        "src change",
+		"dest-added":                      "dest added",
+		filepath.Join("sub", "src-added"): "src added",
+		filepath.Join("sub", "dest-only"): "dest change",
+	}
+	for name, want := range want {
+		if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil {
+			t.Errorf("failure reading the merged file %q: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("unexpected contents for the merged file %q: got %q, want %q", name, got, want)
+		}
+	}
+	_, f, err := s.FindSnapshot(ctx, snapshot.Path(dest))
+	if err != nil {
+		t.Fatalf("failure looking up the merge snapshot: %v", err)
+	}
+	if len(f.Parents) != 2 || !f.Parents[1].Equal(h2) {
+		t.Errorf("unexpected parents of the merge snapshot: %v", f.Parents)
+	}
+	if _, ok := f.Metadata[snapshot.MergeStrategyMetadataKey]; ok {
+		t.Errorf("unexpected merge strategy recorded for merging disjoint changes: %v", f.Metadata)
+	}
+
+	// Changes to the same file still conflict.
+	for _, file := range []string{filepath.Join(src, "both"), filepath.Join(dest, "both")} {
+		if err := os.WriteFile(file, []byte(file), 0600); err != nil {
+			t.Fatalf("failure updating the example file %q: %v", file, err)
+		}
+	}
+	h3, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	if err := Merge(ctx, s, h3, snapshot.Path(dest)); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("unexpected result merging conflicting changes: %v", err)
+	}
+}
+
+func TestMergeMetadataChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	for _, name := range []string{"chmod-src", "chmod-dest"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("original"), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the source directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure checking out the initial snapshot: %v", err)
+	}
+
+	// Each file has its permissions changed on one side and its contents on the other.
+	for _, file := range []string{filepath.Join(src, "chmod-src"), filepath.Join(dest, "chmod-dest")} {
+		if err := os.Chmod(file, 0700); err != nil {
+			t.Fatalf("failure changing the permissions of %q: %v", file, err)
+		}
+	}
+	for _, file := range []string{filepath.Join(src, "chmod-dest"), filepath.Join(dest, "chmod-src")} {
+		if err := os.WriteFile(file, []byte("edited"), 0600); err != nil {
+			t.Fatalf("failure editing the example file %q: %v", file, err)
+		}
+	}
+	h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	preview, err := PreviewMerge(ctx, s, h2, snapshot.Path(dest), WithResolver(nil))
+	if err != nil {
+		t.Fatalf("failure previewing the merge: %v", err)
+	} else if preview.Fails() || len(preview.Outcomes) != 2 {
+		t.Errorf("unexpected preview of merging metadata changes: %+v", preview.Outcomes)
+	}
+	if err := Merge(ctx, s, h2, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure merging the metadata changes: %v", err)
+	}
+	for _, name := range []string{"chmod-src", "chmod-dest"} {
+		file := filepath.Join(dest, name)
+		if got, err := os.ReadFile(file); err != nil {
+			t.Errorf("failure reading the merged file %q: %v", name, err)
+		} else if string(got) != "edited" {
+			t.Errorf("unexpected contents for the merged file %q: got %q", name, got)
+		}
+		if info, err := os.Stat(file); err != nil {
+			t.Errorf("failure reading the permissions of the merged file %q: %v", name, err)
+		} else if got, want := info.Mode().Perm(), os.FileMode(0700); got != want {
+			t.Errorf("unexpected permissions for the merged file %q: got %v, want %v", name, got, want)
+		}
+	}
+
+	// Changing the permissions differently on both sides is a metadata conflict.
+	if err := os.Chmod(filepath.Join(src, "chmod-src"), 0640); err != nil {
+		t.Fatalf("failure changing the source permissions: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dest, "chmod-src"), 0604); err != nil {
+		t.Fatalf("failure changing the destination permissions: %v", err)
+	}
+	h3, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	preview, err = PreviewMerge(ctx, s, h3, snapshot.Path(dest))
+	if err != nil {
+		t.Fatalf("failure previewing the conflicting merge: %v", err)
+	} else if !preview.Fails() || len(preview.Outcomes) != 1 || !preview.Outcomes[0].MetadataConflict {
+		t.Errorf("unexpected preview of merging conflicting permissions: %+v", preview.Outcomes)
+	}
+	if err := Merge(ctx, s, h3, snapshot.Path(dest)); !errors.Is(err, ErrMetadataConflict) || !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("unexpected result merging conflicting permissions: %v", err)
+	}
+	if err := Merge(ctx, s, h3, snapshot.Path(dest), WithStrategy(StrategyTheirs)); err != nil {
+		t.Fatalf("failure merging conflicting permissions with a strategy: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "chmod-src")); err != nil {
+		t.Errorf("failure reading the permissions of the merged file: %v", err)
+	} else if got, want := info.Mode().Perm(), os.FileMode(0640); got != want {
+		t.Errorf("unexpected permissions after resolving the conflict: got %v, want %v", got, want)
+	}
+}
+
+func FuzzFileNames(f *testing.F) {
+	for _, name := range []string{"plain", "new\nline", "tab\t\x01\x1b[31m", "back\\slash", "\"quoted\"", "\xff\xfe", "\xf8", "-dash", " space "} {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if !snapshot.ValidChildName(snapshot.Path(name)) {
+			t.Skip()
+		}
+		ctx := context.Background()
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		if err := os.Mkdir(src, 0700); err != nil {
+			t.Fatalf("failure creating the example directory: %v", err)
+		}
+		file := filepath.Join(src, name)
+		if err := os.WriteFile(file, []byte("before"), 0600); err != nil {
+			// The filesystem does not support the name.
+			t.Skip()
+		}
+		s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+		opts := []snapshot.Option{snapshot.WithFormatVersion(snapshot.LatestFormat)}
+		before, _, err := snapshot.NewSnapshotter(s, opts...).Snapshot(ctx, snapshot.Path(src))
+		if err != nil {
+			t.Fatalf("failure snapshotting the example directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte("after"), 0600); err != nil {
+			t.Fatalf("failure modifying the example file: %v", err)
+		}
+		after, _, err := snapshot.NewSnapshotter(s, opts...).Snapshot(ctx, snapshot.Path(src))
+		if err != nil {
+			t.Fatalf("failure snapshotting the modified directory: %v", err)
+		}
+
+		changes, err := diff.Compare(ctx, s, before, after)
+		if err != nil {
+			t.Fatalf("failure comparing the snapshots: %v", err)
+		}
+		if len(changes) != 1 || changes[0].Path != name || changes[0].Kind() != "M" {
+			t.Errorf("unexpected changes for the file %q: %+v", name, changes)
+		}
+
+		dest := filepath.Join(dir, "dest")
+		for _, h := range []*snapshot.Hash{before, after} {
+			if _, err := Restore(ctx, s, h, snapshot.Path(dest)); err != nil {
+				t.Fatalf("failure restoring the snapshot %q: %v", h, err)
+			}
+			entries, err := os.ReadDir(dest)
+			if err != nil {
+				t.Fatalf("failure listing the restored directory: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name() != name {
+				t.Fatalf("unexpected restored files for %q: %v", name, entries)
+			}
+		}
+		if got, err := os.ReadFile(filepath.Join(dest, name)); err != nil || string(got) != "after" {
+			t.Errorf("unexpected restored contents of %q: %q, %v", name, got, err)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// ErrMetadataConflict means that both sides of a merge changed the
+// permissions of the same file in different ways.
+//
+// It wraps `storage.ErrConflict`, so these are still conflicts, but
+// callers can use `errors.Is` to tell them apart from conflicting
+// changes to the contents of files.
+var ErrMetadataConflict = fmt.Errorf("%w to file metadata", storage.ErrConflict)
+
+// conflictKind describes how the changes made on both sides of a merge overlap.
+//
+// The kinds are ordered, so that the kind for a directory is the
+// greatest of the kinds for its children.
+type conflictKind int
+
+const (
+	// noConflict means that the changes can be combined automatically.
+	noConflict conflictKind = iota
+
+	// metadataConflict means that some file had its permissions
+	// changed in different ways, but no contents conflict.
+	metadataConflict
+
+	// contentConflict means that some file had its contents changed
+	// in different ways, or was deleted on one side and changed on the other.
+	contentConflict
+)
+
+// fileMerge describes how the changes made to a regular file on both
+// sides of a merge combine.
+//
+// The contents and mode are each taken from whichever side changed
+// them, and from the destination if neither or both did.
+type fileMerge struct {
+	mode     string
+	perm     os.FileMode
+	contents *snapshot.Hash
+
+	// contentConflict reports whether both sides changed the contents in different ways.
+	contentConflict bool
+
+	// modeConflict reports whether both sides changed the mode in different ways.
+	modeConflict bool
+}
+
+// kind returns the kind of conflict between the changes merged into `m`.
+func (m *fileMerge) kind() conflictKind {
+	if m.contentConflict {
+		return contentConflict
+	}
+	if m.modeConflict {
+		return metadataConflict
+	}
+	return noConflict
+}
+
+// fileType returns the file type prefix of the mode of `f`.
+func fileType(f *snapshot.File) string {
+	if len(f.Mode) < 9 {
+		return f.Mode
+	}
+	return f.Mode[:len(f.Mode)-9]
+}
+
+// mergeFile combines the changes made to the file `base` in `src` and in `dest`.
+//
+// This returns nil unless all three are files of the same type other
+// than directories and symbolic links, as those are the only files
+// whose contents and mode can be merged separately.
+func mergeFile(base, src, dest *snapshot.File) *fileMerge {
+	for _, f := range []*snapshot.File{base, src, dest} {
+		if f == nil || f.IsDir() || f.IsLink() || fileType(f) != fileType(base) {
+			return nil
+		}
+	}
+	m := &fileMerge{mode: dest.Mode, perm: dest.Permissions(), contents: dest.Contents}
+	switch {
+	case base.Mode == dest.Mode:
+		m.mode, m.perm = src.Mode, src.Permissions()
+	case src.Mode != base.Mode && src.Mode != dest.Mode:
+		m.modeConflict = true
+	}
+	switch {
+	case base.Contents.Equal(dest.Contents):
+		m.contents = src.Contents
+	case !src.Contents.Equal(base.Contents) && !src.Contents.Equal(dest.Contents):
+		m.contentConflict = true
+	}
+	return m
+}
+
+// modeConflicts reports whether the directories `src` and `dest` both
+// changed the mode of the directory `base` in different ways.
+//
+// `base` may be nil or something other than a directory, in which
+// case there is nothing to compare against and no conflict.
+func modeConflicts(base, src, dest *snapshot.File) bool {
+	if !base.IsDir() {
+		return false
+	}
+	return src.Mode != base.Mode && dest.Mode != base.Mode && src.Mode != dest.Mode
+}
+
+// readBase reads the file snapshot for the merge base `base`, which may be nil.
+func readBase(ctx context.Context, s *storage.LocalFiles, base *snapshot.Hash) (*snapshot.File, error) {
+	if base == nil {
+		return nil, nil
+	}
+	f, err := s.ReadSnapshot(ctx, base)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the file snapshot for %q: %w", base, err)
+	}
+	return f, nil
+}
+
+// applyFileMerge updates the file at `p`, which currently matches
+// `destPrev`, to have the contents and permissions selected in `m`.
+//
+// If the contents come from the source, they are copied from `src`.
+func applyFileMerge(ctx context.Context, s *storage.LocalFiles, o *options, m *fileMerge, src, destPrev *snapshot.Hash, destFile *snapshot.File, p snapshot.Path) error {
+	if !m.contents.Equal(destFile.Contents) {
+		if err := update(ctx, s, o, destPrev, src, p, false); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(string(p), m.perm); err != nil {
+		return fmt.Errorf("failure updating the permissions of %q: %w", p, err)
+	}
+	return nil
+}
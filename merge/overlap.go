@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// overlap reports how the changes made to `base` in `src` and in
+// `dest` overlap, and so whether merging them needs any conflicts to
+// be resolved.
+//
+// Directories changed on both sides are compared child by child, the
+// same way that `mergeDirs` merges them. Regular files changed on both
+// sides only conflict if both sides changed their contents, or both
+// changed their permissions, in different ways. Any of the snapshots
+// may be nil, meaning the file did not exist on that side.
+func overlap(ctx context.Context, s *storage.LocalFiles, base, src, dest *snapshot.Hash) (conflictKind, error) {
+	if src.Equal(dest) || base.Equal(src) || base.Equal(dest) {
+		return noConflict, nil
+	}
+	if src == nil || dest == nil {
+		// One side deleted the file while the other changed it.
+		return contentConflict, nil
+	}
+	srcFile, err := s.ReadSnapshot(ctx, src)
+	if err != nil {
+		return 0, fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+	}
+	destFile, err := s.ReadSnapshot(ctx, dest)
+	if err != nil {
+		return 0, fmt.Errorf("failure reading the file snapshot for %q: %w", dest, err)
+	}
+	baseFile, err := readBase(ctx, s, base)
+	if err != nil {
+		return 0, err
+	}
+	if !srcFile.IsDir() || !destFile.IsDir() {
+		if m := mergeFile(baseFile, srcFile, destFile); m != nil {
+			return m.kind(), nil
+		}
+		return contentConflict, nil
+	}
+	srcTree, err := s.ListDirectorySnapshotContents(ctx, src, srcFile)
+	if err != nil {
+		return 0, fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", src, err)
+	}
+	destTree, err := s.ListDirectorySnapshotContents(ctx, dest, destFile)
+	if err != nil {
+		return 0, fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", dest, err)
+	}
+	var baseTree snapshot.Tree
+	if baseFile.IsDir() {
+		if baseTree, err = s.ListDirectorySnapshotContents(ctx, base, baseFile); err != nil {
+			return 0, fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", base, err)
+		}
+	}
+	kind := noConflict
+	if modeConflicts(baseFile, srcFile, destFile) {
+		kind = metadataConflict
+	}
+	children := make(map[snapshot.Path]struct{})
+	for child := range srcTree {
+		children[child] = struct{}{}
+	}
+	for child := range destTree {
+		children[child] = struct{}{}
+	}
+	for child := range children {
+		childKind, err := overlap(ctx, s, baseTree[child], srcTree[child], destTree[child])
+		if err != nil {
+			return 0, err
+		}
+		if childKind > kind {
+			kind = childKind
+		}
+		if kind == contentConflict {
+			break
+		}
+	}
+	return kind, nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// ResolvedByTool is the `Outcome.Resolution` of a conflict that would be resolved using the resolver set with `WithResolver`.
+const ResolvedByTool = "tool"
+
+// Outcome describes what a merge would do to a single file in the destination.
+type Outcome struct {
+	// Path is the path of the file, relative to the destination.
+	//
+	// This is empty for the destination itself.
+	Path string
+
+	// Kind is a single letter describing how the destination's file
+	// would change, using the same letters as `diff.Change.Kind`.
+	//
+	// This is empty if the destination's file would be kept as-is.
+	Kind string
+
+	// Conflict reports whether or not the file was changed on both sides.
+	Conflict bool
+
+	// MetadataConflict reports whether or not the conflict is only
+	// between changes to the permissions of the file, rather than to
+	// its contents.
+	MetadataConflict bool
+
+	// Resolution describes how a conflict would be resolved.
+	//
+	// This is the name of the merge strategy, `ResolvedByTool`, or
+	// empty if the conflict could not be resolved and would make the
+	// merge fail.
+	Resolution string
+}
+
+// Preview describes the result of a merge without performing it.
+type Preview struct {
+	// Base is the merge base of the source and the destination, if any.
+	Base *snapshot.Hash
+
+	// Outcomes lists what would happen to each file that the merge
+	// would change or that has conflicting changes, sorted by path.
+	Outcomes []*Outcome
+}
+
+// Fails reports whether or not the merge would fail due to a conflict that cannot be resolved.
+func (p *Preview) Fails() bool {
+	for _, o := range p.Outcomes {
+		if o.Conflict && len(o.Resolution) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviewMerge reports what merging the snapshot `src` into the path `dest` would do, without doing it.
+//
+// Nothing is written to `dest` or to the archive. The destination is
+// snapshotted the same way that `Merge` would snapshot it, but any new
+// objects are only stored in a temporary overlay of the archive that is
+// removed before returning.
+func PreviewMerge(ctx context.Context, s *storage.LocalFiles, src *snapshot.Hash, dest snapshot.Path, opts ...Option) (*Preview, error) {
+	o := newOptions(opts)
+	ps, err := storage.NewOverlay(s)
+	if err != nil {
+		return nil, err
+	}
+	defer ps.Close()
+	overlay := ps.LocalFiles
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		return nil, err
+	}
+	destPrevHash, _, err := snapshot.NewSnapshotter(ps, append(o.snapshotOptions, filterOpt)...).Snapshot(ctx, dest)
+	if err != nil {
+		return nil, fmt.Errorf("failure generating snapshot of destination %q prior to merging: %w", dest, err)
+	}
+
+	p := &Preview{}
+	if destPrevHash == nil {
+		err = p.addChanges(ctx, overlay, "", nil, src, false, "")
+	} else if p.Base, err = MergeBase(ctx, overlay, src, destPrevHash); err != nil {
+		return nil, fmt.Errorf("failure determining the merge base for %q and %q: %w", src, destPrevHash, err)
+	} else if p.Base.Equal(src) {
+		// The source has already been merged in
+	} else if p.Base.Equal(destPrevHash) {
+		err = p.addChanges(ctx, overlay, "", destPrevHash, src, false, "")
+	} else if len(o.strategy) > 0 || o.resolver == nil {
+		err = p.previewConflict(ctx, overlay, o, p.Base, src, destPrevHash, dest, "")
+	} else if kind, overlapErr := overlap(ctx, overlay, p.Base, src, destPrevHash); overlapErr != nil {
+		err = fmt.Errorf("failure comparing the changes made in %q and %q: %w", src, destPrevHash, overlapErr)
+	} else if kind == contentConflict {
+		err = p.previewResolver(ctx, overlay, p.Base, src, destPrevHash)
+	} else {
+		err = p.previewConflict(ctx, overlay, o, p.Base, src, destPrevHash, dest, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(p.Outcomes, func(i, j int) bool {
+		return p.Outcomes[i].Path < p.Outcomes[j].Path
+	})
+	return p, nil
+}
+
+// addChanges adds an outcome for each file that differs between `before` and `after`, under the relative path `subpath`.
+func (p *Preview) addChanges(ctx context.Context, s *storage.LocalFiles, subpath string, before, after *snapshot.Hash, conflict bool, resolution string) error {
+	changes, err := diff.Compare(ctx, s, before, after)
+	if err != nil {
+		return fmt.Errorf("failure comparing %q to %q: %w", before, after, err)
+	}
+	for _, c := range changes {
+		p.Outcomes = append(p.Outcomes, &Outcome{
+			Path:       filepath.Join(subpath, c.Path),
+			Kind:       c.Kind(),
+			Conflict:   conflict,
+			Resolution: resolution,
+		})
+	}
+	return nil
+}
+
+// previewResolver previews resolving a conflict with the resolver set using `WithResolver`.
+//
+// This mirrors `resolveConflict`, which only supports resolving conflicts
+// between regular files whose permissions do not also conflict.
+func (p *Preview) previewResolver(ctx context.Context, s *storage.LocalFiles, base, src, destPrev *snapshot.Hash) error {
+	srcFile, err := s.ReadSnapshot(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+	}
+	destFile, err := s.ReadSnapshot(ctx, destPrev)
+	if err != nil {
+		return fmt.Errorf("failure reading the file snapshot for %q: %w", destPrev, err)
+	}
+	outcome := &Outcome{Kind: "M", Conflict: true, Resolution: ResolvedByTool}
+	if srcFile.IsDir() || srcFile.IsLink() || destFile.IsDir() || destFile.IsLink() {
+		outcome.Kind, outcome.Resolution = "", ""
+	} else if baseFile, err := readBase(ctx, s, base); err != nil {
+		return err
+	} else if m := mergeFile(baseFile, srcFile, destFile); m != nil && m.modeConflict {
+		outcome.Kind, outcome.Resolution, outcome.MetadataConflict = "", "", true
+	}
+	p.Outcomes = append(p.Outcomes, outcome)
+	return nil
+}
+
+// previewConflict previews resolving the conflicting changes made to
+// `base` in `src` and in the destination `dest`, which currently
+// matches `destPrev`.
+//
+// This mirrors `applyStrategy` and `mergeDirs`. Without a strategy,
+// the conflicting files are still found, but reported as unresolved.
+func (p *Preview) previewConflict(ctx context.Context, s *storage.LocalFiles, o *options, base, src, destPrev *snapshot.Hash, dest snapshot.Path, subpath string) error {
+	if src != nil && destPrev != nil {
+		srcFile, err := s.ReadSnapshot(ctx, src)
+		if err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+		}
+		destFile, err := s.ReadSnapshot(ctx, destPrev)
+		if err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", destPrev, err)
+		}
+		if srcFile.IsDir() && destFile.IsDir() {
+			return p.previewDirs(ctx, s, o, base, src, srcFile, destPrev, destFile, dest, subpath)
+		}
+		baseFile, err := readBase(ctx, s, base)
+		if err != nil {
+			return err
+		}
+		if m := mergeFile(baseFile, srcFile, destFile); m != nil && m.kind() == noConflict {
+			if m.mode != destFile.Mode || !m.contents.Equal(destFile.Contents) {
+				p.Outcomes = append(p.Outcomes, &Outcome{Path: subpath, Kind: "M"})
+			}
+			return nil
+		} else if m != nil && m.kind() == metadataConflict {
+			return p.previewMetadataConflict(ctx, s, o, src, destPrev, dest, subpath)
+		}
+	}
+	if len(o.strategy) == 0 {
+		p.Outcomes = append(p.Outcomes, &Outcome{Path: subpath, Conflict: true})
+		return nil
+	}
+	keep, err := o.keepDestination(ctx, s, src, destPrev, dest.Join(snapshot.Path(subpath)))
+	if err != nil {
+		return err
+	}
+	if keep {
+		p.Outcomes = append(p.Outcomes, &Outcome{Path: subpath, Conflict: true, Resolution: string(o.strategy)})
+		return nil
+	}
+	return p.addChanges(ctx, s, subpath, destPrev, src, true, string(o.strategy))
+}
+
+// previewMetadataConflict previews resolving conflicting changes to the permissions of a file.
+//
+// This mirrors `applyStrategy` and `mergeDirPermissions`, which fail
+// without a strategy and otherwise keep the permissions of one side.
+func (p *Preview) previewMetadataConflict(ctx context.Context, s *storage.LocalFiles, o *options, src, destPrev *snapshot.Hash, dest snapshot.Path, subpath string) error {
+	outcome := &Outcome{Path: subpath, Conflict: true, MetadataConflict: true}
+	if len(o.strategy) > 0 {
+		keep, err := o.keepDestination(ctx, s, src, destPrev, dest.Join(snapshot.Path(subpath)))
+		if err != nil {
+			return err
+		}
+		if !keep {
+			outcome.Kind = "M"
+		}
+		outcome.Resolution = string(o.strategy)
+	}
+	p.Outcomes = append(p.Outcomes, outcome)
+	return nil
+}
+
+// previewDirs previews merging the children of the directory snapshots `src` and `destPrev`.
+func (p *Preview) previewDirs(ctx context.Context, s *storage.LocalFiles, o *options, base, src *snapshot.Hash, srcFile *snapshot.File, destPrev *snapshot.Hash, destFile *snapshot.File, dest snapshot.Path, subpath string) error {
+	srcTree, err := s.ListDirectorySnapshotContents(ctx, src, srcFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", src, err)
+	}
+	destTree, err := s.ListDirectorySnapshotContents(ctx, destPrev, destFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", destPrev, err)
+	}
+	baseFile, err := readBase(ctx, s, base)
+	if err != nil {
+		return err
+	}
+	var baseTree snapshot.Tree
+	if baseFile.IsDir() {
+		if baseTree, err = s.ListDirectorySnapshotContents(ctx, base, baseFile); err != nil {
+			return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", base, err)
+		}
+	}
+	children := make(map[snapshot.Path]struct{})
+	for child := range srcTree {
+		children[child] = struct{}{}
+	}
+	for child := range destTree {
+		children[child] = struct{}{}
+	}
+	for child := range children {
+		b, sc, d := baseTree[child], srcTree[child], destTree[child]
+		childPath := filepath.Join(subpath, string(child))
+		var err error
+		switch {
+		case sc.Equal(d), b.Equal(sc):
+			// Either both sides agree or only the destination changed.
+			continue
+		case b.Equal(d):
+			// Only the source changed.
+			err = p.addChanges(ctx, s, childPath, d, sc, false, "")
+		default:
+			err = p.previewConflict(ctx, s, o, b, sc, d, dest, childPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failure previewing the merge of %q: %w", childPath, err)
+		}
+	}
+	switch {
+	case !baseFile.IsDir() || srcFile.Mode == baseFile.Mode || srcFile.Mode == destFile.Mode:
+		// The permissions of the directory itself are unchanged.
+	case destFile.Mode == baseFile.Mode:
+		p.Outcomes = append(p.Outcomes, &Outcome{Path: subpath, Kind: "M"})
+	default:
+		return p.previewMetadataConflict(ctx, s, o, src, destPrev, dest, subpath)
+	}
+	return nil
+}
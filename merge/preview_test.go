@@ -0,0 +1,138 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func countFiles(t *testing.T, dir string) int {
+	var count int
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return err
+	}); err != nil {
+		t.Fatalf("failure counting the files in %q: %v", dir, err)
+	}
+	return count
+}
+
+func TestPreviewMerge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	for _, name := range []string{"both", "src-only", "dest-only"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte("original"), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	h1, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the source directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Checkout(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure checking out the initial snapshot: %v", err)
+	}
+	changes := map[string]string{
+		filepath.Join(src, "both"):       "theirs",
+		filepath.Join(src, "src-only"):   "src change",
+		filepath.Join(dest, "both"):      "ours",
+		filepath.Join(dest, "dest-only"): "dest change",
+	}
+	for file, contents := range changes {
+		if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure updating the example file %q: %v", file, err)
+		}
+	}
+	h2, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the source directory: %v", err)
+	}
+	objects := countFiles(t, s.ArchiveDir)
+
+	testCases := []struct {
+		opts  []Option
+		want  []Outcome
+		fails bool
+	}{
+		{
+			want: []Outcome{
+				{Path: "both", Conflict: true},
+				{Path: "src-only", Kind: "M"},
+			},
+			fails: true,
+		},
+		{
+			opts: []Option{WithStrategy(StrategyOurs)},
+			want: []Outcome{
+				{Path: "both", Conflict: true, Resolution: "ours"},
+				{Path: "src-only", Kind: "M"},
+			},
+		},
+		{
+			opts: []Option{WithStrategy(StrategyTheirs)},
+			want: []Outcome{
+				{Path: "both", Kind: "M", Conflict: true, Resolution: "theirs"},
+				{Path: "src-only", Kind: "M"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		preview, err := PreviewMerge(ctx, s, h2, snapshot.Path(dest), tc.opts...)
+		if err != nil {
+			t.Fatalf("failure previewing the merge: %v", err)
+		}
+		if !preview.Base.Equal(h1) {
+			t.Errorf("unexpected merge base: got %q, want %q", preview.Base, h1)
+		}
+		if got := preview.Fails(); got != tc.fails {
+			t.Errorf("unexpected prediction of whether the merge fails: got %v, want %v", got, tc.fails)
+		}
+		if len(preview.Outcomes) != len(tc.want) {
+			t.Errorf("unexpected number of outcomes: got %d, want %d", len(preview.Outcomes), len(tc.want))
+			continue
+		}
+		for i, got := range preview.Outcomes {
+			if *got != tc.want[i] {
+				t.Errorf("unexpected outcome: got %+v, want %+v", *got, tc.want[i])
+			}
+		}
+	}
+
+	// Nothing was written to the destination or to the archive.
+	if got, err := os.ReadFile(filepath.Join(dest, "src-only")); err != nil || string(got) != "original" {
+		t.Errorf("unexpected contents of the destination after previewing: %q, %v", got, err)
+	}
+	if got, _, err := s.FindSnapshot(ctx, snapshot.Path(dest)); err != nil || !got.Equal(h1) {
+		t.Errorf("unexpected snapshot of the destination after previewing: %q, %v", got, err)
+	}
+	if got := countFiles(t, s.ArchiveDir); got != objects {
+		t.Errorf("previewing changed the number of files in the archive from %d to %d", objects, got)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Strategy deterministically resolves conflicting changes without any human interaction.
+//
+// Conflicts are resolved file by file: when both sides of a merge
+// changed the same directory, only the children changed on both sides
+// are resolved using the strategy, and all other changes are merged.
+type Strategy string
+
+const (
+	// StrategyOurs resolves conflicts by keeping the destination's version.
+	StrategyOurs Strategy = "ours"
+
+	// StrategyTheirs resolves conflicts by taking the source's version.
+	StrategyTheirs Strategy = "theirs"
+
+	// StrategyNewestMtime resolves conflicts by keeping the newest version.
+	//
+	// The destination's version is dated by its modification time, and
+	// the source's version by the time its snapshot was generated. If
+	// no time was recorded for the source snapshot, then the
+	// destination's version is kept. A modification always wins over
+	// a deletion.
+	StrategyNewestMtime Strategy = "newest-mtime"
+)
+
+// ParseStrategy parses the name of a merge strategy.
+func ParseStrategy(name string) (Strategy, error) {
+	switch st := Strategy(name); st {
+	case StrategyOurs, StrategyTheirs, StrategyNewestMtime:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown merge strategy %q; must be one of %q, %q, or %q", name, StrategyOurs, StrategyTheirs, StrategyNewestMtime)
+}
+
+// WithStrategy sets the strategy used to resolve conflicting changes.
+//
+// The strategy takes precedence over any resolver set with `WithResolver`,
+// and is recorded in the metadata of the resulting merge snapshot.
+func WithStrategy(st Strategy) Option {
+	return func(o *options) {
+		o.strategy = st
+	}
+}
+
+// keepDestination reports whether the strategy resolves a conflict
+// between the source snapshot `src` and the destination `dest` by
+// keeping the destination.
+//
+// Either side may be nil, meaning it was deleted.
+func (o *options) keepDestination(ctx context.Context, s *storage.LocalFiles, src *snapshot.Hash, dest *snapshot.Hash, p snapshot.Path) (bool, error) {
+	switch o.strategy {
+	case StrategyOurs:
+		return true, nil
+	case StrategyTheirs:
+		return false, nil
+	}
+	if src == nil || dest == nil {
+		return src == nil, nil
+	}
+	srcFile, err := s.ReadSnapshot(ctx, src)
+	if err != nil {
+		return false, fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+	}
+	srcTime, ok := srcFile.Time()
+	if !ok {
+		return true, nil
+	}
+	info, err := os.Lstat(string(p))
+	if err != nil {
+		return false, fmt.Errorf("failure reading the modification time of %q: %w", p, err)
+	}
+	return !srcTime.After(info.ModTime()), nil
+}
+
+// applyStrategy resolves the conflicting changes made to `base` in
+// `src` and in the destination `p`, which currently matches `destPrev`.
+//
+// Changes to the contents of a regular file on one side and to its
+// permissions on the other are both applied, without consulting the
+// strategy. If only the contents conflict, then the strategy picks
+// them, and any permission change from either side is still applied.
+//
+// Either `src` or `destPrev` may be nil, meaning that side deleted the file.
+func applyStrategy(ctx context.Context, s *storage.LocalFiles, o *options, base, src, destPrev *snapshot.Hash, p snapshot.Path) error {
+	var merged *fileMerge
+	if src != nil && destPrev != nil {
+		srcFile, err := s.ReadSnapshot(ctx, src)
+		if err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", src, err)
+		}
+		destFile, err := s.ReadSnapshot(ctx, destPrev)
+		if err != nil {
+			return fmt.Errorf("failure reading the file snapshot for %q: %w", destPrev, err)
+		}
+		if srcFile.IsDir() && destFile.IsDir() {
+			return mergeDirs(ctx, s, o, base, src, srcFile, destPrev, destFile, p)
+		}
+		baseFile, err := readBase(ctx, s, base)
+		if err != nil {
+			return err
+		}
+		merged = mergeFile(baseFile, srcFile, destFile)
+		if merged != nil && merged.kind() == noConflict {
+			return applyFileMerge(ctx, s, o, merged, src, destPrev, destFile, p)
+		}
+		if merged != nil && merged.kind() == metadataConflict && len(o.strategy) == 0 {
+			return fmt.Errorf("%w: both sides changed the permissions of %q", ErrMetadataConflict, p)
+		}
+	}
+	keep, err := o.keepDestination(ctx, s, src, destPrev, p)
+	if err != nil {
+		return err
+	}
+	if !keep {
+		if err := update(ctx, s, o, destPrev, src, p, false); err != nil {
+			return err
+		}
+	}
+	if merged != nil && !merged.modeConflict {
+		if err := os.Chmod(string(p), merged.perm); err != nil {
+			return fmt.Errorf("failure updating the permissions of %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// mergeDirs merges the children of the directory snapshots `src` and
+// `destPrev`, using the strategy for the children changed on both sides.
+//
+// The permissions of the directory itself are merged the same way as
+// those of regular files.
+func mergeDirs(ctx context.Context, s *storage.LocalFiles, o *options, base, src *snapshot.Hash, srcFile *snapshot.File, destPrev *snapshot.Hash, destFile *snapshot.File, p snapshot.Path) error {
+	srcTree, err := s.ListDirectorySnapshotContents(ctx, src, srcFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", src, err)
+	}
+	destTree, err := s.ListDirectorySnapshotContents(ctx, destPrev, destFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", destPrev, err)
+	}
+	baseFile, err := readBase(ctx, s, base)
+	if err != nil {
+		return err
+	}
+	var baseTree snapshot.Tree
+	if baseFile.IsDir() {
+		if baseTree, err = s.ListDirectorySnapshotContents(ctx, base, baseFile); err != nil {
+			return fmt.Errorf("failure reading the contents of the directory snapshot %q: %w", base, err)
+		}
+	}
+	children := make(map[snapshot.Path]struct{})
+	for child := range srcTree {
+		children[child] = struct{}{}
+	}
+	for child := range destTree {
+		children[child] = struct{}{}
+	}
+	for child := range children {
+		b, sc, d := baseTree[child], srcTree[child], destTree[child]
+		childPath := p.Join(child)
+		var err error
+		switch {
+		case sc.Equal(d), b.Equal(sc):
+			// Either both sides agree or only the destination changed.
+			continue
+		case b.Equal(d):
+			// Only the source changed.
+			err = update(ctx, s, o, d, sc, childPath, false)
+		default:
+			err = applyStrategy(ctx, s, o, b, sc, d, childPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failure merging %q: %w", childPath, err)
+		}
+	}
+	return mergeDirPermissions(ctx, s, o, baseFile, src, srcFile, destPrev, destFile, p)
+}
+
+// mergeDirPermissions applies any change made to the permissions of
+// the directory `base` in `src` to the destination directory `p`.
+//
+// If the destination changed them differently, then the strategy picks which side to keep.
+func mergeDirPermissions(ctx context.Context, s *storage.LocalFiles, o *options, baseFile *snapshot.File, src *snapshot.Hash, srcFile *snapshot.File, destPrev *snapshot.Hash, destFile *snapshot.File, p snapshot.Path) error {
+	if !baseFile.IsDir() || srcFile.Mode == baseFile.Mode || srcFile.Mode == destFile.Mode {
+		return nil
+	}
+	if destFile.Mode != baseFile.Mode {
+		if len(o.strategy) == 0 {
+			return fmt.Errorf("%w: both sides changed the permissions of %q", ErrMetadataConflict, p)
+		}
+		keep, err := o.keepDestination(ctx, s, src, destPrev, p)
+		if err != nil || keep {
+			return err
+		}
+	}
+	if err := os.Chmod(string(p), srcFile.Permissions()); err != nil {
+		return fmt.Errorf("failure updating the permissions of %q: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merge
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// restoreXattrs sets the extended attributes of `p` to those recorded in `f`.
+//
+// Any attributes recorded in `prev`, the snapshot previously written to
+// `p`, that are no longer recorded in `f` are removed. Other attributes
+// of `p` are left as-is, as are all of them on platforms or file
+// systems that do not support extended attributes.
+func restoreXattrs(ctx context.Context, s *storage.LocalFiles, prev, f *snapshot.File, p snapshot.Path) error {
+	prevAttrs, err := prev.Xattrs()
+	if err != nil {
+		return err
+	}
+	attrs, err := f.Xattrs()
+	if err != nil {
+		return err
+	}
+	for name, h := range attrs {
+		if prevAttrs[name].Equal(h) {
+			continue
+		}
+		value, err := readObject(ctx, s, h)
+		if err != nil {
+			return fmt.Errorf("failure reading the extended attribute %q for %q: %w", name, p, err)
+		}
+		if err := setXattr(p, name, value); err != nil {
+			return fmt.Errorf("failure restoring the extended attribute %q of %q: %w", name, p, err)
+		}
+	}
+	for name := range prevAttrs {
+		if _, ok := attrs[name]; ok {
+			continue
+		}
+		if err := removeXattr(p, name); err != nil {
+			return fmt.Errorf("failure removing the extended attribute %q of %q: %w", name, p, err)
+		}
+	}
+	return nil
+}
+
+// readObject reads the entire object `h` into memory.
+func readObject(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]byte, error) {
+	r, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
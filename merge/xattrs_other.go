@@ -0,0 +1,33 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin
+
+package merge
+
+import "github.com/google/recursive-version-control-system/snapshot"
+
+// setXattr sets the extended attribute `name` of `p` to `value`.
+//
+// This is not supported on the current platform, so the attribute is skipped.
+func setXattr(p snapshot.Path, name string, value []byte) error {
+	return nil
+}
+
+// removeXattr removes the extended attribute `name` of `p`, if it exists.
+//
+// This is not supported on the current platform, so nothing is removed.
+func removeXattr(p snapshot.Path, name string) error {
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package merge
+
+import (
+	"errors"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"golang.org/x/sys/unix"
+)
+
+// unsupportedXattr reports whether `err` means the file system does not support the extended attribute.
+//
+// This is the case, for example, when restoring the macOS-specific
+// attributes of a snapshot on Linux.
+func unsupportedXattr(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
+
+// setXattr sets the extended attribute `name` of `p` to `value`, without following symbolic links.
+func setXattr(p snapshot.Path, name string, value []byte) error {
+	if err := unix.Lsetxattr(string(p), name, value, 0); err != nil && !unsupportedXattr(err) {
+		return err
+	}
+	return nil
+}
+
+// removeXattr removes the extended attribute `name` of `p`, if it exists.
+func removeXattr(p snapshot.Path, name string) error {
+	err := unix.Lremovexattr(string(p), name)
+	if err != nil && !unsupportedXattr(err) && !errors.Is(err, errNoXattr) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package merge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+	"golang.org/x/sys/unix"
+)
+
+func TestRestoreXattrs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the source directory: %v", err)
+	}
+	file := filepath.Join(src, "file")
+	if err := os.WriteFile(file, []byte("contents"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	setAttrs := map[string]map[string]string{
+		file:                      {"user.rvcs-tag": "red", "user.ignored": "ignored"},
+		filepath.Join(src, "sub"): {"user.rvcs-tag": "dir"},
+	}
+	for p, attrs := range setAttrs {
+		for name, value := range attrs {
+			err := unix.Lsetxattr(p, name, []byte(value), 0)
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+				t.Skipf("extended attributes are not supported in %q", dir)
+			} else if err != nil {
+				t.Fatalf("failure setting the extended attribute %q of %q: %v", name, p, err)
+			}
+		}
+	}
+	sn := func() *snapshot.Snapshotter {
+		return snapshot.NewSnapshotter(s, snapshot.WithFormatVersion(snapshot.VersionedFormat), snapshot.WithXattrs("user.rvcs-*"))
+	}
+	h1, _, err := sn().Snapshot(ctx, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	dest := filepath.Join(dir, "dest")
+	if err := Extract(ctx, s, h1, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure extracting the snapshot: %v", err)
+	}
+	checkAttr := func(p, name, want string) {
+		t.Helper()
+		buf := make([]byte, 64)
+		n, err := unix.Lgetxattr(p, name, buf)
+		if len(want) == 0 {
+			if err == nil {
+				t.Errorf("unexpected extended attribute %q of %q: %q", name, p, buf[:n])
+			}
+			return
+		}
+		if err != nil {
+			t.Errorf("failure reading the extended attribute %q of %q: %v", name, p, err)
+		} else if got := string(buf[:n]); got != want {
+			t.Errorf("unexpected value for the extended attribute %q of %q: got %q, want %q", name, p, got, want)
+		}
+	}
+	destFile, destSub := filepath.Join(dest, "file"), filepath.Join(dest, "sub")
+	checkAttr(destFile, "user.rvcs-tag", "red")
+	checkAttr(destFile, "user.ignored", "")
+	checkAttr(destSub, "user.rvcs-tag", "dir")
+
+	// Changing only the extended attributes is recorded, and updates them in place.
+	if err := unix.Lsetxattr(file, "user.rvcs-tag", []byte("blue"), 0); err != nil {
+		t.Fatalf("failure updating the extended attribute of %q: %v", file, err)
+	}
+	if err := unix.Lremovexattr(filepath.Join(src, "sub"), "user.rvcs-tag"); err != nil {
+		t.Fatalf("failure removing the extended attribute of the subdirectory: %v", err)
+	}
+	h2, _, err := sn().Snapshot(ctx, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the example directory: %v", err)
+	} else if h2.Equal(h1) {
+		t.Fatalf("unexpected unchanged snapshot after changing extended attributes")
+	}
+	if err := UpdateExtracted(ctx, s, h1, h2, snapshot.Path(dest)); err != nil {
+		t.Fatalf("failure updating the extracted snapshot: %v", err)
+	}
+	checkAttr(destFile, "user.rvcs-tag", "blue")
+	checkAttr(destSub, "user.rvcs-tag", "")
+}
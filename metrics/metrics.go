@@ -0,0 +1,335 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics records the health of an archive and exports it in the Prometheus text format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// countersConfig is the name of the archive config file holding the recorded counters.
+const countersConfig = "metrics"
+
+// countersMu serializes updates to the recorded counters within this process.
+var countersMu sync.Mutex
+
+// Counters are the cumulative statistics recorded for an archive.
+type Counters struct {
+	// Snapshots is the number of snapshots generated successfully.
+	Snapshots int64
+
+	// SnapshotFailures is the number of snapshots that failed.
+	SnapshotFailures int64
+
+	// SnapshotSeconds is the total time spent generating successful snapshots.
+	SnapshotSeconds float64
+
+	// LastSnapshot is the time that the latest successful snapshot finished, or zero if there has been none.
+	LastSnapshot time.Time
+
+	// LastSnapshotSeconds is how long the latest successful snapshot took.
+	LastSnapshotSeconds float64
+
+	// ObjectsStored is the number of objects newly written to the archive by snapshots.
+	ObjectsStored int64
+
+	// BytesStored is the total size of the objects newly written to the archive by snapshots.
+	BytesStored int64
+
+	// CacheHits is the number of paths whose snapshots were reused from the path info cache.
+	CacheHits int64
+
+	// CacheMisses is the number of paths that had to be read because the path info cache did not match.
+	CacheMisses int64
+
+	// PushFailures is the number of pushes to a remote that failed.
+	PushFailures int64
+
+	// PullFailures is the number of pulls from the remotes that failed.
+	PullFailures int64
+}
+
+// fields returns the name of each counter, along with a pointer to its value.
+func (c *Counters) fields() ([]string, []*int64) {
+	return []string{
+		"snapshots", "snapshot-failures", "objects-stored", "bytes-stored",
+		"cache-hits", "cache-misses", "push-failures", "pull-failures",
+	}, []*int64{
+		&c.Snapshots, &c.SnapshotFailures, &c.ObjectsStored, &c.BytesStored,
+		&c.CacheHits, &c.CacheMisses, &c.PushFailures, &c.PullFailures,
+	}
+}
+
+// add adds the counts of `other` to the counters, and keeps the latest snapshot.
+func (c *Counters) add(other *Counters) {
+	_, counts := c.fields()
+	_, otherCounts := other.fields()
+	for i, count := range counts {
+		*count += *otherCounts[i]
+	}
+	c.SnapshotSeconds += other.SnapshotSeconds
+	if other.LastSnapshot.After(c.LastSnapshot) {
+		c.LastSnapshot = other.LastSnapshot
+		c.LastSnapshotSeconds = other.LastSnapshotSeconds
+	}
+}
+
+func (c *Counters) String() string {
+	names, counts := c.fields()
+	var lines []string
+	for i, name := range names {
+		lines = append(lines, name+" "+strconv.FormatInt(*counts[i], 10))
+	}
+	lines = append(lines,
+		"snapshot-seconds "+strconv.FormatFloat(c.SnapshotSeconds, 'g', -1, 64),
+		"last-snapshot "+strconv.FormatInt(unixSeconds(c.LastSnapshot), 10),
+		"last-snapshot-seconds "+strconv.FormatFloat(c.LastSnapshotSeconds, 'g', -1, 64))
+	return strings.Join(lines, "\n")
+}
+
+func parseCounters(contents string) (*Counters, error) {
+	c := &Counters{}
+	names, counts := c.fields()
+	byName := make(map[string]*int64)
+	for i, name := range names {
+		byName[name] = counts[i]
+	}
+	for _, line := range strings.Split(contents, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed metrics counter %q", line)
+		}
+		var err error
+		switch name {
+		case "snapshot-seconds":
+			c.SnapshotSeconds, err = strconv.ParseFloat(value, 64)
+		case "last-snapshot-seconds":
+			c.LastSnapshotSeconds, err = strconv.ParseFloat(value, 64)
+		case "last-snapshot":
+			var secs int64
+			if secs, err = strconv.ParseInt(value, 10, 64); err == nil && secs != 0 {
+				c.LastSnapshot = time.Unix(secs, 0)
+			}
+		default:
+			// Unknown counters are ignored so that newer versions can add more.
+			if count, ok := byName[name]; ok {
+				*count, err = strconv.ParseInt(value, 10, 64)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed metrics counter %q: %w", line, err)
+		}
+	}
+	return c, nil
+}
+
+// ReadCounters reads the counters recorded in the given archive.
+func ReadCounters(s *storage.LocalFiles) (*Counters, error) {
+	bs, err := os.ReadFile(s.ConfigFile(countersConfig))
+	if os.IsNotExist(err) {
+		return &Counters{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the metrics counters: %w", err)
+	}
+	return parseCounters(string(bs))
+}
+
+// Record adds the given counters to those recorded in the archive.
+func Record(ctx context.Context, s *storage.LocalFiles, delta *Counters) error {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	c, err := ReadCounters(s)
+	if err != nil {
+		return err
+	}
+	c.add(delta)
+	if err := s.WriteConfigFile(ctx, countersConfig, []byte(c.String())); err != nil {
+		return fmt.Errorf("failure writing the metrics counters: %w", err)
+	}
+	return nil
+}
+
+// archiveSizeTTL is how long a measured archive size is reported for
+// before the objects are measured again.
+//
+// Measuring the size walks every object in the archive, which is too
+// slow to repeat on every scrape of a large archive.
+const archiveSizeTTL = 5 * time.Minute
+
+// measuredSize is the size of an archive as of when it was measured.
+type measuredSize struct {
+	size int64
+	at   time.Time
+}
+
+var (
+	// archiveSizesMu guards `archiveSizes`.
+	archiveSizesMu sync.Mutex
+
+	// archiveSizes holds the latest measured sizes, keyed by archive directory.
+	archiveSizes = make(map[string]measuredSize)
+)
+
+// timeNow is a handle on `time.Now` that lets tests simulate the passage of time.
+var timeNow = time.Now
+
+// archiveSize returns the total size in bytes of the objects stored in
+// the archive itself, as measured within the last `archiveSizeTTL`.
+func archiveSize(s *storage.LocalFiles) (int64, error) {
+	archiveSizesMu.Lock()
+	defer archiveSizesMu.Unlock()
+	now := timeNow()
+	if measured, ok := archiveSizes[s.ArchiveDir]; ok && now.Sub(measured.at) < archiveSizeTTL {
+		return measured.size, nil
+	}
+	size, err := measureArchiveSize(s)
+	if err != nil {
+		return 0, err
+	}
+	archiveSizes[s.ArchiveDir] = measuredSize{size: size, at: now}
+	return size, nil
+}
+
+// measureArchiveSize walks the objects stored in the archive itself and returns their total size in bytes.
+func measureArchiveSize(s *storage.LocalFiles) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(filepath.Join(s.ArchiveDir, "objects"), func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// exposition writes metrics in the Prometheus text exposition format.
+type exposition struct {
+	w   io.Writer
+	err error
+}
+
+// metric writes a single metric family with its samples.
+//
+// Each sample is given as a label set, which may be empty, followed by its value.
+func (e *exposition) metric(name, kind, help string, samples ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	lines := []string{
+		fmt.Sprintf("# HELP %s %s", name, help),
+		fmt.Sprintf("# TYPE %s %s", name, kind),
+	}
+	for i := 0; i+1 < len(samples); i += 2 {
+		lines = append(lines, fmt.Sprintf("%s%s %v", name, samples[i], samples[i+1]))
+	}
+	_, e.err = io.WriteString(e.w, strings.Join(lines, "\n")+"\n")
+}
+
+// remoteLabel returns the label set identifying the named remote.
+func remoteLabel(name string) string {
+	return fmt.Sprintf("{remote=%q}", name)
+}
+
+// unixSeconds returns the given time in seconds since the epoch, or zero for the zero time.
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Write writes the metrics for the archive `s` in the Prometheus text exposition format.
+//
+// This includes the recorded counters, the transfer statistics of each
+// remote, and the current size of the archive. The size is measured by
+// walking the archive, so it may take a while for large archives.
+func Write(ctx context.Context, w io.Writer, s *storage.LocalFiles) error {
+	c, err := ReadCounters(s)
+	if err != nil {
+		return err
+	}
+	transfers, err := remote.ReadTransferStats(s)
+	if err != nil {
+		return err
+	}
+	size, err := archiveSize(s)
+	if err != nil {
+		return fmt.Errorf("failure measuring the size of the archive: %w", err)
+	}
+	e := &exposition{w: w}
+	e.metric("rvcs_snapshots_total", "counter", "Number of snapshots generated successfully.", "", c.Snapshots)
+	e.metric("rvcs_snapshot_failures_total", "counter", "Number of snapshots that failed.", "", c.SnapshotFailures)
+	e.metric("rvcs_snapshot_duration_seconds", "summary", "Time spent generating successful snapshots.",
+		"_sum", c.SnapshotSeconds, "_count", c.Snapshots)
+	e.metric("rvcs_last_snapshot_duration_seconds", "gauge", "How long the latest successful snapshot took.", "", c.LastSnapshotSeconds)
+	e.metric("rvcs_last_snapshot_timestamp_seconds", "gauge", "When the latest successful snapshot finished, in seconds since the epoch.", "", unixSeconds(c.LastSnapshot))
+	e.metric("rvcs_objects_stored_total", "counter", "Number of objects newly written to the archive by snapshots.", "", c.ObjectsStored)
+	e.metric("rvcs_stored_bytes_total", "counter", "Total size of the objects newly written to the archive by snapshots.", "", c.BytesStored)
+	e.metric("rvcs_path_cache_hits_total", "counter", "Number of paths whose snapshots were reused from the path info cache.", "", c.CacheHits)
+	e.metric("rvcs_path_cache_misses_total", "counter", "Number of paths that were read because the path info cache did not match.", "", c.CacheMisses)
+	e.metric("rvcs_push_failures_total", "counter", "Number of pushes to a remote that failed.", "", c.PushFailures)
+	e.metric("rvcs_pull_failures_total", "counter", "Number of pulls from the remotes that failed.", "", c.PullFailures)
+	e.metric("rvcs_archive_size_bytes", "gauge", "Total size of the objects stored in the archive, measured at most five minutes ago.", "", size)
+
+	var names []string
+	for name := range transfers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sent, received, lastPush, lastPull []interface{}
+	for _, name := range names {
+		ts := transfers[name]
+		label := remoteLabel(name)
+		sent = append(sent, label, ts.BytesSent)
+		received = append(received, label, ts.BytesReceived)
+		lastPush = append(lastPush, label, unixSeconds(ts.LastPush))
+		lastPull = append(lastPull, label, unixSeconds(ts.LastPull))
+	}
+	if len(names) > 0 {
+		e.metric("rvcs_remote_sent_bytes_total", "counter", "Object bytes pushed to each remote.", sent...)
+		e.metric("rvcs_remote_received_bytes_total", "counter", "Object bytes pulled from each remote.", received...)
+		e.metric("rvcs_remote_last_push_timestamp_seconds", "gauge", "When the latest successful push to each remote finished, in seconds since the epoch.", lastPush...)
+		e.metric("rvcs_remote_last_pull_timestamp_seconds", "gauge", "When the latest successful pull from each remote finished, in seconds since the epoch.", lastPull...)
+	}
+	return e.err
+}
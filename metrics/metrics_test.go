@@ -0,0 +1,110 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRecordAndWrite(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: t.TempDir()}
+	first := time.Unix(1000, 0)
+	if err := Record(ctx, s, &Counters{Snapshots: 1, SnapshotSeconds: 1.5, LastSnapshot: first, LastSnapshotSeconds: 1.5, CacheMisses: 3}); err != nil {
+		t.Fatalf("failure recording the first counters: %v", err)
+	}
+	if err := Record(ctx, s, &Counters{Snapshots: 1, SnapshotSeconds: 0.5, LastSnapshot: first.Add(time.Minute), LastSnapshotSeconds: 0.5, CacheHits: 2, PushFailures: 1}); err != nil {
+		t.Fatalf("failure recording the second counters: %v", err)
+	}
+	c, err := ReadCounters(s)
+	if err != nil {
+		t.Fatalf("failure reading the counters: %v", err)
+	}
+	want := Counters{
+		Snapshots:           2,
+		SnapshotSeconds:     2,
+		LastSnapshot:        first.Add(time.Minute),
+		LastSnapshotSeconds: 0.5,
+		CacheHits:           2,
+		CacheMisses:         3,
+		PushFailures:        1,
+	}
+	if !c.LastSnapshot.Equal(want.LastSnapshot) {
+		t.Errorf("unexpected last snapshot time: got %v, want %v", c.LastSnapshot, want.LastSnapshot)
+	}
+	c.LastSnapshot = want.LastSnapshot
+	if *c != want {
+		t.Errorf("unexpected counters: got %+v, want %+v", *c, want)
+	}
+
+	var out bytes.Buffer
+	if err := Write(ctx, &out, s); err != nil {
+		t.Fatalf("failure writing the metrics: %v", err)
+	}
+	for _, line := range []string{
+		"rvcs_snapshots_total 2",
+		"rvcs_snapshot_duration_seconds_sum 2",
+		"rvcs_last_snapshot_timestamp_seconds 1060",
+		"rvcs_path_cache_hits_total 2",
+		"rvcs_push_failures_total 1",
+		"rvcs_archive_size_bytes 0",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing metric %q in the output:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestArchiveSizeIsCached(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	s := &storage.LocalFiles{ArchiveDir: t.TempDir()}
+	objects := filepath.Join(s.ArchiveDir, "objects")
+	if err := os.MkdirAll(objects, 0700); err != nil {
+		t.Fatalf("failure creating the objects directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(objects, "first"), []byte("12345"), 0600); err != nil {
+		t.Fatalf("failure writing an object: %v", err)
+	}
+	if size, err := archiveSize(s); err != nil {
+		t.Fatalf("failure measuring the archive: %v", err)
+	} else if size != 5 {
+		t.Errorf("unexpected archive size: got %d, want 5", size)
+	}
+	if err := os.WriteFile(filepath.Join(objects, "second"), []byte("123"), 0600); err != nil {
+		t.Fatalf("failure writing an object: %v", err)
+	}
+	if size, err := archiveSize(s); err != nil {
+		t.Fatalf("failure measuring the archive: %v", err)
+	} else if size != 5 {
+		t.Errorf("unexpected remeasurement of the archive before the TTL expired: got %d, want 5", size)
+	}
+	now = now.Add(archiveSizeTTL)
+	if size, err := archiveSize(s); err != nil {
+		t.Fatalf("failure measuring the archive: %v", err)
+	} else if size != 8 {
+		t.Errorf("unexpected archive size after the TTL expired: got %d, want 8", size)
+	}
+}
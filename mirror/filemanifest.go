@@ -0,0 +1,242 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// FileManifestEntry describes a single file in a mirror.
+//
+// File manifests are written as one JSON encoded entry per line, so
+// that they can be read by tools that know nothing about rvcs.
+type FileManifestEntry struct {
+	// Path is the slash separated path of the file relative to the mirror directory.
+	Path string `json:"path"`
+
+	// Mode is the file's mode, formatted as by `fs.FileMode.String`.
+	Mode string `json:"mode"`
+
+	// Size is the size of a regular file, or the length of a link's target.
+	Size int64 `json:"size"`
+
+	// Hash is the hash of a regular file's contents, or of a link's target.
+	//
+	// This is empty for directories.
+	Hash string `json:"hash,omitempty"`
+
+	// ModTime is the modification time of the file.
+	ModTime time.Time `json:"mtime"`
+}
+
+// WriteFileManifest writes a manifest of every file in the mirror in `dir` to `w`.
+//
+// The hashes are taken from the mirrored snapshots where possible, so
+// only the files whose contents were transformed by a content filter
+// are read.
+func WriteFileManifest(ctx context.Context, s *storage.LocalFiles, dir string, w io.Writer) error {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for p := range manifest {
+		paths = append(paths, string(p))
+	}
+	sort.Strings(paths)
+	enc := json.NewEncoder(w)
+	var visit func(h *snapshot.Hash, rel string) error
+	visit = func(h *snapshot.Hash, rel string) error {
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return fmt.Errorf("failure reading the snapshot %q of %q: %w", h, rel, err)
+		}
+		file := filepath.Join(dir, rel)
+		info, err := os.Lstat(file)
+		if err != nil {
+			return fmt.Errorf("failure reading the file info for %q: %w", file, err)
+		}
+		entry := &FileManifestEntry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode().String(),
+			ModTime: info.ModTime().UTC(),
+		}
+		if !f.IsDir() {
+			entry.Size = info.Size()
+			entry.Hash = f.Contents.String()
+			if _, filtered := f.Metadata[snapshot.FilterMetadataKey]; filtered {
+				if entry.Hash, err = hashFile(file, info); err != nil {
+					return err
+				}
+			}
+		}
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("failure writing the file manifest: %w", err)
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return fmt.Errorf("failure listing the contents of the snapshot %q: %w", h, err)
+		}
+		var children []string
+		for child := range tree {
+			children = append(children, string(child))
+		}
+		sort.Strings(children)
+		for _, child := range children {
+			if err := visit(tree[snapshot.Path(child)], filepath.Join(rel, child)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, p := range paths {
+		rel := strings.TrimPrefix(filepath.Clean(p), string(filepath.Separator))
+		if err := visit(manifest[snapshot.Path(p)], rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashFile hashes the contents of a regular file, or the target of a link.
+func hashFile(file string, info fs.FileInfo) (string, error) {
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return "", fmt.Errorf("failure reading the link %q: %w", file, err)
+		}
+		h, err := snapshot.NewHash(strings.NewReader(target))
+		if err != nil {
+			return "", err
+		}
+		return h.String(), nil
+	}
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failure opening %q: %w", file, err)
+	}
+	defer reader.Close()
+	h, err := snapshot.NewHash(reader)
+	if err != nil {
+		return "", fmt.Errorf("failure hashing %q: %w", file, err)
+	}
+	return h.String(), nil
+}
+
+// VerifyFileManifest checks the files in `dir` against the manifest read from `r`.
+//
+// The returned values describe each file that is missing, unexpected,
+// or does not match the manifest. Differences in the modification
+// times of files other than directories are only reported if
+// `checkModTimes` is true.
+func VerifyFileManifest(ctx context.Context, r io.Reader, dir string, checkModTimes bool) (problems []string, err error) {
+	expected := make(map[string]struct{})
+	dec := json.NewDecoder(r)
+	for {
+		var entry FileManifestEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failure reading the file manifest: %w", err)
+		}
+		expected[entry.Path] = struct{}{}
+		file := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		info, err := os.Lstat(file)
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%s: missing", entry.Path))
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failure reading the file info for %q: %w", file, err)
+		}
+		if got := info.Mode().String(); got != entry.Mode {
+			problems = append(problems, fmt.Sprintf("%s: mode is %s, want %s", entry.Path, got, entry.Mode))
+			continue
+		}
+		if info.IsDir() {
+			// The modification times of directories change along with
+			// their contents, which are checked individually.
+			continue
+		}
+		if checkModTimes && !info.ModTime().Equal(entry.ModTime) {
+			problems = append(problems, fmt.Sprintf("%s: modified at %s, want %s", entry.Path, info.ModTime().UTC().Format(time.RFC3339Nano), entry.ModTime.Format(time.RFC3339Nano)))
+		}
+		if info.Size() != entry.Size {
+			problems = append(problems, fmt.Sprintf("%s: size is %d, want %d", entry.Path, info.Size(), entry.Size))
+			continue
+		}
+		got, err := hashFile(file, info)
+		if err != nil {
+			return nil, err
+		}
+		if got != entry.Hash {
+			problems = append(problems, fmt.Sprintf("%s: hash is %s, want %s", entry.Path, got, entry.Hash))
+		}
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." || rel == manifestFile {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := expected[rel]; ok {
+			return nil
+		}
+		if d.IsDir() && isAncestor(rel, expected) {
+			// Parents of the mirrored paths are not listed in the manifest.
+			return nil
+		}
+		problems = append(problems, fmt.Sprintf("%s: unexpected", rel))
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the files in %q: %w", dir, err)
+	}
+	return problems, nil
+}
+
+// isAncestor reports whether the directory `rel` is an ancestor of any of the given paths.
+func isAncestor(rel string, paths map[string]struct{}) bool {
+	prefix := rel + "/"
+	for p := range paths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestFileManifest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	tracked := filepath.Join(dir, "tracked")
+	mirrorDir := filepath.Join(dir, "mirror")
+	mirrored := filepath.Join(mirrorDir, tracked)
+	if err := os.MkdirAll(filepath.Join(tracked, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the tracked dir: %v", err)
+	}
+	for name, contents := range map[string]string{"a.txt": "a", "b.txt": "b", "sub/c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(tracked, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating %q: %v", name, err)
+		}
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(tracked)); err != nil {
+		t.Fatalf("failure snapshotting the tracked dir: %v", err)
+	}
+	if err := Update(ctx, s, mirrorDir); err != nil {
+		t.Fatalf("failure creating the mirror: %v", err)
+	}
+	var manifest bytes.Buffer
+	if err := WriteFileManifest(ctx, s, mirrorDir, &manifest); err != nil {
+		t.Fatalf("failure writing the file manifest: %v", err)
+	}
+	if got, want := strings.Count(manifest.String(), "\n"), 5; got != want {
+		t.Errorf("unexpected number of manifest entries: got %d, want %d", got, want)
+	}
+	if problems, err := VerifyFileManifest(ctx, bytes.NewReader(manifest.Bytes()), mirrorDir, true); err != nil {
+		t.Fatalf("failure verifying the unmodified mirror: %v", err)
+	} else if len(problems) > 0 {
+		t.Errorf("unexpected problems with the unmodified mirror: %q", problems)
+	}
+
+	if err := os.WriteFile(filepath.Join(mirrored, "a.txt"), []byte("modified"), 0600); err != nil {
+		t.Fatalf("failure modifying the mirrored file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(mirrored, "sub", "c.txt")); err != nil {
+		t.Fatalf("failure removing the mirrored file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mirrored, "extra.txt"), []byte("extra"), 0600); err != nil {
+		t.Fatalf("failure adding an extra file: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(mirrored, "b.txt"), later, later); err != nil {
+		t.Fatalf("failure touching the mirrored file: %v", err)
+	}
+	rel := filepath.ToSlash(strings.TrimPrefix(tracked, string(filepath.Separator)))
+	for _, tc := range []struct {
+		checkModTimes bool
+		want          []string
+	}{
+		{false, []string{rel + "/a.txt: size", rel + "/extra.txt: unexpected", rel + "/sub/c.txt: missing"}},
+		{true, []string{rel + "/a.txt: modified", rel + "/a.txt: size", rel + "/b.txt: modified", rel + "/extra.txt: unexpected", rel + "/sub/c.txt: missing"}},
+	} {
+		problems, err := VerifyFileManifest(ctx, bytes.NewReader(manifest.Bytes()), mirrorDir, tc.checkModTimes)
+		if err != nil {
+			t.Fatalf("failure verifying the modified mirror: %v", err)
+		}
+		sort.Strings(problems)
+		if len(problems) != len(tc.want) {
+			t.Errorf("unexpected problems with the modified mirror: got %q, want %q", problems, tc.want)
+			continue
+		}
+		for i, want := range tc.want {
+			if !strings.HasPrefix(problems[i], want) {
+				t.Errorf("unexpected problem: got %q, want %q", problems[i], want)
+			}
+		}
+	}
+}
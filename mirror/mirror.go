@@ -0,0 +1,121 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror maintains plain directory copies of the latest snapshots of tracked paths.
+//
+// A mirror can be read by tools that know nothing about rvcs, such as
+// rsync or a file server.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// manifestFile is the name of the file inside of a mirror that records
+// which snapshot each mirrored path was last updated to.
+//
+// The manifest uses the same format as the contents of a directory snapshot.
+const manifestFile = ".rvcs-mirror"
+
+func readManifest(dir string) (snapshot.Tree, error) {
+	bs, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return make(snapshot.Tree), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the mirror manifest: %w", err)
+	}
+	return snapshot.ParseTree(string(bs))
+}
+
+func writeManifest(dir string, manifest snapshot.Tree) error {
+	tmp, err := os.CreateTemp(dir, manifestFile)
+	if err != nil {
+		return fmt.Errorf("failure creating a temp file for the mirror manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(manifest.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failure writing the mirror manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failure closing the mirror manifest: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("failure replacing the mirror manifest: %w", err)
+	}
+	return nil
+}
+
+// Update brings the mirror in `dir` up to date with the latest snapshots of all tracked paths.
+//
+// Each tracked path is mirrored at the same absolute path relative to
+// `dir`. Only the files that changed since the mirror was last updated
+// are rewritten, and mirrored paths that are no longer tracked are removed.
+func Update(ctx context.Context, s *storage.LocalFiles, dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failure creating the mirror directory %q: %w", dir, err)
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	tracked, err := s.TrackedPaths(ctx)
+	if err != nil {
+		return err
+	}
+	latest := make(snapshot.Tree)
+	for _, p := range tracked {
+		h, _, err := s.FindSnapshot(ctx, p)
+		if err != nil {
+			return fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+		}
+		latest[p] = h
+	}
+	for p := range manifest {
+		if _, ok := latest[p]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, string(p))); err != nil {
+			return fmt.Errorf("failure removing the mirror of the untracked path %q: %w", p, err)
+		}
+		delete(manifest, p)
+	}
+	for p, h := range latest {
+		mirrored := filepath.Join(dir, string(p))
+		if _, err := os.Lstat(mirrored); err == nil && manifest[p].Equal(h) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(mirrored), 0700); err != nil {
+			return fmt.Errorf("failure creating the parent directory of %q: %w", mirrored, err)
+		}
+		// Remove the entry while updating so that an interrupted update is redone from scratch.
+		prev := manifest[p]
+		delete(manifest, p)
+		if err := writeManifest(dir, manifest); err != nil {
+			return err
+		}
+		if err := merge.UpdateExtracted(ctx, s, prev, h, snapshot.Path(mirrored)); err != nil {
+			return fmt.Errorf("failure updating the mirror of %q: %w", p, err)
+		}
+		manifest[p] = h
+	}
+	return writeManifest(dir, manifest)
+}
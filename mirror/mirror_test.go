@@ -0,0 +1,77 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	tracked := filepath.Join(dir, "tracked")
+	mirrorDir := filepath.Join(dir, "mirror")
+	mirrored := filepath.Join(mirrorDir, tracked)
+	if err := os.MkdirAll(filepath.Join(tracked, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the tracked dir: %v", err)
+	}
+	for name, contents := range map[string]string{"unchanged.txt": "same", "changed.txt": "before", "sub/removed.txt": "gone"} {
+		if err := os.WriteFile(filepath.Join(tracked, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating %q: %v", name, err)
+		}
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(tracked)); err != nil {
+		t.Fatalf("failure snapshotting the tracked dir: %v", err)
+	}
+	if err := Update(ctx, s, mirrorDir); err != nil {
+		t.Fatalf("failure creating the mirror: %v", err)
+	}
+	// Mark the unchanged file in the mirror so we can tell if it gets rewritten.
+	marker := []byte("not rewritten")
+	if err := os.WriteFile(filepath.Join(mirrored, "unchanged.txt"), marker, 0600); err != nil {
+		t.Fatalf("failure marking the unchanged file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tracked, "changed.txt"), []byte("after"), 0600); err != nil {
+		t.Fatalf("failure updating the changed file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tracked, "sub", "removed.txt")); err != nil {
+		t.Fatalf("failure removing the removed file: %v", err)
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(tracked)); err != nil {
+		t.Fatalf("failure resnapshotting the tracked dir: %v", err)
+	}
+	if err := Update(ctx, s, mirrorDir); err != nil {
+		t.Fatalf("failure updating the mirror: %v", err)
+	}
+	for name, want := range map[string]string{"unchanged.txt": string(marker), "changed.txt": "after"} {
+		got, err := os.ReadFile(filepath.Join(mirrored, name))
+		if err != nil {
+			t.Errorf("failure reading the mirrored file %q: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("unexpected contents for the mirrored file %q: got %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(mirrored, "sub", "removed.txt")); !os.IsNotExist(err) {
+		t.Errorf("the removed file was not removed from the mirror: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// contextLines is the number of unchanged lines included around each change.
+	contextLines = 3
+
+	// maxEdits bounds the number of line insertions and deletions
+	// computed for a single file.
+	//
+	// The memory used to compute a diff grows with the square of the
+	// number of edits, so files that differ by more than this are
+	// recorded as object references rather than as text.
+	maxEdits = 2000
+)
+
+// splitLines splits text into lines, each of which keeps its trailing newline.
+//
+// Only the last line may be missing a trailing newline.
+func splitLines(text string) []string {
+	var lines []string
+	for len(text) > 0 {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+	return lines
+}
+
+// edit is a single line of a line-based diff.
+type edit struct {
+	// op is one of ' ' for an unchanged line, '-' for a deleted line, or '+' for an inserted line.
+	op   byte
+	line string
+}
+
+// diffLines computes a minimal sequence of edits that transforms `a` into `b`.
+//
+// This uses the algorithm from Eugene Myers' "An O(ND) Difference
+// Algorithm and Its Variations". The returned bool is false if the
+// inputs differ by more than `maxEdits` lines.
+func diffLines(a, b []string) ([]edit, bool) {
+	var prefix, suffix []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, edit{' ', a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxEdits {
+		limit = maxEdits
+	}
+	// v[offset+k] is the furthest x reached on diagonal k, and
+	// trace[d] holds diagonals -d through d of v after d edits.
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	if !found {
+		return nil, false
+	}
+	// Walk the trace backwards to recover the edits in reverse order.
+	var reversed []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, edit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			reversed = append(reversed, edit{'+', b[y-1]})
+		} else {
+			reversed = append(reversed, edit{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, edit{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+	edits := prefix
+	for i := len(reversed) - 1; i >= 0; i-- {
+		edits = append(edits, reversed[i])
+	}
+	for i := len(suffix) - 1; i >= 0; i-- {
+		edits = append(edits, suffix[i])
+	}
+	return edits, true
+}
+
+// hunk is a contiguous group of edits along with the surrounding context.
+type hunk struct {
+	// oldStart and newStart are the zero based indices of the first line of the hunk.
+	oldStart, newStart int
+	edits              []edit
+}
+
+// lengths returns the number of lines the hunk spans before and after it is applied.
+func (h *hunk) lengths() (oldLen, newLen int) {
+	for _, e := range h.edits {
+		if e.op != '+' {
+			oldLen++
+		}
+		if e.op != '-' {
+			newLen++
+		}
+	}
+	return oldLen, newLen
+}
+
+// header returns the "@@ -l,s +l,s @@" line that starts the hunk.
+func (h *hunk) header() string {
+	oldLen, newLen := h.lengths()
+	start := func(i, n int) int {
+		// By convention, empty ranges refer to the line before them.
+		if n == 0 {
+			return i
+		}
+		return i + 1
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", start(h.oldStart, oldLen), oldLen, start(h.newStart, newLen), newLen)
+}
+
+// parseHunkHeader parses the line returned by `hunk.header`.
+func parseHunkHeader(line string) (*hunk, error) {
+	var oldStart, oldLen, newStart, newLen int
+	if _, err := fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@", &oldStart, &oldLen, &newStart, &newLen); err != nil {
+		return nil, fmt.Errorf("malformed hunk header %q: %w", line, err)
+	}
+	h := &hunk{oldStart: oldStart, newStart: newStart}
+	if oldLen > 0 {
+		h.oldStart--
+	}
+	if newLen > 0 {
+		h.newStart--
+	}
+	if h.oldStart < 0 || h.newStart < 0 {
+		return nil, fmt.Errorf("malformed hunk header %q", line)
+	}
+	return h, nil
+}
+
+// hunks groups the given edits into hunks, with up to `contextLines` of
+// unchanged lines around each change.
+func hunks(edits []edit) []*hunk {
+	var result []*hunk
+	var current *hunk
+	oldLine, newLine := 0, 0
+	// lastChange is the index of the most recent inserted or deleted line.
+	lastChange := -1
+	for i, e := range edits {
+		if e.op != ' ' {
+			if current == nil {
+				start := i - contextLines
+				if start < 0 {
+					start = 0
+				}
+				// Back up to include the leading context lines.
+				oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+				current = &hunk{oldStart: oldStart, newStart: newStart, edits: append([]edit(nil), edits[start:i]...)}
+			}
+			current.edits = append(current.edits, e)
+			lastChange = i
+		} else if current != nil {
+			if i-lastChange > 2*contextLines {
+				// Too far from the last change; close the hunk.
+				current.edits = current.edits[:len(current.edits)-(i-lastChange-1-contextLines)]
+				result = append(result, current)
+				current = nil
+			} else {
+				current.edits = append(current.edits, e)
+			}
+		}
+		if e.op != '+' {
+			oldLine++
+		}
+		if e.op != '-' {
+			newLine++
+		}
+	}
+	if current != nil {
+		if trailing := len(edits) - 1 - lastChange; trailing > contextLines {
+			current.edits = current.edits[:len(current.edits)-(trailing-contextLines)]
+		}
+		result = append(result, current)
+	}
+	return result
+}
+
+// applyHunks applies the given hunks to `lines`.
+//
+// Each hunk is applied where its context and deleted lines match,
+// searching outward from the position recorded in the hunk if the
+// lines have moved. An error is returned if any hunk does not match.
+func applyHunks(lines []string, hs []*hunk) ([]string, error) {
+	var result []string
+	// next is the index of the first line of `lines` not yet copied to `result`.
+	next := 0
+	// shift is how far the previous hunk was from its recorded position.
+	shift := 0
+	for i, h := range hs {
+		var old []string
+		for _, e := range h.edits {
+			if e.op != '+' {
+				old = append(old, e.line)
+			}
+		}
+		pos, ok := findLines(lines, old, h.oldStart+shift, next)
+		if !ok {
+			return nil, fmt.Errorf("hunk %d (%s) does not match", i+1, h.header())
+		}
+		shift = pos - h.oldStart
+		result = append(result, lines[next:pos]...)
+		for _, e := range h.edits {
+			if e.op != '-' {
+				result = append(result, e.line)
+			}
+		}
+		next = pos + len(old)
+	}
+	return append(result, lines[next:]...), nil
+}
+
+// findLines finds the position of `want` in `lines` nearest to `near`, and no earlier than `min`.
+func findLines(lines, want []string, near, min int) (int, bool) {
+	matches := func(pos int) bool {
+		if pos < min || pos+len(want) > len(lines) {
+			return false
+		}
+		for i, line := range want {
+			if lines[pos+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for delta := 0; near-delta >= min || near+delta <= len(lines); delta++ {
+		if matches(near - delta) {
+			return near - delta, true
+		}
+		if matches(near + delta) {
+			return near + delta, true
+		}
+	}
+	return 0, false
+}
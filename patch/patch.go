@@ -0,0 +1,552 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package patch defines a portable, textual form for the differences between two snapshots.
+//
+// A patch starts with the line "rvcs-patch 1", followed by the hashes
+// of the two compared snapshots, and then one section per changed file:
+//
+//	change "<PATH>"
+//	before <MODE> <CONTENTS-HASH>
+//	after <MODE> <CONTENTS-HASH>
+//	text|object
+//	<HUNKS>
+//
+// The "before" and "after" lines are "before -" and "after -" for
+// added and deleted files respectively. Changes to text files are
+// followed by the line "text" and then unified diff hunks. All other
+// changes are followed by the line "object", meaning that the new
+// contents are only referenced by their hash; those objects must
+// already be in the storage of whoever applies the patch, e.g. by
+// pulling them or importing a bundle.
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/recursive-version-control-system/diff"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	header = "rvcs-patch 1"
+
+	// maxTextSize is the largest file whose changes are written as text.
+	maxTextSize = 1024 * 1024
+
+	noNewline = `\ No newline at end of file`
+
+	// defaultDirMode is the mode of directories created by a patch at the top level.
+	defaultDirMode = "drwxr-xr-x"
+)
+
+// fileState is the mode and contents of one side of a changed file.
+type fileState struct {
+	mode     string
+	contents *snapshot.Hash
+}
+
+func (fs *fileState) String() string {
+	if fs == nil {
+		return "-"
+	}
+	contents := "-"
+	if fs.contents != nil {
+		contents = fs.contents.String()
+	}
+	return fs.mode + " " + contents
+}
+
+func parseFileState(encoded string) (*fileState, error) {
+	if encoded == "-" {
+		return nil, nil
+	}
+	parts := strings.Split(encoded, " ")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed file state %q", encoded)
+	}
+	fs := &fileState{mode: parts[0]}
+	if parts[1] != "-" {
+		h, err := snapshot.ParseHash(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed contents hash %q: %w", parts[1], err)
+		}
+		fs.contents = h
+	}
+	return fs, nil
+}
+
+// fileChange is a single changed file in a patch.
+type fileChange struct {
+	// path is the slash separated path of the file, relative to the patched snapshot.
+	path string
+
+	before, after *fileState
+
+	// text reports whether or not the new contents are given by `hunks`.
+	text  bool
+	hunks []*hunk
+}
+
+func readText(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) (string, bool, error) {
+	if h == nil {
+		return "", true, nil
+	}
+	size, err := s.ObjectSize(ctx, h)
+	if err != nil {
+		return "", false, fmt.Errorf("failure reading the size of %q: %w", h, err)
+	}
+	if size > maxTextSize {
+		return "", false, nil
+	}
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return "", false, fmt.Errorf("failure opening the contents of %q: %w", h, err)
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return "", false, fmt.Errorf("failure reading the contents of %q: %w", h, err)
+	}
+	if bytes.IndexByte(contents, 0) >= 0 || !utf8.Valid(contents) {
+		return "", false, nil
+	}
+	return string(contents), true, nil
+}
+
+func isRegular(f *snapshot.File) bool {
+	return f == nil || strings.HasPrefix(f.Mode, "-")
+}
+
+func stateOf(f *snapshot.File) *fileState {
+	if f == nil {
+		return nil
+	}
+	return &fileState{mode: f.Mode, contents: f.Contents}
+}
+
+// newFileChange converts the given change into the form written in a patch.
+func newFileChange(ctx context.Context, s *storage.LocalFiles, c *diff.Change) (*fileChange, error) {
+	fc := &fileChange{
+		path:   filepath.ToSlash(c.Path),
+		before: stateOf(c.BeforeFile),
+		after:  stateOf(c.AfterFile),
+	}
+	if c.AfterFile == nil || !isRegular(c.BeforeFile) || !isRegular(c.AfterFile) {
+		return fc, nil
+	}
+	var beforeContents *snapshot.Hash
+	if c.BeforeFile != nil {
+		beforeContents = c.BeforeFile.Contents
+	}
+	before, ok, err := readText(ctx, s, beforeContents)
+	if err != nil || !ok {
+		return fc, err
+	}
+	after, ok, err := readText(ctx, s, c.AfterFile.Contents)
+	if err != nil || !ok {
+		return fc, err
+	}
+	edits, ok := diffLines(splitLines(before), splitLines(after))
+	if !ok {
+		return fc, nil
+	}
+	fc.text = true
+	fc.hunks = hunks(edits)
+	return fc, nil
+}
+
+func (fc *fileChange) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "change %s\n", strconv.Quote(fc.path))
+	fmt.Fprintf(w, "before %s\n", fc.before)
+	fmt.Fprintf(w, "after %s\n", fc.after)
+	if fc.after == nil {
+		return
+	}
+	if !fc.text {
+		w.WriteString("object\n")
+		return
+	}
+	w.WriteString("text\n")
+	for _, h := range fc.hunks {
+		w.WriteString(h.header() + "\n")
+		for _, e := range h.edits {
+			w.WriteByte(e.op)
+			w.WriteString(strings.TrimSuffix(e.line, "\n") + "\n")
+			if !strings.HasSuffix(e.line, "\n") {
+				w.WriteString(noNewline + "\n")
+			}
+		}
+	}
+}
+
+// Format writes a patch describing the changes from the snapshot `before` to the snapshot `after`.
+func Format(ctx context.Context, s *storage.LocalFiles, w io.Writer, before, after *snapshot.Hash) error {
+	changes, err := diff.Compare(ctx, s, before, after)
+	if err != nil {
+		return fmt.Errorf("failure comparing %q and %q: %w", before, after, err)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\nfrom %s\nto %s\n", header, before, after)
+	for _, c := range changes {
+		fc, err := newFileChange(ctx, s, c)
+		if err != nil {
+			return fmt.Errorf("failure formatting the changes to %q: %w", c.Path, err)
+		}
+		fc.write(bw)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failure writing the patch: %w", err)
+	}
+	return nil
+}
+
+// parse reads the changed files from a patch.
+func parse(r io.Reader) ([]*fileChange, error) {
+	br := bufio.NewReader(r)
+	lineNumber := 0
+	readLine := func() (string, bool, error) {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			return "", false, nil
+		} else if err != nil && err != io.EOF {
+			return "", false, fmt.Errorf("failure reading the patch: %w", err)
+		}
+		lineNumber++
+		return line, true, nil
+	}
+	malformed := func(line string) error {
+		return fmt.Errorf("malformed patch line %d: %q", lineNumber, strings.TrimSuffix(line, "\n"))
+	}
+	line, ok, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !ok || strings.TrimSuffix(line, "\n") != header {
+		return nil, fmt.Errorf("not an rvcs patch; the first line must be %q", header)
+	}
+	var changes []*fileChange
+	var current *fileChange
+	var currentHunk *hunk
+	for {
+		line, ok, err := readLine()
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		content := strings.TrimSuffix(line, "\n")
+		if currentHunk != nil && len(content) > 0 && strings.ContainsRune(" -+", rune(content[0])) {
+			currentHunk.edits = append(currentHunk.edits, edit{content[0], line[1:]})
+			continue
+		}
+		switch {
+		case content == noNewline && currentHunk != nil && len(currentHunk.edits) > 0:
+			last := &currentHunk.edits[len(currentHunk.edits)-1]
+			last.line = strings.TrimSuffix(last.line, "\n")
+		case strings.HasPrefix(content, "@@ ") && current != nil && current.text:
+			if currentHunk, err = parseHunkHeader(content); err != nil {
+				return nil, fmt.Errorf("malformed patch line %d: %w", lineNumber, err)
+			}
+			current.hunks = append(current.hunks, currentHunk)
+		case strings.HasPrefix(content, "from "), strings.HasPrefix(content, "to "):
+			if current != nil {
+				return nil, malformed(line)
+			}
+		case strings.HasPrefix(content, "change "):
+			p, err := strconv.Unquote(strings.TrimPrefix(content, "change "))
+			if err != nil {
+				return nil, malformed(line)
+			}
+			current, currentHunk = &fileChange{path: p}, nil
+			changes = append(changes, current)
+			for _, side := range []struct {
+				prefix string
+				state  **fileState
+			}{{"before ", &current.before}, {"after ", &current.after}} {
+				line, ok, err := readLine()
+				if err != nil {
+					return nil, err
+				} else if !ok || !strings.HasPrefix(line, side.prefix) {
+					return nil, malformed(line)
+				}
+				if *side.state, err = parseFileState(strings.TrimSuffix(strings.TrimPrefix(line, side.prefix), "\n")); err != nil {
+					return nil, fmt.Errorf("malformed patch line %d: %w", lineNumber, err)
+				}
+			}
+			if current.after == nil {
+				continue
+			}
+			line, ok, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			switch strings.TrimSuffix(line, "\n") {
+			case "text":
+				current.text = true
+			case "object":
+			default:
+				if !ok {
+					line = ""
+				}
+				return nil, malformed(line)
+			}
+		default:
+			return nil, malformed(line)
+		}
+	}
+	return changes, nil
+}
+
+// ConflictError reports the files that a patch could not be applied to.
+type ConflictError struct {
+	// Paths are the slash separated paths of the conflicting files, relative to the patched snapshot.
+	Paths []string
+}
+
+// Error implements the `error` interface.
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf("the patch does not apply to %s", strings.Join(err.Paths, ", "))
+}
+
+// Is reports that a `*ConflictError` matches `storage.ErrConflict`.
+func (err *ConflictError) Is(target error) bool {
+	return target == storage.ErrConflict
+}
+
+// applier builds new snapshots with the changes from a patch applied.
+type applier struct {
+	s         *storage.LocalFiles
+	conflicts []string
+}
+
+func (a *applier) conflict(p string) {
+	if len(p) == 0 {
+		p = "."
+	}
+	a.conflicts = append(a.conflicts, p)
+}
+
+func (a *applier) store(ctx context.Context, f *snapshot.File) (*snapshot.Hash, error) {
+	h, err := a.s.StoreObject(ctx, strings.NewReader(f.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the file snapshot %+v: %w", f, err)
+	}
+	return h, nil
+}
+
+// applyFile applies a change to a single file, whose current snapshot is `h`.
+//
+// The returned hash is nil if the file was deleted.
+func (a *applier) applyFile(ctx context.Context, h *snapshot.Hash, f *snapshot.File, fc *fileChange, version snapshot.FormatVersion) (*snapshot.Hash, error) {
+	var current *snapshot.Hash
+	if f != nil {
+		current = f.Contents
+	}
+	if fc.after == nil {
+		if f == nil || (!f.IsDir() && current.Equal(fc.before.contents)) {
+			return nil, nil
+		}
+		a.conflict(fc.path)
+		return h, nil
+	}
+	if f != nil && f.Mode == fc.after.mode && current.Equal(fc.after.contents) {
+		// The change has already been applied.
+		return h, nil
+	}
+	if f.IsDir() {
+		// The only directories that may be replaced are those left empty by the patch.
+		tree, err := a.s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return nil, err
+		}
+		if len(tree) > 0 || fc.before != nil {
+			a.conflict(fc.path)
+			return h, nil
+		}
+		f, current = nil, nil
+	}
+	if (f == nil) != (fc.before == nil) {
+		// Either the file was added on both sides or it was modified in the patch but is missing here.
+		a.conflict(fc.path)
+		return h, nil
+	}
+	contents := fc.after.contents
+	if fc.text {
+		text, ok, err := readText(ctx, a.s, current)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			a.conflict(fc.path)
+			return h, nil
+		}
+		lines, err := applyHunks(splitLines(text), fc.hunks)
+		if err != nil {
+			a.conflict(fc.path)
+			return h, nil
+		}
+		if contents, err = a.s.StoreObject(ctx, strings.NewReader(strings.Join(lines, ""))); err != nil {
+			return nil, fmt.Errorf("failure storing the patched contents of %q: %w", fc.path, err)
+		}
+	} else if f != nil && !current.Equal(fc.before.contents) && !current.Equal(contents) {
+		// Changes that are not text can only replace unmodified contents.
+		a.conflict(fc.path)
+		return h, nil
+	} else if contents != nil && !a.s.HasObject(ctx, contents) {
+		return nil, fmt.Errorf("the contents %q of %q are missing from local storage; they must be pulled or imported from a bundle first", contents, fc.path)
+	}
+	result := &snapshot.File{
+		Mode:     fc.after.mode,
+		Contents: contents,
+		Version:  version,
+	}
+	if f != nil {
+		result.Parents = []*snapshot.Hash{h}
+		result.Version = f.Version
+	}
+	return a.store(ctx, result)
+}
+
+// apply applies the given changes to the snapshot `h`, which is at the path `p` within the patched snapshot.
+//
+// `h` may be nil, in which case the file does not yet exist. The returned hash is nil if the file was deleted.
+func (a *applier) apply(ctx context.Context, p string, h *snapshot.Hash, changes []*fileChange, dirMode string, version snapshot.FormatVersion) (*snapshot.Hash, error) {
+	var f *snapshot.File
+	if h != nil {
+		var err error
+		if f, err = a.s.ReadSnapshot(ctx, h); err != nil {
+			return nil, fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+		}
+		version = f.Version
+	}
+	var self *fileChange
+	children := make(map[snapshot.Path][]*fileChange)
+	for _, c := range changes {
+		rel := strings.TrimPrefix(strings.TrimPrefix(c.path, p), "/")
+		if len(rel) == 0 {
+			self = c
+			continue
+		}
+		child := strings.SplitN(rel, "/", 2)[0]
+		children[snapshot.Path(child)] = append(children[snapshot.Path(child)], c)
+	}
+	// Deletions are applied before the changes to the children, and
+	// additions after, so that files may be replaced with directories
+	// and vice versa.
+	if self != nil && self.after == nil {
+		var err error
+		if h, err = a.applyFile(ctx, h, f, self, version); err != nil {
+			return nil, err
+		}
+		if h == nil {
+			f = nil
+		}
+	}
+	if len(children) > 0 {
+		if f != nil && !f.IsDir() {
+			for _, cs := range children {
+				for _, c := range cs {
+					a.conflict(c.path)
+				}
+			}
+			return h, nil
+		}
+		tree := make(snapshot.Tree)
+		result := &snapshot.File{Mode: dirMode, Version: version}
+		if f != nil {
+			var err error
+			if tree, err = a.s.ListDirectorySnapshotContents(ctx, h, f); err != nil {
+				return nil, fmt.Errorf("failure listing the contents of %q: %w", p, err)
+			}
+			result = &snapshot.File{Mode: f.Mode, Parents: []*snapshot.Hash{h}, Version: f.Version}
+		}
+		var names []string
+		for child := range children {
+			names = append(names, string(child))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := snapshot.Path(name)
+			childHash, err := a.apply(ctx, strings.TrimPrefix(p+"/"+name, "/"), tree[child], children[child], result.Mode, result.Version)
+			if err != nil {
+				return nil, err
+			}
+			if childHash == nil {
+				delete(tree, child)
+			} else {
+				tree[child] = childHash
+			}
+		}
+		contents, err := a.s.StoreObject(ctx, strings.NewReader(tree.Encode(result.Version)))
+		if err != nil {
+			return nil, fmt.Errorf("failure storing the contents of %q: %w", p, err)
+		}
+		if result.Contents = contents; f != nil && f.Contents.Equal(contents) {
+			// Nothing changed in this directory.
+		} else if h, err = a.store(ctx, result); err != nil {
+			return nil, err
+		}
+		if f, err = a.s.ReadSnapshot(ctx, h); err != nil {
+			return nil, fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+		}
+	}
+	if self != nil && self.after != nil {
+		return a.applyFile(ctx, h, f, self, version)
+	}
+	return h, nil
+}
+
+// Apply applies the patch read from `r` to the snapshot `base`, and returns the hash of the resulting snapshot.
+//
+// The resulting snapshot records `base` as its parent, so it can be
+// merged into the location `base` was taken from. Text changes are
+// applied wherever their surrounding lines match, so `base` does not
+// have to be the snapshot the patch was created from. Directories
+// left empty by the patch are kept.
+//
+// If any file has conflicting changes, then no snapshot is returned,
+// and the error is a `*ConflictError` listing the conflicting files.
+func Apply(ctx context.Context, s *storage.LocalFiles, r io.Reader, base *snapshot.Hash) (*snapshot.Hash, error) {
+	changes, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return base, nil
+	}
+	a := &applier{s: s}
+	h, err := a.apply(ctx, "", base, changes, defaultDirMode, snapshot.LegacyFormat)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.conflicts) > 0 {
+		sort.Strings(a.conflicts)
+		return nil, &ConflictError{Paths: a.conflicts}
+	}
+	if h == nil {
+		return nil, fmt.Errorf("the patch deletes the entire snapshot %q", base)
+	}
+	return h, nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/merge"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestDiffAndApplyLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func(n int) []string {
+		var lines []string
+		for i := 0; i < n; i++ {
+			lines = append(lines, fmt.Sprintf("line %d\n", r.Intn(20)))
+		}
+		return lines
+	}
+	for i := 0; i < 100; i++ {
+		a, b := randomLines(r.Intn(40)), randomLines(r.Intn(40))
+		if r.Intn(2) == 0 && len(b) > 0 {
+			b[len(b)-1] = strings.TrimSuffix(b[len(b)-1], "\n")
+		}
+		edits, ok := diffLines(a, b)
+		if !ok {
+			t.Fatalf("unexpectedly too many edits between %q and %q", a, b)
+		}
+		got, err := applyHunks(a, hunks(edits))
+		if err != nil {
+			t.Fatalf("failure applying the diff between %q and %q: %v", a, b, err)
+		}
+		if strings.Join(got, "") != strings.Join(b, "") {
+			t.Errorf("unexpected result of applying the diff from %q to %q: got %q", a, b, got)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatalf("failure creating the parent directory of %q: %v", p, err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", p, err)
+		}
+	}
+}
+
+func numberedLines(first string, n int) string {
+	var lines []string
+	if len(first) > 0 {
+		lines = append(lines, first)
+	}
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestFormatAndApply(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	takeSnapshot := func(p string) *snapshot.Hash {
+		h, _, err := snapshot.Current(ctx, s, snapshot.Path(p))
+		if err != nil {
+			t.Fatalf("failure snapshotting %q: %v", p, err)
+		}
+		return h
+	}
+
+	src := filepath.Join(dir, "src")
+	writeFiles(t, src, map[string]string{
+		"a.txt":       numberedLines("", 20),
+		"binary":      "\x00\x01\x02",
+		"sub/old.txt": "old\n",
+		"gone.txt":    "gone\n",
+	})
+	before := takeSnapshot(src)
+	if err := os.RemoveAll(filepath.Join(src, "sub", "old.txt")); err != nil {
+		t.Fatalf("failure removing an example file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(src, "gone.txt")); err != nil {
+		t.Fatalf("failure removing an example file: %v", err)
+	}
+	modified := strings.Replace(strings.Replace(numberedLines("", 20), "line 2\n", "line two\n", 1), "line 17\n", "line seventeen\n", 1)
+	writeFiles(t, src, map[string]string{
+		"a.txt":             modified,
+		"binary":            "\x00\x03",
+		"new/dir/added.txt": "added",
+	})
+	after := takeSnapshot(src)
+
+	var p bytes.Buffer
+	if err := Format(ctx, s, &p, before, after); err != nil {
+		t.Fatalf("failure formatting the patch: %v", err)
+	}
+	for _, want := range []string{"-line 2\n+line two\n", "+added\n" + noNewline + "\n", "change \"binary\"\n"} {
+		if !strings.Contains(p.String(), want) {
+			t.Errorf("the patch %q does not contain %q", p.String(), want)
+		}
+	}
+
+	// Apply the patch to a snapshot with unrelated changes.
+	other := filepath.Join(dir, "other")
+	writeFiles(t, other, map[string]string{
+		"a.txt":       numberedLines("inserted", 20),
+		"binary":      "\x00\x01\x02",
+		"sub/old.txt": "old\n",
+		"gone.txt":    "gone\n",
+		"extra.txt":   "extra\n",
+	})
+	base := takeSnapshot(other)
+	h, err := Apply(ctx, s, bytes.NewReader(p.Bytes()), base)
+	if err != nil {
+		t.Fatalf("failure applying the patch: %v", err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := merge.Extract(ctx, s, h, snapshot.Path(out)); err != nil {
+		t.Fatalf("failure extracting the patched snapshot: %v", err)
+	}
+	want := map[string]string{
+		"a.txt":             "inserted\n" + modified,
+		"binary":            "\x00\x03",
+		"new/dir/added.txt": "added",
+		"extra.txt":         "extra\n",
+	}
+	for name, contents := range want {
+		if got, err := os.ReadFile(filepath.Join(out, name)); err != nil {
+			t.Errorf("failure reading the patched file %q: %v", name, err)
+		} else if string(got) != contents {
+			t.Errorf("unexpected contents for the patched file %q: got %q, want %q", name, got, contents)
+		}
+	}
+	for _, name := range []string{"gone.txt", "sub/old.txt"} {
+		if _, err := os.Lstat(filepath.Join(out, name)); !os.IsNotExist(err) {
+			t.Errorf("unexpectedly found the deleted file %q: %v", name, err)
+		}
+	}
+	patched, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading the patched snapshot: %v", err)
+	}
+	if len(patched.Parents) != 1 || !patched.Parents[0].Equal(base) {
+		t.Errorf("unexpected parents for the patched snapshot: got %v, want [%q]", patched.Parents, base)
+	}
+
+	// Binary files changed on both sides conflict.
+	writeFiles(t, other, map[string]string{"binary": "\x00\x04"})
+	base = takeSnapshot(other)
+	_, err = Apply(ctx, s, bytes.NewReader(p.Bytes()), base)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("unexpected result applying a conflicting patch: %v", err)
+	}
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("conflicts do not match %v: %v", storage.ErrConflict, err)
+	}
+	if got, want := strings.Join(conflict.Paths, ","), "binary"; got != want {
+		t.Errorf("unexpected conflicts: got %q, want %q", got, want)
+	}
+}
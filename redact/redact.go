@@ -0,0 +1,172 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact rewrites snapshots without the metadata that identifies who took them and exactly when.
+//
+// Redacted snapshots keep the same tree structure, modes, and file
+// contents as the originals, so the contents of every file have the
+// same hash, but the author of each snapshot is removed and the times
+// recorded in it are truncated to the day. Since metadata is part of
+// each snapshot, the redacted snapshots, and their parents, have new
+// hashes.
+//
+// Redaction is deterministic, so redacting the same snapshot twice
+// results in the same hash. This allows redacted snapshots to be
+// pushed incrementally.
+package redact
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// removedKeys are the metadata keys that are removed when redacting a snapshot.
+var removedKeys = []string{snapshot.AuthorMetadataKey}
+
+// truncatedKeys are the metadata keys holding times that are truncated to the day when redacting a snapshot.
+var truncatedKeys = []string{snapshot.TimeMetadataKey, snapshot.DirectoryTimeMetadataKey}
+
+// redactor redacts snapshots, remembering the snapshots it has already redacted.
+type redactor struct {
+	s        *storage.LocalFiles
+	redacted map[snapshot.Hash]*snapshot.Hash
+}
+
+// Snapshots stores redacted copies of the given snapshots, along with their entire histories, in `s`.
+//
+// The returned hashes are those of the redacted snapshots, in the
+// same order as `hs`. The original snapshots are left unchanged.
+func Snapshots(ctx context.Context, s *storage.LocalFiles, hs []*snapshot.Hash) ([]*snapshot.Hash, error) {
+	r := &redactor{s: s, redacted: make(map[snapshot.Hash]*snapshot.Hash)}
+	var result []*snapshot.Hash
+	for _, h := range hs {
+		redacted, err := r.redact(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, redacted)
+	}
+	return result, nil
+}
+
+// Snapshot stores a redacted copy of the snapshot `h`, along with its entire history, in `s`.
+func Snapshot(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) (*snapshot.Hash, error) {
+	redacted, err := Snapshots(ctx, s, []*snapshot.Hash{h})
+	if err != nil {
+		return nil, err
+	}
+	return redacted[0], nil
+}
+
+// redactMetadata returns a copy of `metadata` without the identifying keys, and with its times truncated.
+func redactMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	result := make(map[string]string)
+	for key, value := range metadata {
+		result[key] = value
+	}
+	for _, key := range removedKeys {
+		delete(result, key)
+	}
+	for _, key := range truncatedKeys {
+		value, ok := result[key]
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			// The value cannot be truncated, so it is removed instead.
+			delete(result, key)
+			continue
+		}
+		t = t.UTC()
+		result[key] = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Format(time.RFC3339Nano)
+	}
+	return result
+}
+
+// redactTree returns a copy of `tree` in which each snapshot is redacted.
+func (r *redactor) redactTree(ctx context.Context, tree snapshot.Tree) (snapshot.Tree, error) {
+	result := make(snapshot.Tree)
+	for child, childHash := range tree {
+		redacted, err := r.redact(ctx, childHash)
+		if err != nil {
+			return nil, fmt.Errorf("failure redacting the child %q: %w", child, err)
+		}
+		result[child] = redacted
+	}
+	return result, nil
+}
+
+func (r *redactor) redact(ctx context.Context, h *snapshot.Hash) (*snapshot.Hash, error) {
+	if h == nil {
+		return nil, nil
+	}
+	if redacted, ok := r.redacted[*h]; ok {
+		return redacted, nil
+	}
+	f, err := r.s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	redacted := &snapshot.File{
+		Mode:       f.Mode,
+		Contents:   f.Contents,
+		Metadata:   redactMetadata(f.Metadata),
+		Version:    f.Version,
+		Extensions: f.Extensions,
+	}
+	for _, parent := range f.Parents {
+		redactedParent, err := r.redact(ctx, parent)
+		if err != nil {
+			return nil, fmt.Errorf("failure redacting the parent %q of %q: %w", parent, h, err)
+		}
+		redacted.Parents = append(redacted.Parents, redactedParent)
+	}
+	if tombstones, err := f.Tombstones(); err != nil {
+		return nil, fmt.Errorf("failure reading the tombstones of %q: %w", h, err)
+	} else if tombstones != nil {
+		redactedTombstones, err := r.redactTree(ctx, tombstones)
+		if err != nil {
+			return nil, fmt.Errorf("failure redacting the tombstones of %q: %w", h, err)
+		}
+		redacted.Metadata[snapshot.DeletedMetadataKey] = redactedTombstones.String()
+	}
+	if f.IsDir() && f.Contents != nil {
+		tree, err := r.s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return nil, err
+		}
+		redactedTree, err := r.redactTree(ctx, tree)
+		if err != nil {
+			return nil, fmt.Errorf("failure redacting the contents of %q: %w", h, err)
+		}
+		if redacted.Contents, err = r.s.StoreObject(ctx, strings.NewReader(redactedTree.Encode(f.Version))); err != nil {
+			return nil, fmt.Errorf("failure storing the redacted contents of %q: %w", h, err)
+		}
+	}
+	result, err := r.s.StoreObject(ctx, strings.NewReader(redacted.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the redacted snapshot of %q: %w", h, err)
+	}
+	r.redacted[*h] = result
+	return result, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	work := snapshot.Path(filepath.Join(dir, "work"))
+	if err := os.MkdirAll(string(work), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	var h *snapshot.Hash
+	for _, contents := range []string{"first", "second"} {
+		if err := os.WriteFile(string(work.Join("example.txt")), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		var err error
+		sn := snapshot.NewSnapshotter(s, snapshot.WithAuthor("alice@laptop", ""), snapshot.WithRecordTime(true), snapshot.WithDirectoryTimes(true))
+		if h, _, err = sn.Snapshot(ctx, work); err != nil {
+			t.Fatalf("failure snapshotting the example directory: %v", err)
+		}
+	}
+
+	redacted, err := Snapshot(ctx, s, h)
+	if err != nil {
+		t.Fatalf("failure redacting %q: %v", h, err)
+	}
+	if again, err := Snapshot(ctx, s, h); err != nil || !again.Equal(redacted) {
+		t.Errorf("redacting %q again returned %q, %v; want %q", h, again, err, redacted)
+	}
+
+	original, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading %q: %v", h, err)
+	}
+	var check func(h, redacted *snapshot.Hash)
+	check = func(h, redacted *snapshot.Hash) {
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			t.Fatalf("failure reading %q: %v", h, err)
+		}
+		rf, err := s.ReadSnapshot(ctx, redacted)
+		if err != nil {
+			t.Fatalf("failure reading the redacted snapshot %q: %v", redacted, err)
+		}
+		if _, ok := rf.Metadata[snapshot.AuthorMetadataKey]; ok {
+			t.Errorf("the redacted snapshot %q still records its author", redacted)
+		}
+		for _, key := range []string{snapshot.TimeMetadataKey, snapshot.DirectoryTimeMetadataKey} {
+			value, ok := rf.Metadata[key]
+			if !ok {
+				continue
+			}
+			recorded, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil || !recorded.Equal(recorded.Truncate(24*time.Hour)) {
+				t.Errorf("unexpected %q in the redacted snapshot %q: %q", key, redacted, value)
+			}
+		}
+		if len(rf.Parents) != len(f.Parents) {
+			t.Fatalf("unexpected parents of the redacted snapshot %q: %v", redacted, rf.Parents)
+		}
+		for i, parent := range f.Parents {
+			check(parent, rf.Parents[i])
+		}
+		if !f.IsDir() {
+			if !rf.Contents.Equal(f.Contents) {
+				t.Errorf("unexpected contents of the redacted snapshot %q: got %q, want %q", redacted, rf.Contents, f.Contents)
+			}
+			return
+		}
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			t.Fatalf("failure listing %q: %v", h, err)
+		}
+		redactedTree, err := s.ListDirectorySnapshotContents(ctx, redacted, rf)
+		if err != nil {
+			t.Fatalf("failure listing the redacted snapshot %q: %v", redacted, err)
+		}
+		if len(tree) != len(redactedTree) {
+			t.Fatalf("unexpected children of the redacted snapshot %q: %v", redacted, redactedTree)
+		}
+		for child, childHash := range tree {
+			check(childHash, redactedTree[child])
+		}
+	}
+	if _, ok := original.Metadata[snapshot.AuthorMetadataKey]; !ok {
+		t.Fatalf("the original snapshot %q does not record its author", h)
+	}
+	check(h, redacted)
+}
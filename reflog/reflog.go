@@ -0,0 +1,201 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reflog defines a log of the changes made to the latest snapshot of each path.
+//
+// Each time a subcommand such as "snapshot", "merge", "restore", "squash",
+// or "undo" changes the latest snapshot recorded for a path, the change is
+// appended to the reflog. That way the previous snapshot of the path
+// can still be found, even if it is no longer in the path's history.
+//
+// The reflog is stored as a config file of the archive, with one line
+// per change of the form:
+//
+//	<TIME> <PREVIOUS-HASH> <NEW-HASH> <ACTION> <QUOTED-PATH>
+//
+// where <TIME> is in RFC 3339 format, and a missing hash is written as "-".
+package reflog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// reflogConfig is the name of the archive config file holding the reflog.
+const reflogConfig = "reflog"
+
+// noHash is written in place of a missing hash.
+const noHash = "-"
+
+// Entry records a single change to the latest snapshot of a path.
+type Entry struct {
+	// Time is when the change was made.
+	Time time.Time
+
+	// Path is the path whose latest snapshot changed.
+	Path snapshot.Path
+
+	// Prev is the previous latest snapshot of the path, if there was one.
+	Prev *snapshot.Hash
+
+	// New is the new latest snapshot of the path.
+	New *snapshot.Hash
+
+	// Action is the name of the subcommand that made the change.
+	Action string
+}
+
+func encodeHash(h *snapshot.Hash) string {
+	if h == nil {
+		return noHash
+	}
+	return h.String()
+}
+
+func parseHash(encoded string) (*snapshot.Hash, error) {
+	if encoded == noHash {
+		return nil, nil
+	}
+	return snapshot.ParseHash(encoded)
+}
+
+func (e *Entry) String() string {
+	return strings.Join([]string{
+		e.Time.UTC().Format(time.RFC3339Nano),
+		encodeHash(e.Prev),
+		encodeHash(e.New),
+		e.Action,
+		strconv.Quote(string(e.Path)),
+	}, " ")
+}
+
+func parseEntry(line string) (*Entry, error) {
+	fields := strings.SplitN(line, " ", 5)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("malformed reflog entry %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed time in the reflog entry %q: %w", line, err)
+	}
+	prev, err := parseHash(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed previous hash in the reflog entry %q: %w", line, err)
+	}
+	h, err := parseHash(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed new hash in the reflog entry %q: %w", line, err)
+	}
+	p, err := strconv.Unquote(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed path in the reflog entry %q: %w", line, err)
+	}
+	return &Entry{Time: t, Path: snapshot.Path(p), Prev: prev, New: h, Action: fields[3]}, nil
+}
+
+// Record appends a change to the latest snapshot of the path `p` to the reflog of the given archive.
+//
+// Nothing is recorded if the latest snapshot did not actually change.
+func Record(ctx context.Context, s *storage.LocalFiles, action string, p snapshot.Path, prev, h *snapshot.Hash) error {
+	if prev.Equal(h) {
+		return nil
+	}
+	if len(action) == 0 || strings.ContainsAny(action, " \n") {
+		return fmt.Errorf("invalid reflog action %q", action)
+	}
+	e := &Entry{
+		Time:   time.Now(),
+		Path:   p,
+		Prev:   prev,
+		New:    h,
+		Action: action,
+	}
+	reflogFile := s.ConfigFile(reflogConfig)
+	if err := os.MkdirAll(filepath.Dir(reflogFile), 0700); err != nil {
+		return fmt.Errorf("failure creating the config dir: %w", err)
+	}
+	out, err := os.OpenFile(reflogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failure opening the reflog: %w", err)
+	}
+	if _, err := fmt.Fprintln(out, e); err != nil {
+		out.Close()
+		return fmt.Errorf("failure updating the reflog: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failure updating the reflog: %w", err)
+	}
+	return nil
+}
+
+// Read reads the entries in the reflog for the path `p`, in the order they were recorded.
+//
+// If `p` is empty, then the entries for every path are returned.
+func Read(s *storage.LocalFiles, p snapshot.Path) ([]*Entry, error) {
+	bs, err := os.ReadFile(s.ConfigFile(reflogConfig))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the reflog: %w", err)
+	}
+	var entries []*Entry
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		e, err := parseEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) == 0 || e.Path == p {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Relocate rewrites the reflog entries for the path `old`, and for every path within it, to be for the path `new`.
+//
+// This keeps the reflog of a path that has been moved with
+// `storage.LocalFiles.Relocate` under its new location.
+func Relocate(ctx context.Context, s *storage.LocalFiles, old, new snapshot.Path) error {
+	entries, err := Read(s, "")
+	if err != nil {
+		return err
+	}
+	relocated := false
+	var lines []string
+	for _, e := range entries {
+		if p, ok := e.Path.Relocate(old, new); ok {
+			e.Path = p
+			relocated = true
+		}
+		lines = append(lines, e.String())
+	}
+	if !relocated {
+		return nil
+	}
+	if err := s.WriteConfigFile(ctx, reflogConfig, []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return fmt.Errorf("failure rewriting the reflog: %w", err)
+	}
+	return nil
+}
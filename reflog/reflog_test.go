@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reflog
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if entries, err := Read(s, ""); err != nil || len(entries) != 0 {
+		t.Errorf("unexpected result reading an empty reflog: %v, %v", entries, err)
+	}
+	var hashes []*snapshot.Hash
+	for _, contents := range []string{"first", "second"} {
+		h, err := s.StoreObject(ctx, strings.NewReader(contents))
+		if err != nil {
+			t.Fatalf("failure storing the example object %q: %v", contents, err)
+		}
+		hashes = append(hashes, h)
+	}
+	docs := snapshot.Path(filepath.Join(dir, "docs"))
+	odd := snapshot.Path(filepath.Join(dir, "odd\nname"))
+	for _, e := range []struct {
+		action  string
+		p       snapshot.Path
+		prev, h *snapshot.Hash
+	}{
+		{"snapshot", docs, nil, hashes[0]},
+		{"snapshot", docs, hashes[0], hashes[1]},
+		{"snapshot", docs, hashes[1], hashes[1]},
+		{"undo", docs, hashes[1], hashes[0]},
+		{"snapshot", odd, nil, hashes[0]},
+	} {
+		if err := Record(ctx, s, e.action, e.p, e.prev, e.h); err != nil {
+			t.Fatalf("failure recording the %s of %q: %v", e.action, e.p, err)
+		}
+	}
+	if err := Record(ctx, s, "bad action", docs, nil, hashes[0]); err == nil {
+		t.Error("unexpected success recording an invalid action")
+	}
+
+	entries, err := Read(s, docs)
+	if err != nil {
+		t.Fatalf("failure reading the reflog: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("unexpected number of reflog entries for %q: %+v", docs, entries)
+	}
+	if e := entries[0]; e.Action != "snapshot" || e.Prev != nil || !e.New.Equal(hashes[0]) {
+		t.Errorf("unexpected first reflog entry: %+v", e)
+	}
+	if e := entries[2]; e.Action != "undo" || !e.Prev.Equal(hashes[1]) || !e.New.Equal(hashes[0]) || e.Path != docs {
+		t.Errorf("unexpected last reflog entry: %+v", e)
+	}
+	if entries, err := Read(s, odd); err != nil || len(entries) != 1 || entries[0].Path != odd {
+		t.Errorf("unexpected reflog entries for %q: %+v, %v", odd, entries, err)
+	}
+	if entries, err := Read(s, ""); err != nil || len(entries) != 4 {
+		t.Errorf("unexpected reflog entries for all paths: %+v, %v", entries, err)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	h, err := s.StoreObject(ctx, strings.NewReader("example"))
+	if err != nil {
+		t.Fatalf("failure storing the example object: %v", err)
+	}
+	old := snapshot.Path(filepath.Join(dir, "old"))
+	other := snapshot.Path(filepath.Join(dir, "other"))
+	for _, p := range []snapshot.Path{old, old.Join("child"), other} {
+		if err := Record(ctx, s, "snapshot", p, nil, h); err != nil {
+			t.Fatalf("failure recording the snapshot of %q: %v", p, err)
+		}
+	}
+	new := snapshot.Path(filepath.Join(dir, "new"))
+	if err := Relocate(ctx, s, old, new); err != nil {
+		t.Fatalf("failure relocating the reflog of %q: %v", old, err)
+	}
+	entries, err := Read(s, "")
+	if err != nil {
+		t.Fatalf("failure reading the relocated reflog: %v", err)
+	}
+	var got []snapshot.Path
+	for _, e := range entries {
+		got = append(got, e.Path)
+	}
+	if want := []snapshot.Path{new, new.Join("child"), other}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected paths in the relocated reflog: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Backend is the storage of a remote archive.
+//
+// Lookups of objects, snapshots, or tracks that the backend does not
+// have return an error satisfying `os.IsNotExist`.
+type Backend interface {
+	// HasObject reports whether or not the backend has the given object.
+	HasObject(ctx context.Context, h *snapshot.Hash) bool
+
+	// ReadObject opens the given object for reading.
+	ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error)
+
+	// WriteObject stores the object read from `reader`.
+	//
+	// The object must be rejected if its contents do not match `h`.
+	WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error
+
+	// FindSnapshot returns the latest snapshot recorded for the given path.
+	FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error)
+
+	// StoreSnapshot records `h` as the latest snapshot of the given path.
+	//
+	// The snapshot and everything it references must already be stored.
+	StoreSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error
+
+	// FindTrack returns the latest snapshot recorded for the given track.
+	FindTrack(ctx context.Context, id string) (*snapshot.Hash, error)
+
+	// StoreTrack records `h` as the latest snapshot of the given track.
+	StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// Thawer is implemented by backends that may hold objects in cold
+// storage, from which they have to be retrieved before they can be read.
+type Thawer interface {
+	// ThawObject requests that the given object be made readable, if
+	// it is not already, and reports whether or not it can be read now.
+	//
+	// Retrieving an object from cold storage may take hours, so this
+	// does not wait for it; it should be called again later to check.
+	ThawObject(ctx context.Context, h *snapshot.Hash) (bool, error)
+}
+
+// ThawObject requests that the object `h` held by the backend `b` be made readable.
+//
+// The returned value reports whether or not the object can be read now.
+// Objects held by backends that do not implement `Thawer` can always be
+// read, as long as the backend has them.
+func ThawObject(ctx context.Context, b Backend, h *snapshot.Hash) (bool, error) {
+	if t, ok := b.(Thawer); ok {
+		return t.ThawObject(ctx, h)
+	}
+	if !b.HasObject(ctx, h) {
+		return false, fmt.Errorf("the object %q is missing: %w", h, os.ErrNotExist)
+	}
+	return true, nil
+}
+
+// Generationer is implemented by backends that can report when objects
+// may have been removed from them, such as by garbage collection.
+type Generationer interface {
+	// Generation returns a token that changes whenever objects are
+	// removed from the backend.
+	//
+	// An empty token means that no objects have ever been removed.
+	Generation(ctx context.Context) (string, error)
+}
+
+// Generation returns the generation token of the backend `b`.
+//
+// Backends that do not implement `Generationer` are assumed to never
+// remove objects, so their token is always empty.
+func Generation(ctx context.Context, b Backend) (string, error) {
+	if g, ok := b.(Generationer); ok {
+		return g.Generation(ctx)
+	}
+	return "", nil
+}
+
+// localBackend is the backend for remote archives accessed via the file system.
+type localBackend struct {
+	s *storage.LocalFiles
+}
+
+// NewLocalBackend returns a backend for the given archive.
+func NewLocalBackend(s *storage.LocalFiles) Backend {
+	return &localBackend{s: s}
+}
+
+func (b *localBackend) HasObject(ctx context.Context, h *snapshot.Hash) bool {
+	return b.s.HasObject(ctx, h)
+}
+
+func (b *localBackend) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
+	return b.s.ReadObject(ctx, h)
+}
+
+func (b *localBackend) Generation(ctx context.Context) (string, error) {
+	return b.s.Generation()
+}
+
+func (b *localBackend) WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error {
+	return b.s.StoreVerifiedObject(ctx, reader, h)
+}
+
+func (b *localBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	h, _, err := b.s.FindSnapshot(ctx, p)
+	return h, err
+}
+
+func (b *localBackend) StoreSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error {
+	f, err := b.s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return err
+	}
+	_, err = b.s.StoreSnapshot(ctx, p, f)
+	return err
+}
+
+func (b *localBackend) FindTrack(ctx context.Context, id string) (*snapshot.Hash, error) {
+	return b.s.FindTrack(ctx, id)
+}
+
+func (b *localBackend) StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error {
+	return b.s.StoreTrack(ctx, id, h)
+}
+
+func (b *localBackend) Close() error {
+	return nil
+}
+
+// pluginSeparator separates the name of a backend plugin from the address passed to it.
+const pluginSeparator = "::"
+
+// Plugin returns the name of the backend plugin used for the remote,
+// along with the address passed to it.
+//
+// Remotes whose archive locations have the form `<NAME>::<ADDRESS>`
+// are accessed using the `rvcs-backend-<NAME>` plugin, while all other
+// remotes are accessed via the file system.
+func (r *Remote) Plugin() (name, address string, ok bool) {
+	name, address, ok = strings.Cut(r.ArchiveDir, pluginSeparator)
+	if !ok || !validPluginName(name) {
+		return "", "", false
+	}
+	return name, address, true
+}
+
+func validPluginName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Backend opens the backend for the remote archive.
+//
+// The caller is responsible for closing the returned backend.
+func (r *Remote) Backend(ctx context.Context) (Backend, error) {
+	if name, address, ok := r.Plugin(); ok {
+		b, err := startPlugin(ctx, name, address, !r.NoCompress)
+		if err != nil {
+			return nil, fmt.Errorf("failure starting the backend for the remote %q: %w", r.Name, err)
+		}
+		if !r.Limits.IsZero() {
+			return newLimitedBackend(b, r.Limits), nil
+		}
+		return b, nil
+	}
+	if !r.Limits.IsZero() {
+		return newLimitedBackend(NewLocalBackend(r.Storage()), r.Limits), nil
+	}
+	return NewLocalBackend(r.Storage()), nil
+}
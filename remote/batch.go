@@ -0,0 +1,136 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// BatchOptions controls how small objects are grouped into batches when pushing to backend plugins.
+//
+// Each batch takes two requests: one to find which of its objects the
+// remote is missing, and one to send them. The zero value disables batching.
+type BatchOptions struct {
+	// MaxObjects is the maximum number of objects in a single batch.
+	//
+	// Values below 2 disable batching.
+	MaxObjects int
+
+	// MaxObjectSize is the size in bytes of the largest object that is included in a batch.
+	//
+	// Larger objects are pushed one request at a time.
+	MaxObjectSize int64
+}
+
+// errBatchUnsupported is returned by batch requests to backends that do not support them.
+var errBatchUnsupported = errors.New("batch requests are not supported")
+
+// batchBackend is a backend that can check for and write many objects with a single request each.
+type batchBackend interface {
+	// missingObjects returns the subset of `hs` that the backend does not have.
+	missingObjects(ctx context.Context, hs []*snapshot.Hash) ([]*snapshot.Hash, error)
+
+	// writeObjects stores the objects `hs`, reading the contents of each from the reader returned by `open`.
+	writeObjects(ctx context.Context, hs []*snapshot.Hash, open func(*snapshot.Hash) (io.ReadCloser, error)) error
+}
+
+// copyBatch copies the objects `hs` that the backend is missing in a single batch.
+func copyBatch(ctx context.Context, s *storage.LocalFiles, bb batchBackend, hs []*snapshot.Hash, stats *PushStats) error {
+	missing, err := bb.missingObjects(ctx, hs)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, h := range missing {
+		objSize, err := s.ObjectSize(ctx, h)
+		if err != nil {
+			return fmt.Errorf("failure reading the size of the object %q: %w", h, err)
+		}
+		size += objSize
+	}
+	if len(missing) > 0 {
+		open := func(h *snapshot.Hash) (io.ReadCloser, error) {
+			return s.ReadObject(ctx, h)
+		}
+		if err := bb.writeObjects(ctx, missing, open); err != nil {
+			return fmt.Errorf("failure copying a batch of %d objects: %w", len(missing), err)
+		}
+	}
+	stats.Present += len(hs) - len(missing)
+	stats.Pushed += len(missing)
+	stats.Bytes += size
+	return nil
+}
+
+// pushObjects copies each of the objects that the backend does not already have.
+//
+// The objects are copied in order, except that consecutive small
+// objects are grouped into batches if both `opts` and the backend allow it.
+func pushObjects(ctx context.Context, s *storage.LocalFiles, b Backend, objects []*snapshot.Hash, opts BatchOptions, stats *PushStats) error {
+	bb, batching := b.(batchBackend)
+	batching = batching && opts.MaxObjects > 1
+	var batch []*snapshot.Hash
+	flush := func() error {
+		pending := batch
+		batch = nil
+		if len(pending) == 0 {
+			return nil
+		}
+		if batching {
+			err := copyBatch(ctx, s, bb, pending, stats)
+			if !errors.Is(err, errBatchUnsupported) {
+				return err
+			}
+			batching = false
+		}
+		for _, obj := range pending {
+			if err := copyObject(ctx, s, b, obj, stats); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, obj := range objects {
+		if batching {
+			size, err := s.ObjectSize(ctx, obj)
+			if err != nil {
+				return fmt.Errorf("failure reading the size of the object %q: %w", obj, err)
+			}
+			if size <= opts.MaxObjectSize {
+				batch = append(batch, obj)
+				if len(batch) >= opts.MaxObjects {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			// Keep the objects in order by sending the pending batch first.
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if err := copyObject(ctx, s, b, obj, stats); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Browser reads the snapshots in a remote without pulling them, so
+// that a remote can be browsed without downloading the contents of
+// any files other than those that are read.
+//
+// Objects that are already in the local archive, or in its read-through
+// object cache, are read from there instead of the remote. If the local
+// archive has an `ObjectCacheSize`, then the objects read from the
+// remote are added to its object cache, except for those that cannot be
+// cached, which are read from the remote again and verified against
+// their hashes as they are read.
+type Browser struct {
+	s *storage.LocalFiles
+	b Backend
+}
+
+// NewBrowser returns a browser for the given backend.
+//
+// The local archive `s` may be nil, in which case every object is read from the backend.
+func NewBrowser(s *storage.LocalFiles, b Backend) *Browser {
+	return &Browser{s: s, b: b}
+}
+
+// ReadObject opens the given object for reading.
+func (br *Browser) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
+	if br.s != nil && br.s.HasObject(ctx, h) {
+		return br.s.ReadObject(ctx, h)
+	}
+	reader, err := br.b.ReadObject(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	if br.s == nil || br.s.ObjectCacheSize <= 0 {
+		return reader, nil
+	}
+	cached, err := br.s.CacheObject(ctx, h, reader)
+	reader.Close()
+	if err == nil {
+		return cached, nil
+	}
+	// The object could not be cached, such as when it is larger than the
+	// entire cache, and the attempt consumed part of the reader.
+	reader, err = br.b.ReadObject(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	return newVerifiedReader(reader, h), nil
+}
+
+// verifiedReader reads the contents of an object, and fails at the end
+// of them if they do not match the object's hash.
+type verifiedReader struct {
+	reader io.ReadCloser
+	want   *snapshot.Hash
+
+	// hashed receives everything read, so that it can be hashed as it is read.
+	hashed *io.PipeWriter
+	got    chan hashResult
+
+	// done is set once the end of the contents is reached, with `err` holding the result.
+	done bool
+	err  error
+}
+
+// hashResult is the result of hashing the contents read by a `verifiedReader`.
+type hashResult struct {
+	h   *snapshot.Hash
+	err error
+}
+
+func newVerifiedReader(reader io.ReadCloser, h *snapshot.Hash) *verifiedReader {
+	pr, pw := io.Pipe()
+	got := make(chan hashResult, 1)
+	go func() {
+		h, err := snapshot.NewHash(pr)
+		got <- hashResult{h: h, err: err}
+	}()
+	return &verifiedReader{reader: reader, want: h, hashed: pw, got: got}
+}
+
+// Read implements the `io.Reader` interface.
+func (r *verifiedReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if _, hashErr := r.hashed.Write(p[:n]); hashErr != nil {
+			return n, hashErr
+		}
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	r.done = true
+	r.hashed.Close()
+	if got := <-r.got; got.err != nil {
+		r.err = got.err
+	} else if !got.h.Equal(r.want) {
+		r.err = fmt.Errorf("the contents read for %q hashed to %q: %w", r.want, got.h, storage.ErrCorrupt)
+	} else {
+		r.err = io.EOF
+	}
+	return n, r.err
+}
+
+// Close implements the `io.Closer` interface.
+func (r *verifiedReader) Close() error {
+	r.hashed.CloseWithError(io.ErrClosedPipe)
+	return r.reader.Close()
+}
+
+func (br *Browser) readObjectBytes(ctx context.Context, h *snapshot.Hash) ([]byte, error) {
+	reader, err := br.ReadObject(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the object %q: %w", h, err)
+	}
+	return contents, nil
+}
+
+// ReadSnapshot reads the file snapshot with the given hash.
+func (br *Browser) ReadSnapshot(ctx context.Context, h *snapshot.Hash) (*snapshot.File, error) {
+	contents, err := br.readObjectBytes(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	f, err := snapshot.ParseFile(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the file snapshot for %q: %w: %v", h, storage.ErrCorrupt, err)
+	}
+	return f, nil
+}
+
+// ListDirectorySnapshotContents reads the contents of the directory snapshot `f`, with hash `h`.
+func (br *Browser) ListDirectorySnapshotContents(ctx context.Context, h *snapshot.Hash, f *snapshot.File) (snapshot.Tree, error) {
+	if !f.IsDir() {
+		return nil, fmt.Errorf("%q is not the snapshot of a directory", h)
+	}
+	contents, err := br.readObjectBytes(ctx, f.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the contents of %q: %w", h, err)
+	}
+	tree, err := snapshot.ParseTree(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the directory contents of the snapshot %q: %w: %v", h, storage.ErrCorrupt, err)
+	}
+	for child := range tree {
+		if !snapshot.ValidChildName(child) {
+			return nil, fmt.Errorf("failure parsing the directory contents of the snapshot %q: %w: invalid entry name %q", h, storage.ErrCorrupt, child)
+		}
+	}
+	return tree, nil
+}
+
+// ReadSnapshot reads the file snapshot with the given hash from the backend.
+func ReadSnapshot(ctx context.Context, b Backend, h *snapshot.Hash) (*snapshot.File, error) {
+	return NewBrowser(nil, b).ReadSnapshot(ctx, h)
+}
+
+// ListDirectoryContents reads the contents of the directory snapshot `f`, with hash `h`, from the backend.
+func ListDirectoryContents(ctx context.Context, b Backend, h *snapshot.Hash, f *snapshot.File) (snapshot.Tree, error) {
+	return NewBrowser(nil, b).ListDirectorySnapshotContents(ctx, h, f)
+}
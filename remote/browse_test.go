@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestBrowseWithoutPulling(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(root)); err != nil {
+		t.Fatalf("failure snapshotting the example dir: %v", err)
+	}
+	r := &Remote{Name: "origin", ArchiveDir: filepath.Join(dir, "remote")}
+	h, _, err := Push(ctx, s, r, snapshot.Path(root))
+	if err != nil {
+		t.Fatalf("failure pushing the example dir: %v", err)
+	}
+
+	b, err := r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure opening the remote: %v", err)
+	}
+	defer b.Close()
+	f, err := ReadSnapshot(ctx, b, h)
+	if err != nil {
+		t.Fatalf("failure reading the remote snapshot %q: %v", h, err)
+	}
+	tree, err := ListDirectoryContents(ctx, b, h, f)
+	if err != nil {
+		t.Fatalf("failure listing the remote snapshot %q: %v", h, err)
+	}
+	if len(tree) != 2 || tree["notes.txt"] == nil || tree["sub"] == nil {
+		t.Errorf("unexpected contents of the remote snapshot: %v", tree)
+	}
+	notes, err := ReadSnapshot(ctx, b, tree["notes.txt"])
+	if err != nil {
+		t.Fatalf("failure reading the remote snapshot of the example file: %v", err)
+	}
+	if _, err := ListDirectoryContents(ctx, b, tree["notes.txt"], notes); err == nil {
+		t.Error("unexpected success listing the contents of a file")
+	}
+	if _, err := ReadSnapshot(ctx, b, notes.Contents); err == nil {
+		t.Error("unexpected success reading file contents as a snapshot")
+	}
+}
+
+func TestBrowserObjectCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("notes"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(file)); err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	r := &Remote{Name: "origin", ArchiveDir: filepath.Join(dir, "remote")}
+	h, _, err := Push(ctx, s, r, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure pushing the example file: %v", err)
+	}
+	b, err := r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure opening the remote: %v", err)
+	}
+	defer b.Close()
+
+	// A thin client with an empty archive, that only caches what it reads.
+	client := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "client"), ObjectCacheSize: 1024}
+	br := NewBrowser(client, b)
+	f, err := br.ReadSnapshot(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading the remote snapshot %q: %v", h, err)
+	}
+	reader, err := br.ReadObject(ctx, f.Contents)
+	if err != nil {
+		t.Fatalf("failure reading the remote contents %q: %v", f.Contents, err)
+	}
+	contents, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(contents) != "notes" {
+		t.Errorf("unexpected contents read from the remote: %q, %v", contents, err)
+	}
+	for _, obj := range []*snapshot.Hash{h, f.Contents} {
+		if !client.HasObject(ctx, obj) {
+			t.Errorf("the object %q read from the remote was not cached", obj)
+		}
+	}
+
+	// Objects larger than the entire cache are read from the remote without being cached.
+	small := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "small"), ObjectCacheSize: 2}
+	reader, err = NewBrowser(small, b).ReadObject(ctx, f.Contents)
+	if err != nil {
+		t.Fatalf("failure reading the remote contents %q: %v", f.Contents, err)
+	}
+	contents, err = io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(contents) != "notes" {
+		t.Errorf("unexpected contents read from the remote without caching: %q, %v", contents, err)
+	}
+	if small.HasObject(ctx, f.Contents) {
+		t.Errorf("unexpected caching of the object %q, which is larger than the cache", f.Contents)
+	}
+}
+
+func TestVerifiedReader(t *testing.T) {
+	h, err := snapshot.NewHash(strings.NewReader("notes"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	if contents, err := io.ReadAll(newVerifiedReader(io.NopCloser(strings.NewReader("notes")), h)); err != nil || string(contents) != "notes" {
+		t.Errorf("unexpected result reading matching contents: %q, %v", contents, err)
+	}
+	if _, err := io.ReadAll(newVerifiedReader(io.NopCloser(strings.NewReader("other")), h)); !errors.Is(err, storage.ErrCorrupt) {
+		t.Errorf("unexpected result reading mismatched contents: %v", err)
+	}
+}
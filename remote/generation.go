@@ -0,0 +1,115 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// generationsConfig is the name of the archive config file holding the
+// generation token of each remote as of the last push of each path to it.
+const generationsConfig = "remote-generations"
+
+// generationsMu serializes updates to the recorded generations within this process.
+var generationsMu sync.Mutex
+
+// generationKey identifies a path pushed to a remote.
+//
+// Generations are recorded per path, since whether or not the remote
+// still has everything in a path's latest snapshot depends on whether
+// objects were removed since that path was pushed, regardless of any
+// pushes of other paths in between.
+type generationKey struct {
+	remote string
+	path   snapshot.Path
+}
+
+// readGenerations reads the generation tokens recorded in the given archive.
+//
+// Each line has the form `<REMOTE> <TOKEN> <QUOTED PATH>`. Lines
+// written by older versions of rvcs, without a path, are ignored, so
+// the next push of every path checks all of its objects.
+func readGenerations(s *storage.LocalFiles) (map[generationKey]string, error) {
+	generations := make(map[generationKey]string)
+	bs, err := os.ReadFile(s.ConfigFile(generationsConfig))
+	if os.IsNotExist(err) {
+		return generations, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the remote generations: %w", err)
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) == 2 {
+			continue
+		} else if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed remote generation %q", line)
+		}
+		p, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed path in the remote generation %q: %w", line, err)
+		}
+		generations[generationKey{remote: fields[0], path: snapshot.Path(p)}] = fields[1]
+	}
+	return generations, nil
+}
+
+// knownGeneration returns the generation token recorded for the path `p` in the named remote, or the empty string if there is none.
+func knownGeneration(s *storage.LocalFiles, name string, p snapshot.Path) (string, error) {
+	generations, err := readGenerations(s)
+	if err != nil {
+		return "", err
+	}
+	return generations[generationKey{remote: name, path: p}], nil
+}
+
+// recordGeneration records `token` as the generation of the named remote as of the last push of the path `p` to it.
+func recordGeneration(ctx context.Context, s *storage.LocalFiles, name string, p snapshot.Path, token string) error {
+	generationsMu.Lock()
+	defer generationsMu.Unlock()
+	generations, err := readGenerations(s)
+	if err != nil {
+		return err
+	}
+	key := generationKey{remote: name, path: p}
+	if generations[key] == token {
+		return nil
+	}
+	if len(token) == 0 {
+		delete(generations, key)
+	} else {
+		generations[key] = token
+	}
+	var lines []string
+	for key, token := range generations {
+		lines = append(lines, key.remote+" "+token+" "+strconv.Quote(string(key.path))+"\n")
+	}
+	sort.Strings(lines)
+	if err := s.WriteConfigFile(ctx, generationsConfig, []byte(strings.Join(lines, ""))); err != nil {
+		return fmt.Errorf("failure writing the remote generations: %w", err)
+	}
+	return nil
+}
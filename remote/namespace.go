@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// Namespaces allow several machines to push to the same remote without
+// the snapshots of their paths colliding. Each machine configures its
+// own namespace, such as "machine/laptop", and the paths it pushes are
+// recorded in the remote beneath that namespace. For example, with the
+// namespace above, "/home/me/docs" is recorded as
+// "/machine/laptop/home/me/docs".
+
+// namespaceConfig is the name of the archive config file holding the namespace.
+const namespaceConfig = "namespace"
+
+// ValidateNamespace reports whether or not the given string can be used as a namespace.
+//
+// Namespaces are sequences of one or more names separated by "/". The
+// empty namespace is also valid, and means that paths are not prefixed.
+func ValidateNamespace(namespace string) error {
+	if len(namespace) == 0 {
+		return nil
+	}
+	for _, name := range strings.Split(namespace, "/") {
+		if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, "\\\n") {
+			return fmt.Errorf("invalid namespace %q", namespace)
+		}
+	}
+	return nil
+}
+
+// ReadNamespace reads the namespace configured for the given archive.
+//
+// If no namespace is configured, then the returned namespace is empty.
+func ReadNamespace(s *storage.LocalFiles) (string, error) {
+	bs, err := os.ReadFile(s.ConfigFile(namespaceConfig))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failure reading the configured namespace: %w", err)
+	}
+	namespace := strings.TrimSpace(string(bs))
+	if err := ValidateNamespace(namespace); err != nil {
+		return "", err
+	}
+	return namespace, nil
+}
+
+// WriteNamespace configures the namespace for the given archive.
+//
+// Writing the empty namespace removes any previously configured namespace.
+func WriteNamespace(ctx context.Context, s *storage.LocalFiles, namespace string) error {
+	if err := ValidateNamespace(namespace); err != nil {
+		return err
+	}
+	if err := s.WriteConfigFile(ctx, namespaceConfig, []byte(namespace)); err != nil {
+		return fmt.Errorf("failure writing the configured namespace: %w", err)
+	}
+	return nil
+}
+
+// NamespacedPath returns the path used in remotes for the path `p` in the given namespace.
+func NamespacedPath(namespace string, p snapshot.Path) snapshot.Path {
+	if len(namespace) == 0 {
+		return p
+	}
+	return snapshot.Path(string(filepath.Separator) + filepath.FromSlash(namespace)).Join(p)
+}
+
+// ListPaths lists the top-level paths recorded in the remote `r` within the given namespace.
+//
+// The namespace is removed from the returned paths, and paths outside
+// of it are omitted. If the namespace is empty, then every path is
+// returned as it is recorded in the remote, including those of every
+// namespace.
+//
+// This is only supported for remotes accessed via the file system.
+func ListPaths(ctx context.Context, r *Remote, namespace string) ([]snapshot.Path, error) {
+	if _, _, isPlugin := r.Plugin(); isPlugin {
+		return nil, fmt.Errorf("the remote %q uses a backend plugin, and its paths cannot be listed", r.Name)
+	}
+	paths, err := r.Storage().TrackedPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the paths in the remote %q: %w", r.Name, err)
+	}
+	if len(namespace) == 0 {
+		return paths, nil
+	}
+	prefix := string(NamespacedPath(namespace, "")) + string(filepath.Separator)
+	var result []snapshot.Path
+	for _, p := range paths {
+		if strings.HasPrefix(string(p), prefix) {
+			result = append(result, snapshot.Path(string(filepath.Separator)+strings.TrimPrefix(string(p), prefix)))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestPushWithNamespaces(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	r := &Remote{Name: "shared", ArchiveDir: filepath.Join(dir, "remote")}
+
+	// Push the same path from two machines into the same remote.
+	pushed := make(map[string]*snapshot.Hash)
+	for _, namespace := range []string{"machine/laptop", "machine/desktop"} {
+		if err := os.WriteFile(file, []byte("notes from "+namespace), 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, namespace)}
+		if err := WriteNamespace(ctx, s, namespace); err != nil {
+			t.Fatalf("failure configuring the namespace %q: %v", namespace, err)
+		}
+		if got, err := ReadNamespace(s); err != nil {
+			t.Fatalf("failure reading the configured namespace: %v", err)
+		} else if got != namespace {
+			t.Errorf("unexpected namespace: got %q, want %q", got, namespace)
+		}
+		if _, _, err := snapshot.Current(ctx, s, snapshot.Path(file)); err != nil {
+			t.Fatalf("failure snapshotting the example file: %v", err)
+		}
+		h, _, err := Push(ctx, s, r, snapshot.Path(file))
+		if err != nil {
+			t.Fatalf("failure pushing from %q: %v", namespace, err)
+		}
+		pushed[namespace] = h
+	}
+	if pushed["machine/laptop"].Equal(pushed["machine/desktop"]) {
+		t.Fatal("unexpectedly pushed identical snapshots")
+	}
+
+	for namespace, want := range pushed {
+		h, _, err := FindSnapshot(ctx, []*Remote{r}, NamespacedPath(namespace, snapshot.Path(file)))
+		if err != nil {
+			t.Errorf("failure finding the snapshot pushed from %q: %v", namespace, err)
+		} else if !h.Equal(want) {
+			t.Errorf("unexpected snapshot for %q: got %q, want %q", namespace, h, want)
+		}
+		paths, err := ListPaths(ctx, r, namespace)
+		if err != nil {
+			t.Fatalf("failure listing the paths in %q: %v", namespace, err)
+		}
+		if len(paths) != 1 || paths[0] != snapshot.Path(file) {
+			t.Errorf("unexpected paths in %q: got %q, want [%q]", namespace, paths, file)
+		}
+	}
+	if _, _, err := FindSnapshot(ctx, []*Remote{r}, snapshot.Path(file)); err == nil {
+		t.Error("unexpectedly found a snapshot outside of any namespace")
+	}
+	if paths, err := ListPaths(ctx, r, "machine"); err != nil {
+		t.Errorf("failure listing the paths in the parent namespace: %v", err)
+	} else if len(paths) != 2 {
+		t.Errorf("unexpected paths in the parent namespace: %q", paths)
+	}
+
+	for _, namespace := range []string{"/machine", "machine//laptop", "machine/..", "machine/"} {
+		if err := ValidateNamespace(namespace); err == nil {
+			t.Errorf("unexpectedly accepted the invalid namespace %q", namespace)
+		}
+	}
+}
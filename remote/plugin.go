@@ -0,0 +1,808 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Backend plugins are separate executables, so they can be written in
+// any language. The plugin for a remote whose archive location is
+// `<NAME>::<ADDRESS>` is the executable `rvcs-backend-<NAME>` found in
+// the PATH. It is invoked with `<ADDRESS>` as its only argument, and
+// communicates with rvcs over its standard input and output.
+//
+// When it starts, the plugin writes the line "rvcs-backend 1", naming
+// the protocol version it speaks. rvcs then writes requests, one at a
+// time, to the plugin's standard input, and the plugin writes exactly
+// one response to each request. Once rvcs is done, it closes the
+// plugin's standard input and the plugin should exit.
+//
+// Each request and response is a single line of space separated
+// fields. Paths are base64 encoded (without padding), and hashes are
+// in the form they are printed by rvcs. The requests are:
+//
+//	has <HASH>                   -> "ok" or "missing"
+//	read <HASH>                  -> "ok" followed by the contents, or "missing"
+//	write <HASH>                 (followed by the contents) -> "ok"
+//	find-snapshot <PATH>         -> "ok <HASH>" or "missing"
+//	store-snapshot <PATH> <HASH> -> "ok"
+//	find-track <ID>              -> "ok <HASH>" or "missing"
+//	store-track <ID> <HASH>      -> "ok"
+//	compression <ALGORITHM>+     -> "ok <ALGORITHM>" or "ok"
+//	has-batch <HASH>+            -> "ok <HASH>*"
+//	write-batch <COUNT>          (followed by <COUNT> objects) -> "ok"
+//	thaw <HASH>                  -> "ok ready", "ok pending", or "missing"
+//	generation                   -> "ok <TOKEN>" or "ok"
+//
+// Any request may instead fail with the response "error <MESSAGE>".
+//
+// The "compression" request negotiates compressing the object contents
+// sent in both directions for the rest of the connection. rvcs lists
+// the algorithms it supports in order of preference, and the plugin
+// responds with the one it will use, or with a bare "ok" to leave the
+// contents uncompressed. The only algorithm currently defined is
+// "deflate" (RFC 1951). Plugins that fail the request are treated as
+// not supporting compression.
+//
+// The batch requests let many small objects be pushed without a round
+// trip for each of them. The response to "has-batch" lists the hashes
+// that the plugin does not have. Each object in a "write-batch" request
+// is a line holding its hash, followed by its contents. A plugin must
+// read every object in the batch before responding, and fails the
+// request if any of them could not be stored. Plugins that fail a
+// "has-batch" request are treated as not supporting batches, and are
+// not sent "write-batch" requests.
+//
+// The "thaw" request is for plugins that keep objects in cold storage,
+// from which they must be retrieved before they can be read. It asks
+// the plugin to start retrieving the object if that is needed, and the
+// response reports whether or not the object can already be read.
+// Plugins that fail the request are treated as being able to read
+// every object that they have.
+//
+// The "generation" request reports a token that the plugin changes
+// whenever it removes objects, such as by garbage collection, or a bare
+// "ok" if it has never removed any. rvcs remembers the token seen by
+// each push, and no longer assumes that the remote still has the
+// objects it pushed before once the token changes. Plugins that fail
+// the request are treated as never removing objects.
+//
+// Object contents are sent as a sequence of chunks, each of which is a
+// line holding the decimal length of the chunk followed by that many
+// bytes. The contents end with a chunk of length zero. A plugin must
+// read all of the contents of a "write" request before responding, and
+// must reject contents that do not match the hash.
+
+const (
+	pluginPrefix   = "rvcs-backend-"
+	pluginProtocol = "rvcs-backend 1"
+
+	pluginChunkSize = 64 * 1024
+
+	// compressionDeflate is the name of the DEFLATE compression algorithm in the plugin protocol.
+	compressionDeflate = "deflate"
+)
+
+// pluginBackend is a backend implemented by an external plugin process.
+type pluginBackend struct {
+	name string
+	cmd  *exec.Cmd
+
+	// mu serializes requests to the plugin, and is held while the
+	// contents of an object are being read.
+	mu     sync.Mutex
+	stdin  io.WriteCloser
+	w      *bufio.Writer
+	stdout *bufio.Reader
+
+	// broken is set once the plugin has failed to follow the protocol,
+	// after which no further requests are sent.
+	broken error
+
+	// compression is the algorithm negotiated for compressing object
+	// contents, or empty if they are not compressed.
+	compression string
+
+	// noBatch is set once the plugin has failed a batch request.
+	noBatch bool
+}
+
+func startPlugin(ctx context.Context, name, address string, compress bool) (*pluginBackend, error) {
+	cmd := exec.CommandContext(ctx, pluginPrefix+name, address)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	b := &pluginBackend{
+		name:   name,
+		cmd:    cmd,
+		stdin:  stdin,
+		w:      bufio.NewWriter(stdin),
+		stdout: bufio.NewReader(stdout),
+	}
+	if line, err := readLine(b.stdout); err != nil || line != pluginProtocol {
+		b.Close()
+		return nil, fmt.Errorf("the plugin %q does not speak the protocol %q", pluginPrefix+name, pluginProtocol)
+	}
+	if compress {
+		b.mu.Lock()
+		algorithm, err := b.request(nil, "compression", compressionDeflate)
+		b.mu.Unlock()
+		if b.broken != nil {
+			b.Close()
+			return nil, b.broken
+		}
+		if err == nil && algorithm == compressionDeflate {
+			b.compression = algorithm
+		}
+	}
+	return b, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// chunkReader reads object contents sent as a sequence of chunks.
+type chunkReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := readLine(c.r)
+		if err != nil {
+			return 0, err
+		}
+		size, err := strconv.ParseInt(line, 10, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("malformed chunk length %q", line)
+		}
+		c.remaining = size
+		c.done = size == 0
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// writeChunks copies the contents of `reader` to `w` as a sequence of chunks.
+//
+// The terminating chunk is written even if reading the contents
+// fails, so that the other side can detect the truncated contents.
+func writeChunks(w io.Writer, reader io.Reader) error {
+	chunk := make([]byte, pluginChunkSize)
+	var readErr error
+	for readErr == nil {
+		var n int
+		n, readErr = reader.Read(chunk)
+		if n > 0 {
+			if _, err := fmt.Fprintf(w, "%d\n", n); err != nil {
+				return err
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "0\n"); err != nil {
+		return err
+	}
+	if readErr != io.EOF {
+		return readErr
+	}
+	return nil
+}
+
+// chunkWriter writes each call to `Write` as a single chunk.
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.w, "%d\n", len(p)); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// writeCompressedChunks compresses the contents of `reader` with the
+// given algorithm, and copies them to `w` as a sequence of chunks.
+//
+// As with `writeChunks`, the terminating chunk is always written.
+func writeCompressedChunks(w io.Writer, reader io.Reader, algorithm string) error {
+	if len(algorithm) == 0 {
+		return writeChunks(w, reader)
+	}
+	if algorithm != compressionDeflate {
+		return fmt.Errorf("unsupported compression algorithm %q", algorithm)
+	}
+	buffered := bufio.NewWriterSize(&chunkWriter{w: w}, pluginChunkSize)
+	compressor, err := flate.NewWriter(buffered, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(compressor, reader)
+	if err := compressor.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if err := buffered.Flush(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if _, err := io.WriteString(w, "0\n"); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// decompressChunks returns a reader for the contents sent as compressed chunks.
+func decompressChunks(chunks io.Reader, algorithm string) (io.Reader, error) {
+	switch algorithm {
+	case "":
+		return chunks, nil
+	case compressionDeflate:
+		return flate.NewReader(chunks), nil
+	}
+	return nil, fmt.Errorf("unsupported compression algorithm %q", algorithm)
+}
+
+// request sends a request to the plugin and reads the value in its response.
+//
+// The caller must hold `b.mu`. If `contents` is not nil, it is sent
+// to the plugin after the request line.
+func (b *pluginBackend) request(contents io.Reader, fields ...string) (string, error) {
+	var send func() error
+	if contents != nil {
+		send = func() error {
+			return writeCompressedChunks(b.w, contents, b.compression)
+		}
+	}
+	return b.requestWith(send, fields...)
+}
+
+// requestWith is like `request`, except that the contents sent after
+// the request line, if any, are written by the `send` function.
+//
+// The response is read even if `send` fails, in which case its error is returned.
+func (b *pluginBackend) requestWith(send func() error, fields ...string) (string, error) {
+	if b.broken != nil {
+		return "", b.broken
+	}
+	if _, err := io.WriteString(b.w, strings.Join(fields, " ")+"\n"); err != nil {
+		b.broken = fmt.Errorf("failure sending a request to the plugin %q: %w", b.name, err)
+		return "", b.broken
+	}
+	var contentsErr error
+	if send != nil {
+		contentsErr = send()
+	}
+	if err := b.w.Flush(); err != nil {
+		b.broken = fmt.Errorf("failure sending a request to the plugin %q: %w", b.name, err)
+		return "", b.broken
+	}
+	line, err := readLine(b.stdout)
+	if err != nil {
+		b.broken = fmt.Errorf("failure reading a response from the plugin %q: %w", b.name, err)
+		return "", b.broken
+	}
+	if contentsErr != nil {
+		return "", contentsErr
+	}
+	status, value, _ := strings.Cut(line, " ")
+	switch status {
+	case "ok":
+		return value, nil
+	case "missing":
+		return "", os.ErrNotExist
+	case "error":
+		return "", fmt.Errorf("%s: %s", b.name, value)
+	}
+	b.broken = fmt.Errorf("malformed response %q from the plugin %q", line, b.name)
+	return "", b.broken
+}
+
+func (b *pluginBackend) requestHash(fields ...string) (*snapshot.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, err := b.request(nil, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.ParseHash(value)
+}
+
+func (b *pluginBackend) HasObject(ctx context.Context, h *snapshot.Hash) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.request(nil, "has", h.String())
+	return err == nil
+}
+
+// pluginObjectReader reads the contents of an object from a plugin.
+type pluginObjectReader struct {
+	chunks   chunkReader
+	contents io.Reader
+	b        *pluginBackend
+	closed   bool
+}
+
+func (r *pluginObjectReader) Read(p []byte) (int, error) {
+	return r.contents.Read(p)
+}
+
+func (r *pluginObjectReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	defer r.b.mu.Unlock()
+	if _, err := io.Copy(io.Discard, &r.chunks); err != nil {
+		r.b.broken = fmt.Errorf("failure reading an object from the plugin %q: %w", r.b.name, err)
+		return r.b.broken
+	}
+	return nil
+}
+
+func (b *pluginBackend) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
+	b.mu.Lock()
+	if _, err := b.request(nil, "read", h.String()); err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	r := &pluginObjectReader{
+		chunks: chunkReader{r: b.stdout},
+		b:      b,
+	}
+	contents, err := decompressChunks(&r.chunks, b.compression)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.contents = contents
+	return r, nil
+}
+
+func (b *pluginBackend) ThawObject(ctx context.Context, h *snapshot.Hash) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, err := b.request(nil, "thaw", h.String())
+	if os.IsNotExist(err) || b.broken != nil {
+		return false, err
+	} else if err != nil {
+		// The plugin does not support thawing, so its objects can be read directly.
+		if _, hasErr := b.request(nil, "has", h.String()); hasErr != nil {
+			return false, hasErr
+		}
+		return true, nil
+	}
+	switch value {
+	case "ready":
+		return true, nil
+	case "pending":
+		return false, nil
+	}
+	return false, fmt.Errorf("malformed response %q to a thaw request from the plugin %q", value, b.name)
+}
+
+func (b *pluginBackend) Generation(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, err := b.request(nil, "generation")
+	if b.broken != nil {
+		return "", b.broken
+	} else if err != nil {
+		// The plugin does not support generations, so it never removes objects.
+		return "", nil
+	} else if strings.ContainsAny(value, " \t") {
+		return "", fmt.Errorf("malformed response %q to a generation request from the plugin %q", value, b.name)
+	}
+	return value, nil
+}
+
+func (b *pluginBackend) WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.request(reader, "write", h.String())
+	return err
+}
+
+func (b *pluginBackend) missingObjects(ctx context.Context, hs []*snapshot.Hash) ([]*snapshot.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.noBatch {
+		return nil, errBatchUnsupported
+	}
+	fields := []string{"has-batch"}
+	for _, h := range hs {
+		fields = append(fields, h.String())
+	}
+	value, err := b.request(nil, fields...)
+	if err != nil {
+		if b.broken != nil {
+			return nil, err
+		}
+		b.noBatch = true
+		return nil, fmt.Errorf("%w: %v", errBatchUnsupported, err)
+	}
+	var missing []*snapshot.Hash
+	for _, field := range strings.Fields(value) {
+		h, err := snapshot.ParseHash(field)
+		if err != nil {
+			b.broken = fmt.Errorf("malformed hash %q in a response from the plugin %q: %w", field, b.name, err)
+			return nil, b.broken
+		}
+		missing = append(missing, h)
+	}
+	return missing, nil
+}
+
+func (b *pluginBackend) writeObjects(ctx context.Context, hs []*snapshot.Hash, open func(*snapshot.Hash) (io.ReadCloser, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.noBatch {
+		return errBatchUnsupported
+	}
+	send := func() error {
+		var firstErr error
+		for _, h := range hs {
+			if _, err := io.WriteString(b.w, h.String()+"\n"); err != nil {
+				return err
+			}
+			// Every object announced in the request must be sent, so
+			// an object that cannot be read is sent as empty
+			// contents that the plugin will reject.
+			var contents io.Reader = strings.NewReader("")
+			reader, err := open(h)
+			if err == nil {
+				contents = reader
+			} else if firstErr == nil {
+				firstErr = fmt.Errorf("failure opening the object %q: %w", h, err)
+			}
+			err = writeCompressedChunks(b.w, contents, b.compression)
+			if reader != nil {
+				reader.Close()
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failure reading the object %q: %w", h, err)
+			}
+		}
+		return firstErr
+	}
+	_, err := b.requestWith(send, "write-batch", strconv.Itoa(len(hs)))
+	return err
+}
+
+func encodePluginPath(p snapshot.Path) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(p))
+}
+
+func (b *pluginBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	return b.requestHash("find-snapshot", encodePluginPath(p))
+}
+
+func (b *pluginBackend) StoreSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.request(nil, "store-snapshot", encodePluginPath(p), h.String())
+	return err
+}
+
+func (b *pluginBackend) FindTrack(ctx context.Context, id string) (*snapshot.Hash, error) {
+	return b.requestHash("find-track", id)
+}
+
+func (b *pluginBackend) StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.request(nil, "store-track", id, h.String())
+	return err
+}
+
+func (b *pluginBackend) Close() error {
+	b.stdin.Close()
+	if err := b.cmd.Wait(); err != nil {
+		return fmt.Errorf("the plugin %q failed: %w", b.name, err)
+	}
+	return nil
+}
+
+// ServeBackend serves requests for the given backend using the plugin protocol.
+//
+// This allows backend plugins to be written in Go by implementing the
+// `Backend` interface. Requests are read from `r` and responses are
+// written to `w` until `r` is closed.
+func ServeBackend(ctx context.Context, b Backend, r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	session := &pluginSession{}
+	if _, err := io.WriteString(bw, pluginProtocol+"\n"); err != nil {
+		return err
+	}
+	for {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		line, err := br.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+		value, err := serveRequest(ctx, b, session, fields, br, bw)
+		switch {
+		case errors.Is(err, errProtocol):
+			return err
+		case errors.Is(err, os.ErrNotExist):
+			io.WriteString(bw, "missing\n")
+		case err != nil:
+			msg := strings.ReplaceAll(err.Error(), "\n", " ")
+			fmt.Fprintf(bw, "error %s\n", msg)
+		case len(value) > 0:
+			io.WriteString(bw, value+"\n")
+		}
+	}
+}
+
+// errProtocol is returned when the connection can no longer be used.
+var errProtocol = errors.New("protocol failure")
+
+// pluginSession holds the state negotiated over a single plugin connection.
+type pluginSession struct {
+	// compression is the algorithm used to compress object contents, or empty if they are not compressed.
+	compression string
+}
+
+// serveRequest handles a single plugin protocol request, and returns the response line.
+//
+// If the response includes object contents, then the entire response
+// is written to `w` directly and the returned value is empty.
+func serveRequest(ctx context.Context, b Backend, session *pluginSession, fields []string, r *bufio.Reader, w *bufio.Writer) (string, error) {
+	hashArg := func(i int) (*snapshot.Hash, error) {
+		if len(fields) <= i {
+			return nil, fmt.Errorf("missing argument to %q", fields[0])
+		}
+		return snapshot.ParseHash(fields[i])
+	}
+	pathArg := func(i int) (snapshot.Path, error) {
+		if len(fields) <= i {
+			return "", fmt.Errorf("missing argument to %q", fields[0])
+		}
+		decoded, err := base64.RawStdEncoding.DecodeString(fields[i])
+		if err != nil {
+			return "", fmt.Errorf("malformed path %q: %w", fields[i], err)
+		}
+		return snapshot.Path(decoded), nil
+	}
+	idArg := func(i int) (string, error) {
+		if len(fields) <= i {
+			return "", fmt.Errorf("missing argument to %q", fields[0])
+		}
+		return fields[i], nil
+	}
+	switch fields[0] {
+	case "has":
+		h, err := hashArg(1)
+		if err != nil {
+			return "", err
+		}
+		if !b.HasObject(ctx, h) {
+			return "", os.ErrNotExist
+		}
+		return "ok", nil
+	case "read":
+		h, err := hashArg(1)
+		if err != nil {
+			return "", err
+		}
+		reader, err := b.ReadObject(ctx, h)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		if _, err := io.WriteString(w, "ok\n"); err != nil {
+			return "", fmt.Errorf("%w: %v", errProtocol, err)
+		}
+		if err := writeCompressedChunks(w, reader, session.compression); err != nil {
+			// The contents were already truncated, so the
+			// client will fail to verify the object.
+			return "", fmt.Errorf("%w: %v", errProtocol, err)
+		}
+		return "", nil
+	case "write":
+		h, err := hashArg(1)
+		if err != nil {
+			return "", err
+		}
+		chunks := &chunkReader{r: r}
+		contents, err := decompressChunks(chunks, session.compression)
+		if err == nil {
+			err = b.WriteObject(ctx, h, contents)
+		}
+		if _, drainErr := io.Copy(io.Discard, chunks); drainErr != nil {
+			return "", fmt.Errorf("%w: %v", errProtocol, drainErr)
+		}
+		if err != nil {
+			return "", err
+		}
+		return "ok", nil
+	case "find-snapshot":
+		p, err := pathArg(1)
+		if err != nil {
+			return "", err
+		}
+		h, err := b.FindSnapshot(ctx, p)
+		if err != nil {
+			return "", err
+		}
+		return "ok " + h.String(), nil
+	case "store-snapshot":
+		p, err := pathArg(1)
+		if err != nil {
+			return "", err
+		}
+		h, err := hashArg(2)
+		if err != nil {
+			return "", err
+		}
+		if err := b.StoreSnapshot(ctx, p, h); err != nil {
+			return "", err
+		}
+		return "ok", nil
+	case "find-track":
+		id, err := idArg(1)
+		if err != nil {
+			return "", err
+		}
+		h, err := b.FindTrack(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return "ok " + h.String(), nil
+	case "store-track":
+		id, err := idArg(1)
+		if err != nil {
+			return "", err
+		}
+		h, err := hashArg(2)
+		if err != nil {
+			return "", err
+		}
+		if err := b.StoreTrack(ctx, id, h); err != nil {
+			return "", err
+		}
+		return "ok", nil
+	case "has-batch":
+		var missing []string
+		for i := 1; i < len(fields); i++ {
+			h, err := hashArg(i)
+			if err != nil {
+				return "", err
+			}
+			if !b.HasObject(ctx, h) {
+				missing = append(missing, h.String())
+			}
+		}
+		return strings.Join(append([]string{"ok"}, missing...), " "), nil
+	case "write-batch":
+		count, err := idArg(1)
+		if err != nil {
+			return "", err
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("%w: malformed batch size %q", errProtocol, count)
+		}
+		// Every object must be read, even after one fails to be stored.
+		var firstErr error
+		for i := 0; i < n; i++ {
+			line, err := readLine(r)
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", errProtocol, err)
+			}
+			chunks := &chunkReader{r: r}
+			h, err := snapshot.ParseHash(line)
+			if err == nil {
+				var contents io.Reader
+				if contents, err = decompressChunks(chunks, session.compression); err == nil {
+					err = b.WriteObject(ctx, h, contents)
+				}
+			}
+			if _, drainErr := io.Copy(io.Discard, chunks); drainErr != nil {
+				return "", fmt.Errorf("%w: %v", errProtocol, drainErr)
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failure storing the object %q: %w", line, err)
+			}
+		}
+		if firstErr != nil {
+			return "", firstErr
+		}
+		return "ok", nil
+	case "thaw":
+		h, err := hashArg(1)
+		if err != nil {
+			return "", err
+		}
+		ready, err := ThawObject(ctx, b, h)
+		if err != nil {
+			return "", err
+		} else if !ready {
+			return "ok pending", nil
+		}
+		return "ok ready", nil
+	case "generation":
+		token, err := Generation(ctx, b)
+		if err != nil {
+			return "", err
+		} else if len(token) == 0 {
+			return "ok", nil
+		}
+		return "ok " + token, nil
+	case "compression":
+		for _, algorithm := range fields[1:] {
+			if algorithm == compressionDeflate {
+				session.compression = algorithm
+				return "ok " + algorithm, nil
+			}
+		}
+		session.compression = ""
+		return "ok", nil
+	}
+	return "", fmt.Errorf("unknown request %q", fields[0])
+}
@@ -0,0 +1,335 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// testPluginEnv is set when the test binary is run as a backend plugin.
+const testPluginEnv = "RVCS_TEST_BACKEND_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) != "" {
+		s := &storage.LocalFiles{ArchiveDir: os.Args[len(os.Args)-1]}
+		if err := ServeBackend(context.Background(), NewLocalBackend(s), os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "failure serving the backend: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// installTestPlugin makes the test binary available as the backend plugin named "test".
+func installTestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failure locating the test binary: %v", err)
+	}
+	bin := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\n%s=1 exec %q \"$@\"\n", testPluginEnv, exe)
+	if err := os.WriteFile(filepath.Join(bin, pluginPrefix+"test"), []byte(script), 0700); err != nil {
+		t.Fatalf("failure writing the test plugin: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPluginBackend(t *testing.T) {
+	installTestPlugin(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	large := make([]byte, 3*pluginChunkSize+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	if err := os.WriteFile(filepath.Join(src, "large.bin"), large, 0700); err != nil {
+		t.Fatalf("failure creating the large example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "small.txt"), []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the small example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+
+	r := &Remote{Name: "plugin", ArchiveDir: "test::" + filepath.Join(dir, "remote")}
+	if name, address, ok := r.Plugin(); !ok || name != "test" || address != filepath.Join(dir, "remote") {
+		t.Fatalf("unexpected plugin for %q: %q, %q, %v", r.ArchiveDir, name, address, ok)
+	}
+	pushed, stats, err := Push(ctx, s, r, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure pushing the snapshot: %v", err)
+	} else if !pushed.Equal(h) {
+		t.Errorf("unexpected pushed snapshot: got %q, want %q", pushed, h)
+	}
+	if got, want := stats.Pushed, 6; got != want {
+		t.Errorf("unexpected number of pushed objects: got %d, want %d", got, want)
+	}
+	// The remote already has the snapshot, so none of its objects need to be checked again.
+	if _, stats, err := Push(ctx, s, r, snapshot.Path(src)); err != nil {
+		t.Fatalf("failure repeating the push: %v", err)
+	} else if stats.Pushed != 0 || stats.Present != 0 {
+		t.Errorf("unexpected stats for a repeated push: %+v", stats)
+	}
+
+	remotes := []*Remote{r}
+	found, _, err := FindSnapshot(ctx, remotes, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure finding the remote snapshot: %v", err)
+	} else if !found.Equal(h) {
+		t.Errorf("unexpected remote snapshot: got %q, want %q", found, h)
+	}
+	if _, _, err := FindSnapshot(ctx, remotes, snapshot.Path(filepath.Join(dir, "missing"))); err == nil {
+		t.Error("unexpectedly found a remote snapshot of a missing path")
+	}
+
+	b, err := r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure opening the plugin backend: %v", err)
+	}
+	if err := b.StoreTrack(ctx, "example", h); err != nil {
+		t.Errorf("failure storing a track in the plugin backend: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("failure closing the plugin backend: %v", err)
+	}
+	if got, _, err := FindTrack(ctx, remotes, "example"); err != nil {
+		t.Errorf("failure finding the remote track: %v", err)
+	} else if !got.Equal(h) {
+		t.Errorf("unexpected remote track: got %q, want %q", got, h)
+	}
+
+	other := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "other")}
+	pullStats, err := Pull(ctx, other, remotes, h)
+	if err != nil {
+		t.Fatalf("failure pulling the snapshot: %v", err)
+	}
+	if got, want := pullStats.Fetched["plugin"], 6; got != want {
+		t.Errorf("unexpected number of fetched objects: got %d, want %d", got, want)
+	}
+	f, err := other.ReadSnapshot(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading the pulled snapshot: %v", err)
+	}
+	tree, err := other.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		t.Fatalf("failure listing the pulled snapshot: %v", err)
+	}
+	largeFile, err := other.ReadSnapshot(ctx, tree["large.bin"])
+	if err != nil {
+		t.Fatalf("failure reading the pulled snapshot of the large file: %v", err)
+	}
+	reader, err := other.ReadObject(ctx, largeFile.Contents)
+	if err != nil {
+		t.Fatalf("failure opening the pulled contents: %v", err)
+	}
+	defer reader.Close()
+	if got, err := io.ReadAll(reader); err != nil {
+		t.Errorf("failure reading the pulled contents: %v", err)
+	} else if string(got) != string(large) {
+		t.Error("pulled contents do not match the original")
+	}
+}
+
+func TestPluginCompression(t *testing.T) {
+	installTestPlugin(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	contents := bytes.Repeat([]byte("compressible contents\n"), pluginChunkSize/8)
+	h, err := snapshot.NewHash(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	for _, noCompress := range []bool{false, true} {
+		r := &Remote{
+			Name:       "plugin",
+			ArchiveDir: "test::" + filepath.Join(dir, fmt.Sprintf("remote-%v", noCompress)),
+			NoCompress: noCompress,
+		}
+		b, err := r.Backend(ctx)
+		if err != nil {
+			t.Fatalf("failure opening the plugin backend: %v", err)
+		}
+		want := compressionDeflate
+		if noCompress {
+			want = ""
+		}
+		if got := b.(*pluginBackend).compression; got != want {
+			t.Errorf("unexpected negotiated compression with NoCompress=%v: got %q, want %q", noCompress, got, want)
+		}
+		if err := b.WriteObject(ctx, h, bytes.NewReader(contents)); err != nil {
+			t.Fatalf("failure writing an object with NoCompress=%v: %v", noCompress, err)
+		}
+		reader, err := b.ReadObject(ctx, h)
+		if err != nil {
+			t.Fatalf("failure opening the object with NoCompress=%v: %v", noCompress, err)
+		}
+		if got, err := io.ReadAll(reader); err != nil {
+			t.Errorf("failure reading the object with NoCompress=%v: %v", noCompress, err)
+		} else if !bytes.Equal(got, contents) {
+			t.Errorf("object contents read with NoCompress=%v do not match the original", noCompress)
+		}
+		if err := reader.Close(); err != nil {
+			t.Errorf("failure closing the object reader: %v", err)
+		}
+		if !b.HasObject(ctx, h) {
+			t.Errorf("object missing after being written with NoCompress=%v", noCompress)
+		}
+		if err := b.Close(); err != nil {
+			t.Errorf("failure closing the plugin backend: %v", err)
+		}
+	}
+}
+
+func TestMissingPlugin(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	r := &Remote{Name: "missing", ArchiveDir: "missing::somewhere"}
+	if _, err := r.Backend(context.Background()); err == nil {
+		t.Error("unexpectedly opened a backend for a missing plugin")
+	}
+}
+
+func TestPluginThaw(t *testing.T) {
+	installTestPlugin(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	rs := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "remote")}
+	h, err := rs.StoreObject(ctx, strings.NewReader("offloaded"))
+	if err != nil {
+		t.Fatalf("failure storing the example object: %v", err)
+	}
+	r := &Remote{Name: "plugin", ArchiveDir: "test::" + rs.ArchiveDir}
+	b, err := r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure starting the plugin: %v", err)
+	}
+	defer b.Close()
+	if ready, err := ThawObject(ctx, b, h); err != nil || !ready {
+		t.Errorf("unexpected result thawing a stored object: %v, %v", ready, err)
+	}
+	missing, err := snapshot.NewHash(strings.NewReader("missing"))
+	if err != nil {
+		t.Fatalf("failure hashing the missing object: %v", err)
+	}
+	if _, err := ThawObject(ctx, b, missing); !os.IsNotExist(err) {
+		t.Errorf("unexpected result thawing a missing object: %v", err)
+	}
+}
+
+func TestPluginBatches(t *testing.T) {
+	installTestPlugin(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprintf("small-%d.txt", i)), []byte(fmt.Sprintf("File %d", i)), 0700); err != nil {
+			t.Fatalf("failure creating a small example file: %v", err)
+		}
+	}
+	large := make([]byte, 2*pluginChunkSize)
+	rand.New(rand.NewSource(1)).Read(large)
+	if err := os.WriteFile(filepath.Join(src, "large.bin"), large, 0700); err != nil {
+		t.Fatalf("failure creating the large example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	objects, err := reachable(ctx, s, h)
+	if err != nil {
+		t.Fatalf("failure listing the objects to push: %v", err)
+	}
+
+	rs := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "remote")}
+	r := &Remote{
+		Name:       "plugin",
+		ArchiveDir: "test::" + rs.ArchiveDir,
+		Batch:      BatchOptions{MaxObjects: 4, MaxObjectSize: 1024},
+	}
+	// Push part of the history first, so that some of the batched objects are already present.
+	b, err := r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure opening the plugin backend: %v", err)
+	}
+	if err := pushObjects(ctx, s, b, objects[:3], r.Batch, &PushStats{}); err != nil {
+		t.Fatalf("failure pushing the first objects: %v", err)
+	}
+	if b.(*pluginBackend).noBatch {
+		t.Error("the test plugin was treated as not supporting batches")
+	}
+	b.Close()
+
+	_, stats, err := Push(ctx, s, r, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure pushing the snapshot: %v", err)
+	}
+	if got, want := stats.Pushed, len(objects)-3; got != want {
+		t.Errorf("unexpected number of pushed objects: got %d, want %d", got, want)
+	}
+	if got, want := stats.Present, 3; got != want {
+		t.Errorf("unexpected number of objects already present: got %d, want %d", got, want)
+	}
+	for _, obj := range objects {
+		if !rs.HasObject(ctx, obj) {
+			t.Errorf("the object %q was not pushed", obj)
+		}
+	}
+
+	// Plugins without batch support fall back to one request per object.
+	fallback := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "fallback")}
+	r.ArchiveDir = "test::" + fallback.ArchiveDir
+	b, err = r.Backend(ctx)
+	if err != nil {
+		t.Fatalf("failure opening the plugin backend: %v", err)
+	}
+	defer b.Close()
+	b.(*pluginBackend).noBatch = true
+	stats = &PushStats{}
+	if err := pushObjects(ctx, s, b, objects, r.Batch, stats); err != nil {
+		t.Fatalf("failure pushing without batches: %v", err)
+	}
+	if got, want := stats.Pushed, len(objects); got != want {
+		t.Errorf("unexpected number of objects pushed without batches: got %d, want %d", got, want)
+	}
+	for _, obj := range objects {
+		if !fallback.HasObject(ctx, obj) {
+			t.Errorf("the object %q was not pushed without batches", obj)
+		}
+	}
+}
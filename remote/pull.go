@@ -0,0 +1,244 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// PullStats summarizes the objects copied by a pull.
+type PullStats struct {
+	// Fetched is the number of objects copied from each remote, keyed by the remote name.
+	Fetched map[string]int
+
+	// Received is the number of object bytes copied from each remote, keyed by the remote name.
+	Received map[string]int64
+
+	// Present is the number of objects that were already available locally.
+	Present int
+
+	// Mismatched is the number of objects received from each remote
+	// whose contents did not match their hash, keyed by the remote name.
+	//
+	// These objects are quarantined and then fetched from the next remote.
+	Mismatched map[string]int
+}
+
+type puller struct {
+	s       *storage.LocalFiles
+	remotes []*Remote
+	stats   *PullStats
+
+	// backends holds the backend opened for each remote, keyed by the remote name.
+	backends map[string]Backend
+
+	// backendErrs holds the failure to open the backend for each remote, keyed by the remote name.
+	backendErrs map[string]error
+}
+
+// backend returns the backend for the given remote, opening it if necessary.
+func (p *puller) backend(ctx context.Context, r *Remote) (Backend, error) {
+	if b, ok := p.backends[r.Name]; ok {
+		return b, nil
+	}
+	if err, ok := p.backendErrs[r.Name]; ok {
+		return nil, err
+	}
+	b, err := r.Backend(ctx)
+	if err != nil {
+		p.backendErrs[r.Name] = err
+		return nil, err
+	}
+	p.backends[r.Name] = b
+	return b, nil
+}
+
+func (p *puller) close() {
+	for _, b := range p.backends {
+		b.Close()
+	}
+}
+
+// fetch copies the given object from the first remote that is able to provide it.
+func (p *puller) fetch(ctx context.Context, h *snapshot.Hash) error {
+	if p.s.HasObject(ctx, h) {
+		p.stats.Present++
+		return nil
+	}
+	var failures []string
+	for _, r := range p.remotes {
+		n, err := p.fetchFrom(ctx, r, h)
+		if err != nil {
+			var mismatch *storage.HashMismatchError
+			if errors.As(err, &mismatch) {
+				p.stats.Mismatched[r.Name]++
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", r.Name, err))
+			continue
+		}
+		p.stats.Fetched[r.Name]++
+		p.stats.Received[r.Name] += n
+		return nil
+	}
+	if len(failures) == 0 {
+		return errors.New("no remotes are configured")
+	}
+	return fmt.Errorf("failure fetching the object %q from any remote: %s", h, strings.Join(failures, "; "))
+}
+
+// fetchFrom copies the given object from the remote `r`, and returns the number of bytes received.
+func (p *puller) fetchFrom(ctx context.Context, r *Remote, h *snapshot.Hash) (int64, error) {
+	b, err := p.backend(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := b.ReadObject(ctx, h)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	counter := &countingReader{Reader: reader}
+	if err := p.s.StoreVerifiedObject(ctx, counter, h); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// recordTransfers adds the statistics of a successful pull to the
+// transfer statistics of every remote that was used.
+func (p *puller) recordTransfers(ctx context.Context) error {
+	now := time.Now()
+	for _, r := range p.remotes {
+		if _, ok := p.backends[r.Name]; !ok {
+			continue
+		}
+		if err := RecordTransfer(ctx, p.s, r.Name, &TransferStats{
+			BytesReceived:   p.stats.Received[r.Name],
+			ObjectsReceived: int64(p.stats.Fetched[r.Name]),
+			LastPull:        now,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchObject copies the single object `h` from the first of the given
+// remotes that is able to provide it, and returns that remote.
+//
+// Unlike `Pull`, this replaces any copy of the object already in `s`, so
+// that it can be used to repair objects that are corrupt locally. The
+// hash of the fetched object is verified before it is stored.
+func FetchObject(ctx context.Context, s *storage.LocalFiles, remotes []*Remote, h *snapshot.Hash) (*Remote, error) {
+	p := &puller{
+		s:       s,
+		remotes: remotes,
+		stats: &PullStats{
+			Fetched:    make(map[string]int),
+			Received:   make(map[string]int64),
+			Mismatched: make(map[string]int),
+		},
+		backends:    make(map[string]Backend),
+		backendErrs: make(map[string]error),
+	}
+	defer p.close()
+	var failures []string
+	for _, r := range remotes {
+		n, err := p.fetchFrom(ctx, r, h)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.Name, err))
+			continue
+		}
+		p.stats.Fetched[r.Name]++
+		p.stats.Received[r.Name] += n
+		if err := p.recordTransfers(ctx); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	if len(failures) == 0 {
+		return nil, errors.New("no remotes are configured")
+	}
+	return nil, fmt.Errorf("failure fetching the object %q from any remote: %s", h, strings.Join(failures, "; "))
+}
+
+// Pull copies the snapshot `h`, along with its entire history, from the given remotes.
+//
+// Each object is fetched from the first remote (in the given order)
+// that is able to provide it, so remotes that are unreachable or
+// missing objects are transparently skipped.
+//
+// The hash of every fetched object is verified before it is stored.
+// Objects with mismatched hashes are quarantined, and the next remote
+// is tried instead.
+//
+// The statistics of successful pulls are added to the transfer
+// statistics recorded in `s` for each remote that was used.
+func Pull(ctx context.Context, s *storage.LocalFiles, remotes []*Remote, h *snapshot.Hash) (*PullStats, error) {
+	p := &puller{
+		s:       s,
+		remotes: remotes,
+		stats: &PullStats{
+			Fetched:    make(map[string]int),
+			Received:   make(map[string]int64),
+			Mismatched: make(map[string]int),
+		},
+		backends:    make(map[string]Backend),
+		backendErrs: make(map[string]error),
+	}
+	defer p.close()
+	visited := make(map[snapshot.Hash]struct{})
+	queue := []*snapshot.Hash{h}
+	for len(queue) > 0 {
+		h, queue = queue[0], queue[1:]
+		if _, ok := visited[*h]; ok {
+			continue
+		}
+		visited[*h] = struct{}{}
+		if err := p.fetch(ctx, h); err != nil {
+			return nil, err
+		}
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the pulled snapshot %q: %w", h, err)
+		}
+		if f.Contents != nil {
+			if err := p.fetch(ctx, f.Contents); err != nil {
+				return nil, err
+			}
+		}
+		if f.IsDir() {
+			tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+			if err != nil {
+				return nil, fmt.Errorf("failure listing the contents of the pulled snapshot %q: %w", h, err)
+			}
+			for _, child := range tree {
+				queue = append(queue, child)
+			}
+		}
+		queue = append(queue, f.Parents...)
+	}
+	if err := p.recordTransfers(ctx); err != nil {
+		return nil, err
+	}
+	return p.stats, nil
+}
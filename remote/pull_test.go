@@ -0,0 +1,124 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestPullFailover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "nested", "example.txt"), []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	primary := &Remote{Name: "primary", Priority: 0, ArchiveDir: filepath.Join(dir, "missing")}
+	secondary := &Remote{Name: "secondary", Priority: 1, ArchiveDir: filepath.Join(dir, "secondary")}
+	h, _, err := snapshot.Current(ctx, secondary.Storage(), snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	remotes := []*Remote{primary, secondary}
+	if err := WriteRemotes(ctx, s, remotes); err != nil {
+		t.Fatalf("failure writing the remotes config: %v", err)
+	}
+	if got, err := ReadRemotes(s); err != nil {
+		t.Fatalf("failure reading the remotes config: %v", err)
+	} else if len(got) != 2 || got[0].Name != "primary" || got[1].Name != "secondary" {
+		t.Errorf("unexpected remotes config: %+v", got)
+	}
+
+	found, r, err := FindSnapshot(ctx, remotes, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure finding the remote snapshot: %v", err)
+	} else if !found.Equal(h) || r != secondary {
+		t.Errorf("unexpected remote snapshot: got %q from %q, want %q from %q", found, r.Name, h, secondary.Name)
+	}
+	stats, err := Pull(ctx, s, remotes, h)
+	if err != nil {
+		t.Fatalf("failure pulling the snapshot: %v", err)
+	}
+	if got, want := stats.Fetched["secondary"], 6; got != want {
+		t.Errorf("unexpected number of objects fetched: got %d, want %d", got, want)
+	}
+	if _, err := s.ReadSnapshot(ctx, h); err != nil {
+		t.Errorf("failure reading the pulled snapshot: %v", err)
+	}
+	stats, err = Pull(ctx, s, remotes, h)
+	if err != nil {
+		t.Fatalf("failure pulling the snapshot a second time: %v", err)
+	} else if got, want := stats.Present, 6; got != want {
+		t.Errorf("unexpected number of objects already present: got %d, want %d", got, want)
+	}
+}
+
+func TestPullRejectsCorruptObjects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(file, []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	corrupt := &Remote{Name: "corrupt", Priority: 0, ArchiveDir: filepath.Join(dir, "corrupt")}
+	intact := &Remote{Name: "intact", Priority: 1, ArchiveDir: filepath.Join(dir, "intact")}
+	var h *snapshot.Hash
+	var f *snapshot.File
+	for _, r := range []*Remote{corrupt, intact} {
+		var err error
+		h, f, err = snapshot.Current(ctx, r.Storage(), snapshot.Path(file))
+		if err != nil {
+			t.Fatalf("failure snapshotting the example file: %v", err)
+		}
+	}
+	// Replace the contents object in the corrupt remote with different data.
+	contents := f.Contents
+	objects := filepath.Join(corrupt.ArchiveDir, "objects", contents.Function(), contents.HexContents()[0:2], contents.HexContents()[2:4], contents.HexContents()[4:])
+	if err := os.WriteFile(objects, []byte("Goodbye, World!"), 0700); err != nil {
+		t.Fatalf("failure corrupting the remote object: %v", err)
+	}
+
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	stats, err := Pull(ctx, s, []*Remote{corrupt, intact}, h)
+	if err != nil {
+		t.Fatalf("failure pulling the snapshot: %v", err)
+	}
+	if got, want := stats.Mismatched["corrupt"], 1; got != want {
+		t.Errorf("unexpected number of mismatched objects: got %d, want %d", got, want)
+	}
+	if got, want := stats.Fetched["intact"], 1; got != want {
+		t.Errorf("unexpected number of objects fetched from the intact remote: got %d, want %d", got, want)
+	}
+	if !s.HasObject(ctx, contents) {
+		t.Errorf("the contents object %q was not pulled", contents)
+	}
+	quarantined, err := os.ReadDir(filepath.Join(s.ArchiveDir, "quarantine"))
+	if err != nil {
+		t.Fatalf("failure listing the quarantined objects: %v", err)
+	} else if len(quarantined) != 1 {
+		t.Errorf("unexpected quarantined objects: %v", quarantined)
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// pushChunkSize is the size of the chunks used to copy large objects.
+//
+// Objects larger than this are copied one chunk at a time, so that
+// an interrupted push can resume from the last chunk received.
+const pushChunkSize = 4 * 1024 * 1024
+
+// maxGenerationRetries is the number of times that the objects of a
+// push are checked again after the remote removed objects during it.
+const maxGenerationRetries = 3
+
+// PushStats summarizes the objects copied by a push.
+type PushStats struct {
+	// Pushed is the number of objects copied to the remote.
+	Pushed int
+
+	// Present is the number of objects the remote already had.
+	Present int
+
+	// Resumed is the number of objects whose copy resumed from a previously interrupted push.
+	Resumed int
+
+	// Bytes is the number of object bytes sent to the remote.
+	Bytes int64
+}
+
+// reachable lists every object in the snapshot `h`, including its history.
+//
+// The objects are ordered so that each object comes after all of the
+// objects that it references.
+func reachable(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]*snapshot.Hash, error) {
+	return reachableSince(ctx, s, h, nil)
+}
+
+// reachableSince lists the objects in the snapshot `h`, including its
+// history, that are not also in the snapshot `since`.
+//
+// The two snapshots are walked side by side, matching up the children
+// of directories by name, and the walk stops at any object that is the
+// same as its counterpart in `since`. That way only the parts of `h`
+// that changed since `since` are read, rather than its entire history.
+// Objects that moved to a different location may still be listed.
+//
+// If `since` is nil, then every object in `h` is listed. The objects
+// are ordered the same way as with `reachable`.
+func reachableSince(ctx context.Context, s *storage.LocalFiles, h, since *snapshot.Hash) ([]*snapshot.Hash, error) {
+	visited := make(map[snapshot.Hash]struct{})
+	var ordered []*snapshot.Hash
+	var visit func(h, counterpart *snapshot.Hash) error
+	visit = func(h, counterpart *snapshot.Hash) error {
+		if h.Equal(counterpart) || h.Equal(since) {
+			return nil
+		}
+		if _, ok := visited[*h]; ok {
+			return nil
+		}
+		visited[*h] = struct{}{}
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			return fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+		}
+		var counterpartFile *snapshot.File
+		if counterpart != nil {
+			// Without the counterpart, the rest of this object is walked in full.
+			counterpartFile, _ = s.ReadSnapshot(ctx, counterpart)
+		}
+		for _, parent := range f.Parents {
+			if err := visit(parent, counterpart); err != nil {
+				return err
+			}
+		}
+		if f.IsDir() {
+			tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+			if err != nil {
+				return fmt.Errorf("failure listing the contents of %q: %w", h, err)
+			}
+			var counterpartTree snapshot.Tree
+			if counterpartFile != nil && counterpartFile.IsDir() {
+				counterpartTree, _ = s.ListDirectorySnapshotContents(ctx, counterpart, counterpartFile)
+			}
+			for name, child := range tree {
+				if err := visit(child, counterpartTree[name]); err != nil {
+					return err
+				}
+			}
+		}
+		if f.Contents != nil && (counterpartFile == nil || !f.Contents.Equal(counterpartFile.Contents)) {
+			if _, ok := visited[*f.Contents]; !ok {
+				visited[*f.Contents] = struct{}{}
+				ordered = append(ordered, f.Contents)
+			}
+		}
+		ordered = append(ordered, h)
+		return nil
+	}
+	if err := visit(h, since); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// copyChunked copies a large object to the remote in chunks, resuming any previously interrupted copy.
+func copyChunked(ctx context.Context, s, rs *storage.LocalFiles, h *snapshot.Hash, stats *PushStats) error {
+	offset, err := rs.PartialObjectSize(ctx, h)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		stats.Resumed++
+	}
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	defer reader.Close()
+	if offset > 0 {
+		seeker, ok := reader.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("unable to resume copying the object %q", h)
+		}
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failure seeking to the resume offset of %q: %w", h, err)
+		}
+	}
+	chunk := make([]byte, pushChunkSize)
+	for {
+		n, err := io.ReadFull(reader, chunk)
+		if n > 0 {
+			if err := rs.AppendPartialObject(ctx, h, chunk[:n]); err != nil {
+				return err
+			}
+			stats.Bytes += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failure reading the object %q: %w", h, err)
+		}
+	}
+	return rs.CommitPartialObject(ctx, h)
+}
+
+func copyObject(ctx context.Context, s *storage.LocalFiles, b Backend, h *snapshot.Hash, stats *PushStats) error {
+	if b.HasObject(ctx, h) {
+		stats.Present++
+		return nil
+	}
+	size, err := s.ObjectSize(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the size of the object %q: %w", h, err)
+	}
+	if size > pushChunkSize {
+		var copied bool
+		var err error
+		switch b := b.(type) {
+		case *localBackend:
+			copied, err = true, copyChunked(ctx, s, b.s, h, stats)
+		case *limitedBackend:
+			if local, ok := b.b.(*localBackend); ok {
+				copied, err = true, b.copyChunked(ctx, s, local.s, h, stats)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if copied {
+			stats.Pushed++
+			return nil
+		}
+	}
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure opening the object %q: %w", h, err)
+	}
+	defer reader.Close()
+	if err := b.WriteObject(ctx, h, reader); err != nil {
+		return fmt.Errorf("failure copying the object %q: %w", h, err)
+	}
+	stats.Pushed++
+	stats.Bytes += size
+	return nil
+}
+
+// Push copies the latest snapshot of the path `p`, along with its entire history, to the remote `r`.
+//
+// Only the objects added since the snapshot that the remote currently
+// records for `p` are considered, since a snapshot is only recorded on
+// a remote after everything it references has been copied there. If
+// that snapshot is not available locally, or if the generation of the
+// remote changed since `p` was last pushed to it, then the entire history is.
+// If the generation changes during the push, then every object is
+// checked again before the snapshot is recorded.
+//
+// Once all of the objects have been copied, the remote is updated to
+// record the pushed snapshot as the latest snapshot of `p`, within the
+// namespace configured for `s` if there is one. Copies of large objects
+// can only be resumed for remotes accessed via the file system, and
+// small objects are only batched together for backend plugins that
+// support it; see `Remote.Batch`.
+//
+// The statistics of successful pushes are added to the transfer
+// statistics recorded for the remote in `s`.
+func Push(ctx context.Context, s *storage.LocalFiles, r *Remote, p snapshot.Path) (*snapshot.Hash, *PushStats, error) {
+	h, _, err := s.FindSnapshot(ctx, p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	stats, err := PushSnapshot(ctx, s, r, p, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, stats, nil
+}
+
+// PushSnapshot copies the snapshot `h`, along with its entire history, to the remote `r` as the latest snapshot of `p`.
+//
+// This is the same as `Push`, except that `h` need not be the latest
+// snapshot of `p` in `s`, such as when it is a redacted copy.
+func PushSnapshot(ctx context.Context, s *storage.LocalFiles, r *Remote, p snapshot.Path, h *snapshot.Hash) (*PushStats, error) {
+	namespace, err := ReadNamespace(s)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.Backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	remotePath := NamespacedPath(namespace, p)
+	remoteHead, err := b.FindSnapshot(ctx, remotePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failure looking up the latest snapshot of %q in %q: %w", remotePath, r.Name, err)
+	}
+	if remoteHead != nil && !s.HasObject(ctx, remoteHead) {
+		// The remote has a snapshot that has not been pulled, so nothing is known about what it contains.
+		remoteHead = nil
+	}
+	generation, err := Generation(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the generation of %q: %w", r.Name, err)
+	}
+	known, err := knownGeneration(s, r.Name, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if generation != known {
+		// The remote removed objects since the last push of this path, so it may no longer have everything in its latest snapshot.
+		remoteHead = nil
+	}
+	stats := &PushStats{}
+	for attempt := 0; ; attempt++ {
+		objects, err := reachableSince(ctx, s, h, remoteHead)
+		if err != nil {
+			return nil, err
+		}
+		if err := pushObjects(ctx, s, b, objects, r.Batch, stats); err != nil {
+			return nil, fmt.Errorf("failure pushing to %q: %w", r.Name, err)
+		}
+		after, err := Generation(ctx, b)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the generation of %q: %w", r.Name, err)
+		} else if after == generation {
+			break
+		} else if attempt == maxGenerationRetries {
+			return nil, fmt.Errorf("failure pushing to %q: the remote kept removing objects during the push", r.Name)
+		}
+		// The remote removed objects during the push, possibly including the ones just pushed, so check them all again.
+		generation, remoteHead = after, nil
+	}
+	if err := b.StoreSnapshot(ctx, remotePath, h); err != nil {
+		return nil, fmt.Errorf("failure updating the latest snapshot of %q in %q: %w", remotePath, r.Name, err)
+	}
+	if err := recordGeneration(ctx, s, r.Name, remotePath, generation); err != nil {
+		return nil, err
+	}
+	if err := RecordTransfer(ctx, s, r.Name, &TransferStats{
+		BytesSent:   stats.Bytes,
+		ObjectsSent: int64(stats.Pushed),
+		DedupHits:   int64(stats.Present),
+		LastPush:    time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
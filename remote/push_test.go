@@ -0,0 +1,226 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestPushResumesLargeObjects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "large.bin")
+	contents := make([]byte, 2*pushChunkSize+1234)
+	rand.New(rand.NewSource(1)).Read(contents)
+	if err := os.WriteFile(file, contents, 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	h, f, err := snapshot.Current(ctx, s, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+
+	// Simulate a previous push that was interrupted after the first chunk.
+	r := &Remote{Name: "remote", ArchiveDir: filepath.Join(dir, "remote")}
+	rs := r.Storage()
+	if err := rs.AppendPartialObject(ctx, f.Contents, contents[:pushChunkSize]); err != nil {
+		t.Fatalf("failure simulating an interrupted push: %v", err)
+	}
+
+	pushed, stats, err := Push(ctx, s, r, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure pushing the snapshot: %v", err)
+	} else if !pushed.Equal(h) {
+		t.Errorf("unexpected pushed snapshot: got %q, want %q", pushed, h)
+	}
+	if got, want := stats.Resumed, 1; got != want {
+		t.Errorf("unexpected number of resumed objects: got %d, want %d", got, want)
+	}
+	if got, want := stats.Pushed, 2; got != want {
+		t.Errorf("unexpected number of pushed objects: got %d, want %d", got, want)
+	}
+	reader, err := rs.ReadObject(ctx, f.Contents)
+	if err != nil {
+		t.Fatalf("failure reading the pushed contents: %v", err)
+	}
+	defer reader.Close()
+	if got, err := io.ReadAll(reader); err != nil {
+		t.Errorf("failure reading the pushed contents: %v", err)
+	} else if string(got) != string(contents) {
+		t.Error("pushed contents do not match the original")
+	}
+	if remoteHead, _, err := rs.FindSnapshot(ctx, snapshot.Path(file)); err != nil {
+		t.Errorf("failure reading the remote snapshot: %v", err)
+	} else if !remoteHead.Equal(h) {
+		t.Errorf("unexpected remote snapshot: got %q, want %q", remoteHead, h)
+	}
+}
+
+func TestPushOnlyConsidersNewObjects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.MkdirAll(filepath.Join(src, name), 0700); err != nil {
+			t.Fatalf("failure creating the example directory %q: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(src, name, "file.txt"), []byte(name), 0600); err != nil {
+			t.Fatalf("failure creating the example file in %q: %v", name, err)
+		}
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(src)); err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	r := &Remote{Name: "remote", ArchiveDir: filepath.Join(dir, "remote")}
+	if _, _, err := Push(ctx, s, r, snapshot.Path(src)); err != nil {
+		t.Fatalf("failure pushing the first snapshot: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "b", "file.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatalf("failure modifying the example file: %v", err)
+	}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the modified directory: %v", err)
+	}
+	pushed, stats, err := Push(ctx, s, r, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure pushing the second snapshot: %v", err)
+	} else if !pushed.Equal(h) {
+		t.Errorf("unexpected pushed snapshot: got %q, want %q", pushed, h)
+	}
+	// Only the modified file, its directory, and the top level directory
+	// changed, each of which has a new snapshot and new contents.
+	if stats.Pushed != 6 || stats.Present != 0 {
+		t.Errorf("unexpected stats for the second push: %+v", stats)
+	}
+	all, err := reachable(ctx, s, h)
+	if err != nil {
+		t.Fatalf("failure listing the objects in %q: %v", h, err)
+	}
+	rs := r.Storage()
+	for _, obj := range all {
+		if !rs.HasObject(ctx, obj) {
+			t.Errorf("the object %q is missing from the remote", obj)
+		}
+	}
+}
+
+func TestPushRestoresObjectsRemovedFromRemote(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("contents"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	h, f, err := snapshot.Current(ctx, s, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	r := &Remote{Name: "remote", ArchiveDir: filepath.Join(dir, "remote")}
+	if _, _, err := Push(ctx, s, r, snapshot.Path(file)); err != nil {
+		t.Fatalf("failure pushing the snapshot: %v", err)
+	}
+	rs := r.Storage()
+	generation, err := rs.Generation()
+	if err != nil {
+		t.Fatalf("failure reading the remote generation: %v", err)
+	}
+	if known, err := knownGeneration(s, r.Name, snapshot.Path(file)); err != nil {
+		t.Errorf("failure reading the known generation: %v", err)
+	} else if known != generation {
+		t.Errorf("unexpected known generation: got %q, want %q", known, generation)
+	}
+
+	// Offloading the contents from the remote changes its generation,
+	// so the next push must not trust that they are still there.
+	if err := rs.OffloadObject(ctx, f.Contents, "elsewhere"); err != nil {
+		t.Fatalf("failure offloading the contents from the remote: %v", err)
+	}
+	pushed, stats, err := Push(ctx, s, r, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure pushing the snapshot again: %v", err)
+	} else if !pushed.Equal(h) {
+		t.Errorf("unexpected pushed snapshot: got %q, want %q", pushed, h)
+	}
+	if stats.Pushed != 1 {
+		t.Errorf("unexpected stats for the second push: %+v", stats)
+	}
+	if !rs.HasObject(ctx, f.Contents) {
+		t.Error("the removed contents were not pushed again")
+	}
+	generation, err = rs.Generation()
+	if err != nil {
+		t.Fatalf("failure reading the updated remote generation: %v", err)
+	}
+	if known, err := knownGeneration(s, r.Name, snapshot.Path(file)); err != nil {
+		t.Errorf("failure reading the updated known generation: %v", err)
+	} else if known != generation {
+		t.Errorf("unexpected updated known generation: got %q, want %q", known, generation)
+	}
+}
+
+func TestPushGenerationIsPerPath(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileA := filepath.Join(dir, "a.txt")
+	fileB := filepath.Join(dir, "b.txt")
+	for file, contents := range map[string]string{fileA: "contents of a", fileB: "contents of b"} {
+		if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", file, err)
+		}
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	_, fA, err := snapshot.Current(ctx, s, snapshot.Path(fileA))
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", fileA, err)
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(fileB)); err != nil {
+		t.Fatalf("failure snapshotting %q: %v", fileB, err)
+	}
+	r := &Remote{Name: "remote", ArchiveDir: filepath.Join(dir, "remote")}
+	if _, _, err := Push(ctx, s, r, snapshot.Path(fileA)); err != nil {
+		t.Fatalf("failure pushing %q: %v", fileA, err)
+	}
+
+	// Pushing another path after the remote removed objects must not
+	// make the next push of the first path trust the remote.
+	rs := r.Storage()
+	if err := rs.OffloadObject(ctx, fA.Contents, "elsewhere"); err != nil {
+		t.Fatalf("failure offloading the contents of %q from the remote: %v", fileA, err)
+	}
+	if _, _, err := Push(ctx, s, r, snapshot.Path(fileB)); err != nil {
+		t.Fatalf("failure pushing %q: %v", fileB, err)
+	}
+	if _, stats, err := Push(ctx, s, r, snapshot.Path(fileA)); err != nil {
+		t.Fatalf("failure pushing %q again: %v", fileA, err)
+	} else if stats.Pushed != 1 {
+		t.Errorf("unexpected stats for pushing %q again: %+v", fileA, stats)
+	}
+	if !rs.HasObject(ctx, fA.Contents) {
+		t.Errorf("the removed contents of %q were not pushed again", fileA)
+	}
+}
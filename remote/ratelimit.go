@@ -0,0 +1,622 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// limitsConfig is the name of the archive config file holding the request limits of each remote.
+const limitsConfig = "remote-limits"
+
+const (
+	// initialBackoff is the longest delay before the first retry of a failed request.
+	initialBackoff = 100 * time.Millisecond
+
+	// maxBackoff caps the delay between retries of a failed request.
+	maxBackoff = 30 * time.Second
+
+	// defaultBreakFor is how long requests fail fast once the circuit
+	// breaker has tripped, if no duration is configured.
+	defaultBreakFor = 30 * time.Second
+)
+
+// TimeoutError reports that a request to a remote did not complete within the configured timeout.
+//
+// Requests that time out are retried like any other failed request.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("the request to the remote did not complete within %v", e.Timeout)
+}
+
+// CircuitOpenError reports that a request was not sent, because too
+// many consecutive requests to the remote had already failed.
+type CircuitOpenError struct {
+	// Failures is the number of consecutive requests that failed.
+	Failures int
+
+	// Until is when the break ends. After that, a single request is
+	// sent to test the remote, and requests resume if it succeeds.
+	Until time.Time
+
+	// Err is the error of the last failed request.
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("not sending requests to the remote until %s, after %d consecutive failures: %v", e.Until.Format(time.RFC3339), e.Failures, e.Err)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// RequestLimits controls the rate of requests sent to a remote, how long
+// they may take, and how failed requests are retried.
+//
+// These keep large pushes and pulls within the request rate limits
+// imposed by storage services, and make requests to a hung file system
+// mount or an unresponsive service fail rather than wait forever. The
+// zero value means requests are neither limited nor retried.
+//
+// The limits only apply to the requests sent to the remote backend.
+// They do not apply to reading or writing the local archive during a
+// push or pull, nor to reading the contents of an object once it has
+// been opened.
+type RequestLimits struct {
+	// RequestsPerSecond is the maximum sustained rate of requests; zero means no limit.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests that may be sent at once
+	// before the rate limit applies. Values below 1 are treated as 1.
+	Burst int
+
+	// MaxRetries is the maximum number of times a failed request is retried.
+	//
+	// Retries are delayed using exponential backoff with jitter.
+	// Lookups of missing entries and objects rejected for not
+	// matching their hashes are not retried.
+	MaxRetries int
+
+	// Timeout is how long each attempt of a request may take; zero means no limit.
+	//
+	// For requests that read objects, this only covers opening them.
+	// An attempt that times out is abandoned rather than interrupted,
+	// since calls into a hung file system cannot be interrupted.
+	Timeout time.Duration
+
+	// BreakAfter is the number of consecutive failed requests after
+	// which further requests fail immediately; zero means never.
+	//
+	// Each retry counts as a separate request.
+	BreakAfter int
+
+	// BreakFor is how long requests fail immediately once `BreakAfter`
+	// is reached. Zero means 30 seconds. After that, a single request
+	// is sent, and the others keep failing until it completes. Requests
+	// resume normally if it succeeds, and another break starts if not.
+	BreakFor time.Duration
+}
+
+// IsZero reports whether or not the limits leave requests unlimited and unretried.
+func (l RequestLimits) IsZero() bool {
+	return l.RequestsPerSecond <= 0 && l.MaxRetries <= 0 && l.Timeout <= 0 && l.BreakAfter <= 0
+}
+
+func (l RequestLimits) String() string {
+	return strings.Join([]string{
+		strconv.FormatFloat(l.RequestsPerSecond, 'g', -1, 64),
+		strconv.Itoa(l.Burst),
+		strconv.Itoa(l.MaxRetries),
+		l.Timeout.String(),
+		strconv.Itoa(l.BreakAfter),
+		l.BreakFor.String(),
+	}, " ")
+}
+
+// parseLimits parses a line of the limits config.
+//
+// Lines written before timeouts and circuit breaking were supported
+// only hold the rate, burst, and retry count.
+func parseLimits(line string) (string, RequestLimits, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 && len(fields) != 7 {
+		return "", RequestLimits{}, fmt.Errorf("malformed remote limits %q", line)
+	}
+	rate, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed request rate in the remote limits %q: %w", line, err)
+	}
+	burst, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed burst in the remote limits %q: %w", line, err)
+	}
+	retries, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed retry count in the remote limits %q: %w", line, err)
+	}
+	limits := RequestLimits{RequestsPerSecond: rate, Burst: burst, MaxRetries: retries}
+	if len(fields) == 4 {
+		return fields[0], limits, nil
+	}
+	if limits.Timeout, err = time.ParseDuration(fields[4]); err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed timeout in the remote limits %q: %w", line, err)
+	}
+	if limits.BreakAfter, err = strconv.Atoi(fields[5]); err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed failure count in the remote limits %q: %w", line, err)
+	}
+	if limits.BreakFor, err = time.ParseDuration(fields[6]); err != nil {
+		return "", RequestLimits{}, fmt.Errorf("malformed break duration in the remote limits %q: %w", line, err)
+	}
+	return fields[0], limits, nil
+}
+
+// readLimits reads the request limits configured for each remote, keyed by the remote name.
+func readLimits(s *storage.LocalFiles) (map[string]RequestLimits, error) {
+	limits := make(map[string]RequestLimits)
+	bs, err := os.ReadFile(s.ConfigFile(limitsConfig))
+	if os.IsNotExist(err) {
+		return limits, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured remote limits: %w", err)
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		name, l, err := parseLimits(line)
+		if err != nil {
+			return nil, err
+		}
+		limits[name] = l
+	}
+	return limits, nil
+}
+
+// writeLimits replaces the request limits configured for the given remotes.
+func writeLimits(ctx context.Context, s *storage.LocalFiles, remotes []*Remote) error {
+	var lines []string
+	for _, r := range remotes {
+		if !r.Limits.IsZero() {
+			lines = append(lines, r.Name+" "+r.Limits.String())
+		}
+	}
+	if err := s.WriteConfigFile(ctx, limitsConfig, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("failure writing the configured remote limits: %w", err)
+	}
+	return nil
+}
+
+// tokenBucket limits the rate of requests, while allowing short bursts.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a request may be sent without exceeding the rate limit.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	// Take the token now, even if that leaves the bucket in debt, so
+	// that concurrent waiters are queued rather than all waking at once.
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// breaker stops sending requests once too many consecutive requests have failed.
+//
+// Once a break is over, the breaker is half open: a single request is
+// sent to test the remote, and the others fail until it completes.
+type breaker struct {
+	after int
+	wait  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	lastErr   error
+	openUntil time.Time
+	testing   bool
+}
+
+// allow returns a `*CircuitOpenError` if requests should not currently be sent.
+//
+// If it allows the request to test the remote after a break, then the
+// result of that request must be passed to either `record` or `abandon`.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.after {
+		return nil
+	}
+	if now := time.Now(); !b.testing && !now.Before(b.openUntil) {
+		// Should the test fail, the next break starts from its failure.
+		b.testing = true
+		b.openUntil = now.Add(b.wait)
+		return nil
+	}
+	return &CircuitOpenError{Failures: b.failures, Until: b.openUntil, Err: b.lastErr}
+}
+
+// record counts the result of a request.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.testing = false
+	if err == nil || !retryable(err) {
+		// Permanent errors, such as missing entries, show that the remote is responding.
+		b.failures, b.lastErr = 0, nil
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.failures >= b.after {
+		b.openUntil = time.Now().Add(b.wait)
+	}
+}
+
+// abandon discards a request whose result says nothing about the
+// remote, such as one cancelled by the caller, so that another request
+// may be sent to test the remote.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.testing {
+		b.testing = false
+		b.openUntil = time.Now()
+	}
+}
+
+// limitedBackend applies `RequestLimits` to the requests sent to another backend.
+type limitedBackend struct {
+	b       Backend
+	limits  RequestLimits
+	bucket  *tokenBucket
+	breaker *breaker
+	backoff func(attempt int) time.Duration
+}
+
+func newLimitedBackend(b Backend, limits RequestLimits) *limitedBackend {
+	lb := &limitedBackend{
+		b:       b,
+		limits:  limits,
+		backoff: jitteredBackoff,
+	}
+	if limits.RequestsPerSecond > 0 {
+		lb.bucket = newTokenBucket(limits.RequestsPerSecond, limits.Burst)
+	}
+	if limits.BreakAfter > 0 {
+		lb.breaker = &breaker{after: limits.BreakAfter, wait: limits.BreakFor}
+		if lb.breaker.wait <= 0 {
+			lb.breaker.wait = defaultBreakFor
+		}
+	}
+	return lb
+}
+
+// jitteredBackoff returns the delay before the given retry, using exponential backoff with full jitter.
+func jitteredBackoff(attempt int) time.Duration {
+	ceiling := maxBackoff
+	if attempt < 20 {
+		if backoff := initialBackoff << attempt; backoff < maxBackoff {
+			ceiling = backoff
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryable reports whether or not a failed request should be retried.
+//
+// Requests that were cancelled, or that exceeded the deadline of the
+// caller, are not retried, but those that exceeded the configured
+// `RequestLimits.Timeout` are.
+func retryable(err error) bool {
+	for _, permanent := range []error{os.ErrNotExist, errBatchUnsupported, storage.ErrConflict, storage.ErrCorrupt, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	var mismatch *storage.HashMismatchError
+	var open *CircuitOpenError
+	return !errors.As(err, &mismatch) && !errors.As(err, &open)
+}
+
+// request is a single attempt of a request to a remote, which returns the result of that attempt.
+type request func(ctx context.Context) (interface{}, error)
+
+// attemptResult holds the outcome of an attempt that ran in the background.
+type attemptResult struct {
+	result interface{}
+	err    error
+}
+
+// attempt sends a single attempt of a request, subject to the rate limit, the timeout, and the circuit breaker.
+//
+// Each attempt returns its own result rather than storing it, since
+// an attempt that timed out may still be running. If such an attempt
+// later returns an `io.Closer`, then that is closed.
+func (lb *limitedBackend) attempt(ctx context.Context, req request) (interface{}, error) {
+	if lb.breaker != nil {
+		if err := lb.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if lb.bucket != nil {
+		err = lb.bucket.wait(ctx)
+	}
+	var result interface{}
+	if err == nil {
+		result, err = lb.send(ctx, req)
+	}
+	if lb.breaker != nil {
+		if ctx.Err() == nil {
+			lb.breaker.record(err)
+		} else {
+			lb.breaker.abandon()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// send sends a single attempt of a request, subject to the timeout.
+func (lb *limitedBackend) send(ctx context.Context, req request) (interface{}, error) {
+	if lb.limits.Timeout <= 0 {
+		return req(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, lb.limits.Timeout)
+	defer cancel()
+	done := make(chan attemptResult, 1)
+	go func() {
+		result, err := req(attemptCtx)
+		done <- attemptResult{result: result, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-attemptCtx.Done():
+		go func() {
+			// Nothing will use the result of the abandoned attempt.
+			if closer, ok := (<-done).result.(io.Closer); ok {
+				closer.Close()
+			}
+		}()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, &TimeoutError{Timeout: lb.limits.Timeout}
+	}
+}
+
+// do sends a request, and retries it if it fails.
+//
+// The `rewind` function, if not nil, is called before each retry, and
+// the request is not retried if it fails. Such requests are also not
+// retried after timing out.
+func (lb *limitedBackend) do(ctx context.Context, rewind func() error, req request) (interface{}, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := lb.attempt(ctx, req)
+		if err == nil || attempt >= lb.limits.MaxRetries || !retryable(err) {
+			return result, err
+		}
+		var timeout *TimeoutError
+		if rewind != nil && errors.As(err, &timeout) {
+			// The abandoned attempt may still be reading the contents, so they cannot be rewound.
+			return nil, err
+		}
+		t := time.NewTimer(lb.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		if rewind != nil {
+			if rewindErr := rewind(); rewindErr != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// hash converts the result of a request that looks up a hash.
+func hash(result interface{}, err error) (*snapshot.Hash, error) {
+	if err != nil {
+		return nil, err
+	}
+	return result.(*snapshot.Hash), nil
+}
+
+func (lb *limitedBackend) HasObject(ctx context.Context, h *snapshot.Hash) bool {
+	found, err := lb.attempt(ctx, func(ctx context.Context) (interface{}, error) {
+		return lb.b.HasObject(ctx, h), nil
+	})
+	return err == nil && found.(bool)
+}
+
+func (lb *limitedBackend) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
+	reader, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return lb.b.ReadObject(ctx, h)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reader.(io.ReadCloser), nil
+}
+
+func (lb *limitedBackend) WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error {
+	// The contents can only be sent again if they can be read again from the start.
+	rewind := func() error {
+		seeker, ok := reader.(io.Seeker)
+		if !ok {
+			return errors.New("the object contents cannot be rewound")
+		}
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err
+	}
+	_, err := lb.do(ctx, rewind, func(ctx context.Context) (interface{}, error) {
+		return nil, lb.b.WriteObject(ctx, h, reader)
+	})
+	return err
+}
+
+func (lb *limitedBackend) ThawObject(ctx context.Context, h *snapshot.Hash) (bool, error) {
+	ready, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return ThawObject(ctx, lb.b, h)
+	})
+	if err != nil {
+		return false, err
+	}
+	return ready.(bool), nil
+}
+
+func (lb *limitedBackend) Generation(ctx context.Context) (string, error) {
+	token, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return Generation(ctx, lb.b)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(string), nil
+}
+
+func (lb *limitedBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	return hash(lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return lb.b.FindSnapshot(ctx, p)
+	}))
+}
+
+func (lb *limitedBackend) StoreSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error {
+	_, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return nil, lb.b.StoreSnapshot(ctx, p, h)
+	})
+	return err
+}
+
+func (lb *limitedBackend) FindTrack(ctx context.Context, id string) (*snapshot.Hash, error) {
+	return hash(lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return lb.b.FindTrack(ctx, id)
+	}))
+}
+
+func (lb *limitedBackend) StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error {
+	_, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return nil, lb.b.StoreTrack(ctx, id, h)
+	})
+	return err
+}
+
+func (lb *limitedBackend) missingObjects(ctx context.Context, hs []*snapshot.Hash) ([]*snapshot.Hash, error) {
+	bb, ok := lb.b.(batchBackend)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	missing, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return bb.missingObjects(ctx, hs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing.([]*snapshot.Hash), nil
+}
+
+func (lb *limitedBackend) writeObjects(ctx context.Context, hs []*snapshot.Hash, open func(*snapshot.Hash) (io.ReadCloser, error)) error {
+	bb, ok := lb.b.(batchBackend)
+	if !ok {
+		return errBatchUnsupported
+	}
+	// Each attempt opens the objects again, so they do not need to be rewound.
+	_, err := lb.do(ctx, nil, func(ctx context.Context) (interface{}, error) {
+		return nil, bb.writeObjects(ctx, hs, open)
+	})
+	return err
+}
+
+// copyChunked copies a large object to a remote accessed via the file system, subject to the limits.
+//
+// Failed attempts resume the copy where it left off, but attempts that
+// time out are not retried, since they may still be appending to it.
+func (lb *limitedBackend) copyChunked(ctx context.Context, s, rs *storage.LocalFiles, h *snapshot.Hash, stats *PushStats) error {
+	resume := func() error { return nil }
+	copied, err := lb.do(ctx, resume, func(ctx context.Context) (interface{}, error) {
+		var attemptStats PushStats
+		err := copyChunked(ctx, s, rs, h, &attemptStats)
+		return attemptStats, err
+	})
+	if err != nil {
+		return err
+	}
+	attemptStats := copied.(PushStats)
+	stats.Resumed += attemptStats.Resumed
+	stats.Bytes += attemptStats.Bytes
+	return nil
+}
+
+func (lb *limitedBackend) Close() error {
+	return lb.b.Close()
+}
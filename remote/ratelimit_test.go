@@ -0,0 +1,270 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// flakyBackend is a backend whose requests fail until `failures` of them have failed.
+type flakyBackend struct {
+	Backend
+	failures int
+	requests int
+}
+
+func (b *flakyBackend) fail() error {
+	b.requests++
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("throttled")
+	}
+	return nil
+}
+
+func (b *flakyBackend) WriteObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) error {
+	if err := b.fail(); err != nil {
+		// Simulate a request that failed part way through sending the contents.
+		io.CopyN(io.Discard, reader, 3)
+		return err
+	}
+	return b.Backend.WriteObject(ctx, h, reader)
+}
+
+func (b *flakyBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	return b.Backend.FindSnapshot(ctx, p)
+}
+
+func TestLimitedBackend(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	flaky := &flakyBackend{Backend: NewLocalBackend(&storage.LocalFiles{ArchiveDir: dir}), failures: 2}
+	lb := newLimitedBackend(flaky, RequestLimits{MaxRetries: 2})
+	lb.backoff = func(int) time.Duration { return 0 }
+
+	contents := filepath.Join(t.TempDir(), "contents")
+	if err := os.WriteFile(contents, []byte("Hello, World!"), 0600); err != nil {
+		t.Fatalf("failure writing the example contents: %v", err)
+	}
+	reader, err := os.Open(contents)
+	if err != nil {
+		t.Fatalf("failure opening the example contents: %v", err)
+	}
+	defer reader.Close()
+	h, err := snapshot.NewHash(strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	if err := lb.WriteObject(ctx, h, reader); err != nil {
+		t.Fatalf("failure writing an object after retries: %v", err)
+	}
+	if got, want := flaky.requests, 3; got != want {
+		t.Errorf("unexpected number of requests: got %d, want %d", got, want)
+	}
+	if !lb.HasObject(ctx, h) {
+		t.Error("the retried object was not written")
+	}
+
+	// Lookups of missing entries are not retried.
+	flaky.requests = 0
+	if _, err := lb.FindSnapshot(ctx, snapshot.Path("/missing")); !os.IsNotExist(err) {
+		t.Errorf("unexpected result looking up a missing snapshot: %v", err)
+	}
+	if got, want := flaky.requests, 1; got != want {
+		t.Errorf("unexpected number of requests for a missing snapshot: got %d, want %d", got, want)
+	}
+
+	// Requests that keep failing give up after the maximum retries.
+	flaky.requests, flaky.failures = 0, 10
+	if _, err := lb.FindSnapshot(ctx, snapshot.Path("/missing")); err == nil || os.IsNotExist(err) {
+		t.Errorf("unexpected result for a request that keeps failing: %v", err)
+	}
+	if got, want := flaky.requests, 3; got != want {
+		t.Errorf("unexpected number of requests before giving up: got %d, want %d", got, want)
+	}
+
+	// Requests beyond the burst are spread out at the configured rate.
+	flaky.requests, flaky.failures = 0, 0
+	lb = newLimitedBackend(flaky, RequestLimits{RequestsPerSecond: 50, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		lb.FindSnapshot(ctx, snapshot.Path("/missing"))
+	}
+	if elapsed, want := time.Since(start), 90*time.Millisecond; elapsed < want {
+		t.Errorf("requests were not rate limited: 7 requests took %v, want at least %v", elapsed, want)
+	}
+}
+
+func TestRemoteLimitsConfig(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: t.TempDir()}
+	limits := RequestLimits{RequestsPerSecond: 12.5, Burst: 4, MaxRetries: 3}
+	mountLimits := RequestLimits{Timeout: 2 * time.Minute, BreakAfter: 5, BreakFor: time.Minute}
+	remotes := []*Remote{
+		{Name: "cloud", ArchiveDir: "cloud::bucket", Limits: limits},
+		{Name: "local", Priority: 1, ArchiveDir: "/mnt/backup"},
+		{Name: "mount", Priority: 2, ArchiveDir: "/mnt/nfs", Limits: mountLimits},
+	}
+	if err := WriteRemotes(ctx, s, remotes); err != nil {
+		t.Fatalf("failure writing the remotes: %v", err)
+	}
+	got, err := ReadRemotes(s)
+	if err != nil {
+		t.Fatalf("failure reading the remotes: %v", err)
+	}
+	if len(got) != 3 || got[0].Limits != limits || !got[1].Limits.IsZero() || got[2].Limits != mountLimits {
+		t.Fatalf("unexpected remotes: got %+v", got)
+	}
+
+	// Limits written without timeouts or circuit breaking are still read.
+	if _, old, err := parseLimits("cloud 12.5 4 3"); err != nil || old != limits {
+		t.Errorf("unexpected result parsing old limits: %+v, %v", old, err)
+	}
+}
+
+// hungBackend is a backend whose snapshot lookups never complete until `release` is closed.
+type hungBackend struct {
+	Backend
+	release chan struct{}
+}
+
+func (b *hungBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	<-b.release
+	return nil, errors.New("released")
+}
+
+func TestLimitedBackendTimeout(t *testing.T) {
+	ctx := context.Background()
+	hung := &hungBackend{Backend: NewLocalBackend(&storage.LocalFiles{ArchiveDir: t.TempDir()}), release: make(chan struct{})}
+	defer close(hung.release)
+	lb := newLimitedBackend(hung, RequestLimits{Timeout: 20 * time.Millisecond, MaxRetries: 1})
+	lb.backoff = func(int) time.Duration { return 0 }
+
+	start := time.Now()
+	_, err := lb.FindSnapshot(ctx, snapshot.Path("/hung"))
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("unexpected result for a hung request: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("unexpected duration of a hung request that was retried once: %v", elapsed)
+	}
+
+	// Cancelling the caller is reported as such rather than as a timeout.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := lb.FindSnapshot(cancelled, snapshot.Path("/hung")); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected result for a cancelled request: %v", err)
+	}
+}
+
+func TestLimitedBackendBreaker(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBackend{Backend: NewLocalBackend(&storage.LocalFiles{ArchiveDir: t.TempDir()}), failures: 3}
+	lb := newLimitedBackend(flaky, RequestLimits{BreakAfter: 3, BreakFor: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		if _, err := lb.FindSnapshot(ctx, snapshot.Path("/missing")); err == nil || os.IsNotExist(err) {
+			t.Errorf("unexpected result for failing request %d: %v", i, err)
+		}
+	}
+	_, err := lb.FindSnapshot(ctx, snapshot.Path("/missing"))
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || open.Failures != 3 {
+		t.Fatalf("unexpected result once the breaker tripped: %v", err)
+	}
+	if got, want := flaky.requests, 3; got != want {
+		t.Errorf("requests were sent while the breaker was open: got %d, want %d", got, want)
+	}
+
+	// Once the break is over, a successful request closes the breaker.
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := lb.FindSnapshot(ctx, snapshot.Path("/missing")); !os.IsNotExist(err) {
+			t.Errorf("unexpected result after the break: %v", err)
+		}
+	}
+	if got, want := flaky.requests, 5; got != want {
+		t.Errorf("unexpected number of requests after the break: got %d, want %d", got, want)
+	}
+}
+
+// blockedBackend is a backend whose lookups fail until `failures` of them have failed, and then wait for `release`.
+type blockedBackend struct {
+	Backend
+	failures int
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (b *blockedBackend) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, error) {
+	if b.failures > 0 {
+		b.failures--
+		return nil, errors.New("throttled")
+	}
+	b.started <- struct{}{}
+	<-b.release
+	return b.Backend.FindSnapshot(ctx, p)
+}
+
+func TestLimitedBackendBreakerSendsOneTestRequest(t *testing.T) {
+	ctx := context.Background()
+	blocked := &blockedBackend{
+		Backend:  NewLocalBackend(&storage.LocalFiles{ArchiveDir: t.TempDir()}),
+		failures: 2,
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	lb := newLimitedBackend(blocked, RequestLimits{BreakAfter: 2, BreakFor: 20 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		lb.FindSnapshot(ctx, snapshot.Path("/missing"))
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// The first request after the break tests the remote, and the others fail until it completes.
+	done := make(chan error)
+	go func() {
+		_, err := lb.FindSnapshot(ctx, snapshot.Path("/missing"))
+		done <- err
+	}()
+	<-blocked.started
+	_, err := lb.FindSnapshot(ctx, snapshot.Path("/missing"))
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Errorf("unexpected result while the remote was being tested: %v", err)
+	}
+	close(blocked.release)
+	if err := <-done; !os.IsNotExist(err) {
+		t.Errorf("unexpected result of the test request: %v", err)
+	}
+
+	go func() { <-blocked.started }()
+	if _, err := lb.FindSnapshot(ctx, snapshot.Path("/missing")); !os.IsNotExist(err) {
+		t.Errorf("unexpected result once the test request succeeded: %v", err)
+	}
+}
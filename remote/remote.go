@@ -0,0 +1,180 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote defines how snapshots are copied from other archives.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const remotesConfig = "remotes"
+
+// Remote is another archive that snapshots can be pulled from.
+//
+// Remotes are usually accessed via the file system, so they can be on
+// a separate drive or on a network mount. Other storage services are
+// supported using backend plugins; see `Remote.Plugin`.
+type Remote struct {
+	// Name is the name used to refer to the remote.
+	Name string
+
+	// Priority determines the order in which remotes are tried.
+	//
+	// Remotes with lower priorities are tried first.
+	Priority int
+
+	// ArchiveDir is the location of the remote archive.
+	//
+	// For remotes accessed using a backend plugin, this has the form
+	// `<NAME>::<ADDRESS>`.
+	ArchiveDir string
+
+	// NoCompress disables compressing the object contents sent to and
+	// received from backend plugins, e.g. for data that is already
+	// compressed. This is not persisted in the configured remotes.
+	NoCompress bool
+
+	// Batch controls how small objects are grouped together when
+	// pushing to backend plugins. This is not persisted in the
+	// configured remotes.
+	Batch BatchOptions
+
+	// Limits controls the rate of requests sent to the remote, how
+	// long they may take, and how failed requests are retried.
+	Limits RequestLimits
+}
+
+// Storage returns the storage for the remote archive.
+//
+// This is only meaningful for remotes accessed via the file system.
+func (r *Remote) Storage() *storage.LocalFiles {
+	return &storage.LocalFiles{ArchiveDir: r.ArchiveDir}
+}
+
+func (r *Remote) String() string {
+	return strings.Join([]string{r.Name, strconv.Itoa(r.Priority), r.ArchiveDir}, " ")
+}
+
+func parseRemote(line string) (*Remote, error) {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed remote %q", line)
+	}
+	priority, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed priority in the remote %q: %w", line, err)
+	}
+	return &Remote{
+		Name:       parts[0],
+		Priority:   priority,
+		ArchiveDir: parts[2],
+	}, nil
+}
+
+// ReadRemotes reads the remotes configured for the given archive.
+//
+// The returned remotes are sorted in the order they should be tried.
+func ReadRemotes(s *storage.LocalFiles) ([]*Remote, error) {
+	bs, err := s.ReadCommandConfig(remotesConfig)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured remotes: %w", err)
+	}
+	var remotes []*Remote
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		r, err := parseRemote(line)
+		if err != nil {
+			return nil, err
+		}
+		remotes = append(remotes, r)
+	}
+	limits, err := readLimits(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range remotes {
+		r.Limits = limits[r.Name]
+	}
+	sort.SliceStable(remotes, func(i, j int) bool {
+		return remotes[i].Priority < remotes[j].Priority
+	})
+	return remotes, nil
+}
+
+// WriteRemotes replaces the remotes configured for the given archive.
+func WriteRemotes(ctx context.Context, s *storage.LocalFiles, remotes []*Remote) error {
+	var lines []string
+	for _, r := range remotes {
+		if strings.Contains(r.Name, " ") || len(r.Name) == 0 {
+			return fmt.Errorf("invalid remote name %q", r.Name)
+		}
+		if strings.Contains(r.ArchiveDir, "\n") {
+			return fmt.Errorf("invalid archive dir %q for the remote %q", r.ArchiveDir, r.Name)
+		}
+		lines = append(lines, r.String())
+	}
+	if err := s.WriteConfigFile(ctx, remotesConfig, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("failure writing the configured remotes: %w", err)
+	}
+	return writeLimits(ctx, s, remotes)
+}
+
+// FindSnapshot looks up the latest snapshot of the given path in the remotes.
+//
+// The remotes are tried in order, and the first snapshot found is returned.
+func FindSnapshot(ctx context.Context, remotes []*Remote, p snapshot.Path) (*snapshot.Hash, *Remote, error) {
+	for _, r := range remotes {
+		b, err := r.Backend(ctx)
+		if err != nil {
+			continue
+		}
+		h, err := b.FindSnapshot(ctx, p)
+		b.Close()
+		if err == nil && h != nil {
+			return h, r, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no remote has a snapshot of %q: %w", p, storage.ErrNotFound)
+}
+
+// FindTrack looks up the latest snapshot of the given track in the remotes.
+//
+// The remotes are tried in order, and the first snapshot found is returned.
+func FindTrack(ctx context.Context, remotes []*Remote, id string) (*snapshot.Hash, *Remote, error) {
+	for _, r := range remotes {
+		b, err := r.Backend(ctx)
+		if err != nil {
+			continue
+		}
+		h, err := b.FindTrack(ctx, id)
+		b.Close()
+		if err == nil && h != nil {
+			return h, r, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no remote has a snapshot of the track %q: %w", id, storage.ErrNotFound)
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// transferStatsConfig is the name of the archive config file holding the transfer statistics.
+const transferStatsConfig = "transfer-stats"
+
+// transferStatsMu serializes updates to the transfer statistics within this process.
+var transferStatsMu sync.Mutex
+
+// TransferStats are the cumulative statistics of the transfers to and from a remote.
+type TransferStats struct {
+	// BytesSent is the number of object bytes pushed to the remote.
+	BytesSent int64
+
+	// BytesReceived is the number of object bytes pulled from the remote.
+	BytesReceived int64
+
+	// ObjectsSent is the number of objects pushed to the remote.
+	ObjectsSent int64
+
+	// ObjectsReceived is the number of objects pulled from the remote.
+	ObjectsReceived int64
+
+	// DedupHits is the number of objects that did not need to be
+	// pushed because the remote already had them.
+	DedupHits int64
+
+	// LastPush is the time of the last successful push to the remote, or zero if there has been none.
+	LastPush time.Time
+
+	// LastPull is the time of the last successful pull from the remote, or zero if there has been none.
+	LastPull time.Time
+}
+
+// add adds the counts of `other` to the statistics, and takes the later of their timestamps.
+func (ts *TransferStats) add(other *TransferStats) {
+	ts.BytesSent += other.BytesSent
+	ts.BytesReceived += other.BytesReceived
+	ts.ObjectsSent += other.ObjectsSent
+	ts.ObjectsReceived += other.ObjectsReceived
+	ts.DedupHits += other.DedupHits
+	if other.LastPush.After(ts.LastPush) {
+		ts.LastPush = other.LastPush
+	}
+	if other.LastPull.After(ts.LastPull) {
+		ts.LastPull = other.LastPull
+	}
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || secs == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
+
+func (ts *TransferStats) String() string {
+	return strings.Join([]string{
+		strconv.FormatInt(ts.BytesSent, 10),
+		strconv.FormatInt(ts.BytesReceived, 10),
+		strconv.FormatInt(ts.ObjectsSent, 10),
+		strconv.FormatInt(ts.ObjectsReceived, 10),
+		strconv.FormatInt(ts.DedupHits, 10),
+		formatTimestamp(ts.LastPush),
+		formatTimestamp(ts.LastPull),
+	}, " ")
+}
+
+func parseTransferStats(line string) (string, *TransferStats, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 8 {
+		return "", nil, fmt.Errorf("malformed transfer statistics %q", line)
+	}
+	ts := &TransferStats{}
+	for i, count := range []*int64{&ts.BytesSent, &ts.BytesReceived, &ts.ObjectsSent, &ts.ObjectsReceived, &ts.DedupHits} {
+		n, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("malformed count in the transfer statistics %q: %w", line, err)
+		}
+		*count = n
+	}
+	var err error
+	if ts.LastPush, err = parseTimestamp(fields[6]); err != nil {
+		return "", nil, fmt.Errorf("malformed timestamp in the transfer statistics %q: %w", line, err)
+	}
+	if ts.LastPull, err = parseTimestamp(fields[7]); err != nil {
+		return "", nil, fmt.Errorf("malformed timestamp in the transfer statistics %q: %w", line, err)
+	}
+	return fields[0], ts, nil
+}
+
+// ReadTransferStats reads the transfer statistics recorded in the given archive, keyed by the remote name.
+func ReadTransferStats(s *storage.LocalFiles) (map[string]*TransferStats, error) {
+	stats := make(map[string]*TransferStats)
+	bs, err := os.ReadFile(s.ConfigFile(transferStatsConfig))
+	if os.IsNotExist(err) {
+		return stats, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the transfer statistics: %w", err)
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		name, ts, err := parseTransferStats(line)
+		if err != nil {
+			return nil, err
+		}
+		stats[name] = ts
+	}
+	return stats, nil
+}
+
+// RecordTransfer adds the given statistics to those recorded for the named remote.
+func RecordTransfer(ctx context.Context, s *storage.LocalFiles, name string, delta *TransferStats) error {
+	transferStatsMu.Lock()
+	defer transferStatsMu.Unlock()
+	stats, err := ReadTransferStats(s)
+	if err != nil {
+		return err
+	}
+	ts, ok := stats[name]
+	if !ok {
+		ts = &TransferStats{}
+		stats[name] = ts
+	}
+	ts.add(delta)
+	var lines []string
+	for name, ts := range stats {
+		lines = append(lines, name+" "+ts.String())
+	}
+	sort.Strings(lines)
+	if err := s.WriteConfigFile(ctx, transferStatsConfig, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("failure writing the transfer statistics: %w", err)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
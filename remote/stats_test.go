@@ -0,0 +1,83 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestTransferStats(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	contents := "Hello, World!"
+	if err := os.WriteFile(file, []byte(contents), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "local")}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	r := &Remote{Name: "backup", ArchiveDir: filepath.Join(dir, "remote")}
+	for i := 0; i < 2; i++ {
+		if _, _, err := Push(ctx, s, r, snapshot.Path(file)); err != nil {
+			t.Fatalf("failure pushing the snapshot: %v", err)
+		}
+	}
+	stats, err := ReadTransferStats(s)
+	if err != nil {
+		t.Fatalf("failure reading the transfer statistics: %v", err)
+	}
+	pushed, ok := stats[r.Name]
+	if !ok {
+		t.Fatalf("missing transfer statistics for %q: %v", r.Name, stats)
+	}
+	// The repeated push only considers objects added since the remote's snapshot, of which there are none.
+	if pushed.ObjectsSent != 2 || pushed.DedupHits != 0 {
+		t.Errorf("unexpected object counts after pushing: %+v", pushed)
+	}
+	if pushed.BytesSent <= int64(len(contents)) {
+		t.Errorf("unexpected number of bytes sent: %d", pushed.BytesSent)
+	}
+	if pushed.LastPush.IsZero() || !pushed.LastPull.IsZero() {
+		t.Errorf("unexpected timestamps after pushing: %+v", pushed)
+	}
+
+	other := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "other")}
+	if _, err := Pull(ctx, other, []*Remote{r}, h); err != nil {
+		t.Fatalf("failure pulling the snapshot: %v", err)
+	}
+	stats, err = ReadTransferStats(other)
+	if err != nil {
+		t.Fatalf("failure reading the transfer statistics: %v", err)
+	}
+	pulled, ok := stats[r.Name]
+	if !ok {
+		t.Fatalf("missing transfer statistics for %q: %v", r.Name, stats)
+	}
+	if pulled.ObjectsReceived != 2 || pulled.BytesReceived != pushed.BytesSent {
+		t.Errorf("unexpected counts after pulling: got %+v, want %d bytes in 2 objects", pulled, pushed.BytesSent)
+	}
+	if pulled.LastPull.IsZero() || !pulled.LastPush.IsZero() {
+		t.Errorf("unexpected timestamps after pulling: %+v", pulled)
+	}
+}
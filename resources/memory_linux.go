@@ -0,0 +1,57 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package resources
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// availableMemory returns the number of bytes of memory available to the process.
+//
+// This is the memory the kernel reports as available for starting new
+// programs, further limited by the memory limit of the process's
+// control group, if any.
+func availableMemory() (int64, bool) {
+	bs, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	var available int64
+	for _, line := range strings.Split(string(bs), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "MemAvailable:" || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		available = kb * 1024
+	}
+	if available <= 0 {
+		return 0, false
+	}
+	if bs, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		// The limit is "max" if the control group is unlimited.
+		if limit, err := strconv.ParseInt(strings.TrimSpace(string(bs)), 10, 64); err == nil && limit < available {
+			available = limit
+		}
+	}
+	return available, true
+}
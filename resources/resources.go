@@ -0,0 +1,244 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resources determines how much concurrency and memory rvcs uses.
+//
+// Each setting is auto-detected from the number of CPUs and the amount
+// of available memory, so that rvcs behaves well on machines ranging
+// from a small NAS to a large workstation. The detected values can be
+// overridden per archive using the "resources" config file, and those
+// in turn can be overridden using environment variables.
+//
+// The config file has one line per overridden setting, of the form:
+//
+//	<NAME> <VALUE>
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// resourcesConfig is the name of the archive config file holding the overridden settings.
+const resourcesConfig = "resources"
+
+// The names of the settings.
+const (
+	// Workers is the maximum number of files that are read or written concurrently.
+	Workers = "workers"
+
+	// ReadBufferSize is the size, in bytes, of the buffer used to read each file.
+	ReadBufferSize = "read-buffer-size"
+
+	// MaxInFlightBytes is the maximum combined size, in bytes, of the files being read at the same time.
+	MaxInFlightBytes = "max-in-flight-bytes"
+
+	// CacheMemory is the approximate memory, in bytes, used for pending updates to the path info cache.
+	CacheMemory = "cache-memory"
+)
+
+// Names lists the names of all of the settings.
+var Names = []string{Workers, ReadBufferSize, MaxInFlightBytes, CacheMemory}
+
+// envVars maps each setting name to the environment variable that overrides it.
+var envVars = map[string]string{
+	Workers:          "RVCS_WORKERS",
+	ReadBufferSize:   "RVCS_READ_BUFFER_SIZE",
+	MaxInFlightBytes: "RVCS_MAX_IN_FLIGHT_BYTES",
+	CacheMemory:      "RVCS_CACHE_MEMORY",
+}
+
+// EnvVar returns the name of the environment variable that overrides the named setting.
+func EnvVar(name string) string {
+	return envVars[name]
+}
+
+const (
+	kib = 1024
+	mib = 1024 * kib
+	gib = 1024 * mib
+
+	// defaultMemory is the amount of available memory assumed when it cannot be detected.
+	defaultMemory = 1 * gib
+
+	// maxDetectedWorkers caps the detected number of workers.
+	//
+	// Beyond this, additional workers mostly contend for the same disk.
+	maxDetectedWorkers = 16
+)
+
+// Source describes where the value of a setting came from.
+type Source string
+
+const (
+	// Detected means the value was derived from the number of CPUs and the available memory.
+	Detected Source = "detected"
+
+	// Configured means the value was read from the archive's config.
+	Configured Source = "config"
+
+	// Environment means the value was read from an environment variable.
+	Environment Source = "environment"
+)
+
+// Budget holds the value of every setting.
+type Budget struct {
+	// Values holds the value of each setting, keyed by its name.
+	Values map[string]int64
+
+	// Sources records where the value of each setting came from, keyed by its name.
+	Sources map[string]Source
+}
+
+// Workers returns the maximum number of files that are read or written concurrently.
+func (b *Budget) Workers() int {
+	return int(b.Values[Workers])
+}
+
+// ReadBufferSize returns the size, in bytes, of the buffer used to read each file.
+func (b *Budget) ReadBufferSize() int {
+	return int(b.Values[ReadBufferSize])
+}
+
+// MaxInFlightBytes returns the maximum combined size, in bytes, of the files being read at the same time.
+func (b *Budget) MaxInFlightBytes() int64 {
+	return b.Values[MaxInFlightBytes]
+}
+
+// CacheMemory returns the approximate memory, in bytes, used for pending updates to the path info cache.
+func (b *Budget) CacheMemory() int64 {
+	return b.Values[CacheMemory]
+}
+
+func clamp(v, min, max int64) int64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// detect returns the value of each setting for a machine with the given number of CPUs and bytes of available memory.
+func detect(cpus int, memory int64) map[string]int64 {
+	return map[string]int64{
+		Workers:          clamp(int64(cpus), 1, maxDetectedWorkers),
+		ReadBufferSize:   clamp(memory/(4*kib), 32*kib, 1*mib),
+		MaxInFlightBytes: clamp(memory/8, 16*mib, 1*gib),
+		CacheMemory:      clamp(memory/64, 1*mib, 256*mib),
+	}
+}
+
+func parseValue(name, value string) (int64, error) {
+	if _, ok := envVars[name]; !ok {
+		return 0, fmt.Errorf("unknown resource setting %q", name)
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed value for the resource setting %q: %w", name, err)
+	}
+	if v < 1 {
+		return 0, fmt.Errorf("the resource setting %q must be positive, got %d", name, v)
+	}
+	return v, nil
+}
+
+// ReadConfig reads the settings overridden in the archive's config, keyed by name.
+func ReadConfig(s *storage.LocalFiles) (map[string]int64, error) {
+	configured := make(map[string]int64)
+	bs, err := os.ReadFile(s.ConfigFile(resourcesConfig))
+	if os.IsNotExist(err) {
+		return configured, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured resource settings: %w", err)
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed resource setting %q", line)
+		}
+		v, err := parseValue(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+		configured[fields[0]] = v
+	}
+	return configured, nil
+}
+
+// WriteConfig replaces the settings overridden in the archive's config.
+func WriteConfig(ctx context.Context, s *storage.LocalFiles, configured map[string]int64) error {
+	var lines []string
+	for name, v := range configured {
+		if _, ok := envVars[name]; !ok {
+			return fmt.Errorf("unknown resource setting %q", name)
+		}
+		lines = append(lines, name+" "+strconv.FormatInt(v, 10))
+	}
+	sort.Strings(lines)
+	if err := s.WriteConfigFile(ctx, resourcesConfig, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("failure writing the configured resource settings: %w", err)
+	}
+	return nil
+}
+
+// Load returns the value of every setting for the given archive.
+//
+// Environment variables take precedence over the archive's config,
+// which takes precedence over the detected values.
+func Load(s *storage.LocalFiles) (*Budget, error) {
+	memory, ok := availableMemory()
+	if !ok {
+		memory = defaultMemory
+	}
+	b := &Budget{
+		Values:  detect(runtime.NumCPU(), memory),
+		Sources: make(map[string]Source),
+	}
+	for _, name := range Names {
+		b.Sources[name] = Detected
+	}
+	configured, err := ReadConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range configured {
+		b.Values[name] = v
+		b.Sources[name] = Configured
+	}
+	for _, name := range Names {
+		value := os.Getenv(envVars[name])
+		if len(value) == 0 {
+			continue
+		}
+		v, err := parseValue(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the %s environment variable: %w", envVars[name], err)
+		}
+		b.Values[name] = v
+		b.Sources[name] = Environment
+	}
+	return b, nil
+}
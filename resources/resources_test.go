@@ -0,0 +1,108 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		Description string
+		CPUs        int
+		Memory      int64
+		Want        map[string]int64
+	}{
+		{
+			Description: "small NAS",
+			CPUs:        4,
+			Memory:      512 * mib,
+			Want: map[string]int64{
+				Workers:          4,
+				ReadBufferSize:   128 * kib,
+				MaxInFlightBytes: 64 * mib,
+				CacheMemory:      8 * mib,
+			},
+		},
+		{
+			Description: "large workstation",
+			CPUs:        64,
+			Memory:      128 * gib,
+			Want: map[string]int64{
+				Workers:          maxDetectedWorkers,
+				ReadBufferSize:   1 * mib,
+				MaxInFlightBytes: 1 * gib,
+				CacheMemory:      256 * mib,
+			},
+		},
+		{
+			Description: "tiny",
+			CPUs:        1,
+			Memory:      16 * mib,
+			Want: map[string]int64{
+				Workers:          1,
+				ReadBufferSize:   32 * kib,
+				MaxInFlightBytes: 16 * mib,
+				CacheMemory:      1 * mib,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		if got := detect(testCase.CPUs, testCase.Memory); !reflect.DeepEqual(got, testCase.Want) {
+			t.Errorf("unexpected settings for the test case %q: got %v, want %v", testCase.Description, got, testCase.Want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(t.TempDir(), "archive")}
+	if err := WriteConfig(ctx, s, map[string]int64{Workers: 3, CacheMemory: 1000}); err != nil {
+		t.Fatalf("failure writing the resource config: %v", err)
+	}
+	t.Setenv(EnvVar(CacheMemory), "2000")
+	b, err := Load(s)
+	if err != nil {
+		t.Fatalf("failure loading the resource settings: %v", err)
+	}
+	if got, want := b.Workers(), 3; got != want {
+		t.Errorf("unexpected workers: got %d, want %d", got, want)
+	}
+	if got, want := b.CacheMemory(), int64(2000); got != want {
+		t.Errorf("unexpected cache memory: got %d, want %d", got, want)
+	}
+	wantSources := map[string]Source{
+		Workers:          Configured,
+		ReadBufferSize:   Detected,
+		MaxInFlightBytes: Detected,
+		CacheMemory:      Environment,
+	}
+	if !reflect.DeepEqual(b.Sources, wantSources) {
+		t.Errorf("unexpected sources: got %v, want %v", b.Sources, wantSources)
+	}
+
+	t.Setenv(EnvVar(Workers), "0")
+	if _, err := Load(s); err == nil {
+		t.Error("unexpected success loading a non-positive setting")
+	}
+	if err := WriteConfig(ctx, s, map[string]int64{"unknown": 1}); err == nil {
+		t.Error("unexpected success writing an unknown setting")
+	}
+}
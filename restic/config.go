@@ -0,0 +1,280 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restic
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// repositoryVersion is the only version of the repository format that
+// can be written. Version 2 repositories compress their contents with
+// zstd, which is not available here.
+const repositoryVersion = 1
+
+// The scrypt parameters used to derive the key for new key files.
+//
+// These are variables so that tests can use cheaper ones.
+var (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+// config is the contents of the `config` file of a repository.
+type config struct {
+	Version           int    `json:"version"`
+	ID                string `json:"id"`
+	ChunkerPolynomial pol    `json:"chunker_polynomial"`
+}
+
+// newConfig returns the configuration for a new repository, with a random ID and chunker polynomial.
+func newConfig() (*config, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failure generating a repository ID: %w", err)
+	}
+	p, err := randomPol()
+	if err != nil {
+		return nil, err
+	}
+	return &config{
+		Version:           repositoryVersion,
+		ID:                hex.EncodeToString(buf),
+		ChunkerPolynomial: p,
+	}, nil
+}
+
+// pol is a polynomial over GF(2), with the coefficient of x^i stored in bit i.
+//
+// Restic chunks file contents using a Rabin fingerprint over a random
+// irreducible polynomial of degree 53, which is stored in the config.
+// Exported file contents are split into fixed size chunks instead, but
+// the polynomial is still required for restic to back up into the
+// repository afterwards.
+type pol uint64
+
+// MarshalJSON encodes the polynomial as a hex string, the same way restic does.
+func (p pol) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%x", uint64(p)))
+}
+
+// UnmarshalJSON parses a polynomial encoded by `MarshalJSON`.
+func (p *pol) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return fmt.Errorf("malformed chunker polynomial %q: %w", s, err)
+	}
+	*p = pol(v)
+	return nil
+}
+
+// deg returns the degree of the polynomial, or -1 for the zero polynomial.
+func (p pol) deg() int {
+	return 63 - bits.LeadingZeros64(uint64(p))
+}
+
+// mod returns the remainder of dividing `p` by `d`.
+func (p pol) mod(d pol) pol {
+	for p.deg() >= d.deg() {
+		p ^= d << uint(p.deg()-d.deg())
+	}
+	return p
+}
+
+// mulMod returns the product of `p` and `q` modulo `m`.
+//
+// Both `p` and `q` must already be reduced modulo `m`.
+func (p pol) mulMod(q, m pol) pol {
+	var product pol
+	top := pol(1) << uint(m.deg())
+	for ; q != 0; q >>= 1 {
+		if q&1 != 0 {
+			product ^= p
+		}
+		p <<= 1
+		if p&top != 0 {
+			p ^= m
+		}
+	}
+	return product
+}
+
+func gcd(p, q pol) pol {
+	for q != 0 {
+		p, q = q, p.mod(q)
+	}
+	return p
+}
+
+// irreducible reports whether or not the polynomial has no nontrivial factors, using Ben-Or's test.
+func (p pol) irreducible() bool {
+	x := pol(2)
+	for i := 1; i <= p.deg()/2; i++ {
+		// x is x^(2^i) mod p.
+		x = x.mulMod(x, p)
+		if gcd(p, x^2) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// randomPol returns a random irreducible polynomial of degree 53.
+func randomPol() (pol, error) {
+	buf := make([]byte, 8)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return 0, fmt.Errorf("failure generating a chunker polynomial: %w", err)
+		}
+		p := pol(binary.LittleEndian.Uint64(buf))&(1<<53-1) | 1<<53
+		if p.irreducible() {
+			return p, nil
+		}
+	}
+}
+
+// keyFile is the contents of a file in the `keys` directory.
+//
+// Key files are not encrypted. Instead, the `Data` field holds the
+// master key of the repository encrypted with a key derived from the
+// password using scrypt.
+type keyFile struct {
+	Created  time.Time `json:"created"`
+	Username string    `json:"username"`
+	Hostname string    `json:"hostname"`
+	KDF      string    `json:"kdf"`
+	N        int       `json:"N"`
+	R        int       `json:"r"`
+	P        int       `json:"p"`
+	Salt     []byte    `json:"salt"`
+	Data     []byte    `json:"data"`
+}
+
+// userKey derives the key that encrypts the master key.
+func (kf *keyFile) userKey(password string) (*key, error) {
+	if kf.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function %q", kf.KDF)
+	}
+	derived, err := scrypt.Key([]byte(password), kf.Salt, kf.N, kf.R, kf.P, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failure deriving the key from the password: %w", err)
+	}
+	return keyFromBytes(derived), nil
+}
+
+// newKeyFile returns a key file that encrypts the master key `master` with the password.
+func newKeyFile(master *key, password string) (*keyFile, error) {
+	kf := &keyFile{
+		Created: time.Now(),
+		KDF:     "scrypt",
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, 64),
+	}
+	kf.Username, kf.Hostname = currentUser()
+	if _, err := rand.Read(kf.Salt); err != nil {
+		return nil, fmt.Errorf("failure generating a salt: %w", err)
+	}
+	userKey, err := kf.userKey(password)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(master)
+	if err != nil {
+		return nil, fmt.Errorf("failure encoding the master key: %w", err)
+	}
+	if kf.Data, err = userKey.seal(encoded); err != nil {
+		return nil, err
+	}
+	return kf, nil
+}
+
+// masterKey decrypts the master key, returning `errInvalidMAC` if the password is wrong.
+func (kf *keyFile) masterKey(password string) (*key, error) {
+	userKey, err := kf.userKey(password)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := userKey.open(kf.Data)
+	if err != nil {
+		return nil, err
+	}
+	var master key
+	if err := json.Unmarshal(encoded, &master); err != nil {
+		return nil, fmt.Errorf("failure parsing the master key: %w", err)
+	}
+	if !master.valid() {
+		return nil, fmt.Errorf("the master key has the wrong size")
+	}
+	return &master, nil
+}
+
+// lock is the contents of a file in the `locks` directory.
+//
+// Restic refuses to remove data from a repository while it is locked,
+// so a non-exclusive lock is held while exporting.
+type lock struct {
+	Time      time.Time `json:"time"`
+	Exclusive bool      `json:"exclusive"`
+	Hostname  string    `json:"hostname"`
+	Username  string    `json:"username"`
+	PID       int       `json:"pid"`
+	UID       uint32    `json:"uid,omitempty"`
+	GID       uint32    `json:"gid,omitempty"`
+}
+
+func newLock() *lock {
+	l := &lock{
+		Time: time.Now(),
+		PID:  os.Getpid(),
+		UID:  currentID(os.Getuid()),
+		GID:  currentID(os.Getgid()),
+	}
+	l.Username, l.Hostname = currentUser()
+	return l
+}
+
+// currentID converts a user or group ID, which is -1 on platforms without them, to the form stored by restic.
+func currentID(id int) uint32 {
+	if id < 0 {
+		return 0
+	}
+	return uint32(id)
+}
+
+// currentUser returns the name of the current user and host, or empty strings if they are unknown.
+func currentUser() (username, hostname string) {
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname, _ = os.Hostname()
+	return username, hostname
+}
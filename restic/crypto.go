@@ -0,0 +1,167 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/poly1305"
+)
+
+// Everything in a restic repository other than the key files is
+// encrypted with AES-256 in counter mode and authenticated with
+// Poly1305-AES. Each encrypted file or blob is the random IV, followed
+// by the ciphertext, followed by the MAC of the ciphertext.
+//
+// The keys are stored in key files, encrypted with a key derived from
+// the repository password using scrypt.
+
+const (
+	ivSize  = aes.BlockSize
+	macSize = 16
+
+	// overhead is the number of bytes that encryption adds.
+	overhead = ivSize + macSize
+)
+
+// errInvalidMAC is returned when decrypting data that fails authentication, such as with the wrong password.
+var errInvalidMAC = errors.New("ciphertext verification failed")
+
+// macKey is the key for Poly1305-AES.
+type macKey struct {
+	K []byte `json:"k"`
+	R []byte `json:"r"`
+}
+
+// key holds the encryption and authentication keys.
+type key struct {
+	MAC     macKey `json:"mac"`
+	Encrypt []byte `json:"encrypt"`
+}
+
+// newRandomKey generates a new random key.
+func newRandomKey() (*key, error) {
+	buf := make([]byte, 64)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failure generating a random key: %w", err)
+	}
+	return keyFromBytes(buf), nil
+}
+
+// keyFromBytes splits 64 bytes into the encryption key and the two halves of the MAC key.
+func keyFromBytes(buf []byte) *key {
+	k := &key{
+		Encrypt: append([]byte(nil), buf[:32]...),
+		MAC: macKey{
+			K: append([]byte(nil), buf[32:48]...),
+			R: append([]byte(nil), buf[48:64]...),
+		},
+	}
+	k.MAC.mask()
+	return k
+}
+
+// poly1305RMask clears the bits of `r` that Poly1305 requires to be clear.
+var poly1305RMask = [16]byte{0xff, 0xff, 0xff, 0x0f, 0xfc, 0xff, 0xff, 0x0f, 0xfc, 0xff, 0xff, 0x0f, 0xfc, 0xff, 0xff, 0x0f}
+
+func (m *macKey) mask() {
+	for i := range m.R {
+		m.R[i] &= poly1305RMask[i]
+	}
+}
+
+// valid reports whether or not the key has the expected sizes.
+func (k *key) valid() bool {
+	return len(k.Encrypt) == 32 && len(k.MAC.K) == 16 && len(k.MAC.R) == 16
+}
+
+// poly1305Key returns the one-time Poly1305 key for the nonce `iv`,
+// which is `R` followed by the encryption of the nonce with `K`.
+func (m *macKey) poly1305Key(iv []byte) (*[32]byte, error) {
+	c, err := aes.NewCipher(m.K)
+	if err != nil {
+		return nil, err
+	}
+	var k [32]byte
+	copy(k[:16], m.R)
+	c.Encrypt(k[16:], iv)
+	return &k, nil
+}
+
+// mac computes the Poly1305-AES MAC of `msg` using the nonce `iv`.
+func (m *macKey) mac(iv, msg []byte) ([]byte, error) {
+	k, err := m.poly1305Key(iv)
+	if err != nil {
+		return nil, err
+	}
+	var tag [macSize]byte
+	poly1305.Sum(&tag, msg, k)
+	return tag[:], nil
+}
+
+// verify reports whether or not `tag` is the Poly1305-AES MAC of `msg` using the nonce `iv`.
+func (m *macKey) verify(iv, msg, tag []byte) (bool, error) {
+	k, err := m.poly1305Key(iv)
+	if err != nil {
+		return false, err
+	}
+	var expected [macSize]byte
+	copy(expected[:], tag)
+	return poly1305.Verify(&expected, msg, k), nil
+}
+
+// seal encrypts and authenticates `plaintext` with a new random IV.
+func (k *key) seal(plaintext []byte) ([]byte, error) {
+	out := make([]byte, ivSize, len(plaintext)+overhead)
+	if _, err := rand.Read(out); err != nil {
+		return nil, fmt.Errorf("failure generating a random IV: %w", err)
+	}
+	c, err := aes.NewCipher(k.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(c, out[:ivSize]).XORKeyStream(ciphertext, plaintext)
+	mac, err := k.MAC.mac(out[:ivSize], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, ciphertext...)
+	return append(out, mac...), nil
+}
+
+// open authenticates and decrypts data encrypted by `seal`.
+func (k *key) open(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < overhead {
+		return nil, fmt.Errorf("encrypted data of %d bytes is too short", len(encrypted))
+	}
+	iv, ciphertext, mac := encrypted[:ivSize], encrypted[ivSize:len(encrypted)-macSize], encrypted[len(encrypted)-macSize:]
+	if ok, err := k.MAC.verify(iv, ciphertext, mac); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errInvalidMAC
+	}
+	c, err := aes.NewCipher(k.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(c, iv).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package restic exports snapshots into restic backup repositories.
+//
+// This lets the history archived by rvcs be copied into an existing
+// restic setup, and restored or browsed with restic, without first
+// restoring the snapshots to the filesystem and backing them up again.
+//
+// File contents are split into fixed size chunks and stored as blobs
+// named by their SHA-256 hash, so contents that are shared between
+// files, or that are already in the repository, are only stored once.
+package restic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	// chunkSize is the size of the chunks that file contents are split into.
+	chunkSize = 1 << 20
+
+	// exportTag is the tag added to every exported restic snapshot.
+	exportTag = "rvcs"
+
+	// snapshotTagPrefix prefixes the tag that records which rvcs snapshot a restic snapshot was exported from.
+	snapshotTagPrefix = "rvcs-snapshot="
+)
+
+// node is an entry in a restic tree.
+type node struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Mode       os.FileMode `json:"mode,omitempty"`
+	ModTime    time.Time   `json:"mtime,omitempty"`
+	AccessTime time.Time   `json:"atime,omitempty"`
+	ChangeTime time.Time   `json:"ctime,omitempty"`
+	UID        uint32      `json:"uid"`
+	GID        uint32      `json:"gid"`
+	Size       uint64      `json:"size,omitempty"`
+	LinkTarget string      `json:"linktarget,omitempty"`
+	Content    []id        `json:"content"`
+	Subtree    *id         `json:"subtree,omitempty"`
+}
+
+// tree is the contents of a tree blob, with the nodes sorted by name.
+type tree struct {
+	Nodes []*node `json:"nodes"`
+}
+
+// resticSnapshot is the contents of a file in the `snapshots` directory.
+type resticSnapshot struct {
+	Time     time.Time `json:"time"`
+	Tree     *id       `json:"tree"`
+	Paths    []string  `json:"paths"`
+	Hostname string    `json:"hostname,omitempty"`
+	Username string    `json:"username,omitempty"`
+	UID      uint32    `json:"uid,omitempty"`
+	GID      uint32    `json:"gid,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// Exported reports whether or not a restic snapshot was previously exported from the snapshot `h`.
+func (r *Repository) Exported(h *snapshot.Hash) bool {
+	_, ok := r.exported[h.String()]
+	return ok
+}
+
+// Export writes the snapshot `h` of the path `p` to the repository as a new restic snapshot, and returns its ID.
+//
+// As with restic's own backups of an absolute path, the snapshot's
+// root tree holds a directory for each parent of `p`. The restic
+// snapshot is tagged with "rvcs" and with the hash of `h`.
+//
+// Snapshots do not record the owners or access times of files, so the
+// exported files are owned by the current user, and every time of a
+// file is set to the modification time recorded for a directory, or
+// otherwise to the time the snapshot of the file was generated.
+// Symbolic links that were broken when snapshotted are left out.
+func (r *Repository) Export(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash) (string, error) {
+	e := &exporter{
+		s:   s,
+		r:   r,
+		uid: currentID(os.Getuid()),
+		gid: currentID(os.Getgid()),
+	}
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return "", fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	snapshotTime, ok := f.Time()
+	if !ok {
+		snapshotTime = time.Now()
+	}
+	parents := strings.Split(strings.Trim(filepath.ToSlash(string(p)), "/"), "/")
+	name := parents[len(parents)-1]
+	parents = parents[:len(parents)-1]
+	n, err := e.node(ctx, name, h)
+	if err != nil {
+		return "", err
+	}
+	var nodes []*node
+	if n != nil {
+		nodes = append(nodes, n)
+	}
+	root, err := e.saveTree(nodes)
+	if err != nil {
+		return "", err
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		if parents[i] == "" {
+			continue
+		}
+		subtree := root
+		parent := e.newNode(parents[i], snapshotTime)
+		parent.Type, parent.Mode, parent.Subtree = "dir", os.ModeDir|0755, &subtree
+		if root, err = e.saveTree([]*node{parent}); err != nil {
+			return "", err
+		}
+	}
+	if err := r.flush(); err != nil {
+		return "", err
+	}
+	sn := &resticSnapshot{
+		Time:  snapshotTime,
+		Tree:  &root,
+		Paths: []string{string(p)},
+		UID:   e.uid,
+		GID:   e.gid,
+		Tags:  []string{exportTag, snapshotTagPrefix + h.String()},
+	}
+	sn.Username, sn.Hostname = currentUser()
+	encoded, err := json.Marshal(sn)
+	if err != nil {
+		return "", fmt.Errorf("failure encoding the restic snapshot: %w", err)
+	}
+	snapshotID, err := r.saveEncrypted("snapshots", encoded)
+	if err != nil {
+		return "", fmt.Errorf("failure writing the restic snapshot: %w", err)
+	}
+	r.exported[h.String()] = struct{}{}
+	return snapshotID.String(), nil
+}
+
+// exporter converts snapshots into restic trees.
+type exporter struct {
+	s        *storage.LocalFiles
+	r        *Repository
+	uid, gid uint32
+}
+
+func (e *exporter) newNode(name string, t time.Time) *node {
+	return &node{
+		Name:       name,
+		ModTime:    t,
+		AccessTime: t,
+		ChangeTime: t,
+		UID:        e.uid,
+		GID:        e.gid,
+	}
+}
+
+// node returns the restic tree node for the snapshot `h`, saving the blobs of its contents.
+//
+// The returned node is nil if the snapshot is of a broken link.
+func (e *exporter) node(ctx context.Context, name string, h *snapshot.Hash) (*node, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := e.s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	t, ok := f.DirectoryTime()
+	if !ok {
+		t, _ = f.Time()
+	}
+	n := e.newNode(name, t)
+	switch {
+	case f.IsDir():
+		contents, err := e.s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return nil, err
+		}
+		var children []string
+		for child := range contents {
+			children = append(children, string(child))
+		}
+		sort.Strings(children)
+		var nodes []*node
+		for _, child := range children {
+			c, err := e.node(ctx, child, contents[snapshot.Path(child)])
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				nodes = append(nodes, c)
+			}
+		}
+		subtree, err := e.saveTree(nodes)
+		if err != nil {
+			return nil, err
+		}
+		n.Type, n.Mode, n.Subtree = "dir", os.ModeDir|f.Permissions(), &subtree
+	case f.IsLink():
+		if f.Contents == nil {
+			return nil, nil
+		}
+		target, err := e.readAll(ctx, f.Contents)
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the target of the link snapshot %q: %w", h, err)
+		}
+		n.Type, n.Mode, n.LinkTarget = "symlink", os.ModeSymlink|0777, string(target)
+	default:
+		n.Type, n.Mode, n.Content = "file", f.Permissions(), []id{}
+		if f.Contents != nil {
+			if n.Content, n.Size, err = e.saveContents(ctx, f); err != nil {
+				return nil, fmt.Errorf("failure exporting the contents of the snapshot %q: %w", h, err)
+			}
+		}
+	}
+	return n, nil
+}
+
+func (e *exporter) readAll(ctx context.Context, h *snapshot.Hash) ([]byte, error) {
+	rc, err := e.s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// saveContents splits the contents of the regular file snapshot `f` into chunks, saves them as data blobs, and returns their IDs and total size.
+//
+// If the file was snapshotted through a content filter, then the
+// contents are passed through the filter's smudge command first, so
+// that the exported file matches the one that would be restored.
+func (e *exporter) saveContents(ctx context.Context, f *snapshot.File) ([]id, uint64, error) {
+	rc, err := e.s.ReadObject(ctx, f.Contents)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+	var contents io.Reader = rc
+	if filterName, ok := f.Metadata[snapshot.FilterMetadataKey]; ok {
+		contentFilter, err := filter.Find(e.s, filterName)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failure looking up the content filter %q: %w", filterName, err)
+		}
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			pw.CloseWithError(contentFilter.Smudge(ctx, rc, pw))
+		}()
+		contents = pr
+	}
+	ids := []id{}
+	var size uint64
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(contents, buf)
+		if n > 0 {
+			blobID, saveErr := e.r.saveBlob(dataBlob, buf[:n])
+			if saveErr != nil {
+				return nil, 0, saveErr
+			}
+			ids = append(ids, blobID)
+			size += uint64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ids, size, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// saveTree saves the nodes, which must be sorted by name, as a tree blob.
+func (e *exporter) saveTree(nodes []*node) (id, error) {
+	if nodes == nil {
+		nodes = []*node{}
+	}
+	encoded, err := json.Marshal(&tree{Nodes: nodes})
+	if err != nil {
+		return id{}, fmt.Errorf("failure encoding a restic tree: %w", err)
+	}
+	return e.r.saveBlob(treeBlob, append(encoded, '\n'))
+}
@@ -0,0 +1,430 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxPackSize is the size after which a pack file is written out and a new one started.
+const maxPackSize = 16 << 20
+
+// id is the SHA-256 hash identifying a blob or a file in a repository.
+type id [sha256.Size]byte
+
+func hashID(data []byte) id {
+	return id(sha256.Sum256(data))
+}
+
+func (i id) String() string {
+	return hex.EncodeToString(i[:])
+}
+
+// MarshalJSON encodes the ID as a hex string.
+func (i id) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON parses an ID encoded by `MarshalJSON`.
+func (i *id) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	bs, err := hex.DecodeString(s)
+	if err != nil || len(bs) != len(i) {
+		return fmt.Errorf("malformed ID %q", s)
+	}
+	copy(i[:], bs)
+	return nil
+}
+
+// blobType is the type of a blob stored in a pack.
+type blobType uint8
+
+const (
+	dataBlob blobType = 0
+	treeBlob blobType = 1
+)
+
+func (t blobType) String() string {
+	if t == treeBlob {
+		return "tree"
+	}
+	return "data"
+}
+
+// MarshalJSON encodes the blob type as a string.
+func (t blobType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON parses a blob type encoded by `MarshalJSON`.
+func (t *blobType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	switch s {
+	case "data":
+		*t = dataBlob
+	case "tree":
+		*t = treeBlob
+	default:
+		return fmt.Errorf("unknown blob type %q", s)
+	}
+	return nil
+}
+
+// indexBlob is the location of a blob within a pack.
+type indexBlob struct {
+	ID     id       `json:"id"`
+	Type   blobType `json:"type"`
+	Offset uint32   `json:"offset"`
+	Length uint32   `json:"length"`
+}
+
+type indexPack struct {
+	ID    id          `json:"id"`
+	Blobs []indexBlob `json:"blobs"`
+}
+
+// index is the contents of a file in the `index` directory, listing the blobs in each pack.
+type index struct {
+	Packs []indexPack `json:"packs"`
+}
+
+// Repository is a restic repository opened for exporting snapshots.
+//
+// New blobs are buffered into pack files, which are only listed in the
+// repository's index once `flush` is called.
+type Repository struct {
+	dir  string
+	key  *key
+	lock string
+
+	// blobs holds the IDs of all of the blobs already in the repository or in the current pack.
+	blobs map[id]struct{}
+
+	// exported holds the rvcs snapshots that restic snapshots were previously exported from.
+	exported map[string]struct{}
+
+	pack        []byte
+	packBlobs   []indexBlob
+	packedSoFar []indexPack
+}
+
+// Open opens the restic repository in the directory `dir`, creating it if it does not exist.
+//
+// Only repositories using version 1 of the restic repository format,
+// which does not compress its contents, are supported. New repositories
+// are created with that version and with a single key for the password.
+func Open(dir, password string) (*Repository, error) {
+	r := &Repository{
+		dir:      dir,
+		blobs:    make(map[id]struct{}),
+		exported: make(map[string]struct{}),
+	}
+	var err error
+	if _, statErr := os.Stat(filepath.Join(dir, "config")); os.IsNotExist(statErr) {
+		err = r.init(password)
+	} else {
+		err = r.load(password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(newLock())
+	if err != nil {
+		return nil, fmt.Errorf("failure encoding the repository lock: %w", err)
+	}
+	lockID, err := r.saveEncrypted("locks", encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failure locking the repository: %w", err)
+	}
+	r.lock = lockID.String()
+	return r, nil
+}
+
+// init creates a new repository.
+func (r *Repository) init(password string) error {
+	for _, sub := range []string{"index", "keys", "locks", "snapshots"} {
+		if err := os.MkdirAll(filepath.Join(r.dir, sub), 0700); err != nil {
+			return fmt.Errorf("failure creating the repository directory %q: %w", sub, err)
+		}
+	}
+	for i := 0; i < 256; i++ {
+		if err := os.MkdirAll(filepath.Join(r.dir, "data", fmt.Sprintf("%02x", i)), 0700); err != nil {
+			return fmt.Errorf("failure creating the repository data directories: %w", err)
+		}
+	}
+	master, err := newRandomKey()
+	if err != nil {
+		return err
+	}
+	r.key = master
+	kf, err := newKeyFile(master, password)
+	if err != nil {
+		return err
+	}
+	encodedKey, err := json.Marshal(kf)
+	if err != nil {
+		return fmt.Errorf("failure encoding the key file: %w", err)
+	}
+	if err := writeFile(filepath.Join(r.dir, "keys", hashID(encodedKey).String()), encodedKey); err != nil {
+		return err
+	}
+	cfg, err := newConfig()
+	if err != nil {
+		return err
+	}
+	encodedConfig, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failure encoding the repository config: %w", err)
+	}
+	sealed, err := r.key.seal(encodedConfig)
+	if err != nil {
+		return err
+	}
+	// The config is written last, since its existence marks the repository as created.
+	return writeFile(filepath.Join(r.dir, "config"), sealed)
+}
+
+// load reads the key, the index, and the snapshots of an existing repository.
+func (r *Repository) load(password string) error {
+	keyFiles, err := os.ReadDir(filepath.Join(r.dir, "keys"))
+	if err != nil {
+		return fmt.Errorf("failure listing the repository keys: %w", err)
+	}
+	for _, entry := range keyFiles {
+		encoded, err := os.ReadFile(filepath.Join(r.dir, "keys", entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failure reading the repository key %q: %w", entry.Name(), err)
+		}
+		var kf keyFile
+		if err := json.Unmarshal(encoded, &kf); err != nil {
+			return fmt.Errorf("failure parsing the repository key %q: %w", entry.Name(), err)
+		}
+		master, err := kf.masterKey(password)
+		if errors.Is(err, errInvalidMAC) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failure decrypting the repository key %q: %w", entry.Name(), err)
+		}
+		r.key = master
+		break
+	}
+	if r.key == nil {
+		return fmt.Errorf("none of the keys of the repository %q match the password", r.dir)
+	}
+	var cfg config
+	if err := r.loadEncrypted(filepath.Join(r.dir, "config"), &cfg); err != nil {
+		return fmt.Errorf("failure reading the repository config: %w", err)
+	}
+	if cfg.Version != repositoryVersion {
+		return fmt.Errorf("unsupported repository version %d; only version %d repositories can be exported to", cfg.Version, repositoryVersion)
+	}
+	if err := r.forEachFile("index", func(path string) error {
+		var idx index
+		if err := r.loadEncrypted(path, &idx); err != nil {
+			return fmt.Errorf("failure reading the repository index %q: %w", path, err)
+		}
+		for _, p := range idx.Packs {
+			for _, b := range p.Blobs {
+				r.blobs[b.ID] = struct{}{}
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return r.forEachFile("snapshots", func(path string) error {
+		var sn resticSnapshot
+		if err := r.loadEncrypted(path, &sn); err != nil {
+			return fmt.Errorf("failure reading the repository snapshot %q: %w", path, err)
+		}
+		for _, tag := range sn.Tags {
+			if strings.HasPrefix(tag, snapshotTagPrefix) {
+				r.exported[strings.TrimPrefix(tag, snapshotTagPrefix)] = struct{}{}
+			}
+		}
+		return nil
+	})
+}
+
+// forEachFile calls `fn` with the path of each file in the repository subdirectory `sub`.
+func (r *Repository) forEachFile(sub string, fn func(path string) error) error {
+	entries, err := os.ReadDir(filepath.Join(r.dir, sub))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failure listing the repository directory %q: %w", sub, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := fn(filepath.Join(r.dir, sub, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadEncrypted reads, decrypts, and parses the JSON file at `path`.
+func (r *Repository) loadEncrypted(path string, v interface{}) error {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.key.open(sealed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// saveEncrypted encrypts `data` and writes it to the repository subdirectory `sub`, named by the hash of the encrypted contents.
+func (r *Repository) saveEncrypted(sub string, data []byte) (id, error) {
+	sealed, err := r.key.seal(data)
+	if err != nil {
+		return id{}, err
+	}
+	fileID := hashID(sealed)
+	return fileID, writeFile(filepath.Join(r.dir, sub, fileID.String()), sealed)
+}
+
+// writeFile atomically writes `data` to the file at `path`.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failure creating a temp file for %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failure writing %q: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failure closing %q: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failure renaming the temp file to %q: %w", path, err)
+	}
+	return nil
+}
+
+// saveBlob adds the blob to the current pack, unless the repository already has it.
+func (r *Repository) saveBlob(t blobType, data []byte) (id, error) {
+	blobID := hashID(data)
+	if _, ok := r.blobs[blobID]; ok {
+		return blobID, nil
+	}
+	sealed, err := r.key.seal(data)
+	if err != nil {
+		return id{}, err
+	}
+	r.packBlobs = append(r.packBlobs, indexBlob{
+		ID:     blobID,
+		Type:   t,
+		Offset: uint32(len(r.pack)),
+		Length: uint32(len(sealed)),
+	})
+	r.pack = append(r.pack, sealed...)
+	r.blobs[blobID] = struct{}{}
+	if len(r.pack) >= maxPackSize {
+		if err := r.writePack(); err != nil {
+			return id{}, err
+		}
+	}
+	return blobID, nil
+}
+
+// writePack writes out the current pack, if it is not empty.
+//
+// A pack is the encrypted blobs, followed by an encrypted header
+// listing the type, encrypted length, and ID of each blob, followed by
+// the length of the encrypted header.
+func (r *Repository) writePack() error {
+	if len(r.packBlobs) == 0 {
+		return nil
+	}
+	var header bytes.Buffer
+	for _, b := range r.packBlobs {
+		header.WriteByte(byte(b.Type))
+		binary.Write(&header, binary.LittleEndian, b.Length)
+		header.Write(b.ID[:])
+	}
+	sealedHeader, err := r.key.seal(header.Bytes())
+	if err != nil {
+		return err
+	}
+	headerLength := make([]byte, 4)
+	binary.LittleEndian.PutUint32(headerLength, uint32(len(sealedHeader)))
+	pack := append(append(r.pack, sealedHeader...), headerLength...)
+	packID := hashID(pack)
+	dir := filepath.Join(r.dir, "data", packID.String()[:2])
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failure creating the repository data directory %q: %w", dir, err)
+	}
+	if err := writeFile(filepath.Join(dir, packID.String()), pack); err != nil {
+		return err
+	}
+	r.packedSoFar = append(r.packedSoFar, indexPack{ID: packID, Blobs: r.packBlobs})
+	r.pack, r.packBlobs = nil, nil
+	return nil
+}
+
+// flush writes out the current pack and an index of all of the packs written since the last flush.
+//
+// Restic ignores packs that are not in the index, so the blobs saved
+// before the flush must not be referenced by a snapshot until it completes.
+func (r *Repository) flush() error {
+	if err := r.writePack(); err != nil {
+		return err
+	}
+	if len(r.packedSoFar) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(&index{Packs: r.packedSoFar})
+	if err != nil {
+		return fmt.Errorf("failure encoding the repository index: %w", err)
+	}
+	if _, err := r.saveEncrypted("index", encoded); err != nil {
+		return fmt.Errorf("failure writing the repository index: %w", err)
+	}
+	r.packedSoFar = nil
+	return nil
+}
+
+// Close releases the lock on the repository.
+//
+// The packs of an export that did not complete are not listed in the
+// index, so restic ignores them until `restic prune` removes them.
+func (r *Repository) Close() error {
+	if err := os.Remove(filepath.Join(r.dir, "locks", r.lock)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure unlocking the repository: %w", err)
+	}
+	return nil
+}
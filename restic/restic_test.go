@@ -0,0 +1,505 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restic
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/filter"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("malformed hex string %q: %v", s, err)
+	}
+	return bs
+}
+
+func TestPoly1305AES(t *testing.T) {
+	// The Poly1305-AES test vectors from http://cr.yp.to/mac/poly1305-20050329.pdf, which restic also tests against.
+	testCases := []struct {
+		Msg, R, K, Nonce, Want string
+	}{
+		{
+			Msg:   "f3f6",
+			R:     "851fc40c3467ac0be05cc20404f3f700",
+			K:     "ec074c835580741701425b623235add6",
+			Nonce: "fb447350c4e868c52ac3275cf9d4327e",
+			Want:  "f4c633c3044fc145f84f335cb81953de",
+		},
+		{
+			R:     "a0f3080000f46400d0c7e9076c834403",
+			K:     "75deaa25c09f208e1dc4ce6b5cad3fbf",
+			Nonce: "61ee09218d29b0aaed7e154a2c5509cc",
+			Want:  "dd3fab2251f11ac759f0887129cc2ee7",
+		},
+		{
+			Msg:   "663cea190ffb83d89593f3f476b6bc24d7e679107ea26adb8caf6652d0656136",
+			R:     "48443d0bb0d21109c89a100b5ce2c208",
+			K:     "6acb5f61a7176dd320c5c1eb2edcdc74",
+			Nonce: "ae212a55399729595dea458bc621ff0e",
+			Want:  "0ee1c16bb73f0f4fd19881753c01cdbe",
+		},
+	}
+	for _, tc := range testCases {
+		m := &macKey{K: mustDecodeHex(t, tc.K), R: mustDecodeHex(t, tc.R)}
+		got, err := m.mac(mustDecodeHex(t, tc.Nonce), mustDecodeHex(t, tc.Msg))
+		if err != nil {
+			t.Errorf("failure computing the MAC of %q: %v", tc.Msg, err)
+		} else if hex.EncodeToString(got) != tc.Want {
+			t.Errorf("unexpected MAC of %q: got %x, want %s", tc.Msg, got, tc.Want)
+		}
+	}
+}
+
+func TestResticKnownAnswers(t *testing.T) {
+	// Data encrypted by restic, taken from its crypto tests.
+	k := &key{
+		Encrypt: mustDecodeHex(t, "303e8687b1d7db18421bdc6bb8588ccadac4d59ee87b8ff70c44e635790cafef"),
+		MAC: macKey{
+			K: mustDecodeHex(t, "ef4d8824cb80b2bcc5fbff8a9b12a42c"),
+			R: mustDecodeHex(t, "cc8d4b948ee0ebfe1d415de921d10353"),
+		},
+	}
+	sealed := mustDecodeHex(t, "69fb41c62d12def4593bd71757138606338f621aeaeb39da0fe4f99233f8037a54ea63338a813bcf3f75d8c3cc75dddf8750")
+	if got, err := k.open(sealed); err != nil {
+		t.Errorf("failure decrypting restic's test data: %v", err)
+	} else if want := "Dies ist ein Test!"; string(got) != want {
+		t.Errorf("unexpected decrypted contents: got %q, want %q", got, want)
+	}
+
+	// The key file and the config of the test repository from restic's checker tests, whose password is "geheim".
+	var kf keyFile
+	if err := json.Unmarshal([]byte(resticTestKeyFile), &kf); err != nil {
+		t.Fatalf("failure parsing restic's test key file: %v", err)
+	}
+	if _, err := kf.masterKey("wrong"); err != errInvalidMAC {
+		t.Errorf("unexpected result of decrypting the key file with the wrong password: %v", err)
+	}
+	master, err := kf.masterKey("geheim")
+	if err != nil {
+		t.Fatalf("failure decrypting restic's test key file: %v", err)
+	}
+	encoded, err := master.open(mustDecodeHex(t, resticTestConfig))
+	if err != nil {
+		t.Fatalf("failure decrypting restic's test config: %v", err)
+	}
+	var cfg config
+	if err := json.Unmarshal(encoded, &cfg); err != nil {
+		t.Fatalf("failure parsing restic's test config %q: %v", encoded, err)
+	}
+	if cfg.Version != repositoryVersion || len(cfg.ID) != 64 || cfg.ChunkerPolynomial.deg() != 53 || !cfg.ChunkerPolynomial.irreducible() {
+		t.Errorf("unexpected contents of restic's test config: %+v", cfg)
+	}
+}
+
+const (
+	resticTestKeyFile = `{"created":"2015-06-28T23:45:50.154375394+02:00","username":"fd0","hostname":"kasimir","kdf":"scrypt","N":65536,"r":8,"p":1,"salt":"Ovrpuil4mvwCuZR2hPq5AMId8D0m1xi/0h3eHMAarMcNmQ5yqtRSOBc9zm7hdzosN0JgNdj53Esm5M57/CvaCQ==","data":"k1sPEhGncmZk9TJz6ByIU3SlBmW7qv1i/tUAL7yPYgbjCHq/Owoelw/PhCgs32m6noLYu4x6VpmzyBmAYGOOy7XicI8dCBYFhSXI6u0offMQRjGc6W2OHumh8gq4UR/MK5QASBg9VXoKaiYgh4o4FQTh5lRO8Ne3qaACDEzGxSD4Kd3YVQdQAhIpAcORiJ5uVwcv8NOybxcF5VUxHxVN3g=="}`
+	resticTestConfig  = "3248decb51efb1b80982c04544a7724ddfbcc1bc12754433fe2be7eae0147dc3ff5cf500ce2a4a41574cd66641fc1c9c013825006449cdf21cba16a14c6d011f2837a8ac301f31f93d9852820ab92efa109c6335bf78f38ab7aa55eca7644295c380730ef9da6e22b6cd3ae6c5924491dd9b7e90ce1f1bf0e14899dd5c2db831f19ac3b5314e2c43691ea098921182c873d1dd844fcececc1bf72a87"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	k, err := newRandomKey()
+	if err != nil {
+		t.Fatalf("failure generating a key: %v", err)
+	}
+	plaintext := []byte("some secret contents")
+	sealed, err := k.seal(plaintext)
+	if err != nil {
+		t.Fatalf("failure encrypting: %v", err)
+	}
+	if got, err := k.open(sealed); err != nil {
+		t.Errorf("failure decrypting: %v", err)
+	} else if !bytes.Equal(got, plaintext) {
+		t.Errorf("unexpected decrypted contents: got %q, want %q", got, plaintext)
+	}
+	sealed[ivSize] ^= 1
+	if _, err := k.open(sealed); err != errInvalidMAC {
+		t.Errorf("unexpected error decrypting modified contents: got %v, want %v", err, errInvalidMAC)
+	}
+}
+
+func TestPolynomials(t *testing.T) {
+	// A known irreducible polynomial of degree 53.
+	irreducible := pol(0x3DA3358B4DC173)
+	if !irreducible.irreducible() {
+		t.Errorf("%x was reported as reducible", uint64(irreducible))
+	}
+	if reducible := irreducible << 1; reducible.irreducible() {
+		t.Errorf("%x was reported as irreducible", uint64(reducible))
+	}
+	p, err := randomPol()
+	if err != nil {
+		t.Fatalf("failure generating a random polynomial: %v", err)
+	}
+	if p.deg() != 53 || !p.irreducible() {
+		t.Errorf("the random polynomial %x is not an irreducible polynomial of degree 53", uint64(p))
+	}
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failure encoding the polynomial: %v", err)
+	}
+	var parsed pol
+	if err := json.Unmarshal(encoded, &parsed); err != nil {
+		t.Errorf("failure parsing the encoded polynomial %s: %v", encoded, err)
+	} else if parsed != p {
+		t.Errorf("unexpected parsed polynomial: got %x, want %x", uint64(parsed), uint64(p))
+	}
+}
+
+// testReader reads the blobs of a repository the way that restic does.
+type testReader struct {
+	t     *testing.T
+	r     *Repository
+	blobs map[id]indexBlob
+	packs map[id]id
+}
+
+func newTestReader(t *testing.T, r *Repository) *testReader {
+	tr := &testReader{t: t, r: r, blobs: make(map[id]indexBlob), packs: make(map[id]id)}
+	if err := r.forEachFile("index", func(path string) error {
+		var idx index
+		if err := r.loadEncrypted(path, &idx); err != nil {
+			return err
+		}
+		for _, p := range idx.Packs {
+			tr.checkPackHeader(p)
+			for _, b := range p.Blobs {
+				tr.blobs[b.ID] = b
+				tr.packs[b.ID] = p.ID
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failure reading the index: %v", err)
+	}
+	return tr
+}
+
+func (tr *testReader) readPack(packID id) []byte {
+	pack, err := os.ReadFile(filepath.Join(tr.r.dir, "data", packID.String()[:2], packID.String()))
+	if err != nil {
+		tr.t.Fatalf("failure reading the pack %s: %v", packID, err)
+	}
+	if hashID(pack) != packID {
+		tr.t.Fatalf("the pack %s does not match its ID", packID)
+	}
+	return pack
+}
+
+// checkPackHeader checks that the header of the pack matches its index entry.
+func (tr *testReader) checkPackHeader(p indexPack) {
+	pack := tr.readPack(p.ID)
+	headerLength := int(binary.LittleEndian.Uint32(pack[len(pack)-4:]))
+	header, err := tr.r.key.open(pack[len(pack)-4-headerLength : len(pack)-4])
+	if err != nil {
+		tr.t.Fatalf("failure decrypting the header of the pack %s: %v", p.ID, err)
+	}
+	const entrySize = 1 + 4 + len(id{})
+	if len(header) != entrySize*len(p.Blobs) {
+		tr.t.Fatalf("unexpected header size for the pack %s: got %d, want %d", p.ID, len(header), entrySize*len(p.Blobs))
+	}
+	for i, b := range p.Blobs {
+		entry := header[i*entrySize:]
+		if blobType(entry[0]) != b.Type || binary.LittleEndian.Uint32(entry[1:]) != b.Length || !bytes.Equal(entry[5:entrySize], b.ID[:]) {
+			tr.t.Errorf("the header entry %d of the pack %s does not match the index entry %+v", i, p.ID, b)
+		}
+	}
+}
+
+func (tr *testReader) blob(blobID id, t blobType) []byte {
+	b, ok := tr.blobs[blobID]
+	if !ok || b.Type != t {
+		tr.t.Fatalf("the %s blob %s is not in the index", t, blobID)
+	}
+	pack := tr.readPack(tr.packs[blobID])
+	contents, err := tr.r.key.open(pack[b.Offset : b.Offset+b.Length])
+	if err != nil {
+		tr.t.Fatalf("failure decrypting the blob %s: %v", blobID, err)
+	}
+	if hashID(contents) != blobID {
+		tr.t.Fatalf("the blob %s does not match its ID", blobID)
+	}
+	return contents
+}
+
+func (tr *testReader) tree(treeID id) map[string]*node {
+	var parsed tree
+	if err := json.Unmarshal(tr.blob(treeID, treeBlob), &parsed); err != nil {
+		tr.t.Fatalf("failure parsing the tree %s: %v", treeID, err)
+	}
+	nodes := make(map[string]*node)
+	for _, n := range parsed.Nodes {
+		nodes[n.Name] = n
+	}
+	return nodes
+}
+
+// createTrackedDirForTest populates the directory `tracked` with example files and returns their contents.
+//
+// The directory also contains a symbolic link named "link" to "small.txt".
+func createTrackedDirForTest(t *testing.T, tracked string) map[string]string {
+	if err := os.MkdirAll(filepath.Join(tracked, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the tracked dir: %v", err)
+	}
+	large := strings.Repeat("x", 2*chunkSize+10)
+	files := map[string]string{
+		"small.txt":     "hello",
+		"sub/large.txt": large,
+		"copy.txt":      large,
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(tracked, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating %q: %v", name, err)
+		}
+	}
+	if err := os.Symlink("small.txt", filepath.Join(tracked, "link")); err != nil {
+		t.Fatalf("failure creating the symbolic link: %v", err)
+	}
+	return files
+}
+
+func TestExport(t *testing.T) {
+	defaultN, defaultR := scryptN, scryptR
+	scryptN, scryptR = 16, 1
+	defer func() { scryptN, scryptR = defaultN, defaultR }()
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	tracked := filepath.Join(dir, "tracked")
+	files := createTrackedDirForTest(t, tracked)
+	large := files["copy.txt"]
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(tracked))
+	if err != nil {
+		t.Fatalf("failure snapshotting the tracked dir: %v", err)
+	}
+
+	repoDir := filepath.Join(dir, "repo")
+	r, err := Open(repoDir, "secret")
+	if err != nil {
+		t.Fatalf("failure creating the repository: %v", err)
+	}
+	snapshotID, err := r.Export(ctx, s, snapshot.Path(tracked), h)
+	if err != nil {
+		t.Fatalf("failure exporting the snapshot: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("failure closing the repository: %v", err)
+	}
+	if locks, err := os.ReadDir(filepath.Join(repoDir, "locks")); err != nil || len(locks) != 0 {
+		t.Errorf("the repository was not unlocked: %v, %v", locks, err)
+	}
+
+	if _, err := Open(repoDir, "wrong"); err == nil {
+		t.Error("opened the repository with the wrong password")
+	}
+	r, err = Open(repoDir, "secret")
+	if err != nil {
+		t.Fatalf("failure reopening the repository: %v", err)
+	}
+	defer r.Close()
+	if !r.Exported(h) {
+		t.Errorf("the snapshot %q was not recorded as exported", h)
+	}
+	var sn resticSnapshot
+	if err := r.loadEncrypted(filepath.Join(repoDir, "snapshots", snapshotID), &sn); err != nil {
+		t.Fatalf("failure reading the restic snapshot: %v", err)
+	}
+	if len(sn.Paths) != 1 || sn.Paths[0] != tracked {
+		t.Errorf("unexpected snapshot paths: got %q, want [%q]", sn.Paths, tracked)
+	}
+
+	tr := newTestReader(t, r)
+	root := *sn.Tree
+	for _, parent := range strings.Split(strings.Trim(filepath.ToSlash(tracked), "/"), "/") {
+		n, ok := tr.tree(root)[parent]
+		if !ok || n.Type != "dir" || n.Subtree == nil {
+			t.Fatalf("missing the directory %q in the exported snapshot", parent)
+		}
+		root = *n.Subtree
+	}
+	readFile := func(tree map[string]*node, name string) string {
+		n, ok := tree[name]
+		if !ok || n.Type != "file" {
+			t.Fatalf("missing the file %q in the exported snapshot", name)
+		}
+		var contents []byte
+		for _, blobID := range n.Content {
+			contents = append(contents, tr.blob(blobID, dataBlob)...)
+		}
+		if n.Size != uint64(len(contents)) {
+			t.Errorf("unexpected size for %q: got %d, want %d", name, n.Size, len(contents))
+		}
+		return string(contents)
+	}
+	top := tr.tree(root)
+	if got := readFile(top, "small.txt"); got != files["small.txt"] {
+		t.Errorf("unexpected contents for small.txt: got %q, want %q", got, files["small.txt"])
+	}
+	if got := readFile(top, "copy.txt"); got != large {
+		t.Errorf("unexpected contents for copy.txt: got %d bytes, want %d", len(got), len(large))
+	}
+	if n := top["link"]; n == nil || n.Type != "symlink" || n.LinkTarget != "small.txt" {
+		t.Errorf("unexpected node for the symbolic link: %+v", n)
+	}
+	sub := top["sub"]
+	if sub == nil || sub.Type != "dir" || sub.Mode != os.ModeDir|0700 {
+		t.Fatalf("unexpected node for the subdirectory: %+v", sub)
+	}
+	if got := readFile(tr.tree(*sub.Subtree), "large.txt"); got != large {
+		t.Errorf("unexpected contents for sub/large.txt: got %d bytes, want %d", len(got), len(large))
+	}
+	// The full chunks of the large files are identical, so only one of them, the final chunk, and the small file are stored.
+	var dataBlobs int
+	for _, b := range tr.blobs {
+		if b.Type == dataBlob {
+			dataBlobs++
+		}
+	}
+	if want := 3; dataBlobs != want {
+		t.Errorf("unexpected number of data blobs: got %d, want %d", dataBlobs, want)
+	}
+}
+
+func TestExportFilteredContents(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("the `tr` command is not available")
+	}
+	defaultN, defaultR := scryptN, scryptR
+	scryptN, scryptR = 16, 1
+	defer func() { scryptN, scryptR = defaultN, defaultR }()
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := os.MkdirAll(filepath.Dir(s.ConfigFile("filters")), 0700); err != nil {
+		t.Fatalf("failure creating the config dir: %v", err)
+	}
+	config := "upper\t*.txt\ttr a-z A-Z\ttr A-Z a-z\n"
+	if err := os.WriteFile(s.ConfigFile("filters"), []byte(config), 0600); err != nil {
+		t.Fatalf("failure writing the filters config: %v", err)
+	}
+	file := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(file, []byte("hello, world"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	filterOpt, err := filter.SnapshotOption(s)
+	if err != nil {
+		t.Fatalf("failure loading the filters: %v", err)
+	}
+	h, f, err := snapshot.NewSnapshotter(s, filterOpt).Snapshot(ctx, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if _, ok := f.Metadata[snapshot.FilterMetadataKey]; !ok {
+		t.Fatalf("the example file was not snapshotted through the filter: %v", f.Metadata)
+	}
+
+	r, err := Open(filepath.Join(dir, "repo"), "secret")
+	if err != nil {
+		t.Fatalf("failure creating the repository: %v", err)
+	}
+	defer r.Close()
+	snapshotID, err := r.Export(ctx, s, snapshot.Path(file), h)
+	if err != nil {
+		t.Fatalf("failure exporting the snapshot: %v", err)
+	}
+	var sn resticSnapshot
+	if err := r.loadEncrypted(filepath.Join(r.dir, "snapshots", snapshotID), &sn); err != nil {
+		t.Fatalf("failure reading the restic snapshot: %v", err)
+	}
+	tr := newTestReader(t, r)
+	root := *sn.Tree
+	parents := strings.Split(strings.Trim(filepath.ToSlash(dir), "/"), "/")
+	for _, parent := range parents {
+		root = *tr.tree(root)[parent].Subtree
+	}
+	n := tr.tree(root)["example.txt"]
+	if n == nil || n.Type != "file" {
+		t.Fatalf("missing the example file in the exported snapshot")
+	}
+	var contents []byte
+	for _, blobID := range n.Content {
+		contents = append(contents, tr.blob(blobID, dataBlob)...)
+	}
+	if got, want := string(contents), "hello, world"; got != want {
+		t.Errorf("unexpected exported contents: got %q, want %q", got, want)
+	}
+}
+
+// TestResticInterop checks an exported repository with the restic command, if it is installed.
+func TestResticInterop(t *testing.T) {
+	resticPath, err := exec.LookPath("restic")
+	if err != nil {
+		t.Skip("the restic command is not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	tracked := filepath.Join(dir, "tracked")
+	files := createTrackedDirForTest(t, tracked)
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(tracked))
+	if err != nil {
+		t.Fatalf("failure snapshotting the tracked dir: %v", err)
+	}
+	repoDir := filepath.Join(dir, "repo")
+	r, err := Open(repoDir, "secret")
+	if err != nil {
+		t.Fatalf("failure creating the repository: %v", err)
+	}
+	if _, err := r.Export(ctx, s, snapshot.Path(tracked), h); err != nil {
+		t.Fatalf("failure exporting the snapshot: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("failure closing the repository: %v", err)
+	}
+
+	restored := filepath.Join(dir, "restored")
+	for _, args := range [][]string{
+		{"check", "--read-data"},
+		{"restore", "latest", "--target", restored},
+		// Restic must also be able to add its own backups to the exported repository.
+		{"backup", tracked},
+		{"check"},
+	} {
+		cmd := exec.Command(resticPath, append([]string{"--no-cache", "-r", repoDir}, args...)...)
+		cmd.Env = append(os.Environ(), "RESTIC_PASSWORD=secret")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failure running restic %q: %v\n%s", args, err, out)
+		}
+	}
+	restoredDir := filepath.Join(restored, tracked)
+	for name, want := range files {
+		if got, err := os.ReadFile(filepath.Join(restoredDir, name)); err != nil {
+			t.Errorf("failure reading the restored file %q: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("unexpected contents for the restored file %q: got %d bytes, want %d", name, len(got), len(want))
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(restoredDir, "link")); err != nil || target != "small.txt" {
+		t.Errorf("unexpected restored symbolic link: %q, %v", target, err)
+	}
+}
@@ -19,19 +19,70 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/google/recursive-version-control-system/command"
+	"github.com/google/recursive-version-control-system/resources"
 	"github.com/google/recursive-version-control-system/storage"
+	"github.com/google/recursive-version-control-system/stores"
 )
 
+// storeFlag removes the global --store flag from the given arguments, if
+// it is given before the subcommand, and returns its value.
+func storeFlag(args []string) (string, []string) {
+	if len(args) < 2 || !strings.HasPrefix(args[1], "-") {
+		return "", args
+	}
+	flag := strings.TrimPrefix(strings.TrimPrefix(args[1], "-"), "-")
+	if strings.HasPrefix(flag, "store=") {
+		return strings.TrimPrefix(flag, "store="), append([]string{args[0]}, args[2:]...)
+	}
+	if flag == "store" && len(args) > 2 {
+		return args[2], append([]string{args[0]}, args[3:]...)
+	}
+	return "", args
+}
+
 func main() {
-	home, err := os.UserHomeDir()
+	root, err := stores.Root()
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	selected, args := storeFlag(os.Args)
+	store, err := stores.Select(root, selected)
 	if err != nil {
-		log.Fatalf("failure resolving the user's home dir: %v\n", err)
+		log.Fatalf("failure selecting the store: %v\n", err)
 	}
-	s := &storage.LocalFiles{filepath.Join(home, ".rvcs/archive")}
+	s := &storage.LocalFiles{ArchiveDir: store.Dir}
+	if s.Shared() {
+		s.UserDir = stores.UserDir(root, store.Dir)
+	}
+	if baseDirs := os.Getenv("RVCS_BASE_ARCHIVES"); len(baseDirs) > 0 {
+		s.BaseArchiveDirs = filepath.SplitList(baseDirs)
+	}
+	if size := os.Getenv("RVCS_OBJECT_CACHE_SIZE"); len(size) > 0 {
+		s.ObjectCacheSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			log.Fatalf("failure parsing the RVCS_OBJECT_CACHE_SIZE environment variable: %v\n", err)
+		}
+	}
+	if level := os.Getenv("RVCS_CACHE_VALIDATION"); len(level) > 0 {
+		s.CacheValidation, err = storage.ParseCacheValidation(level)
+		if err != nil {
+			log.Fatalf("failure parsing the RVCS_CACHE_VALIDATION environment variable: %v\n", err)
+		}
+	}
+	budget, err := resources.Load(s)
+	if err != nil {
+		log.Fatalf("failure loading the resource settings: %v\n", err)
+	}
+	s.CacheMemory = budget.CacheMemory()
 	ctx := context.Background()
 
-	ret := command.Run(ctx, s, os.Args)
+	ret := command.Run(ctx, s, args)
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("failure writing the path info cache: %v\n", err)
+	}
 	os.Exit(ret)
 }
@@ -0,0 +1,235 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scan defines scanners that inspect the contents of files as
+// they are snapshotted, such as virus or secret scanners, and the reports
+// of their findings that are attached to snapshots.
+//
+// Scanners are external commands configured per archive. Each one reads
+// the contents of a file from its standard input, and writes one line to
+// its standard output for each finding. A line holds the rule that was
+// matched and a message describing the finding, separated by a tab; a
+// line without a tab is a message for a rule named after the scanner.
+// The path of the scanned file is passed in the RVCS_SCAN_PATH environment
+// variable. Scanners that exit with a non-zero status fail the snapshot.
+package scan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const scannersConfig = "scanners"
+
+// Scanner is an external command that scans file contents.
+type Scanner struct {
+	// ScannerName is the name used to refer to the scanner.
+	//
+	// This is recorded in each of the findings the scanner reports.
+	ScannerName string
+
+	// Pattern is matched against the base name of each file to determine
+	// whether or not the scanner applies to it.
+	//
+	// The pattern syntax is that of `filepath.Match`.
+	Pattern string
+
+	// Command is the command run to scan a file.
+	Command string
+}
+
+// Name implements the `snapshot.Scanner` interface.
+func (sc *Scanner) Name() string {
+	return sc.ScannerName
+}
+
+// Matches implements the `snapshot.Scanner` interface.
+func (sc *Scanner) Matches(p snapshot.Path) bool {
+	matched, err := filepath.Match(sc.Pattern, filepath.Base(string(p)))
+	return err == nil && matched
+}
+
+// Scan implements the `snapshot.Scanner` interface.
+func (sc *Scanner) Scan(ctx context.Context, p snapshot.Path, r io.Reader) ([]snapshot.Finding, error) {
+	fields := strings.Fields(sc.Command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no command specified for the scanner %q", sc.ScannerName)
+	}
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Env = append(os.Environ(), "RVCS_SCAN_PATH="+string(p))
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the output of the command %q: %w", sc.Command, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failure running the command %q: %w", sc.Command, err)
+	}
+	var findings []snapshot.Finding
+	lines := bufio.NewScanner(out)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if len(line) == 0 {
+			continue
+		}
+		rule, message, ok := strings.Cut(line, "\t")
+		if !ok {
+			rule, message = sc.ScannerName, line
+		}
+		findings = append(findings, snapshot.Finding{Rule: rule, Message: message})
+	}
+	readErr := lines.Err()
+	if readErr != nil {
+		// Let the command finish rather than blocking on its output.
+		io.Copy(io.Discard, out)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("failure running the command %q: %w", sc.Command, err)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failure reading the output of the command %q: %w", sc.Command, readErr)
+	}
+	return findings, nil
+}
+
+func (sc *Scanner) String() string {
+	return strings.Join([]string{sc.ScannerName, sc.Pattern, sc.Command}, "\t")
+}
+
+func parseScanner(line string) (*Scanner, error) {
+	parts := strings.Split(line, "\t")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed scanner %q", line)
+	}
+	if _, err := filepath.Match(parts[1], ""); err != nil {
+		return nil, fmt.Errorf("malformed pattern in the scanner %q: %w", line, err)
+	}
+	return &Scanner{
+		ScannerName: parts[0],
+		Pattern:     parts[1],
+		Command:     parts[2],
+	}, nil
+}
+
+// ReadScanners reads the scanners configured for the given archive.
+//
+// The config file has one scanner per line, with the name, pattern, and
+// command of the scanner separated by tabs. Every scanner matching a
+// path is run on it.
+func ReadScanners(s *storage.LocalFiles) ([]*Scanner, error) {
+	bs, err := s.ReadCommandConfig(scannersConfig)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured scanners: %w", err)
+	}
+	var scanners []*Scanner
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sc, err := parseScanner(line)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, sc)
+	}
+	return scanners, nil
+}
+
+// SnapshotOption returns an option for running the configured scanners when snapshotting.
+func SnapshotOption(s *storage.LocalFiles) (snapshot.Option, error) {
+	scanners, err := ReadScanners(s)
+	if err != nil {
+		return nil, err
+	}
+	var snapshotScanners []snapshot.Scanner
+	for _, sc := range scanners {
+		snapshotScanners = append(snapshotScanners, sc)
+	}
+	return snapshot.WithScanners(snapshotScanners...), nil
+}
+
+// reportHeader is the first line of every report, identifying it as a report of findings.
+const reportHeader = "rvcs scan findings"
+
+// FormatReport returns the report listing the given findings.
+//
+// After a header line, the report has one line per finding, with the
+// scanner, rule, contents hash, quoted path, and message of the finding
+// separated by tabs.
+func FormatReport(findings []snapshot.Finding) string {
+	lines := []string{reportHeader}
+	for _, f := range findings {
+		message := strings.Join(strings.Fields(f.Message), " ")
+		lines = append(lines, strings.Join([]string{f.Scanner, f.Rule, f.Contents.String(), strconv.Quote(string(f.Path)), message}, "\t"))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ParseReport parses a report generated by `FormatReport`.
+func ParseReport(report string) ([]snapshot.Finding, error) {
+	lines := strings.Split(strings.TrimSuffix(report, "\n"), "\n")
+	if lines[0] != reportHeader {
+		return nil, fmt.Errorf("%w: not a report of findings", storage.ErrCorrupt)
+	}
+	var findings []snapshot.Finding
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, "\t", 5)
+		if len(parts) != 5 {
+			return nil, fmt.Errorf("%w: malformed finding %q", storage.ErrCorrupt, line)
+		}
+		contents, err := snapshot.ParseHash(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed contents hash in the finding %q: %v", storage.ErrCorrupt, line, err)
+		}
+		p, err := strconv.Unquote(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed path in the finding %q: %v", storage.ErrCorrupt, line, err)
+		}
+		findings = append(findings, snapshot.Finding{
+			Scanner:  parts[0],
+			Rule:     parts[1],
+			Contents: contents,
+			Path:     snapshot.Path(p),
+			Message:  parts[4],
+		})
+	}
+	return findings, nil
+}
+
+// Attach stores a report of the given findings and attaches it as a note to the snapshot `h`.
+//
+// The returned value is the hash of the stored report.
+func Attach(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash, findings []snapshot.Finding) (*snapshot.Hash, error) {
+	report, err := s.StoreObject(ctx, strings.NewReader(FormatReport(findings)))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the report of findings for %q: %w", h, err)
+	}
+	if err := s.AddNote(ctx, h, report); err != nil {
+		return nil, fmt.Errorf("failure attaching the report of findings to %q: %w", h, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/scan"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestCommandScanner(t *testing.T) {
+	if _, err := exec.LookPath("grep"); err != nil {
+		t.Skip("the `grep` command is not available")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := os.MkdirAll(filepath.Dir(s.ConfigFile("scanners")), 0700); err != nil {
+		t.Fatalf("failure creating the config dir: %v", err)
+	}
+	config := "# Reports lines assigning passwords\npasswords\t*.env\tgrep password=\n"
+	if err := os.WriteFile(s.ConfigFile("scanners"), []byte(config), 0600); err != nil {
+		t.Fatalf("failure writing the scanners config: %v", err)
+	}
+	root := filepath.Join(dir, "example")
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	files := map[string]string{
+		"app.env":   "user=alice\npassword=hunter2\n",
+		"notes.txt": "password=not scanned\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	scanOpt, err := scan.SnapshotOption(s)
+	if err != nil {
+		t.Fatalf("failure loading the scanners: %v", err)
+	}
+	sn := snapshot.NewSnapshotter(s, scanOpt)
+	h, _, err := sn.Snapshot(ctx, snapshot.Path(root))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example dir: %v", err)
+	}
+	findings := sn.Findings()
+	if len(findings) != 1 {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+	if got, want := findings[0], (snapshot.Finding{
+		Scanner:  "passwords",
+		Path:     snapshot.Path(filepath.Join(root, "app.env")),
+		Contents: findings[0].Contents,
+		Rule:     "passwords",
+		Message:  "password=hunter2",
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected finding: got %+v, want %+v", got, want)
+	}
+
+	report, err := scan.Attach(ctx, s, h, findings)
+	if err != nil {
+		t.Fatalf("failure attaching the findings: %v", err)
+	}
+	notes, err := s.ListNotes(ctx, h)
+	if err != nil {
+		t.Fatalf("failure listing the notes: %v", err)
+	}
+	if len(notes) != 1 || !notes[0].Equal(report) {
+		t.Errorf("unexpected notes: got %v, want [%v]", notes, report)
+	}
+	reader, err := s.ReadObject(ctx, report)
+	if err != nil {
+		t.Fatalf("failure reading the report: %v", err)
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failure reading the report: %v", err)
+	}
+	parsed, err := scan.ParseReport(string(contents))
+	if err != nil {
+		t.Fatalf("failure parsing the report: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, findings) {
+		t.Errorf("unexpected parsed report: got %+v, want %+v", parsed, findings)
+	}
+
+	// Files with findings are not cached, so they are scanned again.
+	sn = snapshot.NewSnapshotter(s, scanOpt)
+	if _, _, err := sn.Snapshot(ctx, snapshot.Path(root)); err != nil {
+		t.Fatalf("failure snapshotting the example dir again: %v", err)
+	}
+	if got := sn.Findings(); len(got) != 1 {
+		t.Errorf("unexpected findings when snapshotting again: %+v", got)
+	}
+}
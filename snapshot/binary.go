@@ -0,0 +1,596 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The binary format encodes `File` and `Tree` objects using a subset of
+// CBOR (RFC 8949), which is more compact and faster to parse than the
+// text formats.
+//
+// Every binary object starts with the CBOR self-described tag (55799),
+// which cannot start an object in any of the text formats, so parsers
+// detect the encoding from it and archives can freely mix objects in
+// binary and text formats. The tag is followed by a two element array
+// of the format version and the body of the object:
+//
+//  1. The body of a file is a map with the text keys "c" (the contents
+//     hash), "d" (the metadata, as a map from text keys to text values),
+//     "m" (the mode), "p" (an array of the parent hashes), and "x" (an
+//     array of the extension field lines), in that order. Metadata,
+//     parents, and extension fields are omitted if there are none.
+//  2. The body of a tree is a map with the text key "e", holding an
+//     indefinite-length map from the names of the entries, as byte
+//     strings, to their hashes. The entries are sorted in the same
+//     order as in the text formats, so trees can be encoded
+//     incrementally from the same sorted runs.
+//  3. Each hash is a two element array of the name of the hash function
+//     and the raw bytes of the hash.
+//
+// Integers and lengths always use their shortest encoding, so the
+// encodings are canonical. Any other keys in the body of an object are
+// ignored, so that newer versions of rvcs can add fields.
+
+// binaryMagic is the encoding of the CBOR self-described tag that starts every binary object.
+const binaryMagic = "\xd9\xd9\xf7"
+
+// CBOR major types, shifted into the high bits of the initial byte.
+const (
+	cborUint   byte = 0 << 5
+	cborNegInt byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborTag    byte = 6 << 5
+
+	// cborIndefinite is the additional information for indefinite-length items.
+	cborIndefinite byte = 31
+
+	// cborBreak ends an indefinite-length item.
+	cborBreak byte = 0xff
+)
+
+// Keys of the body of binary objects.
+const (
+	binaryContentsKey   = "c"
+	binaryMetadataKey   = "d"
+	binaryModeKey       = "m"
+	binaryParentsKey    = "p"
+	binaryExtensionsKey = "x"
+	binaryEntriesKey    = "e"
+)
+
+// isBinary reports whether or not the encoded object is in the binary format.
+func isBinary(encoded string) bool {
+	return strings.HasPrefix(encoded, binaryMagic)
+}
+
+// appendCBORHead appends the initial bytes of a CBOR item of the given major type and argument.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(b, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	b = append(b, major|27)
+	for shift := 56; shift >= 0; shift -= 8 {
+		b = append(b, byte(n>>uint(shift)))
+	}
+	return b
+}
+
+// appendCBORString appends a CBOR byte or text string.
+func appendCBORString(b []byte, major byte, s string) []byte {
+	return append(appendCBORHead(b, major, uint64(len(s))), s...)
+}
+
+// appendBinaryHash appends the binary encoding of a hash.
+func appendBinaryHash(b []byte, h *Hash) []byte {
+	// The hex contents of every hash are validated when it is parsed.
+	digest, _ := hex.DecodeString(h.hexContents)
+	b = appendCBORHead(b, cborArray, 2)
+	b = appendCBORString(b, cborText, h.function)
+	return appendCBORString(b, cborBytes, string(digest))
+}
+
+// binaryHeader returns the start of a binary object in the given format version, up to its body.
+func binaryHeader(v FormatVersion) []byte {
+	b := append([]byte(binaryMagic), cborArray|2)
+	return appendCBORHead(b, cborUint, uint64(v))
+}
+
+// encodeBinaryFile encodes a file in the binary format.
+func encodeBinaryFile(f *File) string {
+	var parents []*Hash
+	for _, parent := range f.Parents {
+		if parent != nil {
+			parents = append(parents, parent)
+		}
+	}
+	var keys []string
+	for key := range f.Metadata {
+		if validMetadataKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	// Sorting the keys by length and then by their bytes sorts their
+	// CBOR encodings, as the shortest head encodes the length first.
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	fields := 2
+	for _, n := range []int{len(keys), len(parents), len(f.Extensions)} {
+		if n > 0 {
+			fields++
+		}
+	}
+	b := binaryHeader(f.Version)
+	b = appendCBORHead(b, cborMap, uint64(fields))
+	b = appendCBORString(b, cborText, binaryContentsKey)
+	b = appendBinaryHash(b, f.Contents)
+	if len(keys) > 0 {
+		b = appendCBORString(b, cborText, binaryMetadataKey)
+		b = appendCBORHead(b, cborMap, uint64(len(keys)))
+		for _, key := range keys {
+			b = appendCBORString(b, cborText, key)
+			b = appendCBORString(b, cborText, f.Metadata[key])
+		}
+	}
+	b = appendCBORString(b, cborText, binaryModeKey)
+	b = appendCBORString(b, cborText, f.Mode)
+	if len(parents) > 0 {
+		b = appendCBORString(b, cborText, binaryParentsKey)
+		b = appendCBORHead(b, cborArray, uint64(len(parents)))
+		for _, parent := range parents {
+			b = appendBinaryHash(b, parent)
+		}
+	}
+	if len(f.Extensions) > 0 {
+		b = appendCBORString(b, cborText, binaryExtensionsKey)
+		b = appendCBORHead(b, cborArray, uint64(len(f.Extensions)))
+		for _, line := range f.Extensions {
+			b = appendCBORString(b, cborText, line)
+		}
+	}
+	return string(b)
+}
+
+// binaryTreePrefix returns the start of a binary tree in the given format version, up to its first entry.
+func binaryTreePrefix(v FormatVersion) []byte {
+	b := binaryHeader(v)
+	b = appendCBORHead(b, cborMap, 1)
+	b = appendCBORString(b, cborText, binaryEntriesKey)
+	return append(b, cborMap|cborIndefinite)
+}
+
+// appendBinaryTreeEntry appends the binary encoding of a single tree entry.
+func appendBinaryTreeEntry(b []byte, p Path, h *Hash) []byte {
+	b = appendCBORString(b, cborBytes, string(p))
+	return appendBinaryHash(b, h)
+}
+
+// binaryTreeEntry converts a tree entry from its text encoding to its binary encoding.
+func binaryTreeEntry(line string) ([]byte, error) {
+	encodedPath, h, err := splitTreeEntry(line)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodePath(encodedPath)
+	if err != nil {
+		return nil, err
+	}
+	return appendBinaryTreeEntry(nil, p, h), nil
+}
+
+// encodeBinaryTree encodes a tree in the binary format.
+func encodeBinaryTree(v FormatVersion, t Tree) string {
+	var paths []Path
+	for p, h := range t {
+		if h != nil {
+			paths = append(paths, p)
+		}
+	}
+	// Every encoded path is followed by a space in the text formats,
+	// which sorts before any character of an encoded path, so sorting
+	// by the encoded paths matches the order of the text formats.
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].encode() < paths[j].encode()
+	})
+	b := binaryTreePrefix(v)
+	for _, p := range paths {
+		b = appendBinaryTreeEntry(b, p, t[p])
+	}
+	return string(append(b, cborBreak))
+}
+
+// cborDecoder reads CBOR items one at a time.
+type cborDecoder struct {
+	r *bufio.Reader
+}
+
+// head reads the initial bytes of the next item.
+func (d *cborDecoder) head() (major byte, n uint64, indefinite bool, err error) {
+	initial, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := initial&^31, initial&31
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		for i := 0; i < 1<<(info-24); i++ {
+			next, err := d.r.ReadByte()
+			if err != nil {
+				return 0, 0, false, err
+			}
+			n = n<<8 | uint64(next)
+		}
+		return major, n, false, nil
+	case info == cborIndefinite && major != cborUint && major != cborNegInt && major != cborTag:
+		return major, 0, true, nil
+	}
+	return 0, 0, false, fmt.Errorf("malformed CBOR item starting with %#x", initial)
+}
+
+// expect reads the initial bytes of a definite-length item of the given major type.
+func (d *cborDecoder) expect(major byte) (uint64, error) {
+	got, n, indefinite, err := d.head()
+	if err != nil {
+		return 0, err
+	}
+	if got != major || indefinite {
+		return 0, fmt.Errorf("unexpected CBOR item of major type %d; expected %d", got>>5, major>>5)
+	}
+	return n, nil
+}
+
+// str reads a definite-length byte or text string.
+func (d *cborDecoder) str(major byte) (string, error) {
+	n, err := d.expect(major)
+	if err != nil {
+		return "", err
+	}
+	if n > math.MaxInt32 {
+		return "", fmt.Errorf("CBOR string of length %d is too long", n)
+	}
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, d.r, int64(n)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// hash reads the binary encoding of a hash.
+func (d *cborDecoder) hash() (*Hash, error) {
+	if n, err := d.expect(cborArray); err != nil {
+		return nil, err
+	} else if n != 2 {
+		return nil, fmt.Errorf("malformed hash of %d elements", n)
+	}
+	function, err := d.str(cborText)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := supportedHashFunctions[function]; !ok {
+		return nil, fmt.Errorf("unsupported hash function %q", function)
+	}
+	digest, err := d.str(cborBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Hash{function: function, hexContents: hex.EncodeToString([]byte(digest))}, nil
+}
+
+// atBreak consumes the next byte and returns true if it ends an indefinite-length item.
+func (d *cborDecoder) atBreak() (bool, error) {
+	next, err := d.r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if next[0] != cborBreak {
+		return false, nil
+	}
+	_, err = d.r.ReadByte()
+	return true, err
+}
+
+// skip reads and discards the next item.
+func (d *cborDecoder) skip() error {
+	major, n, indefinite, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		if indefinite {
+			return fmt.Errorf("unsupported indefinite-length CBOR string")
+		}
+		_, err := d.r.Discard(int(n))
+		return err
+	case cborArray, cborMap:
+		items := n
+		if major == cborMap {
+			items *= 2
+		}
+		for i := uint64(0); indefinite || i < items; i++ {
+			if indefinite {
+				if done, err := d.atBreak(); err != nil || done {
+					return err
+				}
+			}
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return d.skip()
+	}
+	return nil
+}
+
+// version reads the header of a binary object, up to its body.
+func (d *cborDecoder) version() (FormatVersion, error) {
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(d.r, magic); err != nil {
+		return 0, err
+	} else if string(magic) != binaryMagic {
+		return 0, fmt.Errorf("missing the binary format header")
+	}
+	if n, err := d.expect(cborArray); err != nil {
+		return 0, err
+	} else if n != 2 {
+		return 0, fmt.Errorf("malformed binary object of %d elements", n)
+	}
+	v, err := d.expect(cborUint)
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxInt32 || FormatVersion(v) < BinaryFormat {
+		return 0, fmt.Errorf("unexpected binary encoding for format version %d", v)
+	}
+	return FormatVersion(v), nil
+}
+
+// end reports an error if there is any data after the end of an object.
+func (d *cborDecoder) end() error {
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the end of the object")
+	}
+	return nil
+}
+
+func newCBORDecoder(encoded string) *cborDecoder {
+	return &cborDecoder{r: bufio.NewReader(strings.NewReader(encoded))}
+}
+
+// binaryFormatVersion returns the format version of a binary object.
+func binaryFormatVersion(encoded string) (FormatVersion, error) {
+	return newCBORDecoder(encoded).version()
+}
+
+// parseBinaryFile parses a `File` object from its binary encoding.
+func parseBinaryFile(encoded string) (*File, error) {
+	d := newCBORDecoder(encoded)
+	f := &File{}
+	var err error
+	if f.Version, err = d.version(); err != nil {
+		return nil, err
+	}
+	fields, err := d.expect(cborMap)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < fields; i++ {
+		key, err := d.str(cborText)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case binaryContentsKey:
+			f.Contents, err = d.hash()
+		case binaryMetadataKey:
+			f.Metadata, err = d.metadata()
+		case binaryModeKey:
+			f.Mode, err = d.str(cborText)
+		case binaryParentsKey:
+			f.Parents, err = d.hashes()
+		case binaryExtensionsKey:
+			f.Extensions, err = d.extensions()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the %q field: %w", key, err)
+		}
+	}
+	if err := d.end(); err != nil {
+		return nil, err
+	}
+	if len(f.Mode) == 0 || f.Contents == nil {
+		return nil, fmt.Errorf("missing the mode or contents of the encoded file")
+	}
+	return f, nil
+}
+
+// metadata reads the metadata map of a binary file.
+func (d *cborDecoder) metadata() (map[string]string, error) {
+	n, err := d.expect(cborMap)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.str(cborText)
+		if err != nil {
+			return nil, err
+		}
+		if !validMetadataKey(key) {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+		if metadata[key], err = d.str(cborText); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// hashes reads an array of hashes.
+func (d *cborDecoder) hashes() ([]*Hash, error) {
+	n, err := d.expect(cborArray)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []*Hash
+	for i := uint64(0); i < n; i++ {
+		h, err := d.hash()
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+// extensions reads the extension field lines of a binary file.
+func (d *cborDecoder) extensions() ([]string, error) {
+	n, err := d.expect(cborArray)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for i := uint64(0); i < n; i++ {
+		line, err := d.str(cborText)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, extensionPrefix) || strings.Contains(line, "\n") {
+			return nil, fmt.Errorf("malformed extension field %q", line)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// binaryTreeReader reads the entries of a binary tree one at a time.
+type binaryTreeReader struct {
+	d       *cborDecoder
+	started bool
+	done    bool
+
+	// remaining is the number of entries left, or -1 if the entries
+	// are an indefinite-length map.
+	remaining int64
+}
+
+// start reads the tree up to its first entry.
+func (r *binaryTreeReader) start() error {
+	r.started = true
+	if _, err := r.d.version(); err != nil {
+		return err
+	}
+	fields, err := r.d.expect(cborMap)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < fields; i++ {
+		key, err := r.d.str(cborText)
+		if err != nil {
+			return err
+		}
+		if key != binaryEntriesKey {
+			if err := r.d.skip(); err != nil {
+				return fmt.Errorf("failure parsing the %q field: %w", key, err)
+			}
+			continue
+		}
+		major, n, indefinite, err := r.d.head()
+		if err != nil {
+			return err
+		} else if major != cborMap {
+			return fmt.Errorf("malformed tree entries of major type %d", major>>5)
+		}
+		r.remaining = int64(n)
+		if indefinite {
+			r.remaining = -1
+		}
+		return nil
+	}
+	// There are no entries.
+	r.done = true
+	return nil
+}
+
+// next returns the next entry of the tree.
+func (r *binaryTreeReader) next() (p Path, h *Hash, ok bool, err error) {
+	if !r.started {
+		if err := r.start(); err != nil {
+			return "", nil, false, err
+		}
+	}
+	if r.done {
+		return "", nil, false, nil
+	}
+	if r.remaining < 0 {
+		if r.done, err = r.d.atBreak(); err != nil || r.done {
+			return "", nil, false, err
+		}
+	} else if r.remaining == 0 {
+		r.done = true
+		return "", nil, false, nil
+	} else {
+		r.remaining--
+	}
+	name, err := r.d.str(cborBytes)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("malformed tree entry: %w", err)
+	}
+	if h, err = r.d.hash(); err != nil {
+		return "", nil, false, fmt.Errorf("malformed tree entry for %q: %w", name, err)
+	}
+	return Path(name), h, true, nil
+}
+
+// parseBinaryTree parses a `Tree` object from its binary encoding.
+func parseBinaryTree(encoded string) (Tree, error) {
+	r := &binaryTreeReader{d: newCBORDecoder(encoded)}
+	t := make(Tree)
+	for {
+		p, h, ok, err := r.next()
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return t, nil
+		}
+		t[p] = h
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBinaryFormatRoundTrip(t *testing.T) {
+	h1, err := NewHash(strings.NewReader("contents"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	h2, err := NewHash(strings.NewReader("parent"))
+	if err != nil {
+		t.Fatalf("failure hashing the example parent: %v", err)
+	}
+	f := &File{
+		Mode:       "-rw-r-----",
+		Contents:   h1,
+		Parents:    []*Hash{h2},
+		Metadata:   map[string]string{"author": "someone", "a": "b\nc"},
+		Version:    BinaryFormat,
+		Extensions: []string{"+xattr \"user.example\" " + h2.String()},
+	}
+	encoded := f.String()
+	if !isBinary(encoded) {
+		t.Fatalf("the encoded file %q is not in the binary format", encoded)
+	}
+	text := *f
+	text.Version = VersionedFormat
+	if len(encoded) >= len(text.String()) {
+		t.Errorf("the binary encoding %q is not smaller than the text encoding %q", encoded, text.String())
+	}
+	parsed, err := ParseFile(encoded)
+	if err != nil {
+		t.Fatalf("failure parsing the binary file: %v", err)
+	} else if got := parsed.String(); got != encoded {
+		t.Errorf("unexpected result for the binary file roundtrip: got %q, want %q", got, encoded)
+	}
+	if err := CheckCanonicalFile(encoded); err != nil {
+		t.Errorf("the binary file is not canonical: %v", err)
+	}
+
+	tree := Tree{"a": h1, "with space": h2, "new\nline": h1, "\xff": h2}
+	encodedTree := tree.Encode(BinaryFormat)
+	parsedTree, err := ParseTree(encodedTree)
+	if err != nil {
+		t.Fatalf("failure parsing the binary tree: %v", err)
+	} else if got, want := parsedTree.String(), tree.String(); got != want {
+		t.Errorf("unexpected result for the binary tree roundtrip: got %q, want %q", got, want)
+	}
+	if err := CheckCanonicalTree(encodedTree); err != nil {
+		t.Errorf("the binary tree is not canonical: %v", err)
+	}
+	if err := CheckCanonicalTree(Tree{}.Encode(BinaryFormat)); err != nil {
+		t.Errorf("the empty binary tree is not canonical: %v", err)
+	}
+
+	// Objects in the text formats are still parsed the same way.
+	if parsed, err := ParseFile(text.String()); err != nil || parsed.Version != VersionedFormat {
+		t.Errorf("unexpected result parsing the text file: %+v, %v", parsed, err)
+	}
+
+	// Entries are compared in the same order regardless of the format.
+	smaller := Tree{"a": h1, "\xff": h2}
+	deleted, err := deletedEntries(strings.NewReader(tree.Encode(LegacyFormat)), strings.NewReader(smaller.Encode(BinaryFormat)))
+	if err != nil {
+		t.Fatalf("failure comparing the text and binary trees: %v", err)
+	}
+	want := Tree{"with space": h2, "new\nline": h1}
+	if got := deleted.String(); got != want.String() {
+		t.Errorf("unexpected deleted entries: got %q, want %q", got, want.String())
+	}
+}
+
+func TestSnapshotterLargeDirectoryBinary(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0700); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	ctx := context.Background()
+	opt := WithFormatVersion(BinaryFormat)
+	_, small, err := NewSnapshotter(&storageForTest{}, opt).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory in memory: %v", err)
+	}
+
+	defer func(entries, batch int) {
+		maxInMemoryTreeEntries, dirReadBatchSize = entries, batch
+	}(maxInMemoryTreeEntries, dirReadBatchSize)
+	maxInMemoryTreeEntries, dirReadBatchSize = 3, 2
+	s := &storageForTest{}
+	h, large, err := NewSnapshotter(s, opt).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory incrementally: %v", err)
+	}
+	if !large.Contents.Equal(small.Contents) {
+		t.Errorf("unexpected contents for the incrementally encoded directory: got %q, want %q", large.Contents, small.Contents)
+	}
+	if !isBinary(large.String()) {
+		t.Errorf("the directory snapshot %q is not in the binary format", large)
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, large)
+	if err != nil {
+		t.Fatalf("failure listing the binary directory: %v", err)
+	} else if len(tree) != 10 {
+		t.Errorf("unexpected entries in the binary directory: %v", tree)
+	}
+}
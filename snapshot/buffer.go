@@ -0,0 +1,113 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+)
+
+// byteBudget limits the total number of bytes reserved at once across multiple goroutines.
+type byteBudget struct {
+	max int64
+
+	mu       sync.Mutex
+	reserved int64
+	// released is closed, and replaced, whenever a reservation is released.
+	released chan struct{}
+}
+
+func newByteBudget(max int64) *byteBudget {
+	return &byteBudget{max: max, released: make(chan struct{})}
+}
+
+// reserve blocks until `n` bytes may be reserved, and returns a function that releases them.
+//
+// Reservations larger than the whole budget are reduced to the size of
+// the budget, so that they can still proceed on their own.
+func (b *byteBudget) reserve(ctx context.Context, n int64) (func(), error) {
+	if n > b.max {
+		n = b.max
+	}
+	if n <= 0 {
+		return func() {}, nil
+	}
+	for {
+		b.mu.Lock()
+		if b.reserved+n <= b.max {
+			b.reserved += n
+			b.mu.Unlock()
+			return func() { b.release(n) }, nil
+		}
+		released := b.released
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved -= n
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// WithMaxInFlightBytes limits the combined size of the files whose contents are being read at the same time.
+//
+// This bounds the memory and I/O used when snapshotting with a high
+// concurrency, so that a few large files do not starve the rest of the
+// system. A limit of zero or less means the size is not limited.
+func WithMaxInFlightBytes(n int64) Option {
+	return func(sn *Snapshotter) {
+		if n <= 0 {
+			sn.inFlight = nil
+			return
+		}
+		sn.inFlight = newByteBudget(n)
+	}
+}
+
+// WithReadBufferSize sets the size of the buffer used for reading the contents of each file.
+//
+// Larger buffers mean fewer, larger reads, which suits fast disks and
+// network file systems. A size of zero or less uses the default.
+func WithReadBufferSize(n int) Option {
+	return func(sn *Snapshotter) {
+		sn.readBufferSize = n
+	}
+}
+
+// reserveRead blocks until a file of the given size may be read without exceeding the in-flight limit.
+func (sn *Snapshotter) reserveRead(ctx context.Context, size int64) (func(), error) {
+	if sn.inFlight == nil {
+		return func() {}, nil
+	}
+	return sn.inFlight.reserve(ctx, size)
+}
+
+// buffer wraps the given reader so that it reads using the snapshotter's read buffer size, if set.
+func (sn *Snapshotter) buffer(r io.Reader) io.Reader {
+	if sn.readBufferSize <= 0 {
+		return r
+	}
+	return bufio.NewReaderSize(r, sn.readBufferSize)
+}
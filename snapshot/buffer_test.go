@@ -0,0 +1,80 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestByteBudget(t *testing.T) {
+	ctx := context.Background()
+	b := newByteBudget(100)
+	releaseLarge, err := b.reserve(ctx, 1000)
+	if err != nil {
+		t.Fatalf("failure reserving more than the whole budget: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.reserve(timeoutCtx, 1); err == nil {
+		t.Error("unexpected reservation beyond the budget")
+	}
+
+	reserved := make(chan func())
+	go func() {
+		release, err := b.reserve(ctx, 60)
+		if err != nil {
+			t.Errorf("failure reserving after a release: %v", err)
+		}
+		reserved <- release
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("reservation did not wait for the budget to be released")
+	case <-time.After(10 * time.Millisecond):
+	}
+	releaseLarge()
+	release := <-reserved
+	if _, err := b.reserve(ctx, 40); err != nil {
+		t.Errorf("failure reserving the remainder of the budget: %v", err)
+	}
+	release()
+}
+
+func TestSnapshotWithResourceLimits(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat(name, 100)), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	want, _, err := NewSnapshotter(&storageForTest{}).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting without resource limits: %v", err)
+	}
+	got, _, err := NewSnapshotter(&storageForTest{}, WithConcurrency(4), WithMaxInFlightBytes(1), WithReadBufferSize(16)).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting with resource limits: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("unexpected snapshot with resource limits: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The hash of a snapshot only identifies its logical contents if every
+// logically identical `File` and `Tree` is encoded the same way. The
+// encodings are therefore canonical:
+//
+//  1. Each directory entry is encoded as the unpadded, standard base64
+//     encoding of its name, followed by a space and the hash of the
+//     child's snapshot. The base64 encoding escapes every byte of the
+//     name, so names may contain spaces, newlines, or invalid UTF-8.
+//  2. Directory entries are sorted byte-wise by their encoded lines,
+//     independently of the platform's locale or the order in which the
+//     entries were listed by the file system.
+//  3. Metadata entries of file snapshots are sorted byte-wise by their
+//     encoded lines, and their values are quoted using Go syntax.
+//  4. Hashes are encoded with lower case hexadecimal digits.
+//
+// `CheckCanonicalTree` and `CheckCanonicalFile` verify that encoded
+// objects, e.g. ones written by other tools or versions of rvcs, follow
+// these rules.
+
+// ErrNotCanonical is the error reported for encoded objects that are not in their canonical form.
+var ErrNotCanonical = errors.New("not in canonical form")
+
+// checkCanonicalHash reports an error if the hash is not in its canonical form.
+func checkCanonicalHash(h *Hash) error {
+	if h != nil && h.hexContents != strings.ToLower(h.hexContents) {
+		return fmt.Errorf("the hash %q is %w", h, ErrNotCanonical)
+	}
+	return nil
+}
+
+// CheckCanonicalTree reports an error if the encoded tree is not in its canonical form.
+//
+// Trees in format versions newer than `LatestFormat` cannot be checked,
+// and are always accepted.
+func CheckCanonicalTree(encoded string) error {
+	version, err := encodedFormatVersion(encoded)
+	if err != nil {
+		return fmt.Errorf("failure parsing the format header of the encoded tree: %w", err)
+	}
+	if version > LatestFormat {
+		return nil
+	}
+	t, err := ParseTree(encoded)
+	if err != nil {
+		return err
+	}
+	for p, h := range t {
+		if err := checkCanonicalHash(h); err != nil {
+			return fmt.Errorf("failure checking the entry for %q: %w", p, err)
+		}
+	}
+	if canonical := t.Encode(version); canonical != encoded {
+		return fmt.Errorf("the encoded tree %q is %w; expected %q", encoded, ErrNotCanonical, canonical)
+	}
+	return nil
+}
+
+// CheckCanonicalFile reports an error if the encoded file snapshot is not in its canonical form.
+//
+// Files in format versions newer than `LatestFormat` cannot be checked,
+// and are always accepted.
+func CheckCanonicalFile(encoded string) error {
+	version, err := encodedFormatVersion(encoded)
+	if err != nil {
+		return fmt.Errorf("failure parsing the format header of the encoded file: %w", err)
+	}
+	if version > LatestFormat {
+		return nil
+	}
+	f, err := ParseFile(encoded)
+	if err != nil {
+		return err
+	}
+	for _, h := range append([]*Hash{f.Contents}, f.Parents...) {
+		if err := checkCanonicalHash(h); err != nil {
+			return err
+		}
+	}
+	if canonical := f.String(); canonical != encoded {
+		return fmt.Errorf("the encoded file %q is %w; expected %q", encoded, ErrNotCanonical, canonical)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckCanonical(t *testing.T) {
+	h1, err := NewHash(strings.NewReader("one"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	h2, err := NewHash(strings.NewReader("two"))
+	if err != nil {
+		t.Fatalf("failure hashing the example contents: %v", err)
+	}
+	tree := Tree{
+		Path("plain"):              h1,
+		Path("with spaces"):        h2,
+		Path("with\nnewline"):      h1,
+		Path("café"):               h2,
+		Path(string([]byte{0xff})): h1,
+	}
+	for _, v := range []FormatVersion{LegacyFormat, VersionedFormat} {
+		encoded := tree.Encode(v)
+		if err := CheckCanonicalTree(encoded); err != nil {
+			t.Errorf("unexpected failure checking the encoded tree %q: %v", encoded, err)
+		}
+		lines := strings.Split(encoded, "\n")
+		swapped := append([]string{}, lines...)
+		swapped[len(swapped)-1], swapped[len(swapped)-2] = swapped[len(swapped)-2], swapped[len(swapped)-1]
+		duplicated := append(append([]string{}, lines...), lines[len(lines)-1])
+		upper := strings.Replace(encoded, h1.HexContents(), strings.ToUpper(h1.HexContents()), 1)
+		for _, bad := range []string{strings.Join(swapped, "\n"), strings.Join(duplicated, "\n"), upper, encoded + "\n"} {
+			if err := CheckCanonicalTree(bad); !errors.Is(err, ErrNotCanonical) {
+				t.Errorf("unexpected result checking the non-canonical tree %q: %v", bad, err)
+			}
+		}
+	}
+
+	f := &File{
+		Mode:     "-rw-------",
+		Contents: h1,
+		Parents:  []*Hash{h2},
+		Metadata: map[string]string{"a": "1", "b": "2"},
+	}
+	encoded := f.String()
+	if err := CheckCanonicalFile(encoded); err != nil {
+		t.Errorf("unexpected failure checking the encoded file %q: %v", encoded, err)
+	}
+	reordered := strings.Replace(encoded, "a=\"1\"\nb=\"2\"", "b=\"2\"\na=\"1\"", 1)
+	for _, bad := range []string{reordered, strings.Replace(encoded, h2.HexContents(), strings.ToUpper(h2.HexContents()), 1)} {
+		if err := CheckCanonicalFile(bad); !errors.Is(err, ErrNotCanonical) {
+			t.Errorf("unexpected result checking the non-canonical file %q: %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ContentTypeMetadataKey is the `File.Metadata` key under which the
+// detected MIME type of a regular file's stored contents is recorded.
+const ContentTypeMetadataKey = "content-type"
+
+// sniffLen is the number of leading bytes examined to detect a content type.
+const sniffLen = 512
+
+// WithContentTypes enables or disables recording the detected content type of each regular file.
+//
+// The content type is detected from the contents as they are stored,
+// i.e. after any content filter has been applied.
+func WithContentTypes(contentTypes bool) Option {
+	return func(sn *Snapshotter) {
+		sn.contentTypes = contentTypes
+	}
+}
+
+// sniffContentType detects the MIME type of the contents read from `r`.
+//
+// The returned reader yields the complete contents, including the
+// leading bytes that were consumed in order to detect the type.
+func sniffContentType(r io.Reader) (io.Reader, string, error) {
+	prefix := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	prefix = prefix[:n]
+	return io.MultiReader(bytes.NewReader(prefix), r), http.DetectContentType(prefix), nil
+}
+
+// ContentType returns the detected MIME type of the file's contents, if it was recorded.
+func (f *File) ContentType() (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	contentType, ok := f.Metadata[ContentTypeMetadataKey]
+	return contentType, ok
+}
+
+// IsText reports whether or not the file's recorded content type is UTF-8 text.
+//
+// The second return value is false if no content type was recorded, in
+// which case the contents must be read to decide.
+func (f *File) IsText() (isText bool, known bool) {
+	contentType, ok := f.ContentType()
+	if !ok {
+		return false, false
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, false
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return false, true
+	}
+	charset, ok := params["charset"]
+	return !ok || strings.EqualFold(charset, "utf-8"), true
+}
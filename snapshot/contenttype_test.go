@@ -0,0 +1,109 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileIsText(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Metadata    map[string]string
+		WantText    bool
+		WantKnown   bool
+	}{
+		{
+			Description: "no content type",
+		},
+		{
+			Description: "utf-8 text",
+			Metadata:    map[string]string{ContentTypeMetadataKey: "text/plain; charset=utf-8"},
+			WantText:    true,
+			WantKnown:   true,
+		},
+		{
+			Description: "utf-16 text",
+			Metadata:    map[string]string{ContentTypeMetadataKey: "text/plain; charset=utf-16be"},
+			WantKnown:   true,
+		},
+		{
+			Description: "binary",
+			Metadata:    map[string]string{ContentTypeMetadataKey: "application/octet-stream"},
+			WantKnown:   true,
+		},
+		{
+			Description: "malformed content type",
+			Metadata:    map[string]string{ContentTypeMetadataKey: "text/plain; charset"},
+		},
+	}
+	for _, testCase := range testCases {
+		f := &File{Metadata: testCase.Metadata}
+		gotText, gotKnown := f.IsText()
+		if gotText != testCase.WantText || gotKnown != testCase.WantKnown {
+			t.Errorf("unexpected result for %q: got (%v, %v), want (%v, %v)", testCase.Description, gotText, gotKnown, testCase.WantText, testCase.WantKnown)
+		}
+	}
+}
+
+func TestSnapshotterContentTypes(t *testing.T) {
+	dir := t.TempDir()
+	textFile := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(textFile, []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example text file: %v", err)
+	}
+	binaryFile := filepath.Join(dir, "example.bin")
+	if err := os.WriteFile(binaryFile, []byte{0, 1, 2, 3}, 0700); err != nil {
+		t.Fatalf("failure creating the example binary file: %v", err)
+	}
+	s := &storageForTest{}
+	ctx := context.Background()
+	for _, testCase := range []struct {
+		Path string
+		Want string
+	}{
+		{Path: textFile, Want: "text/plain; charset=utf-8"},
+		{Path: binaryFile, Want: "application/octet-stream"},
+	} {
+		h, f, err := NewSnapshotter(s, WithContentTypes(true)).Snapshot(ctx, Path(testCase.Path))
+		if err != nil {
+			t.Fatalf("failure snapshotting %q: %v", testCase.Path, err)
+		}
+		if got, ok := f.ContentType(); !ok || got != testCase.Want {
+			t.Errorf("unexpected content type for %q: got %q, want %q", testCase.Path, got, testCase.Want)
+		}
+		if got, want := s.objects[*f.Contents], readFileForTest(t, testCase.Path); string(got) != string(want) {
+			t.Errorf("unexpected stored contents for %q: got %q, want %q", testCase.Path, got, want)
+		}
+		// Snapshotting without content types should not generate a new snapshot.
+		h2, _, err := NewSnapshotter(s).Snapshot(ctx, Path(testCase.Path))
+		if err != nil {
+			t.Fatalf("failure resnapshotting %q: %v", testCase.Path, err)
+		} else if !h2.Equal(h) {
+			t.Errorf("unexpected new snapshot for the unchanged file %q: got %q, want %q", testCase.Path, h2, h)
+		}
+	}
+}
+
+func readFileForTest(t *testing.T, path string) []byte {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failure reading %q: %v", path, err)
+	}
+	return bs
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"time"
+)
+
+// DirectoryTimeMetadataKey is the `File.Metadata` key under which the
+// modification time of a directory is recorded.
+const DirectoryTimeMetadataKey = "mtime"
+
+// WithDirectoryTimes enables or disables recording the modification time of each directory.
+//
+// Directories, including empty ones, and their permissions are always
+// recorded. This additionally records their modification times so that
+// they can be restored along with the rest of the directory structure.
+//
+// A directory's modification time changes whenever entries are added to
+// or removed from it, so with this enabled a new snapshot is recorded
+// for a directory even if the entries removed were never snapshotted.
+func WithDirectoryTimes(directoryTimes bool) Option {
+	return func(sn *Snapshotter) {
+		sn.directoryTimes = directoryTimes
+	}
+}
+
+// withDirectoryTime returns a copy of `metadata` that also records the modification time `t`.
+func withDirectoryTime(metadata map[string]string, t time.Time) map[string]string {
+	result := map[string]string{
+		DirectoryTimeMetadataKey: t.UTC().Format(time.RFC3339Nano),
+	}
+	for key, value := range metadata {
+		result[key] = value
+	}
+	return result
+}
+
+// DirectoryTime returns the modification time of the directory, if it was recorded.
+func (f *File) DirectoryTime() (time.Time, bool) {
+	if f == nil || !f.IsDir() {
+		return time.Time{}, false
+	}
+	recorded, ok := f.Metadata[DirectoryTimeMetadataKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, recorded)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
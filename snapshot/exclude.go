@@ -0,0 +1,55 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"os"
+	"time"
+)
+
+// ExcludeOtherOwners returns an `Excluder` that leaves out files that are not owned by the user with the given ID.
+//
+// Directories are never excluded, so that the files belonging to the
+// user within shared directories are still snapshotted. On platforms
+// that do not report file owners, nothing is excluded.
+func ExcludeOtherOwners(uid int) Excluder {
+	return ExcludeFunc(func(p Path, info os.FileInfo) bool {
+		if info.IsDir() {
+			return false
+		}
+		owner, ok := fileOwner(info)
+		return ok && owner != uid
+	})
+}
+
+// ExcludeModifiedBefore returns an `Excluder` that leaves out files last modified before the given time.
+//
+// Directories are never excluded, as their modification times do not
+// reflect changes to the files within them.
+func ExcludeModifiedBefore(t time.Time) Excluder {
+	return ExcludeFunc(func(p Path, info os.FileInfo) bool {
+		return !info.IsDir() && info.ModTime().Before(t)
+	})
+}
+
+// ExcludeModifiedAfter returns an `Excluder` that leaves out files last modified after the given time.
+//
+// Directories are never excluded, as their modification times do not
+// reflect changes to the files within them.
+func ExcludeModifiedAfter(t time.Time) Excluder {
+	return ExcludeFunc(func(p Path, info os.FileInfo) bool {
+		return !info.IsDir() && info.ModTime().After(t)
+	})
+}
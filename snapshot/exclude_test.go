@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestExcludeByOwnerAndAge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"ancient.txt":        365 * 24 * time.Hour,
+		"recent.txt":         time.Hour,
+		"sub/old.txt":        30 * 24 * time.Hour,
+		"sub/future.txt":     -24 * time.Hour,
+		"sub/nested/new.txt": 0,
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatalf("failure creating the parent of %q: %v", name, err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+		if err := os.Chtimes(p, now, now.Add(-age)); err != nil {
+			t.Fatalf("failure setting the modification time of %q: %v", name, err)
+		}
+	}
+	// Make the directories look old, which must not exclude the files within them.
+	for _, name := range []string{"sub", "sub/nested"} {
+		if err := os.Chtimes(filepath.Join(dir, name), now, now.Add(-1000*24*time.Hour)); err != nil {
+			t.Fatalf("failure setting the modification time of %q: %v", name, err)
+		}
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("failure reading the file information of %q: %v", dir, err)
+	}
+	owner, ownerKnown := fileOwner(info)
+
+	testCases := []struct {
+		Description string
+		Excluder    Excluder
+		Want        []string
+		SkipUnowned bool
+	}{
+		{
+			Description: "older than a week",
+			Excluder:    ExcludeModifiedBefore(now.Add(-7 * 24 * time.Hour)),
+			Want:        []string{"recent.txt", "sub/future.txt", "sub/nested/new.txt"},
+		},
+		{
+			Description: "newer than a day",
+			Excluder:    ExcludeModifiedAfter(now.Add(-24 * time.Hour)),
+			Want:        []string{"ancient.txt", "sub/old.txt"},
+		},
+		{
+			Description: "owned by the current user",
+			Excluder:    ExcludeOtherOwners(owner),
+			Want:        []string{"ancient.txt", "recent.txt", "sub/future.txt", "sub/nested/new.txt", "sub/old.txt"},
+		},
+		{
+			Description: "owned by another user",
+			Excluder:    ExcludeOtherOwners(owner + 1),
+			SkipUnowned: true,
+		},
+	}
+	for _, testCase := range testCases {
+		if testCase.SkipUnowned && !ownerKnown {
+			continue
+		}
+		s := &storageForTest{}
+		if _, _, err := NewSnapshotter(s, WithExcluder(testCase.Excluder)).Snapshot(ctx, Path(dir)); err != nil {
+			t.Fatalf("failure snapshotting %q for the test case %q: %v", dir, testCase.Description, err)
+		}
+		var got []string
+		for p := range s.snapshots {
+			if _, f, err := s.FindSnapshot(ctx, p); err != nil {
+				t.Fatalf("failure reading the snapshot of %q: %v", p, err)
+			} else if !f.IsDir() {
+				rel, err := filepath.Rel(dir, string(p))
+				if err != nil {
+					t.Fatalf("failure determining the relative path of %q: %v", p, err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+		}
+		sort.Strings(got)
+		if len(got) != len(testCase.Want) {
+			t.Errorf("unexpected files snapshotted for the test case %q: got %q, want %q", testCase.Description, got, testCase.Want)
+			continue
+		}
+		for i := range got {
+			if got[i] != testCase.Want[i] {
+				t.Errorf("unexpected files snapshotted for the test case %q: got %q, want %q", testCase.Description, got, testCase.Want)
+				break
+			}
+		}
+	}
+}
@@ -18,7 +18,10 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // File is the top-level object in a snapshot.
@@ -54,6 +57,92 @@ type File struct {
 	// Parents stores the hashes for the previous snapshots that
 	// immediately preceeded this one.
 	Parents []*Hash
+
+	// Metadata holds any additional information recorded about the file.
+	//
+	// Keys must be non-empty and may only contain lowercase letters,
+	// digits, and dashes.
+	Metadata map[string]string
+
+	// Version is the format version that the file is serialized in.
+	//
+	// The zero value is equivalent to `LegacyFormat`.
+	Version FormatVersion
+
+	// Extensions holds the extension field lines of the file.
+	//
+	// These are only serialized in the versioned format, and are
+	// preserved as-is so that fields added by newer versions of rvcs
+	// survive being read and rewritten by older ones.
+	Extensions []string
+}
+
+func validMetadataKey(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMetadataLine parses a line of the form `<KEY>=<QUOTED-VALUE>`.
+//
+// The returned boolean reports whether or not the line was a metadata line.
+func parseMetadataLine(line string) (key, value string, ok bool, err error) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 || !validMetadataKey(parts[0]) {
+		return "", "", false, nil
+	}
+	value, err = strconv.Unquote(parts[1])
+	if err != nil {
+		return "", "", true, fmt.Errorf("malformed metadata value %q: %w", parts[1], err)
+	}
+	return parts[0], value, true, nil
+}
+
+// Time returns the time that the snapshot was generated, if it was recorded.
+func (f *File) Time() (time.Time, bool) {
+	if f == nil {
+		return time.Time{}, false
+	}
+	recorded, ok := f.Metadata[TimeMetadataKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, recorded)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SameMetadata reports whether or not the two files have identical metadata.
+//
+// Any metadata keys listed in `ignored` are skipped in the comparison.
+func (f *File) SameMetadata(other *File, ignored ...string) bool {
+	skip := func(key string) bool {
+		for _, ignoredKey := range ignored {
+			if key == ignoredKey {
+				return true
+			}
+		}
+		return false
+	}
+	for key, value := range f.Metadata {
+		if otherValue, ok := other.Metadata[key]; !skip(key) && (!ok || otherValue != value) {
+			return false
+		}
+	}
+	for key := range other.Metadata {
+		if _, ok := f.Metadata[key]; !skip(key) && !ok {
+			return false
+		}
+	}
+	return true
 }
 
 // IsDir reports whether or not the file is the snapshot of a directory.
@@ -74,40 +163,88 @@ func (f *File) IsLink() bool {
 
 // String implements the `fmt.Stringer` interface.
 //
-// The resulting value is suitable for serialization.
+// The resulting value is suitable for serialization. It consists of
+// the mode line, the contents hash, and the parent hashes, each on a
+// separate line, followed by one `<KEY>=<QUOTED-VALUE>` line for each
+// metadata entry, sorted by key.
+//
+// In the versioned format, this is preceded by the format header and
+// followed by any extension fields. In the binary format, the result
+// is instead the binary encoding of the same fields.
 func (f *File) String() string {
 	if f == nil {
 		return ""
 	}
+	if f.Version.binary() {
+		return encodeBinaryFile(f)
+	}
 	var contentsStr string
 	if f.Contents != nil {
 		contentsStr = f.Contents.String()
 	}
-	lines := []string{f.Mode, contentsStr}
+	lines := append(f.Version.header(), f.Mode, contentsStr)
 	for _, parent := range f.Parents {
 		if parent != nil {
 			lines = append(lines, parent.String())
 		}
 	}
+	var metadataLines []string
+	for key, value := range f.Metadata {
+		if validMetadataKey(key) {
+			metadataLines = append(metadataLines, key+"="+strconv.Quote(value))
+		}
+	}
+	sort.Strings(metadataLines)
+	lines = append(lines, metadataLines...)
+	if f.Version.versioned() {
+		lines = append(lines, f.Extensions...)
+	}
 	return strings.Join(lines, "\n")
 }
 
 // ParseFile parses a `File` object from its encoded form.
 //
-// The input string must match the form returned by the `File.String` method.
+// The input string must match the form returned by the `File.String`
+// method, in any format version.
 func ParseFile(encoded string) (*File, error) {
 	if len(encoded) == 0 {
 		return nil, nil
 	}
-	lines := strings.Split(string(encoded), "\n")
+	if isBinary(encoded) {
+		f, err := parseBinaryFile(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the binary encoded file %q: %w", encoded, err)
+		}
+		return f, nil
+	}
+	version, lines, err := splitFormatHeader(strings.Split(string(encoded), "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the format header of %q: %w", encoded, err)
+	}
 	if len(lines) < 2 {
 		return nil, fmt.Errorf("malformed file metadata: %q", encoded)
 	}
 	var hashes []*Hash
+	var metadata map[string]string
+	var extensions []string
 	for i, line := range lines[1:] {
+		if isExtension(version, line) {
+			extensions = append(extensions, line)
+			continue
+		}
+		key, value, isMetadata, err := parseMetadataLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the metadata %q: %w", line, err)
+		} else if isMetadata {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[key] = value
+			continue
+		}
 		hash, err := ParseHash(line)
 		if err != nil {
-			return nil, fmt.Errorf("failure parsing the hash %q: %v", line, err)
+			return nil, fmt.Errorf("failure parsing the hash %q: %w", line, err)
 		}
 		if hash != nil {
 			hashes = append(hashes, hash)
@@ -115,10 +252,18 @@ func ParseFile(encoded string) (*File, error) {
 			return nil, fmt.Errorf("missing contents for the encoded file %q", encoded)
 		}
 	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("missing contents for the encoded file %q", encoded)
+	}
 	f := &File{
 		Mode:     lines[0],
 		Contents: hashes[0],
 		Parents:  hashes[1:],
+		Metadata: metadata,
+	}
+	if version.versioned() {
+		f.Version = version
+		f.Extensions = extensions
 	}
 	return f, nil
 }
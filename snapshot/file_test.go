@@ -46,6 +46,41 @@ func TestParseFileRoundTrip(t *testing.T) {
 			Serialized:  "drwxr-x---\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n\n",
 			Want:        "drwxr-x---\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 		},
+		{
+			Description: "unsorted metadata",
+			Serialized:  "-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\nfilter=\"crlf\"\nauthor=\"Jane \\\"J\\\" Doe\"",
+			Want:        "-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\nauthor=\"Jane \\\"J\\\" Doe\"\nfilter=\"crlf\"",
+		},
+		{
+			Description: "versioned format with extensions",
+			Serialized:  "#format 2\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\nfilter=\"crlf\"\n+xattrs user.example=abc",
+			Want:        "#format 2\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\nfilter=\"crlf\"\n+xattrs user.example=abc",
+		},
+		{
+			Description: "newer format with extensions",
+			Serialized:  "#format 7\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n+chunks abc\n+inline def",
+			Want:        "#format 7\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n+chunks abc\n+inline def",
+		},
+		{
+			Description: "extension in the legacy format",
+			Serialized:  "-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n+xattrs user.example=abc",
+			WantError:   true,
+		},
+		{
+			Description: "malformed format header",
+			Serialized:  "#format two\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			WantError:   true,
+		},
+		{
+			Description: "format header for the legacy format",
+			Serialized:  "#format 1\n-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			WantError:   true,
+		},
+		{
+			Description: "malformed metadata value",
+			Serialized:  "-rw-r-----\nsha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\nfilter=crlf",
+			WantError:   true,
+		},
 	}
 	for _, testCase := range testCases {
 		parsed, err := ParseFile(testCase.Serialized)
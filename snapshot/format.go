@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatVersion identifies the version of the serialized form of `File` and `Tree` objects.
+type FormatVersion int
+
+const (
+	// LegacyFormat is the original, unversioned serialization.
+	//
+	// Objects in this format do not have a format header, and may
+	// not contain any extension fields.
+	LegacyFormat FormatVersion = 1
+
+	// VersionedFormat starts with a `#format <VERSION>` header line,
+	// and may contain extension fields.
+	//
+	// Extension fields are lines of the form `+<NAME> <VALUE>`. They
+	// allow new fields to be added to the format without breaking
+	// older versions of rvcs: any extension fields that a reader does
+	// not understand are preserved in files and ignored in trees.
+	VersionedFormat FormatVersion = 2
+
+	// BinaryFormat holds the same fields as `VersionedFormat`, but
+	// encodes objects using a compact binary encoding based on CBOR.
+	//
+	// Objects in this format can be parsed alongside objects in the
+	// text formats, which they are distinguished from by their header.
+	BinaryFormat FormatVersion = 3
+
+	// LatestFormat is the newest format version that this version of rvcs understands.
+	LatestFormat = BinaryFormat
+)
+
+// formatHeaderPrefix starts the header line of a serialized object in the versioned format.
+const formatHeaderPrefix = "#format "
+
+// extensionPrefix starts each extension field line in the versioned format.
+const extensionPrefix = "+"
+
+// ParseFormatVersion parses a format version from its string form.
+func ParseFormatVersion(encoded string) (FormatVersion, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(encoded))
+	if err != nil || v < int(LegacyFormat) {
+		return 0, fmt.Errorf("malformed format version %q", encoded)
+	}
+	return FormatVersion(v), nil
+}
+
+// String implements the `fmt.Stringer` interface.
+func (v FormatVersion) String() string {
+	return strconv.Itoa(int(v))
+}
+
+// versioned reports whether or not objects in the format have a version header.
+func (v FormatVersion) versioned() bool {
+	return v >= VersionedFormat
+}
+
+// binary reports whether or not objects in the format are encoded in binary rather than as text.
+//
+// Objects in format versions newer than `LatestFormat` are encoded as
+// text, the same as they were before the binary format was added.
+func (v FormatVersion) binary() bool {
+	return v == BinaryFormat
+}
+
+// header returns the header lines for an object serialized in one of the text formats.
+func (v FormatVersion) header() []string {
+	if !v.versioned() {
+		return nil
+	}
+	return []string{formatHeaderPrefix + v.String()}
+}
+
+// splitFormatHeader separates the format header, if any, from the given lines of a serialized object.
+//
+// Objects newer than `LatestFormat` are accepted so that they can be
+// read on a best-effort basis.
+func splitFormatHeader(lines []string) (FormatVersion, []string, error) {
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], formatHeaderPrefix) {
+		return LegacyFormat, lines, nil
+	}
+	v, err := ParseFormatVersion(strings.TrimPrefix(lines[0], formatHeaderPrefix))
+	if err != nil {
+		return 0, nil, err
+	}
+	if !v.versioned() {
+		return 0, nil, fmt.Errorf("unexpected format header for version %d", v)
+	}
+	return v, lines[1:], nil
+}
+
+// encodedFormatVersion returns the format version of an encoded object in any format.
+func encodedFormatVersion(encoded string) (FormatVersion, error) {
+	if isBinary(encoded) {
+		return binaryFormatVersion(encoded)
+	}
+	v, _, err := splitFormatHeader(strings.SplitN(encoded, "\n", 2))
+	return v, err
+}
+
+// isExtension reports whether or not the given line is an extension field in the given format.
+func isExtension(v FormatVersion, line string) bool {
+	return v.versioned() && strings.HasPrefix(line, extensionPrefix)
+}
+
+// WithFormatVersion sets the format version used for newly stored `File` and `Tree` objects.
+//
+// The default is `LegacyFormat`. Versions newer than `LatestFormat` are
+// replaced by `LatestFormat`.
+//
+// Existing snapshots are not rewritten; a path's snapshot is only stored
+// in the new format once the path changes.
+func WithFormatVersion(v FormatVersion) Option {
+	return func(sn *Snapshotter) {
+		if v > LatestFormat {
+			v = LatestFormat
+		}
+		sn.formatVersion = v
+	}
+}
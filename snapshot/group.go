@@ -0,0 +1,59 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Group ties together the snapshots of several paths that were taken
+// in the same run, so that they can be restored to a mutually
+// consistent point.
+type Group struct {
+	// Previous is the hash of the group previously recorded under the same name, if any.
+	Previous *Hash
+
+	// Snapshots maps the absolute path of each member of the group to its snapshot.
+	Snapshots Tree
+}
+
+// String implements the `fmt.Stringer` interface.
+//
+// The resulting value is suitable for serialization. It consists of
+// the previous group's hash, which may be empty, on the first line,
+// followed by the encoded `Tree` of the member snapshots.
+func (g *Group) String() string {
+	return g.Previous.String() + "\n" + g.Snapshots.String()
+}
+
+// ParseGroup parses a `Group` object from its encoded form.
+//
+// The input string must match the form returned by the `Group.String` method.
+func ParseGroup(encoded string) (*Group, error) {
+	prevLine, treeLines, ok := strings.Cut(encoded, "\n")
+	if !ok {
+		return nil, fmt.Errorf("malformed group %q", encoded)
+	}
+	prev, err := ParseHash(prevLine)
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the previous group hash %q: %w", prevLine, err)
+	}
+	snapshots, err := ParseTree(treeLines)
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the group members: %w", err)
+	}
+	return &Group{Previous: prev, Snapshots: snapshots}, nil
+}
@@ -45,7 +45,7 @@ type Hash struct {
 func NewHash(reader io.Reader) (*Hash, error) {
 	sum := supportedHashFunctions[defaultHashFunction]()
 	if _, err := io.Copy(sum, reader); err != nil {
-		return nil, fmt.Errorf("failure hashing an object: %v", err)
+		return nil, fmt.Errorf("failure hashing an object: %w", err)
 	}
 	return &Hash{
 		function:    defaultHashFunction,
@@ -69,7 +69,7 @@ func ParseHash(str string) (*Hash, error) {
 		return nil, fmt.Errorf("unsupported hash function %q", parts[0])
 	}
 	if _, err := hex.DecodeString(parts[1]); err != nil {
-		return nil, fmt.Errorf("malformed hash contents %q: %v", parts[1], err)
+		return nil, fmt.Errorf("malformed hash contents %q: %w", parts[1], err)
 	}
 	return &Hash{
 		function:    parts[0],
@@ -95,6 +95,23 @@ func (h *Hash) Equal(other *Hash) bool {
 	return h.function == other.function && h.hexContents == other.hexContents
 }
 
+// ShortHexLength is the number of hexadecimal digits kept by `Hash.Short`.
+const ShortHexLength = 12
+
+// Short returns an abbreviated form of the hash for display.
+//
+// The result can be parsed with `ParseHash`, but only identifies the
+// full hash when expanded by the storage that holds it.
+func (h *Hash) Short() string {
+	if h == nil {
+		return ""
+	}
+	if len(h.hexContents) <= ShortHexLength {
+		return h.String()
+	}
+	return h.function + ":" + h.hexContents[:ShortHexLength]
+}
+
 // String implements the `fmt.Stringer` interface.
 //
 // The resulting value is used when serializing objects holding a hash.
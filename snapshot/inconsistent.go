@@ -0,0 +1,97 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"os"
+	"sync"
+)
+
+// InconsistentMetadataKey is the `File.Metadata` key under which the
+// reason that a regular file's stored contents may be torn is recorded.
+//
+// Files that are being written while they are snapshotted, such as the
+// files of running databases, may be captured part way through an
+// update. The stored contents are then a mix of the old and new
+// contents, and might not be usable.
+const InconsistentMetadataKey = "possibly-inconsistent"
+
+const (
+	// OpenForWriting is the recorded reason when another process had the file open for writing.
+	OpenForWriting = "open for writing"
+
+	// ModifiedWhileReading is the recorded reason when the file changed while its contents were being read.
+	ModifiedWhileReading = "modified while reading"
+)
+
+// WithOpenFileDetection enables or disables checking whether or not
+// regular files are open for writing by other processes.
+//
+// Files found to be open for writing are marked as possibly
+// inconsistent. This is best effort, and is only supported on Linux,
+// where it is limited to the processes that the current user may
+// inspect. Files modified while their contents are being read are
+// marked as possibly inconsistent regardless of this setting.
+func WithOpenFileDetection(detect bool) Option {
+	return func(sn *Snapshotter) {
+		sn.detectOpenFiles = detect
+	}
+}
+
+// PossiblyInconsistent returns the reason that the file's stored contents may be torn, if any.
+func (f *File) PossiblyInconsistent() (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	reason, ok := f.Metadata[InconsistentMetadataKey]
+	return reason, ok
+}
+
+// openFiles lazily lists the files that are open for writing.
+//
+// The files are listed once per snapshotter, when the first regular
+// file is snapshotted, since listing them may require inspecting every
+// running process.
+type openFiles struct {
+	once  sync.Once
+	paths map[Path]struct{}
+}
+
+func (o *openFiles) openForWriting(p Path) bool {
+	o.once.Do(func() {
+		o.paths = filesOpenForWriting()
+	})
+	_, ok := o.paths[p]
+	return ok
+}
+
+// inconsistency returns the reason that the contents of the regular file
+// `p` that were just read may be torn, or the empty string if there is none.
+//
+// The `info` argument is the file information from before the contents were read.
+func (sn *Snapshotter) inconsistency(p Path, info os.FileInfo) string {
+	if sn.deterministic {
+		return ""
+	}
+	if latest, err := os.Lstat(string(p)); err == nil {
+		if latest.Size() != info.Size() || !latest.ModTime().Equal(info.ModTime()) {
+			return ModifiedWhileReading
+		}
+	}
+	if sn.detectOpenFiles && sn.openFiles.openForWriting(p) {
+		return OpenForWriting
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// appendingFilter is a content filter that appends to the file being read.
+type appendingFilter struct {
+	path string
+}
+
+func (f *appendingFilter) Name() string {
+	return "appending"
+}
+
+func (f *appendingFilter) Matches(p Path) bool {
+	return string(p) == f.path
+}
+
+func (f *appendingFilter) Clean(ctx context.Context, r io.Reader, w io.Writer) error {
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write([]byte(" and more"))
+	return err
+}
+
+func TestSnapshotterInconsistentFiles(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := &storageForTest{}
+
+	stable := filepath.Join(dir, "stable.txt")
+	if err := os.WriteFile(stable, []byte("stable"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	if _, f, err := NewSnapshotter(s, WithOpenFileDetection(true)).Snapshot(ctx, Path(stable)); err != nil {
+		t.Fatalf("failure snapshotting %q: %v", stable, err)
+	} else if reason, ok := f.PossiblyInconsistent(); ok {
+		t.Errorf("unexpectedly marked %q as possibly inconsistent: %q", stable, reason)
+	}
+
+	modified := filepath.Join(dir, "modified.txt")
+	if err := os.WriteFile(modified, []byte("modified"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	if _, f, err := NewSnapshotter(s, WithFilters(&appendingFilter{path: modified})).Snapshot(ctx, Path(modified)); err != nil {
+		t.Fatalf("failure snapshotting %q: %v", modified, err)
+	} else if reason, ok := f.PossiblyInconsistent(); !ok || reason != ModifiedWhileReading {
+		t.Errorf("unexpected inconsistency for %q: got %q, want %q", modified, reason, ModifiedWhileReading)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	open := filepath.Join(dir, "open.txt")
+	writer, err := os.Create(open)
+	if err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	defer writer.Close()
+	if _, err := writer.Write([]byte("open")); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	if _, f, err := NewSnapshotter(s, WithOpenFileDetection(true)).Snapshot(ctx, Path(open)); err != nil {
+		t.Fatalf("failure snapshotting %q: %v", open, err)
+	} else if reason, ok := f.PossiblyInconsistent(); !ok || reason != OpenForWriting {
+		t.Errorf("unexpected inconsistency for %q: got %q, want %q", open, reason, OpenForWriting)
+	}
+	if _, f, err := NewSnapshotter(s).Snapshot(ctx, Path(open)); err != nil {
+		t.Fatalf("failure snapshotting %q: %v", open, err)
+	} else if reason, ok := f.PossiblyInconsistent(); ok {
+		t.Errorf("unexpectedly marked %q as possibly inconsistent without detecting open files: %q", open, reason)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// filesOpenForWriting lists the files that running processes have open for writing.
+//
+// This inspects the file descriptors listed under /proc. Processes that
+// the current user is not permitted to inspect are silently skipped.
+func filesOpenForWriting() map[Path]struct{} {
+	paths := make(map[Path]struct{})
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return paths
+	}
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !filepath.IsAbs(target) {
+				continue
+			}
+			if fdOpenForWriting(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name())) {
+				paths[Path(target)] = struct{}{}
+			}
+		}
+	}
+	return paths
+}
+
+// fdOpenForWriting reports whether or not the fdinfo file describes a descriptor open for writing.
+func fdOpenForWriting(fdinfo string) bool {
+	bs, err := os.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if !strings.HasPrefix(line, "flags:") {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64)
+		if err != nil {
+			return false
+		}
+		return flags&syscall.O_ACCMODE != syscall.O_RDONLY
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package snapshot
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the ID of the user that owns the file.
+func fileOwner(info os.FileInfo) (uid int, ok bool) {
+	unixInfo, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || unixInfo == nil {
+		return 0, false
+	}
+	return int(unixInfo.Uid), true
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// SnapshotPaths generates a snapshot of the directory `root` by only
+// snapshotting the given paths under it, instead of walking all of it.
+//
+// This is meant for callers that already know which files changed,
+// such as build systems, where walking a huge tree would be wasteful.
+// Each directory containing a listed path starts from the entries of its
+// previous snapshot, with each listed path snapshotted again, or removed
+// if it no longer exists. Entries that are not listed keep their previous
+// snapshots, so new files and directories are only added if they are
+// listed, and deleted files are only removed if they are listed.
+//
+// A listed directory is snapshotted in full, including everything under
+// it, unless any paths under it are also listed. Listed paths equal to
+// `root` are ignored, and paths outside of it are an error.
+func (sn *Snapshotter) SnapshotPaths(ctx context.Context, root Path, paths []Path) (*Hash, *File, error) {
+	root = Path(filepath.Clean(string(root)))
+	children := map[Path]map[Path]struct{}{root: {}}
+	for _, p := range paths {
+		p = Path(filepath.Clean(string(p)))
+		if _, ok := p.Relocate(root, root); !ok {
+			return nil, nil, fmt.Errorf("the listed path %q is not under %q", p, root)
+		}
+		for p != root {
+			parent := Path(filepath.Dir(string(p)))
+			if children[parent] == nil {
+				children[parent] = make(map[Path]struct{})
+			}
+			children[parent][Path(filepath.Base(string(p)))] = struct{}{}
+			p = parent
+		}
+	}
+	return sn.snapshotListed(ctx, root, children, 0)
+}
+
+// snapshotListed snapshots the path `p` for `SnapshotPaths`, where
+// `children` holds the names of the listed entries of each directory.
+func (sn *Snapshotter) snapshotListed(ctx context.Context, p Path, children map[Path]map[Path]struct{}, depth int) (h *Hash, f *File, err error) {
+	listed, ok := children[p]
+	if !ok {
+		return sn.snapshot(ctx, p, depth)
+	}
+	if sn.s.Exclude(p) {
+		return nil, nil, nil
+	}
+	info, err := os.Lstat(string(p))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failure reading the file stat for %q: %w", p, err)
+	}
+	if !info.IsDir() {
+		// The directory was replaced by something else.
+		return sn.snapshot(ctx, p, depth)
+	}
+	if sn.excluded(p, info) {
+		return nil, nil, nil
+	}
+	if err := sn.checkLimits(p, info, depth); err != nil {
+		return nil, nil, err
+	}
+	if sn.progress != nil {
+		defer func() {
+			if err == nil && h != nil {
+				sn.progress(p, info, h)
+			}
+		}()
+	}
+	var names []Path
+	for name := range listed {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	childHashes := make([]*Hash, len(names))
+	childErrs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		i, childPath := i, p.Join(name)
+		snapshotChild := func() {
+			childHashes[i], _, childErrs[i] = sn.snapshotListed(ctx, childPath, children, depth+1)
+		}
+		select {
+		case sn.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sn.workers
+					wg.Done()
+				}()
+				snapshotChild()
+			}()
+		default:
+			// No workers are free, so snapshot the child in this goroutine.
+			snapshotChild()
+		}
+	}
+	wg.Wait()
+
+	prev, prevTree, hasPrev := sn.previousTree(ctx, p)
+	tree := make(Tree)
+	for child, childHash := range prevTree {
+		tree[child] = childHash
+	}
+	for i, name := range names {
+		if err := childErrs[i]; err != nil {
+			return nil, nil, fmt.Errorf("failure snapshotting the listed path %q: %w", p.Join(name), err)
+		}
+		if childHashes[i] == nil {
+			delete(tree, name)
+		} else {
+			tree[name] = childHashes[i]
+		}
+	}
+	if hasPrev {
+		if contentsHash, ok := previousTreeContents(prev, prevTree, tree); ok {
+			// None of the children changed, so the previous contents can be reused as-is.
+			return sn.snapshotFileMetadata(ctx, p, info, contentsHash, nil)
+		}
+	}
+	contentsHash, err := sn.s.StoreObject(ctx, bytes.NewReader([]byte(tree.Encode(sn.formatVersion))))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure storing the contents of the directory %q: %w", p, err)
+	}
+	return sn.snapshotFileMetadata(ctx, p, info, contentsHash, sn.tombstoneMetadata(prevTree, tree))
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotPaths(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", filepath.Join("sub", "c"), filepath.Join("sub", "d")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700); err != nil {
+			t.Fatalf("failure creating the parent directory of %q: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	s := &storageForTest{}
+	sn := NewSnapshotter(s)
+	if _, _, err := sn.Snapshot(ctx, Path(dir)); err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+
+	// Change every file, but only list some of the changes.
+	for _, name := range []string{"a", "b", filepath.Join("sub", "c")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("changed "+name), 0600); err != nil {
+			t.Fatalf("failure changing the example file %q: %v", name, err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, "sub", "d")); err != nil {
+		t.Fatalf("failure removing the example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "e"), []byte("e"), 0600); err != nil {
+		t.Fatalf("failure creating the new example file: %v", err)
+	}
+	listed := []Path{Path(dir), Path(filepath.Join(dir, "a")), Path(filepath.Join(dir, "sub", "d")), Path(filepath.Join(dir, "sub", "e"))}
+	h, f, err := sn.SnapshotPaths(ctx, Path(dir), listed)
+	if err != nil {
+		t.Fatalf("failure snapshotting the listed paths: %v", err)
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		t.Fatalf("failure listing the snapshot: %v", err)
+	}
+	subHash, sub, err := s.FindSnapshot(ctx, Path(filepath.Join(dir, "sub")))
+	if err != nil {
+		t.Fatalf("failure looking up the snapshot of the subdirectory: %v", err)
+	} else if !tree["sub"].Equal(subHash) {
+		t.Errorf("the snapshot of the subdirectory %q does not match its entry %q", subHash, tree["sub"])
+	}
+	subTree, err := s.ListDirectorySnapshotContents(ctx, subHash, sub)
+	if err != nil {
+		t.Fatalf("failure listing the subdirectory snapshot: %v", err)
+	}
+	want := map[Path]string{
+		Path(filepath.Join(dir, "a")):        "changed a",
+		Path(filepath.Join(dir, "b")):        "b",
+		Path(filepath.Join(dir, "sub", "c")): filepath.Join("sub", "c"),
+		Path(filepath.Join(dir, "sub", "e")): "e",
+	}
+	entries := map[Path]*Hash{
+		Path(filepath.Join(dir, "a")):        tree["a"],
+		Path(filepath.Join(dir, "b")):        tree["b"],
+		Path(filepath.Join(dir, "sub", "c")): subTree["c"],
+		Path(filepath.Join(dir, "sub", "e")): subTree["e"],
+	}
+	for p, contents := range want {
+		fileHash := entries[p]
+		if fileHash == nil {
+			t.Errorf("missing the entry for %q", p)
+			continue
+		}
+		file, err := ParseFile(string(s.objects[*fileHash]))
+		if err != nil {
+			t.Fatalf("failure reading the snapshot of %q: %v", p, err)
+		}
+		if got := string(s.objects[*file.Contents]); got != contents {
+			t.Errorf("unexpected contents for %q: got %q, want %q", p, got, contents)
+		}
+	}
+	if len(tree) != 3 || len(subTree) != 2 {
+		t.Errorf("unexpected entries: %v and %v", tree, subTree)
+	}
+
+	if _, _, err := sn.SnapshotPaths(ctx, Path(filepath.Join(dir, "sub")), []Path{Path(filepath.Join(dir, "a"))}); err == nil {
+		t.Error("unexpected success snapshotting a listed path outside of the root")
+	}
+}
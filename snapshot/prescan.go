@@ -0,0 +1,138 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Estimate describes how much a snapshot of a path is expected to read.
+type Estimate struct {
+	// Paths is the number of paths that will be snapshotted, including directories and links.
+	Paths int64
+
+	// Files is the number of regular files.
+	Files int64
+
+	// Bytes is the total size of the regular files.
+	Bytes int64
+
+	// ChangedFiles is the number of regular files that do not match
+	// the path info cache, and so will have to be read.
+	ChangedFiles int64
+
+	// ChangedBytes is the total size of the changed files.
+	//
+	// This is an upper bound on the new data that the snapshot will
+	// store, since changed files may still have contents that are
+	// already stored.
+	ChangedBytes int64
+}
+
+// Prescan estimates how much a snapshot of `p` will read, without reading the contents of any files.
+//
+// This only lists directories and reads file metadata, using the path
+// info cache to decide which files have changed. It skips the same
+// paths as `Snapshot`, and reports the same `LimitError` if the path
+// exceeds any of the snapshotter's limits, but it does not count towards
+// those limits for later snapshots.
+func (sn *Snapshotter) Prescan(ctx context.Context, p Path) (*Estimate, error) {
+	e := &Estimate{}
+	err := sn.walk(ctx, p, 0, func(p Path, info os.FileInfo, depth int) error {
+		if max := sn.limits.MaxDepth; max > 0 && depth > max {
+			return &LimitError{Limit: "max depth", Max: int64(max), Path: p}
+		}
+		e.Paths++
+		if max := sn.limits.MaxFiles; max > 0 && e.Paths > max {
+			return &LimitError{Limit: "max files", Max: max, Path: p}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		e.Files++
+		e.Bytes += info.Size()
+		if max := sn.limits.MaxTotalSize; max > 0 && e.Bytes > max {
+			return &LimitError{Limit: "max total size", Max: max, Path: p}
+		}
+		if sn.deterministic || !sn.s.PathInfoMatchesCache(ctx, p, info) {
+			e.ChangedFiles++
+			e.ChangedBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// walk calls `visit` for `p` and, recursively, for everything under it
+// that `Snapshot` would not skip, without reading the contents of any files.
+//
+// The `depth` passed to `visit` is the number of directories below the
+// path passed to `Snapshot`. If `visit` returns `fs.SkipDir` for a
+// directory, then its contents are not visited.
+func (sn *Snapshotter) walk(ctx context.Context, p Path, depth int, visit func(p Path, info os.FileInfo, depth int) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sn.s.Exclude(p) {
+		return nil
+	}
+	info, err := os.Lstat(string(p))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failure reading the file stat for %q: %w", p, err)
+	}
+	if sn.excluded(p, info) {
+		return nil
+	}
+	if err := visit(p, info, depth); err == fs.SkipDir {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	contents, err := os.Open(string(p))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failure reading the directory %q: %w", p, err)
+	}
+	defer contents.Close()
+	for {
+		entries, err := contents.ReadDir(dirReadBatchSize)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failure reading the filesystem contents of the directory %q: %w", p, err)
+		}
+		for _, entry := range entries {
+			if err := sn.walk(ctx, Path(filepath.Join(string(p), entry.Name())), depth+1, visit); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || len(entries) == 0 {
+			break
+		}
+	}
+	return nil
+}
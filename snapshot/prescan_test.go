@@ -0,0 +1,64 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrescan(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := &storageForTest{}
+
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	cached := filepath.Join(dir, "cached.txt")
+	if err := os.WriteFile(cached, []byte("cached"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "nested.txt"), []byte("nested contents"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	info, err := os.Lstat(cached)
+	if err != nil {
+		t.Fatalf("failure reading the file stat for %q: %v", cached, err)
+	}
+	if err := s.CachePathInfo(ctx, Path(cached), info); err != nil {
+		t.Fatalf("failure caching the file info for %q: %v", cached, err)
+	}
+
+	e, err := NewSnapshotter(s).Prescan(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure pre-scanning %q: %v", dir, err)
+	}
+	want := Estimate{Paths: 4, Files: 2, Bytes: 21, ChangedFiles: 1, ChangedBytes: 15}
+	if *e != want {
+		t.Errorf("unexpected estimate: got %+v, want %+v", *e, want)
+	}
+
+	_, err = NewSnapshotter(s, WithLimits(Limits{MaxDepth: 1})).Prescan(ctx, Path(dir))
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "max depth" {
+		t.Errorf("unexpected result pre-scanning %q with a max depth: %v", dir, err)
+	}
+
+	if len(s.objects) > 0 || len(s.snapshots) > 0 {
+		t.Errorf("pre-scanning unexpectedly stored %d objects and %d snapshots", len(s.objects), len(s.snapshots))
+	}
+}
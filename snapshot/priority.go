@@ -0,0 +1,179 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+// WithNewestFirst enables or disables snapshotting the most recently modified files first.
+//
+// When enabled, each call to `Snapshot` starts by listing the regular
+// files that have changed since they were last snapshotted, according
+// to the path info cache. Those files are then snapshotted in order of
+// their modification times, newest first, before the rest of the path
+// is snapshotted as usual.
+//
+// The snapshot of each file is recorded as soon as it is generated, so
+// if snapshotting is interrupted then the files that were changing
+// most recently are the most likely to have been captured.
+func WithNewestFirst(newestFirst bool) Option {
+	return func(sn *Snapshotter) {
+		sn.newestFirst = newestFirst
+	}
+}
+
+// prioritizedFile is a regular file snapshotted ahead of the rest of the path.
+type prioritizedFile struct {
+	info os.FileInfo
+	h    *Hash
+	f    *File
+}
+
+// prioritized holds the regular files snapshotted ahead of the rest of the path.
+type prioritized struct {
+	mu    sync.Mutex
+	files map[Path]*prioritizedFile
+}
+
+func (pr *prioritized) add(p Path, file *prioritizedFile) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.files == nil {
+		pr.files = make(map[Path]*prioritizedFile)
+	}
+	pr.files[p] = file
+}
+
+// find returns the snapshot of `p` generated ahead of the rest of the
+// path, if there is one and the file has not changed since.
+func (pr *prioritized) find(p Path, info os.FileInfo) (*Hash, *File, bool) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	file, ok := pr.files[p]
+	if !ok || file.info.Size() != info.Size() || !file.info.ModTime().Equal(info.ModTime()) {
+		return nil, nil, false
+	}
+	return file.h, file.f, true
+}
+
+// snapshotNewestFirst snapshots the changed regular files under `p`, newest first.
+//
+// Each file is counted towards the snapshotter's limits before it is
+// stored, so exceeding a limit stops this pass the same way it would
+// stop the snapshot of the rest of the path. The counts are then reset,
+// since the rest of the path is counted again in full.
+func (sn *Snapshotter) snapshotNewestFirst(ctx context.Context, p Path) error {
+	sn.prioritized.mu.Lock()
+	sn.prioritized.files = nil
+	sn.prioritized.mu.Unlock()
+	fileCount, totalSize := sn.fileCount, sn.totalSize
+	defer func() {
+		sn.fileCount, sn.totalSize = fileCount, totalSize
+	}()
+
+	type candidate struct {
+		p     Path
+		info  os.FileInfo
+		depth int
+	}
+	var candidates []candidate
+	err := sn.walk(ctx, p, 0, func(p Path, info os.FileInfo, depth int) error {
+		if max := sn.limits.MaxDepth; max > 0 && depth > max {
+			// Leave the limit to be reported by the snapshot itself.
+			return fs.SkipDir
+		}
+		if info.Mode().IsRegular() && (sn.deterministic || !sn.s.PathInfoMatchesCache(ctx, p, info)) {
+			candidates = append(candidates, candidate{p: p, info: info, depth: depth})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].info.ModTime().After(candidates[j].info.ModTime())
+	})
+
+	errs := make([]error, len(candidates))
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		i, c := i, c
+		snapshotCandidate := func() {
+			errs[i] = sn.snapshotPrioritized(ctx, c.p, c.depth)
+		}
+		select {
+		case sn.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sn.workers
+					wg.Done()
+				}()
+				snapshotCandidate()
+			}()
+		default:
+			// No workers are free, so snapshot the file in this goroutine.
+			snapshotCandidate()
+		}
+	}
+	wg.Wait()
+	for i, err := range errs {
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			return limitErr
+		} else if err != nil {
+			return fmt.Errorf("failure snapshotting the changed file %q: %w", candidates[i].p, err)
+		}
+	}
+	return nil
+}
+
+// snapshotPrioritized snapshots the regular file `p`, which is `depth` directories below the snapshotted path, ahead of the rest of the path.
+//
+// This does not report progress, since that happens when the rest of
+// the path is snapshotted.
+func (sn *Snapshotter) snapshotPrioritized(ctx context.Context, p Path, depth int) error {
+	contents, err := os.Open(string(p))
+	if os.IsNotExist(err) {
+		// The file was removed since it was listed; the snapshot of its directory will reflect that.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failure reading the file %q: %w", p, err)
+	}
+	defer contents.Close()
+	info, err := contents.Stat()
+	if err != nil {
+		return fmt.Errorf("failure reading the filesystem metadata for %q: %w", p, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if err := sn.checkLimits(p, info, depth); err != nil {
+		return err
+	}
+	h, f, err := sn.snapshotRegularFile(ctx, p, info, contents)
+	if err != nil {
+		return err
+	}
+	sn.prioritized.add(p, &prioritizedFile{info: info, h: h, f: f})
+	return nil
+}
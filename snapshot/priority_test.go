@@ -0,0 +1,137 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderFilter is a content filter that matches no files, but records the order in which files were read.
+type orderFilter struct {
+	mu    sync.Mutex
+	order []Path
+}
+
+func (f *orderFilter) Name() string {
+	return "order"
+}
+
+func (f *orderFilter) Matches(p Path) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.order = append(f.order, p)
+	return false
+}
+
+func (f *orderFilter) Clean(ctx context.Context, r io.Reader, w io.Writer) error {
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func TestSnapshotterNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := &storageForTest{}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	files := []struct {
+		path  string
+		mtime time.Time
+	}{
+		{filepath.Join(dir, "a-old.txt"), time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{filepath.Join(dir, "b-new.txt"), time.Now().Add(-time.Hour)},
+		{filepath.Join(dir, "sub", "middle.txt"), time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(file.path, []byte(file.path), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", file.path, err)
+		}
+		if err := os.Chtimes(file.path, file.mtime, file.mtime); err != nil {
+			t.Fatalf("failure setting the modification time of %q: %v", file.path, err)
+		}
+	}
+	filter := &orderFilter{}
+	h, f, err := NewSnapshotter(s, WithFilters(filter), WithNewestFirst(true)).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", dir, err)
+	}
+	want := []Path{Path(files[1].path), Path(files[2].path), Path(files[0].path)}
+	if len(filter.order) != len(want) {
+		t.Fatalf("unexpected files read: got %q, want %q", filter.order, want)
+	}
+	for i := range want {
+		if filter.order[i] != want[i] {
+			t.Errorf("unexpected order of files read: got %q, want %q", filter.order, want)
+			break
+		}
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		t.Fatalf("failure listing the contents of the snapshot %q: %v", h, err)
+	}
+	for _, file := range files[:2] {
+		want, _, err := s.FindSnapshot(ctx, Path(file.path))
+		if err != nil || want == nil {
+			t.Fatalf("failure finding the snapshot of %q: %v", file.path, err)
+		}
+		if got := tree[Path(filepath.Base(file.path))]; !got.Equal(want) {
+			t.Errorf("unexpected snapshot of %q in the tree: got %q, want %q", file.path, got, want)
+		}
+	}
+}
+
+func TestSnapshotterNewestFirstLimits(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(strings.Repeat(name, 100)), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", file, err)
+		}
+		mtime := time.Now().Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatalf("failure setting the modification time of %q: %v", file, err)
+		}
+	}
+	s := &storageForTest{}
+	_, _, err := NewSnapshotter(s, WithNewestFirst(true), WithLimits(Limits{MaxTotalSize: 700})).Snapshot(ctx, Path(dir))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "max total size" {
+		t.Fatalf("unexpected result of exceeding the size limit: %v", err)
+	}
+	// Only the newest file fits within the limit, so the others must not have been stored.
+	for _, name := range []string{"b.txt", "c.txt"} {
+		for _, contents := range s.objects {
+			if string(contents) == strings.Repeat(name, 100) {
+				t.Errorf("the contents of %q were stored despite exceeding the limit", name)
+			}
+		}
+	}
+
+	// Within the limits, the same snapshotter options succeed.
+	if _, _, err := NewSnapshotter(s, WithNewestFirst(true), WithLimits(Limits{MaxFiles: 4, MaxTotalSize: 1500})).Snapshot(ctx, Path(dir)); err != nil {
+		t.Errorf("unexpected failure snapshotting within the limits: %v", err)
+	}
+}
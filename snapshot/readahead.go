@@ -0,0 +1,140 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"io"
+	"os"
+)
+
+const (
+	// defaultLargeFileSize is the default size from which files are read ahead.
+	defaultLargeFileSize = 64 * 1024 * 1024
+
+	// readAheadChunkSize is the size of each read from a large file.
+	readAheadChunkSize = 4 * 1024 * 1024
+
+	// readAheadChunks is the number of chunks of a large file that are buffered at once.
+	readAheadChunks = 4
+)
+
+// WithLargeFileSize sets the size from which regular files are read ahead.
+//
+// The contents of these files are read in large, aligned chunks by a
+// separate goroutine, with the operating system advised that they are
+// read sequentially. This overlaps reading each file with hashing and
+// storing its contents, which otherwise bottlenecks snapshotting large
+// files on fast disks. Each file read ahead buffers up to 16 MiB.
+//
+// A size of zero or less uses the default of 64 MiB.
+func WithLargeFileSize(n int64) Option {
+	return func(sn *Snapshotter) {
+		sn.largeFileSize = n
+	}
+}
+
+// readsAhead reports whether or not a file of the given size should be read ahead.
+func (sn *Snapshotter) readsAhead(size int64) bool {
+	threshold := sn.largeFileSize
+	if threshold <= 0 {
+		threshold = defaultLargeFileSize
+	}
+	return size >= threshold
+}
+
+// chunk is a chunk of a file read ahead, along with any error from reading it.
+type chunk struct {
+	data []byte
+	err  error
+}
+
+// readAhead reads a file in chunks from a separate goroutine, ahead of when they are needed.
+type readAhead struct {
+	filled chan chunk
+	free   chan []byte
+	stop   chan struct{}
+	done   chan struct{}
+
+	buf  []byte
+	rest []byte
+	err  error
+}
+
+// newReadAhead starts reading the file `f`, of the given size, ahead.
+//
+// The returned reader must be closed, which waits for the goroutine
+// reading the file to finish.
+func newReadAhead(f *os.File, size int64) *readAhead {
+	adviseSequential(f, size)
+	ra := &readAhead{
+		filled: make(chan chunk, readAheadChunks),
+		free:   make(chan []byte, readAheadChunks),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < readAheadChunks; i++ {
+		ra.free <- make([]byte, readAheadChunkSize)
+	}
+	go ra.run(f)
+	return ra
+}
+
+func (ra *readAhead) run(r io.Reader) {
+	defer close(ra.done)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.stop:
+			return
+		}
+		n, err := io.ReadFull(r, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case ra.filled <- chunk{data: buf[:n], err: err}:
+		case <-ra.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read implements the `io.Reader` interface.
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for len(ra.rest) == 0 {
+		if ra.err != nil {
+			return 0, ra.err
+		}
+		if ra.buf != nil {
+			ra.free <- ra.buf[:cap(ra.buf)]
+		}
+		c := <-ra.filled
+		ra.buf, ra.rest, ra.err = c.data, c.data, c.err
+	}
+	n := copy(p, ra.rest)
+	ra.rest = ra.rest[n:]
+	return n, nil
+}
+
+// Close stops reading ahead.
+func (ra *readAhead) Close() error {
+	close(ra.stop)
+	<-ra.done
+	return nil
+}
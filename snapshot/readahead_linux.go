@@ -0,0 +1,31 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package snapshot
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// adviseSequential tells the operating system that the file `f` will be read sequentially.
+//
+// This lets the kernel read further ahead than it otherwise would. The
+// advice is only a hint, so any failure to give it is ignored.
+func adviseSequential(f *os.File, size int64) {
+	unix.Fadvise(int(f.Fd()), 0, size, unix.FADV_SEQUENTIAL)
+}
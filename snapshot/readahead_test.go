@@ -0,0 +1,92 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadAhead(t *testing.T) {
+	dir := t.TempDir()
+	for _, size := range []int{0, 1, readAheadChunkSize, 2*readAheadChunkSize + 17, readAheadChunks*readAheadChunkSize + 1} {
+		contents := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(contents)
+		path := filepath.Join(dir, "example")
+		if err := os.WriteFile(path, contents, 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failure opening the example file: %v", err)
+		}
+		ra := newReadAhead(f, int64(size))
+		got, err := io.ReadAll(ra)
+		ra.Close()
+		f.Close()
+		if err != nil {
+			t.Errorf("failure reading ahead a file of %d bytes: %v", size, err)
+		} else if !bytes.Equal(got, contents) {
+			t.Errorf("unexpected contents read ahead from a file of %d bytes: got %d bytes", size, len(got))
+		}
+	}
+}
+
+func TestReadAheadClosedEarly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example")
+	if err := os.WriteFile(path, make([]byte, (readAheadChunks+2)*readAheadChunkSize), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failure opening the example file: %v", err)
+	}
+	defer f.Close()
+	ra := newReadAhead(f, readAheadChunkSize)
+	if _, err := ra.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("failure reading the start of the file: %v", err)
+	}
+	// This must not block even though the reading goroutine has filled every chunk.
+	ra.Close()
+}
+
+func TestSnapshotLargeFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	contents := make([]byte, 3*readAheadChunkSize+5)
+	rand.New(rand.NewSource(1)).Read(contents)
+	if err := os.WriteFile(filepath.Join(dir, "large"), contents, 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "small"), []byte("small"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	want, _, err := NewSnapshotter(&storageForTest{}).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting without reading ahead: %v", err)
+	}
+	got, _, err := NewSnapshotter(&storageForTest{}, WithLargeFileSize(1024), WithReadBufferSize(64*1024)).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting while reading ahead: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("unexpected snapshot while reading ahead: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Finding is a single result reported by a `Scanner`.
+type Finding struct {
+	// Scanner is the name of the scanner that reported the finding.
+	Scanner string
+
+	// Path is the path of the scanned file.
+	Path Path
+
+	// Contents is the hash of the stored contents of the scanned file.
+	Contents *Hash
+
+	// Rule identifies what was found, such as the name of a virus
+	// signature or the kind of secret.
+	Rule string
+
+	// Message describes the finding in more detail.
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", f.Path.Display(), f.Scanner, f.Rule, f.Message)
+}
+
+// Scanner inspects the contents of regular files as they are snapshotted.
+//
+// Scanners do not change what is stored; they only report findings, such
+// as viruses or secrets, which are collected by the `Snapshotter`.
+type Scanner interface {
+	// Name returns the name identifying the scanner.
+	Name() string
+
+	// Matches reports whether or not the scanner applies to the given path.
+	Matches(Path) bool
+
+	// Scan reads the contents of the file `p` from `r` and returns what
+	// it found in them.
+	//
+	// The `Scanner`, `Path`, and `Contents` fields of the returned
+	// findings are filled in by the `Snapshotter`.
+	Scan(ctx context.Context, p Path, r io.Reader) ([]Finding, error)
+}
+
+// ScanFunc is a callback that scans the contents of a file, as with `Scanner.Scan`.
+type ScanFunc func(ctx context.Context, p Path, r io.Reader) ([]Finding, error)
+
+type funcScanner struct {
+	name string
+	scan ScanFunc
+}
+
+func (s *funcScanner) Name() string      { return s.name }
+func (s *funcScanner) Matches(Path) bool { return true }
+
+func (s *funcScanner) Scan(ctx context.Context, p Path, r io.Reader) ([]Finding, error) {
+	return s.scan(ctx, p, r)
+}
+
+// NewScanner returns a scanner with the given name that applies the callback `scan` to every file.
+func NewScanner(name string, scan ScanFunc) Scanner {
+	return &funcScanner{name: name, scan: scan}
+}
+
+// WithScanners adds scanners for the contents of regular files.
+//
+// The contents of each regular file read while snapshotting are streamed
+// to every scanner matching its path, before any content filter is
+// applied. Files whose snapshots are reused from the path info cache are
+// not read, so they are not scanned again. Files with findings are never
+// added to that cache, so they are scanned again by later snapshots.
+//
+// The collected findings are returned by `Findings`.
+func WithScanners(scanners ...Scanner) Option {
+	return func(sn *Snapshotter) {
+		sn.scanners = append(sn.scanners, scanners...)
+	}
+}
+
+// findings collects the findings reported while snapshotting.
+type findings struct {
+	mu   sync.Mutex
+	seen map[Finding]bool
+	all  []Finding
+}
+
+// add records the given findings, ignoring any already recorded.
+//
+// Files may be read more than once, such as when verifying a snapshot,
+// so the same finding can be reported repeatedly.
+func (fs *findings) add(found []Finding) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.seen == nil {
+		fs.seen = make(map[Finding]bool)
+	}
+	for _, f := range found {
+		key := f
+		key.Contents = nil
+		if fs.seen[key] {
+			continue
+		}
+		fs.seen[key] = true
+		fs.all = append(fs.all, f)
+	}
+}
+
+// Findings returns everything reported by the scanners, sorted by path.
+func (sn *Snapshotter) Findings() []Finding {
+	sn.findings.mu.Lock()
+	defer sn.findings.mu.Unlock()
+	result := append([]Finding(nil), sn.findings.all...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// errScanAbandoned is reported to scanners when the contents they were reading will not be stored.
+var errScanAbandoned = errors.New("the contents were not stored")
+
+// scan is an in progress scan of a file's contents by one scanner.
+type scan struct {
+	scanner Scanner
+	w       *io.PipeWriter
+	done    chan struct{}
+	found   []Finding
+	err     error
+}
+
+// startScans starts each of the scanners matching `p` reading the contents read from `r`.
+//
+// The returned reader must be read in full before calling the returned
+// function, which waits for the scans to finish and returns their
+// findings. The `err` passed to that function is reported to the
+// scanners if the contents could not be read. Only the first call to
+// the returned function has any effect, so it can also be deferred to
+// stop the scans if reading the contents is abandoned.
+func (sn *Snapshotter) startScans(ctx context.Context, p Path, r io.Reader) (io.Reader, func(contents *Hash, err error) ([]Finding, error)) {
+	var scans []*scan
+	var writers []io.Writer
+	for _, scanner := range sn.scanners {
+		if !scanner.Matches(p) {
+			continue
+		}
+		pr, pw := io.Pipe()
+		sc := &scan{scanner: scanner, w: pw, done: make(chan struct{})}
+		go func() {
+			defer close(sc.done)
+			sc.found, sc.err = sc.scanner.Scan(ctx, p, pr)
+			// Keep consuming the contents so the snapshot is not blocked
+			// by a scanner that stopped reading early.
+			io.Copy(io.Discard, pr)
+			pr.Close()
+		}()
+		scans = append(scans, sc)
+		writers = append(writers, pw)
+	}
+	if len(scans) == 0 {
+		return r, func(*Hash, error) ([]Finding, error) { return nil, nil }
+	}
+	var once sync.Once
+	var result []Finding
+	var scanErr error
+	wait := func(contents *Hash, err error) ([]Finding, error) {
+		once.Do(func() {
+			for _, sc := range scans {
+				sc.w.CloseWithError(err)
+			}
+			for _, sc := range scans {
+				<-sc.done
+				if sc.err != nil && scanErr == nil {
+					scanErr = fmt.Errorf("failure scanning %q with the scanner %q: %w", p, sc.scanner.Name(), sc.err)
+				}
+				for _, f := range sc.found {
+					f.Scanner = sc.scanner.Name()
+					f.Path = p
+					f.Contents = contents
+					result = append(result, f)
+				}
+			}
+		})
+		return result, scanErr
+	}
+	return io.TeeReader(r, io.MultiWriter(writers...)), wait
+}
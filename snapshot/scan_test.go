@@ -0,0 +1,87 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanners(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.txt":  "nothing to see here\n",
+		"config.txt": "user=alice\npassword=hunter2\n",
+		"large.txt":  strings.Repeat("filler\n", 10000) + "password=swordfish\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure writing the example file %q: %v", name, err)
+		}
+	}
+	passwords := NewScanner("passwords", func(ctx context.Context, p Path, r io.Reader) ([]Finding, error) {
+		var found []Finding
+		lines := bufio.NewScanner(r)
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), "password=") {
+				found = append(found, Finding{Rule: "password", Message: "a password is assigned"})
+			}
+		}
+		return found, lines.Err()
+	})
+	// This scanner stops reading early, which should not block the snapshot.
+	firstByte := NewScanner("first-byte", func(ctx context.Context, p Path, r io.Reader) ([]Finding, error) {
+		_, err := r.Read(make([]byte, 1))
+		return nil, err
+	})
+	want, _, err := NewSnapshotter(&storageForTest{}).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting without scanners: %v", err)
+	}
+	sn := NewSnapshotter(&storageForTest{}, WithConcurrency(4), WithScanners(passwords, firstByte))
+	got, _, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting with scanners: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("unexpected snapshot with scanners: got %q, want %q", got, want)
+	}
+	var gotPaths []Path
+	for _, f := range sn.Findings() {
+		if f.Scanner != "passwords" || f.Rule != "password" || f.Contents == nil {
+			t.Errorf("unexpected finding: %+v", f)
+		}
+		gotPaths = append(gotPaths, f.Path)
+	}
+	wantPaths := []Path{Path(filepath.Join(dir, "config.txt")), Path(filepath.Join(dir, "large.txt"))}
+	if !reflect.DeepEqual(gotPaths, wantPaths) {
+		t.Errorf("unexpected paths with findings: got %q, want %q", gotPaths, wantPaths)
+	}
+
+	failing := NewScanner("failing", func(ctx context.Context, p Path, r io.Reader) ([]Finding, error) {
+		return nil, errors.New("scanner unavailable")
+	})
+	if _, _, err := NewSnapshotter(&storageForTest{}, WithScanners(failing)).Snapshot(ctx, Path(dir)); err == nil {
+		t.Error("unexpected success snapshotting with a failing scanner")
+	}
+}
@@ -16,7 +16,6 @@
 package snapshot
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -24,6 +23,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -55,52 +56,191 @@ type Storage interface {
 	PathInfoMatchesCache(context.Context, Path, os.FileInfo) bool
 }
 
-func snapshotFileMetadata(ctx context.Context, s Storage, p Path, info os.FileInfo, contentsHash *Hash) (*Hash, *File, error) {
-	modeLine := info.Mode().String()
-	prevFileHash, prev, err := s.FindSnapshot(ctx, p)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, nil, fmt.Errorf("failure looking up the previous file snapshot: %v", err)
+// TreeReader is optionally implemented by a `Storage` that can read
+// back the contents of previously stored directory snapshots.
+//
+// This allows snapshots of individual paths inside a directory to
+// update its previous contents, and tombstones to record the children
+// that were deleted since then.
+type TreeReader interface {
+	// ListDirectorySnapshotContents returns the contents of the directory snapshot `f`, which has the hash `h`.
+	ListDirectorySnapshotContents(ctx context.Context, h *Hash, f *File) (Tree, error)
+}
+
+// ObjectReader is implemented by storage that can read back the objects stored in it.
+//
+// This is used to compare the contents of large directories with their
+// previous snapshots without holding either in memory.
+type ObjectReader interface {
+	// ReadObject opens the object with the given hash for reading.
+	ReadObject(ctx context.Context, h *Hash) (io.ReadCloser, error)
+}
+
+// IdentityCache is optionally implemented by a `Storage` that can
+// recognize files by their identity on the file system, rather than by
+// their path.
+//
+// This allows renamed or moved files to reuse their previously stored
+// contents without reading them again.
+type IdentityCache interface {
+	// FindCachedFile returns the snapshot previously generated for a
+	// regular file with the same identity as `info`, if there is one.
+	//
+	// This is only used for a path `p` that the file was not previously
+	// cached at, since otherwise `PathInfoMatchesCache` decides whether
+	// or not its contents can be reused.
+	FindCachedFile(ctx context.Context, p Path, info os.FileInfo) (*Hash, *File, bool)
+}
+
+// previousTree returns the previous snapshot of the directory `p` and its contents, if available.
+func (sn *Snapshotter) previousTree(ctx context.Context, p Path) (*File, Tree, bool) {
+	reader, ok := sn.s.(TreeReader)
+	if !ok {
+		return nil, nil, false
 	}
-	if prev != nil && prev.Mode == modeLine && prev.Contents.Equal(contentsHash) {
-		// The file is unchanged from the last snapshot...
-		return prevFileHash, prev, nil
+	prevHash, prev, err := sn.s.FindSnapshot(ctx, p)
+	if err != nil || prev == nil || !prev.IsDir() {
+		return nil, nil, false
+	}
+	prevTree, err := reader.ListDirectorySnapshotContents(ctx, prevHash, prev)
+	if err != nil {
+		return nil, nil, false
+	}
+	return prev, prevTree, true
+}
+
+// previousTreeContents returns the contents hash of the previous
+// directory snapshot `prev` if its children were exactly those in `tree`.
+func previousTreeContents(prev *File, prevTree, tree Tree) (*Hash, bool) {
+	if len(prevTree) != len(tree) {
+		return nil, false
+	}
+	for child, childHash := range tree {
+		if !prevTree[child].Equal(childHash) {
+			return nil, false
+		}
+	}
+	return prev.Contents, true
+}
+
+func (sn *Snapshotter) snapshotFileMetadata(ctx context.Context, p Path, info os.FileInfo, contentsHash *Hash, metadata map[string]string) (*Hash, *File, error) {
+	modeLine := sn.modeLine(info)
+	if sn.directoryTimes && info.IsDir() {
+		metadata = withDirectoryTime(metadata, info.ModTime())
 	}
 	f := &File{
 		Contents: contentsHash,
 		Mode:     modeLine,
+		Metadata: metadata,
+		Version:  sn.formatVersion,
+	}
+	if info.IsDir() || info.Mode().IsRegular() {
+		// Extended attributes are not recorded for links.
+		xattrs, err := sn.xattrExtensions(ctx, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.Extensions = xattrs
+	}
+	if sn.deterministic {
+		// Deterministic snapshots do not link to any previous history, and
+		// do not replace the latest snapshot recorded for the path.
+		h, err := sn.s.StoreObject(ctx, strings.NewReader(f.String()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failure saving the file metadata for %q: %w", p, err)
+		}
+		return h, f, nil
+	}
+	prevFileHash, prev, err := sn.s.FindSnapshot(ctx, p)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failure looking up the previous file snapshot: %w", err)
+	}
+	if prev != nil && prev.Mode == modeLine && prev.Contents.Equal(contentsHash) && prev.SameMetadata(f, unchangedKeys...) && (len(sn.xattrs) == 0 || prev.SameXattrs(f)) {
+		// The file is unchanged from the last snapshot...
+		return prevFileHash, prev, nil
+	}
+	for key, value := range sn.provenance() {
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		f.Metadata[key] = value
 	}
-	if prev != nil {
+	if prev != nil && sn.verifyRetries > 0 && sn.verify.wasWritten(p, prevFileHash) {
+		// The previous snapshot came from an earlier verification attempt, so it is replaced rather than extended.
+		f.Parents = prev.Parents
+	} else if prev != nil {
 		f.Parents = []*Hash{prevFileHash}
 	}
-	h, err := s.StoreSnapshot(ctx, p, f)
+	h, err := sn.s.StoreSnapshot(ctx, p, f)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure saving the latest file metadata for %q: %v", p, err)
+		return nil, nil, fmt.Errorf("failure saving the latest file metadata for %q: %w", p, err)
+	}
+	if sn.verifyRetries > 0 {
+		sn.verify.recordWritten(p, h)
 	}
 	return h, f, nil
 }
 
-func readCached(ctx context.Context, s Storage, p Path, info os.FileInfo) (*Hash, *File, bool) {
-	if !s.PathInfoMatchesCache(ctx, p, info) {
+func (sn *Snapshotter) readCached(ctx context.Context, p Path, info os.FileInfo) (*Hash, *File, bool) {
+	if sn.deterministic {
+		return nil, nil, false
+	}
+	if !sn.s.PathInfoMatchesCache(ctx, p, info) {
+		atomic.AddInt64(&sn.cacheMisses, 1)
 		return nil, nil, false
 	}
-	cachedHash, cachedFile, err := s.FindSnapshot(ctx, p)
+	cachedHash, cachedFile, err := sn.s.FindSnapshot(ctx, p)
 	if err != nil {
+		atomic.AddInt64(&sn.cacheMisses, 1)
 		return nil, nil, false
 	}
+	atomic.AddInt64(&sn.cacheHits, 1)
+	sn.reusedPaths.Store(p, struct{}{})
 	return cachedHash, cachedFile, true
 }
 
+// readCachedDirectory returns the previous snapshot of the directory `p`
+// if its path info matches the cache and all of its children were reused.
+//
+// The cached path info of a directory changes whenever an entry is added,
+// removed, or renamed, so together with the reused children this shows
+// that the previous snapshot is still current without encoding the tree.
+func (sn *Snapshotter) readCachedDirectory(ctx context.Context, p Path, info os.FileInfo) (*Hash, *File, bool) {
+	if sn.deterministic || !sn.s.PathInfoMatchesCache(ctx, p, info) {
+		return nil, nil, false
+	}
+	cachedHash, cachedFile, err := sn.s.FindSnapshot(ctx, p)
+	if err != nil || cachedFile == nil || !cachedFile.IsDir() {
+		return nil, nil, false
+	}
+	sn.reusedPaths.Store(p, struct{}{})
+	return cachedHash, cachedFile, true
+}
+
+// CacheStats returns the number of paths whose snapshots were, and were
+// not, reused from the path info cache by this snapshotter.
+func (sn *Snapshotter) CacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&sn.cacheHits), atomic.LoadInt64(&sn.cacheMisses)
+}
+
 // timeNow is a handle on `time.Now` that lets us replace it for simulating the passage of time in unit tests.
 var timeNow func() time.Time = time.Now
 
-func snapshotRegularFile(ctx context.Context, s Storage, p Path, info os.FileInfo, contents io.Reader) (h *Hash, f *File, err error) {
+func (sn *Snapshotter) snapshotRegularFile(ctx context.Context, p Path, info os.FileInfo, contents io.Reader) (h *Hash, f *File, err error) {
+	found := false
 	startTimeSec := timeNow().Truncate(time.Second)
-	if cachedHash, cachedFile, ok := readCached(ctx, s, p, info); ok {
+	if sn.verifyRetries > 0 {
+		sn.verify.recordRead(p, info)
+	}
+	if prioritizedHash, prioritizedFile, ok := sn.prioritized.find(p, info); ok {
+		return prioritizedHash, prioritizedFile, nil
+	}
+	if cachedHash, cachedFile, ok := sn.readCached(ctx, p, info); ok {
 		return cachedHash, cachedFile, nil
 	}
 	defer func() {
 		// Cache the path info if appropriate...
-		if err != nil || h == nil {
+		if err != nil || h == nil || sn.deterministic {
 			// We did not construct a snapshot, so nothing to cache
 			return
 		}
@@ -113,62 +253,314 @@ func snapshotRegularFile(ctx context.Context, s Storage, p Path, info os.FileInf
 			// The file changed while we were snapshotting it; don't cache anything
 			return
 		}
+		if _, ok := f.PossiblyInconsistent(); ok {
+			// The contents might be torn, so they should be read again next time.
+			return
+		}
+		if found {
+			// The file should be scanned again next time.
+			return
+		}
 		if !latestInfo.ModTime().Before(startTimeSec.Add(-1 * time.Second)) {
 			// The file timestamp matches when we started, so there's a potential
 			// race condition where it might have updated after we snapshotted,
 			// and we should not cache it.
 			return
 		}
-		s.CachePathInfo(ctx, p, info)
+		sn.s.CachePathInfo(ctx, p, info)
 	}()
-	h, err = s.StoreObject(ctx, contents)
+	if contentsHash, metadata, ok := sn.movedContents(ctx, p, info); ok {
+		return sn.snapshotFileMetadata(ctx, p, info, contentsHash, metadata)
+	}
+	release, err := sn.reserveRead(ctx, info.Size())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	if file, ok := contents.(*os.File); ok && sn.readsAhead(info.Size()) {
+		ra := newReadAhead(file, info.Size())
+		defer ra.Close()
+		contents = ra
+	}
+	contents = sn.throttle(ctx, sn.buffer(contents))
+	contents, scanned := sn.startScans(ctx, p, contents)
+	defer scanned(nil, errScanAbandoned)
+	metadata := make(map[string]string)
+	if filter := sn.filterFor(p); filter != nil {
+		cleaned := cleanReader(ctx, filter, contents)
+		defer cleaned.Close()
+		contents = cleaned
+		metadata[FilterMetadataKey] = filter.Name()
+	}
+	if sn.contentTypes {
+		var contentType string
+		contents, contentType, err = sniffContentType(contents)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failure detecting the content type of %q: %w", p, err)
+		}
+		metadata[ContentTypeMetadataKey] = contentType
+	}
+	h, err = sn.s.StoreObject(ctx, contents)
+	findings, scanErr := scanned(h, err)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure storing an object: %v", err)
+		return nil, nil, fmt.Errorf("failure storing an object: %w", err)
+	}
+	if scanErr != nil {
+		return nil, nil, scanErr
+	}
+	if len(findings) > 0 {
+		found = true
+		sn.findings.add(findings)
 	}
-	return snapshotFileMetadata(ctx, s, p, info, h)
+	if reason := sn.inconsistency(p, info); len(reason) > 0 {
+		metadata[InconsistentMetadataKey] = reason
+	}
+	return sn.snapshotFileMetadata(ctx, p, info, h, metadata)
 }
 
-func snapshotDirectory(ctx context.Context, s Storage, p Path, info os.FileInfo, contents *os.File) (*Hash, *File, error) {
-	entries, err := contents.ReadDir(0)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the filesystem contents of the directory %q: %v", p, err)
+// movedContents returns the previously stored contents of the regular
+// file `p` if it was snapshotted under a different path and has not
+// changed since, along with the metadata describing those contents.
+func (sn *Snapshotter) movedContents(ctx context.Context, p Path, info os.FileInfo) (*Hash, map[string]string, bool) {
+	cache, ok := sn.s.(IdentityCache)
+	if !ok || sn.deterministic {
+		return nil, nil, false
+	}
+	_, cached, ok := cache.FindCachedFile(ctx, p, info)
+	if !ok || cached.Contents == nil || cached.IsDir() || cached.IsLink() {
+		return nil, nil, false
 	}
-	childHashes := make(Tree)
-	for _, entry := range entries {
-		childPath := Path(filepath.Join(string(p), entry.Name()))
-		childHash, _, err := Current(ctx, s, childPath)
+	if _, ok := cached.PossiblyInconsistent(); ok {
+		return nil, nil, false
+	}
+	metadata := make(map[string]string)
+	// The stored contents depend on the filter applied, which is chosen by path.
+	var filterName string
+	if filter := sn.filterFor(p); filter != nil {
+		filterName = filter.Name()
+		metadata[FilterMetadataKey] = filterName
+	}
+	if cached.Metadata[FilterMetadataKey] != filterName {
+		return nil, nil, false
+	}
+	if sn.contentTypes {
+		contentType, ok := cached.ContentType()
+		if !ok {
+			return nil, nil, false
+		}
+		metadata[ContentTypeMetadataKey] = contentType
+	}
+	return cached.Contents, metadata, true
+}
+
+// cleanReader returns a reader for the result of passing `contents` through the given filter.
+//
+// Any error from the filter is reported by the returned reader. The reader
+// must be closed so that the filter is not left blocked on writing output.
+func cleanReader(ctx context.Context, filter ContentFilter, contents io.Reader) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		err := filter.Clean(ctx, contents, w)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failure hashing the child dir %q: %v", childPath, err)
+			err = fmt.Errorf("failure applying the content filter %q: %w", filter.Name(), err)
+		}
+		w.CloseWithError(err)
+	}()
+	return r
+}
+
+// snapshotChildren snapshots the given directory entries, adding the resulting snapshots to `w`.
+//
+// The returned booleans report whether or not every child reused its
+// previous snapshot, and whether or not any child was skipped.
+func (sn *Snapshotter) snapshotChildren(ctx context.Context, p Path, entries []os.DirEntry, depth int, w *treeWriter) (reused, skipped bool, err error) {
+	childHashes := make([]*Hash, len(entries))
+	childReused := make([]bool, len(entries))
+	childErrs := make([]error, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		i, childPath := i, Path(filepath.Join(string(p), entry.Name()))
+		snapshotChild := func() {
+			sn.reusedPaths.Delete(childPath)
+			childHashes[i], _, childErrs[i] = sn.snapshot(ctx, childPath, depth+1)
+			_, childReused[i] = sn.reusedPaths.LoadAndDelete(childPath)
+		}
+		select {
+		case sn.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sn.workers
+					wg.Done()
+				}()
+				snapshotChild()
+			}()
+		default:
+			// No workers are free, so snapshot the child in this goroutine.
+			snapshotChild()
+		}
+	}
+	wg.Wait()
+	reused = true
+	for i, entry := range entries {
+		if err := childErrs[i]; err != nil {
+			return false, false, fmt.Errorf("failure hashing the child dir %q: %w", p.Join(Path(entry.Name())), err)
+		}
+		if childHashes[i] == nil {
+			skipped = true
+		}
+		reused = reused && childReused[i]
+		if err := w.Add(Path(entry.Name()), childHashes[i]); err != nil {
+			return false, false, err
+		}
+	}
+	return reused, skipped, nil
+}
+
+func (sn *Snapshotter) snapshotDirectory(ctx context.Context, p Path, info os.FileInfo, contents *os.File, depth int) (h *Hash, f *File, err error) {
+	startTimeSec := timeNow().Truncate(time.Second)
+	w := newTreeWriter(sn.formatVersion)
+	defer w.Close()
+	reused, skipped := true, false
+	for {
+		// The entries are read in batches so that large directories
+		// do not need to be listed in memory all at once.
+		entries, err := contents.ReadDir(dirReadBatchSize)
+		if err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("failure reading the filesystem contents of the directory %q: %w", p, err)
+		}
+		childrenReused, childrenSkipped, childErr := sn.snapshotChildren(ctx, p, entries, depth, w)
+		if childErr != nil {
+			return nil, nil, childErr
+		}
+		reused = reused && childrenReused
+		skipped = skipped || childrenSkipped
+		if err == io.EOF || len(entries) == 0 {
+			break
+		}
+	}
+	if reused {
+		if cachedHash, cachedFile, ok := sn.readCachedDirectory(ctx, p, info); ok {
+			// None of the children changed, so the previous snapshot can be reused as-is.
+			return cachedHash, cachedFile, nil
+		}
+	}
+	defer func() {
+		if err != nil || h == nil || sn.deterministic || skipped {
+			// A directory with skipped children must be listed again
+			// next time, in case those children are no longer skipped.
+			return
 		}
-		if childHash != nil {
-			childHashes[Path(entry.Name())] = childHash
+		latestInfo, err := os.Lstat(string(p))
+		if err != nil || !latestInfo.ModTime().Equal(info.ModTime()) {
+			// The entries might have changed while we were snapshotting them.
+			return
+		}
+		if !latestInfo.ModTime().Before(startTimeSec.Add(-1 * time.Second)) {
+			// An entry could have changed after being listed without updating the timestamp.
+			return
+		}
+		sn.s.CachePathInfo(ctx, p, info)
+	}()
+	if w.spilled() {
+		return sn.snapshotLargeDirectory(ctx, p, info, w)
+	}
+	childTree := w.tree
+	contentsHash, err := sn.s.StoreObject(ctx, strings.NewReader(childTree.Encode(sn.formatVersion)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure storing the contents of the directory %q: %w", p, err)
+	}
+	var prevTree Tree
+	if sn.tombstones && !sn.deterministic {
+		// The previous tree is only needed to find the deleted children.
+		_, prevTree, _ = sn.previousTree(ctx, p)
+	}
+	return sn.snapshotFileMetadata(ctx, p, info, contentsHash, sn.tombstoneMetadata(prevTree, childTree))
+}
+
+// snapshotLargeDirectory stores the contents of a directory whose entries were spilled by `w`.
+//
+// Neither the new nor the previous contents are held in memory.
+func (sn *Snapshotter) snapshotLargeDirectory(ctx context.Context, p Path, info os.FileInfo, w *treeWriter) (*Hash, *File, error) {
+	encoded, err := w.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	contentsHash, err := sn.s.StoreObject(ctx, encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure storing the contents of the directory %q: %w", p, err)
+	}
+	var metadata map[string]string
+	if reader, ok := sn.s.(ObjectReader); ok && sn.tombstones && !sn.deterministic {
+		_, prev, err := sn.s.FindSnapshot(ctx, p)
+		if err == nil && prev != nil && prev.IsDir() && !prev.Contents.Equal(contentsHash) {
+			deleted, err := sn.deletedChildren(ctx, reader, prev.Contents, contentsHash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failure comparing the contents of the directory %q to its previous snapshot: %w", p, err)
+			}
+			metadata = sn.deletedMetadata(deleted)
 		}
 	}
-	contentsJson := []byte(childHashes.String())
-	contentsHash, err := s.StoreObject(ctx, bytes.NewReader(contentsJson))
-	return snapshotFileMetadata(ctx, s, p, info, contentsHash)
+	return sn.snapshotFileMetadata(ctx, p, info, contentsHash, metadata)
 }
 
-func snapshotLink(ctx context.Context, s Storage, p Path, info os.FileInfo) (*Hash, *File, error) {
+// deletedChildren returns the entries of the encoded tree `prev` that are missing from the encoded tree `curr`.
+func (sn *Snapshotter) deletedChildren(ctx context.Context, reader ObjectReader, prev, curr *Hash) (Tree, error) {
+	prevContents, err := reader.ReadObject(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	defer prevContents.Close()
+	currContents, err := reader.ReadObject(ctx, curr)
+	if err != nil {
+		return nil, err
+	}
+	defer currContents.Close()
+	return deletedEntries(prevContents, currContents)
+}
+
+func (sn *Snapshotter) snapshotLink(ctx context.Context, p Path, info os.FileInfo) (*Hash, *File, error) {
 	target, err := os.Readlink(string(p))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the link target for %q: %v", p, err)
+		return nil, nil, fmt.Errorf("failure reading the link target for %q: %w", p, err)
 	}
 
-	h, err := s.StoreObject(ctx, strings.NewReader(target))
+	h, err := sn.s.StoreObject(ctx, strings.NewReader(target))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure storing an object: %v", err)
+		return nil, nil, fmt.Errorf("failure storing an object: %w", err)
 	}
-	return snapshotFileMetadata(ctx, s, p, info, h)
+	return sn.snapshotFileMetadata(ctx, p, info, h, nil)
 }
 
-// Current generates a snapshot for the given path, stored in the given store.
+// Snapshot generates a snapshot for the given path.
 //
 // The passed in path must be an absolute path.
 //
 // The returned value is the hash of the generated `snapshot.File` object.
-func Current(ctx context.Context, s Storage, p Path) (*Hash, *File, error) {
-	if s.Exclude(p) {
+//
+// If any of the snapshotter's limits are exceeded, then snapshotting
+// stops with an error describing the exceeded limit.
+//
+// If verification is enabled, then the snapshot is repeated while files
+// change during it; see `WithVerification`.
+//
+// If newest-first ordering is enabled, then the changed files are
+// snapshotted before anything else; see `WithNewestFirst`.
+func (sn *Snapshotter) Snapshot(ctx context.Context, p Path) (h *Hash, f *File, err error) {
+	if sn.newestFirst {
+		if err := sn.snapshotNewestFirst(ctx, p); err != nil {
+			return nil, nil, err
+		}
+	}
+	if sn.verifyRetries > 0 && !sn.deterministic {
+		return sn.snapshotVerified(ctx, p)
+	}
+	return sn.snapshot(ctx, p, 0)
+}
+
+// snapshot generates a snapshot for the path `p`, which is `depth` directories below the path passed to `Snapshot`.
+func (sn *Snapshotter) snapshot(ctx context.Context, p Path, depth int) (h *Hash, f *File, err error) {
+	if sn.s.Exclude(p) {
 		// We are not supposed to store snapshots for the given path, so pretend it does not exist.
 		return nil, nil, nil
 	}
@@ -179,10 +571,23 @@ func Current(ctx context.Context, s Storage, p Path) (*Hash, *File, error) {
 		return nil, nil, nil
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the file stat for %q: %v", p, err)
+		return nil, nil, fmt.Errorf("failure reading the file stat for %q: %w", p, err)
+	}
+	if sn.excluded(p, stat) {
+		return nil, nil, nil
+	}
+	if err := sn.checkLimits(p, stat, depth); err != nil {
+		return nil, nil, err
+	}
+	if sn.progress != nil {
+		defer func() {
+			if err == nil && h != nil {
+				sn.progress(p, stat, h)
+			}
+		}()
 	}
 	if stat.Mode()&fs.ModeSymlink != 0 {
-		return snapshotLink(ctx, s, p, stat)
+		return sn.snapshotLink(ctx, p, stat)
 	}
 	contents, err := os.Open(string(p))
 	if os.IsNotExist(err) {
@@ -194,17 +599,28 @@ func Current(ctx context.Context, s Storage, p Path) (*Hash, *File, error) {
 		return nil, nil, nil
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the file %q: %v", p, err)
+		return nil, nil, fmt.Errorf("failure reading the file %q: %w", p, err)
 	}
 	defer contents.Close()
 
 	info, err := contents.Stat()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the filesystem metadata for %q: %v", p, err)
+		return nil, nil, fmt.Errorf("failure reading the filesystem metadata for %q: %w", p, err)
 	}
 	if info.IsDir() {
-		return snapshotDirectory(ctx, s, p, info, contents)
+		return sn.snapshotDirectory(ctx, p, info, contents, depth)
 	} else {
-		return snapshotRegularFile(ctx, s, p, info, contents)
+		return sn.snapshotRegularFile(ctx, p, info, contents)
 	}
 }
+
+// Current generates a snapshot for the given path, stored in the given store.
+//
+// This is equivalent to calling `Snapshot` on a `Snapshotter` with the default options.
+//
+// The passed in path must be an absolute path.
+//
+// The returned value is the hash of the generated `snapshot.File` object.
+func Current(ctx context.Context, s Storage, p Path) (*Hash, *File, error) {
+	return NewSnapshotter(s).Snapshot(ctx, p)
+}
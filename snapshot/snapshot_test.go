@@ -34,6 +34,12 @@ type storageForTest struct {
 	snapshots    map[Path]*Hash
 	cache        map[Path]os.FileInfo
 	cacheModTime map[Path]time.Time
+
+	// storeCount is the number of times that `StoreObject` has been called.
+	storeCount int
+
+	// listCount is the number of times that `ListDirectorySnapshotContents` has been called.
+	listCount int
 }
 
 // StoreObject persists the contents of the given reader, returning the resulting hash of those contents.
@@ -45,6 +51,7 @@ func (s *storageForTest) StoreObject(ctx context.Context, reader io.Reader) (*Ha
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.storeCount++
 	if s.objects == nil {
 		s.objects = make(map[Hash][]byte)
 	}
@@ -81,7 +88,7 @@ func (s *storageForTest) FindSnapshot(ctx context.Context, p Path) (*Hash, *File
 	}
 	f, err := ParseFile(string(bs))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure parsing the previously saved snapshot %q: %v", string(bs), err)
+		return nil, nil, fmt.Errorf("failure parsing the previously saved snapshot %q: %w", string(bs), err)
 	}
 	return h, f, nil
 }
@@ -104,6 +111,29 @@ func (s *storageForTest) StoreSnapshot(ctx context.Context, p Path, f *File) (*H
 	return h, nil
 }
 
+// ListDirectorySnapshotContents returns the contents of the directory snapshot `f`.
+func (s *storageForTest) ListDirectorySnapshotContents(ctx context.Context, h *Hash, f *File) (Tree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listCount++
+	bs, ok := s.objects[*f.Contents]
+	if !ok {
+		return nil, fmt.Errorf("failure reading the contents of %q", h)
+	}
+	return ParseTree(string(bs))
+}
+
+// ReadObject opens the object with the given hash for reading.
+func (s *storageForTest) ReadObject(ctx context.Context, h *Hash) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bs, ok := s.objects[*h]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(bs)), nil
+}
+
 // CachePathInfo caches the file information for the given path.
 //
 // This is used to avoid rehashing the contents of files that have
@@ -253,3 +283,271 @@ func TestCurrentSingleFile(t *testing.T) {
 		t.Error("failed to set the cached snapshot as the first parent of the update to the cached snapshot")
 	}
 }
+
+func TestSnapshotterDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := os.MkdirAll(filepath.Join(dir, name, "nested"), 0700); err != nil {
+			t.Fatalf("failure creating the example directory %q: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "nested", "example.txt"), []byte(name), 0700); err != nil {
+			t.Fatalf("failure creating the example file in %q: %v", name, err)
+		}
+	}
+	p := Path(dir)
+	s := &storageForTest{}
+	ctx := context.Background()
+
+	h1, _, err := NewSnapshotter(s, WithConcurrency(4)).Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure creating the initial snapshot: %v", err)
+	}
+	deterministic := NewSnapshotter(s, WithDeterministic(true), WithConcurrency(4))
+	h2, _, err := deterministic.Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure creating the deterministic snapshot: %v", err)
+	} else if got, want := h2, h1; !got.Equal(want) {
+		t.Errorf("unexpected hash for the deterministic snapshot; got %q, want %q", got, want)
+	}
+
+	// Change a file and then change it back, so the history differs but the contents do not.
+	file := filepath.Join(dir, "a", "nested", "example.txt")
+	if err := os.WriteFile(file, []byte("changed"), 0700); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	if _, _, err := NewSnapshotter(s).Snapshot(ctx, p); err != nil {
+		t.Fatalf("failure snapshotting the updated file: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("a"), 0700); err != nil {
+		t.Fatalf("failure reverting the example file: %v", err)
+	}
+	h3, _, err := NewSnapshotter(s).Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the reverted file: %v", err)
+	} else if h3.Equal(h1) {
+		t.Error("unexpected reuse of the initial snapshot after the history changed")
+	}
+	h4, _, err := deterministic.Snapshot(ctx, p)
+	if err != nil {
+		t.Fatalf("failure recreating the deterministic snapshot: %v", err)
+	} else if got, want := h4, h2; !got.Equal(want) {
+		t.Errorf("unexpected hash for the recreated deterministic snapshot; got %q, want %q", got, want)
+	}
+	if latest, _, err := s.FindSnapshot(ctx, p); err != nil {
+		t.Errorf("failure looking up the latest snapshot: %v", err)
+	} else if got, want := latest, h3; !got.Equal(want) {
+		t.Errorf("deterministic snapshot changed the latest snapshot; got %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotterLimits(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0700); err != nil {
+		t.Fatalf("failure creating the example directories: %v", err)
+	}
+	for _, name := range []string{"one.txt", "two.txt", "three.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, "a", name), []byte("0123456789"), 0700); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	testCases := []struct {
+		Description string
+		Limits      Limits
+		WantError   bool
+	}{
+		{
+			Description: "no limits",
+		},
+		{
+			Description: "within all limits",
+			Limits:      Limits{MaxDepth: 3, MaxFiles: 7, MaxTotalSize: 30},
+		},
+		{
+			Description: "too deep",
+			Limits:      Limits{MaxDepth: 2},
+			WantError:   true,
+		},
+		{
+			Description: "too many files",
+			Limits:      Limits{MaxFiles: 6},
+			WantError:   true,
+		},
+		{
+			Description: "too large",
+			Limits:      Limits{MaxTotalSize: 29},
+			WantError:   true,
+		},
+	}
+	for _, testCase := range testCases {
+		sn := NewSnapshotter(&storageForTest{}, WithLimits(testCase.Limits))
+		_, _, err := sn.Snapshot(context.Background(), Path(dir))
+		if testCase.WantError && err == nil {
+			t.Errorf("unexpected success for the test case %q", testCase.Description)
+		} else if !testCase.WantError && err != nil {
+			t.Errorf("unexpected failure for the test case %q: %v", testCase.Description, err)
+		}
+	}
+}
+
+func TestSnapshotterAuthor(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(file, []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	s := &storageForTest{}
+	ctx := context.Background()
+	h1, f1, err := NewSnapshotter(s, WithAuthor("alice@example", "v1")).Snapshot(ctx, Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if got, want := f1.Metadata[AuthorMetadataKey], "alice@example"; got != want {
+		t.Errorf("unexpected author: got %q, want %q", got, want)
+	}
+	if got, want := f1.Metadata[VersionMetadataKey], "v1"; got != want {
+		t.Errorf("unexpected version: got %q, want %q", got, want)
+	}
+	// A different author snapshotting an unchanged file should not generate a new snapshot.
+	h2, _, err := NewSnapshotter(s, WithAuthor("bob@example", "v2")).Snapshot(ctx, Path(file))
+	if err != nil {
+		t.Fatalf("failure resnapshotting the example file: %v", err)
+	} else if !h2.Equal(h1) {
+		t.Errorf("unexpected new snapshot for an unchanged file: got %q, want %q", h2, h1)
+	}
+}
+
+func TestSnapshotterReusesUnchangedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a", "b", "file")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		t.Fatalf("failure creating the example directories: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("example"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	// Only paths that have not changed recently are cached.
+	old := time.Now().Add(-time.Hour)
+	for _, p := range []string{file, filepath.Join(dir, "a", "b"), filepath.Join(dir, "a"), dir} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("failure updating the timestamps of %q: %v", p, err)
+		}
+	}
+	s := &storageForTest{}
+	ctx := context.Background()
+	h1, _, err := NewSnapshotter(s).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure creating the initial snapshot: %v", err)
+	}
+	storeCount, listCount := s.storeCount, s.listCount
+	h2, _, err := NewSnapshotter(s).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure recreating the snapshot: %v", err)
+	} else if !h2.Equal(h1) {
+		t.Errorf("unexpected snapshot for an unchanged directory: got %q, want %q", h2, h1)
+	}
+	if got := s.storeCount - storeCount; got != 0 {
+		t.Errorf("unexpected objects stored for unchanged directories: got %d, want 0", got)
+	}
+	if got := s.listCount - listCount; got != 0 {
+		t.Errorf("unexpected reads of the previous contents of unchanged directories: got %d, want 0", got)
+	}
+
+	// Changing the file leaves the path info of its directories
+	// untouched, but they must still be snapshotted again.
+	if err := os.WriteFile(file, []byte("changed"), 0700); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	h3, _, err := NewSnapshotter(s).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the changed directory: %v", err)
+	} else if h3.Equal(h1) {
+		t.Errorf("unexpected reuse of the previous snapshot for a changed directory: %q", h3)
+	}
+}
+
+func TestSnapshotterTombstones(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"kept", "removed"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0700); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	s := &storageForTest{}
+	ctx := context.Background()
+	sn := NewSnapshotter(s, WithTombstones(true))
+	h1, f1, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure creating the initial snapshot: %v", err)
+	}
+	if tombstones, err := f1.Tombstones(); err != nil || tombstones != nil {
+		t.Errorf("unexpected tombstones in the initial snapshot: %v, %v", tombstones, err)
+	}
+	prevTree, err := s.ListDirectorySnapshotContents(ctx, h1, f1)
+	if err != nil {
+		t.Fatalf("failure listing the initial snapshot: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "removed")); err != nil {
+		t.Fatalf("failure removing the example file: %v", err)
+	}
+	_, f2, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure creating the updated snapshot: %v", err)
+	}
+	tombstones, err := f2.Tombstones()
+	if err != nil {
+		t.Fatalf("failure reading the tombstones: %v", err)
+	}
+	if got, want := tombstones.String(), (Tree{"removed": prevTree["removed"]}).String(); got != want {
+		t.Errorf("unexpected tombstones: got %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotterLargeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0700); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	ctx := context.Background()
+	_, small, err := NewSnapshotter(&storageForTest{}).Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory in memory: %v", err)
+	}
+
+	defer func(entries, batch int) {
+		maxInMemoryTreeEntries, dirReadBatchSize = entries, batch
+	}(maxInMemoryTreeEntries, dirReadBatchSize)
+	maxInMemoryTreeEntries, dirReadBatchSize = 3, 2
+	s := &storageForTest{}
+	sn := NewSnapshotter(s, WithTombstones(true))
+	h1, large, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory incrementally: %v", err)
+	}
+	if !large.Contents.Equal(small.Contents) {
+		t.Errorf("unexpected contents for the incrementally encoded directory: got %q, want %q", large.Contents, small.Contents)
+	}
+	prevTree, err := s.ListDirectorySnapshotContents(ctx, h1, large)
+	if err != nil {
+		t.Fatalf("failure listing the initial snapshot: %v", err)
+	}
+	for _, name := range []string{"file-3", "file-7"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("failure removing the example file %q: %v", name, err)
+		}
+	}
+	_, f2, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure creating the updated snapshot: %v", err)
+	}
+	tombstones, err := f2.Tombstones()
+	if err != nil {
+		t.Fatalf("failure reading the tombstones: %v", err)
+	}
+	want := Tree{"file-3": prevTree["file-3"], "file-7": prevTree["file-7"]}
+	if got := tombstones.String(); got != want.String() {
+		t.Errorf("unexpected tombstones: got %q, want %q", got, want.String())
+	}
+}
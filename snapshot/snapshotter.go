@@ -0,0 +1,368 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Excluder decides whether or not a path should be left out of a snapshot.
+type Excluder interface {
+	// Exclude reports whether or not the given path, with the given
+	// file information, should be excluded.
+	Exclude(Path, os.FileInfo) bool
+}
+
+// ExcludeFunc adapts an ordinary function to the `Excluder` interface.
+type ExcludeFunc func(Path, os.FileInfo) bool
+
+// Exclude implements the `Excluder` interface.
+func (e ExcludeFunc) Exclude(p Path, info os.FileInfo) bool {
+	return e(p, info)
+}
+
+// MetadataPolicy controls which file metadata is recorded in snapshots.
+type MetadataPolicy int
+
+const (
+	// RecordMode records the complete file mode, including permissions.
+	RecordMode MetadataPolicy = iota
+
+	// RecordFileType records the type of each file, but replaces its
+	// permissions with defaults that only preserve whether or not the
+	// file is executable.
+	//
+	// This is useful when snapshotting files on file systems that do
+	// not reliably preserve permissions.
+	RecordFileType
+)
+
+// ProgressFunc is called each time a path has been snapshotted.
+//
+// When the snapshotter runs with a concurrency greater than one, this
+// may be called concurrently from multiple goroutines.
+type ProgressFunc func(p Path, info os.FileInfo, h *Hash)
+
+// FilterMetadataKey is the `File.Metadata` key under which the name of
+// the content filter applied to a regular file is recorded.
+const FilterMetadataKey = "filter"
+
+const (
+	// AuthorMetadataKey is the `File.Metadata` key under which the
+	// identity of the author of a snapshot is recorded.
+	AuthorMetadataKey = "author"
+
+	// VersionMetadataKey is the `File.Metadata` key under which the
+	// version of rvcs that generated a snapshot is recorded.
+	VersionMetadataKey = "rvcs-version"
+
+	// TimeMetadataKey is the `File.Metadata` key under which the time
+	// that a snapshot was generated is recorded, in RFC 3339 format.
+	TimeMetadataKey = "time"
+)
+
+// MergeStrategyMetadataKey is the `File.Metadata` key under which the
+// strategy used to automatically resolve conflicts in a merge is recorded.
+const MergeStrategyMetadataKey = "merge-strategy"
+
+// provenanceKeys are the metadata keys describing how a snapshot was
+// generated rather than the file itself, so they are ignored when
+// deciding whether or not a file has changed.
+var provenanceKeys = []string{AuthorMetadataKey, VersionMetadataKey, TimeMetadataKey}
+
+// unchangedKeys are the metadata keys ignored when deciding whether or
+// not a file has changed.
+//
+// In addition to the provenance keys, this includes the keys whose
+// values are determined entirely by the contents of the file, by how
+// those contents differ from the previous snapshot, or by how the
+// previous snapshot was merged.
+var unchangedKeys = append([]string{ContentTypeMetadataKey, DeletedMetadataKey, MergeStrategyMetadataKey}, provenanceKeys...)
+
+// ContentFilter transforms the contents of regular files before they are stored.
+//
+// The name of the filter is recorded in the metadata of each snapshot it
+// was applied to, so that the inverse transformation can be applied when
+// the snapshot is restored.
+type ContentFilter interface {
+	// Name returns the name identifying the filter.
+	Name() string
+
+	// Matches reports whether or not the filter applies to the given path.
+	Matches(Path) bool
+
+	// Clean reads the contents of a file from `r` and writes the
+	// transformed contents that should be stored to `w`.
+	Clean(ctx context.Context, r io.Reader, w io.Writer) error
+}
+
+// Limits bounds how much a `Snapshotter` will snapshot.
+//
+// These guard against accidentally snapshotting far more than intended,
+// such as the entire file system or a runaway tree of recursive links.
+//
+// A zero value for any of the limits means that limit is not enforced.
+type Limits struct {
+	// MaxDepth is the maximum number of directories below the
+	// snapshotted path that will be descended into.
+	MaxDepth int
+
+	// MaxFiles is the maximum number of files, including directories
+	// and links, that will be snapshotted.
+	MaxFiles int64
+
+	// MaxTotalSize is the maximum total size, in bytes, of the regular
+	// files that will be snapshotted.
+	MaxTotalSize int64
+}
+
+// LimitError is the error reported when a snapshot exceeds one of its `Limits`.
+type LimitError struct {
+	// Limit is the name of the limit that was exceeded.
+	Limit string
+
+	// Max is the configured value of the limit.
+	Max int64
+
+	// Path is the path at which the limit was exceeded.
+	Path Path
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("snapshot of %q exceeds the %s limit of %d", e.Path, e.Limit, e.Max)
+}
+
+// Snapshotter generates snapshots of files and stores them in a `Storage`.
+type Snapshotter struct {
+	s              Storage
+	workers        chan struct{}
+	excluders      []Excluder
+	metadataPolicy MetadataPolicy
+	progress       ProgressFunc
+	deterministic  bool
+	filters        []ContentFilter
+	scanners       []Scanner
+	limits         Limits
+	author         string
+	version        string
+	recordTime     bool
+	limiter        *rateLimiter
+	inFlight       *byteBudget
+	readBufferSize int
+	largeFileSize  int64
+	contentTypes   bool
+	formatVersion  FormatVersion
+	tombstones     bool
+	directoryTimes bool
+	xattrs         []string
+
+	detectOpenFiles bool
+	openFiles       openFiles
+
+	verifyRetries int
+	verify        verification
+
+	newestFirst bool
+	prioritized prioritized
+
+	findings findings
+
+	// fileCount and totalSize are the running totals checked against `limits`.
+	fileCount int64
+	totalSize int64
+
+	// cacheHits and cacheMisses count the lookups in the path info cache.
+	cacheHits   int64
+	cacheMisses int64
+
+	// reusedPaths holds the paths whose previous snapshots were reused
+	// via the path info cache, until their parent directory checks them.
+	reusedPaths sync.Map
+}
+
+// Option configures a `Snapshotter`.
+type Option func(*Snapshotter)
+
+// WithConcurrency sets the maximum number of paths that are snapshotted at the same time.
+//
+// The default is 1, meaning paths are snapshotted sequentially.
+func WithConcurrency(n int) Option {
+	return func(sn *Snapshotter) {
+		if n < 1 {
+			n = 1
+		}
+		// The goroutine calling `Snapshot` counts as one of the workers.
+		sn.workers = make(chan struct{}, n-1)
+	}
+}
+
+// WithExcluder adds an additional rule for excluding paths from snapshots.
+//
+// Paths excluded by the storage are always excluded in addition to these.
+func WithExcluder(e Excluder) Option {
+	return func(sn *Snapshotter) {
+		sn.excluders = append(sn.excluders, e)
+	}
+}
+
+// WithMetadataPolicy sets which file metadata is recorded in snapshots.
+func WithMetadataPolicy(policy MetadataPolicy) Option {
+	return func(sn *Snapshotter) {
+		sn.metadataPolicy = policy
+	}
+}
+
+// WithProgress sets a function that is called each time a path is snapshotted.
+func WithProgress(progress ProgressFunc) Option {
+	return func(sn *Snapshotter) {
+		sn.progress = progress
+	}
+}
+
+// WithDeterministic enables or disables deterministic mode.
+//
+// In deterministic mode, the generated snapshots depend only on the
+// current state of the files, so identical trees always produce
+// identical hashes. The previous snapshots of a path are not recorded
+// as its parents, the path info cache is not used, and the latest
+// snapshot recorded for each path is left unchanged.
+func WithDeterministic(deterministic bool) Option {
+	return func(sn *Snapshotter) {
+		sn.deterministic = deterministic
+	}
+}
+
+// WithFilters adds content filters for regular files.
+//
+// Each regular file is passed through the first filter that matches its
+// path, if any.
+func WithFilters(filters ...ContentFilter) Option {
+	return func(sn *Snapshotter) {
+		sn.filters = append(sn.filters, filters...)
+	}
+}
+
+// WithLimits sets limits on how much will be snapshotted.
+//
+// The limits apply to the total across all calls to `Snapshot` on the
+// resulting `Snapshotter`.
+func WithLimits(limits Limits) Option {
+	return func(sn *Snapshotter) {
+		sn.limits = limits
+	}
+}
+
+// WithAuthor records the given author identity and rvcs version in each new snapshot.
+//
+// Either value may be empty, in which case it is not recorded. These are
+// not recorded in deterministic mode, since they do not depend on the
+// state of the files.
+func WithAuthor(author, version string) Option {
+	return func(sn *Snapshotter) {
+		sn.author = author
+		sn.version = version
+	}
+}
+
+// WithRecordTime enables or disables recording the time each new snapshot was generated.
+//
+// The time is not recorded in deterministic mode.
+func WithRecordTime(recordTime bool) Option {
+	return func(sn *Snapshotter) {
+		sn.recordTime = recordTime
+	}
+}
+
+// NewSnapshotter returns a `Snapshotter` that stores snapshots in `s`.
+func NewSnapshotter(s Storage, opts ...Option) *Snapshotter {
+	sn := &Snapshotter{
+		s:       s,
+		workers: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(sn)
+	}
+	return sn
+}
+
+func (sn *Snapshotter) excluded(p Path, info os.FileInfo) bool {
+	for _, e := range sn.excluders {
+		if e.Exclude(p, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLimits counts the given path towards the limits of the snapshotter,
+// and reports an error if any of them are exceeded.
+func (sn *Snapshotter) checkLimits(p Path, info os.FileInfo, depth int) error {
+	if max := sn.limits.MaxDepth; max > 0 && depth > max {
+		return &LimitError{Limit: "max depth", Max: int64(max), Path: p}
+	}
+	if max := sn.limits.MaxFiles; max > 0 && atomic.AddInt64(&sn.fileCount, 1) > max {
+		return &LimitError{Limit: "max files", Max: max, Path: p}
+	}
+	if max := sn.limits.MaxTotalSize; max > 0 && info.Mode().IsRegular() && atomic.AddInt64(&sn.totalSize, info.Size()) > max {
+		return &LimitError{Limit: "max total size", Max: max, Path: p}
+	}
+	return nil
+}
+
+// provenance returns the metadata describing who generated new snapshots.
+func (sn *Snapshotter) provenance() map[string]string {
+	if sn.deterministic {
+		return nil
+	}
+	metadata := make(map[string]string)
+	if len(sn.author) > 0 {
+		metadata[AuthorMetadataKey] = sn.author
+	}
+	if len(sn.version) > 0 {
+		metadata[VersionMetadataKey] = sn.version
+	}
+	if sn.recordTime {
+		metadata[TimeMetadataKey] = timeNow().UTC().Format(time.RFC3339Nano)
+	}
+	return metadata
+}
+
+func (sn *Snapshotter) filterFor(p Path) ContentFilter {
+	for _, f := range sn.filters {
+		if f.Matches(p) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (sn *Snapshotter) modeLine(info os.FileInfo) string {
+	mode := info.Mode()
+	if sn.metadataPolicy == RecordFileType {
+		perm := fs.FileMode(0644)
+		if mode.IsDir() || mode&fs.ModeSymlink != 0 || mode&0111 != 0 {
+			perm = 0755
+		}
+		mode = mode.Type() | perm
+	}
+	return mode.String()
+}
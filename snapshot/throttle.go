@@ -0,0 +1,97 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the combined rate of reads across multiple readers.
+type rateLimiter struct {
+	bytesPerSecond int64
+
+	mu sync.Mutex
+	// next is the earliest time at which the next read may proceed.
+	next time.Time
+}
+
+// wait blocks until `n` more bytes may be read without exceeding the rate limit.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// throttledReader is an `io.Reader` whose reads are limited by a `rateLimiter`.
+type throttledReader struct {
+	ctx     context.Context
+	limiter *rateLimiter
+	r       io.Reader
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Keep individual reads small so that the rate stays smooth.
+	if max := int(t.limiter.bytesPerSecond / 10); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.wait(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// WithReadRateLimit limits the combined rate at which file contents are read, in bytes per second.
+//
+// This reduces the impact of snapshotting on other programs using the
+// same disk. A limit of zero or less means reads are not limited.
+func WithReadRateLimit(bytesPerSecond int64) Option {
+	return func(sn *Snapshotter) {
+		if bytesPerSecond <= 0 {
+			sn.limiter = nil
+			return
+		}
+		sn.limiter = &rateLimiter{bytesPerSecond: bytesPerSecond}
+	}
+}
+
+// throttle wraps the given reader so that it obeys the snapshotter's read rate limit, if any.
+func (sn *Snapshotter) throttle(ctx context.Context, r io.Reader) io.Reader {
+	if sn.limiter == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, limiter: sn.limiter, r: r}
+}
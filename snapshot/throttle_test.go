@@ -0,0 +1,42 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	ctx := context.Background()
+	sn := NewSnapshotter(&storageForTest{}, WithReadRateLimit(100*1024))
+	contents := make([]byte, 30*1024)
+	start := time.Now()
+	got, err := io.ReadAll(sn.throttle(ctx, bytes.NewReader(contents)))
+	if err != nil {
+		t.Fatalf("failure reading the throttled contents: %v", err)
+	}
+	elapsed := time.Since(start)
+	if !bytes.Equal(got, contents) {
+		t.Error("throttled contents do not match the original")
+	}
+	// The first read is allowed immediately, so the minimum time is for the remaining 20KiB.
+	if min := 200 * time.Millisecond; elapsed < min {
+		t.Errorf("throttled read finished too quickly: got %v, want at least %v", elapsed, min)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"fmt"
+)
+
+// DeletedMetadataKey is the `File.Metadata` key under which the
+// tombstones for the children deleted from a directory are recorded.
+//
+// The value is an encoded `Tree` mapping the name of each deleted child
+// to its last snapshot before it was deleted. The deletion time is the
+// time that the directory snapshot itself was generated.
+const DeletedMetadataKey = "deleted"
+
+// WithTombstones enables or disables recording tombstones for deleted files.
+//
+// When enabled, each new directory snapshot records which children
+// were deleted since the previous snapshot of the directory, along
+// with their last snapshots. Tombstones are not recorded in
+// deterministic mode, since they depend on the previous snapshots.
+func WithTombstones(tombstones bool) Option {
+	return func(sn *Snapshotter) {
+		sn.tombstones = tombstones
+	}
+}
+
+// Tombstones returns the children that were deleted from the directory
+// since its previous snapshot, mapped to their last snapshots.
+//
+// The returned value is nil if no tombstones were recorded.
+func (f *File) Tombstones() (Tree, error) {
+	if f == nil {
+		return nil, nil
+	}
+	encoded, ok := f.Metadata[DeletedMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+	t, err := ParseTree(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the tombstones: %w", err)
+	}
+	return t, nil
+}
+
+// tombstoneMetadata returns the metadata recording the children of
+// `prevTree` that are missing from `tree`.
+//
+// The returned value is nil if no children were deleted.
+func (sn *Snapshotter) tombstoneMetadata(prevTree, tree Tree) map[string]string {
+	if !sn.tombstones || sn.deterministic {
+		return nil
+	}
+	deleted := make(Tree)
+	for child, h := range prevTree {
+		if _, ok := tree[child]; !ok {
+			deleted[child] = h
+		}
+	}
+	return sn.deletedMetadata(deleted)
+}
+
+// deletedMetadata returns the metadata recording the given deleted children.
+//
+// The returned value is nil if no children were deleted.
+func (sn *Snapshotter) deletedMetadata(deleted Tree) map[string]string {
+	if len(deleted) == 0 {
+		return nil
+	}
+	return map[string]string{DeletedMetadataKey: deleted.String()}
+}
@@ -18,8 +18,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Path represents the filesystem path of a file.
@@ -32,6 +34,48 @@ func (p Path) Join(child Path) Path {
 	return Path(filepath.Join(string(p), string(child)))
 }
 
+// Relocate returns the path this would have if `old` were moved to `new`.
+//
+// The returned boolean is false, and the path is returned unchanged,
+// if this path is neither `old` nor a path within it.
+func (p Path) Relocate(old, new Path) (Path, bool) {
+	if p == old {
+		return new, true
+	}
+	prefix := strings.TrimSuffix(string(old), string(filepath.Separator)) + string(filepath.Separator)
+	if !strings.HasPrefix(string(p), prefix) {
+		return p, false
+	}
+	return new.Join(Path(strings.TrimPrefix(string(p), prefix))), true
+}
+
+// Display returns the path in a form that is safe to print on a single line.
+//
+// Paths containing newlines or other control characters, paths that
+// are not valid UTF-8, and paths that start with a double quote are
+// quoted using Go syntax. All other paths are returned as-is.
+func (p Path) Display() string {
+	str := string(p)
+	if strings.HasPrefix(str, `"`) || strings.IndexFunc(str, unicode.IsControl) >= 0 || !utf8.ValidString(str) {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// ValidChildName reports whether or not `name` can be the name of an entry in a directory's `Tree`.
+//
+// Any name that a filesystem could hold is valid, including names with
+// newlines and other control characters. Names that are empty, that
+// contain a path separator or a NUL byte, or that refer to the
+// directory itself or its parent are not.
+func ValidChildName(name Path) bool {
+	str := string(name)
+	if len(str) == 0 || str == "." || str == ".." {
+		return false
+	}
+	return !strings.ContainsAny(str, "/\x00") && !strings.ContainsRune(str, filepath.Separator)
+}
+
 func (p Path) encode() string {
 	return base64.RawStdEncoding.EncodeToString([]byte(p))
 }
@@ -39,7 +83,7 @@ func (p Path) encode() string {
 func decodePath(encoded string) (Path, error) {
 	decoded, err := base64.RawStdEncoding.DecodeString(encoded)
 	if err != nil {
-		return Path(""), fmt.Errorf("failure decoding the encoded path string %q: %v", encoded, err)
+		return Path(""), fmt.Errorf("failure decoding the encoded path string %q: %w", encoded, err)
 	}
 	return Path(decoded), nil
 }
@@ -52,42 +96,82 @@ type Tree map[Path]*Hash
 
 // String implements the `fmt.Stringer` interface.
 //
-// The resulting value is suitable for serialization.
+// The resulting value is suitable for serialization, and is in the `LegacyFormat`.
 func (t Tree) String() string {
-	var lines []string
-	for p, h := range t {
-		if h != nil {
-			line := p.encode() + " " + h.String()
-			lines = append(lines, line)
-		}
+	return t.Encode(LegacyFormat)
+}
+
+// Encode serializes the tree in the given format version.
+//
+// The result is canonical, so logically identical trees always have
+// identical encodings.
+func (t Tree) Encode(v FormatVersion) string {
+	if v.binary() {
+		return encodeBinaryTree(v, t)
 	}
-	sort.Strings(lines)
-	return strings.Join(lines, "\n")
+	return strings.Join(append(v.header(), encodedLines(t)...), "\n")
 }
 
 // ParseTree parses a `Tree` object from its encoded form.
 //
-// The input string must match the form returned by the `Tree.String` method.
+// The input string must match the form returned by the `Tree.Encode`
+// method, in any format version. Any extension fields are ignored.
 func ParseTree(encoded string) (Tree, error) {
+	if isBinary(encoded) {
+		t, err := parseBinaryTree(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the binary encoded tree %q: %w", encoded, err)
+		}
+		return t, nil
+	}
 	t := make(Tree)
-	lines := strings.Split(encoded, "\n")
+	version, lines, err := splitFormatHeader(strings.Split(encoded, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the format header of the encoded tree %q: %w", encoded, err)
+	}
 	for _, line := range lines {
-		if len(line) == 0 {
+		if len(line) == 0 || isTreeExtension(version, line) {
 			continue
 		}
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("malformed entry %q in encoded tree %q", line, encoded)
-		}
-		p, err := decodePath(parts[0])
+		encodedPath, h, err := splitTreeEntry(line)
 		if err != nil {
-			return nil, fmt.Errorf("failure parsing encoded path %q: %v", parts[0], err)
+			return nil, fmt.Errorf("%v in encoded tree %q", err, encoded)
 		}
-		h, err := ParseHash(parts[1])
+		p, err := decodePath(encodedPath)
 		if err != nil {
-			return nil, fmt.Errorf("failure parsing encoded hash %q: %v", parts[1], err)
+			return nil, fmt.Errorf("failure parsing encoded path %q: %w", encodedPath, err)
 		}
 		t[p] = h
 	}
 	return t, nil
 }
+
+// splitTreeEntry splits a line of an encoded tree into its encoded path and its hash.
+func splitTreeEntry(line string) (string, *Hash, error) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("malformed entry %q", line)
+	}
+	h, err := ParseHash(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("failure parsing encoded hash %q: %w", parts[1], err)
+	}
+	return parts[0], h, nil
+}
+
+// isTreeExtension reports whether or not the given line of an encoded tree is an extension field.
+//
+// The encoded form of a path may itself start with the extension
+// prefix, so any line that parses as an entry is an entry. Extension
+// fields of trees must never have the same form as an entry.
+func isTreeExtension(v FormatVersion, line string) bool {
+	if !isExtension(v, line) {
+		return false
+	}
+	encodedPath, _, err := splitTreeEntry(line)
+	if err != nil {
+		return true
+	}
+	_, err = decodePath(encodedPath)
+	return err != nil
+}
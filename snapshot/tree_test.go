@@ -14,7 +14,11 @@
 
 package snapshot
 
-import "testing"
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
 
 func TestParseTreeRoundTrip(t *testing.T) {
 	testCases := []struct {
@@ -56,6 +60,16 @@ func TestParseTreeRoundTrip(t *testing.T) {
 			Serialized:  "abcd sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245\n\nefgh sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245\n",
 			Want:        "abcd sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245\nefgh sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245",
 		},
+		{
+			Description: "versioned tree with extensions",
+			Serialized:  "#format 2\nabcd sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245\n+inline abcd 0123",
+			Want:        "abcd sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245",
+		},
+		{
+			Description: "malformed format header",
+			Serialized:  "#format\nabcd sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245",
+			WantError:   true,
+		},
 	}
 	for _, testCase := range testCases {
 		parsed, err := ParseTree(testCase.Serialized)
@@ -70,3 +84,105 @@ func TestParseTreeRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestTreeEncodeVersioned(t *testing.T) {
+	h, err := ParseHash("sha256:d897f1f67a26ce92b59937134d467131537360a63b39316e5c847114a142c245")
+	if err != nil {
+		t.Fatalf("failure parsing the example hash: %v", err)
+	}
+	tree := Tree{Path("a"): h}
+	encoded := tree.Encode(VersionedFormat)
+	if got, want := encoded, "#format 2\n"+tree.String(); got != want {
+		t.Errorf("unexpected encoded tree: got %q, want %q", got, want)
+	}
+	parsed, err := ParseTree(encoded)
+	if err != nil {
+		t.Fatalf("failure parsing the encoded tree %q: %v", encoded, err)
+	} else if got, want := parsed.String(), tree.String(); got != want {
+		t.Errorf("unexpected result for the versioned tree roundtrip: got %q, want %q", got, want)
+	}
+}
+
+func FuzzTreeRoundTrip(f *testing.F) {
+	// The encoding of "\xf8" starts with the extension prefix.
+	for _, name := range []string{"plain", "with space", "new\nline", "tab\t\x01\x7f", "back\\slash", "\"quoted\"", "\xff\xfe", "\xf8", "-dash"} {
+		f.Add(name)
+	}
+	h, err := NewHash(strings.NewReader("example"))
+	if err != nil {
+		f.Fatalf("failure hashing the example contents: %v", err)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if !ValidChildName(Path(name)) {
+			t.Skip()
+		}
+		tree := Tree{Path(name): h, Path(name + "\n"): h}
+		for _, v := range []FormatVersion{LegacyFormat, VersionedFormat, BinaryFormat} {
+			parsed, err := ParseTree(tree.Encode(v))
+			if err != nil {
+				t.Fatalf("failure parsing the encoded tree for %q: %v", name, err)
+			}
+			if len(parsed) != len(tree) || !parsed[Path(name)].Equal(h) || !parsed[Path(name+"\n")].Equal(h) {
+				t.Errorf("unexpected round trip of the tree for %q: got %v, want %v", name, parsed, tree)
+			}
+		}
+	})
+}
+
+func FuzzPathDisplay(f *testing.F) {
+	for _, p := range []string{"/plain/path", "", "new\nline", "\"leading quote", "\xff", "carriage\rreturn"} {
+		f.Add(p)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		displayed := Path(p).Display()
+		if strings.ContainsAny(displayed, "\n\r") {
+			t.Fatalf("the displayed form %q of %q spans multiple lines", displayed, p)
+		}
+		if displayed == p {
+			return
+		}
+		if unquoted, err := strconv.Unquote(displayed); err != nil || unquoted != p {
+			t.Errorf("the displayed form %q of %q does not unquote to the path: %q, %v", displayed, p, unquoted, err)
+		}
+	})
+}
+
+func TestValidChildName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"plain":     true,
+		"new\nline": true,
+		"\xff":      true,
+		"...":       true,
+		"":          false,
+		".":         false,
+		"..":        false,
+		"a/b":       false,
+		"nul\x00":   false,
+	} {
+		if got := ValidChildName(Path(name)); got != want {
+			t.Errorf("unexpected validity of %q: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPathRelocate(t *testing.T) {
+	testCases := []struct {
+		Path   Path
+		Want   Path
+		WantOK bool
+	}{
+		{Path: "/mnt/old", Want: "/media/new", WantOK: true},
+		{Path: "/mnt/old/a/b", Want: "/media/new/a/b", WantOK: true},
+		{Path: "/mnt/older", Want: "/mnt/older"},
+		{Path: "/mnt", Want: "/mnt"},
+	}
+	for _, testCase := range testCases {
+		got, ok := testCase.Path.Relocate("/mnt/old", "/media/new")
+		if got != testCase.Want || ok != testCase.WantOK {
+			t.Errorf("unexpected relocation of %q: got %q, %v, want %q, %v", testCase.Path, got, ok, testCase.Want, testCase.WantOK)
+		}
+	}
+	if got, ok := Path("/a/b").Relocate("/", "/c"); got != "/c/a/b" || !ok {
+		t.Errorf("unexpected relocation out of the root: got %q, %v", got, ok)
+	}
+}
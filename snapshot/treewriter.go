@@ -0,0 +1,316 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Directories with millions of entries would need a lot of memory to
+// snapshot if their entire contents were held in a `Tree`. Instead, the
+// entries of large directories are encoded incrementally, with sorted
+// runs of entries spilled to temporary files and merged together as
+// the encoded tree is stored. This bounds the memory used regardless
+// of the size of the directory.
+
+var (
+	// maxInMemoryTreeEntries is the number of directory entries held in
+	// memory before they are spilled to a temporary file.
+	maxInMemoryTreeEntries = 64 * 1024
+
+	// dirReadBatchSize is the number of directory entries read from the filesystem at a time.
+	dirReadBatchSize = 4 * 1024
+)
+
+// treeWriter incrementally encodes the contents of a directory.
+//
+// The resulting encoding is identical to that of `Tree.Encode`.
+type treeWriter struct {
+	version FormatVersion
+
+	// tree holds the entries that have not yet been spilled.
+	tree Tree
+
+	// runs holds the temporary files of sorted, encoded entries spilled so far.
+	runs []*os.File
+}
+
+func newTreeWriter(v FormatVersion) *treeWriter {
+	return &treeWriter{
+		version: v,
+		tree:    make(Tree),
+	}
+}
+
+// Add adds the given directory entry.
+func (w *treeWriter) Add(p Path, h *Hash) error {
+	if h == nil {
+		return nil
+	}
+	w.tree[p] = h
+	if len(w.tree) < maxInMemoryTreeEntries {
+		return nil
+	}
+	return w.spill()
+}
+
+// spilled reports whether or not any entries were spilled.
+//
+// If not, then `w.tree` holds all of the entries.
+func (w *treeWriter) spilled() bool {
+	return len(w.runs) > 0
+}
+
+// encodedLines returns the sorted, encoded entries of the given tree.
+func encodedLines(t Tree) []string {
+	var lines []string
+	for p, h := range t {
+		if h != nil {
+			lines = append(lines, p.encode()+" "+h.String())
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// spill writes the in-memory entries to a new temporary run file.
+func (w *treeWriter) spill() error {
+	run, err := os.CreateTemp("", "rvcs-tree")
+	if err != nil {
+		return fmt.Errorf("failure creating a temporary file for directory entries: %w", err)
+	}
+	w.runs = append(w.runs, run)
+	bw := bufio.NewWriter(run)
+	for _, line := range encodedLines(w.tree) {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("failure writing directory entries to %q: %w", run.Name(), err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failure writing directory entries to %q: %w", run.Name(), err)
+	}
+	w.tree = make(Tree)
+	return nil
+}
+
+// Reader returns a reader for the encoded tree, merging all of the spilled runs.
+func (w *treeWriter) Reader() (io.Reader, error) {
+	if len(w.tree) > 0 {
+		if err := w.spill(); err != nil {
+			return nil, err
+		}
+	}
+	var runs []*bufio.Reader
+	for _, run := range w.runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failure rewinding %q: %w", run.Name(), err)
+		}
+		runs = append(runs, bufio.NewReader(run))
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(mergeRuns(pw, w.version, runs))
+	}()
+	return pr, nil
+}
+
+// mergeRuns writes the tree encoded in the merged lines of the sorted runs in the given format version.
+//
+// In the text formats, this is the header lines followed by the merged
+// lines, separated by newlines. In the binary format, each merged line
+// is converted to its binary encoding.
+func mergeRuns(out io.Writer, v FormatVersion, runs []*bufio.Reader) error {
+	bw := bufio.NewWriter(out)
+	var writeLine func(line string) error
+	if v.binary() {
+		if _, err := bw.Write(binaryTreePrefix(v)); err != nil {
+			return err
+		}
+		writeLine = func(line string) error {
+			entry, err := binaryTreeEntry(line)
+			if err != nil {
+				return err
+			}
+			_, err = bw.Write(entry)
+			return err
+		}
+	} else {
+		first := true
+		writeLine = func(line string) error {
+			if !first {
+				if err := bw.WriteByte('\n'); err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err := bw.WriteString(line)
+			return err
+		}
+		for _, line := range v.header() {
+			if err := writeLine(line); err != nil {
+				return err
+			}
+		}
+	}
+	heads := make([]string, len(runs))
+	readHead := func(i int) error {
+		line, err := runs[i].ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			runs[i] = nil
+			return nil
+		} else if err != nil {
+			return err
+		}
+		heads[i] = strings.TrimSuffix(line, "\n")
+		return nil
+	}
+	for i := range runs {
+		if err := readHead(i); err != nil {
+			return err
+		}
+	}
+	for {
+		next := -1
+		for i, run := range runs {
+			if run != nil && (next < 0 || heads[i] < heads[next]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		if err := writeLine(heads[next]); err != nil {
+			return err
+		}
+		if err := readHead(next); err != nil {
+			return err
+		}
+	}
+	if v.binary() {
+		if err := bw.WriteByte(cborBreak); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Close removes any temporary files.
+func (w *treeWriter) Close() {
+	for _, run := range w.runs {
+		run.Close()
+		os.Remove(run.Name())
+	}
+	w.runs = nil
+}
+
+// deletedEntries compares two encoded trees read from `prev` and `curr`,
+// and returns the entries of `prev` that are missing from `curr`.
+//
+// Both trees are read incrementally, so this does not need to hold
+// either of them in memory.
+func deletedEntries(prev, curr io.Reader) (Tree, error) {
+	prevEntries, currEntries := newEntryScanner(prev), newEntryScanner(curr)
+	deleted := make(Tree)
+	prevKey, prevHash, prevOK, err := prevEntries.next()
+	if err != nil {
+		return nil, err
+	}
+	currKey, _, currOK, err := currEntries.next()
+	if err != nil {
+		return nil, err
+	}
+	for prevOK {
+		switch {
+		case !currOK || prevKey < currKey:
+			p, err := decodePath(prevKey)
+			if err != nil {
+				return nil, err
+			}
+			deleted[p] = prevHash
+		case prevKey > currKey:
+			if currKey, _, currOK, err = currEntries.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if prevKey, prevHash, prevOK, err = prevEntries.next(); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// entryScanner reads the entries of an encoded tree one at a time.
+type entryScanner struct {
+	r       *bufio.Reader
+	version FormatVersion
+	started bool
+
+	// binary reads the entries if the tree is in the binary format.
+	binary *binaryTreeReader
+}
+
+func newEntryScanner(r io.Reader) *entryScanner {
+	s := &entryScanner{r: bufio.NewReader(r), version: LegacyFormat}
+	if magic, err := s.r.Peek(len(binaryMagic)); err == nil && isBinary(string(magic)) {
+		s.binary = &binaryTreeReader{d: &cborDecoder{r: s.r}}
+	}
+	return s
+}
+
+// next returns the encoded path and hash of the next entry.
+//
+// Entries are returned in the same order for all format versions, so
+// trees in different formats can be compared.
+func (s *entryScanner) next() (key string, h *Hash, ok bool, err error) {
+	if s.binary != nil {
+		p, h, ok, err := s.binary.next()
+		return p.encode(), h, ok, err
+	}
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", nil, false, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			return "", nil, false, nil
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if !s.started {
+			s.started = true
+			if strings.HasPrefix(line, formatHeaderPrefix) {
+				v, _, err := splitFormatHeader([]string{line})
+				if err != nil {
+					return "", nil, false, err
+				}
+				s.version = v
+				continue
+			}
+		}
+		if len(line) == 0 || isTreeExtension(s.version, line) {
+			continue
+		}
+		encodedPath, h, err := splitTreeEntry(line)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("malformed tree entry: %w", err)
+		}
+		return encodedPath, h, true, nil
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+)
+
+// WithVerification enables verifying that the files read while
+// generating a snapshot did not change before the snapshot completed.
+//
+// Once a snapshot has been generated, every regular file in it is
+// stat'ed again. If the size or modification time of any of them has
+// changed, then the path is snapshotted again so that those files are
+// re-read, up to `maxRetries` times. Unchanged files are not re-read.
+//
+// The snapshots generated by all but the last attempt are left out of
+// the history, so the result is recorded as a single snapshot whose
+// parents are the snapshots from before the first attempt.
+//
+// Files that were still changing after the last attempt are reported
+// by `Unstable`.
+func WithVerification(maxRetries int) Option {
+	return func(sn *Snapshotter) {
+		sn.verifyRetries = maxRetries
+	}
+}
+
+// verification tracks the state used to verify a snapshot.
+type verification struct {
+	mu sync.Mutex
+
+	// read holds the file information of each regular file in the current attempt, from before it was read.
+	read map[Path]os.FileInfo
+
+	// written holds the snapshots stored for each path by any attempt.
+	written map[Path]*Hash
+
+	// unstable lists the files that changed after the last attempt.
+	unstable []Path
+}
+
+func (v *verification) recordRead(p Path, info os.FileInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.read == nil {
+		v.read = make(map[Path]os.FileInfo)
+	}
+	v.read[p] = info
+}
+
+func (v *verification) recordWritten(p Path, h *Hash) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.written == nil {
+		v.written = make(map[Path]*Hash)
+	}
+	v.written[p] = h
+}
+
+// wasWritten reports whether or not the snapshot `h` of `p` was stored by a previous attempt.
+func (v *verification) wasWritten(p Path, h *Hash) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.written[p].Equal(h)
+}
+
+// changed returns the files read in the current attempt that have since changed, in sorted order.
+func (v *verification) changed() []Path {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var changed []Path
+	for p, info := range v.read {
+		latest, err := os.Lstat(string(p))
+		if err != nil || latest.Size() != info.Size() || !latest.ModTime().Equal(info.ModTime()) {
+			changed = append(changed, p)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		return changed[i] < changed[j]
+	})
+	return changed
+}
+
+// reset prepares for another attempt.
+func (v *verification) reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.read = nil
+	v.unstable = nil
+}
+
+// Unstable returns the files that were still changing after the last
+// attempt of the most recent snapshot with verification enabled.
+//
+// The snapshots of these files may not match their current contents.
+func (sn *Snapshotter) Unstable() []Path {
+	sn.verify.mu.Lock()
+	defer sn.verify.mu.Unlock()
+	return sn.verify.unstable
+}
+
+// snapshotVerified generates a snapshot of `p`, and then repeats it for as
+// long as files have changed since they were read, up to the retry limit.
+func (sn *Snapshotter) snapshotVerified(ctx context.Context, p Path) (h *Hash, f *File, err error) {
+	fileCount, totalSize := sn.fileCount, sn.totalSize
+	sn.verify.mu.Lock()
+	sn.verify.written = nil
+	sn.verify.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		sn.verify.reset()
+		sn.fileCount, sn.totalSize = fileCount, totalSize
+		h, f, err = sn.snapshot(ctx, p, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		changed := sn.verify.changed()
+		if len(changed) == 0 {
+			return h, f, nil
+		}
+		if attempt >= sn.verifyRetries {
+			sn.verify.mu.Lock()
+			sn.verify.unstable = changed
+			sn.verify.mu.Unlock()
+			return h, f, nil
+		}
+	}
+}
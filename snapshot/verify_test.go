@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// limitedAppendingFilter is a content filter that appends to the file
+// being read, but only for the first `times` reads.
+type limitedAppendingFilter struct {
+	appendingFilter
+	times int
+}
+
+func (f *limitedAppendingFilter) Clean(ctx context.Context, r io.Reader, w io.Writer) error {
+	if f.times <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	f.times--
+	return f.appendingFilter.Clean(ctx, r, w)
+}
+
+func TestSnapshotterVerification(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := &storageForTest{}
+
+	if err := os.WriteFile(filepath.Join(dir, "stable.txt"), []byte("stable"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	changing := filepath.Join(dir, "changing.txt")
+	if err := os.WriteFile(changing, []byte("changing"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	filter := &limitedAppendingFilter{appendingFilter: appendingFilter{path: changing}, times: 1}
+	sn := NewSnapshotter(s, WithFilters(filter), WithVerification(3))
+	h, f, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting %q: %v", dir, err)
+	}
+	if unstable := sn.Unstable(); len(unstable) > 0 {
+		t.Errorf("unexpected unstable files: %v", unstable)
+	}
+	if len(f.Parents) > 0 {
+		t.Errorf("unexpected parents for the verified snapshot %q: %v", h, f.Parents)
+	}
+	_, changingFile, err := s.FindSnapshot(ctx, Path(changing))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of %q: %v", changing, err)
+	}
+	if reason, ok := changingFile.PossiblyInconsistent(); ok {
+		t.Errorf("unexpectedly marked %q as possibly inconsistent: %q", changing, reason)
+	}
+	if len(changingFile.Parents) > 0 {
+		t.Errorf("unexpected parents for the snapshot of %q: %v", changing, changingFile.Parents)
+	}
+	reader, err := s.ReadObject(ctx, changingFile.Contents)
+	if err != nil {
+		t.Fatalf("failure reading the contents of %q: %v", changing, err)
+	}
+	defer reader.Close()
+	if got, err := io.ReadAll(reader); err != nil {
+		t.Errorf("failure reading the contents of %q: %v", changing, err)
+	} else if want := "changing and more"; string(got) != want {
+		t.Errorf("unexpected contents for %q: got %q, want %q", changing, got, want)
+	}
+
+	// A file that changes every time it is read is never stable.
+	filter.times = 10
+	h2, f2, err := sn.Snapshot(ctx, Path(dir))
+	if err != nil {
+		t.Fatalf("failure snapshotting %q again: %v", dir, err)
+	}
+	if unstable := sn.Unstable(); len(unstable) != 1 || unstable[0] != Path(changing) {
+		t.Errorf("unexpected unstable files: got %v, want [%q]", unstable, changing)
+	}
+	if len(f2.Parents) != 1 || !f2.Parents[0].Equal(h) {
+		t.Errorf("unexpected parents for the snapshot %q: got %v, want [%q]", h2, f2.Parents, h)
+	}
+}
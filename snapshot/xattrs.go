@@ -0,0 +1,146 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xattrExtension is the name of the extension field recording one
+// extended attribute of a file.
+//
+// Each field is of the form `+xattr <QUOTED-NAME> <VALUE-HASH>`, and the
+// fields are sorted by name.
+const xattrExtension = extensionPrefix + "xattr "
+
+// WithXattrs records the extended attributes of files whose names match any of the given patterns.
+//
+// The patterns use the syntax of `path.Match`, such as "com.apple.*"
+// for the Finder information, resource forks, and tags on macOS. The
+// value of each attribute is stored as a separate object.
+//
+// Extended attributes are recorded for regular files and directories
+// when snapshotting in the versioned format, on platforms that support
+// them. Since a file's cached snapshot is reused until it changes, the
+// attributes of unchanged files are only recorded once they change.
+func WithXattrs(patterns ...string) Option {
+	return func(sn *Snapshotter) {
+		sn.xattrs = patterns
+	}
+}
+
+// ValidateXattrPattern reports an error if the given pattern for extended attribute names is malformed.
+func ValidateXattrPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("malformed extended attribute pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// recordsXattr reports whether or not the extended attribute `name` is recorded by the snapshotter.
+func (sn *Snapshotter) recordsXattr(name string) bool {
+	for _, pattern := range sn.xattrs {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// xattrExtensions stores the recorded extended attributes of the file `p`, and returns the extension fields for them.
+func (sn *Snapshotter) xattrExtensions(ctx context.Context, p Path) ([]string, error) {
+	if len(sn.xattrs) == 0 || !sn.formatVersion.versioned() {
+		return nil, nil
+	}
+	attrs, err := readXattrs(p, sn.recordsXattr)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the extended attributes of %q: %w", p, err)
+	}
+	hashes := make(map[string]*Hash)
+	for name, value := range attrs {
+		h, err := sn.s.StoreObject(ctx, bytes.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("failure storing the extended attribute %q of %q: %w", name, p, err)
+		}
+		hashes[name] = h
+	}
+	return encodeXattrs(hashes), nil
+}
+
+// encodeXattrs returns the extension fields recording the given extended attribute value hashes.
+func encodeXattrs(hashes map[string]*Hash) []string {
+	var lines []string
+	for name, h := range hashes {
+		lines = append(lines, xattrExtension+strconv.Quote(name)+" "+h.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Xattrs returns the extended attributes recorded for the file, mapping each name to the hash of its value.
+func (f *File) Xattrs() (map[string]*Hash, error) {
+	if f == nil {
+		return nil, nil
+	}
+	var hashes map[string]*Hash
+	for _, line := range f.Extensions {
+		if !strings.HasPrefix(line, xattrExtension) {
+			continue
+		}
+		field := strings.TrimPrefix(line, xattrExtension)
+		sep := strings.LastIndex(field, " ")
+		if sep < 0 {
+			return nil, fmt.Errorf("malformed extended attribute field %q", line)
+		}
+		name, err := strconv.Unquote(field[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("malformed extended attribute name in %q: %w", line, err)
+		}
+		h, err := ParseHash(field[sep+1:])
+		if err != nil || h == nil {
+			return nil, fmt.Errorf("malformed extended attribute value hash in %q: %v", line, err)
+		}
+		if hashes == nil {
+			hashes = make(map[string]*Hash)
+		}
+		hashes[name] = h
+	}
+	return hashes, nil
+}
+
+// SameXattrs reports whether or not the two files have identical extended attributes recorded.
+func (f *File) SameXattrs(other *File) bool {
+	return strings.Join(f.xattrLines(), "\n") == strings.Join(other.xattrLines(), "\n")
+}
+
+// xattrLines returns the extension fields of the file that record its extended attributes.
+func (f *File) xattrLines() []string {
+	if f == nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range f.Extensions {
+		if strings.HasPrefix(line, xattrExtension) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"testing"
+)
+
+func TestFileXattrs(t *testing.T) {
+	const hash = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	f, err := ParseFile("#format 2\n-rw-r-----\n" + hash + "\n+chunks abc\n+xattr \"com.apple.metadata:_kMDItemUserTags\" " + hash + "\n+xattr \"user.with space\" " + hash)
+	if err != nil {
+		t.Fatalf("failure parsing the example file: %v", err)
+	}
+	attrs, err := f.Xattrs()
+	if err != nil {
+		t.Fatalf("failure reading the extended attributes: %v", err)
+	}
+	if len(attrs) != 2 {
+		t.Errorf("unexpected extended attributes: %v", attrs)
+	}
+	for _, name := range []string{"com.apple.metadata:_kMDItemUserTags", "user.with space"} {
+		if got := attrs[name]; got.String() != hash {
+			t.Errorf("unexpected hash for the extended attribute %q: got %q, want %q", name, got, hash)
+		}
+	}
+	if got := encodeXattrs(attrs); len(got) != 2 || got[0] != f.Extensions[1] || got[1] != f.Extensions[2] {
+		t.Errorf("unexpected encoding of the extended attributes: got %q, want %q", got, f.Extensions[1:])
+	}
+
+	without := &File{Mode: f.Mode, Contents: f.Contents, Version: f.Version, Extensions: []string{"+chunks abc"}}
+	if f.SameXattrs(without) {
+		t.Errorf("unexpected match between files with and without extended attributes")
+	}
+	if !without.SameXattrs(&File{}) {
+		t.Errorf("unexpected mismatch between files without extended attributes")
+	}
+
+	malformed := &File{Extensions: []string{"+xattr user.unquoted " + hash}}
+	if _, err := malformed.Xattrs(); err == nil {
+		t.Errorf("unexpected success reading a malformed extended attribute field")
+	}
+}
+
+func TestValidateXattrPattern(t *testing.T) {
+	for _, pattern := range []string{"com.apple.*", "user.example", "user.[a-z]*"} {
+		if err := ValidateXattrPattern(pattern); err != nil {
+			t.Errorf("unexpected error validating %q: %v", pattern, err)
+		}
+	}
+	if err := ValidateXattrPattern("user.[a-"); err == nil {
+		t.Errorf("unexpected success validating a malformed pattern")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the values of the extended attributes of `p` whose names are selected by `include`.
+//
+// Symbolic links are not followed. File systems that do not support
+// extended attributes are treated as if the file had none.
+func readXattrs(p Path, include func(string) bool) (map[string][]byte, error) {
+	names, err := xattrBuffer(func(dest []byte) (int, error) {
+		return unix.Llistxattr(string(p), dest)
+	})
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 || !include(string(name)) {
+			continue
+		}
+		value, err := xattrBuffer(func(dest []byte) (int, error) {
+			return unix.Lgetxattr(string(p), string(name), dest)
+		})
+		if errors.Is(err, errNoXattr) {
+			// The attribute was removed after the names were listed.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = value
+	}
+	return attrs, nil
+}
+
+// xattrBuffer calls `read` with a buffer large enough for its result.
+//
+// The required size is queried first, and the read is retried if the
+// result grew in between.
+func xattrBuffer(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		} else if size == 0 {
+			return nil, nil
+		}
+		dest := make([]byte, size)
+		n, err := read(dest)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return dest[:n], nil
+	}
+}
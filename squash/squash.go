@@ -0,0 +1,346 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package squash defines methods for replacing a run of snapshots with a single snapshot.
+//
+// Frequent snapshots of a path produce long chains of history. Squashing
+// replaces the snapshots after one snapshot, up to and including a later
+// one, with a single snapshot that has the same contents as the later
+// snapshot. The snapshots of the children of directories are squashed in
+// the same way, and any snapshots that came after the squashed range are
+// rewritten to descend from the squashed snapshot instead.
+package squash
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+type squasher struct {
+	s *storage.LocalFiles
+
+	// files caches the file snapshots read so far.
+	files map[snapshot.Hash]*snapshot.File
+
+	// rewritten maps snapshots to the snapshots replacing them.
+	//
+	// Snapshots that are known to be unaffected map to themselves.
+	rewritten map[snapshot.Hash]*snapshot.Hash
+}
+
+func (sq *squasher) readSnapshot(ctx context.Context, h *snapshot.Hash) (*snapshot.File, error) {
+	if f, ok := sq.files[*h]; ok {
+		return f, nil
+	}
+	f, err := sq.s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
+	}
+	sq.files[*h] = f
+	return f, nil
+}
+
+func (sq *squasher) listContents(ctx context.Context, h *snapshot.Hash) (snapshot.Tree, error) {
+	if h == nil {
+		return nil, nil
+	}
+	f, err := sq.readSnapshot(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDir() {
+		return nil, nil
+	}
+	tree, err := sq.s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the contents of %q: %w", h, err)
+	}
+	return tree, nil
+}
+
+// ancestors returns the set of snapshots reachable from `h` via parents, including `h` itself.
+func (sq *squasher) ancestors(ctx context.Context, h *snapshot.Hash) (map[snapshot.Hash]struct{}, error) {
+	visited := make(map[snapshot.Hash]struct{})
+	if h == nil {
+		return visited, nil
+	}
+	queue := []*snapshot.Hash{h}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[*next]; ok {
+			continue
+		}
+		visited[*next] = struct{}{}
+		f, err := sq.readSnapshot(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range f.Parents {
+			if parent != nil {
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return visited, nil
+}
+
+// store stores the given file snapshot, unless it is identical to the snapshot `orig`.
+func (sq *squasher) store(ctx context.Context, orig *snapshot.Hash, origFile, f *snapshot.File) (*snapshot.Hash, error) {
+	if f.String() == origFile.String() {
+		return orig, nil
+	}
+	h, err := sq.s.StoreObject(ctx, strings.NewReader(f.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the file snapshot %+v: %w", f, err)
+	}
+	sq.files[*h] = f
+	return h, nil
+}
+
+// storeTree stores a copy of the directory snapshot `f` with its contents replaced by `tree`.
+func (sq *squasher) storeTree(ctx context.Context, f *snapshot.File, tree snapshot.Tree) (*snapshot.File, error) {
+	contents, err := sq.s.StoreObject(ctx, strings.NewReader(tree.Encode(f.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the directory contents %q: %w", tree, err)
+	}
+	copied := *f
+	copied.Contents = contents
+	return &copied, nil
+}
+
+// squash replaces the snapshots that `to` descends from, but `from` does
+// not, with a single snapshot matching `to`.
+//
+// The replacement's parents are the snapshots outside of the range that
+// it descends from, which for a linear history is just `from`.
+func (sq *squasher) squash(ctx context.Context, from, to *snapshot.Hash) (*snapshot.Hash, error) {
+	if to == nil {
+		return nil, nil
+	}
+	if replacement, ok := sq.rewritten[*to]; ok {
+		return replacement, nil
+	}
+	if to.Equal(from) {
+		sq.rewritten[*to] = to
+		return to, nil
+	}
+	toFile, err := sq.readSnapshot(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := sq.ancestors(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	// The parents of the replacement are the excluded snapshots that the
+	// range descends from, starting with `from` if it is one of them.
+	var parents []*snapshot.Hash
+	visited := map[snapshot.Hash]struct{}{*to: struct{}{}}
+	queue := []*snapshot.Hash{to}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		f, err := sq.readSnapshot(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range f.Parents {
+			if parent == nil {
+				continue
+			}
+			if _, ok := visited[*parent]; ok {
+				continue
+			}
+			visited[*parent] = struct{}{}
+			if _, ok := excluded[*parent]; !ok {
+				queue = append(queue, parent)
+			} else if parent.Equal(from) {
+				parents = append([]*snapshot.Hash{parent}, parents...)
+			} else {
+				parents = append(parents, parent)
+			}
+		}
+	}
+	squashed := *toFile
+	squashed.Parents = parents
+	result := &squashed
+	if toFile.IsDir() {
+		fromTree, err := sq.listContents(ctx, from)
+		if err != nil {
+			return nil, err
+		}
+		toTree, err := sq.listContents(ctx, to)
+		if err != nil {
+			return nil, err
+		}
+		tree := make(snapshot.Tree)
+		for child, childHash := range toTree {
+			if tree[child], err = sq.squash(ctx, fromTree[child], childHash); err != nil {
+				return nil, fmt.Errorf("failure squashing the child %q: %w", child, err)
+			}
+		}
+		if result, err = sq.storeTree(ctx, result, tree); err != nil {
+			return nil, err
+		}
+	}
+	h, err := sq.store(ctx, to, toFile, result)
+	if err != nil {
+		return nil, err
+	}
+	sq.rewritten[*to] = h
+	return h, nil
+}
+
+// rewrite rewrites the snapshot `h` to replace any squashed snapshots in its history.
+func (sq *squasher) rewrite(ctx context.Context, h *snapshot.Hash) (*snapshot.Hash, error) {
+	if h == nil {
+		return nil, nil
+	}
+	if replacement, ok := sq.rewritten[*h]; ok {
+		return replacement, nil
+	}
+	f, err := sq.readSnapshot(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	rewritten := *f
+	rewritten.Parents = nil
+	for _, parent := range f.Parents {
+		newParent, err := sq.rewrite(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		rewritten.Parents = append(rewritten.Parents, newParent)
+	}
+	result := &rewritten
+	if f.IsDir() {
+		tree, err := sq.listContents(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		newTree := make(snapshot.Tree)
+		for child, childHash := range tree {
+			if newTree[child], err = sq.rewrite(ctx, childHash); err != nil {
+				return nil, fmt.Errorf("failure rewriting the child %q: %w", child, err)
+			}
+		}
+		if result, err = sq.storeTree(ctx, result, newTree); err != nil {
+			return nil, err
+		}
+	}
+	newHash, err := sq.store(ctx, h, f, result)
+	if err != nil {
+		return nil, err
+	}
+	sq.rewritten[*h] = newHash
+	return newHash, nil
+}
+
+// updateMappings maps `p` and its nested paths to the snapshots of the
+// directory `h`, which replaced the snapshot `prev`.
+func (sq *squasher) updateMappings(ctx context.Context, p snapshot.Path, prev, h *snapshot.Hash) error {
+	if h.Equal(prev) {
+		return nil
+	}
+	f, err := sq.readSnapshot(ctx, h)
+	if err != nil {
+		return err
+	}
+	if _, err := sq.s.StoreSnapshot(ctx, p, f); err != nil {
+		return fmt.Errorf("failure updating the snapshot of %q: %w", p, err)
+	}
+	prevTree, err := sq.listContents(ctx, prev)
+	if err != nil {
+		return err
+	}
+	tree, err := sq.listContents(ctx, h)
+	if err != nil {
+		return err
+	}
+	for child, childHash := range tree {
+		if err := sq.updateMappings(ctx, p.Join(child), prevTree[child], childHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Squash replaces the snapshots of `p` after `from`, up to and including `to`, with a single snapshot.
+//
+// The squashed snapshot has the same mode, contents, and metadata as
+// `to`, and `from` as its parent. If `from` is nil, then the entire
+// history leading to `to` is squashed. If `to` is nil, then it defaults
+// to the latest snapshot of `p`.
+//
+// Snapshots of `p` that came after `to` are rewritten to descend from
+// the squashed snapshot, and `p` and all of its nested paths are mapped
+// to their rewritten snapshots. The snapshots of any parent directories
+// of `p` still reference the original history.
+//
+// The returned value is the new latest snapshot of `p`.
+func Squash(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, from, to *snapshot.Hash) (*snapshot.Hash, error) {
+	head, _, err := s.FindSnapshot(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+	}
+	if to == nil {
+		to = head
+	}
+	sq := &squasher{
+		s:         s,
+		files:     make(map[snapshot.Hash]*snapshot.File),
+		rewritten: make(map[snapshot.Hash]*snapshot.Hash),
+	}
+	headAncestors, err := sq.ancestors(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := headAncestors[*to]; !ok {
+		return nil, fmt.Errorf("%q is not in the history of %q", to, p)
+	}
+	if from != nil {
+		toAncestors, err := sq.ancestors(ctx, to)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := toAncestors[*from]; !ok {
+			return nil, fmt.Errorf("%q is not an ancestor of %q", from, to)
+		}
+	}
+	if _, err := sq.squash(ctx, from, to); err != nil {
+		return nil, err
+	}
+	// Nothing older than `from` needs to be rewritten.
+	excluded, err := sq.ancestors(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	for h := range excluded {
+		h := h
+		sq.rewritten[h] = &h
+	}
+	newHead, err := sq.rewrite(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	if err := sq.updateMappings(ctx, p, head, newHead); err != nil {
+		return nil, err
+	}
+	return newHead, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package squash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestSquash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	file := filepath.Join(src, "file")
+	var history []*snapshot.Hash
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("version %d", i)), 0600); err != nil {
+			t.Fatalf("failure writing the example file: %v", err)
+		}
+		h, _, err := snapshot.Current(ctx, s, snapshot.Path(src))
+		if err != nil {
+			t.Fatalf("failure snapshotting the example directory: %v", err)
+		}
+		history = append(history, h)
+	}
+
+	// Squash the middle three snapshots into one.
+	head, err := Squash(ctx, s, snapshot.Path(src), history[0], history[3])
+	if err != nil {
+		t.Fatalf("failure squashing the history: %v", err)
+	}
+	if latest, _, err := s.FindSnapshot(ctx, snapshot.Path(src)); err != nil {
+		t.Fatalf("failure finding the latest snapshot: %v", err)
+	} else if !latest.Equal(head) {
+		t.Errorf("unexpected latest snapshot: got %q, want %q", latest, head)
+	}
+	var chain []*snapshot.File
+	for h := head; h != nil; {
+		f, err := s.ReadSnapshot(ctx, h)
+		if err != nil {
+			t.Fatalf("failure reading the snapshot %q: %v", h, err)
+		}
+		chain = append(chain, f)
+		if len(f.Parents) > 1 {
+			t.Fatalf("unexpected parents for %q: %v", h, f.Parents)
+		} else if len(f.Parents) == 0 {
+			break
+		}
+		h = f.Parents[0]
+	}
+	if got, want := len(chain), 3; got != want {
+		t.Fatalf("unexpected length of the squashed history: got %d, want %d", got, want)
+	}
+	for i, want := range []*snapshot.Hash{history[4], history[3], history[0]} {
+		wantFile, err := s.ReadSnapshot(ctx, want)
+		if err != nil {
+			t.Fatalf("failure reading the snapshot %q: %v", want, err)
+		}
+		wantTree, err := s.ListDirectorySnapshotContents(ctx, want, wantFile)
+		if err != nil {
+			t.Fatalf("failure listing the contents of %q: %v", want, err)
+		}
+		wantChild, err := s.ReadSnapshot(ctx, wantTree[snapshot.Path("file")])
+		if err != nil {
+			t.Fatalf("failure reading the child of %q: %v", want, err)
+		}
+		tree, err := s.ListDirectorySnapshotContents(ctx, nil, chain[i])
+		if err != nil {
+			t.Fatalf("failure listing the contents of the squashed history: %v", err)
+		}
+		child, err := s.ReadSnapshot(ctx, tree[snapshot.Path("file")])
+		if err != nil {
+			t.Fatalf("failure reading the child in the squashed history: %v", err)
+		}
+		if !child.Contents.Equal(wantChild.Contents) {
+			t.Errorf("unexpected contents at position %d of the squashed history: got %q, want %q", i, child.Contents, wantChild.Contents)
+		}
+		if wantParents := len(wantChild.Parents); i == len(chain)-1 && len(child.Parents) != wantParents {
+			t.Errorf("unexpected parents for the oldest child snapshot: got %v, want %v", child.Parents, wantChild.Parents)
+		} else if i < len(chain)-1 && len(child.Parents) != 1 {
+			t.Errorf("unexpected parents for the child snapshot at position %d: %v", i, child.Parents)
+		}
+	}
+
+	// New snapshots must build on the squashed history.
+	if err := os.WriteFile(file, []byte("version 5"), 0600); err != nil {
+		t.Fatalf("failure writing the example file: %v", err)
+	}
+	h, f, err := snapshot.Current(ctx, s, snapshot.Path(src))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example directory: %v", err)
+	}
+	if len(f.Parents) != 1 || !f.Parents[0].Equal(head) {
+		t.Errorf("unexpected parents for the new snapshot %q: got %v, want [%q]", h, f.Parents, head)
+	}
+	fileHash, fileSnapshot, err := s.FindSnapshot(ctx, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure finding the snapshot of %q: %v", file, err)
+	}
+	headFile, err := s.ReadSnapshot(ctx, head)
+	if err != nil {
+		t.Fatalf("failure reading the snapshot %q: %v", head, err)
+	}
+	headTree, err := s.ListDirectorySnapshotContents(ctx, head, headFile)
+	if err != nil {
+		t.Fatalf("failure listing the contents of %q: %v", head, err)
+	}
+	if len(fileSnapshot.Parents) != 1 || !fileSnapshot.Parents[0].Equal(headTree[snapshot.Path("file")]) {
+		t.Errorf("unexpected parents for the new file snapshot %q: got %v, want [%q]", fileHash, fileSnapshot.Parents, headTree[snapshot.Path("file")])
+	}
+
+	if _, err := Squash(ctx, s, snapshot.Path(src), history[3], history[1]); err == nil {
+		t.Error("unexpectedly squashed a range whose start is not an ancestor of its end")
+	}
+}
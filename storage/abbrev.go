@@ -0,0 +1,65 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// minAbbreviatedHexLength is the fewest hexadecimal digits accepted in an abbreviated hash.
+//
+// This keeps the search for matching objects within a single directory.
+const minAbbreviatedHexLength = 4
+
+// ExpandHash returns the hash of the only stored object whose hash starts with the abbreviated hash `short`.
+//
+// The archive and each of its base archives are searched. The returned
+// error satisfies `errors.Is(err, ErrNotFound)` if no object matches.
+func (s *LocalFiles) ExpandHash(ctx context.Context, short *snapshot.Hash) (*snapshot.Hash, error) {
+	prefix := short.HexContents()
+	if len(prefix) < minAbbreviatedHexLength {
+		return nil, fmt.Errorf("the abbreviated hash %q is too short; at least %d digits are required", short, minAbbreviatedHexLength)
+	}
+	matches := make(map[string]struct{})
+	for _, archiveDir := range append([]string{s.ArchiveDir}, s.BaseArchiveDirs...) {
+		dir := filepath.Join(archiveDir, "objects", short.Function(), prefix[0:2], prefix[2:4])
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failure listing the objects matching %q: %w", short, err)
+		}
+		for _, entry := range entries {
+			if name := entry.Name(); !entry.IsDir() && strings.HasPrefix(name, prefix[4:]) {
+				matches[prefix[0:4]+name] = struct{}{}
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no object matches the abbreviated hash %q: %w", short, ErrNotFound)
+	} else if len(matches) > 1 {
+		return nil, fmt.Errorf("the abbreviated hash %q is ambiguous; it matches %d objects", short, len(matches))
+	}
+	for match := range matches {
+		return snapshot.ParseHash(short.Function() + ":" + match)
+	}
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestExpandHash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	base := &LocalFiles{ArchiveDir: filepath.Join(dir, "base")}
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive"), BaseArchiveDirs: []string{base.ArchiveDir}}
+	local, err := s.StoreObject(ctx, strings.NewReader("Hello, World!"))
+	if err != nil {
+		t.Fatalf("failure storing an object: %v", err)
+	}
+	inBase, err := base.StoreObject(ctx, strings.NewReader("Goodbye, World!"))
+	if err != nil {
+		t.Fatalf("failure storing an object in the base archive: %v", err)
+	}
+	for _, want := range []*snapshot.Hash{local, inBase} {
+		short, err := snapshot.ParseHash(want.Short())
+		if err != nil {
+			t.Fatalf("failure parsing the abbreviated hash %q: %v", want.Short(), err)
+		}
+		if got, err := s.ExpandHash(ctx, short); err != nil {
+			t.Errorf("failure expanding %q: %v", short, err)
+		} else if !got.Equal(want) {
+			t.Errorf("unexpected expansion of %q: got %q, want %q", short, got, want)
+		}
+	}
+	missing, _ := snapshot.ParseHash("sha256:0000000000")
+	if _, err := s.ExpandHash(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected result expanding a hash that matches nothing: %v", err)
+	}
+	tooShort, _ := snapshot.ParseHash("sha256:" + local.HexContents()[:2])
+	if _, err := s.ExpandHash(ctx, tooShort); err == nil {
+		t.Error("unexpectedly expanded a hash that was too short")
+	}
+}
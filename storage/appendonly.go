@@ -0,0 +1,116 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// appendOnlyConfig is the name of the config file that marks an archive as append-only.
+const appendOnlyConfig = "append-only"
+
+// AppendOnly reports whether or not the archive has been marked as append-only.
+//
+// In an append-only archive, path mappings can only be updated to
+// snapshots that descend from the previously mapped snapshot, and
+// cannot be removed. Objects are never removed from any archive, nor
+// offloaded from an append-only one, so together this means nothing
+// previously stored can be lost.
+//
+// This is intended for archives that backups are pushed to, so that a
+// compromised client cannot rewind them. The marker is a file inside the
+// archive, so it only protects against clients that cannot write to the
+// archive's config directory directly.
+func (s *LocalFiles) AppendOnly() bool {
+	_, err := os.Stat(s.ConfigFile(appendOnlyConfig))
+	return err == nil
+}
+
+// SetAppendOnly marks the archive as append-only.
+//
+// There is deliberately no corresponding method for removing the mark.
+func (s *LocalFiles) SetAppendOnly(ctx context.Context) error {
+	return s.WriteConfigFile(ctx, appendOnlyConfig, []byte("Path mappings in this archive may only be fast-forwarded\n"))
+}
+
+// NotFastForwardError reports an attempt to rewind a path mapping in an append-only archive.
+type NotFastForwardError struct {
+	// Path is the path whose mapping was being updated.
+	Path snapshot.Path
+
+	// Prev is the snapshot that the path is currently mapped to.
+	Prev *snapshot.Hash
+
+	// New is the snapshot that the path was going to be mapped to.
+	New *snapshot.Hash
+}
+
+// Error implements the `error` interface.
+func (e *NotFastForwardError) Error() string {
+	if e.New == nil {
+		return fmt.Sprintf("cannot remove the mapping of %q to %q in an append-only archive", e.Path, e.Prev)
+	}
+	return fmt.Sprintf("cannot update %q from %q to %q in an append-only archive, as it does not descend from it", e.Path, e.Prev, e.New)
+}
+
+// descendsFrom reports whether or not `prev` is `h` or one of the ancestors of the snapshot `f`, which has hash `h`.
+func (s *LocalFiles) descendsFrom(ctx context.Context, prev, h *snapshot.Hash, f *snapshot.File) (bool, error) {
+	if prev.Equal(h) {
+		return true, nil
+	}
+	visited := make(map[snapshot.Hash]struct{})
+	queue := append([]*snapshot.Hash{}, f.Parents...)
+	for len(queue) > 0 {
+		var next *snapshot.Hash
+		next, queue = queue[0], queue[1:]
+		if next.Equal(prev) {
+			return true, nil
+		}
+		if _, ok := visited[*next]; ok {
+			continue
+		}
+		visited[*next] = struct{}{}
+		nextFile, err := s.ReadSnapshot(ctx, next)
+		if err != nil {
+			return false, fmt.Errorf("failure reading the ancestor snapshot %q: %w", next, err)
+		}
+		queue = append(queue, nextFile.Parents...)
+	}
+	return false, nil
+}
+
+// checkFastForward verifies that mapping `p` to the snapshot `f`, with
+// hash `h`, does not rewind the history of `p` if the archive is append-only.
+func (s *LocalFiles) checkFastForward(ctx context.Context, p snapshot.Path, h *snapshot.Hash, f *snapshot.File) error {
+	if !s.AppendOnly() {
+		return nil
+	}
+	prev, err := s.findSnapshotHash(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failure looking up the current snapshot of %q: %w", p, err)
+	}
+	if ok, err := s.descendsFrom(ctx, prev, h, f); err != nil {
+		return err
+	} else if !ok {
+		return &NotFastForwardError{Path: p, Prev: prev, New: h}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.txt")
+	p := snapshot.Path(file)
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := s.SetAppendOnly(ctx); err != nil {
+		t.Fatalf("failure marking the archive as append-only: %v", err)
+	}
+	if !s.AppendOnly() {
+		t.Fatal("archive was not marked as append-only")
+	}
+	if err := os.WriteFile(file, []byte("first"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	first, firstFile, err := snapshot.Current(ctx, s, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("second"), 0700); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	second, _, err := snapshot.Current(ctx, s, p)
+	if err != nil {
+		t.Fatalf("failure fast-forwarding the example file: %v", err)
+	}
+
+	if _, err := s.StoreSnapshot(ctx, p, firstFile); err == nil {
+		t.Errorf("unexpected success rewinding %q from %q to %q", p, second, first)
+	} else if _, ok := err.(*NotFastForwardError); !ok {
+		t.Errorf("unexpected error rewinding %q: %v", p, err)
+	}
+	if err := s.RemoveMappingForPath(ctx, p); err == nil {
+		t.Errorf("unexpected success removing the mapping for %q", p)
+	}
+	if latest, _, err := s.FindSnapshot(ctx, p); err != nil {
+		t.Errorf("failure reading the latest snapshot: %v", err)
+	} else if !latest.Equal(second) {
+		t.Errorf("unexpected latest snapshot: got %q, want %q", latest, second)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Every file in the archive is written by first writing a temporary file,
+// syncing it to disk, and then renaming it into place. Objects are always
+// synced before any path mapping that refers to them is written, so a
+// crash at any point leaves either the previous or the new mapping for a
+// path, and never a mapping to a missing or partially written object.
+//
+// Left over temporary files from an interrupted write are harmless, as
+// nothing in the archive refers to them.
+
+// syncDir flushes the directory entries of `dir` to disk, so that files
+// renamed into it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !os.IsPermission(err) {
+		// Some platforms do not support syncing directories, which is reported as a permission error.
+		return err
+	}
+	return nil
+}
+
+// commitTmpFile syncs the given temporary file and renames it to `dest`.
+//
+// The temporary file is closed, but it is left to the caller to remove it if this fails.
+func commitTmpFile(tmp *os.File, dest string) error {
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failure syncing %q: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failure closing %q: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("failure renaming %q to %q: %w", tmp.Name(), dest, err)
+	}
+	if err := syncDir(filepath.Dir(dest)); err != nil {
+		return fmt.Errorf("failure syncing the parent directory of %q: %w", dest, err)
+	}
+	return nil
+}
+
+// writeFileAtomically replaces the contents of the file `dest` with `contents`.
+//
+// Readers of `dest` will see either the old or the new contents, and
+// never a partially written file.
+func (s *LocalFiles) writeFileAtomically(ctx context.Context, dest string, contents []byte, perm os.FileMode) (err error) {
+	root := s.ArchiveDir
+	if s.inUserDir(dest) {
+		root = s.UserDir
+	}
+	tmp, err := s.tmpFileIn(ctx, root)
+	if err != nil {
+		return fmt.Errorf("failure creating a temp file: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(contents); err != nil {
+		return fmt.Errorf("failure writing the temp file %q: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(s.fileMode(dest, perm)); err != nil {
+		return fmt.Errorf("failure setting the permissions of the temp file %q: %w", tmp.Name(), err)
+	}
+	return commitTmpFile(tmp, dest)
+}
+
+// WriteConfigFile atomically replaces the contents of the named configuration file for the archive.
+func (s *LocalFiles) WriteConfigFile(ctx context.Context, name string, contents []byte) error {
+	configFile := s.ConfigFile(name)
+	if err := s.mkdirAll(filepath.Dir(configFile)); err != nil {
+		return fmt.Errorf("failure creating the config dir: %w", err)
+	}
+	return s.writeFileAtomically(ctx, configFile, contents, 0600)
+}
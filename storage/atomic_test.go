@@ -0,0 +1,46 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteConfigFile(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: t.TempDir()}
+	for _, contents := range []string{"first version", "second"} {
+		if err := s.WriteConfigFile(ctx, "example", []byte(contents)); err != nil {
+			t.Fatalf("failure writing the config file: %v", err)
+		}
+		got, err := os.ReadFile(s.ConfigFile("example"))
+		if err != nil {
+			t.Fatalf("failure reading the config file: %v", err)
+		}
+		if string(got) != contents {
+			t.Errorf("unexpected config file contents: got %q, want %q", got, contents)
+		}
+	}
+	leftovers, err := os.ReadDir(filepath.Join(s.ArchiveDir, "tmp"))
+	if err != nil {
+		t.Fatalf("failure reading the tmp dir: %v", err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("unexpected temporary files left behind: %v", leftovers)
+	}
+}
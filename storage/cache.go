@@ -0,0 +1,480 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// cacheFlushThreshold is the number of pending cache updates that
+// triggers an automatic write of the cache index to disk when no
+// `CacheMemory` budget is set.
+const cacheFlushThreshold = 1024
+
+// cachedInfoOverhead is the estimated memory used by a pending cache
+// update in addition to its path.
+const cachedInfoOverhead = 256
+
+// CacheValidation controls how strictly cached path information is
+// compared against the current state of a file.
+type CacheValidation int
+
+const (
+	// CacheValidationStrict requires the device, inode, size, mode,
+	// modification time, change time, and inode generation (where
+	// the platform provides one) to all be unchanged.
+	//
+	// This detects changes made by tools that preserve the modification
+	// time, and changes made within the granularity of the file system's
+	// modification timestamps.
+	CacheValidationStrict CacheValidation = iota
+
+	// CacheValidationModTime requires only the device, inode, size,
+	// mode, and modification time to be unchanged.
+	//
+	// This avoids rehashing files whose change time was updated
+	// without their contents changing (e.g. by creating a hard link),
+	// and also allows the contents of renamed or moved files to be
+	// reused; see `LocalFiles.FindCachedFile`.
+	CacheValidationModTime
+)
+
+// ParseCacheValidation parses a cache validation level from its name.
+//
+// The supported names are "strict" and "modtime".
+func ParseCacheValidation(name string) (CacheValidation, error) {
+	switch name {
+	case "strict":
+		return CacheValidationStrict, nil
+	case "modtime":
+		return CacheValidationModTime, nil
+	}
+	return CacheValidationStrict, fmt.Errorf("unknown cache validation level %q", name)
+}
+
+// cachedInfo is a single entry in the path info cache index.
+type cachedInfo struct {
+	Dev        uint64
+	Ino        uint64
+	Size       int64
+	Mode       os.FileMode
+	ModTime    int64
+	ChangeTime int64
+	Gen        uint64
+
+	// Hash is the hash of the snapshot that the path mapped to when the entry was cached.
+	Hash *snapshot.Hash
+}
+
+func newCachedInfo(info os.FileInfo) (*cachedInfo, bool) {
+	if info.Sys() == nil {
+		return nil, false
+	}
+	dev, ino, ctime, gen, ok := statInfo(info)
+	if !ok {
+		return nil, false
+	}
+	return &cachedInfo{
+		Dev:        dev,
+		Ino:        ino,
+		Size:       info.Size(),
+		Mode:       info.Mode(),
+		ModTime:    info.ModTime().UnixNano(),
+		ChangeTime: ctime,
+		Gen:        gen,
+	}, true
+}
+
+// matches reports whether or not the file information in `c` matches that in `other`.
+//
+// The cached snapshot hashes are not compared.
+func (c *cachedInfo) matches(other *cachedInfo, level CacheValidation) bool {
+	if c == nil || other == nil {
+		return false
+	}
+	if c.Dev != other.Dev ||
+		c.Ino != other.Ino ||
+		c.Size != other.Size ||
+		c.Mode != other.Mode ||
+		c.ModTime != other.ModTime {
+		return false
+	}
+	if level == CacheValidationModTime {
+		return true
+	}
+	return c.ChangeTime == other.ChangeTime && c.Gen == other.Gen
+}
+
+// fileIdentity identifies a file's contents independently of its path.
+//
+// Renaming a file updates its change time, so that is not included.
+type fileIdentity struct {
+	Dev     uint64
+	Ino     uint64
+	Size    int64
+	ModTime int64
+}
+
+func (c *cachedInfo) identity() fileIdentity {
+	return fileIdentity{
+		Dev:     c.Dev,
+		Ino:     c.Ino,
+		Size:    c.Size,
+		ModTime: c.ModTime,
+	}
+}
+
+func (c *cachedInfo) encode(p snapshot.Path) string {
+	return strings.Join([]string{
+		base64.RawStdEncoding.EncodeToString([]byte(p)),
+		strconv.FormatUint(c.Dev, 10),
+		strconv.FormatUint(c.Ino, 10),
+		strconv.FormatInt(c.Size, 10),
+		strconv.FormatUint(uint64(c.Mode), 10),
+		strconv.FormatInt(c.ModTime, 10),
+		strconv.FormatInt(c.ChangeTime, 10),
+		strconv.FormatUint(c.Gen, 10),
+		c.Hash.String(),
+	}, " ")
+}
+
+func parseCachedInfo(line string) (snapshot.Path, *cachedInfo, error) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 9 {
+		return "", nil, fmt.Errorf("malformed cache entry %q", line)
+	}
+	p, err := base64.RawStdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", nil, fmt.Errorf("failure decoding the path in the cache entry %q: %w", line, err)
+	}
+	dev, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed device in the cache entry %q: %w", line, err)
+	}
+	ino, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed inode in the cache entry %q: %w", line, err)
+	}
+	size, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed size in the cache entry %q: %w", line, err)
+	}
+	mode, err := strconv.ParseUint(parts[4], 10, 32)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed mode in the cache entry %q: %w", line, err)
+	}
+	modTime, err := strconv.ParseInt(parts[5], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed mod time in the cache entry %q: %w", line, err)
+	}
+	changeTime, err := strconv.ParseInt(parts[6], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed change time in the cache entry %q: %w", line, err)
+	}
+	gen, err := strconv.ParseUint(parts[7], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed generation in the cache entry %q: %w", line, err)
+	}
+	h, err := snapshot.ParseHash(parts[8])
+	if err != nil {
+		return "", nil, fmt.Errorf("failure parsing the hash in the cache entry %q: %w", line, err)
+	}
+	return snapshot.Path(p), &cachedInfo{
+		Dev:        dev,
+		Ino:        ino,
+		Size:       size,
+		Mode:       os.FileMode(mode),
+		ModTime:    modTime,
+		ChangeTime: changeTime,
+		Gen:        gen,
+		Hash:       h,
+	}, nil
+}
+
+func (s *LocalFiles) cacheIndexFile() string {
+	return filepath.Join(s.userStateDir(), "cacheIndex")
+}
+
+// readCacheIndex reads the path info cache index from disk.
+//
+// Malformed entries are skipped, since the worst case result of a missing
+// cache entry is that the corresponding file gets rehashed.
+func (s *LocalFiles) readCacheIndex() (map[snapshot.Path]*cachedInfo, error) {
+	index := make(map[snapshot.Path]*cachedInfo)
+	f, err := os.Open(s.cacheIndexFile())
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure opening the cache index: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		p, info, err := parseCachedInfo(scanner.Text())
+		if err != nil {
+			continue
+		}
+		index[p] = info
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failure reading the cache index: %w", err)
+	}
+	return index, nil
+}
+
+// loadCacheIndexLocked ensures the in-memory cache index is populated.
+//
+// The caller must hold `s.cacheMu`.
+func (s *LocalFiles) loadCacheIndexLocked() error {
+	if s.cacheIndex != nil {
+		return nil
+	}
+	index, err := s.readCacheIndex()
+	if err != nil {
+		return err
+	}
+	s.cacheIndex = index
+	return nil
+}
+
+// flushCacheLocked writes all pending cache updates to disk.
+//
+// The index on disk is re-read before writing so that updates made by
+// other processes sharing the same archive are preserved. The new
+// index is written to a temporary file and then renamed into place,
+// so readers never see a partially written index.
+//
+// The caller must hold `s.cacheMu`.
+func (s *LocalFiles) flushCacheLocked(ctx context.Context) error {
+	if len(s.cachePending) == 0 {
+		return nil
+	}
+	index, err := s.readCacheIndex()
+	if err != nil {
+		return err
+	}
+	for p, info := range s.cachePending {
+		index[p] = info
+	}
+	if err := s.writeCacheIndexLocked(ctx, index); err != nil {
+		return err
+	}
+	s.cachePending = nil
+	s.cachePendingSize = 0
+	return nil
+}
+
+// writeCacheIndexLocked replaces the cache index on disk with `index`.
+//
+// The caller must hold `s.cacheMu`.
+func (s *LocalFiles) writeCacheIndexLocked(ctx context.Context, index map[snapshot.Path]*cachedInfo) (err error) {
+	tmp, err := s.tmpFileIn(ctx, s.userStateDir())
+	if err != nil {
+		return fmt.Errorf("failure creating a temp file for the cache index: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := bufio.NewWriter(tmp)
+	for p, info := range index {
+		if _, err := w.WriteString(info.encode(p) + "\n"); err != nil {
+			return fmt.Errorf("failure writing the cache index: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failure writing the cache index: %w", err)
+	}
+	if err := commitTmpFile(tmp, s.cacheIndexFile()); err != nil {
+		return fmt.Errorf("failure replacing the cache index: %w", err)
+	}
+	s.cacheIndex = index
+	s.identityIndex = nil
+	return nil
+}
+
+// relocateCachedPaths moves the path info cache entries for `old`, and for every path within it, to `new`.
+func (s *LocalFiles) relocateCachedPaths(ctx context.Context, old, new snapshot.Path) error {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if err := s.flushCacheLocked(ctx); err != nil {
+		return err
+	}
+	index, err := s.readCacheIndex()
+	if err != nil {
+		return err
+	}
+	relocated := make(map[snapshot.Path]*cachedInfo)
+	for p, info := range index {
+		if newPath, ok := p.Relocate(old, new); ok {
+			delete(index, p)
+			relocated[newPath] = info
+		}
+	}
+	if len(relocated) == 0 {
+		return nil
+	}
+	for p, info := range relocated {
+		index[p] = info
+	}
+	return s.writeCacheIndexLocked(ctx, index)
+}
+
+// identityIndexLocked returns the index of cached snapshots by file identity, building it if necessary.
+//
+// The caller must hold `s.cacheMu`.
+func (s *LocalFiles) identityIndexLocked() (map[fileIdentity]*snapshot.Hash, error) {
+	if s.identityIndex != nil {
+		return s.identityIndex, nil
+	}
+	if err := s.loadCacheIndexLocked(); err != nil {
+		return nil, err
+	}
+	index := make(map[fileIdentity]*snapshot.Hash)
+	for _, info := range s.cacheIndex {
+		if info.Mode.IsRegular() {
+			index[info.identity()] = info.Hash
+		}
+	}
+	s.identityIndex = index
+	return index, nil
+}
+
+// Flush writes any pending updates to the path info cache to disk.
+//
+// Cache updates are batched in memory, so this should be called before
+// the process exits in order to persist them.
+func (s *LocalFiles) Flush(ctx context.Context) error {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	return s.flushCacheLocked(ctx)
+}
+
+func (s *LocalFiles) CachePathInfo(ctx context.Context, p snapshot.Path, info os.FileInfo) error {
+	newInfo, ok := newCachedInfo(info)
+	if !ok {
+		return nil
+	}
+	h, err := s.findSnapshotHash(p)
+	if err != nil {
+		return fmt.Errorf("failure looking up the snapshot for %q: %w", p, err)
+	}
+	newInfo.Hash = h
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if err := s.loadCacheIndexLocked(); err != nil {
+		return fmt.Errorf("failure loading the cache index: %w", err)
+	}
+	s.cacheIndex[p] = newInfo
+	if s.identityIndex != nil && newInfo.Mode.IsRegular() {
+		s.identityIndex[newInfo.identity()] = h
+	}
+	if s.cachePending == nil {
+		s.cachePending = make(map[snapshot.Path]*cachedInfo)
+	}
+	if _, ok := s.cachePending[p]; !ok {
+		s.cachePendingSize += int64(len(p)) + cachedInfoOverhead
+	}
+	s.cachePending[p] = newInfo
+	if s.cacheFlushDue() {
+		return s.flushCacheLocked(ctx)
+	}
+	return nil
+}
+
+// cacheFlushDue reports whether or not the pending cache updates should be written to disk.
+//
+// The caller must hold `s.cacheMu`.
+func (s *LocalFiles) cacheFlushDue() bool {
+	if s.CacheMemory <= 0 {
+		return len(s.cachePending) >= cacheFlushThreshold
+	}
+	return s.cachePendingSize >= s.CacheMemory
+}
+
+func (s *LocalFiles) PathInfoMatchesCache(ctx context.Context, p snapshot.Path, info os.FileInfo) bool {
+	newInfo, ok := newCachedInfo(info)
+	if !ok {
+		return false
+	}
+	s.cacheMu.Lock()
+	if err := s.loadCacheIndexLocked(); err != nil {
+		s.cacheMu.Unlock()
+		return false
+	}
+	cached, ok := s.cacheIndex[p]
+	s.cacheMu.Unlock()
+	if !ok || !cached.matches(newInfo, s.CacheValidation) {
+		return false
+	}
+	// Make sure the path has not been remapped to a different snapshot
+	// since the entry was cached (e.g. by a merge).
+	h, err := s.findSnapshotHash(p)
+	if err != nil {
+		return false
+	}
+	return h.Equal(cached.Hash)
+}
+
+// FindCachedFile looks up the snapshot previously cached for a regular
+// file with the same device, inode, size, and modification time as
+// `info`, regardless of the path it was cached for.
+//
+// This recognizes files that were renamed or moved to `p` since they
+// were last snapshotted. The change time is updated by renames, so it
+// cannot be compared, and this could miss changes made by tools that
+// preserve the modification time. Files are therefore never found
+// with strict cache validation, nor if `p` already has a cache entry,
+// since then its contents are only reused if that entry matches.
+func (s *LocalFiles) FindCachedFile(ctx context.Context, p snapshot.Path, info os.FileInfo) (*snapshot.Hash, *snapshot.File, bool) {
+	if s.CacheValidation == CacheValidationStrict {
+		return nil, nil, false
+	}
+	newInfo, ok := newCachedInfo(info)
+	if !ok || !newInfo.Mode.IsRegular() {
+		return nil, nil, false
+	}
+	s.cacheMu.Lock()
+	var h *snapshot.Hash
+	if err := s.loadCacheIndexLocked(); err == nil {
+		if _, cached := s.cacheIndex[p]; !cached {
+			if index, err := s.identityIndexLocked(); err == nil {
+				h = index[newInfo.identity()]
+			}
+		}
+	}
+	s.cacheMu.Unlock()
+	if h == nil {
+		return nil, nil, false
+	}
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return nil, nil, false
+	}
+	return h, f, true
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestCachePathInfo(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive")
+	file := filepath.Join(dir, "example.txt")
+	p := snapshot.Path(file)
+	if err := os.WriteFile(file, []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		t.Fatalf("failure reading the file info for the example file: %v", err)
+	}
+
+	s := &LocalFiles{ArchiveDir: archive}
+	if _, _, err := snapshot.Current(ctx, s, p); err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if err := s.CachePathInfo(ctx, p, info); err != nil {
+		t.Fatalf("failure caching the path info: %v", err)
+	}
+	if !s.PathInfoMatchesCache(ctx, p, info) {
+		t.Error("path info did not match the cache before flushing")
+	}
+
+	// A fresh store will not see the entry until it has been flushed.
+	if (&LocalFiles{ArchiveDir: archive}).PathInfoMatchesCache(ctx, p, info) {
+		t.Error("unexpected cache match for unflushed entry")
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("failure flushing the cache: %v", err)
+	}
+	if !(&LocalFiles{ArchiveDir: archive}).PathInfoMatchesCache(ctx, p, info) {
+		t.Error("path info did not match the cache after flushing")
+	}
+
+	if err := os.WriteFile(file, []byte("Goodbye, World!"), 0700); err != nil {
+		t.Fatalf("failure updating the example file: %v", err)
+	}
+	updatedInfo, err := os.Lstat(file)
+	if err != nil {
+		t.Fatalf("failure reading the file info for the updated file: %v", err)
+	}
+	if s.PathInfoMatchesCache(ctx, p, updatedInfo) {
+		t.Error("unexpected cache match for an updated file")
+	}
+}
+
+func TestCacheMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive")
+	var paths []snapshot.Path
+	for _, name := range []string{"a.txt", "b.txt"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(name), 0700); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+		paths = append(paths, snapshot.Path(file))
+	}
+
+	s := &LocalFiles{ArchiveDir: archive, CacheMemory: int64(len(paths[0])) + cachedInfoOverhead + 1}
+	for i, p := range paths {
+		info, err := os.Lstat(string(p))
+		if err != nil {
+			t.Fatalf("failure reading the file info for %q: %v", p, err)
+		}
+		if _, _, err := snapshot.Current(ctx, s, p); err != nil {
+			t.Fatalf("failure snapshotting %q: %v", p, err)
+		}
+		if err := s.CachePathInfo(ctx, p, info); err != nil {
+			t.Fatalf("failure caching the path info for %q: %v", p, err)
+		}
+		// The first update fits within the budget, but the second does not.
+		flushed := (&LocalFiles{ArchiveDir: archive}).PathInfoMatchesCache(ctx, p, info)
+		if want := i == 1; flushed != want {
+			t.Errorf("unexpected flush state after caching %q: got %v, want %v", p, flushed, want)
+		}
+	}
+}
+
+// countingFilter is a content filter that counts how many files it was applied to.
+type countingFilter struct {
+	count int
+}
+
+func (f *countingFilter) Name() string {
+	return "counting"
+}
+
+func (f *countingFilter) Matches(snapshot.Path) bool {
+	return true
+}
+
+func (f *countingFilter) Clean(ctx context.Context, r io.Reader, w io.Writer) error {
+	f.count++
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func TestFindCachedFileAfterRename(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive"), CacheValidation: CacheValidationModTime}
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("failure creating the example directory: %v", err)
+	}
+	file := filepath.Join(src, "example.txt")
+	if err := os.WriteFile(file, []byte("Hello, World!"), 0700); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	// Files modified just before being snapshotted are not cached.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, past, past); err != nil {
+		t.Fatalf("failure updating the timestamps of the example file: %v", err)
+	}
+	filter := &countingFilter{}
+	_, f, err := snapshot.NewSnapshotter(s, snapshot.WithFilters(filter)).Snapshot(ctx, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("failure flushing the cache: %v", err)
+	}
+
+	dest := filepath.Join(dir, "dest")
+	if err := os.Rename(src, dest); err != nil {
+		t.Fatalf("failure renaming the example directory: %v", err)
+	}
+	moved := filepath.Join(dest, "example.txt")
+	info, err := os.Lstat(moved)
+	if err != nil {
+		t.Fatalf("failure reading the file info for the moved file: %v", err)
+	}
+	if _, _, ok := (&LocalFiles{ArchiveDir: s.ArchiveDir}).FindCachedFile(ctx, snapshot.Path(moved), info); ok {
+		t.Error("unexpectedly found the moved file with strict cache validation")
+	}
+	s = &LocalFiles{ArchiveDir: s.ArchiveDir, CacheValidation: CacheValidationModTime}
+	if _, _, ok := s.FindCachedFile(ctx, snapshot.Path(file), info); ok {
+		t.Error("unexpectedly found the moved file for a path with its own cache entry")
+	}
+	if _, cached, ok := s.FindCachedFile(ctx, snapshot.Path(moved), info); !ok {
+		t.Error("failed to find the moved file in the cache")
+	} else if !cached.Contents.Equal(f.Contents) {
+		t.Errorf("unexpected cached contents for the moved file: got %q, want %q", cached.Contents, f.Contents)
+	}
+	_, movedFile, err := snapshot.NewSnapshotter(s, snapshot.WithFilters(filter)).Snapshot(ctx, snapshot.Path(dest))
+	if err != nil {
+		t.Fatalf("failure snapshotting the renamed directory: %v", err)
+	}
+	if got, want := filter.count, 1; got != want {
+		t.Errorf("unexpected number of files read: got %d, want %d", got, want)
+	}
+	tree, err := s.ListDirectorySnapshotContents(ctx, nil, movedFile)
+	if err != nil {
+		t.Fatalf("failure listing the contents of the renamed directory: %v", err)
+	}
+	movedSnapshot, err := s.ReadSnapshot(ctx, tree[snapshot.Path("example.txt")])
+	if err != nil {
+		t.Fatalf("failure reading the snapshot of the moved file: %v", err)
+	}
+	if !movedSnapshot.Contents.Equal(f.Contents) {
+		t.Errorf("unexpected contents for the moved file: got %q, want %q", movedSnapshot.Contents, f.Contents)
+	}
+
+	// Modified files must be read again.
+	if err := os.WriteFile(moved, []byte("Goodbye, World!"), 0700); err != nil {
+		t.Fatalf("failure updating the moved file: %v", err)
+	}
+	if info, err := os.Lstat(moved); err != nil {
+		t.Fatalf("failure reading the file info for the updated file: %v", err)
+	} else if _, _, ok := s.FindCachedFile(ctx, snapshot.Path(moved), info); ok {
+		t.Error("unexpectedly found the updated file in the cache")
+	}
+}
+
+func TestCachedInfoMatches(t *testing.T) {
+	base := &cachedInfo{Dev: 1, Ino: 2, Size: 3, Mode: 0700, ModTime: 4, ChangeTime: 5, Gen: 6}
+	testCases := []struct {
+		Description string
+		Other       cachedInfo
+		Level       CacheValidation
+		Want        bool
+	}{
+		{
+			Description: "identical strict",
+			Other:       *base,
+			Want:        true,
+		},
+		{
+			Description: "changed size",
+			Other:       cachedInfo{Dev: 1, Ino: 2, Size: 7, Mode: 0700, ModTime: 4, ChangeTime: 5, Gen: 6},
+			Level:       CacheValidationModTime,
+		},
+		{
+			Description: "changed change time strict",
+			Other:       cachedInfo{Dev: 1, Ino: 2, Size: 3, Mode: 0700, ModTime: 4, ChangeTime: 7, Gen: 6},
+		},
+		{
+			Description: "changed change time modtime",
+			Other:       cachedInfo{Dev: 1, Ino: 2, Size: 3, Mode: 0700, ModTime: 4, ChangeTime: 7, Gen: 6},
+			Level:       CacheValidationModTime,
+			Want:        true,
+		},
+		{
+			Description: "changed generation strict",
+			Other:       cachedInfo{Dev: 1, Ino: 2, Size: 3, Mode: 0700, ModTime: 4, ChangeTime: 5, Gen: 7},
+		},
+	}
+	for _, testCase := range testCases {
+		if got, want := base.matches(&testCase.Other, testCase.Level), testCase.Want; got != want {
+			t.Errorf("unexpected result for test case %q: got %v, want %v", testCase.Description, got, want)
+		}
+	}
+}
+
+// BenchmarkSnapshotUnchangedTree measures snapshotting a tree of many
+// small directories after all of its files have been cached.
+func BenchmarkSnapshotUnchangedTree(b *testing.B) {
+	ctx := context.Background()
+	dir := b.TempDir()
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	root := filepath.Join(dir, "tree")
+	past := time.Now().Add(-time.Hour)
+	for i := 0; i < 500; i++ {
+		subdir := filepath.Join(root, fmt.Sprintf("dir-%03d", i))
+		if err := os.MkdirAll(subdir, 0700); err != nil {
+			b.Fatalf("failure creating the example directory: %v", err)
+		}
+		for j := 0; j < 2; j++ {
+			file := filepath.Join(subdir, fmt.Sprintf("file-%02d.txt", j))
+			if err := os.WriteFile(file, []byte(file), 0600); err != nil {
+				b.Fatalf("failure creating the example file: %v", err)
+			}
+			if err := os.Chtimes(file, past, past); err != nil {
+				b.Fatalf("failure updating the modification time of the example file: %v", err)
+			}
+		}
+	}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(root)); err != nil {
+		b.Fatalf("failure creating the initial snapshot: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := snapshot.Current(ctx, s, snapshot.Path(root)); err != nil {
+			b.Fatalf("failure recreating the snapshot: %v", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadCommandConfig reads the named config file, which names commands that rvcs runs.
+//
+// Anyone able to change such a file could run commands as whoever next
+// uses the archive, so this refuses to read it if it is writable by
+// other users, or if it is owned by anyone other than the current user
+// or the owner of the archive. In a shared archive, that means only the
+// user who shared it may configure commands.
+//
+// If the file does not exist, the returned error matches `ErrNotFound`.
+func (s *LocalFiles) ReadCommandConfig(name string) ([]byte, error) {
+	configFile := s.ConfigFile(name)
+	f, err := os.Open(configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the info of %q: %w", configFile, err)
+	}
+	archiveInfo, err := os.Stat(s.ArchiveDir)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the info of the archive %q: %w", s.ArchiveDir, err)
+	}
+	if !trustedFile(info, archiveInfo) {
+		return nil, fmt.Errorf("refusing to run the commands configured in %q, since it can be modified by other users", configFile)
+	}
+	bs, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %q: %w", configFile, err)
+	}
+	return bs, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// The errors below classify failures so that callers can branch on them
+// using `errors.Is`, rather than by parsing error messages. Errors
+// throughout rvcs wrap the errors that caused them, so these match
+// regardless of how deeply the failure occurred.
+var (
+	// ErrNotFound means that a requested object, snapshot, track, or file does not exist.
+	//
+	// This is the same as `fs.ErrNotExist`, so it also matches the
+	// errors returned by the `os` package for missing files.
+	ErrNotFound = fs.ErrNotExist
+
+	// ErrConflict means that changes could not be combined without human intervention.
+	ErrConflict = errors.New("conflicting changes")
+
+	// ErrCorrupt means that stored data did not match its hash or could not be parsed.
+	ErrCorrupt = errors.New("corrupt data")
+)
+
+// Is reports that hash mismatches are a form of corruption.
+func (e *HashMismatchError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// Is reports that rejected updates to append-only archives are a form of conflict.
+func (e *NotFastForwardError) Is(target error) bool {
+	return target == ErrConflict
+}
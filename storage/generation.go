@@ -0,0 +1,58 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// generationConfig is the name of the archive config file holding the archive's generation token.
+const generationConfig = "generation"
+
+// Generation returns the generation token of the archive.
+//
+// The token changes whenever objects are removed from the archive, such
+// as when they are offloaded to a remote, so that anything that assumed
+// the archive had an object can tell that the assumption may be stale.
+// Archives from which no objects have ever been removed have an empty
+// token.
+func (s *LocalFiles) Generation() (string, error) {
+	bs, err := os.ReadFile(s.ConfigFile(generationConfig))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failure reading the generation of the archive: %w", err)
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// NewGeneration replaces the generation token of the archive with a new, random one.
+//
+// This must be called after removing any objects from the archive.
+func (s *LocalFiles) NewGeneration(ctx context.Context) error {
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return fmt.Errorf("failure generating a generation token: %w", err)
+	}
+	if err := s.WriteConfigFile(ctx, generationConfig, []byte(hex.EncodeToString(token[:])+"\n")); err != nil {
+		return fmt.Errorf("failure writing the generation of the archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func (s *LocalFiles) groupFile(name string) string {
+	return filepath.Join(s.ArchiveDir, "groups", name)
+}
+
+// FindGroup returns the hash of the latest group recorded under the given name.
+//
+// Group names follow the same rules as track IDs.
+func (s *LocalFiles) FindGroup(ctx context.Context, name string) (*snapshot.Hash, error) {
+	if !ValidTrackID(name) {
+		return nil, fmt.Errorf("invalid group name %q", name)
+	}
+	bs, err := os.ReadFile(s.groupFile(name))
+	if err != nil {
+		return nil, err
+	}
+	h, err := snapshot.ParseHash(string(bs))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the hash %q for the group %q: %w", bs, name, err)
+	}
+	return h, nil
+}
+
+// ReadGroup reads the group object with the given hash.
+func (s *LocalFiles) ReadGroup(ctx context.Context, h *snapshot.Hash) (*snapshot.Group, error) {
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		return nil, fmt.Errorf("failure looking up the group %q: %w", h, err)
+	}
+	defer reader.Close()
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the contents of the group %q: %w", h, err)
+	}
+	g, err := snapshot.ParseGroup(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the group %q: %w: %v", h, ErrCorrupt, err)
+	}
+	return g, nil
+}
+
+// StoreGroup records the given snapshots as the latest group with the given name.
+//
+// The new group refers to the group previously recorded under the same
+// name, so earlier groups remain reachable from the latest one.
+func (s *LocalFiles) StoreGroup(ctx context.Context, name string, snapshots snapshot.Tree) (*snapshot.Hash, error) {
+	prev, err := s.FindGroup(ctx, name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failure looking up the current group %q: %w", name, err)
+	}
+	g := &snapshot.Group{Previous: prev, Snapshots: snapshots}
+	h, err := s.StoreObject(ctx, strings.NewReader(g.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the group %q: %w", name, err)
+	}
+	groupFile := s.groupFile(name)
+	if err := s.mkdirAll(filepath.Dir(groupFile)); err != nil {
+		return nil, fmt.Errorf("failure creating the groups dir: %w", err)
+	}
+	if err := s.writeFileAtomically(ctx, groupFile, []byte(h.String()), 0600); err != nil {
+		return nil, fmt.Errorf("failure recording %q for the group %q: %w", h, name, err)
+	}
+	return h, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: t.TempDir()}
+	if _, err := s.FindGroup(ctx, "app"); !os.IsNotExist(err) {
+		t.Errorf("unexpected result looking up a missing group: %v", err)
+	}
+	var hashes []*snapshot.Hash
+	for _, contents := range []string{"code", "database dump", "newer code"} {
+		h, err := s.StoreObject(ctx, strings.NewReader(contents))
+		if err != nil {
+			t.Fatalf("failure storing the example snapshot %q: %v", contents, err)
+		}
+		hashes = append(hashes, h)
+	}
+	first, err := s.StoreGroup(ctx, "app", snapshot.Tree{"/app": hashes[0], "/db/dump sql": hashes[1]})
+	if err != nil {
+		t.Fatalf("failure storing the first group: %v", err)
+	}
+	second, err := s.StoreGroup(ctx, "app", snapshot.Tree{"/app": hashes[2], "/db/dump sql": hashes[1]})
+	if err != nil {
+		t.Fatalf("failure storing the second group: %v", err)
+	}
+	if latest, err := s.FindGroup(ctx, "app"); err != nil {
+		t.Fatalf("failure looking up the group: %v", err)
+	} else if !latest.Equal(second) {
+		t.Errorf("unexpected latest group: got %q, want %q", latest, second)
+	}
+	g, err := s.ReadGroup(ctx, second)
+	if err != nil {
+		t.Fatalf("failure reading the group %q: %v", second, err)
+	}
+	if !g.Previous.Equal(first) {
+		t.Errorf("unexpected previous group: got %q, want %q", g.Previous, first)
+	}
+	if len(g.Snapshots) != 2 || !g.Snapshots["/app"].Equal(hashes[2]) || !g.Snapshots["/db/dump sql"].Equal(hashes[1]) {
+		t.Errorf("unexpected group members: %v", g.Snapshots)
+	}
+	if g, err = s.ReadGroup(ctx, first); err != nil {
+		t.Fatalf("failure reading the group %q: %v", first, err)
+	} else if g.Previous != nil || !g.Snapshots["/app"].Equal(hashes[0]) {
+		t.Errorf("unexpected first group: %+v", g)
+	}
+	if _, err := s.StoreGroup(ctx, "../escape", nil); err == nil {
+		t.Error("unexpected success storing a group with an invalid name")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// notesFile returns the location of the file listing the notes attached to the snapshot `h`.
+func (s *LocalFiles) notesFile(h *snapshot.Hash) string {
+	dir, name := objectName(h, filepath.Join(s.ArchiveDir, "notes"))
+	return filepath.Join(dir, name)
+}
+
+// ListNotes returns the hashes of the objects attached as notes to the snapshot `h`.
+//
+// The notes are returned in the order they were added.
+func (s *LocalFiles) ListNotes(ctx context.Context, h *snapshot.Hash) ([]*snapshot.Hash, error) {
+	bs, err := os.ReadFile(s.notesFile(h))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the notes for %q: %w", h, err)
+	}
+	var notes []*snapshot.Hash
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		note, err := snapshot.ParseHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("failure parsing the note %q for %q: %w", line, h, err)
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+// AddNote attaches the previously stored object `note` to the snapshot `h`.
+//
+// Notes do not change the snapshot they are attached to, so its hash
+// remains the same. Attaching the same note more than once has no effect.
+func (s *LocalFiles) AddNote(ctx context.Context, h, note *snapshot.Hash) error {
+	if !s.HasObject(ctx, note) {
+		return fmt.Errorf("the note %q has not been stored", note)
+	}
+	notes, err := s.ListNotes(ctx, h)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, existing := range notes {
+		if existing.Equal(note) {
+			return nil
+		}
+		lines = append(lines, existing.String())
+	}
+	lines = append(lines, note.String())
+	notesFile := s.notesFile(h)
+	if err := s.mkdirAll(filepath.Dir(notesFile)); err != nil {
+		return fmt.Errorf("failure creating the notes dir for %q: %w", h, err)
+	}
+	if err := s.writeFileAtomically(ctx, notesFile, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		return fmt.Errorf("failure writing the notes for %q: %w", h, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestNotes(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: t.TempDir()}
+	h, err := s.StoreObject(ctx, strings.NewReader("snapshot"))
+	if err != nil {
+		t.Fatalf("failure storing the example snapshot: %v", err)
+	}
+	first, err := s.StoreObject(ctx, strings.NewReader("first note"))
+	if err != nil {
+		t.Fatalf("failure storing the first note: %v", err)
+	}
+	second, err := s.StoreObject(ctx, strings.NewReader("second note"))
+	if err != nil {
+		t.Fatalf("failure storing the second note: %v", err)
+	}
+	// Adding the first note a second time should not duplicate it.
+	for _, note := range []*snapshot.Hash{first, second, first} {
+		if err := s.AddNote(ctx, h, note); err != nil {
+			t.Fatalf("failure adding the note %q: %v", note, err)
+		}
+	}
+	notes, err := s.ListNotes(ctx, h)
+	if err != nil {
+		t.Fatalf("failure listing the notes: %v", err)
+	}
+	if len(notes) != 2 || !notes[0].Equal(first) || !notes[1].Equal(second) {
+		t.Errorf("unexpected notes: got %v, want [%v %v]", notes, first, second)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Objects read from a base archive, which may be on a slow network
+// mount, are copied into a local read-through cache when the archive's
+// `ObjectCacheSize` is set. Once the total size of the cached objects
+// exceeds that limit, the least recently read objects are evicted.
+//
+// Recency is tracked with the modification times of the cached files,
+// so it persists across runs of rvcs.
+
+// objectCacheEntry is a single object in the read-through object cache.
+type objectCacheEntry struct {
+	file string
+	size int64
+}
+
+// objectCache is the in-memory index of the read-through object cache.
+type objectCache struct {
+	// lru orders the cached objects from most to least recently read.
+	lru *list.List
+
+	// elements maps each cached object file to its element in `lru`.
+	elements map[string]*list.Element
+
+	// totalSize is the combined size of all of the cached objects.
+	totalSize int64
+}
+
+func (s *LocalFiles) objectCacheDir() string {
+	return filepath.Join(s.userStateDir(), "objectcache")
+}
+
+// cachedObjectFile returns the location of the given object in the read-through object cache, if it is there.
+func (s *LocalFiles) cachedObjectFile(h *snapshot.Hash) (string, bool) {
+	if s.ObjectCacheSize <= 0 {
+		return "", false
+	}
+	objPath, objName := objectName(h, s.objectCacheDir())
+	cachedFile := filepath.Join(objPath, objName)
+	if _, err := os.Stat(cachedFile); err != nil {
+		return "", false
+	}
+	return cachedFile, true
+}
+
+// loadObjectCache reads the index of the read-through object cache from disk if it has not already been loaded.
+//
+// The caller must hold `s.objectCacheMu`.
+func (s *LocalFiles) loadObjectCache() error {
+	if s.objectCache != nil {
+		return nil
+	}
+	type loaded struct {
+		objectCacheEntry
+		modTime time.Time
+	}
+	var entries []*loaded
+	err := filepath.WalkDir(s.objectCacheDir(), func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &loaded{
+			objectCacheEntry: objectCacheEntry{file: path, size: info.Size()},
+			modTime:          info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failure reading the object cache: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.After(entries[j].modTime)
+	})
+	c := &objectCache{
+		lru:      list.New(),
+		elements: make(map[string]*list.Element),
+	}
+	for _, e := range entries {
+		entry := e.objectCacheEntry
+		c.elements[entry.file] = c.lru.PushBack(&entry)
+		c.totalSize += entry.size
+	}
+	s.objectCache = c
+	return nil
+}
+
+// touchCachedObject marks the given cached object file as the most recently read.
+func (s *LocalFiles) touchCachedObject(cachedFile string) {
+	s.objectCacheMu.Lock()
+	defer s.objectCacheMu.Unlock()
+	if err := s.loadObjectCache(); err != nil {
+		return
+	}
+	if elem, ok := s.objectCache.elements[cachedFile]; ok {
+		s.objectCache.lru.MoveToFront(elem)
+	}
+	now := time.Now()
+	os.Chtimes(cachedFile, now, now)
+}
+
+// cacheObject copies the given object from the base archive file `baseFile` into the read-through object cache.
+//
+// The returned value is the location of the cached copy. The contents
+// are verified against the object's hash, and objects larger than the
+// entire cache are not cached.
+func (s *LocalFiles) cacheObject(ctx context.Context, h *snapshot.Hash, baseFile string) (string, error) {
+	info, err := os.Stat(baseFile)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > s.ObjectCacheSize {
+		return "", fmt.Errorf("the object %q is larger than the object cache", h)
+	}
+	reader, err := os.Open(baseFile)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return s.cacheObjectFrom(ctx, h, reader)
+}
+
+// CacheObject copies the object `h`, read from `reader`, into the
+// read-through object cache, and opens the cached copy for reading.
+//
+// This lets objects read from somewhere other than a base archive,
+// such as a remote, be read again without fetching them. It fails if
+// the archive's `ObjectCacheSize` is not set, if the contents do not
+// match `h`, or if the object is larger than the entire cache.
+func (s *LocalFiles) CacheObject(ctx context.Context, h *snapshot.Hash, reader io.Reader) (io.ReadCloser, error) {
+	if s.ObjectCacheSize <= 0 {
+		return nil, fmt.Errorf("the object cache is not enabled")
+	}
+	cachedFile, err := s.cacheObjectFrom(ctx, h, reader)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(cachedFile)
+}
+
+// cacheObjectFrom copies the object `h`, read from `reader`, into the read-through object cache.
+//
+// The returned value is the location of the cached copy.
+func (s *LocalFiles) cacheObjectFrom(ctx context.Context, h *snapshot.Hash, reader io.Reader) (cachedFile string, err error) {
+	tmp, err := s.tmpFileIn(ctx, s.userStateDir())
+	if err != nil {
+		return "", fmt.Errorf("failure creating a temp file: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	got, err := snapshot.NewHash(io.TeeReader(io.LimitReader(reader, s.ObjectCacheSize+1), tmp))
+	if err != nil {
+		return "", fmt.Errorf("failure copying the object %q: %w", h, err)
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failure reading the size of the copy of %q: %w", h, err)
+	}
+	if info.Size() > s.ObjectCacheSize {
+		return "", fmt.Errorf("the object %q is larger than the object cache", h)
+	} else if !got.Equal(h) {
+		return "", fmt.Errorf("the contents read for %q hashed to %q", h, got)
+	}
+	objPath, objName := objectName(h, s.objectCacheDir())
+	if err := os.MkdirAll(objPath, os.FileMode(0700)); err != nil {
+		return "", fmt.Errorf("failure creating the object cache dir for %q: %w", h, err)
+	}
+	cachedFile = filepath.Join(objPath, objName)
+	if err := commitTmpFile(tmp, cachedFile); err != nil {
+		return "", fmt.Errorf("failure writing the cached object file for %q: %w", h, err)
+	}
+
+	s.objectCacheMu.Lock()
+	defer s.objectCacheMu.Unlock()
+	if err := s.loadObjectCache(); err != nil {
+		return "", err
+	}
+	c := s.objectCache
+	if elem, ok := c.elements[cachedFile]; ok {
+		// The object is already indexed, either because the index was
+		// loaded after the object was written, or because another
+		// reader cached the same object concurrently.
+		c.totalSize -= elem.Value.(*objectCacheEntry).size
+		c.lru.Remove(elem)
+	}
+	c.elements[cachedFile] = c.lru.PushFront(&objectCacheEntry{file: cachedFile, size: info.Size()})
+	c.totalSize += info.Size()
+	for c.totalSize > s.ObjectCacheSize && c.lru.Len() > 1 {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*objectCacheEntry)
+		if err := os.Remove(entry.file); err != nil && !os.IsNotExist(err) {
+			return cachedFile, fmt.Errorf("failure evicting %q from the object cache: %w", entry.file, err)
+		}
+		c.lru.Remove(oldest)
+		delete(c.elements, entry.file)
+		c.totalSize -= entry.size
+	}
+	return cachedFile, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestObjectCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	base := &LocalFiles{ArchiveDir: filepath.Join(dir, "base")}
+	var objects []*snapshot.Hash
+	for _, contents := range []string{"first object", "second object", "third object"} {
+		h, err := base.StoreObject(ctx, strings.NewReader(contents))
+		if err != nil {
+			t.Fatalf("failure storing an object in the base archive: %v", err)
+		}
+		objects = append(objects, h)
+	}
+	s := &LocalFiles{
+		ArchiveDir:      filepath.Join(dir, "overlay"),
+		BaseArchiveDirs: []string{base.ArchiveDir},
+		// Large enough for two of the objects, but not all three.
+		ObjectCacheSize: 30,
+	}
+	read := func(h *snapshot.Hash) {
+		reader, err := s.ReadObject(ctx, h)
+		if err != nil {
+			t.Fatalf("failure reading the object %q: %v", h, err)
+		}
+		defer reader.Close()
+		if _, err := io.ReadAll(reader); err != nil {
+			t.Fatalf("failure reading the contents of %q: %v", h, err)
+		}
+	}
+	cached := func(h *snapshot.Hash) bool {
+		_, ok := s.cachedObjectFile(h)
+		return ok
+	}
+	read(objects[0])
+	read(objects[1])
+	if !cached(objects[0]) || !cached(objects[1]) {
+		t.Fatal("objects read from the base archive were not cached")
+	}
+	// Reading the first object again makes the second one the least recently read.
+	read(objects[0])
+	read(objects[2])
+	if got, want := []bool{cached(objects[0]), cached(objects[1]), cached(objects[2])}, []bool{true, false, true}; got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("unexpected cached objects: got %v, want %v", got, want)
+	}
+	if _, err := os.Stat(objectFile(objects[1], base.ArchiveDir)); err != nil {
+		t.Errorf("evicting a cached object removed it from the base archive: %v", err)
+	}
+	if s.objectCache.totalSize > s.ObjectCacheSize {
+		t.Errorf("object cache exceeds its size limit: %d > %d", s.objectCache.totalSize, s.ObjectCacheSize)
+	}
+}
+
+func TestCacheObject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	contents := "fetched object"
+	h, err := snapshot.NewHash(strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("failure hashing the example object: %v", err)
+	}
+	if _, err := (&LocalFiles{ArchiveDir: filepath.Join(dir, "disabled")}).CacheObject(ctx, h, strings.NewReader(contents)); err == nil {
+		t.Error("unexpected success caching an object with the object cache disabled")
+	}
+
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive"), ObjectCacheSize: 100}
+	if _, err := s.CacheObject(ctx, h, strings.NewReader("tampered")); err == nil {
+		t.Error("unexpected success caching mismatched contents")
+	}
+	if _, err := s.CacheObject(ctx, h, strings.NewReader(strings.Repeat("x", 101))); err == nil {
+		t.Error("unexpected success caching an object larger than the cache")
+	}
+	reader, err := s.CacheObject(ctx, h, strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("failure caching the example object: %v", err)
+	}
+	reader.Close()
+	if !s.HasObject(ctx, h) {
+		t.Error("the cached object is not available from the archive")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Overlay is a `snapshot.Storage` that stores new objects and snapshots
+// in a temporary archive, while reading previous snapshots and the path
+// info cache from an underlying archive without modifying it.
+//
+// The embedded `*LocalFiles` is the temporary archive, which can read
+// the objects of both archives.
+type Overlay struct {
+	*LocalFiles
+	s *LocalFiles
+}
+
+// NewOverlay returns a new overlay of the archive `s`.
+//
+// The returned overlay must be closed once it is no longer needed, which removes its temporary archive.
+func NewOverlay(s *LocalFiles) (*Overlay, error) {
+	tmpDir, err := os.MkdirTemp("", "rvcs-overlay")
+	if err != nil {
+		return nil, fmt.Errorf("failure creating a temporary directory for the overlay: %w", err)
+	}
+	return &Overlay{
+		LocalFiles: &LocalFiles{
+			ArchiveDir:      tmpDir,
+			BaseArchiveDirs: append([]string{s.ArchiveDir}, s.BaseArchiveDirs...),
+			CacheValidation: s.CacheValidation,
+		},
+		s: s,
+	}, nil
+}
+
+// Close removes the temporary archive of the overlay.
+func (o *Overlay) Close() error {
+	return os.RemoveAll(o.ArchiveDir)
+}
+
+func (o *Overlay) Exclude(p snapshot.Path) bool {
+	return o.s.Exclude(p) || o.LocalFiles.Exclude(p)
+}
+
+func (o *Overlay) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, *snapshot.File, error) {
+	h, f, err := o.LocalFiles.FindSnapshot(ctx, p)
+	if os.IsNotExist(err) {
+		return o.s.FindSnapshot(ctx, p)
+	}
+	return h, f, err
+}
+
+func (o *Overlay) CachePathInfo(ctx context.Context, p snapshot.Path, info os.FileInfo) error {
+	return nil
+}
+
+func (o *Overlay) PathInfoMatchesCache(ctx context.Context, p snapshot.Path, info os.FileInfo) bool {
+	return o.s.PathInfoMatchesCache(ctx, p, info)
+}
+
+func (o *Overlay) FindCachedFile(ctx context.Context, p snapshot.Path, info os.FileInfo) (*snapshot.Hash, *snapshot.File, bool) {
+	return o.s.FindCachedFile(ctx, p, info)
+}
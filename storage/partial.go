@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// partialObjectFile returns the location where the object `h` is assembled while it is being received.
+func (s *LocalFiles) partialObjectFile(h *snapshot.Hash) string {
+	return filepath.Join(s.ArchiveDir, "partial", h.Function()+"-"+h.HexContents())
+}
+
+// PartialObjectSize returns the number of bytes received so far for the object `h`.
+//
+// This is zero if no partial copy of the object exists.
+func (s *LocalFiles) PartialObjectSize(ctx context.Context, h *snapshot.Hash) (int64, error) {
+	info, err := os.Stat(s.partialObjectFile(h))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failure reading the partial copy of %q: %w", h, err)
+	}
+	return info.Size(), nil
+}
+
+// AppendPartialObject appends the given chunk to the partial copy of the object `h`.
+//
+// The chunk is synced to disk before this returns, so a copy that is
+// interrupted can later be resumed from the size reported by
+// `PartialObjectSize`.
+func (s *LocalFiles) AppendPartialObject(ctx context.Context, h *snapshot.Hash, chunk []byte) error {
+	partialFile := s.partialObjectFile(h)
+	if err := s.mkdirAll(filepath.Dir(partialFile)); err != nil {
+		return fmt.Errorf("failure creating the partial objects dir: %w", err)
+	}
+	f, err := os.OpenFile(partialFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, s.fileMode(partialFile, 0600))
+	if err != nil {
+		return fmt.Errorf("failure opening the partial copy of %q: %w", h, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(chunk); err != nil {
+		return fmt.Errorf("failure appending to the partial copy of %q: %w", h, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failure syncing the partial copy of %q: %w", h, err)
+	}
+	return f.Close()
+}
+
+// CommitPartialObject verifies the partial copy of the object `h` and then stores it.
+//
+// If the assembled contents do not match the hash, they are quarantined
+// and a `*HashMismatchError` is returned.
+func (s *LocalFiles) CommitPartialObject(ctx context.Context, h *snapshot.Hash) error {
+	partialFile := s.partialObjectFile(h)
+	f, err := os.Open(partialFile)
+	if err != nil {
+		return fmt.Errorf("failure opening the partial copy of %q: %w", h, err)
+	}
+	defer f.Close()
+	storeErr := s.StoreVerifiedObject(ctx, f, h)
+	var mismatch *HashMismatchError
+	if storeErr != nil && !errors.As(storeErr, &mismatch) {
+		// Leave the partial copy in place so that it can be retried.
+		return storeErr
+	}
+	// Either the object was stored, or its contents were quarantined, so the partial copy is no longer needed.
+	if err := os.Remove(partialFile); err != nil && storeErr == nil {
+		return fmt.Errorf("failure removing the partial copy of %q: %w", h, err)
+	}
+	return storeErr
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Relocate moves the latest snapshot of the path `old`, and of every path within it, to the path `new`.
+//
+// This is for when a directory is moved, or a drive is mounted at a
+// new location, so that subsequent snapshots of `new` continue the
+// history of `old` rather than starting a new, unrelated one. The path
+// info cache entries are moved too, so files that are unchanged need
+// not be read again.
+//
+// Anything else recorded for `old` can be moved by `moveRefs`, if it
+// is not nil, which is called once `new` is mapped and before the
+// mappings for `old` are removed. Since the mapping for `old` itself is
+// removed last, an interrupted relocation can always be retried until it
+// completes. If `new` already has a latest snapshot, it must be the same
+// as that of `old`.
+//
+// Relocating paths is not supported in append-only archives, since it
+// removes the mapping for `old`.
+func (s *LocalFiles) Relocate(ctx context.Context, old, new snapshot.Path, moveRefs func() error) error {
+	if _, ok := new.Relocate(old, new); ok {
+		return fmt.Errorf("cannot relocate %q to %q, which is within it", old, new)
+	}
+	if _, ok := old.Relocate(new, old); ok {
+		return fmt.Errorf("cannot relocate %q to %q, which contains it", old, new)
+	}
+	if s.AppendOnly() {
+		return fmt.Errorf("cannot relocate %q in an append-only archive", old)
+	}
+	h, err := s.findSnapshotHash(old)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("there is no snapshot of %q to relocate: %w", old, ErrNotFound)
+	} else if err != nil {
+		return fmt.Errorf("failure looking up the latest snapshot of %q: %w", old, err)
+	}
+	if existing, err := s.findSnapshotHash(new); err == nil && !existing.Equal(h) {
+		return fmt.Errorf("cannot relocate %q to %q, which already has the snapshot %q", old, new, existing)
+	} else if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure looking up the latest snapshot of %q: %w", new, err)
+	}
+	if err := s.ResetSnapshot(ctx, new, h); err != nil {
+		return fmt.Errorf("failure mapping %q to the snapshot %q: %w", new, h, err)
+	}
+	if err := s.relocateCachedPaths(ctx, old, new); err != nil {
+		return fmt.Errorf("failure relocating the cached path info for %q: %w", old, err)
+	}
+	if moveRefs != nil {
+		if err := moveRefs(); err != nil {
+			return err
+		}
+	}
+	if err := s.RemoveMappingForPath(ctx, old); err != nil {
+		return fmt.Errorf("failure removing the mapping for %q: %w", old, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestRelocate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	oldRoot := filepath.Join(dir, "old")
+	newRoot := filepath.Join(dir, "new")
+	oldPath, newPath := snapshot.Path(oldRoot), snapshot.Path(newRoot)
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(oldRoot, "file.txt"), []byte("contents"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	h, _, err := snapshot.Current(ctx, s, oldPath)
+	if err != nil {
+		t.Fatalf("failure snapshotting the example dir: %v", err)
+	}
+	fileHash, _, err := s.FindSnapshot(ctx, oldPath.Join("file.txt"))
+	if err != nil {
+		t.Fatalf("failure looking up the snapshot of the example file: %v", err)
+	}
+	info, err := os.Lstat(filepath.Join(oldRoot, "file.txt"))
+	if err != nil {
+		t.Fatalf("failure reading the file info for the example file: %v", err)
+	}
+	if err := s.CachePathInfo(ctx, oldPath.Join("file.txt"), info); err != nil {
+		t.Fatalf("failure caching the path info: %v", err)
+	}
+	if err := os.Rename(oldRoot, newRoot); err != nil {
+		t.Fatalf("failure moving the example dir: %v", err)
+	}
+
+	if err := s.Relocate(ctx, oldPath, oldPath.Join("sub"), nil); err == nil {
+		t.Error("unexpected success relocating a path to within itself")
+	}
+	interrupted := errors.New("interrupted")
+	if err := s.Relocate(ctx, oldPath, newPath, func() error { return interrupted }); !errors.Is(err, interrupted) {
+		t.Fatalf("unexpected result of an interrupted relocation: %v", err)
+	}
+	if got, _, err := s.FindSnapshot(ctx, oldPath); err != nil || !got.Equal(h) {
+		t.Errorf("unexpected snapshot of %q after an interrupted relocation: got %q, %v, want %q", oldPath, got, err, h)
+	}
+	moved := false
+	if err := s.Relocate(ctx, oldPath, newPath, func() error { moved = true; return nil }); err != nil {
+		t.Fatalf("failure relocating %q to %q: %v", oldPath, newPath, err)
+	} else if !moved {
+		t.Error("the references to the old path were not moved when retrying the relocation")
+	}
+	if got, _, err := s.FindSnapshot(ctx, newPath); err != nil || !got.Equal(h) {
+		t.Errorf("unexpected snapshot of %q after relocating: got %q, %v, want %q", newPath, got, err, h)
+	}
+	if got, _, err := s.FindSnapshot(ctx, newPath.Join("file.txt")); err != nil || !got.Equal(fileHash) {
+		t.Errorf("unexpected snapshot of the relocated file: got %q, %v, want %q", got, err, fileHash)
+	}
+	for _, p := range []snapshot.Path{oldPath, oldPath.Join("file.txt")} {
+		if got, _, err := s.FindSnapshot(ctx, p); !os.IsNotExist(err) {
+			t.Errorf("unexpected snapshot of %q after relocating: got %q, %v", p, got, err)
+		}
+	}
+	if !(&LocalFiles{ArchiveDir: s.ArchiveDir}).PathInfoMatchesCache(ctx, newPath.Join("file.txt"), info) {
+		t.Error("the cached path info was not relocated")
+	}
+	if got, _, err := snapshot.Current(ctx, s, newPath); err != nil || !got.Equal(h) {
+		t.Errorf("unexpected snapshot of the unchanged relocated dir: got %q, %v, want %q", got, err, h)
+	}
+	if err := s.Relocate(ctx, oldPath, newPath, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected result relocating a path with no snapshot: %v", err)
+	}
+}
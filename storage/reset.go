@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// ResetSnapshot maps the path `p` to the existing snapshot `h`, which
+// need not descend from the snapshot that `p` is currently mapped to.
+//
+// If `h` is a directory, then the paths of its children are reset to
+// their snapshots in `h` as well, so that subsequent snapshots of those
+// paths descend from them.
+//
+// In an append-only archive, this fails with a `*NotFastForwardError`
+// unless `h` descends from the current snapshot of `p`.
+func (s *LocalFiles) ResetSnapshot(ctx context.Context, p snapshot.Path, h *snapshot.Hash) error {
+	f, err := s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+	}
+	return s.resetMapping(ctx, p, h, f)
+}
+
+func (s *LocalFiles) resetMapping(ctx context.Context, p snapshot.Path, h *snapshot.Hash, f *snapshot.File) error {
+	prev, err := s.findSnapshotHash(p)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure looking up the current snapshot of %q: %w", p, err)
+	}
+	if prev.Equal(h) {
+		return nil
+	}
+	if err := s.checkFastForward(ctx, p, h, f); err != nil {
+		return err
+	}
+	var prevTree snapshot.Tree
+	if prev != nil {
+		if prevFile, err := s.ReadSnapshot(ctx, prev); err != nil {
+			return fmt.Errorf("failure reading the previous snapshot of %q: %w", p, err)
+		} else if prevFile.IsDir() {
+			if prevTree, err = s.ListDirectorySnapshotContents(ctx, prev, prevFile); err != nil {
+				return fmt.Errorf("failure listing the contents of the previous snapshot of %q: %w", p, err)
+			}
+		}
+	}
+	if err := s.mkdirAll(s.mappedPathsDir(p)); err != nil {
+		return fmt.Errorf("failure creating the mapped paths dir entry for %q: %w", p, err)
+	}
+	pathHashDir, pathHashFile, err := s.pathHashFile(p)
+	if err != nil {
+		return fmt.Errorf("failure calculating the path hash file location for %q: %w", p, err)
+	}
+	if err := s.mkdirAll(pathHashDir); err != nil {
+		return fmt.Errorf("failure creating the paths dir for %q: %w", p, err)
+	}
+	if err := s.writeFileAtomically(ctx, filepath.Join(pathHashDir, pathHashFile), []byte(h.String()), 0600); err != nil {
+		return fmt.Errorf("failure writing the hash for path %q: %w", p, err)
+	}
+	var tree snapshot.Tree
+	if f.IsDir() {
+		if tree, err = s.ListDirectorySnapshotContents(ctx, h, f); err != nil {
+			return fmt.Errorf("failure listing the contents of %q: %w", h, err)
+		}
+	}
+	for child, childHash := range tree {
+		childFile, err := s.ReadSnapshot(ctx, childHash)
+		if err != nil {
+			return fmt.Errorf("failure reading the snapshot of the child path %q: %w", child, err)
+		}
+		if err := s.resetMapping(ctx, p.Join(child), childHash, childFile); err != nil {
+			return fmt.Errorf("failure resetting the child path %q: %w", child, err)
+		}
+	}
+	for child := range prevTree {
+		if _, ok := tree[child]; ok {
+			continue
+		}
+		if err := s.RemoveMappingForPath(ctx, p.Join(child)); err != nil {
+			return fmt.Errorf("failure removing the mapping for the removed child %q: %w", child, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestResetSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "example")
+	p := snapshot.Path(root)
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	for name, contents := range map[string]string{"kept.txt": "first", "removed.txt": "removed"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failure creating the example file %q: %v", name, err)
+		}
+	}
+	first, _, err := snapshot.Current(ctx, s, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the example dir: %v", err)
+	}
+	firstKept, _, err := s.FindSnapshot(ctx, p.Join("kept.txt"))
+	if err != nil {
+		t.Fatalf("failure looking up the first snapshot of the kept file: %v", err)
+	}
+	firstRemoved, _, err := s.FindSnapshot(ctx, p.Join("removed.txt"))
+	if err != nil {
+		t.Fatalf("failure looking up the snapshot of the removed file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "kept.txt"), []byte("second"), 0600); err != nil {
+		t.Fatalf("failure updating the kept file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(root, "removed.txt")); err != nil {
+		t.Fatalf("failure removing the example file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "added.txt"), []byte("added"), 0600); err != nil {
+		t.Fatalf("failure adding the example file: %v", err)
+	}
+	if _, _, err := snapshot.Current(ctx, s, p); err != nil {
+		t.Fatalf("failure snapshotting the updated example dir: %v", err)
+	}
+
+	if err := s.ResetSnapshot(ctx, p, first); err != nil {
+		t.Fatalf("failure resetting %q to %q: %v", p, first, err)
+	}
+	if h, _, err := s.FindSnapshot(ctx, p); err != nil || !h.Equal(first) {
+		t.Errorf("unexpected snapshot of %q after the reset: got %q, %v, want %q", p, h, err, first)
+	}
+	if h, _, err := s.FindSnapshot(ctx, p.Join("kept.txt")); err != nil || !h.Equal(firstKept) {
+		t.Errorf("unexpected snapshot of the kept file after the reset: got %q, %v, want %q", h, err, firstKept)
+	}
+	if h, _, err := s.FindSnapshot(ctx, p.Join("removed.txt")); err != nil || !h.Equal(firstRemoved) {
+		t.Errorf("unexpected snapshot of the removed file after the reset: got %q, %v, want %q", h, err, firstRemoved)
+	}
+	if h, _, err := s.FindSnapshot(ctx, p.Join("added.txt")); !os.IsNotExist(err) {
+		t.Errorf("unexpected snapshot of the added file after the reset: got %q, %v", h, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "kept.txt"), []byte("third"), 0600); err != nil {
+		t.Fatalf("failure updating the kept file: %v", err)
+	}
+	_, third, err := snapshot.Current(ctx, s, p)
+	if err != nil {
+		t.Fatalf("failure snapshotting the example dir after the reset: %v", err)
+	}
+	if len(third.Parents) != 1 || !third.Parents[0].Equal(first) {
+		t.Errorf("unexpected parents of the snapshot taken after the reset: got %v, want [%q]", third.Parents, first)
+	}
+
+	if err := s.SetAppendOnly(ctx); err != nil {
+		t.Fatalf("failure marking the archive as append-only: %v", err)
+	}
+	if err := s.ResetSnapshot(ctx, p, first); err == nil {
+		t.Errorf("unexpected success resetting %q in an append-only archive", p)
+	} else if _, ok := err.(*NotFastForwardError); !ok {
+		t.Errorf("unexpected error resetting %q in an append-only archive: %v", p, err)
+	}
+}
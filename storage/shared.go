@@ -0,0 +1,209 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sharedConfig is the name of the config file that marks an archive as shared by multiple users.
+const sharedConfig = "shared"
+
+const (
+	// sharedDirMode is the mode of the directories in a shared archive.
+	//
+	// The setgid bit makes new files inherit the group of the archive,
+	// rather than the primary group of the user who wrote them.
+	sharedDirMode = 0770 | fs.ModeSetgid
+
+	// sharedFileMode is the mode of the files in a shared archive.
+	sharedFileMode = 0660
+
+	// sharedCommandFileMode is the mode of the `commandConfigs` in a shared archive.
+	//
+	// Other users may read them, but only their owner may change them.
+	sharedCommandFileMode = 0640
+)
+
+// userConfigs are the config files holding the state of an individual
+// user of the archive, rather than of the archive itself.
+//
+// In a shared archive, these are kept in the user's `UserDir`.
+var userConfigs = map[string]bool{
+	"author":    true,
+	"health":    true,
+	"metrics":   true,
+	"namespace": true,
+	"reflog":    true,
+	"resources": true,
+}
+
+// commandConfigs are the config files naming commands that rvcs runs,
+// such as content filters, scanners, and remote backend plugins.
+//
+// Anyone able to change these could run commands as every user of the
+// archive, so in a shared archive they are not writable by the group,
+// and they are only read using `ReadCommandConfig`.
+var commandConfigs = map[string]bool{
+	"filters":  true,
+	"remotes":  true,
+	"scanners": true,
+}
+
+// Shared reports whether or not the archive has been marked as shared by multiple users.
+//
+// Objects, snapshots, and the mappings from paths to snapshots in a
+// shared archive are readable and writable by the group that owns the
+// archive, while the path info cache, the read-through object cache,
+// and the config files that belong to a single user, such as the reflog,
+// are kept in the `UserDir` of each user. That way users sharing an
+// archive on a shared file system never overwrite each other's state.
+func (s *LocalFiles) Shared() bool {
+	_, err := os.Stat(s.ConfigFile(sharedConfig))
+	return err == nil
+}
+
+// SetShared marks the archive as shared by the group that owns it.
+//
+// The `UserDir` must be set, and the current user's state is moved into
+// it. Every existing file and directory of the archive is made
+// accessible to the group, so this must be run by the user who owns
+// them. Users of the archive should also be members of its group.
+//
+// The `commandConfigs` are only made readable by the group, so they
+// can only be changed by the user who shared the archive.
+func (s *LocalFiles) SetShared(ctx context.Context) error {
+	if len(s.UserDir) == 0 {
+		return fmt.Errorf("no user directory for the shared archive %q", s.ArchiveDir)
+	}
+	if err := s.moveUserState(ctx); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(s.ArchiveDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(sharedFileMode)
+		if d.IsDir() {
+			mode = sharedDirMode
+		} else if !d.Type().IsRegular() {
+			return nil
+		} else if s.isCommandConfig(p) {
+			mode = sharedCommandFileMode
+		}
+		return os.Chmod(p, mode)
+	})
+	if err != nil {
+		return fmt.Errorf("failure making the archive %q accessible to its group: %w", s.ArchiveDir, err)
+	}
+	if err := s.WriteConfigFile(ctx, sharedConfig, []byte("This archive is shared by the users in its group\n")); err != nil {
+		return err
+	}
+	// The marker was written before the archive was shared, so it was not yet made accessible to the group.
+	return os.Chmod(s.ConfigFile(sharedConfig), sharedFileMode)
+}
+
+// moveUserState moves the state of the current user out of the archive and into the `UserDir`.
+func (s *LocalFiles) moveUserState(ctx context.Context) error {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	var moves [][2]string
+	for name := range userConfigs {
+		moves = append(moves, [2]string{filepath.Join(s.ArchiveDir, "config", name), s.ConfigFile(name)})
+	}
+	moves = append(moves, [2]string{filepath.Join(s.ArchiveDir, "cacheIndex"), s.cacheIndexFile()})
+	for _, move := range moves {
+		contents, err := os.ReadFile(move[0])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failure reading %q: %w", move[0], err)
+		}
+		if err := s.mkdirAll(filepath.Dir(move[1])); err != nil {
+			return fmt.Errorf("failure creating the directory of %q: %w", move[1], err)
+		}
+		if err := s.writeFileAtomically(ctx, move[1], contents, 0600); err != nil {
+			return err
+		}
+		if err := os.Remove(move[0]); err != nil {
+			return fmt.Errorf("failure removing %q: %w", move[0], err)
+		}
+	}
+	// The object cache only holds copies, so it is simply dropped.
+	if err := os.RemoveAll(filepath.Join(s.ArchiveDir, "objectcache")); err != nil {
+		return fmt.Errorf("failure removing the object cache: %w", err)
+	}
+	s.cacheIndex, s.identityIndex = nil, nil
+	return nil
+}
+
+// userStateDir returns the directory holding the state of the current user of the archive.
+func (s *LocalFiles) userStateDir() string {
+	if len(s.UserDir) > 0 {
+		return s.UserDir
+	}
+	return s.ArchiveDir
+}
+
+// inUserDir reports whether or not the file `p` is in the `UserDir`, rather than the archive.
+func (s *LocalFiles) inUserDir(p string) bool {
+	return len(s.UserDir) > 0 && strings.HasPrefix(p, s.UserDir+string(filepath.Separator))
+}
+
+// mkdirAll creates the directory `dir`, along with any missing parents.
+//
+// In a shared archive, directories outside of the `UserDir` are made
+// accessible to the group regardless of the umask.
+func (s *LocalFiles) mkdirAll(dir string) error {
+	if s.inUserDir(dir) || !s.Shared() {
+		return os.MkdirAll(dir, 0700)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, sharedDirMode); os.IsExist(err) {
+		// Another user created it first.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return os.Chmod(dir, sharedDirMode)
+}
+
+// fileMode returns the mode for the file `p`, which is `perm` unless it is in a shared part of a shared archive.
+func (s *LocalFiles) fileMode(p string, perm os.FileMode) os.FileMode {
+	if s.inUserDir(p) || !s.Shared() {
+		return perm
+	}
+	if s.isCommandConfig(p) {
+		return sharedCommandFileMode
+	}
+	return sharedFileMode
+}
+
+// isCommandConfig reports whether or not the file `p` is one of the `commandConfigs` of the archive.
+func (s *LocalFiles) isCommandConfig(p string) bool {
+	return commandConfigs[filepath.Base(p)] && filepath.Dir(p) == filepath.Join(s.ArchiveDir, "config")
+}
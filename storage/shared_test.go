@@ -0,0 +1,145 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestShared(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.txt")
+	if err := os.WriteFile(file, []byte("example"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	// Files modified too recently are not cached, since they may still be changing.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, past, past); err != nil {
+		t.Fatalf("failure setting the modification time of the example file: %v", err)
+	}
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	if _, _, err := snapshot.Current(ctx, s, snapshot.Path(file)); err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("failure writing the path info cache: %v", err)
+	}
+	if err := s.WriteConfigFile(ctx, "reflog", []byte("example reflog\n")); err != nil {
+		t.Fatalf("failure writing a user config file: %v", err)
+	}
+	if s.Shared() {
+		t.Fatal("unexpected shared archive before it was marked as shared")
+	}
+
+	if err := s.SetShared(ctx); err == nil {
+		t.Error("unexpected success sharing an archive without a user directory")
+	}
+	s.UserDir = filepath.Join(dir, "user")
+	if err := s.SetShared(ctx); err != nil {
+		t.Fatalf("failure marking the archive as shared: %v", err)
+	}
+	if !s.Shared() {
+		t.Fatal("archive was not marked as shared")
+	}
+	if got, err := os.ReadFile(s.ConfigFile("reflog")); err != nil || string(got) != "example reflog\n" {
+		t.Errorf("unexpected user config file after sharing: %q, %v", got, err)
+	} else if !strings.HasPrefix(s.ConfigFile("reflog"), s.UserDir) {
+		t.Errorf("user config file %q is not in the user directory", s.ConfigFile("reflog"))
+	}
+	for _, moved := range []string{filepath.Join(s.ArchiveDir, "config", "reflog"), filepath.Join(s.ArchiveDir, "cacheIndex")} {
+		if _, err := os.Stat(moved); !os.IsNotExist(err) {
+			t.Errorf("user state %q was left in the shared archive: %v", moved, err)
+		}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("failure reading the example file info: %v", err)
+	}
+	if !s.PathInfoMatchesCache(ctx, snapshot.Path(file), info) {
+		t.Error("the path info cache was not moved to the user directory")
+	}
+
+	// New objects and their directories are accessible to the group.
+	h, err := s.StoreObject(ctx, strings.NewReader("shared contents"))
+	if err != nil {
+		t.Fatalf("failure storing an object in the shared archive: %v", err)
+	}
+	objPath, objName := objectName(h, filepath.Join(s.ArchiveDir, "objects"))
+	for p, want := range map[string]os.FileMode{objPath: sharedDirMode | os.ModeDir, filepath.Join(objPath, objName): sharedFileMode} {
+		if info, err := os.Stat(p); err != nil {
+			t.Errorf("failure reading the info of %q: %v", p, err)
+		} else if got := info.Mode(); got != want {
+			t.Errorf("unexpected mode of %q: got %v, want %v", p, got, want)
+		}
+	}
+	if info, err := os.Stat(s.cacheIndexFile()); err != nil {
+		t.Errorf("failure reading the info of the cache index: %v", err)
+	} else if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("unexpected mode of the cache index: got %v, want %v", got, os.FileMode(0600))
+	}
+}
+
+func TestSharedCommandConfigs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &LocalFiles{ArchiveDir: filepath.Join(dir, "archive"), UserDir: filepath.Join(dir, "user")}
+	if err := s.WriteConfigFile(ctx, "filters", []byte("example\t*.txt\tcat\tcat\n")); err != nil {
+		t.Fatalf("failure writing the filters config: %v", err)
+	}
+	if err := s.SetShared(ctx); err != nil {
+		t.Fatalf("failure marking the archive as shared: %v", err)
+	}
+	if err := s.WriteConfigFile(ctx, "scanners", []byte("example\t*\ttrue\n")); err != nil {
+		t.Fatalf("failure writing the scanners config: %v", err)
+	}
+	for _, name := range []string{"filters", "scanners"} {
+		configFile := s.ConfigFile(name)
+		if info, err := os.Stat(configFile); err != nil {
+			t.Errorf("failure reading the info of %q: %v", configFile, err)
+		} else if got, want := info.Mode().Perm(), os.FileMode(sharedCommandFileMode); got != want {
+			t.Errorf("unexpected mode of %q: got %v, want %v", configFile, got, want)
+		}
+		if _, err := s.ReadCommandConfig(name); err != nil {
+			t.Errorf("failure reading the command config %q: %v", name, err)
+		}
+	}
+
+	// A config that other users could have modified is never read.
+	if err := os.Chmod(s.ConfigFile("filters"), sharedFileMode); err != nil {
+		t.Fatalf("failure making the filters config writable by the group: %v", err)
+	}
+	if _, err := s.ReadCommandConfig("filters"); err == nil {
+		t.Error("unexpected success reading a group writable command config")
+	}
+	if os.Getuid() == 0 {
+		if err := os.Chown(s.ConfigFile("scanners"), 12345, -1); err != nil {
+			t.Fatalf("failure changing the owner of the scanners config: %v", err)
+		}
+		if _, err := s.ReadCommandConfig("scanners"); err == nil {
+			t.Error("unexpected success reading a command config owned by another user")
+		}
+	}
+	if _, err := s.ReadCommandConfig("remotes"); !os.IsNotExist(err) {
+		t.Errorf("unexpected error reading a missing command config: %v", err)
+	}
+}
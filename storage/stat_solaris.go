@@ -0,0 +1,26 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build solaris
+
+package storage
+
+import "syscall"
+
+// changeInfo returns the change time and inode generation number of a file.
+//
+// Solaris and illumos do not expose the inode generation number via stat, so it is always reported as zero.
+func changeInfo(unixInfo *syscall.Stat_t) (ctime int64, gen uint64) {
+	return unixInfo.Ctim.Nano(), 0
+}
@@ -20,11 +20,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/recursive-version-control-system/snapshot"
 )
@@ -34,28 +35,171 @@ import (
 // It is used to write and read snapshots to persistent storage.
 type LocalFiles struct {
 	ArchiveDir string
+
+	// BaseArchiveDirs lists additional, read-only archives whose objects are shared.
+	//
+	// Objects are read from these if they are not in `ArchiveDir`, and
+	// objects that are already present in one of them are not copied
+	// into `ArchiveDir` when stored. Everything other than objects,
+	// such as the mapping from paths to snapshots, is only ever read
+	// from and written to `ArchiveDir`.
+	BaseArchiveDirs []string
+
+	// UserDir, if not empty, holds the state of the archive that belongs
+	// to the current user rather than to the archive itself.
+	//
+	// This is used for shared archives, so that each user has their own
+	// path info cache, read-through object cache, and user config files
+	// such as the reflog. If empty, that state is kept in `ArchiveDir`.
+	UserDir string
+
+	// ObjectCacheSize is the maximum total size, in bytes, of the
+	// read-through cache of objects read from the base archives.
+	//
+	// This avoids repeatedly reading the same objects from base
+	// archives on slow network mounts. A value of zero or less
+	// disables the cache.
+	ObjectCacheSize int64
+
+	// CacheValidation controls how strictly the path info cache is validated.
+	CacheValidation CacheValidation
+
+	// CacheMemory is the approximate amount of memory, in bytes, that
+	// updates to the path info cache may use before they are written
+	// to disk.
+	//
+	// Each write re-reads and rewrites the whole cache index, so larger
+	// values make snapshotting big trees faster. A value of zero or
+	// less writes the updates after every 1024 changed paths.
+	CacheMemory int64
+
+	// storedBytes is the total size of the objects newly written to the archive.
+	storedBytes int64
+
+	// storedObjects is the number of objects newly written to the archive.
+	storedObjects int64
+
+	// objectCacheMu guards the in-memory index of the read-through object cache.
+	objectCacheMu sync.Mutex
+
+	// objectCache is the in-memory index of the read-through object cache.
+	//
+	// This is nil until the index has been loaded from disk.
+	objectCache *objectCache
+
+	// cacheMu guards the in-memory copy of the path info cache index.
+	cacheMu sync.Mutex
+
+	// cacheIndex is the in-memory copy of the path info cache index.
+	//
+	// This is nil until the index has been loaded from disk.
+	cacheIndex map[snapshot.Path]*cachedInfo
+
+	// cachePending holds cache entries that have not yet been written to disk.
+	cachePending map[snapshot.Path]*cachedInfo
+
+	// cachePendingSize is the estimated memory used by `cachePending`.
+	cachePendingSize int64
+
+	// identityIndex maps the identities of the files in the path info
+	// cache to their cached snapshots, regardless of their paths.
+	//
+	// This is nil until it has been built from `cacheIndex`.
+	identityIndex map[fileIdentity]*snapshot.Hash
 }
 
 // Exclude reports whether or not the given path should be excluded from snapshotting.
 //
 // This should return true for any paths that are part of the underlying persistent storage.
 func (s *LocalFiles) Exclude(p snapshot.Path) bool {
-	return p == snapshot.Path(s.ArchiveDir)
+	if p == snapshot.Path(s.ArchiveDir) || (len(s.UserDir) > 0 && p == snapshot.Path(s.UserDir)) {
+		return true
+	}
+	for _, baseDir := range s.BaseArchiveDirs {
+		if p == snapshot.Path(baseDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigFile returns the location of the named configuration file for the archive.
+//
+// The config files that belong to the current user, such as the reflog, are kept in the `UserDir` if it is set.
+func (s *LocalFiles) ConfigFile(name string) string {
+	if userConfigs[name] {
+		return filepath.Join(s.userStateDir(), "config", name)
+	}
+	return filepath.Join(s.ArchiveDir, "config", name)
 }
 
 func (s *LocalFiles) tmpFile(ctx context.Context) (*os.File, error) {
-	tmpDir := filepath.Join(s.ArchiveDir, "tmp")
-	if err := os.MkdirAll(tmpDir, os.FileMode(0700)); err != nil {
-		return nil, fmt.Errorf("failure creating the tmp dir: %v", err)
+	return s.tmpFileIn(ctx, s.ArchiveDir)
+}
+
+// tmpFileIn creates a temporary file within `root`, which is either the archive or the `UserDir`.
+//
+// Temporary files are renamed into place, so they must be created on the same file system as their destination.
+func (s *LocalFiles) tmpFileIn(ctx context.Context, root string) (*os.File, error) {
+	tmpDir := filepath.Join(root, "tmp")
+	if err := s.mkdirAll(tmpDir); err != nil {
+		return nil, fmt.Errorf("failure creating the tmp dir: %w", err)
 	}
 	return os.CreateTemp(tmpDir, "archiver")
 }
 
+// HashMismatchError reports that the contents of an object did not match its expected hash.
+type HashMismatchError struct {
+	// Want is the expected hash of the object.
+	Want *snapshot.Hash
+
+	// Got is the actual hash of the object's contents.
+	Got *snapshot.Hash
+
+	// Quarantined is the location where the mismatched contents were saved for inspection.
+	Quarantined string
+}
+
+// Error implements the `error` interface.
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("object contents hashed to %q instead of the expected %q; quarantined in %q", e.Got, e.Want, e.Quarantined)
+}
+
 func (s *LocalFiles) StoreObject(ctx context.Context, reader io.Reader) (h *snapshot.Hash, err error) {
+	return s.storeObject(ctx, reader, nil)
+}
+
+// StoreVerifiedObject persists the contents of the given reader, which must have the hash `want`.
+//
+// If the contents do not match the expected hash, then they are moved
+// to the quarantine directory of the archive instead of being stored,
+// and a `*HashMismatchError` is returned.
+func (s *LocalFiles) StoreVerifiedObject(ctx context.Context, reader io.Reader, want *snapshot.Hash) error {
+	_, err := s.storeObject(ctx, reader, want)
+	return err
+}
+
+func (s *LocalFiles) quarantine(tmpFile string, want, got *snapshot.Hash) error {
+	quarantineDir := filepath.Join(s.ArchiveDir, "quarantine")
+	if err := s.mkdirAll(quarantineDir); err != nil {
+		return fmt.Errorf("failure creating the quarantine dir: %w", err)
+	}
+	quarantined := filepath.Join(quarantineDir, want.Function()+"-"+want.HexContents()+"-"+filepath.Base(tmpFile))
+	if err := os.Rename(tmpFile, quarantined); err != nil {
+		return fmt.Errorf("failure quarantining the contents of %q: %w", want, err)
+	}
+	return &HashMismatchError{
+		Want:        want,
+		Got:         got,
+		Quarantined: quarantined,
+	}
+}
+
+func (s *LocalFiles) storeObject(ctx context.Context, reader io.Reader, want *snapshot.Hash) (h *snapshot.Hash, err error) {
 	var tmp *os.File
 	tmp, err = s.tmpFile(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failure creating a temp file: %v", err)
+		return nil, fmt.Errorf("failure creating a temp file: %w", err)
 	}
 	defer func() {
 		tmp.Close()
@@ -66,18 +210,59 @@ func (s *LocalFiles) StoreObject(ctx context.Context, reader io.Reader) (h *snap
 	reader = io.TeeReader(reader, tmp)
 	h, err = snapshot.NewHash(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failure hashing an object: %v", err)
+		return nil, fmt.Errorf("failure hashing an object: %w", err)
+	}
+	if want != nil && !want.Equal(h) {
+		tmp.Close()
+		return nil, s.quarantine(tmp.Name(), want, h)
+	}
+	if s.inBaseArchive(h) {
+		// The object is already shared via a base archive, so we do not need our own copy.
+		os.Remove(tmp.Name())
+		return h, nil
 	}
 	objPath, objName := objectName(h, filepath.Join(s.ArchiveDir, "objects"))
-	if err := os.MkdirAll(objPath, os.FileMode(0700)); err != nil {
-		return nil, fmt.Errorf("failure creating the object dir for %q: %v", h, err)
+	if err := s.mkdirAll(objPath); err != nil {
+		return nil, fmt.Errorf("failure creating the object dir for %q: %w", h, err)
+	}
+	if s.Shared() {
+		if err := tmp.Chmod(sharedFileMode); err != nil {
+			return nil, fmt.Errorf("failure setting the permissions of the object %q: %w", h, err)
+		}
+	}
+	_, existsErr := os.Stat(filepath.Join(objPath, objName))
+	info, err := tmp.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the size of the object %q: %w", h, err)
 	}
-	if err := os.Rename(tmp.Name(), filepath.Join(objPath, objName)); err != nil {
-		return nil, fmt.Errorf("failure writing the object file for %q: %v", h, err)
+	if err := commitTmpFile(tmp, filepath.Join(objPath, objName)); err != nil {
+		return nil, fmt.Errorf("failure writing the object file for %q: %w", h, err)
+	}
+	if os.IsNotExist(existsErr) {
+		atomic.AddInt64(&s.storedBytes, info.Size())
+		atomic.AddInt64(&s.storedObjects, 1)
+		if err := s.removeStub(h); err != nil {
+			return nil, err
+		}
 	}
 	return h, nil
 }
 
+// StoredBytes returns the total size in bytes of the objects that were newly written to the archive.
+//
+// Objects that were already present in the archive or one of its base
+// archives are not counted.
+func (s *LocalFiles) StoredBytes() int64 {
+	return atomic.LoadInt64(&s.storedBytes)
+}
+
+// StoredObjects returns the number of objects that were newly written to the archive.
+//
+// As with `StoredBytes`, objects that were already present are not counted.
+func (s *LocalFiles) StoredObjects() int64 {
+	return atomic.LoadInt64(&s.storedObjects)
+}
+
 func objectName(h *snapshot.Hash, parentDir string) (dir string, name string) {
 	functionDir := filepath.Join(parentDir, h.Function())
 	if len(h.HexContents()) > 4 {
@@ -88,9 +273,98 @@ func objectName(h *snapshot.Hash, parentDir string) (dir string, name string) {
 	return functionDir, h.HexContents()
 }
 
+func objectFile(h *snapshot.Hash, archiveDir string) string {
+	objPath, objName := objectName(h, filepath.Join(archiveDir, "objects"))
+	return filepath.Join(objPath, objName)
+}
+
+// inBaseArchive reports whether or not the given object is present in one of the base archives.
+func (s *LocalFiles) inBaseArchive(h *snapshot.Hash) bool {
+	for _, baseDir := range s.BaseArchiveDirs {
+		if _, err := os.Stat(objectFile(h, baseDir)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// objectLocation identifies where an object file was found.
+type objectLocation int
+
+const (
+	inArchive objectLocation = iota
+	inObjectCache
+	inBaseArchive
+)
+
+// findObjectFile returns the location of the file holding the given object.
+//
+// The archive is checked first, followed by the read-through object
+// cache, and then each of the base archives in order. If the object is
+// in none of those because it was offloaded, then a `*TieredError` is
+// returned.
+func (s *LocalFiles) findObjectFile(h *snapshot.Hash) (string, objectLocation, error) {
+	objFile := objectFile(h, s.ArchiveDir)
+	_, err := os.Stat(objFile)
+	if err == nil || !os.IsNotExist(err) {
+		return objFile, inArchive, err
+	}
+	if cachedFile, ok := s.cachedObjectFile(h); ok {
+		return cachedFile, inObjectCache, nil
+	}
+	for _, baseDir := range s.BaseArchiveDirs {
+		baseFile := objectFile(h, baseDir)
+		if _, baseErr := os.Stat(baseFile); baseErr == nil {
+			return baseFile, inBaseArchive, nil
+		}
+	}
+	if os.IsNotExist(err) {
+		if stub, stubErr := s.FindStub(context.Background(), h); stubErr == nil {
+			return objFile, inArchive, &TieredError{Hash: h, Remote: stub.Remote}
+		}
+	}
+	return objFile, inArchive, err
+}
+
 func (s *LocalFiles) ReadObject(ctx context.Context, h *snapshot.Hash) (io.ReadCloser, error) {
-	objPath, objName := objectName(h, filepath.Join(s.ArchiveDir, "objects"))
-	return os.Open(filepath.Join(objPath, objName))
+	objFile, location, err := s.findObjectFile(h)
+	if err != nil {
+		return nil, err
+	}
+	switch location {
+	case inObjectCache:
+		s.touchCachedObject(objFile)
+	case inBaseArchive:
+		if s.ObjectCacheSize > 0 {
+			if cachedFile, err := s.cacheObject(ctx, h, objFile); err == nil {
+				objFile = cachedFile
+			}
+		}
+	}
+	return os.Open(objFile)
+}
+
+// HasObject reports whether or not the object with the given hash is available.
+func (s *LocalFiles) HasObject(ctx context.Context, h *snapshot.Hash) bool {
+	objFile, _, err := s.findObjectFile(h)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(objFile)
+	return err == nil
+}
+
+// ObjectSize returns the size in bytes of the object with the given hash.
+func (s *LocalFiles) ObjectSize(ctx context.Context, h *snapshot.Hash) (int64, error) {
+	objFile, _, err := s.findObjectFile(h)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(objFile)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
 }
 
 func (s *LocalFiles) mappedPathsDir(p snapshot.Path) string {
@@ -100,36 +374,39 @@ func (s *LocalFiles) mappedPathsDir(p snapshot.Path) string {
 func (s *LocalFiles) pathHashFile(p snapshot.Path) (dir string, name string, err error) {
 	pathHash, err := snapshot.NewHash(strings.NewReader(string(p)))
 	if err != nil {
-		return "", "", fmt.Errorf("failure hashing the path name %q: %v", p, err)
+		return "", "", fmt.Errorf("failure hashing the path name %q: %w", p, err)
 	}
 	dir, name = objectName(pathHash, filepath.Join(s.ArchiveDir, "paths"))
 	return dir, name, nil
 }
 
 func (s *LocalFiles) StoreSnapshot(ctx context.Context, p snapshot.Path, f *snapshot.File) (*snapshot.Hash, error) {
-	if err := os.MkdirAll(s.mappedPathsDir(p), 0700); err != nil {
-		return nil, fmt.Errorf("failure creating the mapped paths dir entry for %q: %v", p, err)
+	if err := s.mkdirAll(s.mappedPathsDir(p)); err != nil {
+		return nil, fmt.Errorf("failure creating the mapped paths dir entry for %q: %w", p, err)
 	}
 	bs := []byte(f.String())
 	h, err := s.StoreObject(ctx, bytes.NewReader(bs))
 	if err != nil {
-		return nil, fmt.Errorf("failure saving file metadata for %+v: %v", f, err)
+		return nil, fmt.Errorf("failure saving file metadata for %+v: %w", f, err)
+	}
+	if err := s.checkFastForward(ctx, p, h, f); err != nil {
+		return nil, err
 	}
 	pathHashDir, pathHashFile, err := s.pathHashFile(p)
 	if err != nil {
-		return nil, fmt.Errorf("failure calculating the path hash file location for %q: %v", p, err)
+		return nil, fmt.Errorf("failure calculating the path hash file location for %q: %w", p, err)
 	}
-	if err := os.MkdirAll(pathHashDir, 0700); err != nil {
-		return nil, fmt.Errorf("failure creating the paths dir for %q: %v", p, err)
+	if err := s.mkdirAll(pathHashDir); err != nil {
+		return nil, fmt.Errorf("failure creating the paths dir for %q: %w", p, err)
 	}
-	if err := os.WriteFile(filepath.Join(pathHashDir, pathHashFile), []byte(h.String()), 0600); err != nil {
-		return nil, fmt.Errorf("failure writing the hash for path %q: %v", p, err)
+	if err := s.writeFileAtomically(ctx, filepath.Join(pathHashDir, pathHashFile), []byte(h.String()), 0600); err != nil {
+		return nil, fmt.Errorf("failure writing the hash for path %q: %w", p, err)
 	}
 	var currTree snapshot.Tree
 	if f.IsDir() {
 		currTree, err = s.ListDirectorySnapshotContents(ctx, h, f)
 		if err != nil {
-			return nil, fmt.Errorf("failure listing the contents of the new snapshot: %v", err)
+			return nil, fmt.Errorf("failure listing the contents of the new snapshot: %w", err)
 		}
 	}
 	mappedSubPaths, err := os.ReadDir(s.mappedPathsDir(p))
@@ -144,7 +421,7 @@ func (s *LocalFiles) StoreSnapshot(ctx context.Context, p snapshot.Path, f *snap
 			// The previous child entry was removed.
 			subpath := p.Join(child)
 			if err := s.RemoveMappingForPath(ctx, subpath); err != nil {
-				return nil, fmt.Errorf("failure removing path mapping for removed child %q: %v", child, err)
+				return nil, fmt.Errorf("failure removing path mapping for removed child %q: %w", child, err)
 			}
 		}
 	}
@@ -154,41 +431,83 @@ func (s *LocalFiles) StoreSnapshot(ctx context.Context, p snapshot.Path, f *snap
 func (s *LocalFiles) ReadSnapshot(ctx context.Context, h *snapshot.Hash) (*snapshot.File, error) {
 	reader, err := s.ReadObject(ctx, h)
 	if err != nil {
-		return nil, fmt.Errorf("failure looking up the file snapshot for %q: %v", h, err)
+		return nil, fmt.Errorf("failure looking up the file snapshot for %q: %w", h, err)
 	}
 	defer reader.Close()
 	contents, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failure reading file metadata from the reader: %v", err)
+		return nil, fmt.Errorf("failure reading file metadata from the reader: %w", err)
 	}
 	f, err := snapshot.ParseFile(string(contents))
 	if err != nil {
-		return nil, fmt.Errorf("failure parsing the file snapshot for %q: %v", h, err)
+		return nil, fmt.Errorf("failure parsing the file snapshot for %q: %w: %v", h, ErrCorrupt, err)
 	}
 	return f, nil
 }
 
-func (s *LocalFiles) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, *snapshot.File, error) {
+// findSnapshotHash reads the hash of the latest snapshot for the given path.
+func (s *LocalFiles) findSnapshotHash(p snapshot.Path) (*snapshot.Hash, error) {
 	pathHashDir, pathHashFile, err := s.pathHashFile(p)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure calculating the path hash file location for %q: %v", p, err)
+		return nil, fmt.Errorf("failure calculating the path hash file location for %q: %w", p, err)
 	}
 	bs, err := os.ReadFile(filepath.Join(pathHashDir, pathHashFile))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	fileHashStr := string(bs)
 	h, err := snapshot.ParseHash(fileHashStr)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure parsing the hash %q: %v", fileHashStr, err)
+		return nil, fmt.Errorf("failure parsing the hash %q: %w: %v", fileHashStr, ErrCorrupt, err)
+	}
+	return h, nil
+}
+
+func (s *LocalFiles) FindSnapshot(ctx context.Context, p snapshot.Path) (*snapshot.Hash, *snapshot.File, error) {
+	h, err := s.findSnapshotHash(p)
+	if err != nil {
+		return nil, nil, err
 	}
 	f, err := s.ReadSnapshot(ctx, h)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failure reading the file snapshot for %q: %v", h, err)
+		return nil, nil, fmt.Errorf("failure reading the file snapshot for %q: %w", h, err)
 	}
 	return h, f, nil
 }
 
+// TrackedPaths returns the top-level paths that have been snapshotted.
+//
+// These are the paths that have a latest snapshot recorded, but whose
+// parent directories do not. The returned paths are sorted.
+func (s *LocalFiles) TrackedPaths(ctx context.Context) ([]snapshot.Path, error) {
+	root := filepath.Join(s.ArchiveDir, "mappedPaths")
+	var tracked []snapshot.Path
+	err := filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && dir == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if !d.IsDir() || dir == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		p := snapshot.Path(string(filepath.Separator) + rel)
+		if _, err := s.findSnapshotHash(p); err == nil {
+			tracked = append(tracked, p)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the tracked paths: %w", err)
+	}
+	return tracked, nil
+}
+
 // ListDirectorySnapshotContents returns the parsed `*snapshot.Tree` object listing the contents of `f`.
 //
 // The supplied `*snapshot.File` object must correspond to a directory.
@@ -198,22 +517,37 @@ func (s *LocalFiles) ListDirectorySnapshotContents(ctx context.Context, h *snaps
 	}
 	contentsReader, err := s.ReadObject(ctx, f.Contents)
 	if err != nil {
-		return nil, fmt.Errorf("failure opening the contents of %q: %v", h, err)
+		return nil, fmt.Errorf("failure opening the contents of %q: %w", h, err)
 	}
 	contents, err := io.ReadAll(contentsReader)
 	if err != nil {
-		return nil, fmt.Errorf("failure reading the contents of %q: %v", h, err)
+		return nil, fmt.Errorf("failure reading the contents of %q: %w", h, err)
 	}
 	tree, err := snapshot.ParseTree(string(contents))
 	if err != nil {
-		return nil, fmt.Errorf("failure parsing the directory contents of the snapshot %q: %v", h, err)
+		return nil, fmt.Errorf("failure parsing the directory contents of the snapshot %q: %w: %v", h, ErrCorrupt, err)
+	}
+	for child := range tree {
+		// Names like ".." would make restoring the snapshot write outside of the directory.
+		if !snapshot.ValidChildName(child) {
+			return nil, fmt.Errorf("failure parsing the directory contents of the snapshot %q: %w: invalid entry name %q", h, ErrCorrupt, child)
+		}
 	}
 	return tree, nil
 }
 
+// RemoveMappingForPath removes the latest snapshot recorded for `p`, and for every path within it.
+//
+// The mappings for the paths within `p` are removed before that of `p`
+// itself, so an interrupted removal can be repeated to finish it.
 func (s *LocalFiles) RemoveMappingForPath(ctx context.Context, p snapshot.Path) error {
+	if s.AppendOnly() {
+		if prev, err := s.findSnapshotHash(p); err == nil {
+			return &NotFastForwardError{Path: p, Prev: prev}
+		}
+	}
 	if err := os.RemoveAll(s.mappedPathsDir(p)); err != nil {
-		return fmt.Errorf("failure removing the mapped paths entry for %q: %v", p, err)
+		return fmt.Errorf("failure removing the mapped paths entry for %q: %w", p, err)
 	}
 	h, f, err := s.FindSnapshot(ctx, p)
 	if os.IsNotExist(err) {
@@ -221,103 +555,25 @@ func (s *LocalFiles) RemoveMappingForPath(ctx context.Context, p snapshot.Path)
 		// so we have nothing to do.
 		return nil
 	}
+	if f.IsDir() {
+		tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
+		if err != nil {
+			return fmt.Errorf("failure listing the contents of %q: %w", h, err)
+		}
+		for child, _ := range tree {
+			childPath := p.Join(child)
+			if err := s.RemoveMappingForPath(ctx, childPath); err != nil {
+				return fmt.Errorf("failure removing mapping for the child path %q: %w", child, err)
+			}
+		}
+	}
 	pathHashDir, pathHashFile, err := s.pathHashFile(p)
 	if err != nil {
-		return fmt.Errorf("failure calculating the path hash file location for %q: %v", p, err)
+		return fmt.Errorf("failure calculating the path hash file location for %q: %w", p, err)
 	}
 	mappingPath := filepath.Join(pathHashDir, pathHashFile)
 	if err := os.Remove(mappingPath); err != nil {
-		return fmt.Errorf("failure removing the mapping from %q to %q: %v", p, h, err)
-	}
-	if !f.IsDir() {
-		return nil
-	}
-	tree, err := s.ListDirectorySnapshotContents(ctx, h, f)
-	if err != nil {
-		return fmt.Errorf("failure listing the contents of %q: %v", h, err)
-	}
-	for child, _ := range tree {
-		childPath := p.Join(child)
-		if err := s.RemoveMappingForPath(ctx, childPath); err != nil {
-			return fmt.Errorf("failure removing mapping for the child path %q: %v", child, err)
-		}
+		return fmt.Errorf("failure removing the mapping from %q to %q: %w", p, h, err)
 	}
 	return nil
 }
-
-type cachedInfo struct {
-	Size    int64
-	Mode    os.FileMode
-	ModTime time.Time
-	Ino     uint64
-}
-
-func (s *LocalFiles) pathCacheFile(p snapshot.Path) (dir string, name string, err error) {
-	pathHash, err := snapshot.NewHash(strings.NewReader(string(p)))
-	if err != nil {
-		return "", "", fmt.Errorf("failure hashing the path name %q: %v", p, err)
-	}
-	dir, name = objectName(pathHash, filepath.Join(s.ArchiveDir, "cache"))
-	return dir, name, nil
-}
-
-func (s *LocalFiles) CachePathInfo(ctx context.Context, p snapshot.Path, info os.FileInfo) error {
-	sysInfo := info.Sys()
-	if sysInfo == nil {
-		return nil
-	}
-	unix_info, ok := sysInfo.(*syscall.Stat_t)
-	if !ok || unix_info == nil {
-		return nil
-	}
-	ino := unix_info.Ino
-
-	cacheDir, cacheFile, err := s.pathCacheFile(p)
-	if err != nil {
-		return fmt.Errorf("failure constructing the cache dir path for %q: %v", p, err)
-	}
-	cachePath := filepath.Join(cacheDir, cacheFile)
-	if err := os.MkdirAll(cacheDir, 0700); err != nil {
-		return fmt.Errorf("failure creating the cache dir for %q: %v", p, err)
-	}
-	if err := os.Remove(cachePath); !os.IsNotExist(err) {
-		return fmt.Errorf("failure removing the old cache entry for %q: %v", p, err)
-	}
-
-	newInfo := fmt.Sprintf("%+v", &cachedInfo{
-		Size:    info.Size(),
-		Mode:    info.Mode(),
-		ModTime: info.ModTime(),
-		Ino:     ino,
-	})
-	return os.WriteFile(cachePath, []byte(newInfo), 0700)
-}
-
-func (s *LocalFiles) PathInfoMatchesCache(ctx context.Context, p snapshot.Path, info os.FileInfo) bool {
-	sysInfo := info.Sys()
-	if sysInfo == nil {
-		return false
-	}
-	unix_info, ok := sysInfo.(*syscall.Stat_t)
-	if !ok || unix_info == nil {
-		return false
-	}
-	ino := unix_info.Ino
-	cacheDir, cacheFile, err := s.pathCacheFile(p)
-	if err != nil {
-		return false
-	}
-	bs, err := os.ReadFile(filepath.Join(cacheDir, cacheFile))
-	if err != nil {
-		return false
-	}
-	cachedInfoStr := string(bs)
-
-	newInfo := fmt.Sprintf("%+v", &cachedInfo{
-		Size:    info.Size(),
-		Mode:    info.Mode(),
-		ModTime: info.ModTime(),
-		Ino:     ino,
-	})
-	return cachedInfoStr == newInfo
-}
@@ -0,0 +1,111 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+func TestBaseArchiveDirs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	base := &LocalFiles{ArchiveDir: filepath.Join(dir, "base")}
+	shared, err := base.StoreObject(ctx, strings.NewReader("shared contents"))
+	if err != nil {
+		t.Fatalf("failure storing an object in the base archive: %v", err)
+	}
+
+	s := &LocalFiles{
+		ArchiveDir:      filepath.Join(dir, "overlay"),
+		BaseArchiveDirs: []string{base.ArchiveDir},
+	}
+	if h, err := s.StoreObject(ctx, strings.NewReader("shared contents")); err != nil {
+		t.Fatalf("failure storing a shared object: %v", err)
+	} else if !h.Equal(shared) {
+		t.Errorf("unexpected hash for the shared object: got %q, want %q", h, shared)
+	}
+	if _, err := os.Stat(objectFile(shared, s.ArchiveDir)); !os.IsNotExist(err) {
+		t.Errorf("shared object was unexpectedly copied into the overlay archive: %v", err)
+	}
+	private, err := s.StoreObject(ctx, strings.NewReader("private contents"))
+	if err != nil {
+		t.Fatalf("failure storing a private object: %v", err)
+	}
+	if _, err := os.Stat(objectFile(private, base.ArchiveDir)); !os.IsNotExist(err) {
+		t.Errorf("private object was unexpectedly written to the base archive: %v", err)
+	}
+
+	reader, err := s.ReadObject(ctx, shared)
+	if err != nil {
+		t.Fatalf("failure reading the shared object: %v", err)
+	}
+	defer reader.Close()
+	if contents, err := io.ReadAll(reader); err != nil {
+		t.Errorf("failure reading the shared object contents: %v", err)
+	} else if got, want := string(contents), "shared contents"; got != want {
+		t.Errorf("unexpected shared object contents: got %q, want %q", got, want)
+	}
+	if !s.Exclude(snapshot.Path(base.ArchiveDir)) {
+		t.Error("base archive was not excluded from snapshots")
+	}
+}
+
+func TestStoredBytes(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: t.TempDir()}
+	for _, contents := range []string{"first", "second", "first"} {
+		if _, err := s.StoreObject(ctx, strings.NewReader(contents)); err != nil {
+			t.Fatalf("failure storing the object %q: %v", contents, err)
+		}
+	}
+	// The repeated object is already present, so it is only counted once.
+	if got, want := s.StoredBytes(), int64(len("first")+len("second")); got != want {
+		t.Errorf("unexpected stored bytes: got %d, want %d", got, want)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: t.TempDir()}
+	missing, err := snapshot.NewHash(strings.NewReader("missing contents"))
+	if err != nil {
+		t.Fatalf("failure hashing the missing contents: %v", err)
+	}
+	if _, err := s.ReadSnapshot(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected error reading a missing snapshot: got %v, want %v", err, ErrNotFound)
+	}
+	if _, _, err := s.FindSnapshot(ctx, snapshot.Path("/missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected error finding the snapshot of a missing path: got %v, want %v", err, ErrNotFound)
+	}
+
+	malformed, err := s.StoreObject(ctx, strings.NewReader("not a snapshot"))
+	if err != nil {
+		t.Fatalf("failure storing a malformed snapshot: %v", err)
+	}
+	if _, err := s.ReadSnapshot(ctx, malformed); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unexpected error reading a malformed snapshot: got %v, want %v", err, ErrCorrupt)
+	}
+	if err := s.StoreVerifiedObject(ctx, strings.NewReader("other contents"), missing); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unexpected error storing mismatched contents: got %v, want %v", err, ErrCorrupt)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// Objects can be offloaded from an archive to a cheaper remote, such as
+// one backed by cold storage. Each offloaded object is replaced by a
+// small stub recording which remote holds it and how large it is, and
+// reads of the object fail with a `*TieredError` until it is stored
+// again.
+
+// TieredError is the error returned when reading an object that has been offloaded to a remote.
+type TieredError struct {
+	// Hash is the hash of the offloaded object.
+	Hash *snapshot.Hash
+
+	// Remote is the name of the remote holding the object.
+	Remote string
+}
+
+// Error implements the `error` interface.
+func (e *TieredError) Error() string {
+	return fmt.Sprintf("the object %q has been offloaded to the remote %q", e.Hash, e.Remote)
+}
+
+// Unwrap returns `ErrNotFound`, as the object is not available locally.
+func (e *TieredError) Unwrap() error {
+	return ErrNotFound
+}
+
+// Stub describes an object that has been offloaded to a remote.
+type Stub struct {
+	// Hash is the hash of the offloaded object.
+	Hash *snapshot.Hash
+
+	// Remote is the name of the remote holding the object.
+	Remote string
+
+	// Size is the size of the object in bytes.
+	Size int64
+}
+
+func (s *LocalFiles) tieredDir() string {
+	return filepath.Join(s.ArchiveDir, "tiered")
+}
+
+// stubFile returns the location of the stub for the offloaded object `h`.
+func (s *LocalFiles) stubFile(h *snapshot.Hash) string {
+	dir, name := objectName(h, s.tieredDir())
+	return filepath.Join(dir, name)
+}
+
+func parseStub(h *snapshot.Hash, contents string) (*Stub, error) {
+	name, size, ok := strings.Cut(strings.TrimSpace(contents), " ")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed stub %q for the object %q", ErrCorrupt, contents, h)
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed size in the stub for the object %q: %v", ErrCorrupt, h, err)
+	}
+	return &Stub{Hash: h, Remote: name, Size: n}, nil
+}
+
+// FindStub returns the stub of the object `h`, if it has been offloaded.
+//
+// If the object has not been offloaded, then the returned error satisfies `os.IsNotExist`.
+func (s *LocalFiles) FindStub(ctx context.Context, h *snapshot.Hash) (*Stub, error) {
+	bs, err := os.ReadFile(s.stubFile(h))
+	if err != nil {
+		return nil, err
+	}
+	return parseStub(h, string(bs))
+}
+
+// ListStubs returns the stubs of every object offloaded from the archive.
+func (s *LocalFiles) ListStubs(ctx context.Context) ([]*Stub, error) {
+	root := s.tieredDir()
+	var stubs []*Stub
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%w: unexpected file %q in the offloaded objects", ErrCorrupt, path)
+		}
+		h, err := snapshot.ParseHash(parts[0] + ":" + strings.ReplaceAll(parts[1], "/", ""))
+		if err != nil {
+			return fmt.Errorf("%w: unexpected file %q in the offloaded objects: %v", ErrCorrupt, path, err)
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stub, err := parseStub(h, string(bs))
+		if err != nil {
+			return err
+		}
+		stubs = append(stubs, stub)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failure listing the offloaded objects: %w", err)
+	}
+	return stubs, nil
+}
+
+// OffloadObject replaces the object `h` with a stub recording that it is held by the named remote.
+//
+// The caller is responsible for making sure that the remote does hold
+// the object before calling this. The generation of the archive changes
+// once the object has been removed. Objects are not offloaded from
+// append-only archives, since those promise never to lose anything.
+func (s *LocalFiles) OffloadObject(ctx context.Context, h *snapshot.Hash, remoteName string) error {
+	if s.AppendOnly() {
+		return fmt.Errorf("cannot offload the object %q from an append-only archive", h)
+	}
+	if !validStubRemote(remoteName) {
+		return fmt.Errorf("invalid remote name %q", remoteName)
+	}
+	objFile := objectFile(h, s.ArchiveDir)
+	info, err := os.Stat(objFile)
+	if err != nil {
+		return fmt.Errorf("failure reading the object %q: %w", h, err)
+	}
+	stubFile := s.stubFile(h)
+	if err := s.mkdirAll(filepath.Dir(stubFile)); err != nil {
+		return fmt.Errorf("failure creating the stub dir for %q: %w", h, err)
+	}
+	stub := fmt.Sprintf("%s %d\n", remoteName, info.Size())
+	if err := s.writeFileAtomically(ctx, stubFile, []byte(stub), 0600); err != nil {
+		return fmt.Errorf("failure writing the stub for %q: %w", h, err)
+	}
+	if err := os.Remove(objFile); err != nil {
+		return fmt.Errorf("failure removing the offloaded object %q: %w", h, err)
+	}
+	return s.NewGeneration(ctx)
+}
+
+func validStubRemote(name string) bool {
+	return len(name) > 0 && !strings.ContainsAny(name, " \t\n")
+}
+
+// removeStub removes the stub of the object `h`, if it has one, now that the object is stored again.
+func (s *LocalFiles) removeStub(h *snapshot.Hash) error {
+	if err := os.Remove(s.stubFile(h)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failure removing the stub for %q: %w", h, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOffloadObject(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalFiles{ArchiveDir: filepath.Join(t.TempDir(), "archive")}
+	h, err := s.StoreObject(ctx, strings.NewReader("rarely read"))
+	if err != nil {
+		t.Fatalf("failure storing the example object: %v", err)
+	}
+	before, err := s.Generation()
+	if err != nil {
+		t.Fatalf("failure reading the initial generation: %v", err)
+	}
+	if err := s.OffloadObject(ctx, h, "glacier"); err != nil {
+		t.Fatalf("failure offloading the example object: %v", err)
+	}
+	if after, err := s.Generation(); err != nil {
+		t.Errorf("failure reading the generation after offloading: %v", err)
+	} else if after == "" || after == before {
+		t.Errorf("the generation was not changed by offloading: got %q, previously %q", after, before)
+	}
+	if s.HasObject(ctx, h) {
+		t.Error("the offloaded object is still reported as available")
+	}
+	_, err = s.ReadObject(ctx, h)
+	var tiered *TieredError
+	if !errors.As(err, &tiered) || tiered.Remote != "glacier" || !tiered.Hash.Equal(h) {
+		t.Errorf("unexpected error reading the offloaded object: %v", err)
+	} else if !errors.Is(err, ErrNotFound) {
+		t.Errorf("the error reading the offloaded object does not match ErrNotFound: %v", err)
+	}
+	stubs, err := s.ListStubs(ctx)
+	if err != nil {
+		t.Fatalf("failure listing the stubs: %v", err)
+	}
+	if len(stubs) != 1 || !stubs[0].Hash.Equal(h) || stubs[0].Remote != "glacier" || stubs[0].Size != int64(len("rarely read")) {
+		t.Errorf("unexpected stubs: %+v", stubs)
+	}
+
+	// Storing the object again, such as when thawing it, removes the stub.
+	if err := s.StoreVerifiedObject(ctx, strings.NewReader("rarely read"), h); err != nil {
+		t.Fatalf("failure storing the object again: %v", err)
+	}
+	if _, err := s.FindStub(ctx, h); err == nil {
+		t.Error("the stub was not removed when the object was stored again")
+	}
+	reader, err := s.ReadObject(ctx, h)
+	if err != nil {
+		t.Fatalf("failure reading the restored object: %v", err)
+	}
+	defer reader.Close()
+	if contents, err := io.ReadAll(reader); err != nil || string(contents) != "rarely read" {
+		t.Errorf("unexpected contents of the restored object: %q, %v", contents, err)
+	}
+
+	if err := s.SetAppendOnly(ctx); err != nil {
+		t.Fatalf("failure marking the archive as append-only: %v", err)
+	}
+	if err := s.OffloadObject(ctx, h, "glacier"); err == nil {
+		t.Error("unexpected success offloading an object from an append-only archive")
+	}
+}
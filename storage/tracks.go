@@ -0,0 +1,99 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// ValidTrackID reports whether or not the given string can be used as a track ID.
+//
+// Track IDs must be non-empty, and may only contain ASCII letters,
+// digits, dots, dashes, and underscores. They may not start with a dot.
+func ValidTrackID(id string) bool {
+	if len(id) == 0 || id[0] == '.' {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '.' && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LocalFiles) trackFile(id string) string {
+	return filepath.Join(s.ArchiveDir, "tracks", id)
+}
+
+// FindTrack returns the latest snapshot recorded for the given track.
+//
+// A track names a logical history independently of where its files are
+// located on any particular machine, so that the same history can be
+// shared between machines that store the files at different paths.
+func (s *LocalFiles) FindTrack(ctx context.Context, id string) (*snapshot.Hash, error) {
+	if !ValidTrackID(id) {
+		return nil, fmt.Errorf("invalid track ID %q", id)
+	}
+	bs, err := os.ReadFile(s.trackFile(id))
+	if err != nil {
+		return nil, err
+	}
+	h, err := snapshot.ParseHash(string(bs))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing the hash %q for the track %q: %w", bs, id, err)
+	}
+	return h, nil
+}
+
+// StoreTrack records the snapshot `h` as the latest snapshot of the given track.
+//
+// If the archive is append-only, then `h` must descend from the
+// snapshot previously recorded for the track.
+func (s *LocalFiles) StoreTrack(ctx context.Context, id string, h *snapshot.Hash) error {
+	if !ValidTrackID(id) {
+		return fmt.Errorf("invalid track ID %q", id)
+	}
+	if s.AppendOnly() {
+		prev, err := s.FindTrack(ctx, id)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failure looking up the current snapshot of the track %q: %w", id, err)
+		}
+		if prev != nil {
+			f, err := s.ReadSnapshot(ctx, h)
+			if err != nil {
+				return fmt.Errorf("failure reading the snapshot %q: %w", h, err)
+			}
+			if ok, err := s.descendsFrom(ctx, prev, h, f); err != nil {
+				return err
+			} else if !ok {
+				return &NotFastForwardError{Path: snapshot.Path(id), Prev: prev, New: h}
+			}
+		}
+	}
+	trackFile := s.trackFile(id)
+	if err := s.mkdirAll(filepath.Dir(trackFile)); err != nil {
+		return fmt.Errorf("failure creating the tracks dir: %w", err)
+	}
+	if err := s.writeFileAtomically(ctx, trackFile, []byte(h.String()), 0600); err != nil {
+		return fmt.Errorf("failure recording %q for the track %q: %w", h, id, err)
+	}
+	return nil
+}
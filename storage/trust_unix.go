@@ -0,0 +1,40 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// trustedFile reports whether or not the file described by `info` can
+// only be modified by the current user, or by the owner of the archive
+// described by `archiveInfo`.
+func trustedFile(info, archiveInfo os.FileInfo) bool {
+	if info.Mode().Perm()&0022 != 0 {
+		return false
+	}
+	fileStat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || fileStat == nil {
+		return false
+	}
+	archiveStat, ok := archiveInfo.Sys().(*syscall.Stat_t)
+	if !ok || archiveStat == nil {
+		return false
+	}
+	return int(fileStat.Uid) == os.Getuid() || fileStat.Uid == archiveStat.Uid
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stores keeps track of the archives, or stores, that a user has.
+//
+// Every user has a store named "default", which holds the archive in
+// ~/.rvcs/archive. Additional stores are registered by name, so that
+// users can keep separate stores, such as for work and personal data, or
+// keep a store on an external drive. One of the stores is chosen as the
+// one used when no other store is selected.
+//
+// A store can also be shared by several users, such as one on a shared
+// file system. Each user then keeps their own state for that store, such
+// as the path info cache and the reflog, under ~/.rvcs/shared.
+package stores
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	// DefaultName is the name of the store that every user has.
+	DefaultName = "default"
+
+	// EnvVar is the environment variable that selects a store.
+	EnvVar = "RVCS_STORE"
+
+	registryFile     = "stores"
+	defaultStoreFile = "default-store"
+	storesDir        = "archives"
+	sharedStateDir   = "shared"
+)
+
+// Store is a named archive.
+type Store struct {
+	// Name is the name used to refer to the store.
+	Name string
+
+	// Dir is the absolute path of the archive directory of the store.
+	Dir string
+}
+
+// Root returns the directory holding the user's rvcs state, including the default store.
+func Root() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failure resolving the user's home dir: %w", err)
+	}
+	return filepath.Join(home, ".rvcs"), nil
+}
+
+// UserDir returns the directory holding the user's own state for the shared store in the archive directory `dir`.
+//
+// This is keyed by the directory rather than the name of the store, so
+// it is the same however the store is selected.
+func UserDir(root, dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(root, sharedStateDir, filepath.Base(dir)+"-"+hex.EncodeToString(sum[:8]))
+}
+
+// writeFileAtomically replaces the contents of the file `path`.
+func writeFileAtomically(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failure creating the directory of %q: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failure creating a temp file for %q: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failure writing %q: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failure writing %q: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failure writing %q: %w", path, err)
+	}
+	return nil
+}
+
+// List returns the stores of the user whose rvcs state is in `root`, sorted by name.
+//
+// The registry of stores has one store per line, with the name and
+// directory of the store separated by a tab.
+func List(root string) ([]*Store, error) {
+	stores := []*Store{{Name: DefaultName, Dir: filepath.Join(root, "archive")}}
+	bs, err := os.ReadFile(filepath.Join(root, registryFile))
+	if os.IsNotExist(err) {
+		return stores, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the registry of stores: %w", err)
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, dir, ok := strings.Cut(line, "\t")
+		if !ok || !storage.ValidTrackID(name) || !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("malformed store %q in the registry of stores", line)
+		}
+		stores = append(stores, &Store{Name: name, Dir: dir})
+	}
+	sort.Slice(stores, func(i, j int) bool {
+		return stores[i].Name < stores[j].Name
+	})
+	return stores, nil
+}
+
+// Find returns the store with the given name.
+func Find(root, name string) (*Store, error) {
+	stores, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stores {
+		if st.Name == name {
+			return st, nil
+		}
+	}
+	return nil, fmt.Errorf("no store named %q: %w", name, storage.ErrNotFound)
+}
+
+// Create registers a new store with the given name and archive directory, and creates that directory.
+//
+// If `dir` is empty, then the store is created in the user's rvcs state.
+func Create(root, name, dir string) (*Store, error) {
+	if !storage.ValidTrackID(name) {
+		return nil, fmt.Errorf("invalid store name %q", name)
+	}
+	stores, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stores {
+		if st.Name == name {
+			return nil, fmt.Errorf("a store named %q already exists in %q", name, st.Dir)
+		}
+	}
+	if len(dir) == 0 {
+		dir = filepath.Join(root, storesDir, name)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failure resolving the absolute path of %q: %w", dir, err)
+	}
+	if strings.Contains(dir, "\n") {
+		return nil, fmt.Errorf("unsupported store directory %q", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failure creating the store directory %q: %w", dir, err)
+	}
+	var lines []string
+	for _, st := range stores {
+		if st.Name != DefaultName {
+			lines = append(lines, st.Name+"\t"+st.Dir)
+		}
+	}
+	lines = append(lines, name+"\t"+dir)
+	if err := writeFileAtomically(filepath.Join(root, registryFile), []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return nil, fmt.Errorf("failure updating the registry of stores: %w", err)
+	}
+	return &Store{Name: name, Dir: dir}, nil
+}
+
+// Default returns the store used when no other store is selected.
+func Default(root string) (*Store, error) {
+	bs, err := os.ReadFile(filepath.Join(root, defaultStoreFile))
+	if os.IsNotExist(err) {
+		return Find(root, DefaultName)
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the default store: %w", err)
+	}
+	return Find(root, strings.TrimSpace(string(bs)))
+}
+
+// SetDefault makes the named store the one used when no other store is selected.
+func SetDefault(root, name string) error {
+	if _, err := Find(root, name); err != nil {
+		return err
+	}
+	if err := writeFileAtomically(filepath.Join(root, defaultStoreFile), []byte(name+"\n")); err != nil {
+		return fmt.Errorf("failure updating the default store: %w", err)
+	}
+	return nil
+}
+
+// Select returns the store selected by `selected`, which is either the
+// name of a store or the path of an archive directory.
+//
+// If `selected` is empty, then the store named by the `RVCS_STORE`
+// environment variable is used, and if that is not set, then the
+// default store is used. Names are checked before paths, so a relative
+// path that happens to match the name of a store should be written as
+// "./<PATH>". A value that could be a store name but matches none is only
+// used as a path if that directory already exists, so that a mistyped
+// name does not create a new archive. Stores selected by path have no name.
+func Select(root, selected string) (*Store, error) {
+	if len(selected) == 0 {
+		selected = os.Getenv(EnvVar)
+	}
+	if len(selected) == 0 {
+		return Default(root)
+	}
+	if storage.ValidTrackID(selected) {
+		st, err := Find(root, selected)
+		if err == nil {
+			return st, nil
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(selected); statErr != nil || !info.IsDir() {
+			return nil, err
+		}
+	}
+	dir, err := filepath.Abs(selected)
+	if err != nil {
+		return nil, fmt.Errorf("failure resolving the absolute path of the store %q: %w", selected, err)
+	}
+	return &Store{Dir: dir}, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stores
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestStores(t *testing.T) {
+	root := filepath.Join(t.TempDir(), ".rvcs")
+	t.Setenv(EnvVar, "")
+	defaultDir := filepath.Join(root, "archive")
+	if st, err := Select(root, ""); err != nil {
+		t.Fatalf("failure selecting the default store: %v", err)
+	} else if st.Name != DefaultName || st.Dir != defaultDir {
+		t.Errorf("unexpected default store: %+v", st)
+	}
+
+	work, err := Create(root, "work", "")
+	if err != nil {
+		t.Fatalf("failure creating the work store: %v", err)
+	}
+	if want := filepath.Join(root, "archives", "work"); work.Dir != want {
+		t.Errorf("unexpected directory of the work store: got %q, want %q", work.Dir, want)
+	}
+	if _, err := os.Stat(work.Dir); err != nil {
+		t.Errorf("the directory of the work store was not created: %v", err)
+	}
+	externalDir := filepath.Join(t.TempDir(), "external")
+	if _, err := Create(root, "external", externalDir); err != nil {
+		t.Fatalf("failure creating the external store: %v", err)
+	}
+	if _, err := Create(root, "work", externalDir); err == nil {
+		t.Error("unexpected success creating a duplicate store")
+	}
+	if _, err := Create(root, "../escape", ""); err == nil {
+		t.Error("unexpected success creating a store with an invalid name")
+	}
+
+	stores, err := List(root)
+	if err != nil {
+		t.Fatalf("failure listing the stores: %v", err)
+	}
+	var names []string
+	for _, st := range stores {
+		names = append(names, st.Name)
+	}
+	if got, want := len(names), 3; got != want || names[0] != DefaultName || names[1] != "external" || names[2] != "work" {
+		t.Errorf("unexpected stores: %q", names)
+	}
+
+	if err := SetDefault(root, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected result setting a missing store as the default: %v", err)
+	}
+	if err := SetDefault(root, "work"); err != nil {
+		t.Fatalf("failure setting the default store: %v", err)
+	}
+	if st, err := Select(root, ""); err != nil || st.Dir != work.Dir {
+		t.Errorf("unexpected store selected after changing the default: %+v, %v", st, err)
+	}
+	t.Setenv(EnvVar, "external")
+	if st, err := Select(root, ""); err != nil || st.Dir != externalDir {
+		t.Errorf("unexpected store selected by the environment: %+v, %v", st, err)
+	}
+	if st, err := Select(root, DefaultName); err != nil || st.Dir != defaultDir {
+		t.Errorf("unexpected store selected by name: %+v, %v", st, err)
+	}
+	otherDir := filepath.Join(t.TempDir(), "other")
+	if st, err := Select(root, otherDir); err != nil || st.Name != "" || st.Dir != otherDir {
+		t.Errorf("unexpected store selected by path: %+v, %v", st, err)
+	}
+	if st, err := Select(root, "wrok"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("unexpected result selecting a mistyped store name: %+v, %v", st, err)
+	}
+}
+
+func TestUserDir(t *testing.T) {
+	root := t.TempDir()
+	a := UserDir(root, "/srv/rvcs/team")
+	if got, want := filepath.Dir(a), filepath.Join(root, sharedStateDir); got != want {
+		t.Errorf("unexpected parent of the user directory %q: got %q, want %q", a, got, want)
+	}
+	if b := UserDir(root, "/mnt/rvcs/team"); a == b {
+		t.Errorf("stores with the same name in different directories share the user directory %q", a)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tier offloads the contents of old snapshots to a cheaper
+// remote, such as one backed by cold storage, and brings them back.
+//
+// Only the contents of regular files are offloaded. The snapshots
+// themselves and the directory trees stay in the archive, so the history
+// can still be browsed, but reading offloaded contents fails until they
+// are thawed.
+package tier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// policyConfig is the name of the archive config file holding the tiering policy.
+const policyConfig = "tiering"
+
+// Policy describes which objects are offloaded, and where to.
+type Policy struct {
+	// Remote is the name of the remote that objects are offloaded to.
+	Remote string
+
+	// OlderThan is how old a snapshot must be for the contents only it
+	// references to be offloaded.
+	OlderThan time.Duration
+}
+
+// IsZero reports whether or not the policy is unset.
+func (p *Policy) IsZero() bool {
+	return len(p.Remote) == 0 && p.OlderThan == 0
+}
+
+// ReadPolicy reads the tiering policy configured for the given archive.
+//
+// The config file has one setting per line, with the name and value of
+// the setting separated by a space. If no policy is configured, then
+// the returned policy is zero.
+func ReadPolicy(s *storage.LocalFiles) (*Policy, error) {
+	bs, err := os.ReadFile(s.ConfigFile(policyConfig))
+	if os.IsNotExist(err) {
+		return &Policy{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the tiering policy: %w", err)
+	}
+	p := &Policy{}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed tiering policy setting %q", line)
+		}
+		switch name {
+		case "remote":
+			p.Remote = value
+		case "older-than":
+			if p.OlderThan, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("malformed tiering policy setting %q: %w", line, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown tiering policy setting %q", name)
+		}
+	}
+	return p, nil
+}
+
+// WritePolicy saves the tiering policy for the given archive.
+func WritePolicy(ctx context.Context, s *storage.LocalFiles, p *Policy) error {
+	if strings.ContainsAny(p.Remote, "\n") {
+		return fmt.Errorf("invalid remote name %q", p.Remote)
+	}
+	var lines []string
+	if len(p.Remote) > 0 {
+		lines = append(lines, "remote "+p.Remote+"\n")
+	}
+	if p.OlderThan != 0 {
+		lines = append(lines, "older-than "+p.OlderThan.String()+"\n")
+	}
+	if err := s.WriteConfigFile(ctx, policyConfig, []byte(strings.Join(lines, ""))); err != nil {
+		return fmt.Errorf("failure writing the tiering policy: %w", err)
+	}
+	return nil
+}
+
+// walker visits the regular files in snapshots, skipping snapshots it has already visited.
+type walker struct {
+	s       *storage.LocalFiles
+	visited map[snapshot.Hash]struct{}
+}
+
+func newWalker(s *storage.LocalFiles) *walker {
+	return &walker{s: s, visited: make(map[snapshot.Hash]struct{})}
+}
+
+// walk calls `visit` for each regular file in the snapshot `h` of the path `p`.
+func (w *walker) walk(ctx context.Context, p snapshot.Path, h *snapshot.Hash, visit func(snapshot.Path, *snapshot.File) error) error {
+	if _, ok := w.visited[*h]; ok {
+		return nil
+	}
+	w.visited[*h] = struct{}{}
+	f, err := w.s.ReadSnapshot(ctx, h)
+	if err != nil {
+		return fmt.Errorf("failure reading the snapshot %q of %q: %w", h, p, err)
+	}
+	if f.Contents == nil || f.IsLink() {
+		return nil
+	}
+	if !f.IsDir() {
+		return visit(p, f)
+	}
+	tree, err := w.s.ListDirectorySnapshotContents(ctx, h, f)
+	if err != nil {
+		return fmt.Errorf("failure reading the contents of the snapshot %q of %q: %w", h, p, err)
+	}
+	for child, childHash := range tree {
+		if err := w.walk(ctx, p.Join(child), childHash, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Candidates returns the objects that are only referenced by snapshots taken before `cutoff`.
+//
+// The history of every path with a snapshot in the archive is checked.
+// The latest snapshot of each path, and any snapshot without a recorded
+// time, are never treated as old, and objects that are not stored in the
+// archive itself are skipped.
+func Candidates(ctx context.Context, s *storage.LocalFiles, cutoff time.Time) ([]*snapshot.Hash, error) {
+	paths, err := s.TrackedPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type root struct {
+		p snapshot.Path
+		h *snapshot.Hash
+	}
+	var recent, old []root
+	seen := make(map[snapshot.Hash]struct{})
+	for _, p := range paths {
+		head, _, err := s.FindSnapshot(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("failure looking up the latest snapshot of %q: %w", p, err)
+		}
+		queue := []*snapshot.Hash{head}
+		for len(queue) > 0 {
+			h := queue[0]
+			queue = queue[1:]
+			if _, ok := seen[*h]; ok {
+				continue
+			}
+			seen[*h] = struct{}{}
+			f, err := s.ReadSnapshot(ctx, h)
+			if err != nil {
+				return nil, fmt.Errorf("failure reading the snapshot %q of %q: %w", h, p, err)
+			}
+			if t, ok := f.Time(); ok && t.Before(cutoff) && !h.Equal(head) {
+				old = append(old, root{p, h})
+			} else {
+				recent = append(recent, root{p, h})
+			}
+			queue = append(queue, f.Parents...)
+		}
+	}
+	keep := make(map[snapshot.Hash]struct{})
+	w := newWalker(s)
+	for _, r := range recent {
+		if err := w.walk(ctx, r.p, r.h, func(_ snapshot.Path, f *snapshot.File) error {
+			keep[*f.Contents] = struct{}{}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	var candidates []*snapshot.Hash
+	for _, r := range old {
+		if err := w.walk(ctx, r.p, r.h, func(_ snapshot.Path, f *snapshot.File) error {
+			if _, ok := keep[*f.Contents]; ok {
+				return nil
+			}
+			keep[*f.Contents] = struct{}{}
+			if s.HasObject(ctx, f.Contents) {
+				candidates = append(candidates, f.Contents)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+// Result summarizes the objects offloaded by `Offload`.
+type Result struct {
+	// Objects is the number of objects offloaded.
+	Objects int
+
+	// Bytes is the combined size of the offloaded objects.
+	Bytes int64
+}
+
+// Offload copies each of the given objects to the remote `r`, and then
+// replaces the local copy with a stub.
+//
+// Objects that are held by a base archive rather than the archive
+// itself are skipped.
+func Offload(ctx context.Context, s *storage.LocalFiles, r *remote.Remote, objects []*snapshot.Hash) (*Result, error) {
+	b, err := r.Backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	result := &Result{}
+	for _, h := range objects {
+		size, err := s.ObjectSize(ctx, h)
+		if err != nil {
+			return result, fmt.Errorf("failure reading the size of the object %q: %w", h, err)
+		}
+		if !b.HasObject(ctx, h) {
+			reader, err := s.ReadObject(ctx, h)
+			if err != nil {
+				return result, fmt.Errorf("failure reading the object %q: %w", h, err)
+			}
+			err = b.WriteObject(ctx, h, reader)
+			reader.Close()
+			if err != nil {
+				return result, fmt.Errorf("failure copying the object %q to the remote %q: %w", h, r.Name, err)
+			}
+			if !b.HasObject(ctx, h) {
+				return result, fmt.Errorf("the remote %q does not have the object %q after it was copied", r.Name, h)
+			}
+		}
+		if err := s.OffloadObject(ctx, h, r.Name); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+		result.Objects++
+		result.Bytes += size
+	}
+	return result, nil
+}
+
+// Offloaded is an offloaded object, along with a path that it is the contents of.
+type Offloaded struct {
+	*storage.Stub
+
+	// Path is the path of a file with the offloaded object as its contents.
+	Path snapshot.Path
+}
+
+// FindOffloaded returns the offloaded objects in the snapshot `h` of the path `p`.
+func FindOffloaded(ctx context.Context, s *storage.LocalFiles, p snapshot.Path, h *snapshot.Hash) ([]*Offloaded, error) {
+	var offloaded []*Offloaded
+	seen := make(map[snapshot.Hash]struct{})
+	err := newWalker(s).walk(ctx, p, h, func(p snapshot.Path, f *snapshot.File) error {
+		if _, ok := seen[*f.Contents]; ok {
+			return nil
+		}
+		seen[*f.Contents] = struct{}{}
+		stub, err := s.FindStub(ctx, f.Contents)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		offloaded = append(offloaded, &Offloaded{Stub: stub, Path: p})
+		return nil
+	})
+	return offloaded, err
+}
+
+// State is the progress of thawing an offloaded object.
+type State string
+
+const (
+	// Thawed means that the object was copied back into the archive.
+	Thawed State = "thawed"
+
+	// Pending means that the remote is still retrieving the object from
+	// cold storage, so it cannot be copied back yet.
+	Pending State = "pending"
+)
+
+// Thaw copies each of the given offloaded objects back into the archive,
+// if its remote can read it, and otherwise asks the remote to retrieve it.
+//
+// The returned states correspond to the given stubs. Objects that are
+// pending should be thawed again once their remotes have retrieved them.
+func Thaw(ctx context.Context, s *storage.LocalFiles, stubs []*storage.Stub) ([]State, error) {
+	remotes, err := remote.ReadRemotes(s)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*remote.Remote)
+	for _, r := range remotes {
+		byName[r.Name] = r
+	}
+	backends := make(map[string]remote.Backend)
+	defer func() {
+		for _, b := range backends {
+			b.Close()
+		}
+	}()
+	states := make([]State, len(stubs))
+	for i, stub := range stubs {
+		b, ok := backends[stub.Remote]
+		if !ok {
+			r, ok := byName[stub.Remote]
+			if !ok {
+				return states, fmt.Errorf("the object %q was offloaded to the remote %q, which is no longer configured", stub.Hash, stub.Remote)
+			}
+			if b, err = r.Backend(ctx); err != nil {
+				return states, err
+			}
+			backends[stub.Remote] = b
+		}
+		ready, err := remote.ThawObject(ctx, b, stub.Hash)
+		if err != nil {
+			return states, fmt.Errorf("failure thawing the object %q from the remote %q: %w", stub.Hash, stub.Remote, err)
+		}
+		if !ready {
+			states[i] = Pending
+			continue
+		}
+		reader, err := b.ReadObject(ctx, stub.Hash)
+		if err != nil {
+			return states, fmt.Errorf("failure reading the object %q from the remote %q: %w", stub.Hash, stub.Remote, err)
+		}
+		err = s.StoreVerifiedObject(ctx, reader, stub.Hash)
+		reader.Close()
+		if err != nil {
+			return states, fmt.Errorf("failure storing the thawed object %q: %w", stub.Hash, err)
+		}
+		states[i] = Thawed
+	}
+	return states, nil
+}
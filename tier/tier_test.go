@@ -0,0 +1,126 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/remote"
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(t.TempDir(), "archive")}
+	if p, err := ReadPolicy(s); err != nil || !p.IsZero() {
+		t.Errorf("unexpected policy before one was configured: %+v, %v", p, err)
+	}
+	want := &Policy{Remote: "glacier", OlderThan: 90 * 24 * time.Hour}
+	if err := WritePolicy(ctx, s, want); err != nil {
+		t.Fatalf("failure writing the policy: %v", err)
+	}
+	if got, err := ReadPolicy(s); err != nil || *got != *want {
+		t.Errorf("unexpected policy: got %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestOffloadAndThaw(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	cold := &remote.Remote{Name: "cold", ArchiveDir: filepath.Join(dir, "cold")}
+	if err := remote.WriteRemotes(ctx, s, []*remote.Remote{cold}); err != nil {
+		t.Fatalf("failure configuring the remote: %v", err)
+	}
+	root := filepath.Join(dir, "example")
+	if err := os.Mkdir(root, 0700); err != nil {
+		t.Fatalf("failure creating the example dir: %v", err)
+	}
+	var snapshots []*snapshot.Hash
+	for _, contents := range []string{"old contents", "new contents"} {
+		files := map[string]string{"changed.txt": contents, "unchanged.txt": "same contents"}
+		for name, contents := range files {
+			if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0600); err != nil {
+				t.Fatalf("failure writing the example file %q: %v", name, err)
+			}
+		}
+		h, _, err := snapshot.NewSnapshotter(s, snapshot.WithRecordTime(true)).Snapshot(ctx, snapshot.Path(root))
+		if err != nil {
+			t.Fatalf("failure snapshotting the example dir: %v", err)
+		}
+		snapshots = append(snapshots, h)
+	}
+
+	if candidates, err := Candidates(ctx, s, time.Now().Add(-time.Hour)); err != nil || len(candidates) != 0 {
+		t.Errorf("unexpected candidates older than an hour: %v, %v", candidates, err)
+	}
+	candidates, err := Candidates(ctx, s, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failure finding the candidates: %v", err)
+	}
+	oldContents, err := snapshot.NewHash(strings.NewReader("old contents"))
+	if err != nil {
+		t.Fatalf("failure hashing the old contents: %v", err)
+	}
+	if len(candidates) != 1 || !candidates[0].Equal(oldContents) {
+		t.Fatalf("unexpected candidates: got %v, want [%v]", candidates, oldContents)
+	}
+
+	result, err := Offload(ctx, s, cold, candidates)
+	if err != nil {
+		t.Fatalf("failure offloading the candidates: %v", err)
+	}
+	if result.Objects != 1 || result.Bytes != int64(len("old contents")) {
+		t.Errorf("unexpected offload result: %+v", result)
+	}
+	var tiered *storage.TieredError
+	if _, err := s.ReadObject(ctx, oldContents); !errors.As(err, &tiered) {
+		t.Errorf("unexpected result reading the offloaded object: %v", err)
+	}
+	if again, err := Candidates(ctx, s, time.Now().Add(time.Hour)); err != nil || len(again) != 0 {
+		t.Errorf("unexpected candidates after offloading: %v, %v", again, err)
+	}
+
+	offloaded, err := FindOffloaded(ctx, s, snapshot.Path(root), snapshots[0])
+	if err != nil {
+		t.Fatalf("failure finding the offloaded objects: %v", err)
+	}
+	if want := snapshot.Path(filepath.Join(root, "changed.txt")); len(offloaded) != 1 || offloaded[0].Path != want || offloaded[0].Remote != "cold" {
+		t.Fatalf("unexpected offloaded objects: %+v", offloaded)
+	}
+	states, err := Thaw(ctx, s, []*storage.Stub{offloaded[0].Stub})
+	if err != nil {
+		t.Fatalf("failure thawing the offloaded object: %v", err)
+	}
+	if len(states) != 1 || states[0] != Thawed {
+		t.Errorf("unexpected thaw states: %v", states)
+	}
+	reader, err := s.ReadObject(ctx, oldContents)
+	if err != nil {
+		t.Fatalf("failure reading the thawed object: %v", err)
+	}
+	defer reader.Close()
+	if contents, err := io.ReadAll(reader); err != nil || string(contents) != "old contents" {
+		t.Errorf("unexpected contents of the thawed object: %q, %v", contents, err)
+	}
+}
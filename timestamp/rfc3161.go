@@ -0,0 +1,454 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	// Register the hash functions that timestamp tokens may be signed with.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+)
+
+// maxResponseSize is the largest response accepted from a timestamping authority.
+const maxResponseSize = 1 << 20
+
+var (
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// digestAlgorithms maps the supported digest algorithm identifiers to their hash functions.
+var digestAlgorithms = map[string]crypto.Hash{
+	oidSHA1.String():   crypto.SHA1,
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+// The following types mirror the ASN.1 structures defined in RFC 3161 and RFC 5652.
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Attestation describes a verified timestamp token.
+type Attestation struct {
+	// Time is when the timestamping authority attested that the snapshot existed.
+	Time time.Time
+
+	// Authority is the subject of the certificate that signed the token.
+	Authority string
+
+	// SerialNumber is the serial number that the authority assigned to the token.
+	SerialNumber *big.Int
+}
+
+// imprint returns the message imprint identifying the snapshot `h`.
+//
+// The snapshot hash is itself a SHA-256 digest of the snapshot, so it is used as-is.
+func imprint(h *snapshot.Hash) (messageImprint, error) {
+	if h.Function() != "sha256" {
+		return messageImprint{}, fmt.Errorf("unsupported hash function %q for timestamping", h.Function())
+	}
+	digest, err := hex.DecodeString(h.HexContents())
+	if err != nil {
+		return messageImprint{}, fmt.Errorf("malformed hash %q: %w", h, err)
+	}
+	return messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+		HashedMessage: digest,
+	}, nil
+}
+
+// Request asks the timestamping authority at `url` to timestamp the snapshot `h`.
+//
+// The returned value is the DER encoded timestamp token, which is
+// checked to match the request but is not otherwise verified.
+func Request(ctx context.Context, url string, h *snapshot.Hash) ([]byte, error) {
+	mi, err := imprint(h)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failure generating a nonce: %w", err)
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: mi,
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failure encoding the timestamp request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("failure creating the timestamp request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/timestamp-query")
+	httpReq.Header.Set("Accept", "application/timestamp-reply")
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failure sending the timestamp request to %q: %w", url, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the timestamping authority %q responded with %q", url, httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failure reading the timestamp response from %q: %w", url, err)
+	}
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("malformed timestamp response from %q: %w", url, err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("malformed timestamp response from %q: trailing data", url)
+	}
+	// The status is either "granted" (0) or "grantedWithMods" (1).
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("the timestamping authority %q rejected the request with status %d: %q", url, resp.Status.Status, resp.Status.StatusString)
+	}
+	token := resp.TimeStampToken.FullBytes
+	info, _, err := parseToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed timestamp token from %q: %w", url, err)
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("the timestamp token from %q does not match the request nonce", url)
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, mi.HashedMessage) {
+		return nil, fmt.Errorf("the timestamp token from %q is for a different hash", url)
+	}
+	return token, nil
+}
+
+// parseToken parses the DER encoded timestamp token `token`.
+func parseToken(token []byte) (*tstInfo, *signedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, nil, err
+	} else if len(rest) > 0 {
+		return nil, nil, errors.New("trailing data after the token")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("unexpected content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, fmt.Errorf("malformed signed data: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, fmt.Errorf("unexpected signed content type %v", sd.EncapContentInfo.EContentType)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, nil, fmt.Errorf("malformed timestamp info: %w", err)
+	}
+	return &info, &sd, nil
+}
+
+// signerCertificate returns the certificate in `certs` identified by `sid`.
+func signerCertificate(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, errors.New("the token does not include the signer's certificate")
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("malformed signer identifier: %w", err)
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("the token does not include the signer's certificate")
+}
+
+// signatureAlgorithm returns the x509 signature algorithm for a signature by `cert` over a `digest` hash.
+func signatureAlgorithm(alg asn1.ObjectIdentifier, digest crypto.Hash, cert *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	switch {
+	case alg.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case alg.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case alg.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case alg.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case alg.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case alg.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case alg.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+	// Some signers only identify the key type, leaving the hash to the digest algorithm.
+	_, isRSA := cert.PublicKey.(*rsa.PublicKey)
+	_, isECDSA := cert.PublicKey.(*ecdsa.PublicKey)
+	switch {
+	case alg.Equal(oidRSAEncryption) && isRSA:
+		switch digest {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case alg.Equal(oidECPublicKey) && isECDSA:
+		switch digest {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v", alg)
+}
+
+// checkSignedAttributes verifies that the signed attributes `raw` of a
+// timestamp token match its contents, whose digest is `digest`.
+//
+// The returned value is the encoding of the attributes that was signed.
+func checkSignedAttributes(raw asn1.RawValue, digest []byte) ([]byte, error) {
+	if len(raw.FullBytes) == 0 {
+		return nil, errors.New("the token has no signed attributes")
+	}
+	// The signature covers the attributes encoded as a SET rather than with their implicit tag.
+	signed := append([]byte(nil), raw.FullBytes...)
+	signed[0] = 0x31
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return nil, fmt.Errorf("malformed signed attributes: %w", err)
+	}
+	var contentTypeOK, digestOK bool
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			continue
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &ct); err == nil {
+				contentTypeOK = ct.Equal(oidTSTInfo)
+			}
+		case attr.Type.Equal(oidMessageDigest):
+			var md []byte
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &md); err == nil {
+				digestOK = bytes.Equal(md, digest)
+			}
+		}
+	}
+	if !contentTypeOK {
+		return nil, errors.New("the signed content type does not match")
+	}
+	if !digestOK {
+		return nil, errors.New("the signed message digest does not match the timestamp info")
+	}
+	return signed, nil
+}
+
+// Verify checks that `token` is a validly signed timestamp token for the snapshot `h`.
+//
+// The certificate that signed the token must chain up to one of `roots`
+// and be valid for timestamping. If `roots` is nil, then the system's
+// trusted roots are used.
+func Verify(token []byte, h *snapshot.Hash, roots *x509.CertPool) (*Attestation, error) {
+	info, sd, err := parseToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed timestamp token: %w", err)
+	}
+	mi, err := imprint(h)
+	if err != nil {
+		return nil, err
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(mi.HashAlgorithm.Algorithm) || !bytes.Equal(info.MessageImprint.HashedMessage, mi.HashedMessage) {
+		return nil, fmt.Errorf("the timestamp token is not for the snapshot %q", h)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("the timestamp token has %d signers rather than one", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("malformed certificates in the timestamp token: %w", err)
+		}
+	}
+	cert, err := signerCertificate(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+	digestAlg, ok := digestAlgorithms[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+	hasher := digestAlg.New()
+	hasher.Write(sd.EncapContentInfo.EContent)
+	signed, err := checkSignedAttributes(si.SignedAttrs, hasher.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	sigAlg, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, digestAlg, cert)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.CheckSignature(sigAlg, signed, si.Signature); err != nil {
+		return nil, fmt.Errorf("invalid signature on the timestamp token: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if c != cert {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("untrusted timestamping authority %q: %w", cert.Subject, err)
+	}
+	return &Attestation{
+		Time:         info.GenTime,
+		Authority:    cert.Subject.String(),
+		SerialNumber: info.SerialNumber,
+	}, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timestamp attests to when snapshots existed using RFC 3161 timestamping authorities.
+//
+// Timestamp tokens are stored as notes attached to the snapshot that
+// they timestamp, so they are carried along with the snapshot's notes.
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const (
+	// pemType is the PEM block type used for stored timestamp tokens.
+	pemType = "RFC3161 TIMESTAMP TOKEN"
+
+	// authorityHeader is the PEM header recording the URL of the authority that issued a token.
+	authorityHeader = "Authority"
+)
+
+// Token is a timestamp token stored for a snapshot.
+type Token struct {
+	// Note is the hash of the note holding the token.
+	Note *snapshot.Hash
+
+	// URL is the URL of the timestamping authority that issued the token.
+	URL string
+
+	// DER is the DER encoded token.
+	DER []byte
+}
+
+// Add requests a timestamp for the snapshot `h` from the timestamping
+// authority at `url`, verifies it, and stores it as a note on `h`.
+//
+// See `Verify` for how `roots` is used.
+func Add(ctx context.Context, s *storage.LocalFiles, url string, h *snapshot.Hash, roots *x509.CertPool) (*Attestation, error) {
+	token, err := Request(ctx, url, h)
+	if err != nil {
+		return nil, err
+	}
+	a, err := Verify(token, h, roots)
+	if err != nil {
+		return nil, fmt.Errorf("failure verifying the timestamp token from %q: %w", url, err)
+	}
+	var encoded bytes.Buffer
+	if err := pem.Encode(&encoded, &pem.Block{
+		Type:    pemType,
+		Headers: map[string]string{authorityHeader: url},
+		Bytes:   token,
+	}); err != nil {
+		return nil, fmt.Errorf("failure encoding the timestamp token: %w", err)
+	}
+	note, err := s.StoreObject(ctx, &encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failure storing the timestamp token: %w", err)
+	}
+	if err := s.AddNote(ctx, h, note); err != nil {
+		return nil, fmt.Errorf("failure attaching the timestamp token %q to %q: %w", note, h, err)
+	}
+	return a, nil
+}
+
+// List returns the timestamp tokens stored for the snapshot `h`.
+//
+// Notes that do not hold a timestamp token are ignored.
+func List(ctx context.Context, s *storage.LocalFiles, h *snapshot.Hash) ([]*Token, error) {
+	notes, err := s.ListNotes(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*Token
+	for _, note := range notes {
+		reader, err := s.ReadObject(ctx, note)
+		if err != nil {
+			return nil, fmt.Errorf("failure opening the note %q: %w", note, err)
+		}
+		contents, err := io.ReadAll(io.LimitReader(reader, 2*maxResponseSize))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failure reading the note %q: %w", note, err)
+		}
+		block, _ := pem.Decode(contents)
+		if block == nil || block.Type != pemType {
+			continue
+		}
+		tokens = append(tokens, &Token{
+			Note: note,
+			URL:  block.Headers[authorityHeader],
+			DER:  block.Bytes,
+		})
+	}
+	return tokens, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timestamp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+// fakeAuthority is a timestamping authority that signs every request with a self-signed certificate.
+type fakeAuthority struct {
+	t    *testing.T
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	now  time.Time
+}
+
+func newFakeAuthority(t *testing.T) *fakeAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failure generating the authority's key: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "Test TSA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failure creating the authority's certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failure parsing the authority's certificate: %v", err)
+	}
+	return &fakeAuthority{t: t, key: key, cert: cert, now: now}
+}
+
+func (a *fakeAuthority) marshal(val interface{}, params string) []byte {
+	encoded, err := asn1.MarshalWithParams(val, params)
+	if err != nil {
+		a.t.Fatalf("failure encoding %T: %v", val, err)
+	}
+	return encoded
+}
+
+// sign returns a timestamp token for the timestamp info `info`.
+func (a *fakeAuthority) sign(info tstInfo) []byte {
+	eContent := a.marshal(info, "")
+	digest := sha256.Sum256(eContent)
+	attrs := []attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: a.marshal(oidTSTInfo, "")}}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: a.marshal(digest[:], "")}}},
+	}
+	signedAttrs := a.marshal(attrs, "set")
+	attrsDigest := sha256.Sum256(signedAttrs)
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, attrsDigest[:])
+	if err != nil {
+		a.t.Fatalf("failure signing the timestamp: %v", err)
+	}
+	implicitAttrs := append([]byte(nil), signedAttrs...)
+	implicitAttrs[0] = 0xa0
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: eContent},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: a.marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: a.cert.RawIssuer}, SerialNumber: a.cert.SerialNumber}, "")},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        asn1.RawValue{FullBytes: implicitAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	}
+	// The explicit tag is ignored when encoding raw values, so it is added here instead.
+	content := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.marshal(sd, "")}
+	return a.marshal(contentInfo{ContentType: oidSignedData, Content: content}, "")
+}
+
+func (a *fakeAuthority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		a.t.Errorf("failure reading the timestamp request: %v", err)
+		return
+	}
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		a.t.Errorf("malformed timestamp request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token := a.sign(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(7),
+		GenTime:        a.now,
+		Nonce:          req.Nonce,
+	})
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(a.marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	}, ""))
+}
+
+func TestTimestamp(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &storage.LocalFiles{ArchiveDir: filepath.Join(dir, "archive")}
+	file := filepath.Join(dir, "contract.txt")
+	if err := os.WriteFile(file, []byte("Signed and sealed"), 0600); err != nil {
+		t.Fatalf("failure creating the example file: %v", err)
+	}
+	h, _, err := snapshot.Current(ctx, s, snapshot.Path(file))
+	if err != nil {
+		t.Fatalf("failure snapshotting the example file: %v", err)
+	}
+
+	authority := newFakeAuthority(t)
+	server := httptest.NewServer(authority)
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.cert)
+
+	a, err := Add(ctx, s, server.URL, h, roots)
+	if err != nil {
+		t.Fatalf("failure timestamping the snapshot: %v", err)
+	}
+	if !a.Time.Equal(authority.now) || a.Authority != "CN=Test TSA" {
+		t.Errorf("unexpected attestation: %+v", a)
+	}
+	tokens, err := List(ctx, s, h)
+	if err != nil {
+		t.Fatalf("failure listing the timestamps: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].URL != server.URL {
+		t.Fatalf("unexpected timestamps: %+v", tokens)
+	}
+	if _, err := Verify(tokens[0].DER, h, roots); err != nil {
+		t.Errorf("failure verifying the stored timestamp: %v", err)
+	}
+
+	// The token does not attest to any other snapshot.
+	other, err := snapshot.NewHash(strings.NewReader("something else"))
+	if err != nil {
+		t.Fatalf("failure hashing the other contents: %v", err)
+	}
+	if _, err := Verify(tokens[0].DER, other, roots); err == nil {
+		t.Error("unexpectedly verified the timestamp for a different snapshot")
+	}
+
+	// The token is only trusted if the authority is.
+	if _, err := Verify(tokens[0].DER, h, x509.NewCertPool()); err == nil {
+		t.Error("unexpectedly verified the timestamp from an untrusted authority")
+	}
+
+	// Tampering with the token invalidates it.
+	tampered := append([]byte(nil), tokens[0].DER...)
+	tampered[len(tampered)-10] ^= 0xff
+	if _, err := Verify(tampered, h, roots); err == nil {
+		t.Error("unexpectedly verified a tampered timestamp")
+	}
+}
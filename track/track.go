@@ -0,0 +1,135 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package track defines the links between local paths and tracks.
+//
+// A track is a logical history identified by an ID rather than by a
+// path, so that files stored at different paths on different machines
+// can share a single history when synced through a remote.
+package track
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/recursive-version-control-system/snapshot"
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+const linksConfig = "tracks"
+
+// Link associates a track with the local path holding its files.
+type Link struct {
+	// ID is the ID of the track.
+	ID string
+
+	// Path is the absolute local path of the track's files.
+	Path snapshot.Path
+}
+
+// String implements the `fmt.Stringer` interface.
+//
+// The resulting value is suitable for serialization. Paths are quoted
+// as with `snapshot.Path.Display` if needed, so that each link is on a
+// single line. Since the paths are absolute, a quoted path can always
+// be told apart from an unquoted one.
+func (l *Link) String() string {
+	return l.ID + " " + l.Path.Display()
+}
+
+func parseLink(line string) (*Link, error) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 || !storage.ValidTrackID(parts[0]) {
+		return nil, fmt.Errorf("malformed track link %q", line)
+	}
+	p := parts[1]
+	if strings.HasPrefix(p, `"`) {
+		unquoted, err := strconv.Unquote(p)
+		if err != nil {
+			return nil, fmt.Errorf("malformed path in the track link %q: %w", line, err)
+		}
+		p = unquoted
+	}
+	return &Link{ID: parts[0], Path: snapshot.Path(p)}, nil
+}
+
+// ReadLinks reads the track links configured for the given archive, sorted by ID.
+func ReadLinks(s *storage.LocalFiles) ([]*Link, error) {
+	bs, err := os.ReadFile(s.ConfigFile(linksConfig))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failure reading the configured track links: %w", err)
+	}
+	var links []*Link
+	for _, line := range strings.Split(string(bs), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		l, err := parseLink(line)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ID < links[j].ID
+	})
+	return links, nil
+}
+
+// WriteLinks replaces the track links configured for the given archive.
+//
+// Each track may be linked to at most one path, and each path to at most one track.
+func WriteLinks(ctx context.Context, s *storage.LocalFiles, links []*Link) error {
+	ids := make(map[string]struct{})
+	paths := make(map[snapshot.Path]struct{})
+	var lines []string
+	for _, l := range links {
+		if !storage.ValidTrackID(l.ID) {
+			return fmt.Errorf("invalid track ID %q", l.ID)
+		}
+		if _, ok := ids[l.ID]; ok {
+			return fmt.Errorf("the track %q is linked more than once", l.ID)
+		}
+		if _, ok := paths[l.Path]; ok {
+			return fmt.Errorf("the path %q is linked to more than one track", l.Path)
+		}
+		ids[l.ID] = struct{}{}
+		paths[l.Path] = struct{}{}
+		lines = append(lines, l.String())
+	}
+	if err := s.WriteConfigFile(ctx, linksConfig, []byte(strings.Join(lines, "\n"))); err != nil {
+		return fmt.Errorf("failure writing the configured track links: %w", err)
+	}
+	return nil
+}
+
+// ForPath returns the ID of the track linked to the given path, if any.
+func ForPath(s *storage.LocalFiles, p snapshot.Path) (string, bool, error) {
+	links, err := ReadLinks(s)
+	if err != nil {
+		return "", false, err
+	}
+	for _, l := range links {
+		if l.Path == p {
+			return l.ID, true, nil
+		}
+	}
+	return "", false, nil
+}
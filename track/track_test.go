@@ -0,0 +1,58 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package track
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/recursive-version-control-system/storage"
+)
+
+func TestLinks(t *testing.T) {
+	ctx := context.Background()
+	s := &storage.LocalFiles{ArchiveDir: t.TempDir()}
+	links := []*Link{
+		{ID: "projects", Path: "/home/me/projects"},
+		{ID: "notes", Path: "/home/me/notes with spaces"},
+		{ID: "odd", Path: "/home/me/new\nline\t\x01"},
+	}
+	if err := WriteLinks(ctx, s, links); err != nil {
+		t.Fatalf("failure writing the track links: %v", err)
+	}
+	id, ok, err := ForPath(s, "/home/me/notes with spaces")
+	if err != nil {
+		t.Fatalf("failure looking up the track for a path: %v", err)
+	} else if !ok || id != "notes" {
+		t.Errorf("unexpected track for the path: got %q, %v; want %q, true", id, ok, "notes")
+	}
+	if id, ok, err := ForPath(s, "/home/me/new\nline\t\x01"); err != nil || !ok || id != "odd" {
+		t.Errorf("unexpected track for a path with control characters: got %q, %v, %v", id, ok, err)
+	}
+	if _, ok, err := ForPath(s, "/home/me/other"); err != nil || ok {
+		t.Errorf("unexpected track for an unlinked path: %v, %v", ok, err)
+	}
+
+	invalid := [][]*Link{
+		{{ID: "has space", Path: "/a"}},
+		{{ID: "a", Path: "/a"}, {ID: "a", Path: "/b"}},
+		{{ID: "a", Path: "/a"}, {ID: "b", Path: "/a"}},
+	}
+	for _, links := range invalid {
+		if err := WriteLinks(ctx, s, links); err == nil {
+			t.Errorf("unexpected success writing the invalid links %v", links)
+		}
+	}
+}